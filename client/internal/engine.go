@@ -181,6 +181,8 @@ type Engine struct {
 
 	// networkSerial is the latest CurrentSerial (state ID) of the network sent by the Management service
 	networkSerial uint64
+	// latestNetworkMap is the last applied full network map, used as the base for delta network maps
+	latestNetworkMap *mgmProto.NetworkMap
 
 	networkMonitor *networkmonitor.NetworkMonitor
 
@@ -199,6 +201,12 @@ type Engine struct {
 	// checks are the client-applied posture checks that need to be evaluated on the client
 	checks []*mgmProto.Checks
 
+	// loginExpiryNotified is set once the user was asked to re-authenticate before the login expires
+	loginExpiryNotified bool
+
+	// transferred accumulates the bytes transferred with the remote peers, reported to the management service
+	transferred transferCounter
+
 	relayManager *relayClient.Manager
 	stateManager *statemanager.Manager
 	srWatcher    *guard.SRWatcher
@@ -536,6 +544,7 @@ func (e *Engine) Start(netbirdConfig *mgmProto.NetbirdConfig, mgmtURL *url.URL)
 	e.receiveSignalEvents()
 	e.receiveManagementEvents()
 	e.receiveJobEvents()
+	e.startHandshakeReporter()
 
 	// starting network monitor at the very last to avoid disruptions
 	e.startNetworkMonitor()
@@ -883,6 +892,16 @@ func (e *Engine) handleSync(update *mgmProto.SyncResponse) error {
 		return nil
 	}
 
+	if nm.GetIsDelta() {
+		full, err := mergeNetworkMapDelta(e.latestNetworkMap, nm)
+		if err != nil {
+			return fmt.Errorf("merge delta network map: %w", err)
+		}
+		nm = full
+		update.NetworkMap = full
+		update.RemotePeers = full.RemotePeers
+	}
+
 	// Persist sync response under the dedicated lock (syncRespMux), not under syncMsgMux.
 	// Read the storage-enabled flag under the syncRespMux too.
 	e.syncRespMux.RLock()
@@ -902,6 +921,9 @@ func (e *Engine) handleSync(update *mgmProto.SyncResponse) error {
 	if err := e.updateNetworkMap(nm); err != nil {
 		return err
 	}
+	if e.networkSerial == nm.GetSerial() {
+		e.latestNetworkMap = nm
+	}
 
 	e.statusRecorder.PublishEvent(cProto.SystemEvent_INFO, cProto.SystemEvent_SYSTEM, "Network map updated", "", nil)
 
@@ -967,6 +989,15 @@ func (e *Engine) updateChecksIfNew(checks []*mgmProto.Checks) error {
 	}
 	e.checks = checks
 
+	if err := e.mgmClient.SyncMeta(e.getSystemInfo(checks)); err != nil {
+		log.Errorf("could not sync meta: error %s", err)
+		return err
+	}
+	return nil
+}
+
+// getSystemInfo collects the system info with the posture check results and the engine flags
+func (e *Engine) getSystemInfo(checks []*mgmProto.Checks) *system.Info {
 	info, err := system.GetInfoWithChecks(e.ctx, checks)
 	if err != nil {
 		log.Warnf("failed to get system info with checks: %v", err)
@@ -989,12 +1020,11 @@ func (e *Engine) updateChecksIfNew(checks []*mgmProto.Checks) error {
 		e.config.EnableSSHRemotePortForwarding,
 		e.config.DisableSSHAuth,
 	)
+	info.LastHandshake = e.latestHandshake()
+	info.RelayAddress = e.relayAddress()
+	info.RxBytes, info.TxBytes = e.transferredBytes()
 
-	if err := e.mgmClient.SyncMeta(info); err != nil {
-		log.Errorf("could not sync meta: error %s", err)
-		return err
-	}
-	return nil
+	return info
 }
 
 func (e *Engine) updateConfig(conf *mgmProto.PeerConfig) error {
@@ -1014,6 +1044,8 @@ func (e *Engine) updateConfig(conf *mgmProto.PeerConfig) error {
 		}
 	}
 
+	e.notifyLoginExpiration(conf)
+
 	state := e.statusRecorder.GetLocalPeerState()
 	state.IP = e.wgInterface.Address().String()
 	state.PubKey = e.config.WgPrivateKey.PublicKey().String()
@@ -1105,30 +1137,9 @@ func (e *Engine) receiveManagementEvents() {
 	e.shutdownWg.Add(1)
 	go func() {
 		defer e.shutdownWg.Done()
-		info, err := system.GetInfoWithChecks(e.ctx, e.checks)
-		if err != nil {
-			log.Warnf("failed to get system info with checks: %v", err)
-			info = system.GetInfo(e.ctx)
-		}
-		info.SetFlags(
-			e.config.RosenpassEnabled,
-			e.config.RosenpassPermissive,
-			&e.config.ServerSSHAllowed,
-			e.config.DisableClientRoutes,
-			e.config.DisableServerRoutes,
-			e.config.DisableDNS,
-			e.config.DisableFirewall,
-			e.config.BlockLANAccess,
-			e.config.BlockInbound,
-			e.config.LazyConnectionEnabled,
-			e.config.EnableSSHRoot,
-			e.config.EnableSSHSFTP,
-			e.config.EnableSSHLocalPortForwarding,
-			e.config.EnableSSHRemotePortForwarding,
-			e.config.DisableSSHAuth,
-		)
+		info := e.getSystemInfo(e.checks)
 
-		err = e.mgmClient.Sync(e.ctx, info, e.handleSync)
+		err := e.mgmClient.Sync(e.ctx, info, e.handleSync)
 		if err != nil {
 			// happens if management is unavailable for a long time.
 			// We want to cancel the operation of the whole client
@@ -1223,6 +1234,7 @@ func (e *Engine) updateNetworkMap(networkMap *mgmProto.NetworkMap) error {
 
 	if err := e.dnsServer.UpdateDNSServer(serial, dnsConfig); err != nil {
 		log.Errorf("failed to update dns server, err: %v", err)
+		e.mgmClient.ReportError(mgmProto.PeerReportedError_ERROR, fmt.Sprintf("failed to update dns server: %v", err))
 	}
 
 	e.routeManager.SetDNSForwarderPort(dnsConfig.ForwarderPort)
@@ -1240,6 +1252,7 @@ func (e *Engine) updateNetworkMap(networkMap *mgmProto.NetworkMap) error {
 	dnsRouteFeatureFlag := toDNSFeatureFlag(networkMap)
 	if err := e.routeManager.UpdateRoutes(serial, serverRoutes, clientRoutes, dnsRouteFeatureFlag); err != nil {
 		log.Errorf("failed to update routes: %v", err)
+		e.mgmClient.ReportError(mgmProto.PeerReportedError_ERROR, fmt.Sprintf("failed to update routes: %v", err))
 	}
 
 	if e.acl != nil {
@@ -1253,6 +1266,7 @@ func (e *Engine) updateNetworkMap(networkMap *mgmProto.NetworkMap) error {
 	forwardingRules, err := e.updateForwardRules(networkMap.GetForwardingRules())
 	if err != nil {
 		log.Errorf("failed to update forward rules, err: %v", err)
+		e.mgmClient.ReportError(mgmProto.PeerReportedError_ERROR, fmt.Sprintf("failed to update forward rules: %v", err))
 	}
 
 	log.Debugf("got peers update from Management Service, total peers to connect to = %d", len(networkMap.GetRemotePeers()))
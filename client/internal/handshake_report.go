@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// handshakeReportInterval is how often the latest WireGuard handshake is reported to the management service.
+// It has to stay well below the staleness threshold used by the management service.
+const handshakeReportInterval = 5 * time.Minute
+
+// startHandshakeReporter periodically reports the latest WireGuard handshake to the management service,
+// so it can tell peers that are connected to management but have a dead data plane apart from healthy ones.
+// Changes of the relay server the peer is connected to and of the transferred bytes are reported along with it
+func (e *Engine) startHandshakeReporter() {
+	e.shutdownWg.Add(1)
+	go func() {
+		defer e.shutdownWg.Done()
+
+		ticker := time.NewTicker(handshakeReportInterval)
+		defer ticker.Stop()
+
+		var reported time.Time
+		var reportedRelay string
+		var reportedRx, reportedTx int64
+		for {
+			select {
+			case <-e.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			latest := e.latestHandshake()
+			relay := e.relayAddress()
+			rx, tx := e.transferredBytes()
+			if !latest.After(reported) && relay == reportedRelay && rx == reportedRx && tx == reportedTx {
+				continue
+			}
+
+			e.syncMsgMux.Lock()
+			checks := e.checks
+			e.syncMsgMux.Unlock()
+
+			info := e.getSystemInfo(checks)
+			info.LastHandshake = latest
+			info.RelayAddress = relay
+			info.RxBytes, info.TxBytes = rx, tx
+			if err := e.mgmClient.SyncMeta(info); err != nil {
+				log.Debugf("failed to report the latest handshake: %v", err)
+				continue
+			}
+			reported = latest
+			reportedRelay = relay
+			reportedRx, reportedTx = rx, tx
+		}
+	}()
+}
+
+// latestHandshake returns the most recent WireGuard handshake with any remote peer, or zero time if there was none
+func (e *Engine) latestHandshake() time.Time {
+	if e.statusRecorder == nil {
+		return time.Time{}
+	}
+
+	stats, err := e.statusRecorder.PeersStatus()
+	if err != nil {
+		return time.Time{}
+	}
+
+	var latest time.Time
+	for _, p := range stats.Peers {
+		if p.LastHandshake.After(latest) {
+			latest = p.LastHandshake
+		}
+	}
+	return latest
+}
+
+// relayAddress returns the address of the relay server instance the peer is connected to, or empty if there is none
+func (e *Engine) relayAddress() string {
+	if e.relayManager == nil {
+		return ""
+	}
+
+	address, err := e.relayManager.RelayInstanceAddress()
+	if err != nil {
+		return ""
+	}
+	return address
+}
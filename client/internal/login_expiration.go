@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	cProto "github.com/netbirdio/netbird/client/proto"
+	mgmProto "github.com/netbirdio/netbird/shared/management/proto"
+)
+
+// notifyLoginExpiration asks the user to re-authenticate when the management service reports that the login of the
+// peer expires soon, so the session can be renewed before the peer gets disconnected. The user is notified once
+// until the login is renewed
+func (e *Engine) notifyLoginExpiration(conf *mgmProto.PeerConfig) {
+	if !conf.GetLoginExpiresSoon() {
+		e.loginExpiryNotified = false
+		return
+	}
+
+	if e.loginExpiryNotified {
+		return
+	}
+	e.loginExpiryNotified = true
+
+	expiresIn := time.Duration(conf.GetLoginExpiresIn()) * time.Second
+	log.Infof("peer login expires in %s, re-authentication is required to stay connected", expiresIn)
+
+	e.statusRecorder.PublishEvent(
+		cProto.SystemEvent_WARNING, cProto.SystemEvent_AUTHENTICATION,
+		"peer login expires soon",
+		fmt.Sprintf("Your NetBird session expires in %s. Please log in again to stay connected.", expiresIn.Round(time.Minute)),
+		map[string]string{"expires_in_seconds": strconv.FormatInt(conf.GetLoginExpiresIn(), 10)},
+	)
+}
@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/client/internal/peer"
+	cProto "github.com/netbirdio/netbird/client/proto"
+	mgmProto "github.com/netbirdio/netbird/shared/management/proto"
+)
+
+func TestEngine_NotifyLoginExpiration(t *testing.T) {
+	e := &Engine{statusRecorder: peer.NewRecorder("")}
+
+	e.notifyLoginExpiration(&mgmProto.PeerConfig{LoginExpiresIn: 86400})
+	assert.Empty(t, e.statusRecorder.GetEventHistory())
+
+	expiresSoon := &mgmProto.PeerConfig{LoginExpiresIn: 1800, LoginExpiresSoon: true}
+	e.notifyLoginExpiration(expiresSoon)
+	e.notifyLoginExpiration(expiresSoon)
+
+	events := e.statusRecorder.GetEventHistory()
+	require.Len(t, events, 1, "the user must be notified once")
+	assert.Equal(t, cProto.SystemEvent_AUTHENTICATION, events[0].GetCategory())
+	assert.Equal(t, "1800", events[0].GetMetadata()["expires_in_seconds"])
+
+	// after the login is renewed the user is notified again when it is about to expire
+	e.notifyLoginExpiration(&mgmProto.PeerConfig{LoginExpiresIn: 86400})
+	e.notifyLoginExpiration(expiresSoon)
+	assert.Len(t, e.statusRecorder.GetEventHistory(), 2)
+}
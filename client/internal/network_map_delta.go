@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	mgmProto "github.com/netbirdio/netbird/shared/management/proto"
+)
+
+// mergeNetworkMapDelta applies a delta network map received from the Management service on top of the
+// last applied full network map and returns the resulting full network map.
+func mergeNetworkMapDelta(base, delta *mgmProto.NetworkMap) (*mgmProto.NetworkMap, error) {
+	if base == nil {
+		return nil, fmt.Errorf("no network map to apply the delta with base serial %d to", delta.GetBaseSerial())
+	}
+	if base.GetSerial() != delta.GetBaseSerial() {
+		return nil, fmt.Errorf("delta base serial %d doesn't match the applied network map serial %d", delta.GetBaseSerial(), base.GetSerial())
+	}
+
+	merged := proto.Clone(delta).(*mgmProto.NetworkMap)
+	merged.IsDelta = false
+	merged.BaseSerial = 0
+	merged.RemovedPeers = nil
+
+	removed := make(map[string]struct{}, len(delta.GetRemovedPeers()))
+	for _, key := range delta.GetRemovedPeers() {
+		removed[key] = struct{}{}
+	}
+
+	changed := make(map[string]*mgmProto.RemotePeerConfig, len(merged.GetRemotePeers()))
+	for _, remotePeer := range merged.GetRemotePeers() {
+		changed[remotePeer.GetWgPubKey()] = remotePeer
+	}
+
+	remotePeers := make([]*mgmProto.RemotePeerConfig, 0, len(base.GetRemotePeers())+len(changed))
+	for _, remotePeer := range base.GetRemotePeers() {
+		key := remotePeer.GetWgPubKey()
+		if _, ok := removed[key]; ok {
+			continue
+		}
+		if updated, ok := changed[key]; ok {
+			remotePeers = append(remotePeers, updated)
+			delete(changed, key)
+			continue
+		}
+		remotePeers = append(remotePeers, proto.Clone(remotePeer).(*mgmProto.RemotePeerConfig))
+	}
+	// the remaining changed peers are new ones, keep them in the order they were sent
+	for _, remotePeer := range merged.GetRemotePeers() {
+		if _, ok := changed[remotePeer.GetWgPubKey()]; ok {
+			remotePeers = append(remotePeers, remotePeer)
+		}
+	}
+	merged.RemotePeers = remotePeers
+
+	if merged.GetFirewallRulesUnchanged() {
+		merged.FirewallRules = make([]*mgmProto.FirewallRule, 0, len(base.GetFirewallRules()))
+		for _, rule := range base.GetFirewallRules() {
+			merged.FirewallRules = append(merged.FirewallRules, proto.Clone(rule).(*mgmProto.FirewallRule))
+		}
+		merged.FirewallRulesUnchanged = false
+	}
+
+	return merged, nil
+}
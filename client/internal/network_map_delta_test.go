@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mgmProto "github.com/netbirdio/netbird/shared/management/proto"
+)
+
+func TestMergeNetworkMapDelta(t *testing.T) {
+	base := &mgmProto.NetworkMap{
+		Serial: 1,
+		RemotePeers: []*mgmProto.RemotePeerConfig{
+			{WgPubKey: "peer-a", AllowedIps: []string{"100.64.0.1/32"}},
+			{WgPubKey: "peer-b", AllowedIps: []string{"100.64.0.2/32"}},
+			{WgPubKey: "peer-c", AllowedIps: []string{"100.64.0.3/32"}},
+		},
+		FirewallRules: []*mgmProto.FirewallRule{{PeerIP: "100.64.0.1", Port: "22"}},
+	}
+
+	delta := &mgmProto.NetworkMap{
+		Serial:     2,
+		IsDelta:    true,
+		BaseSerial: 1,
+		RemotePeers: []*mgmProto.RemotePeerConfig{
+			{WgPubKey: "peer-d", AllowedIps: []string{"100.64.0.4/32"}},
+			{WgPubKey: "peer-b", AllowedIps: []string{"100.64.1.2/32"}},
+		},
+		RemovedPeers:           []string{"peer-a"},
+		FirewallRulesUnchanged: true,
+	}
+
+	merged, err := mergeNetworkMapDelta(base, delta)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(2), merged.Serial)
+	assert.False(t, merged.IsDelta)
+	assert.False(t, merged.FirewallRulesUnchanged)
+	assert.Empty(t, merged.RemovedPeers)
+
+	var keys []string
+	for _, remotePeer := range merged.RemotePeers {
+		keys = append(keys, remotePeer.WgPubKey)
+	}
+	assert.Equal(t, []string{"peer-b", "peer-c", "peer-d"}, keys)
+	assert.Equal(t, []string{"100.64.1.2/32"}, merged.RemotePeers[0].AllowedIps)
+	require.Len(t, merged.FirewallRules, 1)
+	assert.Equal(t, "22", merged.FirewallRules[0].Port)
+
+	_, err = mergeNetworkMapDelta(base, &mgmProto.NetworkMap{Serial: 3, IsDelta: true, BaseSerial: 2})
+	assert.Error(t, err, "delta with a different base serial must not be applied")
+
+	_, err = mergeNetworkMapDelta(nil, delta)
+	assert.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"sync"
+
+	"github.com/netbirdio/netbird/client/iface/configurer"
+)
+
+// transferCounter accumulates the bytes transferred with the remote peers into totals that only grow,
+// even when the WireGuard counters of a remote peer are reset or the remote peer is removed
+type transferCounter struct {
+	mu     sync.Mutex
+	last   map[string]configurer.Peer
+	rx, tx int64
+}
+
+// update adds the bytes transferred since the previous update to the totals and returns them
+func (c *transferCounter) update(peers []configurer.Peer) (int64, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := make(map[string]configurer.Peer, len(peers))
+	for _, p := range peers {
+		previous := c.last[p.PublicKey]
+		c.rx += counterDelta(previous.RxBytes, p.RxBytes)
+		c.tx += counterDelta(previous.TxBytes, p.TxBytes)
+		current[p.PublicKey] = p
+	}
+	c.last = current
+
+	return c.rx, c.tx
+}
+
+// totals returns the bytes received and sent as of the last update
+func (c *transferCounter) totals() (int64, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rx, c.tx
+}
+
+// counterDelta returns the growth of a counter, counting the whole value when the counter was reset
+func counterDelta(previous, current int64) int64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+// transferredBytes returns the total bytes received and sent over the WireGuard interface since the engine started
+func (e *Engine) transferredBytes() (int64, int64) {
+	if e.statusRecorder == nil {
+		return 0, 0
+	}
+
+	stats, err := e.statusRecorder.PeersStatus()
+	if err != nil {
+		return e.transferred.totals()
+	}
+
+	return e.transferred.update(stats.Peers)
+}
@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/netbirdio/netbird/client/iface/configurer"
+)
+
+func TestTransferCounter(t *testing.T) {
+	var counter transferCounter
+
+	rx, tx := counter.update([]configurer.Peer{
+		{PublicKey: "a", RxBytes: 100, TxBytes: 10},
+		{PublicKey: "b", RxBytes: 50, TxBytes: 5},
+	})
+	assert.Equal(t, int64(150), rx)
+	assert.Equal(t, int64(15), tx)
+
+	// peer b was removed and the counters of peer a were reset
+	rx, tx = counter.update([]configurer.Peer{
+		{PublicKey: "a", RxBytes: 30, TxBytes: 3},
+	})
+	assert.Equal(t, int64(180), rx)
+	assert.Equal(t, int64(18), tx)
+
+	// peer b came back with fresh counters
+	rx, tx = counter.update([]configurer.Peer{
+		{PublicKey: "a", RxBytes: 40, TxBytes: 4},
+		{PublicKey: "b", RxBytes: 20, TxBytes: 2},
+	})
+	assert.Equal(t, int64(210), rx)
+	assert.Equal(t, int64(21), tx)
+
+	rx, tx = counter.totals()
+	assert.Equal(t, int64(210), rx)
+	assert.Equal(t, int64(21), tx)
+}
@@ -5,6 +5,7 @@ import (
 	"net"
 	"net/netip"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc/metadata"
@@ -78,6 +79,14 @@ type Info struct {
 	EnableSSHLocalPortForwarding  bool
 	EnableSSHRemotePortForwarding bool
 	DisableSSHAuth                bool
+
+	// LastHandshake is the most recent WireGuard handshake with any remote peer
+	LastHandshake time.Time
+	// RelayAddress is the address of the relay server instance the peer is connected to
+	RelayAddress string
+	// RxBytes and TxBytes are the total bytes received and sent over the WireGuard interface since the engine started
+	RxBytes int64
+	TxBytes int64
 }
 
 func (i *Info) SetFlags(
@@ -96,6 +96,9 @@ func addFields(entry *logrus.Entry) {
 	if ctxReqID, ok := entry.Context.Value(context.RequestIDKey).(string); ok {
 		entry.Data[context.RequestIDKey] = ctxReqID
 	}
+	if ctxCorrelationID, ok := entry.Context.Value(context.CorrelationIDKey).(string); ok {
+		entry.Data[context.CorrelationIDKey] = ctxCorrelationID
+	}
 	if ctxAccountID, ok := entry.Context.Value(context.AccountIDKey).(string); ok {
 		entry.Data[context.AccountIDKey] = ctxAccountID
 	}
@@ -1,9 +1,13 @@
 package hook
 
 import (
+	"context"
 	"testing"
 
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+
+	nbcontext "github.com/netbirdio/netbird/shared/context"
 )
 
 func TestFilePathParsing(t *testing.T) {
@@ -37,3 +41,20 @@ func TestFilePathParsing(t *testing.T) {
 	}
 
 }
+
+func TestAddFields(t *testing.T) {
+	//nolint
+	ctx := context.WithValue(context.Background(), nbcontext.RequestIDKey, "request-id")
+	//nolint
+	ctx = context.WithValue(ctx, nbcontext.CorrelationIDKey, "correlation-id")
+	//nolint
+	ctx = context.WithValue(ctx, nbcontext.PeerIDKey, "peer-id")
+
+	entry := logrus.NewEntry(logrus.StandardLogger()).WithContext(ctx)
+	addFields(entry)
+
+	assert.Equal(t, "request-id", entry.Data[nbcontext.RequestIDKey])
+	assert.Equal(t, "correlation-id", entry.Data[nbcontext.CorrelationIDKey])
+	assert.Equal(t, "peer-id", entry.Data[nbcontext.PeerIDKey])
+	assert.NotContains(t, entry.Data, nbcontext.AccountIDKey)
+}
@@ -0,0 +1,24 @@
+package network_map
+
+import "time"
+
+// BufferUpdateState is a snapshot of the buffering of the network map updates of an account, for troubleshooting
+// peers that stop receiving updates
+type BufferUpdateState struct {
+	// Locked is true while an update is built and sent. The updates requested meanwhile are coalesced
+	Locked bool
+	// UpdatePending is true if updates were coalesced, they are scheduled once the running update is done
+	UpdatePending bool
+	// InFlight is the number of updates running or scheduled
+	InFlight int32
+	// NextUpdateAt is when the scheduled update runs, nil if no update is scheduled
+	NextUpdateAt *time.Time
+}
+
+// AccountBufferUpdateState holds the state of both update buffers of an account
+type AccountBufferUpdateState struct {
+	// Update is the buffer of BufferUpdateAccountPeers, recalculating the network maps before sending them
+	Update BufferUpdateState
+	// Send is the buffer sending the network maps of the account peers without recalculating them
+	Send BufferUpdateState
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/management/server/types"
+)
+
+// bufferIntervals is the single lookup of the interval used to coalesce the updates of the account peers.
+// It holds the global interval, configured with NB_PEER_UPDATE_INTERVAL_MS and raised during the startup period,
+// and the overrides of the accounts. The override of an account is refreshed whenever the controller loads the
+// account, so the settings are only read from the store for accounts it didn't load yet.
+type bufferIntervals struct {
+	global   atomic.Int64
+	accounts sync.Map
+}
+
+func newBufferIntervals() *bufferIntervals {
+	return &bufferIntervals{}
+}
+
+// setGlobal sets the interval used by the accounts without an override
+func (b *bufferIntervals) setGlobal(interval time.Duration) {
+	b.global.Store(int64(interval))
+}
+
+// observe records the buffer interval override of the account settings, zero meaning no override
+func (b *bufferIntervals) observe(accountID string, settings *types.Settings) {
+	if settings == nil {
+		return
+	}
+	b.accounts.Store(accountID, settings.PeerUpdateBufferInterval)
+}
+
+// get returns the buffer interval of the account: its override if it has one, the global interval otherwise.
+// The settings are only read through load when the override of the account is not known yet.
+func (b *bufferIntervals) get(ctx context.Context, accountID string, load func(ctx context.Context, accountID string) (*types.Settings, error)) time.Duration {
+	override, ok := b.accounts.Load(accountID)
+	if !ok {
+		settings, err := load(ctx, accountID)
+		if err != nil {
+			log.WithContext(ctx).Debugf("failed to get settings of account %s, using the global peer update buffer interval: %v", accountID, err)
+			return time.Duration(b.global.Load())
+		}
+		b.observe(accountID, settings)
+		override = settings.PeerUpdateBufferInterval
+	}
+
+	if interval := override.(time.Duration); interval > 0 {
+		return interval
+	}
+	return time.Duration(b.global.Load())
+}
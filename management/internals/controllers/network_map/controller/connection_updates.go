@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/management/internals/modules/zones"
+	"github.com/netbirdio/netbird/management/server/types"
+)
+
+// connectionChanges collects the peers of each account whose connection to management changed since the last
+// update of the peers affected by it
+type connectionChanges struct {
+	mu    sync.Mutex
+	peers map[string]map[string]struct{}
+}
+
+func newConnectionChanges() *connectionChanges {
+	return &connectionChanges{
+		peers: make(map[string]map[string]struct{}),
+	}
+}
+
+// add records that the connection of the peer changed
+func (c *connectionChanges) add(accountID, peerID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.peers[accountID] == nil {
+		c.peers[accountID] = make(map[string]struct{})
+	}
+	c.peers[accountID][peerID] = struct{}{}
+}
+
+// take returns the peers of the account whose connection changed and forgets them
+func (c *connectionChanges) take(accountID string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := make([]string, 0, len(c.peers[accountID]))
+	for peerID := range c.peers[accountID] {
+		changed = append(changed, peerID)
+	}
+	delete(c.peers, accountID)
+	return changed
+}
+
+// OnPeerConnectionChanged lets the peers having the peer in their network map know that it connected or disconnected,
+// which matters to the accounts limiting the network maps to the connected peers. Unlike OnPeersUpdated, only these
+// peers are sent an update. The updates are buffered like the account updates, so that a burst of reconnects, e.g.
+// after a restart of management, results in a few updates only
+func (c *Controller) OnPeerConnectionChanged(ctx context.Context, accountID string, peerID string) error {
+	peers, err := c.repo.GetPeersByIDs(ctx, accountID, []string{peerID})
+	if err != nil {
+		return fmt.Errorf("failed to get peers by ids: %w", err)
+	}
+
+	for _, peer := range peers {
+		c.UpdatePeerInNetworkMapCache(accountID, peer)
+	}
+
+	c.connectionChanges.add(accountID, peerID)
+	c.bufferSendConnectionUpdates(ctx, accountID)
+
+	return nil
+}
+
+// bufferSendConnectionUpdates sends the updates of the peers affected by the connection changes of the account,
+// coalescing the changes made while an update is sent or scheduled
+func (c *Controller) bufferSendConnectionUpdates(ctx context.Context, accountID string) {
+	bufUpd, _ := c.connectionUpdateLocks.LoadOrStore(accountID, &bufferUpdate{})
+	b := bufUpd.(*bufferUpdate)
+
+	if !b.tryLock() {
+		b.update.Store(true)
+		return
+	}
+
+	b.stop()
+	b.begin()
+
+	send := func() {
+		changed := c.connectionChanges.take(accountID)
+		if len(changed) == 0 {
+			return
+		}
+		if err := c.sendUpdatePeers(ctx, accountID, changed); err != nil {
+			log.WithContext(ctx).Errorf("failed to update the peers affected by connection changes in account %s: %v", accountID, err)
+		}
+	}
+
+	go func() {
+		defer b.unlock()
+		defer b.end()
+		send()
+		if !b.update.Load() {
+			return
+		}
+		b.update.Store(false)
+		b.schedule(c.getBufferInterval(ctx, accountID), send)
+	}()
+}
+
+// getConnectionAffectedPeers returns the IDs of the peers having one of the changed peers in their network map.
+// Network maps list the peers on both ends of a connection, so these are the peers in the full network maps of the
+// changed peers
+func (c *Controller) getConnectionAffectedPeers(ctx context.Context, account *types.Account, changedPeers []string, approvedPeersMap map[string]struct{}, inputs *networkMapInputs, accountZones []*zones.Zone) map[string]struct{} {
+	affected := make(map[string]struct{})
+	for _, peerID := range changedPeers {
+		if account.GetPeer(peerID) == nil {
+			continue
+		}
+
+		networkMap := c.calcPeerNetworkMap(ctx, account, peerID, approvedPeersMap, inputs, accountZones, nil)
+		for _, peer := range networkMap.Peers {
+			affected[peer.ID] = struct{}{}
+		}
+		for _, peer := range networkMap.OfflinePeers {
+			affected[peer.ID] = struct{}{}
+		}
+	}
+	return affected
+}
@@ -46,9 +46,13 @@ type Controller struct {
 	settingsManager       settings.Manager
 	EphemeralPeersManager ephemeral.Manager
 
-	accountUpdateLocks               sync.Map
-	sendAccountUpdateLocks           sync.Map
-	updateAccountPeersBufferInterval atomic.Int64
+	accountUpdateLocks     sync.Map
+	sendAccountUpdateLocks sync.Map
+	// connectionUpdateLocks buffers the updates sent to the peers affected by peers (dis)connecting
+	connectionUpdateLocks sync.Map
+	// connectionChanges holds the peers whose connection changed since the last update of the affected peers
+	connectionChanges *connectionChanges
+	bufferIntervals   *bufferIntervals
 	// dnsDomain is used for peer resolution. This is appended to the peer's name
 	dnsDomain string
 	config    *config.Config
@@ -59,8 +63,26 @@ type Controller struct {
 
 	integratedPeerValidator integrated_validator.IntegratedValidator
 
+	// peerAuthorizer decides how much of its network map a validated peer receives. It is replaced while the
+	// network maps are built, so it is only accessed atomically, see getPeerAuthorizer
+	peerAuthorizer atomic.Pointer[network_map.PeerAuthorizer]
+
 	holder *types.Holder
 
+	// peerGroups tracks the group membership last sent to each connected peer
+	peerGroups *peerGroupsTracker
+
+	// laggingPeers tracks the network serials sent to the peers of each account
+	laggingPeers *laggingPeersTracker
+
+	// pausedPeers holds the IDs of the peers that don't receive network map updates, e.g. while they are debugged
+	pausedPeers sync.Map
+	// peerCapabilities holds the network map capabilities reported by the peers on login and sync
+	peerCapabilities sync.Map
+
+	// networkMapInputs caches the account-wide network map inputs per network serial
+	networkMapInputs *networkMapInputsCache
+
 	expNewNetworkMap     bool
 	expNewNetworkMapAIDs map[string]struct{}
 }
@@ -69,6 +91,112 @@ type bufferUpdate struct {
 	mu     sync.Mutex
 	next   *time.Timer
 	update atomic.Bool
+
+	// running counts the updates in flight or scheduled on next. It is read without taking mu,
+	// so that checking for an update in progress doesn't interfere with the TryLock buffering
+	running   atomic.Int32
+	drainedMu sync.Mutex
+	drained   []chan struct{}
+
+	// locked and nextAt mirror mu and next for the troubleshooting snapshot, which must not take mu
+	locked atomic.Bool
+	nextAt atomic.Int64
+}
+
+// tryLock takes mu if it is free and records it for the snapshot
+func (b *bufferUpdate) tryLock() bool {
+	if !b.mu.TryLock() {
+		return false
+	}
+	b.locked.Store(true)
+	return true
+}
+
+func (b *bufferUpdate) unlock() {
+	b.locked.Store(false)
+	b.mu.Unlock()
+}
+
+// state returns a snapshot of the buffer without taking any of its locks
+func (b *bufferUpdate) state() network_map.BufferUpdateState {
+	state := network_map.BufferUpdateState{
+		Locked:        b.locked.Load(),
+		UpdatePending: b.update.Load(),
+		InFlight:      b.running.Load(),
+	}
+	if nextAt := b.nextAt.Load(); nextAt != 0 {
+		next := time.Unix(0, nextAt)
+		state.NextUpdateAt = &next
+	}
+	return state
+}
+
+func (b *bufferUpdate) begin() {
+	b.running.Add(1)
+}
+
+// end marks an update as done and wakes up the waiters once no update is left
+func (b *bufferUpdate) end() {
+	b.drainedMu.Lock()
+	defer b.drainedMu.Unlock()
+
+	if b.running.Add(-1) > 0 {
+		return
+	}
+	for _, ch := range b.drained {
+		close(ch)
+	}
+	b.drained = nil
+}
+
+func (b *bufferUpdate) inProgress() bool {
+	return b.running.Load() > 0
+}
+
+// wait blocks until no update is in flight or scheduled, or the context is done
+func (b *bufferUpdate) wait(ctx context.Context) error {
+	b.drainedMu.Lock()
+	if b.running.Load() == 0 {
+		b.drainedMu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	b.drained = append(b.drained, ch)
+	b.drainedMu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// schedule runs update after the buffer interval, replacing the update scheduled before if it didn't run yet.
+// The timer is reused, so update must be the same on every call
+func (b *bufferUpdate) schedule(interval time.Duration, update func()) {
+	b.begin()
+	b.nextAt.Store(time.Now().Add(interval).UnixNano())
+	if b.next == nil {
+		b.next = time.AfterFunc(interval, func() {
+			defer b.end()
+			b.nextAt.Store(0)
+			update()
+		})
+		return
+	}
+	if b.next.Reset(interval) {
+		// the replaced update was still counted
+		b.end()
+	}
+}
+
+// stop cancels the scheduled update if it didn't run yet
+func (b *bufferUpdate) stop() {
+	if b.next != nil && b.next.Stop() {
+		b.nextAt.Store(0)
+		b.end()
+	}
 }
 
 var _ network_map.Controller = (*Controller)(nil)
@@ -106,11 +234,79 @@ func NewController(ctx context.Context, store store.Store, metrics telemetry.App
 		EphemeralPeersManager: ephemeralPeersManager,
 
 		holder:               types.NewHolder(),
+		bufferIntervals:      newBufferIntervals(),
+		peerGroups:           newPeerGroupsTracker(),
+		laggingPeers:         newLaggingPeersTracker(),
+		connectionChanges:    newConnectionChanges(),
+		networkMapInputs:     newNetworkMapInputsCache(),
 		expNewNetworkMap:     newNetworkMapBuilder,
 		expNewNetworkMapAIDs: expIDs,
 	}
 }
 
+// SetPeerAuthorizer replaces the authorizer consulted for every validated peer sync.
+// A nil authorizer restores the default one, which grants the full network map
+func (c *Controller) SetPeerAuthorizer(authorizer network_map.PeerAuthorizer) {
+	if authorizer == nil {
+		c.peerAuthorizer.Store(nil)
+		return
+	}
+	c.peerAuthorizer.Store(&authorizer)
+}
+
+// getPeerAuthorizer returns the authorizer set with SetPeerAuthorizer or the default one
+func (c *Controller) getPeerAuthorizer() network_map.PeerAuthorizer {
+	if authorizer := c.peerAuthorizer.Load(); authorizer != nil {
+		return *authorizer
+	}
+	return network_map.DefaultPeerAuthorizer{}
+}
+
+// authorizePeer asks the peer authorizer how much of its network map the validated peer receives
+func (c *Controller) authorizePeer(ctx context.Context, account *types.Account, peer *nbpeer.Peer, postureChecks []*posture.Checks) (network_map.PeerAuthorizationDecision, error) {
+	decision, err := c.getPeerAuthorizer().AuthorizePeer(ctx, network_map.PeerAuthorizationRequest{
+		Account:       account,
+		Peer:          peer,
+		PostureChecks: postureChecks,
+	})
+	if err != nil {
+		return decision, fmt.Errorf("authorize peer %s: %w", peer.ID, err)
+	}
+	if decision == network_map.PeerAuthorizationDenied {
+		log.WithContext(ctx).Debugf("peer %s was denied a network map by the peer authorizer", peer.ID)
+	}
+	return decision, nil
+}
+
+// SetPeerUpdatesPaused stops or resumes sending network map updates to the peer without disconnecting it
+func (c *Controller) SetPeerUpdatesPaused(peerID string, paused bool) {
+	if paused {
+		c.pausedPeers.Store(peerID, struct{}{})
+		return
+	}
+	c.pausedPeers.Delete(peerID)
+}
+
+// SetPeerCapabilities records the network map capabilities the peer reported on login or sync.
+// They are kept in memory only, until the peer reports them again or is deleted
+func (c *Controller) SetPeerCapabilities(peerID string, capabilities network_map.PeerCapabilities) {
+	c.peerCapabilities.Store(peerID, capabilities)
+}
+
+// GetPeerCapabilities returns the network map capabilities of the peer, none if it didn't report any
+func (c *Controller) GetPeerCapabilities(peerID string) network_map.PeerCapabilities {
+	capabilities, ok := c.peerCapabilities.Load(peerID)
+	if !ok {
+		return 0
+	}
+	return capabilities.(network_map.PeerCapabilities)
+}
+
+func (c *Controller) isPeerUpdatesPaused(peerID string) bool {
+	_, paused := c.pausedPeers.Load(peerID)
+	return paused
+}
+
 func (c *Controller) OnPeerConnected(ctx context.Context, accountID string, peerID string) (chan *network_map.UpdateMessage, error) {
 	peer, err := c.repo.GetPeerByID(ctx, accountID, peerID)
 	if err != nil {
@@ -119,11 +315,15 @@ func (c *Controller) OnPeerConnected(ctx context.Context, accountID string, peer
 
 	c.EphemeralPeersManager.OnPeerConnected(ctx, peer)
 
+	// the initial sync response always carries the full group list, so the next update is compared to it
+	c.seedPeerGroups(ctx, accountID, peerID)
+
 	return c.peersUpdateManager.CreateChannel(ctx, peerID), nil
 }
 
 func (c *Controller) OnPeerDisconnected(ctx context.Context, accountID string, peerID string) {
 	c.peersUpdateManager.CloseChannel(ctx, peerID)
+	c.peerGroups.remove(peerID)
 	peer, err := c.repo.GetPeerByID(ctx, accountID, peerID)
 	if err != nil {
 		log.WithContext(ctx).Errorf("failed to get peer %s: %v", peerID, err)
@@ -137,6 +337,12 @@ func (c *Controller) CountStreams() int {
 }
 
 func (c *Controller) sendUpdateAccountPeers(ctx context.Context, accountID string) error {
+	return c.sendUpdatePeers(ctx, accountID, nil)
+}
+
+// sendUpdatePeers sends the network maps to the connected peers of the account. With changedPeers set, only the peers
+// having one of them in their network map are updated, otherwise all of them are
+func (c *Controller) sendUpdatePeers(ctx context.Context, accountID string, changedPeers []string) error {
 	log.WithContext(ctx).Tracef("updating peers for account %s from %s", accountID, util.GetCallerName())
 	var (
 		account *types.Account
@@ -151,6 +357,8 @@ func (c *Controller) sendUpdateAccountPeers(ctx context.Context, accountID strin
 		}
 	}
 
+	c.bufferIntervals.observe(accountID, account.Settings)
+
 	globalStart := time.Now()
 
 	hasPeersConnected := false
@@ -166,7 +374,12 @@ func (c *Controller) sendUpdateAccountPeers(ctx context.Context, accountID strin
 		return nil
 	}
 
-	approvedPeersMap, err := c.integratedPeerValidator.GetValidatedPeers(ctx, account.Id, maps.Values(account.Groups), maps.Values(account.Peers), account.Settings.Extra)
+	// the serial only changes with full updates, so the peers are only checked for lagging behind on these
+	if changedPeers == nil {
+		c.checkLaggingPeers(ctx, account)
+	}
+
+	approvedPeersMap, err := c.getValidatedPeers(ctx, account)
 	if err != nil {
 		return fmt.Errorf("failed to get validate peers: %v", err)
 	}
@@ -176,10 +389,7 @@ func (c *Controller) sendUpdateAccountPeers(ctx context.Context, accountID strin
 
 	dnsCache := &cache.DNSConfigCache{}
 	dnsDomain := c.GetDNSDomain(account.Settings)
-	peersCustomZone := account.GetPeersCustomZone(ctx, dnsDomain)
-	resourcePolicies := account.GetResourcePoliciesMap()
-	routers := account.GetResourceRoutersMap()
-	groupIDToUserIDs := account.GetActiveGroupUsers()
+	inputs := c.getNetworkMapInputs(ctx, account, dnsDomain)
 
 	if c.experimentalNetworkMap(accountID) {
 		c.initNetworkMapBuilderIfNeeded(account, approvedPeersMap)
@@ -197,6 +407,7 @@ func (c *Controller) sendUpdateAccountPeers(ctx context.Context, accountID strin
 	}
 
 	dnsFwdPort := computeForwarderPort(maps.Values(account.Peers), network_map.DnsForwarderPortMinVersion)
+	loginExpirationOverrides := account.GetPeerLoginExpirationOverrides()
 
 	accountZones, err := c.repo.GetAccountZones(ctx, account.Id)
 	if err != nil {
@@ -204,12 +415,28 @@ func (c *Controller) sendUpdateAccountPeers(ctx context.Context, accountID strin
 		return fmt.Errorf("failed to get account zones: %v", err)
 	}
 
+	var affectedPeers map[string]struct{}
+	if changedPeers != nil {
+		affectedPeers = c.getConnectionAffectedPeers(ctx, account, changedPeers, approvedPeersMap, inputs, accountZones)
+	}
+
 	for _, peer := range account.Peers {
+		if affectedPeers != nil {
+			if _, ok := affectedPeers[peer.ID]; !ok {
+				continue
+			}
+		}
+
 		if !c.peersUpdateManager.HasChannel(peer.ID) {
 			log.WithContext(ctx).Tracef("peer %s doesn't have a channel, skipping network map update", peer.ID)
 			continue
 		}
 
+		if c.isPeerUpdatesPaused(peer.ID) {
+			log.WithContext(ctx).Tracef("updates of peer %s are paused, skipping network map update", peer.ID)
+			continue
+		}
+
 		wg.Add(1)
 		semaphore <- struct{}{}
 		go func(p *nbpeer.Peer) {
@@ -225,29 +452,43 @@ func (c *Controller) sendUpdateAccountPeers(ctx context.Context, accountID strin
 			}
 
 			c.metrics.CountCalcPostureChecksDuration(time.Since(start))
-			start = time.Now()
-
-			var remotePeerNetworkMap *types.NetworkMap
 
-			if c.experimentalNetworkMap(accountID) {
-				remotePeerNetworkMap = c.getPeerNetworkMapExp(ctx, p.AccountID, p.ID, approvedPeersMap, peersCustomZone, accountZones, c.accountManagerMetrics)
-			} else {
-				remotePeerNetworkMap = account.GetPeerNetworkMap(ctx, p.ID, peersCustomZone, accountZones, approvedPeersMap, resourcePolicies, routers, c.accountManagerMetrics, groupIDToUserIDs)
+			decision := network_map.PeerAuthorizationFull
+			if _, ok := approvedPeersMap[p.ID]; ok {
+				decision, err = c.authorizePeer(ctx, account, p, postureChecks)
+				if err != nil {
+					log.WithContext(ctx).Errorf("failed to send update to peer %s: %v", p.ID, err)
+					return
+				}
+			}
+			if decision == network_map.PeerAuthorizationDenied {
+				update := grpc.ToSyncResponse(ctx, nil, c.config.HttpConfig, c.config.DeviceAuthorizationFlow, p, nil, nil, &types.NetworkMap{Network: account.Network.Copy()}, dnsDomain, nil, dnsCache, account.Settings, account.Settings.GetPeerLoginExpiration(loginExpirationOverrides, p.ID), extraSetting, nil, 0)
+				c.peersUpdateManager.SendUpdate(ctx, p.ID, &network_map.UpdateMessage{Update: update, Capabilities: c.GetPeerCapabilities(p.ID)})
+				return
 			}
 
-			c.metrics.CountCalcPeerNetworkMapDuration(time.Since(start))
+			remotePeerNetworkMap := c.calcPeerNetworkMap(ctx, account, p.ID, approvedPeersMap, inputs, accountZones, c.accountManagerMetrics)
 
 			proxyNetworkMap, ok := proxyNetworkMaps[peer.ID]
 			if ok {
 				remotePeerNetworkMap.Merge(proxyNetworkMap)
 			}
 
-			peerGroups := account.GetPeerGroups(p.ID)
+			if account.Settings.NetworkMapConnectedPeersOnly {
+				remotePeerNetworkMap.RemoveDisconnectedPeers()
+			}
+
+			if decision == network_map.PeerAuthorizationRestricted {
+				restrictNetworkMap(remotePeerNetworkMap)
+			}
+
+			peerGroups := maps.Keys(account.GetPeerGroups(p.ID))
 			start = time.Now()
-			update := grpc.ToSyncResponse(ctx, nil, c.config.HttpConfig, c.config.DeviceAuthorizationFlow, p, nil, nil, remotePeerNetworkMap, dnsDomain, postureChecks, dnsCache, account.Settings, extraSetting, maps.Keys(peerGroups), dnsFwdPort)
+			update := grpc.ToSyncResponse(ctx, nil, c.config.HttpConfig, c.config.DeviceAuthorizationFlow, p, nil, nil, remotePeerNetworkMap, dnsDomain, postureChecks, dnsCache, account.Settings, account.Settings.GetPeerLoginExpiration(loginExpirationOverrides, p.ID), extraSetting, peerGroups, dnsFwdPort)
+			c.setPeerGroupsChanged(update, p.ID, peerGroups)
 			c.metrics.CountToSyncResponseDuration(time.Since(start))
 
-			c.peersUpdateManager.SendUpdate(ctx, p.ID, &network_map.UpdateMessage{Update: update})
+			c.peersUpdateManager.SendUpdate(ctx, p.ID, &network_map.UpdateMessage{Update: update, Capabilities: c.GetPeerCapabilities(p.ID)})
 		}(peer)
 	}
 
@@ -265,29 +506,25 @@ func (c *Controller) bufferSendUpdateAccountPeers(ctx context.Context, accountID
 	bufUpd, _ := c.sendAccountUpdateLocks.LoadOrStore(accountID, &bufferUpdate{})
 	b := bufUpd.(*bufferUpdate)
 
-	if !b.mu.TryLock() {
+	if !b.tryLock() {
 		b.update.Store(true)
 		return nil
 	}
 
-	if b.next != nil {
-		b.next.Stop()
-	}
+	b.stop()
+	b.begin()
 
 	go func() {
-		defer b.mu.Unlock()
+		defer b.unlock()
+		defer b.end()
 		_ = c.sendUpdateAccountPeers(ctx, accountID)
 		if !b.update.Load() {
 			return
 		}
 		b.update.Store(false)
-		if b.next == nil {
-			b.next = time.AfterFunc(time.Duration(c.updateAccountPeersBufferInterval.Load()), func() {
-				_ = c.sendUpdateAccountPeers(ctx, accountID)
-			})
-			return
-		}
-		b.next.Reset(time.Duration(c.updateAccountPeersBufferInterval.Load()))
+		b.schedule(c.getBufferInterval(ctx, accountID), func() {
+			_ = c.sendUpdateAccountPeers(ctx, accountID)
+		})
 	}()
 
 	return nil
@@ -308,6 +545,11 @@ func (c *Controller) UpdateAccountPeer(ctx context.Context, accountId string, pe
 		return fmt.Errorf("peer %s doesn't have a channel, skipping network map update", peerId)
 	}
 
+	if c.isPeerUpdatesPaused(peerId) {
+		log.WithContext(ctx).Tracef("updates of peer %s are paused, skipping network map update", peerId)
+		return nil
+	}
+
 	account, err := c.requestBuffer.GetAccountWithBackpressure(ctx, accountId)
 	if err != nil {
 		return fmt.Errorf("failed to send out updates to peer %s: %v", peerId, err)
@@ -318,17 +560,14 @@ func (c *Controller) UpdateAccountPeer(ctx context.Context, accountId string, pe
 		return fmt.Errorf("peer %s doesn't exists in account %s", peerId, accountId)
 	}
 
-	approvedPeersMap, err := c.integratedPeerValidator.GetValidatedPeers(ctx, account.Id, maps.Values(account.Groups), maps.Values(account.Peers), account.Settings.Extra)
+	approvedPeersMap, err := c.getValidatedPeers(ctx, account)
 	if err != nil {
 		return fmt.Errorf("failed to get validated peers: %v", err)
 	}
 
 	dnsCache := &cache.DNSConfigCache{}
 	dnsDomain := c.GetDNSDomain(account.Settings)
-	peersCustomZone := account.GetPeersCustomZone(ctx, dnsDomain)
-	resourcePolicies := account.GetResourcePoliciesMap()
-	routers := account.GetResourceRoutersMap()
-	groupIDToUserIDs := account.GetActiveGroupUsers()
+	inputs := c.getNetworkMapInputs(ctx, account, dnsDomain)
 
 	postureChecks, err := c.getPeerPostureChecks(account, peerId)
 	if err != nil {
@@ -336,6 +575,25 @@ func (c *Controller) UpdateAccountPeer(ctx context.Context, accountId string, pe
 		return fmt.Errorf("failed to get posture checks for peer %s: %v", peerId, err)
 	}
 
+	decision := network_map.PeerAuthorizationFull
+	if _, ok := approvedPeersMap[peerId]; ok {
+		decision, err = c.authorizePeer(ctx, account, peer, postureChecks)
+		if err != nil {
+			return err
+		}
+	}
+
+	extraSettings, err := c.settingsManager.GetExtraSettings(ctx, peer.AccountID)
+	if err != nil {
+		return fmt.Errorf("failed to get extra settings: %v", err)
+	}
+
+	if decision == network_map.PeerAuthorizationDenied {
+		update := grpc.ToSyncResponse(ctx, nil, c.config.HttpConfig, c.config.DeviceAuthorizationFlow, peer, nil, nil, &types.NetworkMap{Network: account.Network.Copy()}, dnsDomain, nil, dnsCache, account.Settings, account.Settings.GetPeerLoginExpiration(account.GetPeerLoginExpirationOverrides(), peer.ID), extraSettings, nil, 0)
+		c.peersUpdateManager.SendUpdate(ctx, peer.ID, &network_map.UpdateMessage{Update: update, Capabilities: c.GetPeerCapabilities(peer.ID)})
+		return nil
+	}
+
 	proxyNetworkMaps, err := c.proxyController.GetProxyNetworkMaps(ctx, account.Id, peer.ID, account.Peers)
 	if err != nil {
 		log.WithContext(ctx).Errorf("failed to get proxy network maps: %v", err)
@@ -348,67 +606,112 @@ func (c *Controller) UpdateAccountPeer(ctx context.Context, accountId string, pe
 		return err
 	}
 
-	var remotePeerNetworkMap *types.NetworkMap
-
-	if c.experimentalNetworkMap(accountId) {
-		remotePeerNetworkMap = c.getPeerNetworkMapExp(ctx, peer.AccountID, peer.ID, approvedPeersMap, peersCustomZone, accountZones, c.accountManagerMetrics)
-	} else {
-		remotePeerNetworkMap = account.GetPeerNetworkMap(ctx, peerId, peersCustomZone, accountZones, approvedPeersMap, resourcePolicies, routers, c.accountManagerMetrics, groupIDToUserIDs)
-	}
+	remotePeerNetworkMap := c.calcPeerNetworkMap(ctx, account, peerId, approvedPeersMap, inputs, accountZones, c.accountManagerMetrics)
 
 	proxyNetworkMap, ok := proxyNetworkMaps[peer.ID]
 	if ok {
 		remotePeerNetworkMap.Merge(proxyNetworkMap)
 	}
 
-	extraSettings, err := c.settingsManager.GetExtraSettings(ctx, peer.AccountID)
-	if err != nil {
-		return fmt.Errorf("failed to get extra settings: %v", err)
+	if account.Settings.NetworkMapConnectedPeersOnly {
+		remotePeerNetworkMap.RemoveDisconnectedPeers()
 	}
 
-	peerGroups := account.GetPeerGroups(peerId)
+	if decision == network_map.PeerAuthorizationRestricted {
+		restrictNetworkMap(remotePeerNetworkMap)
+	}
+
+	peerGroups := maps.Keys(account.GetPeerGroups(peerId))
 	dnsFwdPort := computeForwarderPort(maps.Values(account.Peers), network_map.DnsForwarderPortMinVersion)
 
-	update := grpc.ToSyncResponse(ctx, nil, c.config.HttpConfig, c.config.DeviceAuthorizationFlow, peer, nil, nil, remotePeerNetworkMap, dnsDomain, postureChecks, dnsCache, account.Settings, extraSettings, maps.Keys(peerGroups), dnsFwdPort)
-	c.peersUpdateManager.SendUpdate(ctx, peer.ID, &network_map.UpdateMessage{Update: update})
+	update := grpc.ToSyncResponse(ctx, nil, c.config.HttpConfig, c.config.DeviceAuthorizationFlow, peer, nil, nil, remotePeerNetworkMap, dnsDomain, postureChecks, dnsCache, account.Settings, account.Settings.GetPeerLoginExpiration(account.GetPeerLoginExpirationOverrides(), peer.ID), extraSettings, peerGroups, dnsFwdPort)
+	c.setPeerGroupsChanged(update, peer.ID, peerGroups)
+	c.peersUpdateManager.SendUpdate(ctx, peer.ID, &network_map.UpdateMessage{Update: update, Capabilities: c.GetPeerCapabilities(peer.ID)})
 
 	return nil
 }
 
+// getBufferInterval returns the interval used to coalesce the updates of the account peers, see bufferIntervals.
+// The account setting takes precedence over the global interval. A change of the setting takes effect once the
+// controller loaded the account again, which every update of its peers does.
+func (c *Controller) getBufferInterval(ctx context.Context, accountID string) time.Duration {
+	return c.bufferIntervals.get(ctx, accountID, c.repo.GetAccountSettings)
+}
+
 func (c *Controller) BufferUpdateAccountPeers(ctx context.Context, accountID string) error {
 	log.WithContext(ctx).Tracef("buffer updating peers for account %s from %s", accountID, util.GetCallerName())
 
 	bufUpd, _ := c.accountUpdateLocks.LoadOrStore(accountID, &bufferUpdate{})
 	b := bufUpd.(*bufferUpdate)
 
-	if !b.mu.TryLock() {
+	if !b.tryLock() {
+		// the pending update runs with the context of the request that started it, so log here that this request
+		// was coalesced into it to keep the request traceable
+		log.WithContext(ctx).Tracef("coalescing update of peers for account %s into the pending buffered update", accountID)
 		b.update.Store(true)
 		return nil
 	}
 
-	if b.next != nil {
-		b.next.Stop()
-	}
+	b.stop()
+	b.begin()
 
 	go func() {
-		defer b.mu.Unlock()
+		defer b.unlock()
+		defer b.end()
 		_ = c.UpdateAccountPeers(ctx, accountID)
 		if !b.update.Load() {
 			return
 		}
 		b.update.Store(false)
-		if b.next == nil {
-			b.next = time.AfterFunc(time.Duration(c.updateAccountPeersBufferInterval.Load()), func() {
-				_ = c.UpdateAccountPeers(ctx, accountID)
-			})
-			return
-		}
-		b.next.Reset(time.Duration(c.updateAccountPeersBufferInterval.Load()))
+		b.schedule(c.getBufferInterval(ctx, accountID), func() {
+			_ = c.UpdateAccountPeers(ctx, accountID)
+		})
 	}()
 
 	return nil
 }
 
+// IsAccountUpdateInProgress reports whether a buffered update of the account peers is being built, sent or scheduled.
+// It doesn't block and doesn't interfere with the buffering of new updates
+func (c *Controller) IsAccountUpdateInProgress(accountID string) bool {
+	for _, locks := range []*sync.Map{&c.accountUpdateLocks, &c.sendAccountUpdateLocks, &c.connectionUpdateLocks} {
+		if bufUpd, ok := locks.Load(accountID); ok && bufUpd.(*bufferUpdate).inProgress() {
+			return true
+		}
+	}
+	return false
+}
+
+// GetBufferUpdateState returns a snapshot of the update buffers of the account, e.g. to find out whether they are
+// wedged with pending updates that never drain. It doesn't block and doesn't interfere with the buffering
+func (c *Controller) GetBufferUpdateState(accountID string) network_map.AccountBufferUpdateState {
+	var state network_map.AccountBufferUpdateState
+	if bufUpd, ok := c.accountUpdateLocks.Load(accountID); ok {
+		state.Update = bufUpd.(*bufferUpdate).state()
+	}
+	if bufUpd, ok := c.sendAccountUpdateLocks.Load(accountID); ok {
+		state.Send = bufUpd.(*bufferUpdate).state()
+	}
+	return state
+}
+
+// WaitAccountUpdate blocks until the buffered updates of the account peers in progress, including the scheduled
+// ones, are done or the context is done. Updates buffered while waiting are waited for as well
+func (c *Controller) WaitAccountUpdate(ctx context.Context, accountID string) error {
+	for c.IsAccountUpdateInProgress(accountID) {
+		for _, locks := range []*sync.Map{&c.accountUpdateLocks, &c.sendAccountUpdateLocks, &c.connectionUpdateLocks} {
+			bufUpd, ok := locks.Load(accountID)
+			if !ok {
+				continue
+			}
+			if err := bufUpd.(*bufferUpdate).wait(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (c *Controller) GetValidatedPeerWithMap(ctx context.Context, isRequiresApproval bool, accountID string, peer *nbpeer.Peer) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, int64, error) {
 	if isRequiresApproval {
 		network, err := c.repo.GetAccountNetwork(ctx, accountID)
@@ -435,7 +738,7 @@ func (c *Controller) GetValidatedPeerWithMap(ctx context.Context, isRequiresAppr
 		}
 	}
 
-	approvedPeersMap, err := c.integratedPeerValidator.GetValidatedPeers(ctx, account.Id, maps.Values(account.Groups), maps.Values(account.Peers), account.Settings.Extra)
+	approvedPeersMap, err := c.getValidatedPeers(ctx, account)
 	if err != nil {
 		return nil, nil, nil, 0, err
 	}
@@ -447,6 +750,14 @@ func (c *Controller) GetValidatedPeerWithMap(ctx context.Context, isRequiresAppr
 	}
 	log.WithContext(ctx).Debugf("getPeerPostureChecks took %s", time.Since(startPosture))
 
+	decision, err := c.authorizePeer(ctx, account, peer, postureChecks)
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+	if decision == network_map.PeerAuthorizationDenied {
+		return peer, &types.NetworkMap{Network: account.Network.Copy()}, nil, 0, nil
+	}
+
 	accountZones, err := c.repo.GetAccountZones(ctx, account.Id)
 	if err != nil {
 		log.WithContext(ctx).Errorf("failed to get account zones: %v", err)
@@ -454,7 +765,7 @@ func (c *Controller) GetValidatedPeerWithMap(ctx context.Context, isRequiresAppr
 	}
 
 	dnsDomain := c.GetDNSDomain(account.Settings)
-	peersCustomZone := account.GetPeersCustomZone(ctx, dnsDomain)
+	inputs := c.getNetworkMapInputs(ctx, account, dnsDomain)
 
 	proxyNetworkMaps, err := c.proxyController.GetProxyNetworkMaps(ctx, account.Id, peer.ID, account.Peers)
 	if err != nil {
@@ -462,31 +773,82 @@ func (c *Controller) GetValidatedPeerWithMap(ctx context.Context, isRequiresAppr
 		return nil, nil, nil, 0, err
 	}
 
-	var networkMap *types.NetworkMap
-
-	if c.experimentalNetworkMap(accountID) {
-		networkMap = c.getPeerNetworkMapExp(ctx, peer.AccountID, peer.ID, approvedPeersMap, peersCustomZone, accountZones, c.accountManagerMetrics)
-	} else {
-		resourcePolicies := account.GetResourcePoliciesMap()
-		routers := account.GetResourceRoutersMap()
-		networkMap = account.GetPeerNetworkMap(ctx, peer.ID, peersCustomZone, accountZones, approvedPeersMap, resourcePolicies, routers, c.accountManagerMetrics, account.GetActiveGroupUsers())
-	}
+	networkMap := c.calcPeerNetworkMap(ctx, account, peer.ID, approvedPeersMap, inputs, accountZones, c.accountManagerMetrics)
 
 	proxyNetworkMap, ok := proxyNetworkMaps[peer.ID]
 	if ok {
 		networkMap.Merge(proxyNetworkMap)
 	}
 
+	if account.Settings.NetworkMapConnectedPeersOnly {
+		networkMap.RemoveDisconnectedPeers()
+	}
+
+	if decision == network_map.PeerAuthorizationRestricted {
+		restrictNetworkMap(networkMap)
+	}
+
 	dnsFwdPort := computeForwarderPort(maps.Values(account.Peers), network_map.DnsForwarderPortMinVersion)
 
 	return peer, networkMap, postureChecks, dnsFwdPort, nil
 }
 
+// restrictNetworkMap drops everything but the peers and their firewall rules from the network map,
+// so a restricted peer can't reach the networks behind routing peers
+func restrictNetworkMap(networkMap *types.NetworkMap) {
+	networkMap.Routes = nil
+	networkMap.RoutesFirewallRules = nil
+	networkMap.ForwardingRules = nil
+}
+
+// getValidatedPeers returns the peers of the account validated by the integrated validator, without the peers
+// quarantined because their owner is blocked and the peers pending the approval required by their setup key
+func (c *Controller) getValidatedPeers(ctx context.Context, account *types.Account) (map[string]struct{}, error) {
+	validatedPeers, err := c.integratedPeerValidator.GetValidatedPeers(ctx, account.Id, maps.Values(account.Groups), maps.Values(account.Peers), account.Settings.Extra)
+	if err != nil {
+		return nil, err
+	}
+
+	account.RemoveQuarantinedPeers(validatedPeers)
+	account.RemovePeersPendingApproval(validatedPeers)
+	return validatedPeers, nil
+}
+
 func (c *Controller) initNetworkMapBuilderIfNeeded(account *types.Account, validatedPeers map[string]struct{}) {
 	c.enrichAccountFromHolder(account)
 	account.InitNetworkMapBuilderIfNeeded(validatedPeers)
 }
 
+// calcPeerNetworkMap calculates the network map of the peer with the experimental or the default network map builder
+// and counts the calculation duration. Slow calculations are also logged, so the peers with expensive network maps
+// can be found
+func (c *Controller) calcPeerNetworkMap(
+	ctx context.Context,
+	account *types.Account,
+	peerID string,
+	validatedPeers map[string]struct{},
+	inputs *networkMapInputs,
+	accountZones []*zones.Zone,
+	metrics *telemetry.AccountManagerMetrics,
+) *types.NetworkMap {
+	start := time.Now()
+
+	var networkMap *types.NetworkMap
+	if c.experimentalNetworkMap(account.Id) {
+		networkMap = c.getPeerNetworkMapExp(ctx, account.Id, peerID, validatedPeers, inputs.peersCustomZone, accountZones, metrics)
+	} else {
+		networkMap = account.GetPeerNetworkMap(ctx, peerID, inputs.peersCustomZone, accountZones, validatedPeers, inputs.resourcePolicies, inputs.routers, metrics, inputs.groupIDToUserIDs)
+	}
+
+	calcDuration := time.Since(start)
+	c.metrics.CountCalcPeerNetworkMapDuration(calcDuration, account.Id)
+	if calcDuration > telemetry.SlowPeerNetworkMapThreshold {
+		log.WithContext(ctx).Warnf("calculating the network map of peer %s took %s", peerID, calcDuration)
+	}
+
+	return networkMap
+}
+
 func (c *Controller) getPeerNetworkMapExp(
 	ctx context.Context,
 	accountId string,
@@ -536,7 +898,8 @@ func (c *Controller) RecalculateNetworkMapCache(ctx context.Context, accountId s
 		if err != nil {
 			return err
 		}
-		validatedPeers, err := c.integratedPeerValidator.GetValidatedPeers(ctx, account.Id, maps.Values(account.Groups), maps.Values(account.Peers), account.Settings.Extra)
+		c.bufferIntervals.observe(accountId, account.Settings)
+		validatedPeers, err := c.getValidatedPeers(ctx, account)
 		if err != nil {
 			log.WithContext(ctx).Errorf("failed to get validate peers: %v", err)
 			return err
@@ -634,11 +997,11 @@ func (c *Controller) StartWarmup(ctx context.Context) {
 				log.WithContext(ctx).Warnf("failed to parse peer update startup period, using default value %ds: %v", startupPeriod, err)
 			}
 			time.Sleep(time.Duration(startupPeriod) * time.Second)
-			c.updateAccountPeersBufferInterval.Store(int64(time.Duration(interval) * time.Millisecond))
+			c.bufferIntervals.setGlobal(time.Duration(interval) * time.Millisecond)
 			log.WithContext(ctx).Infof("set peer update buffer interval to %dms", interval)
 		}()
 	}
-	c.updateAccountPeersBufferInterval.Store(int64(time.Duration(initialInterval) * time.Millisecond))
+	c.bufferIntervals.setGlobal(time.Duration(initialInterval) * time.Millisecond)
 	log.WithContext(ctx).Infof("set peer update buffer interval to %dms", initialInterval)
 
 }
@@ -747,6 +1110,9 @@ func (c *Controller) OnPeersAdded(ctx context.Context, accountID string, peerIDs
 		log.WithContext(ctx).Debugf("peers are ready to be added to networkmap cache: %v", peerIDs)
 		c.onPeersAddedUpdNetworkMapCache(account, peerIDs...)
 	}
+	for _, peerID := range peerIDs {
+		c.seedPeerGroups(ctx, accountID, peerID)
+	}
 	return c.bufferSendUpdateAccountPeers(ctx, accountID)
 }
 
@@ -780,6 +1146,9 @@ func (c *Controller) OnPeersDeleted(ctx context.Context, accountID string, peerI
 			},
 		})
 		c.peersUpdateManager.CloseChannel(ctx, peerID)
+		c.pausedPeers.Delete(peerID)
+		c.peerCapabilities.Delete(peerID)
+		c.peerGroups.remove(peerID)
 
 		if c.experimentalNetworkMap(accountID) {
 			account, err := c.requestBuffer.GetAccountWithBackpressure(ctx, accountID)
@@ -798,6 +1167,20 @@ func (c *Controller) OnPeersDeleted(ctx context.Context, accountID string, peerI
 	return c.bufferSendUpdateAccountPeers(ctx, accountID)
 }
 
+// OnAccountDeleted drops the state kept for the deleted account and its peers. The peers are gone from the store
+// already, so no updates are sent to them
+func (c *Controller) OnAccountDeleted(ctx context.Context, accountID string, peerIDs []string) {
+	for _, peerID := range peerIDs {
+		c.peersUpdateManager.CloseChannel(ctx, peerID)
+		c.pausedPeers.Delete(peerID)
+		c.peerCapabilities.Delete(peerID)
+		c.peerGroups.remove(peerID)
+	}
+
+	c.laggingPeers.remove(accountID)
+	c.networkMapInputs.remove(accountID)
+}
+
 // GetNetworkMap returns Network map for a given peer (omits original peer from the Peers result)
 func (c *Controller) GetNetworkMap(ctx context.Context, peerID string) (*types.NetworkMap, error) {
 	account, err := c.repo.GetAccountByPeerID(ctx, peerID)
@@ -815,7 +1198,7 @@ func (c *Controller) GetNetworkMap(ctx context.Context, peerID string) (*types.N
 		groups[groupID] = group.Peers
 	}
 
-	validatedPeers, err := c.integratedPeerValidator.GetValidatedPeers(ctx, account.Id, maps.Values(account.Groups), maps.Values(account.Peers), account.Settings.Extra)
+	validatedPeers, err := c.getValidatedPeers(ctx, account)
 	if err != nil {
 		return nil, err
 	}
@@ -827,7 +1210,7 @@ func (c *Controller) GetNetworkMap(ctx context.Context, peerID string) (*types.N
 	}
 
 	dnsDomain := c.GetDNSDomain(account.Settings)
-	peersCustomZone := account.GetPeersCustomZone(ctx, dnsDomain)
+	inputs := c.getNetworkMapInputs(ctx, account, dnsDomain)
 
 	proxyNetworkMaps, err := c.proxyController.GetProxyNetworkMaps(ctx, account.Id, peerID, account.Peers)
 	if err != nil {
@@ -835,21 +1218,17 @@ func (c *Controller) GetNetworkMap(ctx context.Context, peerID string) (*types.N
 		return nil, err
 	}
 
-	var networkMap *types.NetworkMap
-
-	if c.experimentalNetworkMap(peer.AccountID) {
-		networkMap = c.getPeerNetworkMapExp(ctx, peer.AccountID, peerID, validatedPeers, peersCustomZone, accountZones, nil)
-	} else {
-		resourcePolicies := account.GetResourcePoliciesMap()
-		routers := account.GetResourceRoutersMap()
-		networkMap = account.GetPeerNetworkMap(ctx, peer.ID, peersCustomZone, accountZones, validatedPeers, resourcePolicies, routers, nil, account.GetActiveGroupUsers())
-	}
+	networkMap := c.calcPeerNetworkMap(ctx, account, peer.ID, validatedPeers, inputs, accountZones, nil)
 
 	proxyNetworkMap, ok := proxyNetworkMaps[peer.ID]
 	if ok {
 		networkMap.Merge(proxyNetworkMap)
 	}
 
+	if account.Settings.NetworkMapConnectedPeersOnly {
+		networkMap.RemoveDisconnectedPeers()
+	}
+
 	return networkMap, nil
 }
 
@@ -860,3 +1239,7 @@ func (c *Controller) DisconnectPeers(ctx context.Context, accountId string, peer
 func (c *Controller) TrackEphemeralPeer(ctx context.Context, peer *nbpeer.Peer) {
 	c.EphemeralPeersManager.OnPeerDisconnected(ctx, peer)
 }
+
+func (c *Controller) GetEphemeralPeersPendingCleanup(accountID string) map[string]time.Time {
+	return c.EphemeralPeersManager.GetPendingCleanup(accountID)
+}
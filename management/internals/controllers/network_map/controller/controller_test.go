@@ -1,10 +1,22 @@
 package controller
 
 import (
+	"context"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 
 	"github.com/netbirdio/netbird/management/internals/controllers/network_map"
+	"github.com/netbirdio/netbird/management/internals/controllers/network_map/update_channel"
 	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/management/server/telemetry"
+	"github.com/netbirdio/netbird/management/server/types"
+	"github.com/netbirdio/netbird/route"
+	"github.com/netbirdio/netbird/shared/management/proto"
 )
 
 func TestComputeForwarderPort(t *testing.T) {
@@ -107,3 +119,374 @@ func TestComputeForwarderPort(t *testing.T) {
 		t.Errorf("Expected %d for peers with unknown version, got %d", network_map.OldForwarderPort, result)
 	}
 }
+
+func TestSetPeerGroupsChanged(t *testing.T) {
+	c := &Controller{peerGroups: newPeerGroupsTracker()}
+
+	update := &proto.SyncResponse{}
+	c.setPeerGroupsChanged(update, "peer1", []string{"g2", "g1"})
+	assert.True(t, update.PeerGroupsChanged, "first update of a peer should be reported as changed")
+	assert.ElementsMatch(t, []string{"g1", "g2"}, update.PeerGroups)
+
+	update = &proto.SyncResponse{}
+	c.setPeerGroupsChanged(update, "peer1", []string{"g1", "g2"})
+	assert.False(t, update.PeerGroupsChanged, "same membership in a different order should not be reported as changed")
+	assert.Empty(t, update.PeerGroups)
+
+	update = &proto.SyncResponse{}
+	c.setPeerGroupsChanged(update, "peer1", []string{"g1"})
+	assert.True(t, update.PeerGroupsChanged)
+	assert.Equal(t, []string{"g1"}, update.PeerGroups)
+
+	c.peerGroups.remove("peer1")
+	update = &proto.SyncResponse{}
+	c.setPeerGroupsChanged(update, "peer1", []string{"g1"})
+	assert.True(t, update.PeerGroupsChanged, "membership should be sent again after the peer reconnected")
+}
+
+type peerGroupsRepository struct {
+	Repository
+	groups map[string][]string
+}
+
+func (r *peerGroupsRepository) GetPeerGroupIDs(_ context.Context, _ string, peerID string) ([]string, error) {
+	return r.groups[peerID], nil
+}
+
+func TestSeedPeerGroups(t *testing.T) {
+	repo := &peerGroupsRepository{groups: map[string][]string{"peer1": {"g1", "g2"}}}
+	c := &Controller{peerGroups: newPeerGroupsTracker(), repo: repo}
+
+	c.seedPeerGroups(context.Background(), "account1", "peer1")
+
+	update := &proto.SyncResponse{}
+	c.setPeerGroupsChanged(update, "peer1", []string{"g2", "g1"})
+	assert.False(t, update.PeerGroupsChanged, "membership sent on registration or initial sync should not be reported again")
+
+	update = &proto.SyncResponse{}
+	c.setPeerGroupsChanged(update, "peer1", []string{"g1"})
+	assert.True(t, update.PeerGroupsChanged, "the first real change should be compared against the seeded membership")
+	assert.Equal(t, []string{"g1"}, update.PeerGroups)
+}
+
+func TestOnAccountDeleted(t *testing.T) {
+	repo := &peerGroupsRepository{groups: map[string][]string{"peer1": {"g1"}, "peer2": {"g2"}, "other": {"g1"}}}
+	c := &Controller{
+		peerGroups:         newPeerGroupsTracker(),
+		repo:               repo,
+		laggingPeers:       newLaggingPeersTracker(),
+		networkMapInputs:   newNetworkMapInputsCache(),
+		peersUpdateManager: update_channel.NewPeersUpdateManager(nil),
+	}
+
+	// peers are seeded on registration, even when they never connect
+	for _, peerID := range []string{"peer1", "peer2", "other"} {
+		c.seedPeerGroups(context.Background(), "account1", peerID)
+	}
+	c.laggingPeers.sent("account1", 2, time.Now())
+	c.networkMapInputs.get(context.Background(), &types.Account{Id: "account1", Network: &types.Network{Serial: 2}}, "netbird.cloud")
+
+	c.OnAccountDeleted(context.Background(), "account1", []string{"peer1", "peer2"})
+
+	assert.NotContains(t, c.peerGroups.groups, "peer1")
+	assert.NotContains(t, c.peerGroups.groups, "peer2")
+	assert.Contains(t, c.peerGroups.groups, "other", "peers of other accounts should be kept")
+	assert.Empty(t, c.laggingPeers.pending)
+	assert.Empty(t, c.laggingPeers.settled)
+	assert.Empty(t, c.networkMapInputs.entries)
+}
+
+func TestLaggingPeers(t *testing.T) {
+	peersUpdateManager := update_channel.NewPeersUpdateManager(nil)
+	c := &Controller{laggingPeers: newLaggingPeersTracker(), peersUpdateManager: peersUpdateManager}
+
+	account := &types.Account{
+		Id: "account1",
+		Peers: map[string]*nbpeer.Peer{
+			"up-to-date":   {ID: "up-to-date", AppliedNetworkSerial: 2, Status: &nbpeer.PeerStatus{Connected: true}},
+			"lagging":      {ID: "lagging", AppliedNetworkSerial: 1, Status: &nbpeer.PeerStatus{Connected: true}},
+			"disconnected": {ID: "disconnected", AppliedNetworkSerial: 1, Status: &nbpeer.PeerStatus{}},
+			"stale-stream": {ID: "stale-stream", AppliedNetworkSerial: 1, Status: &nbpeer.PeerStatus{}},
+			"paused":       {ID: "paused", AppliedNetworkSerial: 1, Status: &nbpeer.PeerStatus{Connected: true}},
+			"never-acked":  {ID: "never-acked", Status: &nbpeer.PeerStatus{Connected: true}},
+		},
+	}
+	for _, peerID := range []string{"up-to-date", "lagging", "stale-stream", "paused", "never-acked"} {
+		peersUpdateManager.CreateChannel(context.Background(), peerID)
+	}
+	c.SetPeerUpdatesPaused("paused", true)
+
+	now := time.Now()
+	assert.Equal(t, uint64(0), c.laggingPeers.sent(account.Id, 2, now), "nothing should be sent before the first update")
+	assert.Equal(t, uint64(0), c.laggingPeers.sent(account.Id, 3, now.Add(time.Second)), "the peers should get the grace period to acknowledge the serial")
+	assert.Equal(t, uint64(2), c.laggingPeers.sent(account.Id, 4, now.Add(laggingPeersGracePeriod)))
+	assert.Equal(t, uint64(2), c.laggingPeers.sent(account.Id, 5, now.Add(laggingPeersGracePeriod+time.Second)), "frequent updates should not postpone the pending serial")
+	assert.Equal(t, uint64(4), c.laggingPeers.sent(account.Id, 1, now.Add(2*laggingPeersGracePeriod)), "an older serial should not replace the sent one")
+
+	assert.Equal(t, []string{"lagging"}, c.getLaggingPeers(account, 2))
+	assert.Empty(t, c.getLaggingPeers(account, 1))
+}
+
+func TestRestrictNetworkMap(t *testing.T) {
+	networkMap := &types.NetworkMap{
+		Peers:               []*nbpeer.Peer{{ID: "peer1"}},
+		FirewallRules:       []*types.FirewallRule{{PeerIP: "100.64.0.1"}},
+		Routes:              []*route.Route{{ID: "route1"}},
+		RoutesFirewallRules: []*types.RouteFirewallRule{{Destination: "10.0.0.0/8"}},
+		ForwardingRules:     []*types.ForwardingRule{{RuleProtocol: "tcp"}},
+	}
+
+	restrictNetworkMap(networkMap)
+	assert.Len(t, networkMap.Peers, 1, "peers should be kept")
+	assert.Len(t, networkMap.FirewallRules, 1, "peer firewall rules should be kept")
+	assert.Empty(t, networkMap.Routes)
+	assert.Empty(t, networkMap.RoutesFirewallRules)
+	assert.Empty(t, networkMap.ForwardingRules)
+}
+
+func TestSetPeerAuthorizer(t *testing.T) {
+	c := &Controller{}
+	assert.Equal(t, network_map.DefaultPeerAuthorizer{}, c.getPeerAuthorizer(), "the default authorizer should be used when none is set")
+
+	c.SetPeerAuthorizer(denyAuthorizer{})
+	assert.Equal(t, denyAuthorizer{}, c.getPeerAuthorizer())
+
+	c.SetPeerAuthorizer(nil)
+	assert.Equal(t, network_map.DefaultPeerAuthorizer{}, c.getPeerAuthorizer(), "nil should restore the default authorizer")
+
+	decision, err := c.getPeerAuthorizer().AuthorizePeer(context.Background(), network_map.PeerAuthorizationRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, network_map.PeerAuthorizationFull, decision, "the default authorizer should grant the full map")
+}
+
+func TestPeerCapabilities(t *testing.T) {
+	c := &Controller{}
+	assert.Equal(t, network_map.PeerCapabilities(0), c.GetPeerCapabilities("peer1"), "peers without capabilities should get full network maps")
+
+	c.SetPeerCapabilities("peer1", network_map.PeerCapabilityDeltaNetworkMap|network_map.PeerCapabilityLazyResources)
+	capabilities := c.GetPeerCapabilities("peer1")
+	assert.True(t, capabilities.Has(network_map.PeerCapabilityDeltaNetworkMap))
+	assert.True(t, capabilities.Has(network_map.PeerCapabilityLazyResources))
+
+	c.SetPeerCapabilities("peer1", network_map.PeerCapabilityLazyResources)
+	assert.False(t, c.GetPeerCapabilities("peer1").Has(network_map.PeerCapabilityDeltaNetworkMap), "reported capabilities should replace the previous ones")
+}
+
+type denyAuthorizer struct{}
+
+func (denyAuthorizer) AuthorizePeer(context.Context, network_map.PeerAuthorizationRequest) (network_map.PeerAuthorizationDecision, error) {
+	return network_map.PeerAuthorizationDenied, nil
+}
+
+func TestNetworkMapInputsCache(t *testing.T) {
+	cache := newNetworkMapInputsCache()
+	account := &types.Account{
+		Id:      "account1",
+		Network: &types.Network{Serial: 1},
+		Peers: map[string]*nbpeer.Peer{
+			"peer1": {ID: "peer1", DNSLabel: "peer1"},
+		},
+	}
+
+	first := cache.get(context.Background(), account, "netbird.cloud")
+	require.Len(t, first.peersCustomZone.Records, 1)
+
+	assert.Same(t, first, cache.get(context.Background(), account, "netbird.cloud"), "inputs should be reused within a serial generation")
+	assert.NotSame(t, first, cache.get(context.Background(), account, "other.cloud"), "inputs should be recomputed for another DNS domain")
+
+	account.Peers["peer2"] = &nbpeer.Peer{ID: "peer2", DNSLabel: "peer2"}
+	account.Network.IncSerial()
+
+	second := cache.get(context.Background(), account, "netbird.cloud")
+	assert.NotSame(t, first, second, "inputs should be recomputed after the serial is incremented")
+	assert.Len(t, second.peersCustomZone.Records, 2)
+}
+
+func TestGetNetworkMapInputs_GroupUsers(t *testing.T) {
+	c := &Controller{networkMapInputs: newNetworkMapInputsCache()}
+	account := &types.Account{
+		Id:      "account1",
+		Network: &types.Network{Serial: 1},
+		Groups: map[string]*types.Group{
+			"all": {ID: "all", Name: "All"},
+		},
+		Users: map[string]*types.User{
+			"user1": {Id: "user1", AutoGroups: []string{"devs"}},
+			"user2": {Id: "user2", AutoGroups: []string{"devs"}},
+		},
+	}
+
+	inputs := c.getNetworkMapInputs(context.Background(), account, "netbird.cloud")
+	assert.ElementsMatch(t, []string{"user1", "user2"}, inputs.groupIDToUserIDs["devs"])
+
+	// user changes don't always increment the network serial
+	delete(account.Users, "user2")
+	account.Users["user1"].Blocked = true
+	account.Users["user3"] = &types.User{Id: "user3", AutoGroups: []string{"devs"}}
+
+	inputs = c.getNetworkMapInputs(context.Background(), account, "netbird.cloud")
+	assert.Equal(t, []string{"user3"}, inputs.groupIDToUserIDs["devs"], "group users should be computed for every map build")
+	assert.Nil(t, c.networkMapInputs.get(context.Background(), account, "netbird.cloud").groupIDToUserIDs, "group users must not be cached")
+}
+
+func TestCalcPeerNetworkMap_CountsDuration(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	updateChannelMetrics, err := telemetry.NewUpdateChannelMetrics(context.Background(), sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+	require.NoError(t, err)
+	m, err := newMetrics(updateChannelMetrics)
+	require.NoError(t, err)
+
+	c := &Controller{metrics: m, networkMapInputs: newNetworkMapInputsCache()}
+	account := &types.Account{
+		Id:       "account1",
+		Network:  &types.Network{Serial: 1},
+		Settings: &types.Settings{},
+		Peers: map[string]*nbpeer.Peer{
+			"peer1": {ID: "peer1", DNSLabel: "peer1"},
+		},
+	}
+	inputs := c.getNetworkMapInputs(context.Background(), account, "netbird.cloud")
+
+	require.NotNil(t, c.calcPeerNetworkMap(context.Background(), account, "peer1", map[string]struct{}{"peer1": {}}, inputs, nil, nil))
+	require.NotNil(t, c.calcPeerNetworkMap(context.Background(), account, "peer1", map[string]struct{}{"peer1": {}}, inputs, nil, nil))
+
+	var data metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &data))
+
+	var calculations uint64
+	for _, scope := range data.ScopeMetrics {
+		for _, metric := range scope.Metrics {
+			if metric.Name != "management.updatechannel.calc.networkmap.duration.ms" {
+				continue
+			}
+			histogram, ok := metric.Data.(metricdata.Histogram[int64])
+			require.True(t, ok)
+			for _, point := range histogram.DataPoints {
+				calculations += point.Count
+			}
+		}
+	}
+	assert.Equal(t, uint64(2), calculations, "every network map calculation should be counted")
+}
+
+func TestConnectionChanges(t *testing.T) {
+	changes := newConnectionChanges()
+	changes.add("account1", "peer1")
+	changes.add("account1", "peer2")
+	changes.add("account1", "peer1")
+	changes.add("account2", "peer3")
+
+	assert.ElementsMatch(t, []string{"peer1", "peer2"}, changes.take("account1"))
+	assert.Empty(t, changes.take("account1"), "taken changes should be forgotten")
+	assert.Equal(t, []string{"peer3"}, changes.take("account2"))
+}
+
+func TestAccountUpdateInProgress(t *testing.T) {
+	c := &Controller{}
+	accountID := "account"
+	assert.False(t, c.IsAccountUpdateInProgress(accountID))
+	require.NoError(t, c.WaitAccountUpdate(context.Background(), accountID))
+
+	b := &bufferUpdate{}
+	c.sendAccountUpdateLocks.Store(accountID, b)
+	assert.False(t, c.IsAccountUpdateInProgress(accountID))
+
+	b.begin()
+	assert.True(t, c.IsAccountUpdateInProgress(accountID))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, c.WaitAccountUpdate(ctx, accountID), context.DeadlineExceeded)
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- c.WaitAccountUpdate(context.Background(), accountID)
+	}()
+	b.end()
+	select {
+	case err := <-waited:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiting should return once the update is done")
+	}
+	assert.False(t, c.IsAccountUpdateInProgress(accountID))
+
+	// a scheduled update counts until it ran
+	ran := make(chan struct{}, 1)
+	update := func() { ran <- struct{}{} }
+	b.schedule(20*time.Millisecond, update)
+	assert.True(t, c.IsAccountUpdateInProgress(accountID))
+	require.NoError(t, c.WaitAccountUpdate(context.Background(), accountID))
+	select {
+	case <-ran:
+	default:
+		t.Fatal("the scheduled update should have run before waiting returned")
+	}
+
+	// rescheduling and cancelling the pending update doesn't leave it counted
+	b.schedule(time.Hour, update)
+	b.schedule(time.Hour, update)
+	assert.True(t, c.IsAccountUpdateInProgress(accountID))
+	b.stop()
+	assert.False(t, c.IsAccountUpdateInProgress(accountID))
+}
+
+func TestBufferUpdateState(t *testing.T) {
+	c := &Controller{}
+	accountID := "account"
+	assert.Equal(t, network_map.AccountBufferUpdateState{}, c.GetBufferUpdateState(accountID))
+
+	b := &bufferUpdate{}
+	c.accountUpdateLocks.Store(accountID, b)
+
+	require.True(t, b.tryLock())
+	b.update.Store(true)
+	state := c.GetBufferUpdateState(accountID)
+	assert.True(t, state.Update.Locked)
+	assert.True(t, state.Update.UpdatePending)
+	assert.Nil(t, state.Update.NextUpdateAt)
+	assert.Equal(t, network_map.BufferUpdateState{}, state.Send)
+
+	b.unlock()
+	b.update.Store(false)
+	b.schedule(time.Hour, func() {})
+	state = c.GetBufferUpdateState(accountID)
+	assert.False(t, state.Update.Locked)
+	assert.Equal(t, int32(1), state.Update.InFlight)
+	require.NotNil(t, state.Update.NextUpdateAt)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *state.Update.NextUpdateAt, time.Minute)
+
+	b.stop()
+	state = c.GetBufferUpdateState(accountID)
+	assert.Equal(t, int32(0), state.Update.InFlight)
+	assert.Nil(t, state.Update.NextUpdateAt)
+}
+
+func TestBufferIntervals(t *testing.T) {
+	intervals := newBufferIntervals()
+	intervals.setGlobal(100 * time.Millisecond)
+
+	var loads int
+	load := func(_ context.Context, accountID string) (*types.Settings, error) {
+		loads++
+		if accountID == "override" {
+			return &types.Settings{PeerUpdateBufferInterval: time.Second}, nil
+		}
+		return &types.Settings{}, nil
+	}
+
+	assert.Equal(t, time.Second, intervals.get(context.Background(), "override", load))
+	assert.Equal(t, 100*time.Millisecond, intervals.get(context.Background(), "default", load))
+	assert.Equal(t, time.Second, intervals.get(context.Background(), "override", load))
+	assert.Equal(t, 2, loads, "the settings should only be read for accounts not seen yet")
+
+	// a loaded account refreshes its override without reading the settings again
+	intervals.observe("override", &types.Settings{})
+	assert.Equal(t, 100*time.Millisecond, intervals.get(context.Background(), "override", load))
+	intervals.observe("default", &types.Settings{PeerUpdateBufferInterval: 5 * time.Second})
+	assert.Equal(t, 5*time.Second, intervals.get(context.Background(), "default", load))
+	assert.Equal(t, 2, loads)
+
+	intervals.setGlobal(time.Millisecond)
+	assert.Equal(t, time.Millisecond, intervals.get(context.Background(), "override", load), "accounts without an override follow the global interval")
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/management/server/types"
+)
+
+// laggingPeersGracePeriod is how long the peers have to acknowledge a network map before they are reported as
+// lagging behind. It covers the round trip of the acknowledgement and the interval the acknowledgements are
+// buffered for before they are written to the store
+const laggingPeersGracePeriod = 30 * time.Second
+
+// sentSerial is a network serial sent to the peers of an account
+type sentSerial struct {
+	serial uint64
+	sentAt time.Time
+}
+
+// laggingPeersTracker remembers the network serials sent to the peers of each account, so that peers which didn't
+// acknowledge a serial within laggingPeersGracePeriod can be detected.
+type laggingPeersTracker struct {
+	mu sync.Mutex
+	// settled holds the newest serial sent at least laggingPeersGracePeriod ago
+	settled map[string]sentSerial
+	// pending holds the oldest serial sent within laggingPeersGracePeriod
+	pending map[string]sentSerial
+}
+
+func newLaggingPeersTracker() *laggingPeersTracker {
+	return &laggingPeersTracker{
+		settled: make(map[string]sentSerial),
+		pending: make(map[string]sentSerial),
+	}
+}
+
+// sent stores the serial sent to the peers of the account at the given time and returns the newest serial sent at
+// least laggingPeersGracePeriod before, or 0 when there is none.
+func (t *laggingPeersTracker) sent(accountID string, serial uint64, now time.Time) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending, ok := t.pending[accountID]
+	if ok && now.Sub(pending.sentAt) >= laggingPeersGracePeriod {
+		t.settled[accountID] = pending
+		ok = false
+	}
+	// a pending serial is kept until it settles, so frequent updates can't keep postponing the check
+	if !ok && serial > t.settled[accountID].serial {
+		t.pending[accountID] = sentSerial{serial: serial, sentAt: now}
+	} else if !ok {
+		delete(t.pending, accountID)
+	}
+
+	return t.settled[accountID].serial
+}
+
+// remove drops the serials sent to the peers of the account, e.g. when the account is deleted
+func (t *laggingPeersTracker) remove(accountID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.settled, accountID)
+	delete(t.pending, accountID)
+}
+
+// getLaggingPeers returns the IDs of the connected peers that acknowledged a network map older than the
+// given serial. Peers that never acknowledged a network map, e.g. older clients, and peers that don't receive
+// updates, because they are disconnected or their updates are paused, are not reported.
+func (c *Controller) getLaggingPeers(account *types.Account, serial uint64) []string {
+	var lagging []string
+	for _, peer := range account.Peers {
+		if peer.AppliedNetworkSerial == 0 || peer.AppliedNetworkSerial >= serial {
+			continue
+		}
+		if peer.Status == nil || !peer.Status.Connected || !c.peersUpdateManager.HasChannel(peer.ID) {
+			continue
+		}
+		if c.isPeerUpdatesPaused(peer.ID) {
+			continue
+		}
+		lagging = append(lagging, peer.ID)
+	}
+	return lagging
+}
+
+// checkLaggingPeers records the serial about to be sent to the peers of the account and reports the connected
+// peers that are still behind the serial sent at least laggingPeersGracePeriod ago.
+func (c *Controller) checkLaggingPeers(ctx context.Context, account *types.Account) {
+	settledSerial := c.laggingPeers.sent(account.Id, account.Network.CurrentSerial(), time.Now())
+	if settledSerial == 0 {
+		return
+	}
+
+	lagging := c.getLaggingPeers(account, settledSerial)
+	if len(lagging) == 0 {
+		return
+	}
+
+	log.WithContext(ctx).Warnf("%d connected peers of account %s didn't apply the network map with serial %d: %v",
+		len(lagging), account.Id, settledSerial, lagging)
+
+	if c.accountManagerMetrics != nil {
+		c.accountManagerMetrics.CountLaggingPeers(len(lagging))
+	}
+}
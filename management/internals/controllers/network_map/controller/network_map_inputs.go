@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"sync"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+	routerTypes "github.com/netbirdio/netbird/management/server/networks/routers/types"
+	"github.com/netbirdio/netbird/management/server/types"
+)
+
+// networkMapInputs holds the account-wide inputs shared by all peer network map computations.
+// Apart from groupIDToUserIDs they only change when the account network serial is incremented, so they must be
+// treated as read-only.
+type networkMapInputs struct {
+	serial           uint64
+	dnsDomain        string
+	peersCustomZone  nbdns.CustomZone
+	resourcePolicies map[string][]*types.Policy
+	routers          map[string]map[string]*routerTypes.NetworkRouter
+	// groupIDToUserIDs holds the SSH authorized users. It isn't cached, as deleting, approving or blocking a user
+	// doesn't always increment the network serial
+	groupIDToUserIDs map[string][]string
+}
+
+// newNetworkMapInputs computes the inputs that only change with the account network serial
+func newNetworkMapInputs(ctx context.Context, account *types.Account, dnsDomain string) *networkMapInputs {
+	return &networkMapInputs{
+		serial:           account.Network.CurrentSerial(),
+		dnsDomain:        dnsDomain,
+		peersCustomZone:  account.GetPeersCustomZone(ctx, dnsDomain),
+		resourcePolicies: account.GetResourcePoliciesMap(),
+		routers:          account.GetResourceRoutersMap(),
+	}
+}
+
+// networkMapInputsCache caches the shared network map inputs per account, keyed by the account network serial.
+// Incrementing the serial invalidates the cached inputs of the account.
+type networkMapInputsCache struct {
+	mu      sync.Mutex
+	entries map[string]*networkMapInputs
+}
+
+func newNetworkMapInputsCache() *networkMapInputsCache {
+	return &networkMapInputsCache{
+		entries: make(map[string]*networkMapInputs),
+	}
+}
+
+// get returns the shared inputs for the account, computing them only if the cached ones are from another serial generation
+func (c *networkMapInputsCache) get(ctx context.Context, account *types.Account, dnsDomain string) *networkMapInputs {
+	serial := account.Network.CurrentSerial()
+
+	c.mu.Lock()
+	cached, ok := c.entries[account.Id]
+	c.mu.Unlock()
+	if ok && cached.serial == serial && cached.dnsDomain == dnsDomain {
+		return cached
+	}
+
+	// computed outside the lock to not block map builds of other accounts
+	inputs := newNetworkMapInputs(ctx, account, dnsDomain)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// don't replace inputs of a newer generation computed concurrently
+	if current, ok := c.entries[account.Id]; !ok || current.serial <= serial {
+		c.entries[account.Id] = inputs
+	}
+
+	return inputs
+}
+
+// remove drops the cached inputs of the account, e.g. when the account is deleted
+func (c *networkMapInputsCache) remove(accountID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, accountID)
+}
+
+// getNetworkMapInputs returns the account-wide network map inputs with the active users of the groups computed for
+// this map build. The experimental network map builder keeps its own account copy that is updated in place, so its
+// inputs are always computed from it.
+func (c *Controller) getNetworkMapInputs(ctx context.Context, account *types.Account, dnsDomain string) *networkMapInputs {
+	if c.experimentalNetworkMap(account.Id) {
+		inputs := newNetworkMapInputs(ctx, account, dnsDomain)
+		inputs.groupIDToUserIDs = account.GetActiveGroupUsers()
+		return inputs
+	}
+
+	// the cached inputs are shared, so the users are set on a copy
+	inputs := *c.networkMapInputs.get(ctx, account, dnsDomain)
+	inputs.groupIDToUserIDs = account.GetActiveGroupUsers()
+	return &inputs
+}
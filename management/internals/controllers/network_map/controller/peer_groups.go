@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/shared/management/proto"
+)
+
+// peerGroupsTracker remembers the group membership last sent to each connected peer,
+// so that sync responses can signal when it changes.
+type peerGroupsTracker struct {
+	mu     sync.Mutex
+	groups map[string][]string
+}
+
+func newPeerGroupsTracker() *peerGroupsTracker {
+	return &peerGroupsTracker{
+		groups: make(map[string][]string),
+	}
+}
+
+// update stores the peer's current group IDs and reports whether they differ from the previously sent ones.
+// A peer without a previous record is reported as changed.
+func (t *peerGroupsTracker) update(peerID string, groupIDs []string) bool {
+	sorted := slices.Clone(groupIDs)
+	slices.Sort(sorted)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous, ok := t.groups[peerID]
+	if ok && slices.Equal(previous, sorted) {
+		return false
+	}
+
+	t.groups[peerID] = sorted
+	return true
+}
+
+// set stores the peer's group IDs as the ones last sent to it
+func (t *peerGroupsTracker) set(peerID string, groupIDs []string) {
+	sorted := slices.Clone(groupIDs)
+	slices.Sort(sorted)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.groups[peerID] = sorted
+}
+
+// remove drops the record of the peer, e.g. when its stream is closed
+func (t *peerGroupsTracker) remove(peerID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.groups, peerID)
+}
+
+// seedPeerGroups records the peer's current group membership, as sent on registration and on the initial sync,
+// so that the first following update is compared against it instead of an empty set.
+// Without a stored membership the record is dropped and the next update carries the full group list.
+func (c *Controller) seedPeerGroups(ctx context.Context, accountID string, peerID string) {
+	groupIDs, err := c.repo.GetPeerGroupIDs(ctx, accountID, peerID)
+	if err != nil {
+		log.WithContext(ctx).Debugf("failed to get groups of peer %s, its next update will carry the full group list: %v", peerID, err)
+		c.peerGroups.remove(peerID)
+		return
+	}
+	c.peerGroups.set(peerID, groupIDs)
+}
+
+// setPeerGroupsChanged sets the groups-changed indicator on the sync response and includes the full group list
+// only when the membership changed since the last response sent to the peer.
+func (c *Controller) setPeerGroupsChanged(update *proto.SyncResponse, peerID string, groupIDs []string) {
+	if !c.peerGroups.update(peerID, groupIDs) {
+		return
+	}
+
+	update.PeerGroupsChanged = true
+	update.PeerGroups = groupIDs
+}
@@ -16,6 +16,8 @@ type Repository interface {
 	GetPeersByIDs(ctx context.Context, accountID string, peerIDs []string) (map[string]*peer.Peer, error)
 	GetPeerByID(ctx context.Context, accountID string, peerID string) (*peer.Peer, error)
 	GetAccountZones(ctx context.Context, accountID string) ([]*zones.Zone, error)
+	GetAccountSettings(ctx context.Context, accountID string) (*types.Settings, error)
+	GetPeerGroupIDs(ctx context.Context, accountID string, peerID string) ([]string, error)
 }
 
 type repository struct {
@@ -35,7 +37,7 @@ func (r *repository) GetAccountNetwork(ctx context.Context, accountID string) (*
 }
 
 func (r *repository) GetAccountPeers(ctx context.Context, accountID string) ([]*peer.Peer, error) {
-	return r.store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "")
+	return r.store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "", nil)
 }
 
 func (r *repository) GetAccountByPeerID(ctx context.Context, peerID string) (*types.Account, error) {
@@ -53,3 +55,11 @@ func (r *repository) GetPeerByID(ctx context.Context, accountID string, peerID s
 func (r *repository) GetAccountZones(ctx context.Context, accountID string) ([]*zones.Zone, error) {
 	return r.store.GetAccountZones(ctx, store.LockingStrengthNone, accountID)
 }
+
+func (r *repository) GetAccountSettings(ctx context.Context, accountID string) (*types.Settings, error) {
+	return r.store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+}
+
+func (r *repository) GetPeerGroupIDs(ctx context.Context, accountID string, peerID string) ([]string, error) {
+	return r.store.GetPeerGroupIDs(ctx, store.LockingStrengthNone, accountID, peerID)
+}
@@ -4,6 +4,7 @@ package network_map
 
 import (
 	"context"
+	"time"
 
 	nbdns "github.com/netbirdio/netbird/dns"
 	nbpeer "github.com/netbirdio/netbird/management/server/peer"
@@ -24,6 +25,9 @@ type Controller interface {
 	UpdateAccountPeers(ctx context.Context, accountID string) error
 	UpdateAccountPeer(ctx context.Context, accountId string, peerId string) error
 	BufferUpdateAccountPeers(ctx context.Context, accountID string) error
+	IsAccountUpdateInProgress(accountID string) bool
+	GetBufferUpdateState(accountID string) AccountBufferUpdateState
+	WaitAccountUpdate(ctx context.Context, accountID string) error
 	GetValidatedPeerWithMap(ctx context.Context, isRequiresApproval bool, accountID string, p *nbpeer.Peer) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, int64, error)
 	GetDNSDomain(settings *types.Settings) string
 	StartWarmup(context.Context)
@@ -33,9 +37,15 @@ type Controller interface {
 	OnPeersUpdated(ctx context.Context, accountId string, peerIDs []string) error
 	OnPeersAdded(ctx context.Context, accountID string, peerIDs []string) error
 	OnPeersDeleted(ctx context.Context, accountID string, peerIDs []string) error
+	OnAccountDeleted(ctx context.Context, accountID string, peerIDs []string)
 	DisconnectPeers(ctx context.Context, accountId string, peerIDs []string)
 	OnPeerConnected(ctx context.Context, accountID string, peerID string) (chan *UpdateMessage, error)
+	OnPeerConnectionChanged(ctx context.Context, accountID string, peerID string) error
 	OnPeerDisconnected(ctx context.Context, accountID string, peerID string)
 
 	TrackEphemeralPeer(ctx context.Context, peer *nbpeer.Peer)
+	GetEphemeralPeersPendingCleanup(accountID string) map[string]time.Time
+	SetPeerUpdatesPaused(peerID string, paused bool)
+	SetPeerCapabilities(peerID string, capabilities PeerCapabilities)
+	GetPeerCapabilities(peerID string) PeerCapabilities
 }
@@ -12,6 +12,7 @@ package network_map
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	peer "github.com/netbirdio/netbird/management/server/peer"
 	posture "github.com/netbirdio/netbird/management/server/posture"
@@ -83,6 +84,20 @@ func (mr *MockControllerMockRecorder) DisconnectPeers(ctx, accountId, peerIDs an
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisconnectPeers", reflect.TypeOf((*MockController)(nil).DisconnectPeers), ctx, accountId, peerIDs)
 }
 
+// GetBufferUpdateState mocks base method.
+func (m *MockController) GetBufferUpdateState(accountID string) AccountBufferUpdateState {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBufferUpdateState", accountID)
+	ret0, _ := ret[0].(AccountBufferUpdateState)
+	return ret0
+}
+
+// GetBufferUpdateState indicates an expected call of GetBufferUpdateState.
+func (mr *MockControllerMockRecorder) GetBufferUpdateState(accountID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBufferUpdateState", reflect.TypeOf((*MockController)(nil).GetBufferUpdateState), accountID)
+}
+
 // GetDNSDomain mocks base method.
 func (m *MockController) GetDNSDomain(settings *types.Settings) string {
 	m.ctrl.T.Helper()
@@ -97,6 +112,20 @@ func (mr *MockControllerMockRecorder) GetDNSDomain(settings any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDNSDomain", reflect.TypeOf((*MockController)(nil).GetDNSDomain), settings)
 }
 
+// GetEphemeralPeersPendingCleanup mocks base method.
+func (m *MockController) GetEphemeralPeersPendingCleanup(accountID string) map[string]time.Time {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEphemeralPeersPendingCleanup", accountID)
+	ret0, _ := ret[0].(map[string]time.Time)
+	return ret0
+}
+
+// GetEphemeralPeersPendingCleanup indicates an expected call of GetEphemeralPeersPendingCleanup.
+func (mr *MockControllerMockRecorder) GetEphemeralPeersPendingCleanup(accountID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEphemeralPeersPendingCleanup", reflect.TypeOf((*MockController)(nil).GetEphemeralPeersPendingCleanup), accountID)
+}
+
 // GetNetworkMap mocks base method.
 func (m *MockController) GetNetworkMap(ctx context.Context, peerID string) (*types.NetworkMap, error) {
 	m.ctrl.T.Helper()
@@ -112,6 +141,20 @@ func (mr *MockControllerMockRecorder) GetNetworkMap(ctx, peerID any) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNetworkMap", reflect.TypeOf((*MockController)(nil).GetNetworkMap), ctx, peerID)
 }
 
+// GetPeerCapabilities mocks base method.
+func (m *MockController) GetPeerCapabilities(peerID string) PeerCapabilities {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPeerCapabilities", peerID)
+	ret0, _ := ret[0].(PeerCapabilities)
+	return ret0
+}
+
+// GetPeerCapabilities indicates an expected call of GetPeerCapabilities.
+func (mr *MockControllerMockRecorder) GetPeerCapabilities(peerID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPeerCapabilities", reflect.TypeOf((*MockController)(nil).GetPeerCapabilities), peerID)
+}
+
 // GetValidatedPeerWithMap mocks base method.
 func (m *MockController) GetValidatedPeerWithMap(ctx context.Context, isRequiresApproval bool, accountID string, p *peer.Peer) (*peer.Peer, *types.NetworkMap, []*posture.Checks, int64, error) {
 	m.ctrl.T.Helper()
@@ -130,6 +173,32 @@ func (mr *MockControllerMockRecorder) GetValidatedPeerWithMap(ctx, isRequiresApp
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetValidatedPeerWithMap", reflect.TypeOf((*MockController)(nil).GetValidatedPeerWithMap), ctx, isRequiresApproval, accountID, p)
 }
 
+// IsAccountUpdateInProgress mocks base method.
+func (m *MockController) IsAccountUpdateInProgress(accountID string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsAccountUpdateInProgress", accountID)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsAccountUpdateInProgress indicates an expected call of IsAccountUpdateInProgress.
+func (mr *MockControllerMockRecorder) IsAccountUpdateInProgress(accountID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsAccountUpdateInProgress", reflect.TypeOf((*MockController)(nil).IsAccountUpdateInProgress), accountID)
+}
+
+// OnAccountDeleted mocks base method.
+func (m *MockController) OnAccountDeleted(ctx context.Context, accountID string, peerIDs []string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnAccountDeleted", ctx, accountID, peerIDs)
+}
+
+// OnAccountDeleted indicates an expected call of OnAccountDeleted.
+func (mr *MockControllerMockRecorder) OnAccountDeleted(ctx, accountID, peerIDs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnAccountDeleted", reflect.TypeOf((*MockController)(nil).OnAccountDeleted), ctx, accountID, peerIDs)
+}
+
 // OnPeerConnected mocks base method.
 func (m *MockController) OnPeerConnected(ctx context.Context, accountID, peerID string) (chan *UpdateMessage, error) {
 	m.ctrl.T.Helper()
@@ -145,6 +214,20 @@ func (mr *MockControllerMockRecorder) OnPeerConnected(ctx, accountID, peerID any
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnPeerConnected", reflect.TypeOf((*MockController)(nil).OnPeerConnected), ctx, accountID, peerID)
 }
 
+// OnPeerConnectionChanged mocks base method.
+func (m *MockController) OnPeerConnectionChanged(ctx context.Context, accountID, peerID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OnPeerConnectionChanged", ctx, accountID, peerID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// OnPeerConnectionChanged indicates an expected call of OnPeerConnectionChanged.
+func (mr *MockControllerMockRecorder) OnPeerConnectionChanged(ctx, accountID, peerID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnPeerConnectionChanged", reflect.TypeOf((*MockController)(nil).OnPeerConnectionChanged), ctx, accountID, peerID)
+}
+
 // OnPeerDisconnected mocks base method.
 func (m *MockController) OnPeerDisconnected(ctx context.Context, accountID, peerID string) {
 	m.ctrl.T.Helper()
@@ -199,6 +282,30 @@ func (mr *MockControllerMockRecorder) OnPeersUpdated(ctx, accountId, peerIDs any
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnPeersUpdated", reflect.TypeOf((*MockController)(nil).OnPeersUpdated), ctx, accountId, peerIDs)
 }
 
+// SetPeerCapabilities mocks base method.
+func (m *MockController) SetPeerCapabilities(peerID string, capabilities PeerCapabilities) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetPeerCapabilities", peerID, capabilities)
+}
+
+// SetPeerCapabilities indicates an expected call of SetPeerCapabilities.
+func (mr *MockControllerMockRecorder) SetPeerCapabilities(peerID, capabilities any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPeerCapabilities", reflect.TypeOf((*MockController)(nil).SetPeerCapabilities), peerID, capabilities)
+}
+
+// SetPeerUpdatesPaused mocks base method.
+func (m *MockController) SetPeerUpdatesPaused(peerID string, paused bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetPeerUpdatesPaused", peerID, paused)
+}
+
+// SetPeerUpdatesPaused indicates an expected call of SetPeerUpdatesPaused.
+func (mr *MockControllerMockRecorder) SetPeerUpdatesPaused(peerID, paused any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPeerUpdatesPaused", reflect.TypeOf((*MockController)(nil).SetPeerUpdatesPaused), peerID, paused)
+}
+
 // StartWarmup mocks base method.
 func (m *MockController) StartWarmup(arg0 context.Context) {
 	m.ctrl.T.Helper()
@@ -250,3 +357,17 @@ func (mr *MockControllerMockRecorder) UpdateAccountPeers(ctx, accountID any) *go
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateAccountPeers", reflect.TypeOf((*MockController)(nil).UpdateAccountPeers), ctx, accountID)
 }
+
+// WaitAccountUpdate mocks base method.
+func (m *MockController) WaitAccountUpdate(ctx context.Context, accountID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaitAccountUpdate", ctx, accountID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WaitAccountUpdate indicates an expected call of WaitAccountUpdate.
+func (mr *MockControllerMockRecorder) WaitAccountUpdate(ctx, accountID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitAccountUpdate", reflect.TypeOf((*MockController)(nil).WaitAccountUpdate), ctx, accountID)
+}
@@ -0,0 +1,45 @@
+package network_map
+
+import (
+	"context"
+
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/management/server/posture"
+	"github.com/netbirdio/netbird/management/server/types"
+)
+
+// PeerAuthorizationDecision defines how much of its network map a peer receives
+type PeerAuthorizationDecision int
+
+const (
+	// PeerAuthorizationFull grants the complete network map
+	PeerAuthorizationFull PeerAuthorizationDecision = iota
+	// PeerAuthorizationRestricted grants the peers and their firewall rules, but no routes, route firewall rules
+	// or forwarding rules, so the peer can't reach the networks behind routing peers
+	PeerAuthorizationRestricted
+	// PeerAuthorizationDenied grants an empty network map, the same way as for a peer pending approval
+	PeerAuthorizationDenied
+)
+
+// PeerAuthorizationRequest holds the context a PeerAuthorizer decides on
+type PeerAuthorizationRequest struct {
+	Account       *types.Account
+	Peer          *nbpeer.Peer
+	PostureChecks []*posture.Checks
+}
+
+// PeerAuthorizer decides on every sync and every network map update pushed to a validated peer how much of its
+// network map the peer receives, e.g. based on external signals like the time of day or the status of a ticket.
+// It can only restrict the map further: peers pending approval get an empty map without the authorizer being called.
+// It is called concurrently for the peers of an account, so implementations must be safe for concurrent use
+type PeerAuthorizer interface {
+	AuthorizePeer(ctx context.Context, request PeerAuthorizationRequest) (PeerAuthorizationDecision, error)
+}
+
+// DefaultPeerAuthorizer grants the full network map to every validated peer
+type DefaultPeerAuthorizer struct{}
+
+// AuthorizePeer always returns PeerAuthorizationFull
+func (DefaultPeerAuthorizer) AuthorizePeer(_ context.Context, _ PeerAuthorizationRequest) (PeerAuthorizationDecision, error) {
+	return PeerAuthorizationFull, nil
+}
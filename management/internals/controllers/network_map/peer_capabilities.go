@@ -0,0 +1,17 @@
+package network_map
+
+// PeerCapabilities is the set of network map features a connected client reported to handle.
+// Peers without any capability, e.g. older clients, receive full network maps
+type PeerCapabilities uint32
+
+const (
+	// PeerCapabilityDeltaNetworkMap is set for clients that apply delta network maps
+	PeerCapabilityDeltaNetworkMap PeerCapabilities = 1 << iota
+	// PeerCapabilityLazyResources is set for clients that resolve lazy network maps with GetResourceDetails
+	PeerCapabilityLazyResources
+)
+
+// Has returns true if all the given capabilities are set
+func (c PeerCapabilities) Has(capabilities PeerCapabilities) bool {
+	return c&capabilities == capabilities
+}
@@ -6,4 +6,6 @@ import (
 
 type UpdateMessage struct {
 	Update *proto.SyncResponse
+	// Capabilities are the capabilities of the receiving peer at the time the update was built
+	Capabilities PeerCapabilities
 }
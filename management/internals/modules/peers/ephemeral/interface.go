@@ -16,4 +16,5 @@ type Manager interface {
 	Stop()
 	OnPeerConnected(ctx context.Context, peer *nbpeer.Peer)
 	OnPeerDisconnected(ctx context.Context, peer *nbpeer.Peer)
+	GetPendingCleanup(accountID string) map[string]time.Time
 }
@@ -134,6 +134,21 @@ func (e *EphemeralManager) OnPeerDisconnected(ctx context.Context, peer *nbpeer.
 	}
 }
 
+// GetPendingCleanup returns the ephemeral peers of the account which are waiting for cleanup, mapped
+// to the time after which they become eligible for deletion.
+func (e *EphemeralManager) GetPendingCleanup(accountID string) map[string]time.Time {
+	e.peersLock.Lock()
+	defer e.peersLock.Unlock()
+
+	pending := make(map[string]time.Time)
+	for p := e.headPeer; p != nil; p = p.next {
+		if p.accountID == accountID {
+			pending[p.id] = p.deadline
+		}
+	}
+	return pending
+}
+
 func (e *EphemeralManager) loadEphemeralPeers(ctx context.Context) {
 	peers, err := e.store.GetAllEphemeralPeers(ctx, store.LockingStrengthNone)
 	if err != nil {
@@ -276,6 +276,36 @@ func TestCleanupSchedulingBehaviorIsBatched(t *testing.T) {
 	assert.Equal(t, ephemeralPeers, mockAM.GetDeletePeerCalls(), "should have deleted all peers")
 }
 
+func TestGetPendingCleanup(t *testing.T) {
+	t.Cleanup(func() {
+		timeNow = time.Now
+	})
+	startTime := time.Now()
+	timeNow = func() time.Time {
+		return startTime
+	}
+
+	ctrl := gomock.NewController(t)
+	mgr := NewEphemeralManager(&MockStore{}, peers.NewMockManager(ctrl))
+	defer mgr.Stop()
+
+	mgr.OnPeerDisconnected(context.Background(), &nbpeer.Peer{ID: "peer_a", AccountID: "account_1", Ephemeral: true})
+	startTime = startTime.Add(time.Minute)
+	mgr.OnPeerDisconnected(context.Background(), &nbpeer.Peer{ID: "peer_b", AccountID: "account_1", Ephemeral: true})
+	mgr.OnPeerDisconnected(context.Background(), &nbpeer.Peer{ID: "peer_c", AccountID: "account_2", Ephemeral: true})
+	mgr.OnPeerDisconnected(context.Background(), &nbpeer.Peer{ID: "peer_d", AccountID: "account_1", Ephemeral: false})
+
+	pending := mgr.GetPendingCleanup("account_1")
+	assert.Equal(t, map[string]time.Time{
+		"peer_a": startTime.Add(-time.Minute).Add(ephemeral.EphemeralLifeTime),
+		"peer_b": startTime.Add(ephemeral.EphemeralLifeTime),
+	}, pending)
+
+	mgr.OnPeerConnected(context.Background(), &nbpeer.Peer{ID: "peer_a", AccountID: "account_1", Ephemeral: true})
+	assert.Len(t, mgr.GetPendingCleanup("account_1"), 1, "connected peer should not be pending cleanup")
+	assert.Empty(t, mgr.GetPendingCleanup("account_3"))
+}
+
 func seedPeers(store *MockStore, numberOfPeers int, numberOfEphemeralPeers int) {
 	store.account = newAccountWithId(context.Background(), "my account", "", "", false)
 
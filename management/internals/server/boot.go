@@ -7,6 +7,7 @@ import (
 	"crypto/tls"
 	"net/http"
 	"net/netip"
+	"regexp"
 	"slices"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/netbirdio/management-integrations/integrations"
 	"github.com/netbirdio/netbird/encryption"
@@ -32,6 +34,8 @@ import (
 )
 
 var (
+	correlationIDRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
 	kaep = keepalive.EnforcementPolicy{
 		MinTime:             15 * time.Second,
 		PermitWithoutStream: true,
@@ -184,6 +188,8 @@ func unaryInterceptor(
 	ctx = context.WithValue(ctx, hook.ExecutionContextKey, hook.GRPCSource)
 	//nolint
 	ctx = context.WithValue(ctx, nbContext.RequestIDKey, reqID)
+	//nolint
+	ctx = context.WithValue(ctx, nbContext.CorrelationIDKey, correlationID(ctx, reqID))
 	return handler(ctx, req)
 }
 
@@ -198,6 +204,25 @@ func streamInterceptor(
 	//nolint
 	ctx := context.WithValue(ss.Context(), hook.ExecutionContextKey, hook.GRPCSource)
 	//nolint
-	wrapped.WrappedContext = context.WithValue(ctx, nbContext.RequestIDKey, reqID)
+	ctx = context.WithValue(ctx, nbContext.RequestIDKey, reqID)
+	//nolint
+	wrapped.WrappedContext = context.WithValue(ctx, nbContext.CorrelationIDKey, correlationID(ctx, reqID))
 	return handler(srv, wrapped)
 }
+
+// correlationID returns the correlation ID the client sent in the request metadata, falling back to the request ID
+// for clients that don't send one. IDs that are too long or contain anything but letters, digits, '-', '_' and '.'
+// are ignored, so they can't tamper with the logs
+func correlationID(ctx context.Context, reqID string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return reqID
+	}
+
+	for _, id := range md.Get(nbContext.CorrelationIDHeader) {
+		if correlationIDRegex.MatchString(id) {
+			return id
+		}
+	}
+	return reqID
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+
+	nbContext "github.com/netbirdio/netbird/management/server/context"
+)
+
+func TestCorrelationID(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{
+			name:     "no metadata falls back to the request ID",
+			ctx:      context.Background(),
+			expected: "request-id",
+		},
+		{
+			name:     "correlation ID sent by the client",
+			ctx:      metadata.NewIncomingContext(context.Background(), metadata.Pairs(nbContext.CorrelationIDHeader, "9b2c4d6e-client")),
+			expected: "9b2c4d6e-client",
+		},
+		{
+			name:     "correlation ID with invalid characters is ignored",
+			ctx:      metadata.NewIncomingContext(context.Background(), metadata.Pairs(nbContext.CorrelationIDHeader, "id\nforged log line")),
+			expected: "request-id",
+		},
+		{
+			name:     "too long correlation ID is ignored",
+			ctx:      metadata.NewIncomingContext(context.Background(), metadata.Pairs(nbContext.CorrelationIDHeader, strings.Repeat("a", 65))),
+			expected: "request-id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, correlationID(tt.ctx, "request-id"))
+		})
+	}
+}
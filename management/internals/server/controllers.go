@@ -108,7 +108,13 @@ func (s *BaseServer) NetworkMapController() network_map.Controller {
 
 func (s *BaseServer) AccountRequestBuffer() *server.AccountRequestBuffer {
 	return Create(s, func() *server.AccountRequestBuffer {
-		return server.NewAccountRequestBuffer(context.Background(), s.Store())
+		requestBuffer := server.NewAccountRequestBuffer(context.Background(), s.Store())
+		if metrics := s.Metrics(); metrics != nil {
+			if err := metrics.AccountManagerMetrics().RegisterRequestBufferDepth(requestBuffer.Depth); err != nil {
+				log.Errorf("failed to register account request buffer depth metric: %v", err)
+			}
+		}
+		return requestBuffer
 	})
 }
 
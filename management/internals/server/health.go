@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/management/server/account"
+	"github.com/netbirdio/netbird/management/server/types"
+)
+
+// schedulerHealthEndpoint is served on the metrics port and reports the state of the peer expiration schedulers
+const schedulerHealthEndpoint = "/health/schedulers"
+
+type scheduledJobHealthResponse struct {
+	NextRun time.Time  `json:"next_run"`
+	LastRun *time.Time `json:"last_run,omitempty"`
+	Stuck   bool       `json:"stuck"`
+}
+
+type accountSchedulerHealthResponse struct {
+	AccountID            string                      `json:"account_id"`
+	LoginExpiration      *scheduledJobHealthResponse `json:"login_expiration,omitempty"`
+	InactivityExpiration *scheduledJobHealthResponse `json:"inactivity_expiration,omitempty"`
+}
+
+type schedulerHealthResponse struct {
+	Healthy  bool                             `json:"healthy"`
+	Accounts []accountSchedulerHealthResponse `json:"accounts"`
+}
+
+// newSchedulerHealthHandler returns a handler reporting the next and last run times of the peer login and inactivity
+// expiration jobs per account. It responds with 503 when a job is overdue without having run.
+func newSchedulerHealthHandler(accountManager account.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		resp := schedulerHealthResponse{
+			Healthy:  true,
+			Accounts: []accountSchedulerHealthResponse{},
+		}
+
+		for _, health := range accountManager.ReportSchedulerHealth() {
+			accountHealth := accountSchedulerHealthResponse{
+				AccountID:            health.AccountID,
+				LoginExpiration:      toScheduledJobHealthResponse(health.LoginExpiration, now),
+				InactivityExpiration: toScheduledJobHealthResponse(health.InactivityExpiration, now),
+			}
+			for _, job := range []*scheduledJobHealthResponse{accountHealth.LoginExpiration, accountHealth.InactivityExpiration} {
+				if job != nil && job.Stuck {
+					resp.Healthy = false
+				}
+			}
+			resp.Accounts = append(resp.Accounts, accountHealth)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !resp.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.WithContext(r.Context()).Errorf("failed to write scheduler health response: %v", err)
+		}
+	})
+}
+
+func toScheduledJobHealthResponse(job *types.ScheduledJobHealth, now time.Time) *scheduledJobHealthResponse {
+	if job == nil {
+		return nil
+	}
+
+	resp := &scheduledJobHealthResponse{
+		NextRun: job.NextRun.UTC(),
+		Stuck:   job.IsStuck(now),
+	}
+	if !job.LastRun.IsZero() {
+		lastRun := job.LastRun.UTC()
+		resp.LastRun = &lastRun
+	}
+	return resp
+}
@@ -95,6 +95,7 @@ func (s *BaseServer) Start(ctx context.Context) error {
 	s.PeersManager()
 	s.GeoLocationManager()
 
+	s.Metrics().Handle(schedulerHealthEndpoint, newSchedulerHealthHandler(s.AccountManager()))
 	err := s.Metrics().Expose(srvCtx, s.mgmtMetricsPort, "/metrics")
 	if err != nil {
 		return fmt.Errorf("failed to expose metrics: %v", err)
@@ -3,8 +3,10 @@ package grpc
 import (
 	"context"
 	"fmt"
+	"math"
 	"net/url"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -88,7 +90,7 @@ func toNetbirdConfig(config *nbconfig.Config, turnCredentials *Token, relayToken
 	return nbConfig
 }
 
-func toPeerConfig(peer *nbpeer.Peer, network *types.Network, dnsName string, settings *types.Settings, httpConfig *nbconfig.HttpServerConfig, deviceFlowConfig *nbconfig.DeviceAuthorizationFlow, enableSSH bool) *proto.PeerConfig {
+func toPeerConfig(peer *nbpeer.Peer, network *types.Network, dnsName string, settings *types.Settings, loginExpiration time.Duration, httpConfig *nbconfig.HttpServerConfig, deviceFlowConfig *nbconfig.DeviceAuthorizationFlow, enableSSH bool) *proto.PeerConfig {
 	netmask, _ := network.Net.Mask.Size()
 	fqdn := peer.FQDN(dnsName)
 
@@ -100,6 +102,8 @@ func toPeerConfig(peer *nbpeer.Peer, network *types.Network, dnsName string, set
 		sshConfig.JwtConfig = buildJWTConfig(httpConfig, deviceFlowConfig)
 	}
 
+	loginExpiresIn, loginExpiresSoon := toLoginExpiration(peer, settings, loginExpiration)
+
 	return &proto.PeerConfig{
 		Address:                         fmt.Sprintf("%s/%d", peer.IP.String(), netmask),
 		SshConfig:                       sshConfig,
@@ -109,17 +113,37 @@ func toPeerConfig(peer *nbpeer.Peer, network *types.Network, dnsName string, set
 		AutoUpdate: &proto.AutoUpdateSettings{
 			Version: settings.AutoUpdateVersion,
 		},
+		LoginExpiresIn:    loginExpiresIn,
+		LoginExpiresSoon:  loginExpiresSoon,
+		PreferredRelayUrl: settings.GetPreferredRelay(peer.Location.CountryCode),
+	}
+}
+
+// toLoginExpiration returns the seconds left until the login of the peer expires and whether it expires within
+// the lead time of the account. loginExpiration is the login expiration of the peer after the group overrides.
+// Returns zero when the login of the peer doesn't expire
+func toLoginExpiration(peer *nbpeer.Peer, settings *types.Settings, loginExpiration time.Duration) (int64, bool) {
+	if !settings.PeerLoginExpirationEnabled {
+		return 0, false
 	}
+
+	expired, expiresIn := peer.LoginExpired(loginExpiration, settings.GetPeerExpirationTolerance())
+	if expired || expiresIn <= 0 {
+		return 0, false
+	}
+
+	expiresSoon := settings.PeerLoginExpirationLeadTime > 0 && expiresIn <= settings.PeerLoginExpirationLeadTime
+	return int64(math.Ceil(expiresIn.Seconds())), expiresSoon
 }
 
-func ToSyncResponse(ctx context.Context, config *nbconfig.Config, httpConfig *nbconfig.HttpServerConfig, deviceFlowConfig *nbconfig.DeviceAuthorizationFlow, peer *nbpeer.Peer, turnCredentials *Token, relayCredentials *Token, networkMap *types.NetworkMap, dnsName string, checks []*posture.Checks, dnsCache *cache.DNSConfigCache, settings *types.Settings, extraSettings *types.ExtraSettings, peerGroups []string, dnsFwdPort int64) *proto.SyncResponse {
+func ToSyncResponse(ctx context.Context, config *nbconfig.Config, httpConfig *nbconfig.HttpServerConfig, deviceFlowConfig *nbconfig.DeviceAuthorizationFlow, peer *nbpeer.Peer, turnCredentials *Token, relayCredentials *Token, networkMap *types.NetworkMap, dnsName string, checks []*posture.Checks, dnsCache *cache.DNSConfigCache, settings *types.Settings, loginExpiration time.Duration, extraSettings *types.ExtraSettings, peerGroups []string, dnsFwdPort int64) *proto.SyncResponse {
 	response := &proto.SyncResponse{
-		PeerConfig: toPeerConfig(peer, networkMap.Network, dnsName, settings, httpConfig, deviceFlowConfig, networkMap.EnableSSH),
+		PeerConfig: toPeerConfig(peer, networkMap.Network, dnsName, settings, loginExpiration, httpConfig, deviceFlowConfig, networkMap.EnableSSH),
 		NetworkMap: &proto.NetworkMap{
 			Serial:     networkMap.Network.CurrentSerial(),
-			Routes:     toProtocolRoutes(networkMap.Routes),
+			Routes:     toProtocolRoutes(networkMap.Routes, networkMap.AccessPaths),
 			DNSConfig:  toProtocolDNSConfig(networkMap.DNSConfig, dnsCache, dnsFwdPort),
-			PeerConfig: toPeerConfig(peer, networkMap.Network, dnsName, settings, httpConfig, deviceFlowConfig, networkMap.EnableSSH),
+			PeerConfig: toPeerConfig(peer, networkMap.Network, dnsName, settings, loginExpiration, httpConfig, deviceFlowConfig, networkMap.EnableSSH),
 		},
 		Checks: toProtocolChecks(ctx, checks),
 	}
@@ -131,13 +155,13 @@ func ToSyncResponse(ctx context.Context, config *nbconfig.Config, httpConfig *nb
 	response.NetworkMap.PeerConfig = response.PeerConfig
 
 	remotePeers := make([]*proto.RemotePeerConfig, 0, len(networkMap.Peers)+len(networkMap.OfflinePeers))
-	remotePeers = appendRemotePeerConfig(remotePeers, networkMap.Peers, dnsName)
+	remotePeers = appendRemotePeerConfig(remotePeers, networkMap.Peers, dnsName, networkMap.AccessPaths)
 	response.RemotePeers = remotePeers
 	response.NetworkMap.RemotePeers = remotePeers
 	response.RemotePeersIsEmpty = len(remotePeers) == 0
 	response.NetworkMap.RemotePeersIsEmpty = response.RemotePeersIsEmpty
 
-	response.NetworkMap.OfflinePeers = appendRemotePeerConfig(nil, networkMap.OfflinePeers, dnsName)
+	response.NetworkMap.OfflinePeers = appendRemotePeerConfig(nil, networkMap.OfflinePeers, dnsName, nil)
 
 	firewallRules := toProtocolFirewallRules(networkMap.FirewallRules)
 	response.NetworkMap.FirewallRules = firewallRules
@@ -194,7 +218,7 @@ func buildAuthorizedUsersProto(ctx context.Context, authorizedUsers map[string]m
 	return hashedUsers, machineUsers
 }
 
-func appendRemotePeerConfig(dst []*proto.RemotePeerConfig, peers []*nbpeer.Peer, dnsName string) []*proto.RemotePeerConfig {
+func appendRemotePeerConfig(dst []*proto.RemotePeerConfig, peers []*nbpeer.Peer, dnsName string, accessPaths map[string]types.AccessPath) []*proto.RemotePeerConfig {
 	for _, rPeer := range peers {
 		dst = append(dst, &proto.RemotePeerConfig{
 			WgPubKey:     rPeer.Key,
@@ -202,6 +226,7 @@ func appendRemotePeerConfig(dst []*proto.RemotePeerConfig, peers []*nbpeer.Peer,
 			SshConfig:    &proto.SSHConfig{SshPubKey: []byte(rPeer.SSHKey)},
 			Fqdn:         rPeer.FQDN(dnsName),
 			AgentVersion: rPeer.Meta.WtVersion,
+			AccessPath:   getProtoAccessPath(accessPaths, rPeer.ID),
 		})
 	}
 	return dst
@@ -252,14 +277,35 @@ func ToResponseProto(configProto nbconfig.Protocol) proto.HostConfig_Protocol {
 	}
 }
 
-func toProtocolRoutes(routes []*route.Route) []*proto.Route {
+func toProtocolRoutes(routes []*route.Route, accessPaths map[string]types.AccessPath) []*proto.Route {
 	protoRoutes := make([]*proto.Route, 0, len(routes))
 	for _, r := range routes {
-		protoRoutes = append(protoRoutes, toProtocolRoute(r))
+		protoRoute := toProtocolRoute(r)
+		protoRoute.AccessPath = getProtoAccessPath(accessPaths, string(r.ID))
+		protoRoutes = append(protoRoutes, protoRoute)
 	}
 	return protoRoutes
 }
 
+// getProtoAccessPath converts the access path of the network map entry to proto.AccessPath
+func getProtoAccessPath(accessPaths map[string]types.AccessPath, id string) proto.AccessPath {
+	path, ok := accessPaths[id]
+	if !ok {
+		return proto.AccessPath_AccessPathUnknown
+	}
+
+	switch path.Type {
+	case types.AccessPathDirect:
+		return proto.AccessPath_AccessPathDirect
+	case types.AccessPathRouted:
+		return proto.AccessPath_AccessPathRouted
+	case types.AccessPathExitNode:
+		return proto.AccessPath_AccessPathExitNode
+	default:
+		return proto.AccessPath_AccessPathUnknown
+	}
+}
+
 func toProtocolRoute(route *route.Route) *proto.Route {
 	return &proto.Route{
 		ID:            string(route.ID),
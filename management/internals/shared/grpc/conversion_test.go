@@ -2,9 +2,11 @@ package grpc
 
 import (
 	"fmt"
+	"net"
 	"net/netip"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -12,6 +14,10 @@ import (
 	"github.com/netbirdio/netbird/management/internals/controllers/network_map"
 	"github.com/netbirdio/netbird/management/internals/controllers/network_map/controller/cache"
 	nbconfig "github.com/netbirdio/netbird/management/internals/server/config"
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/management/server/types"
+	"github.com/netbirdio/netbird/route"
+	"github.com/netbirdio/netbird/shared/management/proto"
 )
 
 func TestToProtocolDNSConfigWithCache(t *testing.T) {
@@ -200,3 +206,140 @@ func TestBuildJWTConfig_Audiences(t *testing.T) {
 		})
 	}
 }
+
+func TestToLoginExpiration(t *testing.T) {
+	loggedIn := func(ago time.Duration) *time.Time {
+		lastLogin := time.Now().Add(-ago)
+		return &lastLogin
+	}
+
+	settings := &types.Settings{
+		PeerLoginExpirationEnabled:  true,
+		PeerLoginExpiration:         24 * time.Hour,
+		PeerLoginExpirationLeadTime: time.Hour,
+	}
+
+	tests := []struct {
+		name            string
+		peer            *nbpeer.Peer
+		settings        *types.Settings
+		override        time.Duration
+		expectExpiresIn bool
+		expectSoon      bool
+	}{
+		{
+			name:            "login far from expiration",
+			peer:            &nbpeer.Peer{UserID: "user", LoginExpirationEnabled: true, LastLogin: loggedIn(time.Hour)},
+			settings:        settings,
+			expectExpiresIn: true,
+		},
+		{
+			name:            "login within the lead time",
+			peer:            &nbpeer.Peer{UserID: "user", LoginExpirationEnabled: true, LastLogin: loggedIn(23*time.Hour + 30*time.Minute)},
+			settings:        settings,
+			expectExpiresIn: true,
+			expectSoon:      true,
+		},
+		{
+			name:            "login within the lead time of a group override",
+			peer:            &nbpeer.Peer{UserID: "user", LoginExpirationEnabled: true, LastLogin: loggedIn(11*time.Hour + 30*time.Minute)},
+			settings:        settings,
+			override:        12 * time.Hour,
+			expectExpiresIn: true,
+			expectSoon:      true,
+		},
+		{
+			name:     "login expired by a group override",
+			peer:     &nbpeer.Peer{UserID: "user", LoginExpirationEnabled: true, LastLogin: loggedIn(13 * time.Hour)},
+			settings: settings,
+			override: 12 * time.Hour,
+		},
+		{
+			name:     "expired login",
+			peer:     &nbpeer.Peer{UserID: "user", LoginExpirationEnabled: true, LastLogin: loggedIn(25 * time.Hour)},
+			settings: settings,
+		},
+		{
+			name:     "setup key peer",
+			peer:     &nbpeer.Peer{LoginExpirationEnabled: true, LastLogin: loggedIn(23*time.Hour + 30*time.Minute)},
+			settings: settings,
+		},
+		{
+			name: "login expiration disabled for the account",
+			peer: &nbpeer.Peer{UserID: "user", LoginExpirationEnabled: true, LastLogin: loggedIn(23*time.Hour + 30*time.Minute)},
+			settings: &types.Settings{
+				PeerLoginExpiration:         24 * time.Hour,
+				PeerLoginExpirationLeadTime: time.Hour,
+			},
+		},
+		{
+			name: "no lead time",
+			peer: &nbpeer.Peer{UserID: "user", LoginExpirationEnabled: true, LastLogin: loggedIn(23*time.Hour + 30*time.Minute)},
+			settings: &types.Settings{
+				PeerLoginExpirationEnabled: true,
+				PeerLoginExpiration:        24 * time.Hour,
+			},
+			expectExpiresIn: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			expiresIn, soon := toLoginExpiration(tc.peer, tc.settings, tc.settings.ApplyPeerLoginExpirationOverride(tc.override))
+			if tc.expectExpiresIn {
+				assert.Positive(t, expiresIn)
+				assert.LessOrEqual(t, expiresIn, int64(tc.settings.PeerLoginExpiration.Seconds()))
+			} else {
+				assert.Zero(t, expiresIn)
+			}
+			assert.Equal(t, tc.expectSoon, soon)
+		})
+	}
+}
+
+func TestToPeerConfig_PreferredRelay(t *testing.T) {
+	network := &types.Network{Net: net.IPNet{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)}}
+	settings := &types.Settings{
+		RelayCountryMapping: map[string]string{"DE": "rels://relay-eu.example.com:443"},
+	}
+
+	tests := []struct {
+		name        string
+		countryCode string
+		expected    string
+	}{
+		{name: "mapped country", countryCode: "DE", expected: "rels://relay-eu.example.com:443"},
+		{name: "unmapped country", countryCode: "US"},
+		{name: "unknown location"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			peer := &nbpeer.Peer{IP: net.IP{100, 64, 0, 1}, Location: nbpeer.Location{CountryCode: tc.countryCode}}
+			peerConfig := toPeerConfig(peer, network, "netbird.cloud", settings, settings.PeerLoginExpiration, nil, nil, false)
+			assert.Equal(t, tc.expected, peerConfig.PreferredRelayUrl)
+		})
+	}
+}
+
+func TestToProtocolAccessPaths(t *testing.T) {
+	accessPaths := map[string]types.AccessPath{
+		"remote":  {Type: types.AccessPathDirect},
+		"network": {Type: types.AccessPathRouted, ViaPeerID: "router"},
+		"default": {Type: types.AccessPathExitNode, ViaPeerID: "router"},
+	}
+
+	routes := []*route.Route{
+		{ID: "network", Network: netip.MustParsePrefix("10.0.0.0/16")},
+		{ID: "default", Network: netip.MustParsePrefix("0.0.0.0/0")},
+		{ID: "own", Network: netip.MustParsePrefix("10.1.0.0/16")},
+	}
+	protoRoutes := toProtocolRoutes(routes, accessPaths)
+	assert.Equal(t, proto.AccessPath_AccessPathRouted, protoRoutes[0].AccessPath)
+	assert.Equal(t, proto.AccessPath_AccessPathExitNode, protoRoutes[1].AccessPath)
+	assert.Equal(t, proto.AccessPath_AccessPathUnknown, protoRoutes[2].AccessPath, "routes served by the peer itself have no access path")
+
+	peers := []*nbpeer.Peer{{ID: "remote", IP: net.IP{100, 64, 0, 2}}}
+	assert.Equal(t, proto.AccessPath_AccessPathDirect, appendRemotePeerConfig(nil, peers, "netbird.cloud", accessPaths)[0].AccessPath)
+	assert.Equal(t, proto.AccessPath_AccessPathUnknown, appendRemotePeerConfig(nil, peers, "netbird.cloud", nil)[0].AccessPath)
+}
@@ -0,0 +1,186 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"slices"
+	"sync"
+
+	gproto "google.golang.org/protobuf/proto"
+
+	"github.com/netbirdio/netbird/shared/management/proto"
+)
+
+const (
+	// networkMapHistoryDepth is the number of network maps remembered per peer,
+	// so that a peer that missed the last update can still get a delta on reconnect
+	networkMapHistoryDepth = 2
+	// maxNetworkMapHistoryPeers bounds the number of peers the network map history is kept for
+	maxNetworkMapHistoryPeers = 10000
+)
+
+// networkMapSnapshot is a compact fingerprint of a network map sent to a peer
+type networkMapSnapshot struct {
+	serial uint64
+	// ambiguous is set when different network maps were sent with the same serial,
+	// in which case it is unknown which one the peer has applied
+	ambiguous     bool
+	fingerprint   uint64
+	remotePeers   map[string]uint64
+	firewallRules uint64
+}
+
+func newNetworkMapSnapshot(nm *proto.NetworkMap) *networkMapSnapshot {
+	snapshot := &networkMapSnapshot{
+		serial:      nm.GetSerial(),
+		remotePeers: make(map[string]uint64, len(nm.GetRemotePeers())),
+	}
+
+	fingerprint := fnv.New64a()
+	for _, remotePeer := range nm.GetRemotePeers() {
+		h := fingerprintMessages(remotePeer)
+		snapshot.remotePeers[remotePeer.GetWgPubKey()] = h
+		_, _ = fingerprint.Write([]byte(remotePeer.GetWgPubKey()))
+		_, _ = fingerprint.Write(binary.LittleEndian.AppendUint64(nil, h))
+	}
+
+	rules := make([]gproto.Message, 0, len(nm.GetFirewallRules()))
+	for _, rule := range nm.GetFirewallRules() {
+		rules = append(rules, rule)
+	}
+	snapshot.firewallRules = fingerprintMessages(rules...)
+	_, _ = fingerprint.Write(binary.LittleEndian.AppendUint64(nil, snapshot.firewallRules))
+	snapshot.fingerprint = fingerprint.Sum64()
+
+	return snapshot
+}
+
+func fingerprintMessages(msgs ...gproto.Message) uint64 {
+	h := fnv.New64a()
+	opts := gproto.MarshalOptions{Deterministic: true}
+	for _, msg := range msgs {
+		b, err := opts.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		_, _ = h.Write(b)
+	}
+	return h.Sum64()
+}
+
+// networkMapHistory remembers the last network maps sent to peers supporting deltas, keyed by serial
+type networkMapHistory struct {
+	mu    sync.Mutex
+	peers map[string][]*networkMapSnapshot
+}
+
+func newNetworkMapHistory() *networkMapHistory {
+	return &networkMapHistory{
+		peers: make(map[string][]*networkMapSnapshot),
+	}
+}
+
+// record stores the fingerprint of a full network map sent to the peer
+func (h *networkMapHistory) record(peerKey string, snapshot *networkMapSnapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshots, ok := h.peers[peerKey]
+	if !ok && len(h.peers) >= maxNetworkMapHistoryPeers {
+		// evict an arbitrary peer, it will get a full network map on its next sync
+		for key := range h.peers {
+			delete(h.peers, key)
+			break
+		}
+	}
+
+	for _, s := range snapshots {
+		if s.serial == snapshot.serial {
+			s.ambiguous = s.ambiguous || s.fingerprint != snapshot.fingerprint
+			return
+		}
+	}
+
+	snapshots = append(snapshots, snapshot)
+	if len(snapshots) > networkMapHistoryDepth {
+		snapshots = snapshots[len(snapshots)-networkMapHistoryDepth:]
+	}
+	h.peers[peerKey] = snapshots
+}
+
+// get returns the snapshot of the network map with the given serial sent to the peer, or nil if it isn't usable
+func (h *networkMapHistory) get(peerKey string, serial uint64) *networkMapSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, s := range h.peers[peerKey] {
+		if s.serial == serial && !s.ambiguous {
+			return s
+		}
+	}
+	return nil
+}
+
+// toDeltaNetworkMap turns the full network map into a delta against the base snapshot.
+// Returns false and leaves the map untouched when the delta isn't smaller than half of the full map.
+func toDeltaNetworkMap(nm *proto.NetworkMap, base, current *networkMapSnapshot) bool {
+	var changed []*proto.RemotePeerConfig
+	for _, remotePeer := range nm.GetRemotePeers() {
+		baseHash, ok := base.remotePeers[remotePeer.GetWgPubKey()]
+		if !ok || baseHash != current.remotePeers[remotePeer.GetWgPubKey()] {
+			changed = append(changed, remotePeer)
+		}
+	}
+
+	var removed []string
+	for key := range base.remotePeers {
+		if _, ok := current.remotePeers[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+
+	if len(changed)+len(removed) > len(nm.GetRemotePeers())/2 {
+		return false
+	}
+
+	slices.Sort(removed)
+
+	nm.IsDelta = true
+	nm.BaseSerial = base.serial
+	nm.RemotePeers = changed
+	nm.RemovedPeers = removed
+	if base.firewallRules == current.firewallRules {
+		nm.FirewallRules = nil
+		nm.FirewallRulesUnchanged = true
+	}
+
+	return true
+}
+
+// applyNetworkMapDelta records the full network map of the sync response and, when the peer reported a known serial
+// that is still in the history, replaces it with a delta against that serial.
+func (s *Server) applyNetworkMapDelta(peerKey string, knownSerial uint64, resp *proto.SyncResponse) {
+	nm := resp.GetNetworkMap()
+	if nm == nil {
+		return
+	}
+
+	current := newNetworkMapSnapshot(nm)
+	base := s.networkMapHistory.get(peerKey, knownSerial)
+	s.networkMapHistory.record(peerKey, current)
+
+	if knownSerial == 0 || base == nil || base.serial >= current.serial {
+		return
+	}
+
+	if toDeltaNetworkMap(nm, base, current) {
+		resp.RemotePeers = nm.RemotePeers
+	}
+}
+
+// recordNetworkMap remembers the full network map sent to the peer in an update
+func (s *Server) recordNetworkMap(peerKey string, resp *proto.SyncResponse) {
+	if nm := resp.GetNetworkMap(); nm != nil {
+		s.networkMapHistory.record(peerKey, newNetworkMapSnapshot(nm))
+	}
+}
@@ -0,0 +1,85 @@
+package grpc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/shared/management/proto"
+)
+
+func testNetworkMap(serial uint64, peers int) *proto.NetworkMap {
+	nm := &proto.NetworkMap{
+		Serial:        serial,
+		FirewallRules: []*proto.FirewallRule{{PeerIP: "100.64.0.1", Port: "22"}},
+	}
+	for i := 0; i < peers; i++ {
+		nm.RemotePeers = append(nm.RemotePeers, &proto.RemotePeerConfig{
+			WgPubKey:   fmt.Sprintf("peer-%d", i),
+			AllowedIps: []string{fmt.Sprintf("100.64.0.%d/32", i+2)},
+		})
+	}
+	return nm
+}
+
+func TestNetworkMapHistory(t *testing.T) {
+	history := newNetworkMapHistory()
+
+	history.record("peer", newNetworkMapSnapshot(testNetworkMap(1, 3)))
+	history.record("peer", newNetworkMapSnapshot(testNetworkMap(2, 3)))
+	require.NotNil(t, history.get("peer", 1))
+	require.NotNil(t, history.get("peer", 2))
+	assert.Nil(t, history.get("other", 1))
+
+	history.record("peer", newNetworkMapSnapshot(testNetworkMap(3, 3)))
+	assert.Nil(t, history.get("peer", 1), "oldest serial should be evicted")
+
+	// the same serial with a different content makes it unknown which map the peer has
+	history.record("peer", newNetworkMapSnapshot(testNetworkMap(3, 4)))
+	assert.Nil(t, history.get("peer", 3))
+	assert.NotNil(t, history.get("peer", 2))
+}
+
+func TestToDeltaNetworkMap(t *testing.T) {
+	base := newNetworkMapSnapshot(testNetworkMap(1, 10))
+
+	t.Run("small change", func(t *testing.T) {
+		nm := testNetworkMap(2, 10)
+		nm.RemotePeers = nm.RemotePeers[1:]
+		nm.RemotePeers[0].AllowedIps = []string{"100.64.1.1/32"}
+		nm.RemotePeers = append(nm.RemotePeers, &proto.RemotePeerConfig{WgPubKey: "new-peer"})
+
+		require.True(t, toDeltaNetworkMap(nm, base, newNetworkMapSnapshot(nm)))
+		assert.True(t, nm.IsDelta)
+		assert.Equal(t, uint64(1), nm.BaseSerial)
+		assert.Equal(t, []string{"peer-0"}, nm.RemovedPeers)
+		require.Len(t, nm.RemotePeers, 2)
+		assert.Equal(t, "peer-1", nm.RemotePeers[0].WgPubKey)
+		assert.Equal(t, "new-peer", nm.RemotePeers[1].WgPubKey)
+		assert.True(t, nm.FirewallRulesUnchanged)
+		assert.Nil(t, nm.FirewallRules)
+	})
+
+	t.Run("changed firewall rules are sent in full", func(t *testing.T) {
+		nm := testNetworkMap(2, 10)
+		nm.FirewallRules[0].Port = "443"
+
+		require.True(t, toDeltaNetworkMap(nm, base, newNetworkMapSnapshot(nm)))
+		assert.Empty(t, nm.RemotePeers)
+		assert.False(t, nm.FirewallRulesUnchanged)
+		assert.Len(t, nm.FirewallRules, 1)
+	})
+
+	t.Run("large change falls back to full map", func(t *testing.T) {
+		nm := testNetworkMap(2, 10)
+		for _, remotePeer := range nm.RemotePeers[:6] {
+			remotePeer.AllowedIps = nil
+		}
+
+		require.False(t, toDeltaNetworkMap(nm, base, newNetworkMapSnapshot(nm)))
+		assert.False(t, nm.IsDelta)
+		assert.Len(t, nm.RemotePeers, 10)
+	})
+}
@@ -0,0 +1,203 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	cacheStore "github.com/eko/gocache/lib/v4/store"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	gproto "google.golang.org/protobuf/proto"
+
+	"github.com/netbirdio/netbird/encryption"
+	"github.com/netbirdio/netbird/management/server/store"
+	"github.com/netbirdio/netbird/shared/management/proto"
+)
+
+const (
+	envLazyRoutesMinCount = "NB_LAZY_ROUTES_MIN_COUNT"
+
+	// defaultLazyRoutesMinCount is the default number of routes from which the network map of a peer supporting lazy
+	// resources references its routes instead of carrying their definitions.
+	//
+	// Compatibility: only clients reporting the lazy resources capability receive lazy network maps, older clients
+	// and older servers keep exchanging full network maps. A client that fails to resolve a lazy network map reconnects
+	// without the capability and gets full network maps from then on.
+	defaultLazyRoutesMinCount = 100
+
+	// lazyRoutesCacheExpiration bounds how long the routes of a lazy network map are remembered for a peer. A lazy
+	// network map is only current until the next network map is sent to the peer, and the client resolves its routes
+	// right after receiving it, so the routes only need to outlive that request. A later request is served from the
+	// current network map of the peer
+	lazyRoutesCacheExpiration = 10 * time.Minute
+	// lazyRoutesCacheCleanupInterval is how often the expired routes are dropped from the in-memory cache store
+	lazyRoutesCacheCleanupInterval = 5 * time.Minute
+	// lazyRoutesCacheOpenConn is the maximum number of connections to a redis cache store
+	lazyRoutesCacheOpenConn  = 20
+	lazyRoutesCacheKeyPrefix = "lazy-routes:"
+)
+
+// lazyRoutesMinCountFromEnv returns the route count from which network maps are sent lazily,
+// as configured by NB_LAZY_ROUTES_MIN_COUNT
+func lazyRoutesMinCountFromEnv() int {
+	value := os.Getenv(envLazyRoutesMinCount)
+	if value == "" {
+		return defaultLazyRoutesMinCount
+	}
+
+	minCount, err := strconv.Atoi(value)
+	if err != nil || minCount <= 0 {
+		log.Errorf("invalid value for %s: %q, using %d", envLazyRoutesMinCount, value, defaultLazyRoutesMinCount)
+		return defaultLazyRoutesMinCount
+	}
+	return minCount
+}
+
+// lazyRoutesCache remembers the route definitions of the last lazy network map sent to each peer,
+// so that GetResourceDetails can serve them without building the network map again. The routes are kept in the
+// cache store shared by the management instances, so a peer can fetch them from any instance
+type lazyRoutesCache struct {
+	store cacheStore.StoreInterface
+}
+
+func newLazyRoutesCache(store cacheStore.StoreInterface) *lazyRoutesCache {
+	return &lazyRoutesCache{store: store}
+}
+
+// record replaces the routes remembered for the peer
+func (c *lazyRoutesCache) record(ctx context.Context, peerKey string, routes []*proto.Route) error {
+	data, err := gproto.Marshal(&proto.ResourceDetailsResponse{Routes: routes})
+	if err != nil {
+		return fmt.Errorf("marshal routes: %w", err)
+	}
+	return c.store.Set(ctx, lazyRoutesCacheKeyPrefix+peerKey, data, cacheStore.WithExpiration(lazyRoutesCacheExpiration))
+}
+
+// get returns the remembered routes of the peer with the given IDs. Returns false when nothing is remembered for the peer
+func (c *lazyRoutesCache) get(ctx context.Context, peerKey string, routeIDs []string) ([]*proto.Route, bool) {
+	value, err := c.store.Get(ctx, lazyRoutesCacheKeyPrefix+peerKey)
+	if err != nil {
+		return nil, false
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil, false
+	}
+
+	remembered := &proto.ResourceDetailsResponse{}
+	if err := gproto.Unmarshal(data, remembered); err != nil {
+		log.WithContext(ctx).Debugf("failed to unmarshal remembered routes of peer %s: %v", peerKey, err)
+		return nil, false
+	}
+
+	byID := make(map[string]*proto.Route, len(remembered.GetRoutes()))
+	for _, r := range remembered.GetRoutes() {
+		byID[r.GetID()] = r
+	}
+	return selectRoutes(byID, routeIDs), true
+}
+
+func selectRoutes(byID map[string]*proto.Route, routeIDs []string) []*proto.Route {
+	routes := make([]*proto.Route, 0, len(routeIDs))
+	for _, id := range routeIDs {
+		if r, ok := byID[id]; ok {
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
+// toLazyNetworkMap replaces the route definitions of the network map with references.
+// Returns false and leaves the map untouched when it has less than minCount routes.
+func toLazyNetworkMap(nm *proto.NetworkMap, minCount int) bool {
+	if len(nm.GetRoutes()) < minCount {
+		return false
+	}
+
+	refs := make([]*proto.ResourceReference, 0, len(nm.GetRoutes()))
+	for _, r := range nm.GetRoutes() {
+		refs = append(refs, &proto.ResourceReference{
+			ID:   r.GetID(),
+			Hash: fingerprintMessages(r),
+		})
+	}
+
+	nm.RoutesLazy = true
+	nm.LazyRoutes = refs
+	nm.Routes = nil
+
+	return true
+}
+
+// applyLazyResources turns the network map of the sync response into a lazy one
+// and remembers its route definitions for GetResourceDetails
+func (s *Server) applyLazyResources(ctx context.Context, peerKey string, resp *proto.SyncResponse) {
+	nm := resp.GetNetworkMap()
+	if nm == nil {
+		return
+	}
+
+	routes := nm.GetRoutes()
+	if !toLazyNetworkMap(nm, s.lazyRoutesMinCount) {
+		return
+	}
+	if err := s.lazyRoutesCache.record(ctx, peerKey, routes); err != nil {
+		log.WithContext(ctx).Debugf("failed to remember the routes of peer %s: %v", peerKey, err)
+	}
+}
+
+// GetResourceDetails returns the definitions of the routes referenced by the last lazy network map sent to the peer.
+// When the routes are not remembered, e.g. after they expired, they are taken from the current network map of the peer
+func (s *Server) GetResourceDetails(ctx context.Context, req *proto.EncryptedMessage) (*proto.EncryptedMessage, error) {
+	detailsReq := &proto.ResourceDetailsRequest{}
+	peerKey, err := s.parseRequest(ctx, req, detailsReq)
+	if err != nil {
+		return nil, err
+	}
+
+	routes, ok := s.lazyRoutesCache.get(ctx, peerKey.String(), detailsReq.GetRouteIDs())
+	if !ok {
+		peer, err := s.accountManager.GetStore().GetPeerByPeerPubKey(ctx, store.LockingStrengthNone, peerKey.String())
+		if err != nil {
+			log.WithContext(ctx).Debugf("peer %s is not registered for resource details", peerKey.String())
+			return nil, mapError(ctx, err)
+		}
+
+		networkMap, err := s.networkMapController.GetNetworkMap(ctx, peer.ID)
+		if err != nil {
+			log.WithContext(ctx).Errorf("failed to get network map of peer %s: %v", peerKey.String(), err)
+			return nil, status.Errorf(codes.Internal, "failed getting resource details")
+		}
+
+		byID := make(map[string]*proto.Route, len(networkMap.Routes))
+		for _, r := range toProtocolRoutes(networkMap.Routes, networkMap.AccessPaths) {
+			byID[r.GetID()] = r
+		}
+		routes = selectRoutes(byID, detailsReq.GetRouteIDs())
+	}
+
+	key, err := s.secretsManager.GetWGKey()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed getting server key")
+	}
+
+	encryptedResp, err := encryption.EncryptMessage(peerKey, key, &proto.ResourceDetailsResponse{Routes: routes})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed encrypting resource details")
+	}
+
+	return &proto.EncryptedMessage{
+		WgPubKey: key.PublicKey().String(),
+		Body:     encryptedResp,
+	}, nil
+}
@@ -0,0 +1,87 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	nbcache "github.com/netbirdio/netbird/management/server/cache"
+	"github.com/netbirdio/netbird/shared/management/proto"
+)
+
+func testRoutes(count int) []*proto.Route {
+	routes := make([]*proto.Route, 0, count)
+	for i := 0; i < count; i++ {
+		routes = append(routes, &proto.Route{
+			ID:      fmt.Sprintf("route-%d", i),
+			NetID:   fmt.Sprintf("net-%d", i),
+			Network: fmt.Sprintf("10.%d.%d.0/24", i/256, i%256),
+			Peer:    "routing-peer",
+			Metric:  9999,
+		})
+	}
+	return routes
+}
+
+func TestToLazyNetworkMap(t *testing.T) {
+	nm := &proto.NetworkMap{Routes: testRoutes(defaultLazyRoutesMinCount - 1)}
+	assert.False(t, toLazyNetworkMap(nm, defaultLazyRoutesMinCount), "small network maps should keep their routes")
+	assert.Len(t, nm.Routes, defaultLazyRoutesMinCount-1)
+
+	routes := testRoutes(defaultLazyRoutesMinCount)
+	nm = &proto.NetworkMap{Routes: routes}
+	require.True(t, toLazyNetworkMap(nm, defaultLazyRoutesMinCount))
+	assert.True(t, nm.RoutesLazy)
+	assert.Empty(t, nm.Routes)
+	require.Len(t, nm.LazyRoutes, len(routes))
+	for i, ref := range nm.LazyRoutes {
+		assert.Equal(t, routes[i].ID, ref.ID)
+	}
+
+	changed := testRoutes(defaultLazyRoutesMinCount)
+	changed[0].Metric = 1
+	changedMap := &proto.NetworkMap{Routes: changed}
+	require.True(t, toLazyNetworkMap(changedMap, defaultLazyRoutesMinCount))
+	assert.NotEqual(t, nm.LazyRoutes[0].Hash, changedMap.LazyRoutes[0].Hash, "changed routes should get a new hash")
+	assert.Equal(t, nm.LazyRoutes[1].Hash, changedMap.LazyRoutes[1].Hash, "unchanged routes should keep their hash")
+}
+
+func TestLazyRoutesCache(t *testing.T) {
+	ctx := context.Background()
+	store, err := nbcache.NewStore(ctx, lazyRoutesCacheExpiration, lazyRoutesCacheCleanupInterval, lazyRoutesCacheOpenConn)
+	require.NoError(t, err)
+	cache := newLazyRoutesCache(store)
+
+	_, ok := cache.get(ctx, "peer", []string{"route-1"})
+	assert.False(t, ok)
+
+	require.NoError(t, cache.record(ctx, "peer", testRoutes(3)))
+	routes, ok := cache.get(ctx, "peer", []string{"route-2", "unknown", "route-0"})
+	require.True(t, ok)
+	require.Len(t, routes, 2, "unknown routes should be left out")
+	assert.Equal(t, "route-2", routes[0].ID)
+	assert.Equal(t, "route-0", routes[1].ID)
+
+	otherInstance := newLazyRoutesCache(store)
+	routes, ok = otherInstance.get(ctx, "peer", []string{"route-1"})
+	require.True(t, ok, "routes should be served by every instance sharing the store")
+	require.Len(t, routes, 1)
+
+	require.NoError(t, cache.record(ctx, "peer", testRoutes(1)))
+	routes, ok = cache.get(ctx, "peer", []string{"route-2"})
+	require.True(t, ok)
+	assert.Empty(t, routes, "routes of the previous network map should be forgotten")
+}
+
+func TestLazyRoutesMinCountFromEnv(t *testing.T) {
+	assert.Equal(t, defaultLazyRoutesMinCount, lazyRoutesMinCountFromEnv())
+
+	t.Setenv(envLazyRoutesMinCount, "500")
+	assert.Equal(t, 500, lazyRoutesMinCountFromEnv())
+
+	t.Setenv(envLazyRoutesMinCount, "-1")
+	assert.Equal(t, defaultLazyRoutesMinCount, lazyRoutesMinCountFromEnv())
+}
@@ -20,6 +20,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
@@ -37,6 +38,7 @@ import (
 	"github.com/netbirdio/netbird/management/server/account"
 	"github.com/netbirdio/netbird/management/server/activity"
 	"github.com/netbirdio/netbird/management/server/auth"
+	nbcache "github.com/netbirdio/netbird/management/server/cache"
 	nbContext "github.com/netbirdio/netbird/management/server/context"
 	nbpeer "github.com/netbirdio/netbird/management/server/peer"
 	"github.com/netbirdio/netbird/management/server/posture"
@@ -53,6 +55,9 @@ const (
 	envConcurrentSyncs = "NB_MAX_CONCURRENT_SYNCS"
 
 	defaultSyncLim = 1000
+
+	// idempotencyKeyHeader is the metadata key a client can use to make a login with registration safe to retry
+	idempotencyKeyHeader = "x-idempotency-key"
 )
 
 // Server an instance of a Management gRPC API server
@@ -74,6 +79,9 @@ type Server struct {
 	loginFilter *loginFilter
 
 	networkMapController network_map.Controller
+	networkMapHistory    *networkMapHistory
+	lazyRoutesCache      *lazyRoutesCache
+	lazyRoutesMinCount   int
 
 	oAuthConfigProvider idp.OAuthConfigProvider
 
@@ -118,6 +126,11 @@ func NewServer(
 		}
 	}
 
+	lazyRoutesStore, err := nbcache.NewStore(context.Background(), lazyRoutesCacheExpiration, lazyRoutesCacheCleanupInterval, lazyRoutesCacheOpenConn)
+	if err != nil {
+		return nil, fmt.Errorf("create lazy routes cache store: %w", err)
+	}
+
 	return &Server{
 		jobManager:               jobManager,
 		accountManager:           accountManager,
@@ -130,6 +143,9 @@ func NewServer(
 		blockPeersWithSameConfig: blockPeersWithSameConfig,
 		integratedPeerValidator:  integratedPeerValidator,
 		networkMapController:     networkMapController,
+		networkMapHistory:        newNetworkMapHistory(),
+		lazyRoutesCache:          newLazyRoutesCache(lazyRoutesStore),
+		lazyRoutesMinCount:       lazyRoutesMinCountFromEnv(),
 		oAuthConfigProvider:      oAuthConfigProvider,
 
 		loginFilter: newLoginFilter(),
@@ -175,6 +191,54 @@ func getRealIP(ctx context.Context) net.IP {
 	return nil
 }
 
+// realPortHeader is the header a reverse proxy or relay in front of the management server sets to the source port
+// of the peer, e.g. proxy_set_header X-Real-Port $remote_port for nginx
+const realPortHeader = "x-real-port"
+
+// getRealPort returns the source port the peer connected from. When the peer connects directly, i.e. the transport
+// address matches the resolved real IP, it is the port of the gRPC connection. Behind a reverse proxy or relay the
+// port of the connection belongs to the proxy, so the port is read from the X-Real-Port header set by it.
+// 0 is returned when the port is unknown.
+func getRealPort(ctx context.Context, realIP net.IP) uint16 {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil || realIP == nil {
+		return 0
+	}
+	addrPort, err := netip.ParseAddrPort(p.Addr.String())
+	if err != nil {
+		return 0
+	}
+	if net.IP(addrPort.Addr().Unmap().AsSlice()).Equal(realIP) {
+		return addrPort.Port()
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0
+	}
+	values := md.Get(realPortHeader)
+	if len(values) == 0 {
+		return 0
+	}
+	port, err := strconv.ParseUint(strings.TrimSpace(values[len(values)-1]), 10, 16)
+	if err != nil {
+		return 0
+	}
+	return uint16(port)
+}
+
+// getIdempotencyKey returns the optional registration idempotency key sent by the client in the request metadata
+func getIdempotencyKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(idempotencyKeyHeader); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
 func (s *Server) Job(srv proto.ManagementService_JobServer) error {
 	reqStart := time.Now()
 	ctx := srv.Context()
@@ -294,14 +358,28 @@ func (s *Server) Sync(req *proto.EncryptedMessage, srv proto.ManagementService_S
 	metahash := metaHash(peerMeta, realIP.String())
 	s.loginFilter.addLogin(peerKey.String(), metahash)
 
-	peer, netMap, postureChecks, dnsFwdPort, err := s.accountManager.SyncAndMarkPeer(ctx, accountID, peerKey.String(), peerMeta, realIP)
+	peer, netMap, postureChecks, dnsFwdPort, err := s.accountManager.SyncAndMarkPeer(ctx, accountID, peerKey.String(), peerMeta, realIP, getRealPort(ctx, realIP))
 	if err != nil {
 		log.WithContext(ctx).Debugf("error while syncing peer %s: %v", peerKey.String(), err)
 		s.syncSem.Add(-1)
 		return mapError(ctx, err)
 	}
 
-	err = s.sendInitialSync(ctx, peerKey, peer, netMap, postureChecks, srv, dnsFwdPort)
+	// the known serial is only reported by clients that applied the network map with that serial
+	if err = s.accountManager.UpdatePeerAppliedSerial(ctx, peerKey.String(), syncReq.GetKnownSerial()); err != nil {
+		log.WithContext(ctx).Warnf("failed to update applied serial of peer %s: %v", peerKey.String(), err)
+	}
+
+	if reportedErrors := extractReportedErrors(syncReq.GetReportedErrors()); len(reportedErrors) > 0 {
+		if err = s.accountManager.UpdatePeerReportedErrors(ctx, peerKey.String(), reportedErrors); err != nil {
+			log.WithContext(ctx).Warnf("failed to update reported errors of peer %s: %v", peerKey.String(), err)
+		}
+	}
+
+	capabilities := extractPeerCapabilities(syncReq.GetCapabilities())
+	s.networkMapController.SetPeerCapabilities(peer.ID, capabilities)
+
+	err = s.sendInitialSync(ctx, peerKey, peer, netMap, postureChecks, srv, dnsFwdPort, capabilities, syncReq.GetKnownSerial())
 	if err != nil {
 		log.WithContext(ctx).Debugf("error while sending initial sync for %s: %v", peerKey.String(), err)
 		s.syncSem.Add(-1)
@@ -398,6 +476,9 @@ func (s *Server) sendJobsLoop(ctx context.Context, accountID string, peerKey wgt
 }
 
 // handleUpdates sends updates to the connected peer until the updates channel is closed.
+// The update is delivered according to the peer capabilities it was built with: the network maps sent to peers
+// supporting deltas are recorded, so that a delta can be returned when they reconnect, and peers supporting lazy
+// resources get their routes referenced instead of included in large network maps.
 func (s *Server) handleUpdates(ctx context.Context, accountID string, peerKey wgtypes.Key, peer *nbpeer.Peer, updates chan *network_map.UpdateMessage, srv proto.ManagementService_SyncServer) error {
 	log.WithContext(ctx).Tracef("starting to handle updates for peer %s", peerKey.String())
 	for {
@@ -414,10 +495,16 @@ func (s *Server) handleUpdates(ctx context.Context, accountID string, peerKey wg
 				return nil
 			}
 			log.WithContext(ctx).Debugf("received an update for peer %s", peerKey.String())
+			if update.Capabilities.Has(network_map.PeerCapabilityLazyResources) {
+				s.applyLazyResources(ctx, peerKey.String(), update.Update)
+			}
 			if err := s.sendUpdate(ctx, accountID, peerKey, peer, update, srv); err != nil {
 				log.WithContext(ctx).Debugf("error while sending an update to peer %s: %v", peerKey.String(), err)
 				return err
 			}
+			if update.Capabilities.Has(network_map.PeerCapabilityDeltaNetworkMap) {
+				s.recordNetworkMap(peerKey.String(), update.Update)
+			}
 
 		// condition when client <-> server connection has been terminated
 		case <-srv.Context().Done():
@@ -560,6 +647,10 @@ func mapError(ctx context.Context, err error) error {
 			return status.Error(codes.FailedPrecondition, e.Message)
 		case internalStatus.NotFound:
 			return status.Error(codes.NotFound, e.Message)
+		case internalStatus.Unavailable:
+			return status.Error(codes.Unavailable, e.Message)
+		case internalStatus.TooManyRequests:
+			return status.Error(codes.ResourceExhausted, e.Message)
 		default:
 		}
 	}
@@ -570,6 +661,67 @@ func mapError(ctx context.Context, err error) error {
 	return status.Errorf(codes.Internal, "failed handling request")
 }
 
+// extractLastHandshake returns the last WireGuard handshake reported by the peer.
+// Returns zero time when it isn't reported or lies in the future, e.g. because of a skewed client clock
+func extractLastHandshake(meta *proto.PeerSystemMeta) time.Time {
+	if meta.GetLastHandshake() == nil {
+		return time.Time{}
+	}
+
+	lastHandshake := meta.GetLastHandshake().AsTime()
+	if lastHandshake.Unix() <= 0 || lastHandshake.After(time.Now().Add(time.Minute)) {
+		return time.Time{}
+	}
+	return lastHandshake
+}
+
+// extractPeerCapabilities converts the capabilities reported by the client. Unknown capabilities of newer clients
+// are ignored
+func extractPeerCapabilities(reported []proto.PeerCapability) network_map.PeerCapabilities {
+	var capabilities network_map.PeerCapabilities
+	for _, capability := range reported {
+		switch capability {
+		case proto.PeerCapability_PeerCapabilityDeltaNetworkMap:
+			capabilities |= network_map.PeerCapabilityDeltaNetworkMap
+		case proto.PeerCapability_PeerCapabilityLazyResources:
+			capabilities |= network_map.PeerCapabilityLazyResources
+		}
+	}
+	return capabilities
+}
+
+// extractReportedErrors converts the errors reported on sync, skipping the ones without a message or with an
+// invalid timestamp. Only the most recent nbpeer.MaxReportedErrors of them are kept anyway
+func extractReportedErrors(reportedErrors []*proto.PeerReportedError) []nbpeer.ReportedError {
+	if len(reportedErrors) > nbpeer.MaxReportedErrors {
+		reportedErrors = reportedErrors[len(reportedErrors)-nbpeer.MaxReportedErrors:]
+	}
+
+	errs := make([]nbpeer.ReportedError, 0, len(reportedErrors))
+	for _, reportedError := range reportedErrors {
+		if reportedError.GetMessage() == "" || reportedError.GetTimestamp() == nil {
+			continue
+		}
+
+		reportedAt := reportedError.GetTimestamp().AsTime()
+		if reportedAt.Unix() <= 0 || reportedAt.After(time.Now().Add(time.Minute)) {
+			continue
+		}
+
+		level := nbpeer.ReportedErrorLevelError
+		if reportedError.GetLevel() == proto.PeerReportedError_WARNING {
+			level = nbpeer.ReportedErrorLevelWarning
+		}
+
+		errs = append(errs, nbpeer.ReportedError{
+			Time:    reportedAt,
+			Level:   level,
+			Message: reportedError.GetMessage(),
+		})
+	}
+	return errs
+}
+
 func extractPeerMeta(ctx context.Context, meta *proto.PeerSystemMeta) nbpeer.PeerSystemMeta {
 	if meta == nil {
 		return nbpeer.PeerSystemMeta{}
@@ -580,8 +732,14 @@ func extractPeerMeta(ctx context.Context, meta *proto.PeerSystemMeta) nbpeer.Pee
 		osVersion = meta.GetCore()
 	}
 
-	networkAddresses := make([]nbpeer.NetworkAddress, 0, len(meta.GetNetworkAddresses()))
-	for _, addr := range meta.GetNetworkAddresses() {
+	reportedAddresses := meta.GetNetworkAddresses()
+	if len(reportedAddresses) > nbpeer.MaxNetworkAddresses {
+		log.WithContext(ctx).Warnf("peer reported %d network addresses, storing only the first %d", len(reportedAddresses), nbpeer.MaxNetworkAddresses)
+		reportedAddresses = reportedAddresses[:nbpeer.MaxNetworkAddresses]
+	}
+
+	networkAddresses := make([]nbpeer.NetworkAddress, 0, len(reportedAddresses))
+	for _, addr := range reportedAddresses {
 		netAddr, err := netip.ParsePrefix(addr.GetNetIP())
 		if err != nil {
 			log.WithContext(ctx).Warnf("failed to parse netip address, %s: %v", addr.GetNetIP(), err)
@@ -632,7 +790,8 @@ func extractPeerMeta(ctx context.Context, meta *proto.PeerSystemMeta) nbpeer.Pee
 			BlockInbound:          meta.GetFlags().GetBlockInbound(),
 			LazyConnectionEnabled: meta.GetFlags().GetLazyConnectionEnabled(),
 		},
-		Files: files,
+		Files:        files,
+		RelayAddress: meta.GetRelayAddress(),
 	}
 }
 
@@ -733,12 +892,20 @@ func (s *Server) Login(ctx context.Context, req *proto.EncryptedMessage) (*proto
 		SetupKey:        loginReq.GetSetupKey(),
 		ConnectionIP:    realIP,
 		ExtraDNSLabels:  loginReq.GetDnsLabels(),
+		IdempotencyKey:  getIdempotencyKey(ctx),
+		Attestation:     loginReq.GetAttestation(),
+		RequestedGroups: loginReq.GetRequestedGroups(),
 	})
 	if err != nil {
 		log.WithContext(ctx).Warnf("failed logging in peer %s: %s", peerKey, err)
 		return nil, mapError(ctx, err)
 	}
 
+	// the capabilities are reported again on sync, recording them here covers the updates sent in between
+	if capabilities := extractPeerCapabilities(loginReq.GetCapabilities()); capabilities != 0 {
+		s.networkMapController.SetPeerCapabilities(peer.ID, capabilities)
+	}
+
 	loginResp, err := s.prepareLoginResponse(ctx, peer, netMap, postureChecks)
 	if err != nil {
 		log.WithContext(ctx).Warnf("failed preparing login response for peer %s: %s", peerKey, err)
@@ -779,10 +946,16 @@ func (s *Server) prepareLoginResponse(ctx context.Context, peer *nbpeer.Peer, ne
 		return nil, status.Errorf(codes.Internal, "failed getting settings")
 	}
 
+	loginExpiration, err := s.getPeerLoginExpiration(ctx, peer, settings)
+	if err != nil {
+		log.WithContext(ctx).Warnf("failed getting login expiration of peer %s: %s", peer.Key, err)
+		return nil, status.Errorf(codes.Internal, "failed getting settings")
+	}
+
 	// if peer has reached this point then it has logged in
 	loginResp := &proto.LoginResponse{
 		NetbirdConfig: toNetbirdConfig(s.config, nil, relayToken, nil),
-		PeerConfig:    toPeerConfig(peer, netMap.Network, s.networkMapController.GetDNSDomain(settings), settings, s.config.HttpConfig, s.config.DeviceAuthorizationFlow, netMap.EnableSSH),
+		PeerConfig:    toPeerConfig(peer, netMap.Network, s.networkMapController.GetDNSDomain(settings), settings, loginExpiration, s.config.HttpConfig, s.config.DeviceAuthorizationFlow, netMap.EnableSSH),
 		Checks:        toProtocolChecks(ctx, postureChecks),
 	}
 
@@ -819,8 +992,21 @@ func (s *Server) IsHealthy(ctx context.Context, req *proto.Empty) (*proto.Empty,
 	return &proto.Empty{}, nil
 }
 
+// getPeerLoginExpiration returns the login expiration of the peer after the login expiration overrides of its groups
+func (s *Server) getPeerLoginExpiration(ctx context.Context, peer *nbpeer.Peer, settings *types.Settings) (time.Duration, error) {
+	if !settings.PeerLoginExpirationEnabled || !peer.AddedWithSSOLogin() {
+		return settings.PeerLoginExpiration, nil
+	}
+
+	override, err := s.accountManager.GetStore().GetPeerLoginExpirationOverride(ctx, store.LockingStrengthNone, peer.AccountID, peer.ID)
+	if err != nil {
+		return 0, err
+	}
+	return settings.ApplyPeerLoginExpirationOverride(override), nil
+}
+
 // sendInitialSync sends initial proto.SyncResponse to the peer requesting synchronization
-func (s *Server) sendInitialSync(ctx context.Context, peerKey wgtypes.Key, peer *nbpeer.Peer, networkMap *types.NetworkMap, postureChecks []*posture.Checks, srv proto.ManagementService_SyncServer, dnsFwdPort int64) error {
+func (s *Server) sendInitialSync(ctx context.Context, peerKey wgtypes.Key, peer *nbpeer.Peer, networkMap *types.NetworkMap, postureChecks []*posture.Checks, srv proto.ManagementService_SyncServer, dnsFwdPort int64, capabilities network_map.PeerCapabilities, knownSerial uint64) error {
 	var err error
 	var turnToken *Token
 
@@ -849,7 +1035,21 @@ func (s *Server) sendInitialSync(ctx context.Context, peerKey wgtypes.Key, peer
 		return status.Errorf(codes.Internal, "failed to get peer groups %s", err)
 	}
 
-	plainResp := ToSyncResponse(ctx, s.config, s.config.HttpConfig, s.config.DeviceAuthorizationFlow, peer, turnToken, relayToken, networkMap, s.networkMapController.GetDNSDomain(settings), postureChecks, nil, settings, settings.Extra, peerGroups, dnsFwdPort)
+	loginExpiration, err := s.getPeerLoginExpiration(ctx, peer, settings)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to get peer login expiration %s", err)
+	}
+
+	plainResp := ToSyncResponse(ctx, s.config, s.config.HttpConfig, s.config.DeviceAuthorizationFlow, peer, turnToken, relayToken, networkMap, s.networkMapController.GetDNSDomain(settings), postureChecks, nil, settings, loginExpiration, settings.Extra, peerGroups, dnsFwdPort)
+	// the client has no previous state on a new sync stream, so the initial response always carries the group list
+	plainResp.PeerGroupsChanged = true
+	plainResp.PeerGroups = peerGroups
+	if capabilities.Has(network_map.PeerCapabilityDeltaNetworkMap) {
+		s.applyNetworkMapDelta(peerKey.String(), knownSerial, plainResp)
+	}
+	if capabilities.Has(network_map.PeerCapabilityLazyResources) {
+		s.applyLazyResources(ctx, peerKey.String(), plainResp)
+	}
 
 	key, err := s.secretsManager.GetWGKey()
 	if err != nil {
@@ -1042,6 +1242,18 @@ func (s *Server) SyncMeta(ctx context.Context, req *proto.EncryptedMessage) (*pr
 		return nil, msg
 	}
 
+	if lastHandshake := extractLastHandshake(syncMetaReq.GetMeta()); !lastHandshake.IsZero() {
+		if err = s.accountManager.UpdatePeerLastHandshake(ctx, peerKey.String(), lastHandshake); err != nil {
+			log.WithContext(ctx).Warnf("failed to update last handshake of peer %s: %v", peerKey.String(), err)
+		}
+	}
+
+	if meta := syncMetaReq.GetMeta(); meta.GetRxBytes() > 0 || meta.GetTxBytes() > 0 {
+		if err = s.accountManager.RecordPeerUsage(ctx, peerKey.String(), meta.GetRxBytes(), meta.GetTxBytes()); err != nil {
+			log.WithContext(ctx).Warnf("failed to record usage of peer %s: %v", peerKey.String(), err)
+		}
+	}
+
 	err = s.accountManager.SyncPeerMeta(ctx, peerKey.String(), extractPeerMeta(ctx, syncMetaReq.GetMeta()))
 	if err != nil {
 		return nil, mapError(ctx, err)
@@ -1050,6 +1262,47 @@ func (s *Server) SyncMeta(ctx context.Context, req *proto.EncryptedMessage) (*pr
 	return &proto.Empty{}, nil
 }
 
+// AckNetworkMap stores the serial of the network map the peer applied, so that peers stuck on a stale
+// network map can be detected
+func (s *Server) AckNetworkMap(ctx context.Context, req *proto.EncryptedMessage) (*proto.Empty, error) {
+	ackReq := &proto.NetworkMapAck{}
+	peerKey, err := s.parseRequest(ctx, req, ackReq)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithContext(ctx).Tracef("peer %s applied network map serial %d", peerKey.String(), ackReq.GetSerial())
+
+	if err = s.accountManager.UpdatePeerAppliedSerial(ctx, peerKey.String(), ackReq.GetSerial()); err != nil {
+		log.WithContext(ctx).Debugf("failed to update applied serial of peer %s: %v", peerKey.String(), err)
+		return nil, mapError(ctx, err)
+	}
+
+	return &proto.Empty{}, nil
+}
+
+// ReportErrors stores the most recent errors and warnings the client ran into while the sync stream is open. They
+// are merged into the ones reported before, like the ones sent on sync
+func (s *Server) ReportErrors(ctx context.Context, req *proto.EncryptedMessage) (*proto.Empty, error) {
+	reportReq := &proto.ReportErrorsRequest{}
+	peerKey, err := s.parseRequest(ctx, req, reportReq)
+	if err != nil {
+		return nil, err
+	}
+
+	reportedErrors := extractReportedErrors(reportReq.GetReportedErrors())
+	if len(reportedErrors) == 0 {
+		return &proto.Empty{}, nil
+	}
+
+	if err = s.accountManager.UpdatePeerReportedErrors(ctx, peerKey.String(), reportedErrors); err != nil {
+		log.WithContext(ctx).Debugf("failed to update reported errors of peer %s: %v", peerKey.String(), err)
+		return nil, mapError(ctx, err)
+	}
+
+	return &proto.Empty{}, nil
+}
+
 func (s *Server) Logout(ctx context.Context, req *proto.EncryptedMessage) (*proto.Empty, error) {
 	log.WithContext(ctx).Debugf("Logout request from peer [%s]", req.WgPubKey)
 	start := time.Now()
@@ -2,13 +2,20 @@ package grpc
 
 import (
 	"context"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/netbirdio/netbird/encryption"
+	"github.com/netbirdio/netbird/management/internals/controllers/network_map"
 	"github.com/netbirdio/netbird/management/internals/server/config"
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
 	mgmtProto "github.com/netbirdio/netbird/shared/management/proto"
 )
 
@@ -106,3 +113,46 @@ func TestServer_GetDeviceAuthorizationFlow(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRealPort(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 41641}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+
+	require.Equal(t, uint16(41641), getRealPort(ctx, net.ParseIP("203.0.113.7")), "direct connection should report the source port")
+	require.Zero(t, getRealPort(ctx, net.ParseIP("198.51.100.1")), "port of a reverse proxy should not be reported")
+
+	proxied := metadata.NewIncomingContext(ctx, metadata.Pairs(realPortHeader, "51820"))
+	require.Equal(t, uint16(51820), getRealPort(proxied, net.ParseIP("198.51.100.1")), "relayed connection should report the port set by the relay")
+	proxied = metadata.NewIncomingContext(ctx, metadata.Pairs(realPortHeader, "70000"))
+	require.Zero(t, getRealPort(proxied, net.ParseIP("198.51.100.1")), "invalid port header should not be reported")
+	require.Zero(t, getRealPort(ctx, nil), "unknown real IP should not report a port")
+	require.Zero(t, getRealPort(context.Background(), net.ParseIP("203.0.113.7")), "missing peer info should not report a port")
+}
+
+func TestExtractReportedErrors(t *testing.T) {
+	now := time.Now().UTC()
+	reportedErrors := extractReportedErrors([]*mgmtProto.PeerReportedError{
+		{Timestamp: timestamppb.New(now.Add(-5 * time.Minute)), Level: mgmtProto.PeerReportedError_WARNING, Message: "route conflict"},
+		{Timestamp: timestamppb.New(now), Message: "dns server unreachable"},
+		{Timestamp: timestamppb.New(now), Message: ""},
+		{Message: "missing timestamp"},
+		{Timestamp: timestamppb.New(now.Add(time.Hour)), Message: "timestamp in the future"},
+	})
+
+	require.Equal(t, []nbpeer.ReportedError{
+		{Time: now.Add(-5 * time.Minute), Level: nbpeer.ReportedErrorLevelWarning, Message: "route conflict"},
+		{Time: now, Level: nbpeer.ReportedErrorLevelError, Message: "dns server unreachable"},
+	}, reportedErrors)
+}
+
+func TestExtractPeerCapabilities(t *testing.T) {
+	require.Equal(t, network_map.PeerCapabilities(0), extractPeerCapabilities(nil), "older clients should get full network maps")
+
+	capabilities := extractPeerCapabilities([]mgmtProto.PeerCapability{mgmtProto.PeerCapability_PeerCapabilityLazyResources, mgmtProto.PeerCapability(99)})
+	require.True(t, capabilities.Has(network_map.PeerCapabilityLazyResources))
+	require.False(t, capabilities.Has(network_map.PeerCapabilityDeltaNetworkMap))
+
+	capabilities = extractPeerCapabilities([]mgmtProto.PeerCapability{mgmtProto.PeerCapability_PeerCapabilityDeltaNetworkMap, mgmtProto.PeerCapability_PeerCapabilityLazyResources})
+	require.True(t, capabilities.Has(network_map.PeerCapabilityDeltaNetworkMap))
+	require.True(t, capabilities.Has(network_map.PeerCapabilityLazyResources))
+}
@@ -26,7 +26,6 @@ import (
 	"golang.org/x/exp/maps"
 
 	nbdns "github.com/netbirdio/netbird/dns"
-	nbdomain "github.com/netbirdio/netbird/shared/management/domain"
 	"github.com/netbirdio/netbird/formatter/hook"
 	"github.com/netbirdio/netbird/management/internals/controllers/network_map"
 	nbconfig "github.com/netbirdio/netbird/management/internals/server/config"
@@ -36,8 +35,10 @@ import (
 	nbcontext "github.com/netbirdio/netbird/management/server/context"
 	"github.com/netbirdio/netbird/management/server/geolocation"
 	"github.com/netbirdio/netbird/management/server/idp"
+	"github.com/netbirdio/netbird/management/server/integrations/attestation"
 	"github.com/netbirdio/netbird/management/server/integrations/integrated_validator"
 	"github.com/netbirdio/netbird/management/server/integrations/port_forwarding"
+	"github.com/netbirdio/netbird/management/server/integrations/webhook"
 	nbpeer "github.com/netbirdio/netbird/management/server/peer"
 	"github.com/netbirdio/netbird/management/server/permissions"
 	"github.com/netbirdio/netbird/management/server/permissions/modules"
@@ -49,6 +50,7 @@ import (
 	"github.com/netbirdio/netbird/management/server/types"
 	"github.com/netbirdio/netbird/management/server/util"
 	"github.com/netbirdio/netbird/route"
+	nbdomain "github.com/netbirdio/netbird/shared/management/domain"
 	"github.com/netbirdio/netbird/shared/management/status"
 )
 
@@ -99,6 +101,10 @@ type DefaultAccountManager struct {
 
 	peerInactivityExpiry Scheduler
 
+	peerUsageRollup Scheduler
+
+	appliedSerialFlush Scheduler
+
 	// userDeleteFromIDPEnabled allows to delete user from IDP when user is deleted from account
 	userDeleteFromIDPEnabled bool
 
@@ -109,10 +115,52 @@ type DefaultAccountManager struct {
 	permissionsManager permissions.Manager
 
 	disableDefaultPolicy bool
+
+	// peerRegistrations keeps recently used AddPeer idempotency keys to make peer registration safe to retry
+	peerRegistrations *peerRegistrationCache
+
+	// attestationVerifier verifies the platform attestation of registering peers
+	attestationVerifier attestation.Verifier
+
+	// peerWebhooks notifies the account webhooks about added and deleted peers
+	peerWebhooks *webhook.Dispatcher
+
+	// peerIPAllocator picks the IPs of new peers
+	peerIPAllocator types.PeerIPAllocator
+
+	// peerAdmission bounds the number of concurrent peer registrations per account
+	peerAdmission *peerAdmissionControl
+
+	// peerDisconnects delays the disconnects of the peers by the disconnect grace period of their account
+	peerDisconnects *peerDisconnectDebouncer
+
+	// appliedSerials buffers the network map acknowledgements of the peers until they are written to the store
+	appliedSerials *appliedSerialBuffer
 }
 
 var _ account.Manager = (*DefaultAccountManager)(nil)
 
+// SetPeerAttestationVerifier sets the verifier that checks the platform attestation of peers on registration
+func (am *DefaultAccountManager) SetPeerAttestationVerifier(verifier attestation.Verifier) {
+	am.attestationVerifier = verifier
+}
+
+// SetPeerIPAllocator sets the allocator that picks the IPs of new peers
+func (am *DefaultAccountManager) SetPeerIPAllocator(allocator types.PeerIPAllocator) {
+	am.peerIPAllocator = allocator
+}
+
+// allocatePeerIP returns an IP of the network for a new peer, falling back to a random IP when no allocator is set.
+// It has to be called in the transaction adding the peer, so the allocator sees the IPs taken in that transaction
+func (am *DefaultAccountManager) allocatePeerIP(ctx context.Context, transaction store.Store, accountID string, ipNet net.IPNet) (net.IP, error) {
+	if am.peerIPAllocator == nil {
+		return types.AllocateRandomPeerIP(ipNet)
+	}
+	return am.peerIPAllocator.AllocatePeerIP(ipNet, func() ([]net.IP, error) {
+		return transaction.GetTakenIPs(ctx, store.LockingStrengthNone, accountID)
+	})
+}
+
 func isUniqueConstraintError(err error) bool {
 	switch {
 	case strings.Contains(err.Error(), "(SQLSTATE 23505)"),
@@ -212,6 +260,8 @@ func BuildManager(
 		eventStore:               eventStore,
 		peerLoginExpiry:          NewDefaultScheduler(),
 		peerInactivityExpiry:     NewDefaultScheduler(),
+		peerUsageRollup:          NewDefaultScheduler(),
+		appliedSerialFlush:       NewDefaultScheduler(),
 		userDeleteFromIDPEnabled: userDeleteFromIDPEnabled,
 		integratedPeerValidator:  integratedPeerValidator,
 		metrics:                  metrics,
@@ -220,6 +270,19 @@ func BuildManager(
 		settingsManager:          settingsManager,
 		permissionsManager:       permissionsManager,
 		disableDefaultPolicy:     disableDefaultPolicy,
+		peerRegistrations:        newPeerRegistrationCache(peerRegistrationTTL),
+		attestationVerifier:      attestation.NewNoopVerifier(),
+		peerWebhooks:             webhook.NewDispatcher(),
+		peerIPAllocator:          types.RandomPeerIPAllocator{},
+		peerAdmission:            newPeerAdmissionControlFromEnv(ctx),
+		peerDisconnects:          newPeerDisconnectDebouncer(),
+		appliedSerials:           newAppliedSerialBuffer(),
+	}
+
+	if metrics != nil && metrics.AccountManagerMetrics() != nil {
+		if err := metrics.AccountManagerMetrics().RegisterAddPeerQueueDepth(am.peerAdmission.Depth); err != nil {
+			log.WithContext(ctx).Errorf("failed to register add peer queue depth metric: %v", err)
+		}
 	}
 
 	am.networkMapController.StartWarmup(ctx)
@@ -263,6 +326,9 @@ func BuildManager(
 		am.onPeersInvalidated(ctx, accountID, peerIDs)
 	})
 
+	go am.peerUsageRollup.Schedule(ctx, peerUsageRollupInterval, peerUsageRollupJobID, am.peerUsageRollupJob(ctx))
+	go am.appliedSerialFlush.Schedule(ctx, appliedSerialFlushInterval, appliedSerialFlushJobID, am.appliedSerialFlushJob(ctx))
+
 	return am, nil
 }
 
@@ -300,6 +366,13 @@ func (am *DefaultAccountManager) UpdateAccountSettings(ctx context.Context, acco
 			return err
 		}
 
+		// the webhook secret isn't returned by the API, keep the stored one unless a new one is provided
+		if newSettings.PeerWebhookURL == "" {
+			newSettings.PeerWebhookSecret = ""
+		} else if newSettings.PeerWebhookSecret == "" {
+			newSettings.PeerWebhookSecret = oldSettings.PeerWebhookSecret
+		}
+
 		if err = am.validateSettingsUpdate(ctx, transaction, newSettings, oldSettings, userID, accountID); err != nil {
 			return err
 		}
@@ -327,7 +400,10 @@ func (am *DefaultAccountManager) UpdateAccountSettings(ctx context.Context, acco
 		if oldSettings.RoutingPeerDNSResolutionEnabled != newSettings.RoutingPeerDNSResolutionEnabled ||
 			oldSettings.LazyConnectionEnabled != newSettings.LazyConnectionEnabled ||
 			oldSettings.DNSDomain != newSettings.DNSDomain ||
-			oldSettings.AutoUpdateVersion != newSettings.AutoUpdateVersion {
+			oldSettings.AutoUpdateVersion != newSettings.AutoUpdateVersion ||
+			oldSettings.NetworkMapConnectedPeersOnly != newSettings.NetworkMapConnectedPeersOnly ||
+			oldSettings.GetBlockedPeerOwnerBehavior() != newSettings.GetBlockedPeerOwnerBehavior() ||
+			!maps.Equal(oldSettings.RelayCountryMapping, newSettings.RelayCountryMapping) {
 			updateAccountPeers = true
 		}
 
@@ -366,8 +442,24 @@ func (am *DefaultAccountManager) UpdateAccountSettings(ctx context.Context, acco
 	am.handleRoutingPeerDNSResolutionSettings(ctx, oldSettings, newSettings, userID, accountID)
 	am.handleLazyConnectionSettings(ctx, oldSettings, newSettings, userID, accountID)
 	am.handlePeerLoginExpirationSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handlePeerLoginExpirationLeadTimeSettings(ctx, oldSettings, newSettings, userID, accountID)
 	am.handleGroupsPropagationSettings(ctx, oldSettings, newSettings, userID, accountID)
 	am.handleAutoUpdateVersionSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handlePeerNamingTemplateSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handlePeerWebhookSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handlePeerUpdateBufferIntervalSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handlePeerDisconnectGracePeriodSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handlePeerExpirationToleranceSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handlePeerDNSLabelSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handlePeerUsageCapSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handleEphemeralPeersLimitsSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handlePeerRegistrationOSVersionSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handleNetworkMapConnectedPeersOnlySettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handleBlockedPeerOwnerSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handleRegistrationFrozenSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handleRelayCountryMappingSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handleSignificantPeerMetaFieldsSettings(ctx, oldSettings, newSettings, userID, accountID)
+	am.handlePeerExpirationDefaultsSettings(ctx, oldSettings, newSettings, userID, accountID)
 	if err = am.handleInactivityExpirationSettings(ctx, oldSettings, newSettings, userID, accountID); err != nil {
 		return nil, err
 	}
@@ -403,10 +495,99 @@ func (am *DefaultAccountManager) validateSettingsUpdate(ctx context.Context, tra
 		return status.Errorf(status.InvalidArgument, "peer login expiration can't be smaller than one hour")
 	}
 
+	if newSettings.PeerLoginExpirationLeadTime < 0 || newSettings.PeerLoginExpirationLeadTime >= newSettings.PeerLoginExpiration {
+		return status.Errorf(status.InvalidArgument, "peer login expiration lead time can't be negative and must be smaller than the peer login expiration")
+	}
+
+	if newSettings.PeerExpirationTolerance < 0 || newSettings.PeerExpirationTolerance > nbpeer.MaxExpirationTolerance {
+		return status.Errorf(status.InvalidArgument, "peer expiration tolerance must be between 0 and %s", nbpeer.MaxExpirationTolerance)
+	}
+
+	if newSettings.PeerUpdateBufferInterval < 0 || newSettings.PeerUpdateBufferInterval > types.MaxPeerUpdateBufferInterval {
+		return status.Errorf(status.InvalidArgument, "peer update buffer interval must be between 0 and %s", types.MaxPeerUpdateBufferInterval)
+	}
+
+	if newSettings.PeerDisconnectGracePeriod < 0 || newSettings.PeerDisconnectGracePeriod > types.MaxPeerDisconnectGracePeriod {
+		return status.Errorf(status.InvalidArgument, "peer disconnect grace period must be between 0 and %s", types.MaxPeerDisconnectGracePeriod)
+	}
+
+	if newSettings.PeerUsageCap < 0 {
+		return status.Errorf(status.InvalidArgument, "peer usage cap can't be negative")
+	}
+
+	if newSettings.PeerUsageCap > 0 && (newSettings.PeerUsageCapWindow <= 0 || newSettings.PeerUsageCapWindow > nbpeer.UsageRetention) {
+		return status.Errorf(status.InvalidArgument, "peer usage cap window must be positive and at most %s", nbpeer.UsageRetention)
+	}
+
+	if err := types.ValidatePeerDNSLabelSuffix(newSettings.PeerDNSLabelSuffix); err != nil {
+		return status.Errorf(status.InvalidArgument, "%v", err)
+	}
+
+	if err := types.ValidatePeerDNSLabelMaxLength(newSettings.PeerDNSLabelMaxLength); err != nil {
+		return status.Errorf(status.InvalidArgument, "%v", err)
+	}
+
+	if err := types.ValidatePeerExtraDNSLabelsLimit(newSettings.PeerExtraDNSLabelsLimit); err != nil {
+		return status.Errorf(status.InvalidArgument, "%v", err)
+	}
+
+	if newSettings.PeerLimit < 0 {
+		return status.Errorf(status.InvalidArgument, "peer limit can't be negative")
+	}
+
+	if err := types.ValidateReservedDNSLabels(newSettings.ReservedDNSLabels); err != nil {
+		return status.Errorf(status.InvalidArgument, "%v", err)
+	}
+
+	if err := types.ValidateReservedDNSLabelAction(newSettings.ReservedDNSLabelAction); err != nil {
+		return status.Errorf(status.InvalidArgument, "%v", err)
+	}
+
+	if err := types.ValidateBlockedPeerOwnerBehavior(newSettings.BlockedPeerOwnerBehavior); err != nil {
+		return status.Errorf(status.InvalidArgument, "%v", err)
+	}
+
+	if err := types.ValidateRelayCountryMapping(newSettings.RelayCountryMapping); err != nil {
+		return status.Errorf(status.InvalidArgument, "%v", err)
+	}
+
+	if err := nbpeer.ValidateSignificantMetaFields(newSettings.SignificantPeerMetaFields); err != nil {
+		return status.Errorf(status.InvalidArgument, "%v", err)
+	}
+
+	if newSettings.SetupKeyPeerExpirationDefaults.Enabled() && !newSettings.SetupKeyPeerExpirationAllowed {
+		return status.Errorf(status.InvalidArgument, "the expiration of the peers added with a setup key must be allowed explicitly, these peers can't re-authenticate with SSO")
+	}
+
+	if newSettings.BlockedPeerOwnerBehavior == types.BlockedPeerOwnerAllowUntilExpiry && !newSettings.PeerLoginExpirationEnabled {
+		return status.Errorf(status.InvalidArgument, "peer login expiration must be enabled to allow the peers of blocked users until their login expires")
+	}
+
 	if newSettings.DNSDomain != "" && !nbdomain.IsValidDomainNoWildcard(newSettings.DNSDomain) {
 		return status.Errorf(status.InvalidArgument, "invalid domain \"%s\" provided for DNS domain", newSettings.DNSDomain)
 	}
 
+	if newSettings.PeerRegistrationOSVersionCheck != nil {
+		if err := newSettings.PeerRegistrationOSVersionCheck.Validate(); err != nil {
+			return status.Errorf(status.InvalidArgument, "invalid peer registration OS version check: %v", err)
+		}
+	}
+
+	if newSettings.PeerNamingTemplate != "" {
+		if err := types.ValidatePeerNamingTemplate(newSettings.PeerNamingTemplate); err != nil {
+			return status.Errorf(status.InvalidArgument, "invalid peer naming template: %v", err)
+		}
+	}
+
+	if newSettings.PeerWebhookURL != "" {
+		if err := am.validatePeerWebhookURL(ctx, newSettings.PeerWebhookURL); err != nil {
+			return err
+		}
+		if newSettings.PeerWebhookSecret == "" {
+			return status.Errorf(status.InvalidArgument, "peer webhook secret is required to sign the webhook payloads")
+		}
+	}
+
 	if newSettings.DNSDomain != oldSettings.DNSDomain && newSettings.DNSDomain != "" {
 		existingZone, err := transaction.GetZoneByDomain(ctx, accountID, newSettings.DNSDomain)
 		if err != nil {
@@ -422,6 +603,14 @@ func (am *DefaultAccountManager) validateSettingsUpdate(ctx context.Context, tra
 	return am.integratedPeerValidator.ValidateExtraSettings(ctx, newSettings.Extra, oldSettings.Extra, userID, accountID)
 }
 
+// validatePeerWebhookURL checks the peer webhook URL is an absolute http or https URL resolving to public addresses
+func (am *DefaultAccountManager) validatePeerWebhookURL(ctx context.Context, webhookURL string) error {
+	if err := am.peerWebhooks.ValidateURL(ctx, webhookURL); err != nil {
+		return status.Errorf(status.InvalidArgument, "invalid peer webhook URL %q: %v", webhookURL, err)
+	}
+	return nil
+}
+
 func (am *DefaultAccountManager) handleRoutingPeerDNSResolutionSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
 	if oldSettings.RoutingPeerDNSResolutionEnabled != newSettings.RoutingPeerDNSResolutionEnabled {
 		if newSettings.RoutingPeerDNSResolutionEnabled {
@@ -479,6 +668,209 @@ func (am *DefaultAccountManager) handleAutoUpdateVersionSettings(ctx context.Con
 	}
 }
 
+func (am *DefaultAccountManager) handlePeerWebhookSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if oldSettings.PeerWebhookURL != newSettings.PeerWebhookURL || oldSettings.PeerWebhookSecret != newSettings.PeerWebhookSecret {
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountPeerWebhookUpdated, map[string]any{
+			"url": newSettings.PeerWebhookURL,
+		})
+	}
+}
+
+func (am *DefaultAccountManager) handlePeerLoginExpirationLeadTimeSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if oldSettings.PeerLoginExpirationLeadTime != newSettings.PeerLoginExpirationLeadTime {
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountPeerLoginExpirationLeadTimeUpdated, map[string]any{
+			"old_lead_time_seconds": int64(oldSettings.PeerLoginExpirationLeadTime.Seconds()),
+			"new_lead_time_seconds": int64(newSettings.PeerLoginExpirationLeadTime.Seconds()),
+		})
+		if newSettings.PeerLoginExpirationEnabled {
+			am.peerLoginExpiry.Cancel(ctx, []string{accountID})
+			am.schedulePeerLoginExpiration(ctx, accountID)
+		}
+	}
+}
+
+func (am *DefaultAccountManager) handlePeerExpirationDefaultsSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if !reflect.DeepEqual(oldSettings.UserPeerExpirationDefaults, newSettings.UserPeerExpirationDefaults) ||
+		!reflect.DeepEqual(oldSettings.SetupKeyPeerExpirationDefaults, newSettings.SetupKeyPeerExpirationDefaults) ||
+		oldSettings.SetupKeyPeerExpirationAllowed != newSettings.SetupKeyPeerExpirationAllowed {
+		userPeers := newSettings.GetNewPeerExpiration(true, nil)
+		setupKeyPeers := newSettings.GetNewPeerExpiration(false, nil)
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountPeerExpirationDefaultsUpdated, map[string]any{
+			"user_peer_login_expiration":           userPeers.LoginExpirationEnabled,
+			"user_peer_inactivity_expiration":      userPeers.InactivityExpirationEnabled,
+			"setup_key_peer_login_expiration":      setupKeyPeers.LoginExpirationEnabled,
+			"setup_key_peer_inactivity_expiration": setupKeyPeers.InactivityExpirationEnabled,
+			"setup_key_peer_expiration_allowed":    newSettings.SetupKeyPeerExpirationAllowed,
+		})
+	}
+}
+
+func (am *DefaultAccountManager) handlePeerDisconnectGracePeriodSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if oldSettings.PeerDisconnectGracePeriod != newSettings.PeerDisconnectGracePeriod {
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountPeerDisconnectGracePeriodUpdated, map[string]any{
+			"old_grace_period_s": int64(oldSettings.PeerDisconnectGracePeriod.Seconds()),
+			"new_grace_period_s": int64(newSettings.PeerDisconnectGracePeriod.Seconds()),
+		})
+	}
+}
+
+func (am *DefaultAccountManager) handlePeerExpirationToleranceSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if oldSettings.PeerExpirationTolerance != newSettings.PeerExpirationTolerance {
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountPeerExpirationToleranceUpdated, map[string]any{
+			"old_tolerance_ms": oldSettings.PeerExpirationTolerance.Milliseconds(),
+			"new_tolerance_ms": newSettings.PeerExpirationTolerance.Milliseconds(),
+		})
+	}
+}
+
+func (am *DefaultAccountManager) handlePeerUpdateBufferIntervalSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if oldSettings.PeerUpdateBufferInterval != newSettings.PeerUpdateBufferInterval {
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountPeerUpdateBufferIntervalUpdated, map[string]any{
+			"old_interval_ms": oldSettings.PeerUpdateBufferInterval.Milliseconds(),
+			"new_interval_ms": newSettings.PeerUpdateBufferInterval.Milliseconds(),
+		})
+	}
+}
+
+func (am *DefaultAccountManager) handlePeerUsageCapSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if oldSettings.PeerUsageCap != newSettings.PeerUsageCap || oldSettings.PeerUsageCapWindow != newSettings.PeerUsageCapWindow {
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountPeerUsageCapUpdated, map[string]any{
+			"old_cap_bytes":      oldSettings.PeerUsageCap,
+			"new_cap_bytes":      newSettings.PeerUsageCap,
+			"old_window_seconds": int64(oldSettings.PeerUsageCapWindow.Seconds()),
+			"new_window_seconds": int64(newSettings.PeerUsageCapWindow.Seconds()),
+		})
+	}
+}
+
+func (am *DefaultAccountManager) handleEphemeralPeersLimitsSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if oldSettings.ExcludeEphemeralPeersFromLimits != newSettings.ExcludeEphemeralPeersFromLimits {
+		if newSettings.ExcludeEphemeralPeersFromLimits {
+			am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountEphemeralPeersExcludedFromLimits, nil)
+		} else {
+			am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountEphemeralPeersIncludedInLimits, nil)
+		}
+	}
+
+	if oldSettings.PeerLimit != newSettings.PeerLimit {
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountPeerLimitUpdated, map[string]any{
+			"old_limit": oldSettings.PeerLimit,
+			"new_limit": newSettings.PeerLimit,
+		})
+	}
+}
+
+func (am *DefaultAccountManager) handlePeerRegistrationOSVersionSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if !reflect.DeepEqual(oldSettings.PeerRegistrationOSVersionCheck, newSettings.PeerRegistrationOSVersionCheck) {
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountPeerRegistrationOSVersionCheckUpdated, nil)
+	}
+}
+
+func (am *DefaultAccountManager) handleNetworkMapConnectedPeersOnlySettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if oldSettings.NetworkMapConnectedPeersOnly != newSettings.NetworkMapConnectedPeersOnly {
+		if newSettings.NetworkMapConnectedPeersOnly {
+			am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountNetworkMapConnectedPeersOnlyEnabled, nil)
+		} else {
+			am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountNetworkMapConnectedPeersOnlyDisabled, nil)
+		}
+	}
+}
+
+func (am *DefaultAccountManager) handleRegistrationFrozenSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if oldSettings.RegistrationFrozen != newSettings.RegistrationFrozen {
+		if newSettings.RegistrationFrozen {
+			am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountRegistrationFrozen, nil)
+		} else {
+			am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountRegistrationUnfrozen, nil)
+		}
+	}
+}
+
+func (am *DefaultAccountManager) handleRelayCountryMappingSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if !maps.Equal(oldSettings.RelayCountryMapping, newSettings.RelayCountryMapping) {
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountRelayCountryMappingUpdated, map[string]any{
+			"mapping": newSettings.RelayCountryMapping,
+		})
+	}
+}
+
+func (am *DefaultAccountManager) handleSignificantPeerMetaFieldsSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if !slices.Equal(oldSettings.SignificantPeerMetaFields, newSettings.SignificantPeerMetaFields) {
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountSignificantPeerMetaFieldsUpdated, map[string]any{
+			"old_fields": oldSettings.SignificantPeerMetaFields,
+			"new_fields": newSettings.SignificantPeerMetaFields,
+		})
+	}
+}
+
+func (am *DefaultAccountManager) handleBlockedPeerOwnerSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if oldSettings.GetBlockedPeerOwnerBehavior() != newSettings.GetBlockedPeerOwnerBehavior() {
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountBlockedPeerOwnerBehaviorUpdated, map[string]any{
+			"old_behavior": oldSettings.GetBlockedPeerOwnerBehavior(),
+			"new_behavior": newSettings.GetBlockedPeerOwnerBehavior(),
+		})
+
+		if newSettings.GetBlockedPeerOwnerBehavior() == types.BlockedPeerOwnerReject {
+			am.expireBlockedUsersPeers(ctx, accountID)
+		}
+	}
+}
+
+// expireBlockedUsersPeers expires the peers of the blocked users of the account, as done when a user is blocked with
+// the reject blocked peer owner behavior
+func (am *DefaultAccountManager) expireBlockedUsersPeers(ctx context.Context, accountID string) {
+	users, err := am.Store.GetAccountUsers(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		log.WithContext(ctx).Errorf("failed to get users to expire the peers of blocked users: %v", err)
+		return
+	}
+
+	var peersToExpire []*nbpeer.Peer
+	for _, user := range users {
+		if !user.IsBlocked() {
+			continue
+		}
+
+		userPeers, err := am.Store.GetUserPeers(ctx, store.LockingStrengthNone, accountID, user.Id)
+		if err != nil {
+			log.WithContext(ctx).Errorf("failed to get peers of blocked user %s: %v", user.Id, err)
+			return
+		}
+		peersToExpire = append(peersToExpire, userPeers...)
+	}
+
+	if len(peersToExpire) == 0 {
+		return
+	}
+
+	if err = am.expireAndUpdatePeers(ctx, accountID, peersToExpire); err != nil {
+		log.WithContext(ctx).Errorf("failed to expire the peers of blocked users: %v", err)
+	}
+}
+
+func (am *DefaultAccountManager) handlePeerDNSLabelSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if oldSettings.PeerDNSLabelSuffix != newSettings.PeerDNSLabelSuffix || oldSettings.PeerDNSLabelMaxLength != newSettings.PeerDNSLabelMaxLength ||
+		oldSettings.PeerExtraDNSLabelsLimit != newSettings.PeerExtraDNSLabelsLimit ||
+		!slices.Equal(oldSettings.ReservedDNSLabels, newSettings.ReservedDNSLabels) ||
+		oldSettings.GetReservedDNSLabelAction() != newSettings.GetReservedDNSLabelAction() {
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountPeerDNSLabelSettingsUpdated, map[string]any{
+			"suffix":                newSettings.PeerDNSLabelSuffix,
+			"max_length":            newSettings.PeerDNSLabelMaxLength,
+			"extra_labels_limit":    newSettings.PeerExtraDNSLabelsLimit,
+			"reserved_labels":       newSettings.ReservedDNSLabels,
+			"reserved_label_action": newSettings.GetReservedDNSLabelAction(),
+		})
+	}
+}
+
+func (am *DefaultAccountManager) handlePeerNamingTemplateSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) {
+	if oldSettings.PeerNamingTemplate != newSettings.PeerNamingTemplate {
+		am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountPeerNamingTemplateUpdated, map[string]any{
+			"template": newSettings.PeerNamingTemplate,
+		})
+	}
+}
+
 func (am *DefaultAccountManager) handleInactivityExpirationSettings(ctx context.Context, oldSettings, newSettings *types.Settings, userID, accountID string) error {
 	if newSettings.PeerInactivityExpirationEnabled {
 		if oldSettings.PeerInactivityExpiration != newSettings.PeerInactivityExpiration {
@@ -501,7 +893,10 @@ func (am *DefaultAccountManager) handleInactivityExpirationSettings(ctx context.
 	return nil
 }
 
+// peerLoginExpirationJob expires the peers whose login expired and asks the peers that entered the login expiration
+// lead time since the previous run to re-authenticate
 func (am *DefaultAccountManager) peerLoginExpirationJob(ctx context.Context, accountID string) func() (time.Duration, bool) {
+	lastRun := time.Now()
 	return func() (time.Duration, bool) {
 		//nolint
 		ctx := context.WithValue(ctx, nbcontext.AccountIDKey, accountID)
@@ -525,6 +920,10 @@ func (am *DefaultAccountManager) peerLoginExpirationJob(ctx context.Context, acc
 			return peerSchedulerRetryInterval, true
 		}
 
+		now := time.Now()
+		am.hintPeerLoginExpiration(ctx, accountID, now.Sub(lastRun))
+		lastRun = now
+
 		return am.getNextPeerExpiration(ctx, accountID)
 	}
 }
@@ -572,6 +971,37 @@ func (am *DefaultAccountManager) checkAndSchedulePeerInactivityExpiration(ctx co
 	}
 }
 
+// ReportSchedulerHealth returns the state of the peer login and inactivity expiration jobs for every account with
+// scheduled jobs, sorted by account ID. A job that is overdue without having run indicates a stuck scheduler.
+func (am *DefaultAccountManager) ReportSchedulerHealth() []*types.AccountSchedulerHealth {
+	accounts := make(map[string]*types.AccountSchedulerHealth)
+	getAccount := func(accountID string) *types.AccountSchedulerHealth {
+		health, ok := accounts[accountID]
+		if !ok {
+			health = &types.AccountSchedulerHealth{AccountID: accountID}
+			accounts[accountID] = health
+		}
+		return health
+	}
+
+	for accountID, job := range am.peerLoginExpiry.JobsHealth() {
+		getAccount(accountID).LoginExpiration = &job
+	}
+	for accountID, job := range am.peerInactivityExpiry.JobsHealth() {
+		getAccount(accountID).InactivityExpiration = &job
+	}
+
+	report := make([]*types.AccountSchedulerHealth, 0, len(accounts))
+	for _, health := range accounts {
+		report = append(report, health)
+	}
+	slices.SortFunc(report, func(a, b *types.AccountSchedulerHealth) int {
+		return strings.Compare(a.AccountID, b.AccountID)
+	})
+
+	return report
+}
+
 // newAccount creates a new Account with a generated ID and generated default setup keys.
 // If ID is already in use (due to collision) we try one more time before returning error
 func (am *DefaultAccountManager) newAccount(ctx context.Context, userID, domain, email, name string) (*types.Account, error) {
@@ -739,6 +1169,7 @@ func (am *DefaultAccountManager) DeleteAccount(ctx context.Context, accountID, u
 		log.WithContext(ctx).Errorf("failed deleting account %s. error: %s", accountID, err)
 		return err
 	}
+	am.networkMapController.OnAccountDeleted(ctx, accountID, maps.Keys(account.Peers))
 	// cancel peer login expiry job
 	am.peerLoginExpiry.Cancel(ctx, []string{account.Id})
 
@@ -1436,7 +1867,7 @@ func (am *DefaultAccountManager) SyncUserJWTGroups(ctx context.Context, userAuth
 
 			for _, peer := range peers {
 				for _, g := range addNewGroups {
-					if err := transaction.AddPeerToGroup(ctx, userAuth.AccountId, peer.ID, g); err != nil {
+					if err := transaction.AddPeerToAutoGroup(ctx, userAuth.AccountId, peer.ID, g); err != nil {
 						return fmt.Errorf("error adding peer %s to group %s: %w", peer.ID, g, err)
 					}
 				}
@@ -1657,13 +2088,13 @@ func domainIsUpToDate(domain string, domainCategory string, userAuth auth.UserAu
 	return domainCategory == types.PrivateCategory || userAuth.DomainCategory != types.PrivateCategory || domain != userAuth.Domain
 }
 
-func (am *DefaultAccountManager) SyncAndMarkPeer(ctx context.Context, accountID string, peerPubKey string, meta nbpeer.PeerSystemMeta, realIP net.IP) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, int64, error) {
+func (am *DefaultAccountManager) SyncAndMarkPeer(ctx context.Context, accountID string, peerPubKey string, meta nbpeer.PeerSystemMeta, realIP net.IP, realPort uint16) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, int64, error) {
 	peer, netMap, postureChecks, dnsfwdPort, err := am.SyncPeer(ctx, types.PeerSync{WireGuardPubKey: peerPubKey, Meta: meta}, accountID)
 	if err != nil {
 		return nil, nil, nil, 0, fmt.Errorf("error syncing peer: %w", err)
 	}
 
-	err = am.MarkPeerConnected(ctx, peerPubKey, true, realIP, accountID)
+	err = am.MarkPeerConnected(ctx, peerPubKey, true, realIP, realPort, accountID)
 	if err != nil {
 		log.WithContext(ctx).Warnf("failed marking peer as connected %s %v", peerPubKey, err)
 	}
@@ -1671,21 +2102,62 @@ func (am *DefaultAccountManager) SyncAndMarkPeer(ctx context.Context, accountID
 	return peer, netMap, postureChecks, dnsfwdPort, nil
 }
 
+// OnPeerDisconnected marks the peer as disconnected. With a disconnect grace period configured for the account, the
+// peer keeps its connected status until the period has passed without the peer reconnecting
 func (am *DefaultAccountManager) OnPeerDisconnected(ctx context.Context, accountID string, peerPubKey string) error {
-	err := am.MarkPeerConnected(ctx, peerPubKey, false, nil, accountID)
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
 	if err != nil {
-		log.WithContext(ctx).Warnf("failed marking peer as disconnected %s %v", peerPubKey, err)
+		log.WithContext(ctx).Warnf("failed getting account settings to disconnect peer %s: %v", peerPubKey, err)
 	}
+
+	if settings != nil && settings.PeerDisconnectGracePeriod > 0 {
+		disconnectCtx := context.WithoutCancel(ctx)
+		am.peerDisconnects.schedule(peerPubKey, settings.PeerDisconnectGracePeriod, func() {
+			am.markPeerDisconnected(disconnectCtx, accountID, peerPubKey)
+		})
+		return nil
+	}
+
+	am.peerDisconnects.cancel(peerPubKey)
+	am.markPeerDisconnected(ctx, accountID, peerPubKey)
 	return nil
 }
 
+func (am *DefaultAccountManager) markPeerDisconnected(ctx context.Context, accountID string, peerPubKey string) {
+	err := am.markPeerConnected(ctx, peerPubKey, false, nil, 0, accountID)
+	if err != nil {
+		log.WithContext(ctx).Warnf("failed marking peer as disconnected %s %v", peerPubKey, err)
+	}
+}
+
 func (am *DefaultAccountManager) SyncPeerMeta(ctx context.Context, peerPubKey string, meta nbpeer.PeerSystemMeta) error {
-	accountID, err := am.Store.GetAccountIDByPeerPubKey(ctx, peerPubKey)
+	peer, err := am.Store.GetPeerByPeerPubKey(ctx, store.LockingStrengthNone, peerPubKey)
 	if err != nil {
 		return err
 	}
 
-	_, _, _, _, err = am.SyncPeer(ctx, types.PeerSync{WireGuardPubKey: peerPubKey, Meta: meta, UpdateAccountPeers: true}, accountID)
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, peer.AccountID)
+	if err != nil {
+		return err
+	}
+
+	// clients resend unchanged meta when reporting the last handshake, which must not trigger account peer updates
+	updatedPeer := peer.Copy()
+	updated, _, insignificant := updatedPeer.UpdateMetaIfNew(meta, settings.SignificantPeerMetaFields)
+	// changes of insignificant meta fields are stored without updating the account peers
+	if insignificant {
+		return am.Store.SavePeerMeta(ctx, peer.AccountID, peer.ID, updatedPeer.Meta)
+	}
+	if !updated {
+		return nil
+	}
+
+	// relay changes don't affect network maps, so they are stored without updating the account peers
+	if updatedPeer.Meta.IsEqualIgnoringRelay(peer.Meta) {
+		return am.Store.SavePeerRelayAddress(ctx, peer.AccountID, peer.ID, updatedPeer.Meta.RelayAddress)
+	}
+
+	_, _, _, _, err = am.SyncPeer(ctx, types.PeerSync{WireGuardPubKey: peerPubKey, Meta: meta, UpdateAccountPeers: true}, peer.AccountID)
 	if err != nil {
 		return err
 	}
@@ -1733,26 +2205,37 @@ func (am *DefaultAccountManager) GetAccountIDForPeerKey(ctx context.Context, pee
 	return am.Store.GetAccountIDByPeerPubKey(ctx, peerKey)
 }
 
-func (am *DefaultAccountManager) handleUserPeer(ctx context.Context, transaction store.Store, peer *nbpeer.Peer, settings *types.Settings) (bool, error) {
+// handleUserPeer checks the owner and the login expiration of a peer logging in with SSO. It returns whether the peer
+// has been changed and whether it is quarantined because its owner is blocked
+func (am *DefaultAccountManager) handleUserPeer(ctx context.Context, transaction store.Store, peer *nbpeer.Peer, settings *types.Settings) (bool, bool, error) {
 	user, err := transaction.GetUserByUserID(ctx, store.LockingStrengthNone, peer.UserID)
 	if err != nil {
-		return false, err
+		return false, false, err
 	}
 
-	err = checkIfPeerOwnerIsBlocked(peer, user)
+	quarantined, err := handleBlockedPeerOwner(peer, user, settings)
 	if err != nil {
-		return false, err
+		return false, false, err
 	}
 
-	if peerLoginExpired(ctx, peer, settings) {
+	expired, err := peerLoginExpired(ctx, transaction, peer, settings)
+	if err != nil {
+		return false, false, err
+	}
+	if expired {
+		// the login of a peer whose owner is blocked is never renewed, whatever the blocked peer owner behavior
+		if err = checkIfPeerOwnerIsBlocked(peer, user); err != nil {
+			return false, false, err
+		}
+
 		err = am.handleExpiredPeer(ctx, transaction, user, peer)
 		if err != nil {
-			return false, err
+			return false, false, err
 		}
-		return true, nil
+		return true, false, nil
 	}
 
-	return false, nil
+	return false, quarantined, nil
 }
 
 func (am *DefaultAccountManager) GetAccountSettings(ctx context.Context, accountID string, userID string) (*types.Settings, error) {
@@ -2026,7 +2509,7 @@ func propagateUserGroupMemberships(ctx context.Context, transaction store.Store,
 				if _, exists := accountGroupPeers[groupID][peer.ID]; exists {
 					continue
 				}
-				if err := transaction.AddPeerToGroup(ctx, accountID, peer.ID, groupID); err != nil {
+				if err := transaction.AddPeerToAutoGroup(ctx, accountID, peer.ID, groupID); err != nil {
 					return false, false, fmt.Errorf("error adding peer %s to group %s: %w", peer.ID, groupID, err)
 				}
 				updatedGroups = append(updatedGroups, groupID)
@@ -2058,7 +2541,7 @@ func (am *DefaultAccountManager) reallocateAccountPeerIPs(ctx context.Context, t
 		return err
 	}
 
-	peers, err := transaction.GetAccountPeers(ctx, store.LockingStrengthUpdate, accountID, "", "")
+	peers, err := transaction.GetAccountPeers(ctx, store.LockingStrengthUpdate, accountID, "", "", nil)
 	if err != nil {
 		return err
 	}
@@ -2147,7 +2630,11 @@ func (am *DefaultAccountManager) updatePeerIPInTransaction(ctx context.Context,
 			return nil
 		}
 
-		peers, err := transaction.GetAccountPeers(ctx, store.LockingStrengthShare, accountID, "", "")
+		if existingPeer.ManagedBySetupKeyOnly {
+			return newPeerManagedBySetupKeyError(existingPeer.ID)
+		}
+
+		peers, err := transaction.GetAccountPeers(ctx, store.LockingStrengthShare, accountID, "", "", nil)
 		if err != nil {
 			return fmt.Errorf("get account peers: %w", err)
 		}
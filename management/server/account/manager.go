@@ -9,6 +9,7 @@ import (
 	"github.com/netbirdio/netbird/shared/auth"
 
 	nbdns "github.com/netbirdio/netbird/dns"
+	"github.com/netbirdio/netbird/management/internals/controllers/network_map"
 	"github.com/netbirdio/netbird/management/server/activity"
 	nbcache "github.com/netbirdio/netbird/management/server/cache"
 	"github.com/netbirdio/netbird/management/server/idp"
@@ -27,7 +28,7 @@ type Manager interface {
 	GetOrCreateAccountByUser(ctx context.Context, userAuth auth.UserAuth) (*types.Account, error)
 	GetAccount(ctx context.Context, accountID string) (*types.Account, error)
 	CreateSetupKey(ctx context.Context, accountID string, keyName string, keyType types.SetupKeyType, expiresIn time.Duration,
-		autoGroups []string, usageLimit int, userID string, ephemeral bool, allowExtraDNSLabels bool) (*types.SetupKey, error)
+		autoGroups []string, usageLimit int, userID string, opts types.SetupKeyOptions) (*types.SetupKey, error)
 	SaveSetupKey(ctx context.Context, accountID string, key *types.SetupKey, userID string) (*types.SetupKey, error)
 	CreateUser(ctx context.Context, accountID, initiatorUserID string, key *types.UserInfo) (*types.UserInfo, error)
 	CreateUserInvite(ctx context.Context, accountID, initiatorUserID string, invite *types.UserInfo, expiresIn int) (*types.UserInvite, error)
@@ -42,11 +43,14 @@ type Manager interface {
 	InviteUser(ctx context.Context, accountID string, initiatorUserID string, targetUserID string) error
 	ApproveUser(ctx context.Context, accountID, initiatorUserID, targetUserID string) (*types.UserInfo, error)
 	RejectUser(ctx context.Context, accountID, initiatorUserID, targetUserID string) error
+	ReconcileUserPeerGroups(ctx context.Context, accountID, initiatorUserID, targetUserID string, removeStale bool) error
 	ListSetupKeys(ctx context.Context, accountID, userID string) ([]*types.SetupKey, error)
 	SaveUser(ctx context.Context, accountID, initiatorUserID string, update *types.User) (*types.UserInfo, error)
 	SaveOrAddUser(ctx context.Context, accountID, initiatorUserID string, update *types.User, addIfNotExists bool) (*types.UserInfo, error)
 	SaveOrAddUsers(ctx context.Context, accountID, initiatorUserID string, updates []*types.User, addIfNotExists bool) ([]*types.UserInfo, error)
 	GetSetupKey(ctx context.Context, accountID, userID, keyID string) (*types.SetupKey, error)
+	ReportSchedulerHealth() []*types.AccountSchedulerHealth
+	ValidateSetupKey(ctx context.Context, setupKey string) (*types.SetupKeyValidation, error)
 	GetAccountByID(ctx context.Context, accountID string, userID string) (*types.Account, error)
 	GetAccountMeta(ctx context.Context, accountID string, userID string) (*types.AccountMeta, error)
 	GetAccountOnboarding(ctx context.Context, accountID string, userID string) (*types.AccountOnboarding, error)
@@ -57,12 +61,38 @@ type Manager interface {
 	GetUserByID(ctx context.Context, id string) (*types.User, error)
 	GetUserFromUserAuth(ctx context.Context, userAuth auth.UserAuth) (*types.User, error)
 	ListUsers(ctx context.Context, accountID string) ([]*types.User, error)
-	GetPeers(ctx context.Context, accountID, userID, nameFilter, ipFilter string) ([]*nbpeer.Peer, error)
-	MarkPeerConnected(ctx context.Context, peerKey string, connected bool, realIP net.IP, accountID string) error
+	GetPeers(ctx context.Context, accountID, userID string, filters store.PeerFilters) ([]*nbpeer.Peer, error)
+	CountPeers(ctx context.Context, accountID, userID string, filters store.PeerFilters) (int, error)
+	RefreshPeerOwnerEmails(ctx context.Context, accountID, userID string) (int, error)
+	GetPeersMissingGroups(ctx context.Context, accountID, userID string) ([]*nbpeer.Peer, error)
+	GetOrphanedPeers(ctx context.Context, accountID, userID string) ([]*nbpeer.Peer, error)
+	ReassignOrphanedPeers(ctx context.Context, accountID, userID, newOwnerID string) (int, error)
+	DeleteOrphanedPeers(ctx context.Context, accountID, userID string) (int, error)
+	DeletePeersBySetupKey(ctx context.Context, accountID, userID, setupKeyID string) (int, []string, int, error)
+	GetPeersByCountry(ctx context.Context, accountID, userID, countryCode string) ([]*nbpeer.Peer, error)
+	GetPeersByRelay(ctx context.Context, accountID, userID, relayID string) ([]*nbpeer.Peer, error)
+	GetPeersPendingApproval(ctx context.Context, accountID, userID string) ([]*nbpeer.Peer, error)
+	GetPeerRoles(ctx context.Context, accountID, userID, peerID string) (*types.PeerRoles, error)
+	ExportAccountPeers(ctx context.Context, accountID, userID string) (*types.PeersExport, error)
+	ImportAccountPeers(ctx context.Context, accountID, userID string, export *types.PeersExport) ([]*nbpeer.Peer, error)
+	TransferPeer(ctx context.Context, srcAccountID, dstAccountID, peerID, userID string) (*nbpeer.Peer, error)
+	UpdatePeerFirewallOverrides(ctx context.Context, accountID, userID, peerID string, overrides []nbpeer.FirewallOverride) (*nbpeer.Peer, error)
+	SetPeerPinned(ctx context.Context, accountID, userID, peerID string, pinned bool) error
+	MarkPeerConnected(ctx context.Context, peerKey string, connected bool, realIP net.IP, realPort uint16, accountID string) error
 	DeletePeer(ctx context.Context, accountID, peerID, userID string) error
 	UpdatePeer(ctx context.Context, accountID, userID string, peer *nbpeer.Peer) (*nbpeer.Peer, error)
 	UpdatePeerIP(ctx context.Context, accountID, userID, peerID string, newIP netip.Addr) error
+	UpdatePeerAdminNotes(ctx context.Context, accountID, userID, peerID, notes string) (*nbpeer.Peer, error)
 	GetNetworkMap(ctx context.Context, peerID string) (*types.NetworkMap, error)
+	GetPeerNetworkMapStats(ctx context.Context, peerID string) (*types.NetworkMapStats, error)
+	GetPeerDNSConfig(ctx context.Context, accountID, userID, peerID string) (*nbdns.Config, error)
+	DiffPeerNetworkMaps(ctx context.Context, accountID, userID, peerAID, peerBID string) (*types.NetworkMapDiff, error)
+	GenerateDebugWGConfig(ctx context.Context, accountID, userID, peerID string) (string, error)
+	GetPeerExitNode(ctx context.Context, accountID, userID, peerID string) (*types.PeerExitNode, error)
+	GetPeersByVersion(ctx context.Context, accountID, userID, versionConstraint string) ([]*nbpeer.Peer, error)
+	GetPeersWithIngressPorts(ctx context.Context, accountID, userID string) ([]*types.PeerIngressPorts, error)
+	GetEphemeralPeersPendingCleanup(ctx context.Context, accountID, userID string) ([]*types.EphemeralPeerCleanup, error)
+	GetBufferUpdateState(ctx context.Context, accountID, userID string) (*network_map.AccountBufferUpdateState, error)
 	GetPeerNetwork(ctx context.Context, peerID string) (*types.Network, error)
 	AddPeer(ctx context.Context, accountID, setupKey, userID string, peer *nbpeer.Peer, temporary bool) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, error)
 	CreatePAT(ctx context.Context, accountID string, initiatorUserID string, targetUserID string, tokenName string, expiresIn int) (*types.PersonalAccessTokenGenerated, error)
@@ -81,11 +111,13 @@ type Manager interface {
 	DeleteGroups(ctx context.Context, accountId, userId string, groupIDs []string) error
 	GroupAddPeer(ctx context.Context, accountId, groupID, peerID string) error
 	GroupDeletePeer(ctx context.Context, accountId, groupID, peerID string) error
+	RemovePeersFromGroups(ctx context.Context, accountID, userID string, peerIDs, groupIDs []string) (int, error)
 	GetPeerGroups(ctx context.Context, accountID, peerID string) ([]*types.Group, error)
 	GetPolicy(ctx context.Context, accountID, policyID, userID string) (*types.Policy, error)
 	SavePolicy(ctx context.Context, accountID, userID string, policy *types.Policy, create bool) (*types.Policy, error)
 	DeletePolicy(ctx context.Context, accountID, policyID, userID string) error
 	ListPolicies(ctx context.Context, accountID, userID string) ([]*types.Policy, error)
+	ExplainPeerAccess(ctx context.Context, accountID, userID, srcPeerID, dstPeerID string) (*types.PeerAccessExplanation, error)
 	GetRoute(ctx context.Context, accountID string, routeID route.ID, userID string) (*route.Route, error)
 	CreateRoute(ctx context.Context, accountID string, prefix netip.Prefix, networkType route.NetworkType, domains domain.List, peerID string, peerGroupIDs []string, description string, netID route.NetID, masquerade bool, metric int, groups, accessControlGroupIDs []string, enabled bool, userID string, keepRoute bool, skipAutoApply bool) (*route.Route, error)
 	SaveRoute(ctx context.Context, accountID, userID string, route *route.Route) error
@@ -98,9 +130,18 @@ type Manager interface {
 	ListNameServerGroups(ctx context.Context, accountID string, userID string) ([]*nbdns.NameServerGroup, error)
 	StoreEvent(ctx context.Context, initiatorID, targetID, accountID string, activityID activity.ActivityDescriber, meta map[string]any)
 	GetEvents(ctx context.Context, accountID, userID string) ([]*activity.Event, error)
+	StreamAccountEvents(ctx context.Context, accountID, userID string, from time.Time) (*activity.EventsReader, error)
+	GetPeerCountHistory(ctx context.Context, accountID, userID string, from, to time.Time, bucket types.PeerCountHistoryBucket) ([]*types.PeerCountDelta, error)
 	GetDNSSettings(ctx context.Context, accountID string, userID string) (*types.DNSSettings, error)
 	SaveDNSSettings(ctx context.Context, accountID string, userID string, dnsSettingsToSave *types.DNSSettings) error
 	GetPeer(ctx context.Context, accountID, peerID, userID string) (*nbpeer.Peer, error)
+	CanAllocatePeers(ctx context.Context, accountID, userID string, count int) (bool, int, error)
+	GetPeersByPubKeyPrefix(ctx context.Context, accountID, userID, prefix string) ([]*nbpeer.Peer, error)
+	GetPeerFast(ctx context.Context, accountID, peerID, userID string) (*nbpeer.Peer, error)
+	GetPeersByIDs(ctx context.Context, accountID, userID string, peerIDs []string) (map[string]*nbpeer.Peer, []string, error)
+	GetPeerFQDNs(ctx context.Context, accountID, userID, peerID string) ([]string, error)
+	DisconnectPeer(ctx context.Context, accountID, peerID, userID string, markDisconnected bool) error
+	SetGroupSSHEnabled(ctx context.Context, accountID, userID, groupID string, enabled bool) (int, error)
 	UpdateAccountSettings(ctx context.Context, accountID, userID string, newSettings *types.Settings) (*types.Settings, error)
 	UpdateAccountOnboarding(ctx context.Context, accountID, userID string, newOnboarding *types.AccountOnboarding) (*types.AccountOnboarding, error)
 	LoginPeer(ctx context.Context, login types.PeerLogin) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, error)                       // used by peer gRPC API
@@ -110,18 +151,28 @@ type Manager interface {
 	SavePostureChecks(ctx context.Context, accountID, userID string, postureChecks *posture.Checks, create bool) (*posture.Checks, error)
 	DeletePostureChecks(ctx context.Context, accountID, postureChecksID, userID string) error
 	ListPostureChecks(ctx context.Context, accountID, userID string) ([]*posture.Checks, error)
+	GetPeerPostureContext(ctx context.Context, accountID, userID, peerID string) ([]*types.PeerPostureCheckSource, error)
 	GetIdpManager() idp.Manager
 	UpdateIntegratedValidator(ctx context.Context, accountID, userID, validator string, groups []string) error
 	GroupValidation(ctx context.Context, accountId string, groups []string) (bool, error)
 	GetValidatedPeers(ctx context.Context, accountID string) (map[string]struct{}, map[string]string, error)
-	SyncAndMarkPeer(ctx context.Context, accountID string, peerPubKey string, meta nbpeer.PeerSystemMeta, realIP net.IP) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, int64, error)
+	SyncAndMarkPeer(ctx context.Context, accountID string, peerPubKey string, meta nbpeer.PeerSystemMeta, realIP net.IP, realPort uint16) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, int64, error)
 	OnPeerDisconnected(ctx context.Context, accountID string, peerPubKey string) error
 	SyncPeerMeta(ctx context.Context, peerPubKey string, meta nbpeer.PeerSystemMeta) error
+	UpdatePeerLastHandshake(ctx context.Context, peerPubKey string, lastHandshake time.Time) error
+	UpdatePeerAppliedSerial(ctx context.Context, peerPubKey string, serial uint64) error
+	GetPeerAppliedSerial(ctx context.Context, accountID, peerID, userID string) (uint64, error)
+	UpdatePeerReportedErrors(ctx context.Context, peerPubKey string, reportedErrors []nbpeer.ReportedError) error
+	RecordPeerUsage(ctx context.Context, peerPubKey string, rxCounter, txCounter int64) error
+	GetPeerUsage(ctx context.Context, accountID, userID, peerID string, window time.Duration) (*nbpeer.Usage, error)
 	FindExistingPostureCheck(accountID string, checks *posture.ChecksDefinition) (*posture.Checks, error)
 	GetAccountIDForPeerKey(ctx context.Context, peerKey string) (string, error)
 	GetAccountSettings(ctx context.Context, accountID string, userID string) (*types.Settings, error)
 	DeleteSetupKey(ctx context.Context, accountID, userID, keyID string) error
 	UpdateAccountPeers(ctx context.Context, accountID string)
+	ForceAccountResync(ctx context.Context, accountID, userID string) error
+	SetPeerUpdatesPaused(ctx context.Context, accountID, peerID string, paused bool, userID string) error
+	RenewExpiredPeerLogins(ctx context.Context, accountID, userID string) (int, error)
 	BufferUpdateAccountPeers(ctx context.Context, accountID string)
 	BuildUserInfosForAccount(ctx context.Context, accountID, initiatorUserID string, accountUsers []*types.User) (map[string]*types.UserInfo, error)
 	SyncUserJWTGroups(ctx context.Context, userAuth auth.UserAuth) error
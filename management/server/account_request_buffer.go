@@ -4,14 +4,18 @@ import (
 	"context"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/netbirdio/netbird/management/server/store"
 	"github.com/netbirdio/netbird/management/server/types"
+	"github.com/netbirdio/netbird/shared/management/status"
 )
 
+const defaultAccountRequestTimeout = 30 * time.Second
+
 // AccountRequest holds the result channel to return the requested account.
 type AccountRequest struct {
 	AccountID  string
@@ -30,6 +34,10 @@ type AccountRequestBuffer struct {
 	mu                  sync.Mutex
 	getAccountRequestCh chan *AccountRequest
 	bufferInterval      time.Duration
+	// requestTimeout bounds the wait of requests whose context has no deadline
+	requestTimeout time.Duration
+	// depth is the number of requests currently waiting for an account
+	depth atomic.Int64
 }
 
 func NewAccountRequestBuffer(ctx context.Context, store store.Store) *AccountRequestBuffer {
@@ -42,32 +50,75 @@ func NewAccountRequestBuffer(ctx context.Context, store store.Store) *AccountReq
 		bufferInterval = 100 * time.Millisecond
 	}
 
-	log.WithContext(ctx).Infof("set account request buffer interval to %s", bufferInterval)
+	requestTimeoutStr := os.Getenv("NB_GET_ACCOUNT_BUFFER_TIMEOUT")
+	requestTimeout, err := time.ParseDuration(requestTimeoutStr)
+	if err != nil || requestTimeout <= 0 {
+		if requestTimeoutStr != "" {
+			log.WithContext(ctx).Warnf("failed to parse account request buffer timeout %q, using default", requestTimeoutStr)
+		}
+		requestTimeout = defaultAccountRequestTimeout
+	}
+
+	log.WithContext(ctx).Infof("set account request buffer interval to %s and timeout to %s", bufferInterval, requestTimeout)
 
-	ac := AccountRequestBuffer{
+	ac := &AccountRequestBuffer{
 		store:               store,
 		getAccountRequests:  make(map[string][]*AccountRequest),
 		getAccountRequestCh: make(chan *AccountRequest),
 		bufferInterval:      bufferInterval,
+		requestTimeout:      requestTimeout,
 	}
 
 	go ac.processGetAccountRequests(ctx)
 
-	return &ac
+	return ac
 }
+
+// Depth returns the number of requests currently waiting for an account
+func (ac *AccountRequestBuffer) Depth() int64 {
+	return ac.depth.Load()
+}
+
+// GetAccountWithBackpressure returns the account, batching concurrent requests for the same account.
+// The wait is bounded by the context deadline, or by the buffer timeout when the context has none.
+// Returns status.Unavailable when the account couldn't be fetched in time.
 func (ac *AccountRequestBuffer) GetAccountWithBackpressure(ctx context.Context, accountID string) (*types.Account, error) {
 	req := &AccountRequest{
 		AccountID:  accountID,
 		ResultChan: make(chan *AccountResult, 1),
 	}
 
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ac.requestTimeout)
+		defer cancel()
+	}
+
+	ac.depth.Add(1)
+	defer ac.depth.Add(-1)
+
 	log.WithContext(ctx).Tracef("requesting account %s with backpressure", accountID)
 	startTime := time.Now()
-	ac.getAccountRequestCh <- req
 
-	result := <-req.ResultChan
-	log.WithContext(ctx).Tracef("got account with backpressure after %s", time.Since(startTime))
-	return result.Account, result.Err
+	select {
+	case ac.getAccountRequestCh <- req:
+	case <-ctx.Done():
+		return nil, ac.unavailableError(ctx, accountID, startTime)
+	}
+
+	// the result channel is buffered, so an abandoned request doesn't block the batch processing
+	select {
+	case result := <-req.ResultChan:
+		log.WithContext(ctx).Tracef("got account with backpressure after %s", time.Since(startTime))
+		return result.Account, result.Err
+	case <-ctx.Done():
+		return nil, ac.unavailableError(ctx, accountID, startTime)
+	}
+}
+
+func (ac *AccountRequestBuffer) unavailableError(ctx context.Context, accountID string, startTime time.Time) error {
+	log.WithContext(ctx).Warnf("gave up waiting for account %s with backpressure after %s: %v", accountID, time.Since(startTime), ctx.Err())
+	return status.Errorf(status.Unavailable, "account request buffer is saturated, please try again later")
 }
 
 func (ac *AccountRequestBuffer) processGetAccountBatch(ctx context.Context, accountID string) {
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/shared/management/status"
+)
+
+func TestAccountRequestBuffer_GetAccountWithBackpressure_Timeout(t *testing.T) {
+	// no processor is running, so nothing consumes the requests and the buffer stays saturated
+	buffer := &AccountRequestBuffer{
+		getAccountRequests:  make(map[string][]*AccountRequest),
+		getAccountRequestCh: make(chan *AccountRequest),
+		requestTimeout:      time.Minute,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	account, err := buffer.GetAccountWithBackpressure(ctx, "accountID")
+	require.Error(t, err)
+	assert.Nil(t, account)
+
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.Unavailable, sErr.Type())
+	assert.Equal(t, int64(0), buffer.Depth())
+}
@@ -812,6 +812,39 @@ func createAccount(am *DefaultAccountManager, accountID, userID, domain string)
 	return account, nil
 }
 
+// createManagerWithAccount creates a manager with the "testaccount" account owned by the "testuser" admin
+func createManagerWithAccount(t *testing.T) (*DefaultAccountManager, string, string) {
+	t.Helper()
+
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	userID := "testuser"
+
+	_, err = createAccount(manager, accountID, userID, "domain.com")
+	require.NoError(t, err)
+
+	return manager, accountID, userID
+}
+
+// addTestPeer registers a peer with a new WireGuard key, using the setup key or the user ID, and fails the test when
+// the registration fails
+func addTestPeer(t *testing.T, manager *DefaultAccountManager, setupKey, userID string, meta nbpeer.PeerSystemMeta) *nbpeer.Peer {
+	t.Helper()
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	peer, _, _, err := manager.AddPeer(context.Background(), "", setupKey, userID, &nbpeer.Peer{
+		Key:  key.PublicKey().String(),
+		Meta: meta,
+	}, false)
+	require.NoError(t, err)
+
+	return peer
+}
+
 func TestAccountManager_GetAccount(t *testing.T) {
 	manager, _, err := createManager(t)
 	if err != nil {
@@ -1038,7 +1071,7 @@ func TestAccountManager_AddPeer(t *testing.T) {
 
 	serial := account.Network.CurrentSerial() // should be 0
 
-	setupKey, err := manager.CreateSetupKey(context.Background(), account.Id, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, userID, false, false)
+	setupKey, err := manager.CreateSetupKey(context.Background(), account.Id, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{})
 	if err != nil {
 		t.Fatal("error creating setup key")
 		return
@@ -1479,7 +1512,7 @@ func TestAccountManager_DeletePeer(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	setupKey, err := manager.CreateSetupKey(context.Background(), account.Id, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, userID, false, false)
+	setupKey, err := manager.CreateSetupKey(context.Background(), account.Id, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{})
 	if err != nil {
 		t.Fatal("error creating setup key")
 		return
@@ -1881,7 +1914,7 @@ func TestDefaultAccountManager_UpdatePeer_PeerLoginExpiration(t *testing.T) {
 	accountID, err := manager.GetAccountIDByUserID(context.Background(), auth.UserAuth{UserId: userID})
 	require.NoError(t, err, "unable to get the account")
 
-	err = manager.MarkPeerConnected(context.Background(), key.PublicKey().String(), true, nil, accountID)
+	err = manager.MarkPeerConnected(context.Background(), key.PublicKey().String(), true, nil, 0, accountID)
 	require.NoError(t, err, "unable to mark peer connected")
 
 	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
@@ -1952,7 +1985,7 @@ func TestDefaultAccountManager_MarkPeerConnected_PeerLoginExpiration(t *testing.
 	require.NoError(t, err, "unable to get the account")
 
 	// when we mark peer as connected, the peer login expiration routine should trigger
-	err = manager.MarkPeerConnected(context.Background(), key.PublicKey().String(), true, nil, accountID)
+	err = manager.MarkPeerConnected(context.Background(), key.PublicKey().String(), true, nil, 0, accountID)
 	require.NoError(t, err, "unable to mark peer connected")
 
 	failed := waitTimeout(wg, time.Second)
@@ -1961,6 +1994,152 @@ func TestDefaultAccountManager_MarkPeerConnected_PeerLoginExpiration(t *testing.
 	}
 }
 
+func TestDefaultAccountManager_GroupPeerLoginExpiration(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err, "unable to create account manager")
+
+	accountID, err := manager.GetAccountIDByUserID(context.Background(), auth.UserAuth{UserId: userID})
+	require.NoError(t, err, "unable to create an account")
+
+	key, err := wgtypes.GenerateKey()
+	require.NoError(t, err, "unable to generate WireGuard key")
+	peer, _, _, err := manager.AddPeer(context.Background(), "", "", userID, &nbpeer.Peer{
+		Key:                    key.PublicKey().String(),
+		Meta:                   nbpeer.PeerSystemMeta{Hostname: "test-peer"},
+		LoginExpirationEnabled: true,
+	}, false)
+	require.NoError(t, err, "unable to add peer")
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration:        7 * 24 * time.Hour,
+		PeerLoginExpirationEnabled: true,
+		Extra:                      &types.ExtraSettings{},
+	})
+	require.NoError(t, err, "expecting to update account settings successfully but got error")
+
+	err = manager.MarkPeerConnected(context.Background(), key.PublicKey().String(), true, nil, 0, accountID)
+	require.NoError(t, err, "unable to mark peer connected")
+
+	manager.peerLoginExpiry = &MockScheduler{}
+
+	err = manager.CreateGroup(context.Background(), accountID, userID, &types.Group{
+		Name:                "contractors",
+		Issued:              types.GroupIssuedAPI,
+		PeerLoginExpiration: time.Minute,
+	})
+	require.Error(t, err, "group login expiration below one hour should be rejected")
+
+	contractors := &types.Group{
+		Name:                "contractors",
+		Issued:              types.GroupIssuedAPI,
+		Peers:               []string{peer.ID},
+		PeerLoginExpiration: 2 * time.Hour,
+	}
+	require.NoError(t, manager.CreateGroup(context.Background(), accountID, userID, contractors))
+	require.NoError(t, manager.CreateGroup(context.Background(), accountID, userID, &types.Group{
+		Name:                "temporary",
+		Issued:              types.GroupIssuedAPI,
+		Peers:               []string{peer.ID},
+		PeerLoginExpiration: 24 * time.Hour,
+	}))
+
+	nextRun, ok := manager.getNextPeerExpiration(context.Background(), accountID)
+	require.True(t, ok)
+	assert.LessOrEqual(t, nextRun, 2*time.Hour+nbpeer.DefaultExpirationTolerance, "the shortest group expiration should apply")
+	assert.Greater(t, nextRun, time.Hour)
+
+	contractors.PeerLoginExpiration = 0
+	require.NoError(t, manager.UpdateGroup(context.Background(), accountID, userID, contractors))
+
+	nextRun, ok = manager.getNextPeerExpiration(context.Background(), accountID)
+	require.True(t, ok)
+	assert.Greater(t, nextRun, 2*time.Hour, "the remaining group expiration should apply")
+	assert.LessOrEqual(t, nextRun, 24*time.Hour+nbpeer.DefaultExpirationTolerance)
+
+	settings, err := manager.Store.GetAccountSettings(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err)
+	storedPeer, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+
+	lastLogin := time.Now().UTC().Add(-25 * time.Hour)
+	storedPeer.LastLogin = &lastLogin
+	expired, err := peerLoginExpired(context.Background(), manager.Store, storedPeer, settings)
+	require.NoError(t, err)
+	assert.True(t, expired, "the group expiration should expire the peer before the account one")
+
+	// a group override longer than the account setting is capped to it
+	settings.PeerLoginExpiration = 12 * time.Hour
+	lastLogin = time.Now().UTC().Add(-13 * time.Hour)
+	expired, err = peerLoginExpired(context.Background(), manager.Store, storedPeer, settings)
+	require.NoError(t, err)
+	assert.True(t, expired, "a longer group expiration should not extend the account one")
+
+	lastLogin = time.Now().UTC().Add(-30 * time.Minute)
+	expired, err = peerLoginExpired(context.Background(), manager.Store, storedPeer, settings)
+	require.NoError(t, err)
+	assert.False(t, expired)
+}
+
+func TestDefaultAccountManager_PeerLoginAndInactivityExpirationPrecedence(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err, "unable to create account manager")
+
+	accountID, err := manager.GetAccountIDByUserID(context.Background(), auth.UserAuth{UserId: userID})
+	require.NoError(t, err, "unable to create an account")
+
+	key, err := wgtypes.GenerateKey()
+	require.NoError(t, err, "unable to generate WireGuard key")
+	peer, _, _, err := manager.AddPeer(context.Background(), "", "", userID, &nbpeer.Peer{
+		Key:                         key.PublicKey().String(),
+		Meta:                        nbpeer.PeerSystemMeta{Hostname: "test-peer"},
+		LoginExpirationEnabled:      true,
+		InactivityExpirationEnabled: true,
+	}, false)
+	require.NoError(t, err, "unable to add peer")
+
+	manager.peerLoginExpiry = &MockScheduler{}
+	manager.peerInactivityExpiry = &MockScheduler{}
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration:             24 * time.Hour,
+		PeerLoginExpirationEnabled:      true,
+		PeerInactivityExpiration:        time.Hour,
+		PeerInactivityExpirationEnabled: true,
+		Extra:                           &types.ExtraSettings{},
+	})
+	require.NoError(t, err, "expecting to update account settings successfully but got error")
+
+	// the peer is eligible for both expirations, the login one expired first
+	peer, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	lastLogin := time.Now().UTC().Add(-48 * time.Hour)
+	peer.LastLogin = &lastLogin
+	peer.Status = &nbpeer.PeerStatus{Connected: false, LastSeen: time.Now().UTC().Add(-2 * time.Hour)}
+	require.NoError(t, manager.Store.SavePeer(context.Background(), accountID, peer))
+
+	expiredPeers, err := manager.getExpiredPeers(context.Background(), accountID)
+	require.NoError(t, err)
+	require.Len(t, expiredPeers, 1, "the login expiration should govern the peer")
+	inactivePeers, err := manager.getInactivePeers(context.Background(), accountID)
+	require.NoError(t, err)
+	assert.Empty(t, inactivePeers, "a peer governed by the login expiration should not be expired by inactivity")
+
+	// the inactivity expiration comes first once the peer logged in again
+	lastLogin = time.Now().UTC().Add(-time.Hour)
+	peer.LastLogin = &lastLogin
+	require.NoError(t, manager.Store.SavePeer(context.Background(), accountID, peer))
+
+	expiredPeers, err = manager.getExpiredPeers(context.Background(), accountID)
+	require.NoError(t, err)
+	assert.Empty(t, expiredPeers, "a peer governed by the inactivity expiration should not be expired by login")
+	inactivePeers, err = manager.getInactivePeers(context.Background(), accountID)
+	require.NoError(t, err)
+	require.Len(t, inactivePeers, 1, "the inactivity expiration should govern the peer")
+
+	_, ok := manager.getNextPeerExpiration(context.Background(), accountID)
+	assert.False(t, ok, "disconnected peers should not be scheduled for login expiration")
+}
+
 func TestDefaultAccountManager_UpdateAccountSettings_PeerLoginExpiration(t *testing.T) {
 	manager, _, err := createManager(t)
 	require.NoError(t, err, "unable to create account manager")
@@ -1983,7 +2162,7 @@ func TestDefaultAccountManager_UpdateAccountSettings_PeerLoginExpiration(t *test
 	account, err := manager.Store.GetAccount(context.Background(), accountID)
 	require.NoError(t, err, "unable to get the account")
 
-	err = manager.MarkPeerConnected(context.Background(), key.PublicKey().String(), true, nil, accountID)
+	err = manager.MarkPeerConnected(context.Background(), key.PublicKey().String(), true, nil, 0, accountID)
 	require.NoError(t, err, "unable to mark peer connected")
 
 	wg := &sync.WaitGroup{}
@@ -2060,6 +2239,167 @@ func TestDefaultAccountManager_UpdateAccountSettings(t *testing.T) {
 	require.Error(t, err, "expecting to fail when providing PeerLoginExpiration more than 180 days")
 }
 
+func TestDefaultAccountManager_UpdateAccountSettings_PeerUpdateBufferInterval(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err, "unable to create account manager")
+
+	accountID, err := manager.GetAccountIDByUserID(context.Background(), auth.UserAuth{UserId: userID})
+	require.NoError(t, err, "unable to create an account")
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration:      time.Hour,
+		PeerUpdateBufferInterval: 500 * time.Millisecond,
+		Extra:                    &types.ExtraSettings{},
+	})
+	require.NoError(t, err, "expecting to update the peer update buffer interval")
+
+	settings, err := manager.Store.GetAccountSettings(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err, "unable to get account settings")
+	assert.Equal(t, 500*time.Millisecond, settings.PeerUpdateBufferInterval)
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration:      time.Hour,
+		PeerUpdateBufferInterval: 2 * time.Minute,
+		Extra:                    &types.ExtraSettings{},
+	})
+	require.Error(t, err, "expecting to fail when providing a buffer interval above the maximum")
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration:      time.Hour,
+		PeerUpdateBufferInterval: -time.Second,
+		Extra:                    &types.ExtraSettings{},
+	})
+	require.Error(t, err, "expecting to fail when providing a negative buffer interval")
+}
+
+func TestDefaultAccountManager_UpdateAccountSettings_PeerLoginExpirationLeadTime(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err, "unable to create account manager")
+
+	accountID, err := manager.GetAccountIDByUserID(context.Background(), auth.UserAuth{UserId: userID})
+	require.NoError(t, err, "unable to create an account")
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpirationEnabled:  true,
+		PeerLoginExpiration:         24 * time.Hour,
+		PeerLoginExpirationLeadTime: time.Hour,
+		Extra:                       &types.ExtraSettings{},
+	})
+	require.NoError(t, err, "expecting to update the peer login expiration lead time")
+
+	settings, err := manager.Store.GetAccountSettings(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err, "unable to get account settings")
+	assert.Equal(t, time.Hour, settings.PeerLoginExpirationLeadTime)
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration:         time.Hour,
+		PeerLoginExpirationLeadTime: time.Hour,
+		Extra:                       &types.ExtraSettings{},
+	})
+	require.Error(t, err, "expecting to fail when the lead time is not smaller than the login expiration")
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration:         time.Hour,
+		PeerLoginExpirationLeadTime: -time.Second,
+		Extra:                       &types.ExtraSettings{},
+	})
+	require.Error(t, err, "expecting to fail when providing a negative lead time")
+}
+
+func TestDefaultAccountManager_UpdateAccountSettings_PeerExpirationTolerance(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err, "unable to create account manager")
+
+	accountID, err := manager.GetAccountIDByUserID(context.Background(), auth.UserAuth{UserId: userID})
+	require.NoError(t, err, "unable to create an account")
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration:     time.Hour,
+		PeerExpirationTolerance: 10 * time.Second,
+		Extra:                   &types.ExtraSettings{},
+	})
+	require.NoError(t, err, "expecting to update the peer expiration tolerance")
+
+	settings, err := manager.Store.GetAccountSettings(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err, "unable to get account settings")
+	assert.Equal(t, 10*time.Second, settings.GetPeerExpirationTolerance())
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration:     time.Hour,
+		PeerExpirationTolerance: nbpeer.MaxExpirationTolerance + time.Second,
+		Extra:                   &types.ExtraSettings{},
+	})
+	require.Error(t, err, "expecting to fail when the tolerance exceeds the maximum")
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration:     time.Hour,
+		PeerExpirationTolerance: -time.Second,
+		Extra:                   &types.ExtraSettings{},
+	})
+	require.Error(t, err, "expecting to fail when providing a negative tolerance")
+}
+
+func TestDefaultAccountManager_PeerLoginExpirationLeadTimeSchedule(t *testing.T) {
+	manager, updateManager, err := createManager(t)
+	require.NoError(t, err, "unable to create account manager")
+
+	ctx := context.Background()
+	accountID, err := manager.GetAccountIDByUserID(ctx, auth.UserAuth{UserId: userID})
+	require.NoError(t, err, "unable to create an account")
+
+	peer := addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: "laptop"})
+
+	_, err = manager.UpdateAccountSettings(ctx, accountID, userID, &types.Settings{
+		PeerLoginExpirationEnabled:  true,
+		PeerLoginExpiration:         24 * time.Hour,
+		PeerLoginExpirationLeadTime: time.Hour,
+		Extra:                       &types.ExtraSettings{},
+	})
+	require.NoError(t, err)
+
+	setLastLogin := func(ago time.Duration) {
+		peer, err := manager.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peer.ID)
+		require.NoError(t, err)
+		lastLogin := time.Now().UTC().Add(-ago)
+		peer.LastLogin = &lastLogin
+		peer.LoginExpirationEnabled = true
+		peer.Status.Connected = true
+		require.NoError(t, manager.Store.SavePeer(ctx, accountID, peer))
+	}
+
+	setLastLogin(22 * time.Hour)
+	nextRun, ok := manager.getNextPeerExpiration(ctx, accountID)
+	require.True(t, ok)
+	assert.InDelta(t, float64(time.Hour), float64(nextRun), float64(time.Minute), "the job should run when the peer enters the lead time")
+
+	updMsg := updateManager.CreateChannel(ctx, peer.ID)
+	t.Cleanup(func() {
+		updateManager.CloseChannel(ctx, peer.ID)
+	})
+
+	// drain the buffered updates of the settings change
+	for drained := false; !drained; {
+		select {
+		case <-updMsg:
+		case <-time.After(500 * time.Millisecond):
+			drained = true
+		}
+	}
+
+	setLastLogin(23*time.Hour + 30*time.Minute)
+	manager.hintPeerLoginExpiration(ctx, accountID, time.Minute)
+	peerShouldNotReceiveUpdate(t, updMsg)
+
+	manager.hintPeerLoginExpiration(ctx, accountID, time.Hour)
+	select {
+	case msg := <-updMsg:
+		require.NotNil(t, msg)
+		assert.True(t, msg.Update.GetPeerConfig().GetLoginExpiresSoon(), "peer should be asked to re-authenticate")
+	case <-time.After(time.Second):
+		t.Error("timeout waiting for the login expiration hint")
+	}
+}
+
 func TestDefaultAccountManager_UpdateAccountSettings_PeerApproval(t *testing.T) {
 	manager, _, account, peer1, peer2, peer3 := setupNetworkMapTest(t)
 
@@ -2089,7 +2429,7 @@ func TestDefaultAccountManager_UpdateAccountSettings_PeerApproval(t *testing.T)
 	_, err = manager.UpdateAccountSettings(ctx, accountID, userID, newSettings)
 	require.NoError(t, err)
 
-	accountPeers, err := manager.Store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "")
+	accountPeers, err := manager.Store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "", nil)
 	require.NoError(t, err)
 
 	for _, peer := range accountPeers {
@@ -2179,7 +2519,7 @@ func TestAccount_GetExpiredPeers(t *testing.T) {
 						Connected:    true,
 						LoginExpired: false,
 					},
-					LastLogin: util.ToPtr(time.Now().UTC().Add(-1 * time.Hour)),
+					LastLogin: util.ToPtr(time.Now().UTC().Add(-1*time.Hour - nbpeer.DefaultExpirationTolerance)),
 					UserID:    userID,
 				},
 			},
@@ -2443,7 +2783,8 @@ func TestAccount_GetNextPeerExpiration(t *testing.T) {
 		expectedNextExpiration time.Duration
 	}
 
-	expectedNextExpiration := time.Minute
+	// the expiration includes the tolerance grace period
+	expectedNextExpiration := time.Minute + nbpeer.DefaultExpirationTolerance
 	testCases := []test{
 		{
 			name:                   "No peers, no expiration",
@@ -3078,7 +3419,7 @@ func setupNetworkMapTest(t *testing.T) (*DefaultAccountManager, *update_channel.
 		t.Fatal(err)
 	}
 
-	setupKey, err := manager.CreateSetupKey(context.Background(), account.Id, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, userID, false, false)
+	setupKey, err := manager.CreateSetupKey(context.Background(), account.Id, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{})
 	if err != nil {
 		t.Fatal("error creating setup key")
 	}
@@ -3176,7 +3517,7 @@ func BenchmarkSyncAndMarkPeer(b *testing.B) {
 			b.ResetTimer()
 			start := time.Now()
 			for i := 0; i < b.N; i++ {
-				_, _, _, _, err := manager.SyncAndMarkPeer(context.Background(), account.Id, account.Peers["peer-1"].Key, nbpeer.PeerSystemMeta{Hostname: strconv.Itoa(i)}, net.IP{1, 1, 1, 1})
+				_, _, _, _, err := manager.SyncAndMarkPeer(context.Background(), account.Id, account.Peers["peer-1"].Key, nbpeer.PeerSystemMeta{Hostname: strconv.Itoa(i)}, net.IP{1, 1, 1, 1}, 0)
 				assert.NoError(b, err)
 			}
 
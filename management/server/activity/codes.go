@@ -204,6 +204,72 @@ const (
 	UserInviteLinkRegenerated Activity = 106
 	UserInviteLinkDeleted     Activity = 107
 
+	PeerDescriptionChanged Activity = 108
+
+	AccountPeerNamingTemplateUpdated Activity = 109
+
+	PeerFirewallOverridesUpdated Activity = 110
+
+	AccountPeerWebhookUpdated Activity = 111
+
+	AccountPeerUpdateBufferIntervalUpdated Activity = 112
+
+	PeerImported Activity = 113
+
+	AccountPeerDNSLabelSettingsUpdated Activity = 114
+
+	PeerDisconnectedByUser Activity = 115
+
+	AccountPeerLoginExpirationLeadTimeUpdated Activity = 116
+
+	PeerOwnerReassigned Activity = 117
+
+	AccountPeerUsageCapUpdated Activity = 118
+
+	PeerUsageCapExceeded Activity = 119
+
+	AccountResyncForced Activity = 120
+
+	AccountEphemeralPeersExcludedFromLimits Activity = 121
+	AccountEphemeralPeersIncludedInLimits   Activity = 122
+
+	PeerUpdatesPaused  Activity = 123
+	PeerUpdatesResumed Activity = 124
+
+	PeerLoginRenewedByUser Activity = 125
+
+	AccountPeerRegistrationOSVersionCheckUpdated Activity = 126
+
+	AccountNetworkMapConnectedPeersOnlyEnabled  Activity = 127
+	AccountNetworkMapConnectedPeersOnlyDisabled Activity = 128
+
+	PeerTransferredOut Activity = 129
+	PeerTransferredIn  Activity = 130
+
+	AccountBlockedPeerOwnerBehaviorUpdated Activity = 131
+
+	PeerAdminNotesChanged Activity = 132
+
+	AccountRegistrationFrozen   Activity = 133
+	AccountRegistrationUnfrozen Activity = 134
+
+	AccountRelayCountryMappingUpdated Activity = 135
+
+	AccountPeerDisconnectGracePeriodUpdated Activity = 136
+
+	AccountPeerExpirationDefaultsUpdated Activity = 137
+
+	PeerPendingApproval Activity = 138
+	PeerRejected        Activity = 139
+	// AccountPeerExpirationToleranceUpdated indicates that a user updated the peer expiration tolerance of the account
+	AccountPeerExpirationToleranceUpdated Activity = 140
+	// AccountSignificantPeerMetaFieldsUpdated indicates that a user updated the peer meta fields that trigger peer updates
+	AccountSignificantPeerMetaFieldsUpdated Activity = 141
+	// AccountPeerLimitUpdated indicates that a user updated the maximum number of peers of the account
+	AccountPeerLimitUpdated Activity = 142
+	// PeerImportClaimed indicates that a registering client took over a peer imported from another account
+	PeerImportClaimed Activity = 143
+
 	AccountDeleted Activity = 99999
 )
 
@@ -337,6 +403,70 @@ var activityMap = map[Activity]Code{
 	UserInviteLinkAccepted:    {"User invite link accepted", "user.invite.link.accept"},
 	UserInviteLinkRegenerated: {"User invite link regenerated", "user.invite.link.regenerate"},
 	UserInviteLinkDeleted:     {"User invite link deleted", "user.invite.link.delete"},
+
+	PeerDescriptionChanged: {"Peer description changed", "peer.description.update"},
+
+	AccountPeerNamingTemplateUpdated: {"Account peer naming template updated", "account.settings.peer.naming.template.update"},
+
+	PeerFirewallOverridesUpdated: {"Peer firewall overrides updated", "peer.firewall.overrides.update"},
+
+	AccountPeerWebhookUpdated: {"Account peer webhook updated", "account.settings.peer.webhook.update"},
+
+	AccountPeerUpdateBufferIntervalUpdated: {"Account peer update buffer interval updated", "account.settings.peer.update.buffer.interval.update"},
+
+	PeerImported: {"Peer imported", "peer.import"},
+
+	AccountPeerDNSLabelSettingsUpdated: {"Account peer DNS label settings updated", "account.settings.peer.dns.label.update"},
+
+	PeerDisconnectedByUser: {"Peer disconnected by user", "peer.user.disconnect"},
+
+	AccountPeerLoginExpirationLeadTimeUpdated: {"Account peer login expiration lead time updated", "account.setting.peer.login.expiration.lead.time.update"},
+
+	PeerOwnerReassigned: {"Peer owner reassigned", "peer.owner.reassign"},
+
+	AccountPeerUsageCapUpdated: {"Account peer usage cap updated", "account.settings.peer.usage.cap.update"},
+
+	PeerUsageCapExceeded: {"Peer exceeded the usage cap", "peer.usage.cap.exceed"},
+
+	AccountResyncForced: {"Account peers resync forced", "account.resync.force"},
+
+	AccountEphemeralPeersExcludedFromLimits: {"Account ephemeral peers excluded from limits", "account.setting.ephemeral.peers.limits.exclude"},
+	AccountEphemeralPeersIncludedInLimits:   {"Account ephemeral peers included in limits", "account.setting.ephemeral.peers.limits.include"},
+
+	PeerUpdatesPaused:  {"Peer network map updates paused", "peer.updates.pause"},
+	PeerUpdatesResumed: {"Peer network map updates resumed", "peer.updates.resume"},
+
+	PeerLoginRenewedByUser: {"Expired peer login renewed", "peer.login.renew"},
+
+	AccountPeerRegistrationOSVersionCheckUpdated: {"Account peer registration minimum OS versions updated", "account.setting.peer.registration.os.version.update"},
+
+	AccountNetworkMapConnectedPeersOnlyEnabled:  {"Account network maps limited to connected peers", "account.setting.network.map.connected.peers.only.enable"},
+	AccountNetworkMapConnectedPeersOnlyDisabled: {"Account network maps include offline peers", "account.setting.network.map.connected.peers.only.disable"},
+
+	PeerTransferredOut: {"Peer transferred to another account", "peer.transfer.out"},
+	PeerTransferredIn:  {"Peer transferred from another account", "peer.transfer.in"},
+
+	AccountBlockedPeerOwnerBehaviorUpdated: {"Account blocked peer owner behavior updated", "account.setting.blocked.peer.owner.behavior.update"},
+
+	PeerAdminNotesChanged: {"Peer admin notes changed", "peer.admin.notes.update"},
+
+	AccountRegistrationFrozen:   {"Account peer registration frozen", "account.setting.registration.freeze"},
+	AccountRegistrationUnfrozen: {"Account peer registration unfrozen", "account.setting.registration.unfreeze"},
+
+	AccountRelayCountryMappingUpdated: {"Account relay country mapping updated", "account.setting.relay.country.mapping.update"},
+
+	AccountPeerDisconnectGracePeriodUpdated: {"Account peer disconnect grace period updated", "account.setting.peer.disconnect.grace.period.update"},
+	AccountPeerExpirationToleranceUpdated:   {"Account peer expiration tolerance updated", "account.setting.peer.expiration.tolerance.update"},
+	AccountSignificantPeerMetaFieldsUpdated: {"Account significant peer meta fields updated", "account.setting.peer.meta.significant.fields.update"},
+
+	AccountPeerLimitUpdated: {"Account peer limit updated", "account.setting.peer.limit.update"},
+
+	AccountPeerExpirationDefaultsUpdated: {"Account new peer expiration defaults updated", "account.setting.peer.expiration.defaults.update"},
+
+	PeerPendingApproval: {"Peer pending approval", "peer.approval.pending"},
+	PeerRejected:        {"Peer rejected", "peer.approval.reject"},
+
+	PeerImportClaimed: {"Imported peer claimed", "peer.import.claim"},
 }
 
 // StringCode returns a string code of the activity
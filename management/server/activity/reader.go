@@ -0,0 +1,69 @@
+package activity
+
+import (
+	"context"
+	"time"
+)
+
+// EventCursor is the position of an event in the events ordered ascending by their timestamp and ID
+type EventCursor struct {
+	Timestamp time.Time
+	ID        uint64
+}
+
+// EventsPageFunc returns "limit" number of events following the "after" cursor, or the first events when it is nil
+type EventsPageFunc func(ctx context.Context, after *EventCursor, limit int) ([]*Event, error)
+
+// EventsReader reads events page by page so that large event logs can be consumed without loading them at once.
+// Pages are read with a cursor on the last read event, so events stored while reading don't shift the pages
+type EventsReader struct {
+	fetch    EventsPageFunc
+	pageSize int
+	after    *EventCursor
+	keep     func(event *Event) bool
+}
+
+// NewEventsReader returns an EventsReader fetching pages of pageSize events with the given function
+func NewEventsReader(pageSize int, fetch EventsPageFunc) *EventsReader {
+	return &EventsReader{
+		fetch:    fetch,
+		pageSize: pageSize,
+	}
+}
+
+// WithFilter makes the reader skip the events for which keep returns false
+func (r *EventsReader) WithFilter(keep func(event *Event) bool) *EventsReader {
+	r.keep = keep
+	return r
+}
+
+// Next returns the next page of events. An empty page is returned once all events have been read, a later call
+// returns the events stored in the meantime. With a filter set, a page can hold fewer events than the page size.
+func (r *EventsReader) Next(ctx context.Context) ([]*Event, error) {
+	for {
+		events, err := r.fetch(ctx, r.after, r.pageSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) == 0 {
+			return events, nil
+		}
+
+		last := events[len(events)-1]
+		r.after = &EventCursor{Timestamp: last.Timestamp, ID: last.ID}
+
+		if r.keep == nil {
+			return events, nil
+		}
+
+		kept := make([]*Event, 0, len(events))
+		for _, event := range events {
+			if r.keep(event) {
+				kept = append(kept, event)
+			}
+		}
+		if len(kept) > 0 {
+			return kept, nil
+		}
+	}
+}
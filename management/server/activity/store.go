@@ -3,14 +3,20 @@ package activity
 import (
 	"context"
 	"sync"
+	"time"
 )
 
 // Store provides an interface to store or stream events.
 type Store interface {
 	// Save an event in the store
 	Save(ctx context.Context, event *Event) (*Event, error)
+	// SaveBatch saves multiple events in the store with a single write
+	SaveBatch(ctx context.Context, events []*Event) error
 	// Get returns "limit" number of events from the "offset" index ordered descending or ascending by a timestamp
 	Get(ctx context.Context, accountID string, offset, limit int, descending bool) ([]*Event, error)
+	// GetFrom returns "limit" number of events not older than "from" ordered ascending by a timestamp and ID,
+	// following the "after" cursor when it is set
+	GetFrom(ctx context.Context, accountID string, from time.Time, after *EventCursor, limit int) ([]*Event, error)
 	// Close the sink flushing events if necessary
 	Close(ctx context.Context) error
 }
@@ -35,6 +41,16 @@ func (store *InMemoryEventStore) Save(_ context.Context, event *Event) (*Event,
 	return event, nil
 }
 
+// SaveBatch sets the Event.ID of every event, same as Save
+func (store *InMemoryEventStore) SaveBatch(ctx context.Context, events []*Event) error {
+	for _, event := range events {
+		if _, err := store.Save(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Get returns a list of ALL events that belong to the given accountID without taking offset, limit and order into consideration
 func (store *InMemoryEventStore) Get(_ context.Context, accountID string, offset, limit int, descending bool) ([]*Event, error) {
 	store.mu.Lock()
@@ -48,6 +64,28 @@ func (store *InMemoryEventStore) Get(_ context.Context, accountID string, offset
 	return events, nil
 }
 
+// GetFrom returns the events of the given accountID not older than "from" and following the "after" cursor,
+// applying the limit in the order the events were saved
+func (store *InMemoryEventStore) GetFrom(_ context.Context, accountID string, from time.Time, after *EventCursor, limit int) ([]*Event, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	events := make([]*Event, 0)
+	for _, event := range store.events {
+		if event.AccountID != accountID || event.Timestamp.Before(from) {
+			continue
+		}
+		if after != nil && (event.Timestamp.Before(after.Timestamp) || event.Timestamp.Equal(after.Timestamp) && event.ID <= after.ID) {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	if limit < len(events) {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
 // Close cleans up the event list
 func (store *InMemoryEventStore) Close(_ context.Context) error {
 	store.mu.Lock()
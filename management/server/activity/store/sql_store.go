@@ -33,6 +33,10 @@ const (
 	storeEngineEnv     = "NB_ACTIVITY_EVENT_STORE_ENGINE"
 	postgresDsnEnv     = "NB_ACTIVITY_EVENT_POSTGRES_DSN"
 	sqlMaxOpenConnsEnv = "NB_SQL_MAX_OPEN_CONNS"
+	saveBatchSizeEnv   = "NB_ACTIVITY_EVENT_SAVE_BATCH_SIZE"
+
+	// defaultSaveBatchSize is the number of events inserted per statement by SaveBatch
+	defaultSaveBatchSize = 100
 )
 
 type eventWithNames struct {
@@ -47,6 +51,8 @@ type eventWithNames struct {
 type Store struct {
 	db           *gorm.DB
 	fieldEncrypt *crypt.FieldEncrypt
+	// saveBatchSize is the number of events inserted per statement by SaveBatch
+	saveBatchSize int
 }
 
 // NewSqlStore creates a new Store with an event table if not exists.
@@ -71,9 +77,15 @@ func NewSqlStore(ctx context.Context, dataDir string, encryptionKey string) (*St
 		return nil, fmt.Errorf("events auto migrate: %w", err)
 	}
 
+	saveBatchSize, err := strconv.Atoi(os.Getenv(saveBatchSizeEnv))
+	if err != nil || saveBatchSize <= 0 {
+		saveBatchSize = defaultSaveBatchSize
+	}
+
 	return &Store{
-		db:           db,
-		fieldEncrypt: fieldEncrypt,
+		db:            db,
+		fieldEncrypt:  fieldEncrypt,
+		saveBatchSize: saveBatchSize,
 	}, nil
 }
 
@@ -139,24 +151,13 @@ func (store *Store) processResult(ctx context.Context, events []*eventWithNames)
 
 // Get returns "limit" number of events from index ordered descending or ascending by a timestamp
 func (store *Store) Get(ctx context.Context, accountID string, offset, limit int, descending bool) ([]*activity.Event, error) {
-	baseQuery := store.db.Model(&activity.Event{}).
-		Select(`
-      events.*,
-      u.name  AS initiator_name,
-      u.email AS initiator_email,
-      t.name  AS target_name,
-      t.email AS target_email
-    `).
-		Joins(`LEFT JOIN deleted_users u ON u.id = events.initiator_id`).
-		Joins(`LEFT JOIN deleted_users t ON t.id = events.target_id`)
-
 	orderDir := "DESC"
 	if !descending {
 		orderDir = "ASC"
 	}
 
 	var events []*eventWithNames
-	err := baseQuery.Order("events.timestamp "+orderDir).Offset(offset).Limit(limit).
+	err := store.eventsQuery().Order("events.timestamp "+orderDir).Offset(offset).Limit(limit).
 		Find(&events, "account_id = ?", accountID).Error
 	if err != nil {
 		return nil, err
@@ -165,6 +166,38 @@ func (store *Store) Get(ctx context.Context, accountID string, offset, limit int
 	return store.processResult(ctx, events)
 }
 
+// GetFrom returns "limit" number of events not older than "from" ordered ascending by a timestamp and ID. When set,
+// only the events following the "after" cursor are returned, so that the pages are read with the index on the
+// timestamp instead of skipping an offset of rows, and stay stable while events are stored.
+func (store *Store) GetFrom(ctx context.Context, accountID string, from time.Time, after *activity.EventCursor, limit int) ([]*activity.Event, error) {
+	query := store.eventsQuery().Where("account_id = ? AND events.timestamp >= ?", accountID, from)
+	if after != nil {
+		query = query.Where("events.timestamp > ? OR (events.timestamp = ? AND events.id > ?)", after.Timestamp, after.Timestamp, after.ID)
+	}
+
+	var events []*eventWithNames
+	err := query.Order("events.timestamp ASC").Order("events.id ASC").Limit(limit).Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return store.processResult(ctx, events)
+}
+
+// eventsQuery returns the base query selecting events together with the names of deleted initiators and targets
+func (store *Store) eventsQuery() *gorm.DB {
+	return store.db.Model(&activity.Event{}).
+		Select(`
+      events.*,
+      u.name  AS initiator_name,
+      u.email AS initiator_email,
+      t.name  AS target_name,
+      t.email AS target_email
+    `).
+		Joins(`LEFT JOIN deleted_users u ON u.id = events.initiator_id`).
+		Joins(`LEFT JOIN deleted_users t ON t.id = events.target_id`)
+}
+
 // Save an event in the SQLite events table end encrypt the "email" element in meta map
 func (store *Store) Save(_ context.Context, event *activity.Event) (*activity.Event, error) {
 	eventCopy := event.Copy()
@@ -181,6 +214,26 @@ func (store *Store) Save(_ context.Context, event *activity.Event) (*activity.Ev
 	return eventCopy, nil
 }
 
+// SaveBatch saves the events in a single transaction, inserting up to saveBatchSize events per statement
+func (store *Store) SaveBatch(_ context.Context, events []*activity.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	eventCopies := make([]*activity.Event, 0, len(events))
+	for _, event := range events {
+		eventCopy := event.Copy()
+		meta, err := store.saveDeletedUserEmailAndNameInEncrypted(eventCopy)
+		if err != nil {
+			return err
+		}
+		eventCopy.Meta = meta
+		eventCopies = append(eventCopies, eventCopy)
+	}
+
+	return store.db.CreateInBatches(eventCopies, store.saveBatchSize).Error
+}
+
 // saveDeletedUserEmailAndNameInEncrypted if the meta contains email and name then store it in encrypted way and delete
 // this item from meta map
 func (store *Store) saveDeletedUserEmailAndNameInEncrypted(event *activity.Event) (map[string]any, error) {
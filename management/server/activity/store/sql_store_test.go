@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/netbirdio/netbird/management/server/activity"
 	"github.com/netbirdio/netbird/util/crypt"
@@ -56,3 +57,85 @@ func TestNewSqlStore(t *testing.T) {
 	assert.Len(t, result, 5)
 	assert.True(t, result[0].Timestamp.After(result[len(result)-1].Timestamp))
 }
+
+func TestSqlStore_SaveBatch(t *testing.T) {
+	t.Setenv(saveBatchSizeEnv, "3")
+
+	key, _ := crypt.GenerateKey()
+	store, err := NewSqlStore(context.Background(), t.TempDir(), key)
+	require.NoError(t, err)
+	defer store.Close(context.Background()) //nolint
+
+	accountID := "account_1"
+
+	var events []*activity.Event
+	for i := 0; i < 10; i++ {
+		events = append(events, &activity.Event{
+			Timestamp:   time.Now().UTC().Add(time.Duration(i) * time.Millisecond),
+			Activity:    activity.PeerRemovedByUser,
+			InitiatorID: "user_1",
+			TargetID:    "peer_" + fmt.Sprint(i),
+			AccountID:   accountID,
+			Meta:        map[string]any{"name": "peer_" + fmt.Sprint(i)},
+		})
+	}
+
+	require.NoError(t, store.SaveBatch(context.Background(), events))
+	require.NoError(t, store.SaveBatch(context.Background(), nil))
+
+	result, err := store.Get(context.Background(), accountID, 0, 20, false)
+	require.NoError(t, err)
+	require.Len(t, result, len(events))
+	for i, event := range result {
+		assert.Equal(t, events[i].TargetID, event.TargetID)
+		assert.Equal(t, events[i].Meta["name"], event.Meta["name"])
+	}
+}
+
+func TestSqlStore_GetFrom(t *testing.T) {
+	key, _ := crypt.GenerateKey()
+	store, err := NewSqlStore(context.Background(), t.TempDir(), key)
+	require.NoError(t, err)
+	defer store.Close(context.Background()) //nolint
+
+	accountID := "account_1"
+	from := time.Now().UTC()
+
+	for i := -2; i < 5; i++ {
+		_, err = store.Save(context.Background(), &activity.Event{
+			Timestamp:   from.Add(time.Duration(i) * time.Minute),
+			Activity:    activity.PeerAddedByUser,
+			InitiatorID: "user_1",
+			TargetID:    "peer_" + fmt.Sprint(i),
+			AccountID:   accountID,
+		})
+		require.NoError(t, err)
+	}
+
+	_, err = store.Save(context.Background(), &activity.Event{
+		Timestamp:   from,
+		Activity:    activity.PeerAddedByUser,
+		InitiatorID: "user_2",
+		TargetID:    "peer_other",
+		AccountID:   "account_2",
+	})
+	require.NoError(t, err)
+
+	result, err := store.GetFrom(context.Background(), accountID, from, nil, 3)
+	require.NoError(t, err)
+	require.Len(t, result, 3)
+	assert.Equal(t, "peer_0", result[0].TargetID)
+	assert.Equal(t, "peer_2", result[2].TargetID)
+
+	after := &activity.EventCursor{Timestamp: result[2].Timestamp, ID: result[2].ID}
+	result, err = store.GetFrom(context.Background(), accountID, from, after, 3)
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	assert.Equal(t, "peer_3", result[0].TargetID)
+	assert.Equal(t, "peer_4", result[1].TargetID)
+
+	after = &activity.EventCursor{Timestamp: result[1].Timestamp, ID: result[1].ID}
+	result, err = store.GetFrom(context.Background(), accountID, from, after, 3)
+	require.NoError(t, err)
+	assert.Empty(t, result)
+}
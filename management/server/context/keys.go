@@ -3,8 +3,11 @@ package context
 import "github.com/netbirdio/netbird/shared/context"
 
 const (
-	RequestIDKey = context.RequestIDKey
-	AccountIDKey = context.AccountIDKey
-	UserIDKey    = context.UserIDKey
-	PeerIDKey    = context.PeerIDKey
+	RequestIDKey     = context.RequestIDKey
+	CorrelationIDKey = context.CorrelationIDKey
+	AccountIDKey     = context.AccountIDKey
+	UserIDKey        = context.UserIDKey
+	PeerIDKey        = context.PeerIDKey
+
+	CorrelationIDHeader = context.CorrelationIDHeader
 )
@@ -16,6 +16,14 @@ import (
 	"github.com/netbirdio/netbird/shared/management/status"
 )
 
+const (
+	// eventsStreamPageSize is the number of events read from the event store at once when streaming account events
+	eventsStreamPageSize = 500
+
+	// maxPeerCountHistoryBuckets bounds the time range of the peer count history, e.g. about 83 days of hourly buckets
+	maxPeerCountHistoryBuckets = 2000
+)
+
 func isEnabled() bool {
 	response := os.Getenv("NB_EVENT_ACTIVITY_LOG_ENABLED")
 	return response == "" || response == "true"
@@ -36,19 +44,11 @@ func (am *DefaultAccountManager) GetEvents(ctx context.Context, accountID, userI
 		return nil, err
 	}
 
-	// this is a workaround for duplicate activity.UserJoined events that might occur when a user redeems invite.
-	// we will need to find a better way to handle this.
 	filtered := make([]*activity.Event, 0)
-	dups := make(map[string]struct{})
+	isDuplicate := newDuplicateEventsFilter()
 	for _, event := range events {
-		if event.Activity == activity.UserJoined {
-			key := event.TargetID + event.InitiatorID + event.AccountID + fmt.Sprint(event.Activity)
-			_, duplicate := dups[key]
-			if duplicate {
-				continue
-			} else {
-				dups[key] = struct{}{}
-			}
+		if isDuplicate(event) {
+			continue
 		}
 		filtered = append(filtered, event)
 	}
@@ -61,6 +61,114 @@ func (am *DefaultAccountManager) GetEvents(ctx context.Context, accountID, userI
 	return filtered, nil
 }
 
+// StreamAccountEvents returns a reader of the account activity events not older than "from", oldest first. The events
+// are read from the event store page by page and carry their full meta, so the log can be exported incrementally.
+func (am *DefaultAccountManager) StreamAccountEvents(ctx context.Context, accountID, userID string, from time.Time) (*activity.EventsReader, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Events, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	isDuplicate := newDuplicateEventsFilter()
+	return activity.NewEventsReader(eventsStreamPageSize, func(ctx context.Context, after *activity.EventCursor, limit int) ([]*activity.Event, error) {
+		events, err := am.eventStore.GetFrom(ctx, accountID, from, after, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = am.fillEventsWithUserInfo(ctx, events, accountID, userID); err != nil {
+			return nil, err
+		}
+		return events, nil
+	}).WithFilter(func(event *activity.Event) bool {
+		return !isDuplicate(event)
+	}), nil
+}
+
+// newDuplicateEventsFilter returns a function reporting the events already seen by it that are duplicates.
+// this is a workaround for duplicate activity.UserJoined events that might occur when a user redeems invite.
+// we will need to find a better way to handle this.
+func newDuplicateEventsFilter() func(event *activity.Event) bool {
+	seen := make(map[string]struct{})
+	return func(event *activity.Event) bool {
+		if event.Activity != activity.UserJoined {
+			return false
+		}
+
+		key := event.TargetID + event.InitiatorID + event.AccountID + fmt.Sprint(event.Activity)
+		if _, duplicate := seen[key]; duplicate {
+			return true
+		}
+		seen[key] = struct{}{}
+		return false
+	}
+}
+
+// GetPeerCountHistory returns the number of peers added to and removed from the account between "from" and "to",
+// grouped by hour or day. The counts are derived from the stored activity events, so the peers added or removed while
+// the activity log was disabled aren't counted. The buckets are aligned to UTC and returned oldest first, including the
+// buckets without changes
+func (am *DefaultAccountManager) GetPeerCountHistory(ctx context.Context, accountID, userID string, from, to time.Time, bucket types.PeerCountHistoryBucket) ([]*types.PeerCountDelta, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Events, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	bucketSize := bucket.Duration()
+	if bucketSize == 0 {
+		return nil, status.Errorf(status.InvalidArgument, "unsupported peer count history bucket %q", bucket)
+	}
+
+	if !from.Before(to) {
+		return nil, status.Errorf(status.InvalidArgument, "the start of the peer count history must be before its end")
+	}
+
+	start := from.UTC().Truncate(bucketSize)
+	bucketsCount := int((to.Sub(start) + bucketSize - 1) / bucketSize)
+	if bucketsCount > maxPeerCountHistoryBuckets {
+		return nil, status.Errorf(status.InvalidArgument, "the peer count history can't span more than %d buckets", maxPeerCountHistoryBuckets)
+	}
+
+	history := make([]*types.PeerCountDelta, 0, bucketsCount)
+	for i := 0; i < bucketsCount; i++ {
+		history = append(history, &types.PeerCountDelta{Start: start.Add(time.Duration(i) * bucketSize)})
+	}
+
+	reader := activity.NewEventsReader(eventsStreamPageSize, func(ctx context.Context, after *activity.EventCursor, limit int) ([]*activity.Event, error) {
+		return am.eventStore.GetFrom(ctx, accountID, from, after, limit)
+	})
+
+	for {
+		events, err := reader.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) == 0 {
+			return history, nil
+		}
+
+		for _, event := range events {
+			if !event.Timestamp.Before(to) {
+				return history, nil
+			}
+
+			delta := history[int(event.Timestamp.Sub(start)/bucketSize)]
+			switch event.Activity {
+			case activity.PeerAddedByUser, activity.PeerAddedWithSetupKey, activity.PeerTransferredIn:
+				delta.Added++
+			case activity.PeerRemovedByUser, activity.PeerTransferredOut:
+				delta.Removed++
+			}
+		}
+	}
+}
+
 func (am *DefaultAccountManager) StoreEvent(ctx context.Context, initiatorID, targetID, accountID string, activityID activity.ActivityDescriber, meta map[string]any) {
 	if isEnabled() {
 		go func() {
@@ -80,6 +188,24 @@ func (am *DefaultAccountManager) StoreEvent(ctx context.Context, initiatorID, ta
 	}
 }
 
+// storeEvents stores multiple events with a single write, e.g. the events of a bulk deletion
+func (am *DefaultAccountManager) storeEvents(ctx context.Context, events []*activity.Event) {
+	if !isEnabled() || len(events) == 0 {
+		return
+	}
+
+	timestamp := time.Now().UTC()
+	for _, event := range events {
+		event.Timestamp = timestamp
+	}
+
+	go func() {
+		if err := am.eventStore.SaveBatch(ctx, events); err != nil {
+			log.WithContext(ctx).Errorf("received an error while storing %d activity events, error: %s", len(events), err)
+		}
+	}()
+}
+
 type eventUserInfo struct {
 	email     string
 	name      string
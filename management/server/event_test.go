@@ -6,8 +6,10 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/netbirdio/netbird/management/server/activity"
+	"github.com/netbirdio/netbird/management/server/types"
 )
 
 func generateAndStoreEvents(t *testing.T, manager *DefaultAccountManager, typ activity.Activity, initiatorID, targetID,
@@ -65,3 +67,129 @@ func TestDefaultAccountManager_GetEvents(t *testing.T) {
 		_ = manager.eventStore.Close(context.Background()) //nolint
 	})
 }
+
+func TestDefaultAccountManager_StreamAccountEvents(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	_, err = createAccount(manager, accountID, userID, "domain.com")
+	require.NoError(t, err)
+	_, err = createAccount(manager, "otheraccount", "otheruser", "other.com")
+	require.NoError(t, err)
+
+	from := time.Now().UTC()
+	saveEvent := func(typ activity.Activity, timestamp time.Time, meta map[string]any) {
+		_, err := manager.eventStore.Save(context.Background(), &activity.Event{
+			Timestamp:   timestamp,
+			Activity:    typ,
+			InitiatorID: userID,
+			TargetID:    "peer",
+			AccountID:   accountID,
+			Meta:        meta,
+		})
+		require.NoError(t, err)
+	}
+
+	saveEvent(activity.PeerAddedByUser, from.Add(-time.Hour), nil)
+	saveEvent(activity.PeerAddedByUser, from, map[string]any{"name": "peer1"})
+	saveEvent(activity.PeerRenamed, from.Add(time.Second), map[string]any{"old_name": "peer1", "new_name": "peer2"})
+
+	_, err = manager.StreamAccountEvents(context.Background(), accountID, "otheruser", from)
+	require.Error(t, err, "user of another account must not stream the events")
+
+	reader, err := manager.StreamAccountEvents(context.Background(), accountID, userID, from)
+	require.NoError(t, err)
+
+	events, err := reader.Next(context.Background())
+	require.NoError(t, err)
+	require.Len(t, events, 2, "events older than from must be skipped")
+	assert.Equal(t, activity.PeerAddedByUser, events[0].Activity)
+	assert.Equal(t, activity.PeerRenamed, events[1].Activity)
+	assert.Equal(t, "peer2", events[1].Meta["new_name"])
+
+	events, err = reader.Next(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	saveEvent(activity.PeerSSHEnabled, from.Add(2*time.Second), nil)
+
+	events, err = reader.Next(context.Background())
+	require.NoError(t, err)
+	require.Len(t, events, 1, "events stored after the end was reached must be returned")
+	assert.Equal(t, activity.PeerSSHEnabled, events[0].Activity)
+
+	saveEvent(activity.UserJoined, from.Add(3*time.Second), nil)
+	saveEvent(activity.UserJoined, from.Add(3*time.Second), nil)
+
+	events, err = reader.Next(context.Background())
+	require.NoError(t, err)
+	require.Len(t, events, 1, "duplicate user joined events must be skipped")
+	assert.Equal(t, activity.UserJoined, events[0].Activity)
+}
+
+func TestDefaultAccountManager_GetPeerCountHistory(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	_, err = createAccount(manager, accountID, userID, "domain.com")
+	require.NoError(t, err)
+	_, err = createAccount(manager, "otheraccount", "otheruser", "other.com")
+	require.NoError(t, err)
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	saveEvent := func(accountID string, typ activity.Activity, timestamp time.Time) {
+		_, err := manager.eventStore.Save(context.Background(), &activity.Event{
+			Timestamp:   timestamp,
+			Activity:    typ,
+			InitiatorID: userID,
+			TargetID:    "peer",
+			AccountID:   accountID,
+		})
+		require.NoError(t, err)
+	}
+
+	saveEvent(accountID, activity.PeerAddedByUser, day.Add(-time.Minute))
+	saveEvent(accountID, activity.PeerAddedByUser, day.Add(10*time.Minute))
+	saveEvent(accountID, activity.PeerAddedWithSetupKey, day.Add(50*time.Minute))
+	saveEvent(accountID, activity.PeerRenamed, day.Add(55*time.Minute))
+	saveEvent(accountID, activity.PeerRemovedByUser, day.Add(2*time.Hour+time.Minute))
+	saveEvent(accountID, activity.PeerTransferredIn, day.Add(26*time.Hour))
+	saveEvent(accountID, activity.PeerTransferredOut, day.Add(27*time.Hour))
+	saveEvent(accountID, activity.PeerAddedByUser, day.Add(48*time.Hour))
+	saveEvent("otheraccount", activity.PeerAddedByUser, day.Add(time.Hour))
+
+	_, err = manager.GetPeerCountHistory(context.Background(), accountID, "otheruser", day, day.Add(48*time.Hour), types.PeerCountHistoryBucketDay)
+	require.Error(t, err, "user of another account must not read the history")
+
+	t.Run("daily", func(t *testing.T) {
+		history, err := manager.GetPeerCountHistory(context.Background(), accountID, userID, day, day.Add(48*time.Hour), types.PeerCountHistoryBucketDay)
+		require.NoError(t, err)
+		assert.Equal(t, []*types.PeerCountDelta{
+			{Start: day, Added: 2, Removed: 1},
+			{Start: day.Add(24 * time.Hour), Added: 1, Removed: 1},
+		}, history)
+	})
+
+	t.Run("hourly", func(t *testing.T) {
+		history, err := manager.GetPeerCountHistory(context.Background(), accountID, userID, day.Add(5*time.Minute), day.Add(3*time.Hour), types.PeerCountHistoryBucketHour)
+		require.NoError(t, err)
+		assert.Equal(t, []*types.PeerCountDelta{
+			{Start: day, Added: 2},
+			{Start: day.Add(time.Hour)},
+			{Start: day.Add(2 * time.Hour), Removed: 1},
+		}, history)
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		_, err := manager.GetPeerCountHistory(context.Background(), accountID, userID, day, day.Add(time.Hour), "week")
+		assert.Error(t, err)
+
+		_, err = manager.GetPeerCountHistory(context.Background(), accountID, userID, day, day, types.PeerCountHistoryBucketDay)
+		assert.Error(t, err)
+
+		_, err = manager.GetPeerCountHistory(context.Background(), accountID, userID, day, day.AddDate(1, 0, 0), types.PeerCountHistoryBucketHour)
+		assert.Error(t, err)
+	})
+}
@@ -9,15 +9,19 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/oschwald/maxminddb-golang"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/shared/management/status"
 )
 
 type Geolocation interface {
 	Lookup(ip net.IP) (*Record, error)
 	GetAllCountries() ([]Country, error)
 	GetCitiesByCountry(countryISOCode string) ([]City, error)
+	DatabaseInfo() (*DatabaseInfo, error)
 	Stop() error
 }
 
@@ -44,11 +48,27 @@ type Record struct {
 		GeonameID uint   `maxminddb:"geoname_id"`
 		ISOCode   string `maxminddb:"iso_code"`
 	} `maxminddb:"country"`
+	// Subdivisions are ordered from the largest to the smallest, e.g. state before county
+	Subdivisions []struct {
+		GeonameID uint   `maxminddb:"geoname_id"`
+		ISOCode   string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+}
+
+// SubdivisionCode returns the ISO 3166-2 code of the largest subdivision of the record, e.g. US-CA,
+// or an empty string when the record has no subdivision
+func (r *Record) SubdivisionCode() string {
+	if len(r.Subdivisions) == 0 {
+		return ""
+	}
+	return subdivisionCode(r.Country.ISOCode, r.Subdivisions[0].ISOCode)
 }
 
 type City struct {
 	GeoNameID int `gorm:"column:geoname_id"`
 	CityName  string
+	// SubdivisionCode is the ISO 3166-2 code of the region of the city, e.g. US-CA. Empty when unknown
+	SubdivisionCode string `gorm:"column:subdivision_1_iso_code"`
 }
 
 type Country struct {
@@ -56,6 +76,16 @@ type Country struct {
 	CountryName    string
 }
 
+// DatabaseInfo holds the build and version metadata of the geolocation databases in use
+type DatabaseInfo struct {
+	// MMDBBuildTime is the build time of the MaxMind database
+	MMDBBuildTime time.Time
+	// MMDBType is the type of the MaxMind database, e.g. GeoLite2-City
+	MMDBType string
+	// GeoNamesSnapshotDate is the date of the geonames database snapshot, zero when it can't be determined
+	GeoNamesSnapshotDate time.Time
+}
+
 const (
 	mmdbPattern       = "GeoLite2-City_*.mmdb"
 	geonamesdbPattern = "geonames_*.db"
@@ -165,6 +195,22 @@ func (gl *geolocationImpl) GetCitiesByCountry(countryISOCode string) ([]City, er
 	return cities, nil
 }
 
+// DatabaseInfo returns the build and version metadata of the open geolocation databases
+func (gl *geolocationImpl) DatabaseInfo() (*DatabaseInfo, error) {
+	gl.mux.RLock()
+	defer gl.mux.RUnlock()
+
+	if gl.db == nil {
+		return nil, status.Errorf(status.PreconditionFailed, "geo location database is not initialized")
+	}
+
+	return &DatabaseInfo{
+		MMDBBuildTime:        time.Unix(int64(gl.db.Metadata.BuildEpoch), 0).UTC(),
+		MMDBType:             gl.db.Metadata.DatabaseType,
+		GeoNamesSnapshotDate: gl.locationDB.snapshotDate(),
+	}, nil
+}
+
 func (gl *geolocationImpl) Stop() error {
 	close(gl.stopCh)
 	if gl.db != nil {
@@ -267,6 +313,14 @@ func cleanupMaxMindDatabases(ctx context.Context, dataDir string, mmdbFile strin
 	return nil
 }
 
+// subdivisionCode joins the country and subdivision ISO codes into an ISO 3166-2 code
+func subdivisionCode(countryISOCode string, subdivisionISOCode string) string {
+	if countryISOCode == "" || subdivisionISOCode == "" {
+		return ""
+	}
+	return countryISOCode + "-" + subdivisionISOCode
+}
+
 type Mock struct{}
 
 func (g *Mock) Lookup(ip net.IP) (*Record, error) {
@@ -281,6 +335,10 @@ func (g *Mock) GetCitiesByCountry(countryISOCode string) ([]City, error) {
 	return []City{}, nil
 }
 
+func (g *Mock) DatabaseInfo() (*DatabaseInfo, error) {
+	return &DatabaseInfo{}, nil
+}
+
 func (g *Mock) Stop() error {
 	return nil
 }
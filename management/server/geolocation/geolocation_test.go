@@ -44,6 +44,7 @@ func TestGeoLite_Lookup(t *testing.T) {
 	assert.Equal(t, uint(2661886), record.Country.GeonameID)
 	assert.Equal(t, "Linköping", record.City.Names.En)
 	assert.Equal(t, uint(2694762), record.City.GeonameID)
+	assert.Equal(t, "SE-E", record.SubdivisionCode())
 	assert.Equal(t, "EU", record.Continent.Code)
 	assert.Equal(t, uint(6255148), record.Continent.GeonameID)
 }
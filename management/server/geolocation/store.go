@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
@@ -92,7 +93,7 @@ func (s *SqliteStore) GetCitiesByCountry(countryISOCode string) ([]City, error)
 
 	var cities []City
 	result := s.db.Model(&GeoNames{}).
-		Select("geoname_id", "city_name").
+		Select("geoname_id", "city_name", "subdivision_1_iso_code").
 		Where("country_iso_code = ?", countryISOCode).
 		Group("city_name").
 		Scan(&cities)
@@ -100,6 +101,11 @@ func (s *SqliteStore) GetCitiesByCountry(countryISOCode string) ([]City, error)
 		return nil, result.Error
 	}
 
+	// the geonames DB stores the subdivision code without the country prefix
+	for i := range cities {
+		cities[i].SubdivisionCode = subdivisionCode(countryISOCode, cities[i].SubdivisionCode)
+	}
+
 	return cities, nil
 }
 
@@ -114,6 +120,22 @@ func (s *SqliteStore) close() error {
 	return sqlDB.Close()
 }
 
+// snapshotDate returns the date of the geonames snapshot taken from the database file name, e.g. geonames_20240305.db,
+// or a zero time when the name has no date
+func (s *SqliteStore) snapshotDate() time.Time {
+	basename := strings.TrimSuffix(filepath.Base(s.filePath), filepath.Ext(s.filePath))
+	_, date, found := strings.Cut(basename, "_")
+	if !found {
+		return time.Time{}
+	}
+
+	snapshotDate, err := time.Parse("20060102", date)
+	if err != nil {
+		return time.Time{}
+	}
+	return snapshotDate
+}
+
 // connectDB connects to an SQLite database and prepares it by setting up an in-memory database.
 func connectDB(ctx context.Context, filePath string) (*gorm.DB, error) {
 	start := time.Now()
@@ -12,6 +12,7 @@ import (
 	nbdns "github.com/netbirdio/netbird/dns"
 	"github.com/netbirdio/netbird/management/server/activity"
 	routerTypes "github.com/netbirdio/netbird/management/server/networks/routers/types"
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
 	"github.com/netbirdio/netbird/management/server/permissions/modules"
 	"github.com/netbirdio/netbird/management/server/permissions/operations"
 	"github.com/netbirdio/netbird/management/server/store"
@@ -113,6 +114,10 @@ func (am *DefaultAccountManager) CreateGroup(ctx context.Context, accountID, use
 		storeEvent()
 	}
 
+	if newGroup.PeerLoginExpiration > 0 && len(newGroup.Peers) > 0 {
+		am.reschedulePeerLoginExpiration(ctx, accountID)
+	}
+
 	if updateAccountPeers {
 		am.UpdateAccountPeers(ctx, accountID)
 	}
@@ -132,6 +137,7 @@ func (am *DefaultAccountManager) UpdateGroup(ctx context.Context, accountID, use
 
 	var eventsToStore []func()
 	var updateAccountPeers bool
+	var expirationChanged bool
 
 	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
 		if err = validateNewGroup(ctx, transaction, accountID, newGroup); err != nil {
@@ -151,6 +157,9 @@ func (am *DefaultAccountManager) UpdateGroup(ctx context.Context, accountID, use
 		peersToAdd := util.Difference(newGroup.Peers, oldGroup.Peers)
 		peersToRemove := util.Difference(oldGroup.Peers, newGroup.Peers)
 
+		expirationChanged = oldGroup.PeerLoginExpiration != newGroup.PeerLoginExpiration ||
+			(newGroup.PeerLoginExpiration > 0 && len(peersToAdd) > 0)
+
 		for _, peerID := range peersToAdd {
 			if err := transaction.AddPeerToGroup(ctx, accountID, peerID, newGroup.ID); err != nil {
 				return status.Errorf(status.Internal, "failed to add peer %s to group %s: %v", peerID, newGroup.ID, err)
@@ -181,6 +190,10 @@ func (am *DefaultAccountManager) UpdateGroup(ctx context.Context, accountID, use
 		storeEvent()
 	}
 
+	if expirationChanged {
+		am.reschedulePeerLoginExpiration(ctx, accountID)
+	}
+
 	if updateAccountPeers {
 		am.UpdateAccountPeers(ctx, accountID)
 	}
@@ -188,6 +201,23 @@ func (am *DefaultAccountManager) UpdateGroup(ctx context.Context, accountID, use
 	return nil
 }
 
+// reschedulePeerLoginExpiration restarts the peer login expiration job of the account after a group
+// login expiration override changed, as the next peer may now expire sooner
+func (am *DefaultAccountManager) reschedulePeerLoginExpiration(ctx context.Context, accountID string) {
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		log.WithContext(ctx).Errorf("failed to get account settings: %v", err)
+		return
+	}
+
+	if !settings.PeerLoginExpirationEnabled {
+		return
+	}
+
+	am.peerLoginExpiry.Cancel(ctx, []string{accountID})
+	am.schedulePeerLoginExpiration(ctx, accountID)
+}
+
 // CreateGroups adds new groups to the account.
 // Note: This function does not acquire the global lock.
 // It is the caller's responsibility to ensure proper locking is in place before invoking this method.
@@ -557,6 +587,124 @@ func (am *DefaultAccountManager) GroupDeletePeer(ctx context.Context, accountID,
 	return nil
 }
 
+// RemovePeersFromGroups removes the given peers from the given groups in a single transaction and returns the
+// number of group memberships that were removed. Peers can't be removed from the All group as it is system-managed.
+func (am *DefaultAccountManager) RemovePeersFromGroups(ctx context.Context, accountID, userID string, peerIDs, groupIDs []string) (int, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Groups, operations.Update)
+	if err != nil {
+		return 0, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return 0, status.NewPermissionDeniedError()
+	}
+
+	var removed int
+	var updateAccountPeers bool
+	var eventsToStore []func()
+
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		removed = 0
+		eventsToStore = nil
+
+		peers, groups, err := validatePeersGroupsMembershipChange(ctx, transaction, accountID, peerIDs, groupIDs)
+		if err != nil {
+			return err
+		}
+
+		settings, err := transaction.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+		if err != nil {
+			return err
+		}
+		dnsDomain := am.networkMapController.GetDNSDomain(settings)
+
+		var changedGroupIDs []string
+		for _, group := range groups {
+			var groupChanged bool
+			for _, peerID := range group.Peers {
+				peer, ok := peers[peerID]
+				if !ok {
+					continue
+				}
+
+				if err = transaction.RemovePeerFromGroup(ctx, peerID, group.ID); err != nil {
+					return err
+				}
+				removed++
+				groupChanged = true
+
+				meta := map[string]any{
+					"group": group.Name, "group_id": group.ID,
+					"peer_ip": peer.IP.String(), "peer_fqdn": peer.FQDN(dnsDomain),
+				}
+				eventsToStore = append(eventsToStore, func() {
+					am.StoreEvent(ctx, userID, peer.ID, accountID, activity.GroupRemovedFromPeer, meta)
+				})
+			}
+			if groupChanged {
+				changedGroupIDs = append(changedGroupIDs, group.ID)
+			}
+		}
+
+		if removed == 0 {
+			return nil
+		}
+
+		updateAccountPeers, err = areGroupChangesAffectPeers(ctx, transaction, accountID, changedGroupIDs)
+		if err != nil {
+			return err
+		}
+
+		return transaction.IncrementNetworkSerial(ctx, accountID)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, storeEvent := range eventsToStore {
+		storeEvent()
+	}
+
+	if updateAccountPeers {
+		am.BufferUpdateAccountPeers(ctx, accountID)
+	}
+
+	return removed, nil
+}
+
+// validatePeersGroupsMembershipChange validates a bulk group membership change. All peers and groups must exist in
+// the account and the All group can't be part of the change.
+func validatePeersGroupsMembershipChange(ctx context.Context, transaction store.Store, accountID string, peerIDs, groupIDs []string) (map[string]*nbpeer.Peer, map[string]*types.Group, error) {
+	if len(peerIDs) == 0 || len(groupIDs) == 0 {
+		return nil, nil, status.Errorf(status.InvalidArgument, "at least one peer and one group must be provided")
+	}
+
+	peers, err := transaction.GetPeersByIDs(ctx, store.LockingStrengthNone, accountID, peerIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, peerID := range peerIDs {
+		if _, ok := peers[peerID]; !ok {
+			return nil, nil, status.Errorf(status.NotFound, "peer %s not found", peerID)
+		}
+	}
+
+	groups, err := transaction.GetGroupsByIDs(ctx, store.LockingStrengthUpdate, accountID, groupIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, groupID := range groupIDs {
+		group, ok := groups[groupID]
+		if !ok {
+			return nil, nil, status.Errorf(status.NotFound, "group %s not found", groupID)
+		}
+		if group.IsGroupAll() {
+			return nil, nil, status.Errorf(status.InvalidArgument, "peers membership in the All group is managed by the system")
+		}
+	}
+
+	return peers, groups, nil
+}
+
 // GroupDeleteResource removes resource from the group
 func (am *DefaultAccountManager) GroupDeleteResource(ctx context.Context, accountID, groupID string, resource types.Resource) error {
 	var group *types.Group
@@ -601,6 +749,10 @@ func validateNewGroup(ctx context.Context, transaction store.Store, accountID st
 		return status.Errorf(status.InvalidArgument, "%s group without ID set", newGroup.Issued)
 	}
 
+	if err := validateGroupPeerLoginExpiration(newGroup); err != nil {
+		return err
+	}
+
 	if newGroup.ID == "" && newGroup.Issued == types.GroupIssuedAPI {
 		existingGroup, err := transaction.GetGroupByName(ctx, store.LockingStrengthNone, accountID, newGroup.Name)
 		if err != nil {
@@ -621,6 +773,27 @@ func validateNewGroup(ctx context.Context, transaction store.Store, accountID st
 	return nil
 }
 
+// validateGroupPeerLoginExpiration checks the group login expiration override is within the limits of the account setting
+func validateGroupPeerLoginExpiration(group *types.Group) error {
+	if group.PeerLoginExpiration == 0 {
+		return nil
+	}
+
+	if group.IsGroupAll() {
+		return status.Errorf(status.InvalidArgument, "peer login expiration can't be overridden for group All, use the account settings instead")
+	}
+
+	if group.PeerLoginExpiration > types.MaxGroupPeerLoginExpiration {
+		return status.Errorf(status.InvalidArgument, "group peer login expiration can't be larger than 180 days")
+	}
+
+	if group.PeerLoginExpiration < types.MinGroupPeerLoginExpiration {
+		return status.Errorf(status.InvalidArgument, "group peer login expiration can't be smaller than one hour")
+	}
+
+	return nil
+}
+
 func validateDeleteGroup(ctx context.Context, transaction store.Store, group *types.Group, userID string) error {
 	// disable a deleting integration group if the initiator is not an admin service user
 	if group.Issued == types.GroupIssuedIntegration {
@@ -1003,3 +1003,54 @@ func Test_IncrementNetworkSerial(t *testing.T) {
 
 	assert.Equal(t, totalPeers, int(account.Network.Serial), "Expected %d serial increases in account %s, got %d", totalPeers, accountID, account.Network.Serial)
 }
+
+func TestDefaultAccountManager_RemovePeersFromGroups(t *testing.T) {
+	manager, _, account, peer1, peer2, peer3 := setupNetworkMapTest(t)
+
+	for _, group := range []*types.Group{
+		{ID: "groupA", Name: "GroupA", Peers: []string{peer1.ID, peer2.ID}},
+		{ID: "groupB", Name: "GroupB", Peers: []string{peer1.ID, peer3.ID}},
+	} {
+		require.NoError(t, manager.CreateGroup(context.Background(), account.Id, userID, group))
+	}
+
+	groupAll, err := manager.Store.GetGroupByName(context.Background(), store.LockingStrengthNone, account.Id, "All")
+	require.NoError(t, err)
+
+	_, err = manager.RemovePeersFromGroups(context.Background(), account.Id, userID, []string{peer1.ID}, []string{"groupA", groupAll.ID})
+	require.Error(t, err, "removing peers from the All group must fail")
+
+	_, err = manager.RemovePeersFromGroups(context.Background(), account.Id, userID, []string{peer1.ID, "unknown"}, []string{"groupA"})
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.NotFound, sErr.Type())
+
+	_, err = manager.RemovePeersFromGroups(context.Background(), account.Id, userID, []string{peer1.ID}, []string{"unknown"})
+	sErr, ok = status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.NotFound, sErr.Type())
+
+	group, err := manager.GetGroup(context.Background(), account.Id, "groupA", userID)
+	require.NoError(t, err)
+	assert.Len(t, group.Peers, 2, "failed validation must not remove any membership")
+
+	removed, err := manager.RemovePeersFromGroups(context.Background(), account.Id, userID, []string{peer1.ID, peer2.ID}, []string{"groupA", "groupB"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	group, err = manager.GetGroup(context.Background(), account.Id, "groupA", userID)
+	require.NoError(t, err)
+	assert.Empty(t, group.Peers)
+
+	group, err = manager.GetGroup(context.Background(), account.Id, "groupB", userID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{peer3.ID}, group.Peers)
+
+	group, err = manager.GetGroup(context.Background(), account.Id, groupAll.ID, userID)
+	require.NoError(t, err)
+	assert.Contains(t, group.Peers, peer1.ID)
+
+	removed, err = manager.RemovePeersFromGroups(context.Background(), account.Id, userID, []string{peer1.ID, peer2.ID}, []string{"groupA", "groupB"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed, "memberships already removed must not be counted")
+}
@@ -14,7 +14,9 @@ import (
 
 	"github.com/netbirdio/netbird/management/server/account"
 	nbcontext "github.com/netbirdio/netbird/management/server/context"
+	"github.com/netbirdio/netbird/management/server/posture"
 	"github.com/netbirdio/netbird/management/server/settings"
+	"github.com/netbirdio/netbird/management/server/store"
 	"github.com/netbirdio/netbird/management/server/types"
 	"github.com/netbirdio/netbird/shared/management/http/api"
 	"github.com/netbirdio/netbird/shared/management/http/util"
@@ -101,7 +103,7 @@ func (h *handler) validateNetworkRange(ctx context.Context, accountID, userID st
 }
 
 func (h *handler) validateCapacity(ctx context.Context, accountID, userID string, prefix netip.Prefix) error {
-	peers, err := h.accountManager.GetPeers(ctx, accountID, userID, "", "")
+	peers, err := h.accountManager.GetPeers(ctx, accountID, userID, store.PeerFilters{})
 	if err != nil {
 		return status.Errorf(status.Internal, "get peer count: %v", err)
 	}
@@ -210,6 +212,23 @@ func (h *handler) updateAccountRequestSettings(req api.PutApiAccountsAccountIdJS
 	if req.Settings.LazyConnectionEnabled != nil {
 		returnSettings.LazyConnectionEnabled = *req.Settings.LazyConnectionEnabled
 	}
+	if req.Settings.ExcludeEphemeralPeersFromLimits != nil {
+		returnSettings.ExcludeEphemeralPeersFromLimits = *req.Settings.ExcludeEphemeralPeersFromLimits
+	}
+	if req.Settings.NetworkMapConnectedPeersOnly != nil {
+		returnSettings.NetworkMapConnectedPeersOnly = *req.Settings.NetworkMapConnectedPeersOnly
+	}
+	if req.Settings.RegistrationFrozen != nil {
+		returnSettings.RegistrationFrozen = *req.Settings.RegistrationFrozen
+	}
+	if req.Settings.SetupKeyPeerExpirationAllowed != nil {
+		returnSettings.SetupKeyPeerExpirationAllowed = *req.Settings.SetupKeyPeerExpirationAllowed
+	}
+	if req.Settings.SignificantPeerMetaFields != nil {
+		returnSettings.SignificantPeerMetaFields = *req.Settings.SignificantPeerMetaFields
+	}
+	returnSettings.UserPeerExpirationDefaults = toPeerExpirationDefaults(req.Settings.UserPeerExpirationDefaults)
+	returnSettings.SetupKeyPeerExpirationDefaults = toPeerExpirationDefaults(req.Settings.SetupKeyPeerExpirationDefaults)
 	if req.Settings.AutoUpdateVersion != nil {
 		_, err := goversion.NewSemver(*req.Settings.AutoUpdateVersion)
 		if *req.Settings.AutoUpdateVersion == autoUpdateLatestVersion ||
@@ -220,6 +239,66 @@ func (h *handler) updateAccountRequestSettings(req api.PutApiAccountsAccountIdJS
 			return nil, fmt.Errorf("invalid AutoUpdateVersion")
 		}
 	}
+	if req.Settings.PeerNamingTemplate != nil {
+		returnSettings.PeerNamingTemplate = *req.Settings.PeerNamingTemplate
+	}
+	if req.Settings.PeerWebhookUrl != nil {
+		returnSettings.PeerWebhookURL = *req.Settings.PeerWebhookUrl
+	}
+	if req.Settings.PeerWebhookSecret != nil {
+		returnSettings.PeerWebhookSecret = *req.Settings.PeerWebhookSecret
+	}
+	if req.Settings.PeerLoginExpirationLeadTime != nil {
+		returnSettings.PeerLoginExpirationLeadTime = time.Duration(*req.Settings.PeerLoginExpirationLeadTime) * time.Second
+	}
+	if req.Settings.PeerExpirationTolerance != nil {
+		returnSettings.PeerExpirationTolerance = time.Duration(*req.Settings.PeerExpirationTolerance) * time.Millisecond
+	}
+	if req.Settings.PeerUpdateBufferInterval != nil {
+		returnSettings.PeerUpdateBufferInterval = time.Duration(*req.Settings.PeerUpdateBufferInterval) * time.Millisecond
+	}
+	if req.Settings.PeerDisconnectGracePeriod != nil {
+		returnSettings.PeerDisconnectGracePeriod = time.Duration(*req.Settings.PeerDisconnectGracePeriod) * time.Second
+	}
+	if req.Settings.PeerUsageCap != nil {
+		returnSettings.PeerUsageCap = *req.Settings.PeerUsageCap
+	}
+	if req.Settings.PeerUsageCapWindow != nil {
+		returnSettings.PeerUsageCapWindow = time.Duration(*req.Settings.PeerUsageCapWindow) * time.Second
+	}
+	if req.Settings.PeerDnsLabelSuffix != nil {
+		returnSettings.PeerDNSLabelSuffix = types.PeerDNSLabelSuffix(*req.Settings.PeerDnsLabelSuffix)
+	}
+	if req.Settings.PeerDnsLabelMaxLength != nil {
+		returnSettings.PeerDNSLabelMaxLength = *req.Settings.PeerDnsLabelMaxLength
+	}
+	if req.Settings.PeerExtraDnsLabelsLimit != nil {
+		returnSettings.PeerExtraDNSLabelsLimit = *req.Settings.PeerExtraDnsLabelsLimit
+	}
+	if req.Settings.PeerLimit != nil {
+		returnSettings.PeerLimit = *req.Settings.PeerLimit
+	}
+	if req.Settings.BlockedPeerOwnerBehavior != nil {
+		returnSettings.BlockedPeerOwnerBehavior = types.BlockedPeerOwnerBehavior(*req.Settings.BlockedPeerOwnerBehavior)
+	}
+	if req.Settings.ReservedDnsLabels != nil {
+		returnSettings.ReservedDNSLabels = *req.Settings.ReservedDnsLabels
+	}
+	if req.Settings.ReservedDnsLabelAction != nil {
+		returnSettings.ReservedDNSLabelAction = types.ReservedDNSLabelAction(*req.Settings.ReservedDnsLabelAction)
+	}
+	if req.Settings.RelayCountryMapping != nil {
+		returnSettings.RelayCountryMapping = *req.Settings.RelayCountryMapping
+	}
+	if osVersionCheck := req.Settings.PeerRegistrationOsVersionCheck; osVersionCheck != nil {
+		returnSettings.PeerRegistrationOSVersionCheck = &posture.OSVersionCheck{
+			Android: (*posture.MinVersionCheck)(osVersionCheck.Android),
+			Darwin:  (*posture.MinVersionCheck)(osVersionCheck.Darwin),
+			Ios:     (*posture.MinVersionCheck)(osVersionCheck.Ios),
+			Linux:   (*posture.MinKernelVersionCheck)(osVersionCheck.Linux),
+			Windows: (*posture.MinKernelVersionCheck)(osVersionCheck.Windows),
+		}
+	}
 
 	return returnSettings, nil
 }
@@ -339,8 +418,15 @@ func toAccountResponse(accountID string, settings *types.Settings, meta *types.A
 		RegularUsersViewBlocked:         settings.RegularUsersViewBlocked,
 		RoutingPeerDnsResolutionEnabled: &settings.RoutingPeerDNSResolutionEnabled,
 		LazyConnectionEnabled:           &settings.LazyConnectionEnabled,
+		ExcludeEphemeralPeersFromLimits: &settings.ExcludeEphemeralPeersFromLimits,
+		NetworkMapConnectedPeersOnly:    &settings.NetworkMapConnectedPeersOnly,
+		RegistrationFrozen:              &settings.RegistrationFrozen,
+		SetupKeyPeerExpirationAllowed:   &settings.SetupKeyPeerExpirationAllowed,
+		UserPeerExpirationDefaults:      toAPIPeerExpirationDefaults(settings.UserPeerExpirationDefaults),
+		SetupKeyPeerExpirationDefaults:  toAPIPeerExpirationDefaults(settings.SetupKeyPeerExpirationDefaults),
 		DnsDomain:                       &settings.DNSDomain,
 		AutoUpdateVersion:               &settings.AutoUpdateVersion,
+		PeerNamingTemplate:              &settings.PeerNamingTemplate,
 		EmbeddedIdpEnabled:              &embeddedIdpEnabled,
 	}
 
@@ -349,6 +435,86 @@ func toAccountResponse(accountID string, settings *types.Settings, meta *types.A
 		apiSettings.NetworkRange = &networkRangeStr
 	}
 
+	if settings.PeerWebhookURL != "" {
+		apiSettings.PeerWebhookUrl = &settings.PeerWebhookURL
+	}
+
+	if settings.PeerLoginExpirationLeadTime > 0 {
+		leadTime := int(settings.PeerLoginExpirationLeadTime.Seconds())
+		apiSettings.PeerLoginExpirationLeadTime = &leadTime
+	}
+
+	if settings.PeerExpirationTolerance > 0 {
+		tolerance := int(settings.PeerExpirationTolerance.Milliseconds())
+		apiSettings.PeerExpirationTolerance = &tolerance
+	}
+
+	if settings.PeerUpdateBufferInterval > 0 {
+		bufferInterval := int(settings.PeerUpdateBufferInterval.Milliseconds())
+		apiSettings.PeerUpdateBufferInterval = &bufferInterval
+	}
+
+	if settings.PeerDisconnectGracePeriod > 0 {
+		gracePeriod := int(settings.PeerDisconnectGracePeriod.Seconds())
+		apiSettings.PeerDisconnectGracePeriod = &gracePeriod
+	}
+
+	if settings.PeerUsageCap > 0 {
+		usageCap := settings.PeerUsageCap
+		apiSettings.PeerUsageCap = &usageCap
+		usageCapWindow := int(settings.PeerUsageCapWindow.Seconds())
+		apiSettings.PeerUsageCapWindow = &usageCapWindow
+	}
+
+	if settings.PeerDNSLabelSuffix != "" {
+		labelSuffix := api.AccountSettingsPeerDnsLabelSuffix(settings.PeerDNSLabelSuffix)
+		apiSettings.PeerDnsLabelSuffix = &labelSuffix
+	}
+
+	if settings.BlockedPeerOwnerBehavior != "" {
+		blockedPeerOwnerBehavior := api.AccountSettingsBlockedPeerOwnerBehavior(settings.BlockedPeerOwnerBehavior)
+		apiSettings.BlockedPeerOwnerBehavior = &blockedPeerOwnerBehavior
+	}
+
+	if settings.PeerDNSLabelMaxLength > 0 {
+		apiSettings.PeerDnsLabelMaxLength = &settings.PeerDNSLabelMaxLength
+	}
+
+	if len(settings.ReservedDNSLabels) > 0 {
+		apiSettings.ReservedDnsLabels = &settings.ReservedDNSLabels
+	}
+
+	if settings.ReservedDNSLabelAction != "" {
+		reservedLabelAction := api.AccountSettingsReservedDnsLabelAction(settings.ReservedDNSLabelAction)
+		apiSettings.ReservedDnsLabelAction = &reservedLabelAction
+	}
+
+	if len(settings.SignificantPeerMetaFields) > 0 {
+		apiSettings.SignificantPeerMetaFields = &settings.SignificantPeerMetaFields
+	}
+
+	if len(settings.RelayCountryMapping) > 0 {
+		apiSettings.RelayCountryMapping = &settings.RelayCountryMapping
+	}
+
+	if settings.PeerExtraDNSLabelsLimit > 0 {
+		apiSettings.PeerExtraDnsLabelsLimit = &settings.PeerExtraDNSLabelsLimit
+	}
+
+	if settings.PeerLimit > 0 {
+		apiSettings.PeerLimit = &settings.PeerLimit
+	}
+
+	if osVersionCheck := settings.PeerRegistrationOSVersionCheck; osVersionCheck != nil {
+		apiSettings.PeerRegistrationOsVersionCheck = &api.OSVersionCheck{
+			Android: (*api.MinVersionCheck)(osVersionCheck.Android),
+			Darwin:  (*api.MinVersionCheck)(osVersionCheck.Darwin),
+			Ios:     (*api.MinVersionCheck)(osVersionCheck.Ios),
+			Linux:   (*api.MinKernelVersionCheck)(osVersionCheck.Linux),
+			Windows: (*api.MinKernelVersionCheck)(osVersionCheck.Windows),
+		}
+	}
+
 	apiOnboarding := api.AccountOnboarding{
 		OnboardingFlowPending: onboarding.OnboardingFlowPending,
 		SignupFormPending:     onboarding.SignupFormPending,
@@ -374,3 +540,23 @@ func toAccountResponse(accountID string, settings *types.Settings, meta *types.A
 		Onboarding:     apiOnboarding,
 	}
 }
+
+func toPeerExpirationDefaults(defaults *api.PeerExpirationDefaults) *types.PeerExpirationDefaults {
+	if defaults == nil {
+		return nil
+	}
+	return &types.PeerExpirationDefaults{
+		LoginExpirationEnabled:      defaults.LoginExpirationEnabled,
+		InactivityExpirationEnabled: defaults.InactivityExpirationEnabled,
+	}
+}
+
+func toAPIPeerExpirationDefaults(defaults *types.PeerExpirationDefaults) *api.PeerExpirationDefaults {
+	if defaults == nil {
+		return nil
+	}
+	return &api.PeerExpirationDefaults{
+		LoginExpirationEnabled:      defaults.LoginExpirationEnabled,
+		InactivityExpirationEnabled: defaults.InactivityExpirationEnabled,
+	}
+}
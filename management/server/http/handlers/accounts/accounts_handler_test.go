@@ -121,8 +121,13 @@ func TestAccounts_AccountsHandler(t *testing.T) {
 				RegularUsersViewBlocked:         true,
 				RoutingPeerDnsResolutionEnabled: br(false),
 				LazyConnectionEnabled:           br(false),
+				ExcludeEphemeralPeersFromLimits: br(false),
+				NetworkMapConnectedPeersOnly:    br(false),
+				RegistrationFrozen:              br(false),
+				SetupKeyPeerExpirationAllowed:   br(false),
 				DnsDomain:                       sr(""),
 				AutoUpdateVersion:               sr(""),
+				PeerNamingTemplate:              sr(""),
 				EmbeddedIdpEnabled:              br(false),
 			},
 			expectedArray: true,
@@ -145,8 +150,13 @@ func TestAccounts_AccountsHandler(t *testing.T) {
 				RegularUsersViewBlocked:         false,
 				RoutingPeerDnsResolutionEnabled: br(false),
 				LazyConnectionEnabled:           br(false),
+				ExcludeEphemeralPeersFromLimits: br(false),
+				NetworkMapConnectedPeersOnly:    br(false),
+				RegistrationFrozen:              br(false),
+				SetupKeyPeerExpirationAllowed:   br(false),
 				DnsDomain:                       sr(""),
 				AutoUpdateVersion:               sr(""),
+				PeerNamingTemplate:              sr(""),
 				EmbeddedIdpEnabled:              br(false),
 			},
 			expectedArray: false,
@@ -169,8 +179,13 @@ func TestAccounts_AccountsHandler(t *testing.T) {
 				RegularUsersViewBlocked:         false,
 				RoutingPeerDnsResolutionEnabled: br(false),
 				LazyConnectionEnabled:           br(false),
+				ExcludeEphemeralPeersFromLimits: br(false),
+				NetworkMapConnectedPeersOnly:    br(false),
+				RegistrationFrozen:              br(false),
+				SetupKeyPeerExpirationAllowed:   br(false),
 				DnsDomain:                       sr(""),
 				AutoUpdateVersion:               sr("latest"),
+				PeerNamingTemplate:              sr(""),
 				EmbeddedIdpEnabled:              br(false),
 			},
 			expectedArray: false,
@@ -193,8 +208,13 @@ func TestAccounts_AccountsHandler(t *testing.T) {
 				RegularUsersViewBlocked:         true,
 				RoutingPeerDnsResolutionEnabled: br(false),
 				LazyConnectionEnabled:           br(false),
+				ExcludeEphemeralPeersFromLimits: br(false),
+				NetworkMapConnectedPeersOnly:    br(false),
+				RegistrationFrozen:              br(false),
+				SetupKeyPeerExpirationAllowed:   br(false),
 				DnsDomain:                       sr(""),
 				AutoUpdateVersion:               sr(""),
+				PeerNamingTemplate:              sr(""),
 				EmbeddedIdpEnabled:              br(false),
 			},
 			expectedArray: false,
@@ -217,8 +237,13 @@ func TestAccounts_AccountsHandler(t *testing.T) {
 				RegularUsersViewBlocked:         true,
 				RoutingPeerDnsResolutionEnabled: br(false),
 				LazyConnectionEnabled:           br(false),
+				ExcludeEphemeralPeersFromLimits: br(false),
+				NetworkMapConnectedPeersOnly:    br(false),
+				RegistrationFrozen:              br(false),
+				SetupKeyPeerExpirationAllowed:   br(false),
 				DnsDomain:                       sr(""),
 				AutoUpdateVersion:               sr(""),
+				PeerNamingTemplate:              sr(""),
 				EmbeddedIdpEnabled:              br(false),
 			},
 			expectedArray: false,
@@ -241,8 +266,13 @@ func TestAccounts_AccountsHandler(t *testing.T) {
 				RegularUsersViewBlocked:         true,
 				RoutingPeerDnsResolutionEnabled: br(false),
 				LazyConnectionEnabled:           br(false),
+				ExcludeEphemeralPeersFromLimits: br(false),
+				NetworkMapConnectedPeersOnly:    br(false),
+				RegistrationFrozen:              br(false),
+				SetupKeyPeerExpirationAllowed:   br(false),
 				DnsDomain:                       sr(""),
 				AutoUpdateVersion:               sr(""),
+				PeerNamingTemplate:              sr(""),
 				EmbeddedIdpEnabled:              br(false),
 			},
 			expectedArray: false,
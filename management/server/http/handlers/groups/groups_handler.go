@@ -3,6 +3,7 @@ package groups
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
@@ -10,6 +11,7 @@ import (
 	"github.com/netbirdio/netbird/management/server/account"
 	nbcontext "github.com/netbirdio/netbird/management/server/context"
 	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/management/server/store"
 
 	"github.com/netbirdio/netbird/management/server/types"
 	"github.com/netbirdio/netbird/shared/management/http/api"
@@ -58,7 +60,7 @@ func (h *handler) getAllGroups(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		accountPeers, err := h.accountManager.GetPeers(r.Context(), accountID, userID, "", "")
+		accountPeers, err := h.accountManager.GetPeers(r.Context(), accountID, userID, store.PeerFilters{})
 		if err != nil {
 			util.WriteError(r.Context(), err, w)
 			return
@@ -77,7 +79,7 @@ func (h *handler) getAllGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accountPeers, err := h.accountManager.GetPeers(r.Context(), accountID, userID, "", "")
+	accountPeers, err := h.accountManager.GetPeers(r.Context(), accountID, userID, store.PeerFilters{})
 	if err != nil {
 		util.WriteError(r.Context(), err, w)
 		return
@@ -162,6 +164,7 @@ func (h *handler) updateGroup(w http.ResponseWriter, r *http.Request) {
 		Name:                 req.Name,
 		Peers:                peers,
 		Resources:            resources,
+		PeerLoginExpiration:  toPeerLoginExpiration(req.PeerLoginExpiration),
 		Issued:               existingGroup.Issued,
 		IntegrationReference: existingGroup.IntegrationReference,
 	}
@@ -172,7 +175,7 @@ func (h *handler) updateGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accountPeers, err := h.accountManager.GetPeers(r.Context(), accountID, userID, "", "")
+	accountPeers, err := h.accountManager.GetPeers(r.Context(), accountID, userID, store.PeerFilters{})
 	if err != nil {
 		util.WriteError(r.Context(), err, w)
 		return
@@ -220,10 +223,11 @@ func (h *handler) createGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	group := types.Group{
-		Name:      req.Name,
-		Peers:     peers,
-		Resources: resources,
-		Issued:    types.GroupIssuedAPI,
+		Name:                req.Name,
+		Peers:               peers,
+		Resources:           resources,
+		PeerLoginExpiration: toPeerLoginExpiration(req.PeerLoginExpiration),
+		Issued:              types.GroupIssuedAPI,
 	}
 
 	err = h.accountManager.CreateGroup(r.Context(), accountID, userID, &group)
@@ -232,7 +236,7 @@ func (h *handler) createGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accountPeers, err := h.accountManager.GetPeers(r.Context(), accountID, userID, "", "")
+	accountPeers, err := h.accountManager.GetPeers(r.Context(), accountID, userID, store.PeerFilters{})
 	if err != nil {
 		util.WriteError(r.Context(), err, w)
 		return
@@ -293,7 +297,7 @@ func (h *handler) getGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accountPeers, err := h.accountManager.GetPeers(r.Context(), accountID, userID, "", "")
+	accountPeers, err := h.accountManager.GetPeers(r.Context(), accountID, userID, store.PeerFilters{})
 	if err != nil {
 		util.WriteError(r.Context(), err, w)
 		return
@@ -303,6 +307,14 @@ func (h *handler) getGroup(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// toPeerLoginExpiration converts the group login expiration override from seconds, a missing value disables the override
+func toPeerLoginExpiration(seconds *int) time.Duration {
+	if seconds == nil {
+		return 0
+	}
+	return time.Duration(*seconds) * time.Second
+}
+
 func toGroupResponse(peers []*nbpeer.Peer, group *types.Group) *api.Group {
 	peersMap := make(map[string]*nbpeer.Peer, len(peers))
 	for _, peer := range peers {
@@ -316,6 +328,11 @@ func toGroupResponse(peers []*nbpeer.Peer, group *types.Group) *api.Group {
 		Issued: (*api.GroupIssued)(&group.Issued),
 	}
 
+	if group.PeerLoginExpiration > 0 {
+		peerLoginExpiration := int(group.PeerLoginExpiration.Seconds())
+		gr.PeerLoginExpiration = &peerLoginExpiration
+	}
+
 	for _, pid := range group.Peers {
 		_, ok := peerCache[pid]
 		if !ok {
@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"net/netip"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
@@ -17,12 +21,20 @@ import (
 	nbcontext "github.com/netbirdio/netbird/management/server/context"
 	"github.com/netbirdio/netbird/management/server/groups"
 	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/management/server/store"
 	"github.com/netbirdio/netbird/management/server/types"
 	"github.com/netbirdio/netbird/shared/management/http/api"
 	"github.com/netbirdio/netbird/shared/management/http/util"
 	"github.com/netbirdio/netbird/shared/management/status"
 )
 
+// updatablePeerFields are the fields of the peer update request, in strict mode setting any other field of a peer
+// fails the update instead of being ignored
+var updatablePeerFields = []string{
+	"name", "description", "ssh_enabled", "login_expiration_enabled", "inactivity_expiration_enabled",
+	"approval_required", "ip", "admin_notes",
+}
+
 // Handler is a handler that returns peers of the account
 type Handler struct {
 	accountManager       account.Manager
@@ -32,10 +44,14 @@ type Handler struct {
 func AddEndpoints(accountManager account.Manager, router *mux.Router, networkMapController network_map.Controller) {
 	peersHandler := NewHandler(accountManager, networkMapController)
 	router.HandleFunc("/peers", peersHandler.GetAllPeers).Methods("GET", "OPTIONS")
+	router.HandleFunc("/peers/renew-expired-logins", peersHandler.RenewExpiredPeerLogins).Methods("POST", "OPTIONS")
 	router.HandleFunc("/peers/{peerId}", peersHandler.HandlePeer).
 		Methods("GET", "PUT", "DELETE", "OPTIONS")
 	router.HandleFunc("/peers/{peerId}/accessible-peers", peersHandler.GetAccessiblePeers).Methods("GET", "OPTIONS")
 	router.HandleFunc("/peers/{peerId}/temporary-access", peersHandler.CreateTemporaryAccess).Methods("POST", "OPTIONS")
+	router.HandleFunc("/peers/{peerId}/pin", peersHandler.SetPeerPinned).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/peers/{peerId}/firewall-overrides", peersHandler.GetPeerFirewallOverrides).Methods("GET", "OPTIONS")
+	router.HandleFunc("/peers/{peerId}/firewall-overrides", peersHandler.UpdatePeerFirewallOverrides).Methods("PUT", "OPTIONS")
 	router.HandleFunc("/peers/{peerId}/jobs", peersHandler.ListJobs).Methods("GET", "OPTIONS")
 	router.HandleFunc("/peers/{peerId}/jobs", peersHandler.CreateJob).Methods("POST", "OPTIONS")
 	router.HandleFunc("/peers/{peerId}/jobs/{jobId}", peersHandler.GetJob).Methods("GET", "OPTIONS")
@@ -170,13 +186,72 @@ func (h *Handler) getPeer(ctx context.Context, accountID, peerID, userID string,
 	_, valid := validPeers[peer.ID]
 	reason := invalidPeers[peer.ID]
 
-	util.WriteJSONObject(ctx, w, toSinglePeerResponse(peer, grpsInfoMap[peerID], dnsDomain, valid, reason))
+	resp := toSinglePeerResponse(peer, grpsInfoMap[peerID], dnsDomain, valid, reason)
+
+	// local network addresses, the connection source port and the reported errors reveal the peer's network layout,
+	// so they are only shared with admins, same as the admin notes
+	user, err := h.accountManager.GetUserByID(ctx, userID)
+	if err != nil {
+		util.WriteError(ctx, err, w)
+		return
+	}
+	if user.HasAdminPower() {
+		resp.LocalNetworks = toPeerLocalNetworks(peer.Meta.NetworkAddresses)
+		connectionPort := int(peer.Location.ConnectionPort)
+		resp.ConnectionPort = &connectionPort
+		resp.ReportedErrors = toPeerReportedErrors(peer.ReportedErrors)
+		resp.AdminNotes = &peer.AdminNotes
+	}
+
+	util.WriteJSONObject(ctx, w, resp)
+}
+
+func toPeerLocalNetworks(addresses []nbpeer.NetworkAddress) *[]api.PeerLocalNetwork {
+	localNetworks := make([]api.PeerLocalNetwork, 0, len(addresses))
+	for _, addr := range addresses {
+		localNetworks = append(localNetworks, api.PeerLocalNetwork{
+			Address: addr.NetIP.String(),
+			Mac:     addr.Mac,
+		})
+	}
+	return &localNetworks
+}
+
+func toPeerReportedErrors(reportedErrors []nbpeer.ReportedError) *[]api.PeerReportedError {
+	apiErrors := make([]api.PeerReportedError, 0, len(reportedErrors))
+	for _, reportedError := range reportedErrors {
+		apiErrors = append(apiErrors, api.PeerReportedError{
+			Time:    reportedError.Time,
+			Level:   api.PeerReportedErrorLevel(reportedError.Level),
+			Message: reportedError.Message,
+		})
+	}
+	return &apiErrors
 }
 
 func (h *Handler) updatePeer(ctx context.Context, accountID, userID, peerID string, w http.ResponseWriter, r *http.Request) {
+	var strict bool
+	if v := r.URL.Query().Get("strict"); v != "" {
+		var err error
+		strict, err = strconv.ParseBool(v)
+		if err != nil {
+			util.WriteError(ctx, status.Errorf(status.InvalidArgument, "invalid strict mode: %s", v), w)
+			return
+		}
+	}
+
 	req := &api.PeerRequest{}
-	err := json.NewDecoder(r.Body).Decode(&req)
+	decoder := json.NewDecoder(r.Body)
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	err := decoder.Decode(&req)
 	if err != nil {
+		if field, ok := unknownJSONField(err); strict && ok {
+			util.WriteError(ctx, status.Errorf(status.InvalidArgument, "field %s can't be changed with a peer update, supported fields are: %s",
+				field, strings.Join(updatablePeerFields, ", ")), w)
+			return
+		}
 		util.WriteErrorResponse("couldn't parse JSON request", http.StatusBadRequest, w)
 		return
 	}
@@ -190,6 +265,18 @@ func (h *Handler) updatePeer(ctx context.Context, accountID, userID, peerID stri
 		InactivityExpirationEnabled: req.InactivityExpirationEnabled,
 	}
 
+	if req.Description != nil {
+		update.Description = *req.Description
+	} else {
+		// description is optional in the request, keep the stored one when it is not provided
+		peer, err := h.accountManager.GetPeer(ctx, accountID, peerID, userID)
+		if err != nil {
+			util.WriteError(ctx, err, w)
+			return
+		}
+		update.Description = peer.Description
+	}
+
 	if req.ApprovalRequired != nil {
 		// todo: looks like that we reset all status property, is it right?
 		update.Status = &nbpeer.PeerStatus{
@@ -197,14 +284,18 @@ func (h *Handler) updatePeer(ctx context.Context, accountID, userID, peerID stri
 		}
 	}
 
+	var addr netip.Addr
 	if req.Ip != nil {
-		addr, err := netip.ParseAddr(*req.Ip)
+		addr, err = netip.ParseAddr(*req.Ip)
 		if err != nil {
 			util.WriteError(ctx, status.Errorf(status.InvalidArgument, "invalid IP address %s: %v", *req.Ip, err), w)
 			return
 		}
+	}
 
-		if err = h.accountManager.UpdatePeerIP(ctx, accountID, userID, peerID, addr); err != nil {
+	if req.AdminNotes != nil {
+		// admin notes are kept out of UpdatePeer, they don't affect the network map
+		if _, err = h.accountManager.UpdatePeerAdminNotes(ctx, accountID, userID, peerID, *req.AdminNotes); err != nil {
 			util.WriteError(ctx, err, w)
 			return
 		}
@@ -216,6 +307,20 @@ func (h *Handler) updatePeer(ctx context.Context, accountID, userID, peerID stri
 		return
 	}
 
+	// the IP is changed after the update, so an update rejected, e.g. for a peer managed by its setup key, leaves the IP as is
+	if req.Ip != nil {
+		if err = h.accountManager.UpdatePeerIP(ctx, accountID, userID, peerID, addr); err != nil {
+			util.WriteError(ctx, err, w)
+			return
+		}
+
+		peer, err = h.accountManager.GetPeer(ctx, accountID, peerID, userID)
+		if err != nil {
+			util.WriteError(ctx, err, w)
+			return
+		}
+	}
+
 	settings, err := h.accountManager.GetAccountSettings(ctx, accountID, activity.SystemInitiator)
 	if err != nil {
 		util.WriteError(ctx, err, w)
@@ -241,7 +346,11 @@ func (h *Handler) updatePeer(ctx context.Context, accountID, userID, peerID stri
 	_, valid := validPeers[peer.ID]
 	reason := invalidPeers[peer.ID]
 
-	util.WriteJSONObject(r.Context(), w, toSinglePeerResponse(peer, grpsInfoMap[peerID], dnsDomain, valid, reason))
+	resp := toSinglePeerResponse(peer, grpsInfoMap[peerID], dnsDomain, valid, reason)
+	// only users allowed to update the peer get here, so the admin notes can be returned
+	resp.AdminNotes = &peer.AdminNotes
+
+	util.WriteJSONObject(r.Context(), w, resp)
 }
 
 func (h *Handler) deletePeer(ctx context.Context, accountID, userID string, peerID string, w http.ResponseWriter) {
@@ -285,6 +394,12 @@ func (h *Handler) HandlePeer(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// unknownJSONField returns the name of the field the JSON decoder rejected because it is not part of the request
+func unknownJSONField(err error) (string, bool) {
+	field, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	return strings.Trim(field, `"`), ok
+}
+
 // GetAllPeers returns a list of all peers associated with a provided account
 func (h *Handler) GetAllPeers(w http.ResponseWriter, r *http.Request) {
 	userAuth, err := nbcontext.GetUserAuthFromContext(r.Context())
@@ -293,17 +408,53 @@ func (h *Handler) GetAllPeers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	nameFilter := r.URL.Query().Get("name")
-	ipFilter := r.URL.Query().Get("ip")
+	filters := store.PeerFilters{
+		Name:           r.URL.Query().Get("name"),
+		IP:             r.URL.Query().Get("ip"),
+		GroupID:        r.URL.Query().Get("group_id"),
+		ExcludeGroupID: r.URL.Query().Get("exclude_group_id"),
+	}
+
+	var staleFilter *bool
+	if v := r.URL.Query().Get("handshake_stale"); v != "" {
+		stale, err := strconv.ParseBool(v)
+		if err != nil {
+			util.WriteError(r.Context(), status.Errorf(status.InvalidArgument, "invalid handshake_stale filter: %s", v), w)
+			return
+		}
+		staleFilter = &stale
+	}
+
+	if v := r.URL.Query().Get("ephemeral"); v != "" {
+		ephemeral, err := strconv.ParseBool(v)
+		if err != nil {
+			util.WriteError(r.Context(), status.Errorf(status.InvalidArgument, "invalid ephemeral filter: %s", v), w)
+			return
+		}
+		filters.Ephemeral = &ephemeral
+	}
+
+	if v := r.URL.Query().Get("pinned_first"); v != "" {
+		pinnedFirst, err := strconv.ParseBool(v)
+		if err != nil {
+			util.WriteError(r.Context(), status.Errorf(status.InvalidArgument, "invalid pinned_first parameter: %s", v), w)
+			return
+		}
+		filters.PinnedFirst = pinnedFirst
+	}
 
 	accountID, userID := userAuth.AccountId, userAuth.UserId
 
-	peers, err := h.accountManager.GetPeers(r.Context(), accountID, userID, nameFilter, ipFilter)
+	peers, err := h.accountManager.GetPeers(r.Context(), accountID, userID, filters)
 	if err != nil {
 		util.WriteError(r.Context(), err, w)
 		return
 	}
 
+	if staleFilter != nil {
+		peers = filterPeersByStaleHandshake(peers, *staleFilter, time.Now().UTC())
+	}
+
 	settings, err := h.accountManager.GetAccountSettings(r.Context(), accountID, activity.SystemInitiator)
 	if err != nil {
 		util.WriteError(r.Context(), err, w)
@@ -400,6 +551,150 @@ func (h *Handler) GetAccessiblePeers(w http.ResponseWriter, r *http.Request) {
 	util.WriteJSONObject(r.Context(), w, toAccessiblePeers(netMap, dnsDomain))
 }
 
+// SetPeerPinned pins or unpins a peer in the peer listings of the requesting user
+func (h *Handler) SetPeerPinned(w http.ResponseWriter, r *http.Request) {
+	userAuth, err := nbcontext.GetUserAuthFromContext(r.Context())
+	if err != nil {
+		util.WriteError(r.Context(), err, w)
+		return
+	}
+
+	peerID := mux.Vars(r)["peerId"]
+	if len(peerID) == 0 {
+		util.WriteError(r.Context(), status.Errorf(status.InvalidArgument, "invalid peer ID"), w)
+		return
+	}
+
+	var req api.PutApiPeersPeerIdPinJSONRequestBody
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteErrorResponse("couldn't parse JSON request", http.StatusBadRequest, w)
+		return
+	}
+
+	if err = h.accountManager.SetPeerPinned(r.Context(), userAuth.AccountId, userAuth.UserId, peerID, req.Pinned); err != nil {
+		util.WriteError(r.Context(), err, w)
+		return
+	}
+
+	util.WriteJSONObject(r.Context(), w, util.EmptyObject{})
+}
+
+// RenewExpiredPeerLogins renews the logins of all expired peers of the account whose owners are still valid
+func (h *Handler) RenewExpiredPeerLogins(w http.ResponseWriter, r *http.Request) {
+	userAuth, err := nbcontext.GetUserAuthFromContext(r.Context())
+	if err != nil {
+		util.WriteError(r.Context(), err, w)
+		return
+	}
+
+	renewed, err := h.accountManager.RenewExpiredPeerLogins(r.Context(), userAuth.AccountId, userAuth.UserId)
+	if err != nil {
+		util.WriteError(r.Context(), err, w)
+		return
+	}
+
+	util.WriteJSONObject(r.Context(), w, api.PeerLoginsRenewResponse{RenewedPeers: renewed})
+}
+
+// GetPeerFirewallOverrides returns the firewall overrides of a peer
+func (h *Handler) GetPeerFirewallOverrides(w http.ResponseWriter, r *http.Request) {
+	userAuth, err := nbcontext.GetUserAuthFromContext(r.Context())
+	if err != nil {
+		util.WriteError(r.Context(), err, w)
+		return
+	}
+
+	peerID := mux.Vars(r)["peerId"]
+	if len(peerID) == 0 {
+		util.WriteError(r.Context(), status.Errorf(status.InvalidArgument, "invalid peer ID"), w)
+		return
+	}
+
+	peer, err := h.accountManager.GetPeer(r.Context(), userAuth.AccountId, peerID, userAuth.UserId)
+	if err != nil {
+		util.WriteError(r.Context(), err, w)
+		return
+	}
+
+	util.WriteJSONObject(r.Context(), w, toFirewallOverridesResponse(peer.FirewallOverrides))
+}
+
+// UpdatePeerFirewallOverrides replaces the firewall overrides of a peer
+func (h *Handler) UpdatePeerFirewallOverrides(w http.ResponseWriter, r *http.Request) {
+	userAuth, err := nbcontext.GetUserAuthFromContext(r.Context())
+	if err != nil {
+		util.WriteError(r.Context(), err, w)
+		return
+	}
+
+	peerID := mux.Vars(r)["peerId"]
+	if len(peerID) == 0 {
+		util.WriteError(r.Context(), status.Errorf(status.InvalidArgument, "invalid peer ID"), w)
+		return
+	}
+
+	var req api.PutApiPeersPeerIdFirewallOverridesJSONRequestBody
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteErrorResponse("couldn't parse JSON request", http.StatusBadRequest, w)
+		return
+	}
+
+	overrides := make([]nbpeer.FirewallOverride, 0, len(req.Overrides))
+	for _, o := range req.Overrides {
+		override := nbpeer.FirewallOverride{
+			PeerIP:    o.PeerIp,
+			Direction: string(o.Direction),
+			Action:    string(o.Action),
+			Protocol:  string(o.Protocol),
+		}
+		if o.Port != nil {
+			override.Port = *o.Port
+		}
+		if o.PortRange != nil {
+			if o.PortRange.Start < 0 || o.PortRange.Start > math.MaxUint16 || o.PortRange.End < 0 || o.PortRange.End > math.MaxUint16 {
+				util.WriteError(r.Context(), status.Errorf(status.InvalidArgument, "invalid port range %d-%d", o.PortRange.Start, o.PortRange.End), w)
+				return
+			}
+			override.PortRange = nbpeer.FirewallOverridePortRange{
+				Start: uint16(o.PortRange.Start),
+				End:   uint16(o.PortRange.End),
+			}
+		}
+		overrides = append(overrides, override)
+	}
+
+	peer, err := h.accountManager.UpdatePeerFirewallOverrides(r.Context(), userAuth.AccountId, userAuth.UserId, peerID, overrides)
+	if err != nil {
+		util.WriteError(r.Context(), err, w)
+		return
+	}
+
+	util.WriteJSONObject(r.Context(), w, toFirewallOverridesResponse(peer.FirewallOverrides))
+}
+
+func toFirewallOverridesResponse(overrides []nbpeer.FirewallOverride) []api.PeerFirewallOverride {
+	result := make([]api.PeerFirewallOverride, 0, len(overrides))
+	for _, o := range overrides {
+		override := api.PeerFirewallOverride{
+			PeerIp:    o.PeerIP,
+			Direction: api.PeerFirewallOverrideDirection(o.Direction),
+			Action:    api.PeerFirewallOverrideAction(o.Action),
+			Protocol:  api.PeerFirewallOverrideProtocol(o.Protocol),
+		}
+		if o.Port != "" {
+			override.Port = &o.Port
+		}
+		if o.PortRange != (nbpeer.FirewallOverridePortRange{}) {
+			override.PortRange = &api.RulePortRange{
+				Start: int(o.PortRange.Start),
+				End:   int(o.PortRange.End),
+			}
+		}
+		result = append(result, override)
+	}
+	return result
+}
+
 func (h *Handler) CreateTemporaryAccess(w http.ResponseWriter, r *http.Request) {
 	userAuth, err := nbcontext.GetUserAuthFromContext(r.Context())
 	if err != nil {
@@ -528,6 +823,10 @@ func toSinglePeerResponse(peer *nbpeer.Peer, groupsInfo []api.GroupMinimum, dnsD
 		ConnectionIp:                peer.Location.ConnectionIP.String(),
 		Connected:                   peer.Status.Connected,
 		LastSeen:                    peer.Status.LastSeen,
+		LastHandshake:               toLastHandshake(peer),
+		PendingApprovalSince:        toPendingApprovalSince(peer),
+		FirstConnectedAt:            peer.FirstConnectedAt,
+		HandshakeStale:              peer.HasStaleHandshake(time.Now().UTC()),
 		Os:                          fmt.Sprintf("%s %s", peer.Meta.OS, osVersion),
 		KernelVersion:               peer.Meta.KernelVersion,
 		GeonameId:                   int(peer.Location.GeoNameID),
@@ -536,6 +835,7 @@ func toSinglePeerResponse(peer *nbpeer.Peer, groupsInfo []api.GroupMinimum, dnsD
 		SshEnabled:                  peer.SSHEnabled,
 		Hostname:                    peer.Meta.Hostname,
 		UserId:                      peer.UserID,
+		OwnerEmail:                  toOwnerEmail(peer),
 		UiVersion:                   peer.Meta.UIVersion,
 		DnsLabel:                    fqdn(peer, dnsDomain),
 		ExtraDnsLabels:              fqdnList(peer.ExtraDNSLabels, dnsDomain),
@@ -548,6 +848,8 @@ func toSinglePeerResponse(peer *nbpeer.Peer, groupsInfo []api.GroupMinimum, dnsD
 		SerialNumber:                peer.Meta.SystemSerialNumber,
 		InactivityExpirationEnabled: peer.InactivityExpirationEnabled,
 		Ephemeral:                   peer.Ephemeral,
+		ManagedBySetupKeyOnly:       peer.ManagedBySetupKeyOnly,
+		Description:                 &peer.Description,
 		LocalFlags: &api.PeerLocalFlags{
 			BlockInbound:          &peer.Meta.Flags.BlockInbound,
 			BlockLanAccess:        &peer.Meta.Flags.BlockLANAccess,
@@ -582,6 +884,10 @@ func toPeerListItemResponse(peer *nbpeer.Peer, groupsInfo []api.GroupMinimum, dn
 		ConnectionIp:                peer.Location.ConnectionIP.String(),
 		Connected:                   peer.Status.Connected,
 		LastSeen:                    peer.Status.LastSeen,
+		LastHandshake:               toLastHandshake(peer),
+		PendingApprovalSince:        toPendingApprovalSince(peer),
+		FirstConnectedAt:            peer.FirstConnectedAt,
+		HandshakeStale:              peer.HasStaleHandshake(time.Now().UTC()),
 		Os:                          fmt.Sprintf("%s %s", peer.Meta.OS, osVersion),
 		KernelVersion:               peer.Meta.KernelVersion,
 		GeonameId:                   int(peer.Location.GeoNameID),
@@ -590,6 +896,7 @@ func toPeerListItemResponse(peer *nbpeer.Peer, groupsInfo []api.GroupMinimum, dn
 		SshEnabled:                  peer.SSHEnabled,
 		Hostname:                    peer.Meta.Hostname,
 		UserId:                      peer.UserID,
+		OwnerEmail:                  toOwnerEmail(peer),
 		UiVersion:                   peer.Meta.UIVersion,
 		DnsLabel:                    fqdn(peer, dnsDomain),
 		ExtraDnsLabels:              fqdnList(peer.ExtraDNSLabels, dnsDomain),
@@ -602,6 +909,8 @@ func toPeerListItemResponse(peer *nbpeer.Peer, groupsInfo []api.GroupMinimum, dn
 		SerialNumber:                peer.Meta.SystemSerialNumber,
 		InactivityExpirationEnabled: peer.InactivityExpirationEnabled,
 		Ephemeral:                   peer.Ephemeral,
+		ManagedBySetupKeyOnly:       peer.ManagedBySetupKeyOnly,
+		Description:                 &peer.Description,
 		LocalFlags: &api.PeerLocalFlags{
 			BlockInbound:          &peer.Meta.Flags.BlockInbound,
 			BlockLanAccess:        &peer.Meta.Flags.BlockLANAccess,
@@ -617,6 +926,40 @@ func toPeerListItemResponse(peer *nbpeer.Peer, groupsInfo []api.GroupMinimum, dn
 	}
 }
 
+func filterPeersByStaleHandshake(peers []*nbpeer.Peer, stale bool, now time.Time) []*nbpeer.Peer {
+	filtered := make([]*nbpeer.Peer, 0, len(peers))
+	for _, peer := range peers {
+		if peer.HasStaleHandshake(now) == stale {
+			filtered = append(filtered, peer)
+		}
+	}
+	return filtered
+}
+
+func toLastHandshake(peer *nbpeer.Peer) *time.Time {
+	if peer.Status.LastHandshake.IsZero() {
+		return nil
+	}
+	lastHandshake := peer.Status.LastHandshake
+	return &lastHandshake
+}
+
+func toOwnerEmail(peer *nbpeer.Peer) *string {
+	if peer.OwnerEmail == "" {
+		return nil
+	}
+	ownerEmail := peer.OwnerEmail
+	return &ownerEmail
+}
+
+func toPendingApprovalSince(peer *nbpeer.Peer) *time.Time {
+	if peer.Status.PendingApprovalSince.IsZero() {
+		return nil
+	}
+	pendingSince := peer.Status.PendingApprovalSince
+	return &pendingSince
+}
+
 func toSingleJobResponse(job *types.Job) (*api.JobResponse, error) {
 	workload, err := job.BuildWorkloadResponse()
 	if err != nil {
@@ -20,6 +20,7 @@ import (
 	"github.com/netbirdio/netbird/management/internals/controllers/network_map"
 	nbcontext "github.com/netbirdio/netbird/management/server/context"
 	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/management/server/store"
 	"github.com/netbirdio/netbird/management/server/types"
 	"github.com/netbirdio/netbird/shared/auth"
 	"github.com/netbirdio/netbird/shared/management/http/api"
@@ -156,7 +157,7 @@ func initTestMetaData(t *testing.T, peers ...*nbpeer.Peer) *Handler {
 					return nil, fmt.Errorf("user not found")
 				}
 			},
-			GetPeersFunc: func(_ context.Context, accountID, userID, nameFilter, ipFilter string) ([]*nbpeer.Peer, error) {
+			GetPeersFunc: func(_ context.Context, accountID, userID string, filters store.PeerFilters) ([]*nbpeer.Peer, error) {
 				return peers, nil
 			},
 			GetPeerGroupsFunc: func(ctx context.Context, accountID, peerID string) ([]*types.Group, error) {
@@ -533,3 +534,234 @@ func TestPeersHandlerUpdatePeerIP(t *testing.T) {
 		})
 	}
 }
+
+func TestPeersHandlerUpdatePeerStrictMode(t *testing.T) {
+	testPeer := &nbpeer.Peer{
+		ID:     testPeerID,
+		Key:    "key",
+		IP:     net.ParseIP("100.64.0.1"),
+		Status: &nbpeer.PeerStatus{Connected: false, LastSeen: time.Now()},
+		Name:   "test-host",
+		Meta: nbpeer.PeerSystemMeta{
+			Hostname: "test-host",
+		},
+	}
+
+	p := initTestMetaData(t, testPeer)
+
+	tt := []struct {
+		name           string
+		query          string
+		requestBody    string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "unsupported field is ignored by default",
+			requestBody:    `{"name": "renamed", "groups": ["servers"]}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unsupported field fails in strict mode",
+			query:          "?strict=true",
+			requestBody:    `{"name": "renamed", "groups": ["servers"]}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedError:  "field groups can't be changed with a peer update",
+		},
+		{
+			name:           "supported fields pass in strict mode",
+			query:          "?strict=true",
+			requestBody:    `{"name": "renamed", "ssh_enabled": true, "login_expiration_enabled": false, "inactivity_expiration_enabled": false}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid strict mode",
+			query:          "?strict=maybe",
+			requestBody:    `{"name": "renamed"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedError:  "invalid strict mode",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/peers/"+testPeerID+tc.query, bytes.NewBufferString(tc.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			req = nbcontext.SetUserAuthInRequest(req, auth.UserAuth{
+				UserId:    adminUser,
+				Domain:    "hotmail.com",
+				AccountId: "test_id",
+			})
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/peers/{peerId}", p.HandlePeer).Methods("PUT")
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			if tc.expectedError != "" {
+				assert.Contains(t, rr.Body.String(), tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestGetPeerLocalNetworks(t *testing.T) {
+	reportedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	testPeer := &nbpeer.Peer{
+		ID:     testPeerID,
+		Key:    "key",
+		IP:     net.ParseIP("100.64.0.1"),
+		Status: &nbpeer.PeerStatus{Connected: true, LastSeen: time.Now()},
+		Name:   "test-host",
+		UserID: regularUser,
+		Meta: nbpeer.PeerSystemMeta{
+			Hostname: "test-host",
+			NetworkAddresses: []nbpeer.NetworkAddress{
+				{NetIP: netip.MustParsePrefix("192.168.1.10/24"), Mac: "00:1b:44:11:3a:b7"},
+			},
+		},
+		Location: nbpeer.Location{ConnectionIP: net.ParseIP("203.0.113.7"), ConnectionPort: 41641},
+		ReportedErrors: []nbpeer.ReportedError{
+			{Time: reportedAt, Level: nbpeer.ReportedErrorLevelWarning, Message: "route 10.10.0.0/16 conflicts with local network"},
+		},
+	}
+
+	p := initTestMetaData(t, testPeer)
+	connectionPort := 41641
+
+	tt := []struct {
+		name                   string
+		callerUserID           string
+		expectedLocalNetworks  *[]api.PeerLocalNetwork
+		expectedConnectionPort *int
+		expectedReportedErrors *[]api.PeerReportedError
+	}{
+		{
+			name:         "admin sees local networks",
+			callerUserID: adminUser,
+			expectedLocalNetworks: &[]api.PeerLocalNetwork{
+				{Address: "192.168.1.10/24", Mac: "00:1b:44:11:3a:b7"},
+			},
+			expectedConnectionPort: &connectionPort,
+			expectedReportedErrors: &[]api.PeerReportedError{
+				{Time: reportedAt, Level: api.PeerReportedErrorLevelWarning, Message: "route 10.10.0.0/16 conflicts with local network"},
+			},
+		},
+		{
+			name:                  "regular user doesn't see local networks",
+			callerUserID:          regularUser,
+			expectedLocalNetworks: nil,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/peers/%s", testPeerID), nil)
+			req = nbcontext.SetUserAuthInRequest(req, auth.UserAuth{
+				UserId:    tc.callerUserID,
+				Domain:    "hotmail.com",
+				AccountId: "test_id",
+			})
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/peers/{peerId}", p.HandlePeer).Methods("GET")
+
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var got api.Peer
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+			assert.Equal(t, tc.expectedLocalNetworks, got.LocalNetworks)
+			assert.Equal(t, tc.expectedConnectionPort, got.ConnectionPort)
+			assert.Equal(t, tc.expectedReportedErrors, got.ReportedErrors)
+		})
+	}
+}
+
+func TestGetPeersHandshakeStaleFilter(t *testing.T) {
+	stalePeer := &nbpeer.Peer{
+		ID:     "stale-peer",
+		Key:    "stale-key",
+		IP:     net.ParseIP("100.64.0.1"),
+		Status: &nbpeer.PeerStatus{Connected: true, LastSeen: time.Now(), LastHandshake: time.Now().Add(-time.Hour)},
+		Name:   "stale",
+		Meta:   nbpeer.PeerSystemMeta{Hostname: "stale"},
+	}
+	healthyPeer := &nbpeer.Peer{
+		ID:     "healthy-peer",
+		Key:    "healthy-key",
+		IP:     net.ParseIP("100.64.0.2"),
+		Status: &nbpeer.PeerStatus{Connected: true, LastSeen: time.Now(), LastHandshake: time.Now()},
+		Name:   "healthy",
+		Meta:   nbpeer.PeerSystemMeta{Hostname: "healthy"},
+	}
+
+	p := initTestMetaData(t, stalePeer, healthyPeer)
+
+	tt := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedPeers  []string
+	}{
+		{
+			name:           "no filter",
+			expectedStatus: http.StatusOK,
+			expectedPeers:  []string{"stale-peer", "healthy-peer"},
+		},
+		{
+			name:           "stale peers",
+			query:          "?handshake_stale=true",
+			expectedStatus: http.StatusOK,
+			expectedPeers:  []string{"stale-peer"},
+		},
+		{
+			name:           "healthy peers",
+			query:          "?handshake_stale=false",
+			expectedStatus: http.StatusOK,
+			expectedPeers:  []string{"healthy-peer"},
+		},
+		{
+			name:           "invalid filter",
+			query:          "?handshake_stale=maybe",
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/peers"+tc.query, nil)
+			req = nbcontext.SetUserAuthInRequest(req, auth.UserAuth{
+				UserId:    adminUser,
+				Domain:    "hotmail.com",
+				AccountId: "test_id",
+			})
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/peers", p.GetAllPeers).Methods("GET")
+
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.expectedStatus, rr.Code)
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var got []api.PeerBatch
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+
+			ids := make([]string, 0, len(got))
+			for _, peer := range got {
+				ids = append(ids, peer.Id)
+				assert.Equal(t, peer.Id == "stale-peer", peer.HandshakeStale)
+				assert.NotNil(t, peer.LastHandshake)
+			}
+			assert.ElementsMatch(t, tc.expectedPeers, ids)
+		})
+	}
+}
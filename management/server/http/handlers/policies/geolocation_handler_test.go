@@ -13,6 +13,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	nbcontext "github.com/netbirdio/netbird/management/server/context"
 	"github.com/netbirdio/netbird/management/server/geolocation"
@@ -21,6 +22,7 @@ import (
 	"github.com/netbirdio/netbird/management/server/permissions/modules"
 	"github.com/netbirdio/netbird/management/server/permissions/operations"
 	"github.com/netbirdio/netbird/management/server/types"
+	nbutil "github.com/netbirdio/netbird/management/server/util"
 	"github.com/netbirdio/netbird/shared/auth"
 	"github.com/netbirdio/netbird/shared/management/http/api"
 	"github.com/netbirdio/netbird/util"
@@ -53,6 +55,11 @@ func initGeolocationTestData(t *testing.T) *geolocationsHandler {
 		ValidateUserPermissions(gomock.Any(), gomock.Any(), gomock.Any(), modules.Policies, operations.Read).
 		Return(true, nil).
 		AnyTimes()
+	permissionsManagerMock.
+		EXPECT().
+		ValidateUserPermissions(gomock.Any(), gomock.Any(), gomock.Any(), modules.Settings, operations.Read).
+		Return(true, nil).
+		AnyTimes()
 
 	return &geolocationsHandler{
 		accountManager: &mock_server.MockAccountManager{
@@ -80,12 +87,14 @@ func TestGetCitiesByCountry(t *testing.T) {
 			expectedBody:   true,
 			expectedCities: []api.City{
 				{
-					CityName:  "Souni",
-					GeonameId: 5819,
+					CityName:        "Souni",
+					GeonameId:       5819,
+					SubdivisionCode: nbutil.ToPtr("CY-2"),
 				},
 				{
-					CityName:  "Protaras",
-					GeonameId: 18918,
+					CityName:        "Protaras",
+					GeonameId:       18918,
+					SubdivisionCode: nbutil.ToPtr("CY-4"),
 				},
 			},
 			requestType: http.MethodGet,
@@ -245,3 +254,32 @@ func TestGetAllCountries(t *testing.T) {
 		})
 	}
 }
+
+func TestGetDatabaseInfo(t *testing.T) {
+	geolocationHandler := initGeolocationTestData(t)
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/locations/database", nil)
+	req = nbcontext.SetUserAuthInRequest(req, auth.UserAuth{
+		UserId:    "test_user",
+		Domain:    "hotmail.com",
+		AccountId: "test_id",
+	})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/locations/database", geolocationHandler.getDatabaseInfo).Methods("GET")
+	router.ServeHTTP(recorder, req)
+
+	res := recorder.Result()
+	defer res.Body.Close()
+
+	content, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, recorder.Code, string(content))
+
+	info := api.GeoLocationDatabaseInfo{}
+	require.NoError(t, json.Unmarshal(content, &info))
+	assert.Equal(t, "GeoLite2-City", info.MmdbType)
+	assert.False(t, info.MmdbBuildTime.IsZero())
+	assert.Equal(t, "2024-03-05", info.GeonamesSnapshotDate)
+}
@@ -3,6 +3,7 @@ package policies
 import (
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/gorilla/mux"
 
@@ -32,6 +33,7 @@ func AddLocationsEndpoints(accountManager account.Manager, locationManager geolo
 	locationHandler := newGeolocationsHandlerHandler(accountManager, locationManager, permissionsManager)
 	router.HandleFunc("/locations/countries", locationHandler.getAllCountries).Methods("GET", "OPTIONS")
 	router.HandleFunc("/locations/countries/{country}/cities", locationHandler.getCitiesByCountry).Methods("GET", "OPTIONS")
+	router.HandleFunc("/locations/database", locationHandler.getDatabaseInfo).Methods("GET", "OPTIONS")
 }
 
 // newGeolocationsHandlerHandler creates a new Geolocations handler
@@ -45,7 +47,7 @@ func newGeolocationsHandlerHandler(accountManager account.Manager, geolocationMa
 
 // getAllCountries retrieves a list of all countries
 func (l *geolocationsHandler) getAllCountries(w http.ResponseWriter, r *http.Request) {
-	if err := l.authenticateUser(r); err != nil {
+	if err := l.authenticateUser(r, modules.Policies); err != nil {
 		util.WriteError(r.Context(), err, w)
 		return
 	}
@@ -71,7 +73,7 @@ func (l *geolocationsHandler) getAllCountries(w http.ResponseWriter, r *http.Req
 
 // getCitiesByCountry retrieves a list of cities based on the given country code
 func (l *geolocationsHandler) getCitiesByCountry(w http.ResponseWriter, r *http.Request) {
-	if err := l.authenticateUser(r); err != nil {
+	if err := l.authenticateUser(r, modules.Policies); err != nil {
 		util.WriteError(r.Context(), err, w)
 		return
 	}
@@ -102,7 +104,29 @@ func (l *geolocationsHandler) getCitiesByCountry(w http.ResponseWriter, r *http.
 	util.WriteJSONObject(r.Context(), w, cities)
 }
 
-func (l *geolocationsHandler) authenticateUser(r *http.Request) error {
+// getDatabaseInfo retrieves the build and version metadata of the geolocation databases
+func (l *geolocationsHandler) getDatabaseInfo(w http.ResponseWriter, r *http.Request) {
+	if err := l.authenticateUser(r, modules.Settings); err != nil {
+		util.WriteError(r.Context(), err, w)
+		return
+	}
+
+	if l.geolocationManager == nil {
+		util.WriteError(r.Context(), status.Errorf(status.PreconditionFailed, "Geo location database is not initialized. "+
+			"Check the self-hosted Geo database documentation at https://docs.netbird.io/selfhosted/geo-support"), w)
+		return
+	}
+
+	info, err := l.geolocationManager.DatabaseInfo()
+	if err != nil {
+		util.WriteError(r.Context(), err, w)
+		return
+	}
+
+	util.WriteJSONObject(r.Context(), w, toDatabaseInfoResponse(info))
+}
+
+func (l *geolocationsHandler) authenticateUser(r *http.Request, module modules.Module) error {
 	ctx := r.Context()
 
 	userAuth, err := nbcontext.GetUserAuthFromContext(ctx)
@@ -112,7 +136,7 @@ func (l *geolocationsHandler) authenticateUser(r *http.Request) error {
 
 	accountID, userID := userAuth.AccountId, userAuth.UserId
 
-	allowed, err := l.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Policies, operations.Read)
+	allowed, err := l.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, module, operations.Read)
 	if err != nil {
 		return status.NewPermissionValidationError(err)
 	}
@@ -131,8 +155,27 @@ func toCountryResponse(country geolocation.Country) api.Country {
 }
 
 func toCityResponse(city geolocation.City) api.City {
+	var subdivisionCode *string
+	if city.SubdivisionCode != "" {
+		subdivisionCode = &city.SubdivisionCode
+	}
+
 	return api.City{
-		CityName:  city.CityName,
-		GeonameId: city.GeoNameID,
+		CityName:        city.CityName,
+		GeonameId:       city.GeoNameID,
+		SubdivisionCode: subdivisionCode,
+	}
+}
+
+func toDatabaseInfoResponse(info *geolocation.DatabaseInfo) api.GeoLocationDatabaseInfo {
+	var geonamesSnapshotDate string
+	if !info.GeoNamesSnapshotDate.IsZero() {
+		geonamesSnapshotDate = info.GeoNamesSnapshotDate.Format(time.DateOnly)
+	}
+
+	return api.GeoLocationDatabaseInfo{
+		GeonamesSnapshotDate: geonamesSnapshotDate,
+		MmdbBuildTime:        info.MMDBBuildTime,
+		MmdbType:             info.MMDBType,
 	}
 }
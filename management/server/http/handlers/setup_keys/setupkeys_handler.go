@@ -75,18 +75,34 @@ func (h *handler) createSetupKey(w http.ResponseWriter, r *http.Request) {
 		req.AutoGroups = []string{}
 	}
 
-	var ephemeral bool
+	var opts types.SetupKeyOptions
 	if req.Ephemeral != nil {
-		ephemeral = *req.Ephemeral
+		opts.Ephemeral = *req.Ephemeral
 	}
-
-	var allowExtraDNSLabels bool
 	if req.AllowExtraDnsLabels != nil {
-		allowExtraDNSLabels = *req.AllowExtraDnsLabels
+		opts.AllowExtraDNSLabels = *req.AllowExtraDnsLabels
+	}
+	if req.RequiresApproval != nil {
+		opts.RequiresApproval = *req.RequiresApproval
+	}
+	if req.AllowOutdatedOsVersion != nil {
+		opts.AllowOutdatedOSVersion = *req.AllowOutdatedOsVersion
+	}
+	if req.ManagedPeers != nil {
+		opts.ManagedPeers = *req.ManagedPeers
+	}
+	if req.PeerExpirationDefaults != nil {
+		opts.PeerExpiration = &types.PeerExpirationDefaults{
+			LoginExpirationEnabled:      req.PeerExpirationDefaults.LoginExpirationEnabled,
+			InactivityExpirationEnabled: req.PeerExpirationDefaults.InactivityExpirationEnabled,
+		}
+	}
+	if req.RequestableGroups != nil {
+		opts.RequestableGroups = *req.RequestableGroups
 	}
 
 	setupKey, err := h.accountManager.CreateSetupKey(r.Context(), accountID, req.Name, types.SetupKeyType(req.Type), expiresIn,
-		req.AutoGroups, req.UsageLimit, userID, ephemeral, allowExtraDNSLabels)
+		req.AutoGroups, req.UsageLimit, userID, opts)
 	if err != nil {
 		util.WriteError(r.Context(), err, w)
 		return
@@ -155,6 +171,9 @@ func (h *handler) updateSetupKey(w http.ResponseWriter, r *http.Request) {
 	newKey := &types.SetupKey{}
 	newKey.AutoGroups = req.AutoGroups
 	newKey.Revoked = req.Revoked
+	if req.RequestableGroups != nil {
+		newKey.RequestableGroups = *req.RequestableGroups
+	}
 	newKey.Id = keyID
 
 	newKey, err = h.accountManager.SaveSetupKey(r.Context(), accountID, newKey, userID)
@@ -235,21 +254,39 @@ func ToResponseBody(key *types.SetupKey) *api.SetupKey {
 		state = "valid"
 	}
 
+	requestableGroups := key.RequestableGroups
+	if requestableGroups == nil {
+		requestableGroups = []string{}
+	}
+
+	var peerExpiration *api.PeerExpirationDefaults
+	if key.PeerExpirationDefaults != nil {
+		peerExpiration = &api.PeerExpirationDefaults{
+			LoginExpirationEnabled:      key.PeerExpirationDefaults.LoginExpirationEnabled,
+			InactivityExpirationEnabled: key.PeerExpirationDefaults.InactivityExpirationEnabled,
+		}
+	}
+
 	return &api.SetupKey{
-		Id:                  key.Id,
-		Key:                 key.KeySecret,
-		Name:                key.Name,
-		Expires:             key.GetExpiresAt(),
-		Type:                string(key.Type),
-		Valid:               key.IsValid(),
-		Revoked:             key.Revoked,
-		UsedTimes:           key.UsedTimes,
-		LastUsed:            key.GetLastUsed(),
-		State:               state,
-		AutoGroups:          key.AutoGroups,
-		UpdatedAt:           key.UpdatedAt,
-		UsageLimit:          key.UsageLimit,
-		Ephemeral:           key.Ephemeral,
-		AllowExtraDnsLabels: key.AllowExtraDNSLabels,
+		Id:                     key.Id,
+		Key:                    key.KeySecret,
+		Name:                   key.Name,
+		Expires:                key.GetExpiresAt(),
+		Type:                   string(key.Type),
+		Valid:                  key.IsValid(),
+		Revoked:                key.Revoked,
+		UsedTimes:              key.UsedTimes,
+		LastUsed:               key.GetLastUsed(),
+		State:                  state,
+		AutoGroups:             key.AutoGroups,
+		UpdatedAt:              key.UpdatedAt,
+		UsageLimit:             key.UsageLimit,
+		Ephemeral:              key.Ephemeral,
+		AllowExtraDnsLabels:    key.AllowExtraDNSLabels,
+		RequiresApproval:       key.RequiresApproval,
+		AllowOutdatedOsVersion: key.AllowOutdatedOSVersion,
+		ManagedPeers:           key.ManagedPeers,
+		PeerExpirationDefaults: peerExpiration,
+		RequestableGroups:      &requestableGroups,
 	}
 }
@@ -33,12 +33,15 @@ func initSetupKeysTestMetaData(defaultKey *types.SetupKey, newKey *types.SetupKe
 	return &handler{
 		accountManager: &mock_server.MockAccountManager{
 			CreateSetupKeyFunc: func(_ context.Context, _ string, keyName string, typ types.SetupKeyType, _ time.Duration, _ []string,
-				_ int, _ string, ephemeral bool, allowExtraDNSLabels bool,
+				_ int, _ string, opts types.SetupKeyOptions,
 			) (*types.SetupKey, error) {
 				if keyName == newKey.Name || typ != newKey.Type {
 					nk := newKey.Copy()
-					nk.Ephemeral = ephemeral
-					nk.AllowExtraDNSLabels = allowExtraDNSLabels
+					nk.Ephemeral = opts.Ephemeral
+					nk.AllowExtraDNSLabels = opts.AllowExtraDNSLabels
+					nk.RequiresApproval = opts.RequiresApproval
+					nk.AllowOutdatedOSVersion = opts.AllowOutdatedOSVersion
+					nk.ManagedPeers = opts.ManagedPeers
 					return nk, nil
 				}
 				return nil, fmt.Errorf("failed creating setup key")
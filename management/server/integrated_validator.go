@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 
 	log "github.com/sirupsen/logrus"
 
@@ -99,7 +100,7 @@ func (am *DefaultAccountManager) GetValidatedPeers(ctx context.Context, accountI
 		return nil, nil, err
 	}
 
-	peers, err = am.Store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "")
+	peers, err = am.Store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "", nil)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -114,11 +115,26 @@ func (am *DefaultAccountManager) GetValidatedPeers(ctx context.Context, accountI
 		return nil, nil, err
 	}
 
-	invalidPeers, err := am.integratedPeerValidator.GetInvalidPeers(ctx, accountID, settings.Extra)
+	validatorInvalidPeers, err := am.integratedPeerValidator.GetInvalidPeers(ctx, accountID, settings.Extra)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// the peers pending the approval required by their setup key are not valid whatever the validator says
+	invalidPeers := maps.Clone(validatorInvalidPeers)
+	if invalidPeers == nil {
+		invalidPeers = make(map[string]string)
+	}
+	for _, peer := range peers {
+		if peer.Status == nil || !peer.Status.RequiresApproval {
+			continue
+		}
+		delete(validPeers, peer.ID)
+		if _, ok := invalidPeers[peer.ID]; !ok {
+			invalidPeers[peer.ID] = "the setup key of the peer requires approval"
+		}
+	}
+
 	return validPeers, invalidPeers, nil
 }
 
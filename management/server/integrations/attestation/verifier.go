@@ -0,0 +1,27 @@
+package attestation
+
+import (
+	"context"
+
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+)
+
+// Verifier verifies the platform attestation (e.g. a TPM quote or an MDM token) a peer provides on registration.
+// It is an integration point for deployments that require attested devices and doesn't assume any specific scheme.
+type Verifier interface {
+	// Verify checks the attestation provided by a registering peer. A returned error rejects the registration.
+	// The returned result, if any, is stored on the peer for audit.
+	Verify(ctx context.Context, accountID string, meta nbpeer.PeerSystemMeta, attestation []byte) (*nbpeer.Attestation, error)
+}
+
+// NoopVerifier accepts every registration without checking the attestation
+type NoopVerifier struct {
+}
+
+func NewNoopVerifier() *NoopVerifier {
+	return &NoopVerifier{}
+}
+
+func (v *NoopVerifier) Verify(ctx context.Context, accountID string, meta nbpeer.PeerSystemMeta, attestation []byte) (*nbpeer.Attestation, error) {
+	return nil, nil
+}
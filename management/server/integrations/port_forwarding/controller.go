@@ -14,6 +14,12 @@ type Controller interface {
 	IsPeerInIngressPorts(ctx context.Context, accountID, peerID string) (bool, error)
 }
 
+// IngressPortsProvider is implemented by the controllers able to describe the ingress port configurations a peer
+// is linked to
+type IngressPortsProvider interface {
+	GetPeerIngressPorts(ctx context.Context, accountID, peerID string) ([]*nbtypes.IngressPort, error)
+}
+
 type ControllerMock struct {
 }
 
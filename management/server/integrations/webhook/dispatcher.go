@@ -0,0 +1,247 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// EventPeerAdded is sent after a peer has been registered
+	EventPeerAdded = "peer.added"
+	// EventPeerDeleted is sent after a peer has been deleted
+	EventPeerDeleted = "peer.deleted"
+	// EventPeerPendingApproval is sent when a peer starts requiring approval
+	EventPeerPendingApproval = "peer.approval.pending"
+	// EventPeerApproved is sent when a peer pending approval has been approved
+	EventPeerApproved = "peer.approval.approved"
+	// EventPeerRejected is sent when a peer pending approval has been deleted
+	EventPeerRejected = "peer.approval.rejected"
+
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body, prefixed with "sha256="
+	SignatureHeader = "X-Netbird-Signature"
+	// EventHeader carries the event type of the payload
+	EventHeader = "X-Netbird-Event"
+
+	// EnvAllowedPrivateHosts is a comma separated list of webhook hosts allowed to resolve to loopback, link-local
+	// or private addresses, e.g. for receivers running next to a self-hosted management server
+	EnvAllowedPrivateHosts = "NB_PEER_WEBHOOK_ALLOWED_PRIVATE_HOSTS"
+
+	defaultMaxAttempts     = 4
+	defaultRetryBackoff    = time.Second
+	defaultRequestTimeout  = 10 * time.Second
+	defaultMaxInFlightJobs = 100
+)
+
+// sharedAddressSpace is the carrier-grade NAT range, also used by the NetBird peers
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Endpoint is the webhook configuration of an account
+type Endpoint struct {
+	URL    string
+	Secret string
+}
+
+// PeerEvent is the JSON payload posted to the webhook when a peer is added, deleted or changes its approval state
+type PeerEvent struct {
+	Event       string    `json:"event"`
+	Timestamp   time.Time `json:"timestamp"`
+	AccountID   string    `json:"account_id"`
+	PeerID      string    `json:"peer_id"`
+	PeerName    string    `json:"peer_name"`
+	PeerIP      string    `json:"peer_ip"`
+	InitiatorID string    `json:"initiator_id"`
+}
+
+// Dispatcher delivers peer events to the account webhooks in the background, retrying failed deliveries
+// with an exponential backoff. Dispatching never blocks the caller.
+// Webhooks are only delivered to public addresses, unless their host is allowed with EnvAllowedPrivateHosts,
+// so that accounts can't use them to reach the network of the management server.
+type Dispatcher struct {
+	client       *http.Client
+	resolver     *net.Resolver
+	allowedHosts map[string]struct{}
+	maxAttempts  int
+	retryBackoff time.Duration
+	inFlight     chan struct{}
+}
+
+// NewDispatcher returns a Dispatcher with the default retry policy
+func NewDispatcher() *Dispatcher {
+	d := &Dispatcher{
+		resolver:     net.DefaultResolver,
+		allowedHosts: allowedPrivateHostsFromEnv(),
+		maxAttempts:  defaultMaxAttempts,
+		retryBackoff: defaultRetryBackoff,
+		inFlight:     make(chan struct{}, defaultMaxInFlightJobs),
+	}
+
+	// the target address is checked when dialing, so a host resolving to a private address after it has been
+	// validated is still rejected. Proxies are not used, as the dialed address would be the proxy one.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = d.dialContext
+	d.client = &http.Client{Timeout: defaultRequestTimeout, Transport: transport}
+
+	return d
+}
+
+func allowedPrivateHostsFromEnv() map[string]struct{} {
+	hosts := make(map[string]struct{})
+	for _, host := range strings.Split(os.Getenv(EnvAllowedPrivateHosts), ",") {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host != "" {
+			hosts[host] = struct{}{}
+		}
+	}
+	return hosts
+}
+
+// ValidateURL checks the webhook URL is an absolute http or https URL whose host only resolves to public addresses
+func (d *Dispatcher) ValidateURL(ctx context.Context, webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("expected an http or https URL")
+	}
+
+	_, err = d.resolveTarget(ctx, u.Hostname())
+	return err
+}
+
+// resolveTarget resolves the host and returns its addresses, failing when one of them is not public
+// and the host is not allowed to be private
+func (d *Dispatcher) resolveTarget(ctx context.Context, host string) ([]netip.Addr, error) {
+	addrs, err := d.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+
+	if _, ok := d.allowedHosts[strings.ToLower(host)]; ok {
+		return addrs, nil
+	}
+
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return nil, fmt.Errorf("%s resolves to the non-public address %s", host, addr)
+		}
+	}
+
+	return addrs, nil
+}
+
+func (d *Dispatcher) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := d.resolveTarget(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// isPublicAddr reports whether the address is a publicly routable unicast address
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// Dispatch delivers the event to the endpoint asynchronously. The event is dropped when too many deliveries
+// are already in progress, so a slow or unreachable webhook can't pile up goroutines.
+func (d *Dispatcher) Dispatch(ctx context.Context, endpoint Endpoint, event PeerEvent) {
+	if endpoint.URL == "" {
+		return
+	}
+
+	select {
+	case d.inFlight <- struct{}{}:
+	default:
+		log.WithContext(ctx).Warnf("dropping %s webhook for peer %s of account %s: too many deliveries in progress", event.Event, event.PeerID, event.AccountID)
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer func() { <-d.inFlight }()
+		d.deliver(ctx, endpoint, event)
+	}()
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, endpoint Endpoint, event PeerEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.WithContext(ctx).Errorf("failed to marshal %s webhook payload: %v", event.Event, err)
+		return
+	}
+
+	backoff := d.retryBackoff
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		err = d.send(ctx, endpoint, event.Event, body)
+		if err == nil {
+			return
+		}
+
+		if attempt < d.maxAttempts {
+			log.WithContext(ctx).Debugf("%s webhook for peer %s failed on attempt %d, retrying in %s: %v", event.Event, event.PeerID, attempt, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	log.WithContext(ctx).Errorf("failed to deliver %s webhook for peer %s of account %s after %d attempts: %v",
+		event.Event, event.PeerID, event.AccountID, d.maxAttempts, err)
+}
+
+func (d *Dispatcher) send(ctx context.Context, endpoint Endpoint, eventType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(SignatureHeader, Sign(endpoint.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the value of the SignatureHeader for the body. Receivers should compute the same value with the
+// shared secret and compare it in constant time.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
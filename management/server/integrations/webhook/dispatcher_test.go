@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcher_DispatchRetriesAndSigns(t *testing.T) {
+	const secret = "secret"
+
+	var attempts atomic.Int32
+	delivered := make(chan PeerEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, Sign(secret, body), r.Header.Get(SignatureHeader))
+		assert.Equal(t, EventPeerAdded, r.Header.Get(EventHeader))
+
+		var event PeerEvent
+		require.NoError(t, json.Unmarshal(body, &event))
+		delivered <- event
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvAllowedPrivateHosts, "127.0.0.1")
+	d := NewDispatcher()
+	d.retryBackoff = time.Millisecond
+
+	d.Dispatch(context.Background(), Endpoint{URL: server.URL, Secret: secret}, PeerEvent{
+		Event:     EventPeerAdded,
+		AccountID: "account",
+		PeerID:    "peer",
+		PeerName:  "laptop",
+		PeerIP:    "100.64.0.1",
+	})
+
+	select {
+	case event := <-delivered:
+		assert.Equal(t, "peer", event.PeerID)
+		assert.Equal(t, "100.64.0.1", event.PeerIP)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+func TestDispatcher_DropsWhenBusy(t *testing.T) {
+	d := NewDispatcher()
+	d.inFlight = make(chan struct{}, 1)
+	d.inFlight <- struct{}{}
+
+	var called atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	}))
+	defer server.Close()
+
+	d.Dispatch(context.Background(), Endpoint{URL: server.URL}, PeerEvent{Event: EventPeerDeleted})
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, called.Load(), "event should be dropped when the dispatcher is busy")
+}
+
+func TestDispatcher_ValidateURL(t *testing.T) {
+	d := NewDispatcher()
+
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "https://203.0.113.10/hook"},
+		{url: "http://[2001:db8::1]:8080/hook"},
+		{url: "ftp://203.0.113.10/hook", wantErr: true},
+		{url: "/hook", wantErr: true},
+		{url: "http://127.0.0.1/hook", wantErr: true},
+		{url: "http://localhost/hook", wantErr: true},
+		{url: "http://169.254.169.254/latest/meta-data", wantErr: true},
+		{url: "http://10.0.0.1/hook", wantErr: true},
+		{url: "http://192.168.1.1/hook", wantErr: true},
+		{url: "http://172.16.0.1/hook", wantErr: true},
+		{url: "http://100.64.0.1/hook", wantErr: true},
+		{url: "http://[::1]/hook", wantErr: true},
+		{url: "http://[fd00::1]/hook", wantErr: true},
+		{url: "http://[::ffff:127.0.0.1]/hook", wantErr: true},
+		{url: "http://0.0.0.0/hook", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := d.ValidateURL(context.Background(), tt.url)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	d.allowedHosts = map[string]struct{}{"127.0.0.1": {}}
+	assert.NoError(t, d.ValidateURL(context.Background(), "http://127.0.0.1/hook"), "allowed hosts may be private")
+}
+
+func TestDispatcher_RefusesPrivateTargets(t *testing.T) {
+	var called atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	}))
+	defer server.Close()
+
+	d := NewDispatcher()
+	err := d.send(context.Background(), Endpoint{URL: server.URL}, EventPeerAdded, []byte("{}"))
+	require.Error(t, err, "delivery to a loopback address should be refused")
+	assert.False(t, called.Load())
+}
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"slices"
 	"strings"
 	"unicode/utf8"
 
@@ -539,3 +540,94 @@ func RemoveDuplicatePeerKeys(ctx context.Context, db *gorm.DB) error {
 
 	return nil
 }
+
+// MigrateGroupPeersAutoAssigned adds the auto_assigned column to the group memberships of the peers and marks the
+// existing memberships that match the auto groups of the peer's user as auto assigned, so that the reconciliation of
+// the user peer groups can remove them later. It only runs while the column doesn't exist, memberships changed once
+// the column is in place are left untouched
+func MigrateGroupPeersAutoAssigned[T any](ctx context.Context, db *gorm.DB) error {
+	var model T
+
+	if !db.Migrator().HasTable(&model) {
+		log.WithContext(ctx).Debugf("table for %T does not exist, no migration needed", model)
+		return nil
+	}
+
+	if db.Migrator().HasColumn(&model, "auto_assigned") {
+		log.WithContext(ctx).Debugf("column auto_assigned already exists in table for %T, no migration needed", model)
+		return nil
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&model); err != nil {
+		return fmt.Errorf("parse model: %w", err)
+	}
+	tableName := stmt.Schema.Table
+
+	var marked int
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Migrator().AddColumn(&model, "auto_assigned"); err != nil {
+			return fmt.Errorf("add column auto_assigned: %w", err)
+		}
+
+		if err := tx.Table(tableName).Where("1 = 1").Update("auto_assigned", false).Error; err != nil {
+			return fmt.Errorf("reset auto_assigned: %w", err)
+		}
+
+		if !tx.Migrator().HasTable("users") || !tx.Migrator().HasTable("peers") {
+			return nil
+		}
+
+		var users []struct {
+			ID         string
+			AutoGroups sql.NullString
+		}
+		if err := tx.Table("users").Select("id", "auto_groups").Find(&users).Error; err != nil {
+			return fmt.Errorf("find users: %w", err)
+		}
+
+		userAutoGroups := make(map[string][]string, len(users))
+		for _, user := range users {
+			if !user.AutoGroups.Valid || user.AutoGroups.String == "" {
+				continue
+			}
+			var autoGroups []string
+			if err := json.Unmarshal([]byte(user.AutoGroups.String), &autoGroups); err != nil {
+				log.WithContext(ctx).Warnf("failed to parse the auto groups of user %s: %v", user.ID, err)
+				continue
+			}
+			userAutoGroups[user.ID] = autoGroups
+		}
+
+		var memberships []struct {
+			GroupID string
+			PeerID  string
+			UserID  string
+		}
+		if err := tx.Table(tableName + " AS gp").
+			Select("gp.group_id, gp.peer_id, p.user_id").
+			Joins("JOIN peers AS p ON p.id = gp.peer_id").
+			Where("p.user_id <> ''").
+			Scan(&memberships).Error; err != nil {
+			return fmt.Errorf("find user peer memberships: %w", err)
+		}
+
+		for _, membership := range memberships {
+			if !slices.Contains(userAutoGroups[membership.UserID], membership.GroupID) {
+				continue
+			}
+			if err := tx.Table(tableName).
+				Where("group_id = ? AND peer_id = ?", membership.GroupID, membership.PeerID).
+				Update("auto_assigned", true).Error; err != nil {
+				return fmt.Errorf("mark membership of peer %s in group %s: %w", membership.PeerID, membership.GroupID, err)
+			}
+			marked++
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	log.WithContext(ctx).Infof("Migration of auto assigned group memberships in table %s completed, %d marked", tableName, marked)
+	return nil
+}
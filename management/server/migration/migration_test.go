@@ -441,3 +441,48 @@ func TestRemoveDuplicatePeerKeys_NoTable(t *testing.T) {
 	err := migration.RemoveDuplicatePeerKeys(context.Background(), db)
 	require.NoError(t, err, "Should not fail when table does not exist")
 }
+
+// legacyGroupPeer is the group membership of a peer before the auto assigned memberships were tracked
+type legacyGroupPeer struct {
+	AccountID string `gorm:"index"`
+	GroupID   string `gorm:"primaryKey"`
+	PeerID    string `gorm:"primaryKey"`
+}
+
+func (legacyGroupPeer) TableName() string {
+	return "group_peers"
+}
+
+func TestMigrateGroupPeersAutoAssigned(t *testing.T) {
+	db := setupDatabase(t)
+	require.NoError(t, db.Migrator().DropTable("group_peers"))
+	require.NoError(t, db.AutoMigrate(&nbpeer.Peer{}, &types.User{}, &legacyGroupPeer{}))
+
+	require.NoError(t, db.Save(&types.User{Id: "user", AccountID: "account", AutoGroups: []string{"auto"}}).Error)
+	require.NoError(t, db.Save(&nbpeer.Peer{ID: "user-peer", AccountID: "account", Key: "user-peer-key", UserID: "user", DNSLabel: "user-peer"}).Error)
+	require.NoError(t, db.Save(&nbpeer.Peer{ID: "key-peer", AccountID: "account", Key: "key-peer-key", DNSLabel: "key-peer"}).Error)
+	for _, membership := range []legacyGroupPeer{
+		{AccountID: "account", GroupID: "auto", PeerID: "user-peer"},
+		{AccountID: "account", GroupID: "manual", PeerID: "user-peer"},
+		{AccountID: "account", GroupID: "auto", PeerID: "key-peer"},
+	} {
+		require.NoError(t, db.Create(&membership).Error)
+	}
+
+	require.NoError(t, migration.MigrateGroupPeersAutoAssigned[types.GroupPeer](context.Background(), db))
+
+	var memberships []types.GroupPeer
+	require.NoError(t, db.Order("peer_id, group_id").Find(&memberships).Error)
+	assert.Equal(t, []types.GroupPeer{
+		{AccountID: "account", GroupID: "auto", PeerID: "key-peer", AutoAssigned: false},
+		{AccountID: "account", GroupID: "auto", PeerID: "user-peer", AutoAssigned: true},
+		{AccountID: "account", GroupID: "manual", PeerID: "user-peer", AutoAssigned: false},
+	}, memberships, "only the memberships matching the auto groups of the peer's user should be marked")
+
+	// once the column exists the memberships are left to the reconciliation
+	require.NoError(t, db.Model(&types.GroupPeer{}).Where("peer_id = ?", "user-peer").Update("auto_assigned", false).Error)
+	require.NoError(t, migration.MigrateGroupPeersAutoAssigned[types.GroupPeer](context.Background(), db))
+	var marked int64
+	require.NoError(t, db.Model(&types.GroupPeer{}).Where("auto_assigned = ?", true).Count(&marked).Error)
+	assert.Zero(t, marked)
+}
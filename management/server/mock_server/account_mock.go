@@ -12,6 +12,7 @@ import (
 	"google.golang.org/grpc/status"
 
 	nbdns "github.com/netbirdio/netbird/dns"
+	"github.com/netbirdio/netbird/management/internals/controllers/network_map"
 	"github.com/netbirdio/netbird/management/server/account"
 	"github.com/netbirdio/netbird/management/server/activity"
 	"github.com/netbirdio/netbird/management/server/idp"
@@ -30,17 +31,44 @@ type MockAccountManager struct {
 	GetOrCreateAccountByUserFunc func(ctx context.Context, userAuth auth.UserAuth) (*types.Account, error)
 	GetAccountFunc               func(ctx context.Context, accountID string) (*types.Account, error)
 	CreateSetupKeyFunc           func(ctx context.Context, accountId string, keyName string, keyType types.SetupKeyType,
-		expiresIn time.Duration, autoGroups []string, usageLimit int, userID string, ephemeral bool, allowExtraDNSLabels bool) (*types.SetupKey, error)
+		expiresIn time.Duration, autoGroups []string, usageLimit int, userID string, opts types.SetupKeyOptions) (*types.SetupKey, error)
 	GetSetupKeyFunc                       func(ctx context.Context, accountID, userID, keyID string) (*types.SetupKey, error)
+	ValidateSetupKeyFunc                  func(ctx context.Context, setupKey string) (*types.SetupKeyValidation, error)
+	ReportSchedulerHealthFunc             func() []*types.AccountSchedulerHealth
 	AccountExistsFunc                     func(ctx context.Context, accountID string) (bool, error)
 	GetAccountIDByUserIdFunc              func(ctx context.Context, userAuth auth.UserAuth) (string, error)
 	GetUserFromUserAuthFunc               func(ctx context.Context, userAuth auth.UserAuth) (*types.User, error)
 	ListUsersFunc                         func(ctx context.Context, accountID string) ([]*types.User, error)
-	GetPeersFunc                          func(ctx context.Context, accountID, userID, nameFilter, ipFilter string) ([]*nbpeer.Peer, error)
+	GetPeersFunc                          func(ctx context.Context, accountID, userID string, filters store.PeerFilters) ([]*nbpeer.Peer, error)
+	CountPeersFunc                        func(ctx context.Context, accountID, userID string, filters store.PeerFilters) (int, error)
+	RefreshPeerOwnerEmailsFunc            func(ctx context.Context, accountID, userID string) (int, error)
+	GetPeersMissingGroupsFunc             func(ctx context.Context, accountID, userID string) ([]*nbpeer.Peer, error)
+	GetOrphanedPeersFunc                  func(ctx context.Context, accountID, userID string) ([]*nbpeer.Peer, error)
+	ReassignOrphanedPeersFunc             func(ctx context.Context, accountID, userID, newOwnerID string) (int, error)
+	DeleteOrphanedPeersFunc               func(ctx context.Context, accountID, userID string) (int, error)
+	DeletePeersBySetupKeyFunc             func(ctx context.Context, accountID, userID, setupKeyID string) (int, []string, int, error)
+	GetPeersByCountryFunc                 func(ctx context.Context, accountID, userID, countryCode string) ([]*nbpeer.Peer, error)
+	GetPeersByRelayFunc                   func(ctx context.Context, accountID, userID, relayID string) ([]*nbpeer.Peer, error)
+	GetPeersPendingApprovalFunc           func(ctx context.Context, accountID, userID string) ([]*nbpeer.Peer, error)
+	GetPeerRolesFunc                      func(ctx context.Context, accountID, userID, peerID string) (*types.PeerRoles, error)
+	ExportAccountPeersFunc                func(ctx context.Context, accountID, userID string) (*types.PeersExport, error)
+	ImportAccountPeersFunc                func(ctx context.Context, accountID, userID string, export *types.PeersExport) ([]*nbpeer.Peer, error)
+	TransferPeerFunc                      func(ctx context.Context, srcAccountID, dstAccountID, peerID, userID string) (*nbpeer.Peer, error)
+	SetPeerPinnedFunc                     func(ctx context.Context, accountID, userID, peerID string, pinned bool) error
+	UpdatePeerFirewallOverridesFunc       func(ctx context.Context, accountID, userID, peerID string, overrides []nbpeer.FirewallOverride) (*nbpeer.Peer, error)
 	MarkPeerConnectedFunc                 func(ctx context.Context, peerKey string, connected bool, realIP net.IP) error
-	SyncAndMarkPeerFunc                   func(ctx context.Context, accountID string, peerPubKey string, meta nbpeer.PeerSystemMeta, realIP net.IP) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, int64, error)
+	SyncAndMarkPeerFunc                   func(ctx context.Context, accountID string, peerPubKey string, meta nbpeer.PeerSystemMeta, realIP net.IP, realPort uint16) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, int64, error)
 	DeletePeerFunc                        func(ctx context.Context, accountID, peerKey, userID string) error
 	GetNetworkMapFunc                     func(ctx context.Context, peerKey string) (*types.NetworkMap, error)
+	GetPeerNetworkMapStatsFunc            func(ctx context.Context, peerID string) (*types.NetworkMapStats, error)
+	GetPeerDNSConfigFunc                  func(ctx context.Context, accountID, userID, peerID string) (*nbdns.Config, error)
+	DiffPeerNetworkMapsFunc               func(ctx context.Context, accountID, userID, peerAID, peerBID string) (*types.NetworkMapDiff, error)
+	GenerateDebugWGConfigFunc             func(ctx context.Context, accountID, userID, peerID string) (string, error)
+	GetPeerExitNodeFunc                   func(ctx context.Context, accountID, userID, peerID string) (*types.PeerExitNode, error)
+	GetPeersByVersionFunc                 func(ctx context.Context, accountID, userID, versionConstraint string) ([]*nbpeer.Peer, error)
+	GetPeersWithIngressPortsFunc          func(ctx context.Context, accountID, userID string) ([]*types.PeerIngressPorts, error)
+	GetEphemeralPeersPendingCleanupFunc   func(ctx context.Context, accountID, userID string) ([]*types.EphemeralPeerCleanup, error)
+	GetBufferUpdateStateFunc              func(ctx context.Context, accountID, userID string) (*network_map.AccountBufferUpdateState, error)
 	GetPeerNetworkFunc                    func(ctx context.Context, peerKey string) (*types.Network, error)
 	AddPeerFunc                           func(ctx context.Context, accountID string, setupKey string, userId string, peer *nbpeer.Peer, temporary bool) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, error)
 	GetGroupFunc                          func(ctx context.Context, accountID, groupID, userID string) (*types.Group, error)
@@ -52,16 +80,19 @@ type MockAccountManager struct {
 	DeleteGroupsFunc                      func(ctx context.Context, accountId, userId string, groupIDs []string) error
 	GroupAddPeerFunc                      func(ctx context.Context, accountID, groupID, peerID string) error
 	GroupDeletePeerFunc                   func(ctx context.Context, accountID, groupID, peerID string) error
+	RemovePeersFromGroupsFunc             func(ctx context.Context, accountID, userID string, peerIDs, groupIDs []string) (int, error)
 	GetPeerGroupsFunc                     func(ctx context.Context, accountID, peerID string) ([]*types.Group, error)
 	DeleteRuleFunc                        func(ctx context.Context, accountID, ruleID, userID string) error
 	GetPolicyFunc                         func(ctx context.Context, accountID, policyID, userID string) (*types.Policy, error)
 	SavePolicyFunc                        func(ctx context.Context, accountID, userID string, policy *types.Policy, create bool) (*types.Policy, error)
 	DeletePolicyFunc                      func(ctx context.Context, accountID, policyID, userID string) error
 	ListPoliciesFunc                      func(ctx context.Context, accountID, userID string) ([]*types.Policy, error)
+	ExplainPeerAccessFunc                 func(ctx context.Context, accountID, userID, srcPeerID, dstPeerID string) (*types.PeerAccessExplanation, error)
 	GetUsersFromAccountFunc               func(ctx context.Context, accountID, userID string) (map[string]*types.UserInfo, error)
 	UpdatePeerMetaFunc                    func(ctx context.Context, peerID string, meta nbpeer.PeerSystemMeta) error
 	UpdatePeerFunc                        func(ctx context.Context, accountID, userID string, peer *nbpeer.Peer) (*nbpeer.Peer, error)
 	UpdatePeerIPFunc                      func(ctx context.Context, accountID, userID, peerID string, newIP netip.Addr) error
+	UpdatePeerAdminNotesFunc              func(ctx context.Context, accountID, userID, peerID, notes string) (*nbpeer.Peer, error)
 	CreateRouteFunc                       func(ctx context.Context, accountID string, prefix netip.Prefix, networkType route.NetworkType, domains domain.List, peer string, peerGroups []string, description string, netID route.NetID, masquerade bool, metric int, groups, accessControlGroupIDs []string, enabled bool, userID string, keepRoute bool, isSelected bool) (*route.Route, error)
 	GetRouteFunc                          func(ctx context.Context, accountID string, routeID route.ID, userID string) (*route.Route, error)
 	SaveRouteFunc                         func(ctx context.Context, accountID string, userID string, route *route.Route) error
@@ -90,15 +121,25 @@ type MockAccountManager struct {
 	GetDNSDomainFunc                      func(settings *types.Settings) string
 	StoreEventFunc                        func(ctx context.Context, initiatorID, targetID, accountID string, activityID activity.ActivityDescriber, meta map[string]any)
 	GetEventsFunc                         func(ctx context.Context, accountID, userID string) ([]*activity.Event, error)
+	StreamAccountEventsFunc               func(ctx context.Context, accountID, userID string, from time.Time) (*activity.EventsReader, error)
+	GetPeerCountHistoryFunc               func(ctx context.Context, accountID, userID string, from, to time.Time, bucket types.PeerCountHistoryBucket) ([]*types.PeerCountDelta, error)
 	GetDNSSettingsFunc                    func(ctx context.Context, accountID, userID string) (*types.DNSSettings, error)
 	SaveDNSSettingsFunc                   func(ctx context.Context, accountID, userID string, dnsSettingsToSave *types.DNSSettings) error
 	GetPeerFunc                           func(ctx context.Context, accountID, peerID, userID string) (*nbpeer.Peer, error)
+	CanAllocatePeersFunc                  func(ctx context.Context, accountID, userID string, count int) (bool, int, error)
+	GetPeersByPubKeyPrefixFunc            func(ctx context.Context, accountID, userID, prefix string) ([]*nbpeer.Peer, error)
+	GetPeerFastFunc                       func(ctx context.Context, accountID, peerID, userID string) (*nbpeer.Peer, error)
+	GetPeersByIDsFunc                     func(ctx context.Context, accountID, userID string, peerIDs []string) (map[string]*nbpeer.Peer, []string, error)
+	GetPeerFQDNsFunc                      func(ctx context.Context, accountID, userID, peerID string) ([]string, error)
+	DisconnectPeerFunc                    func(ctx context.Context, accountID, peerID, userID string, markDisconnected bool) error
+	SetGroupSSHEnabledFunc                func(ctx context.Context, accountID, userID, groupID string, enabled bool) (int, error)
 	UpdateAccountSettingsFunc             func(ctx context.Context, accountID, userID string, newSettings *types.Settings) (*types.Settings, error)
 	LoginPeerFunc                         func(ctx context.Context, login types.PeerLogin) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, error)
 	SyncPeerFunc                          func(ctx context.Context, sync types.PeerSync, accountID string) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, int64, error)
 	InviteUserFunc                        func(ctx context.Context, accountID string, initiatorUserID string, targetUserEmail string) error
 	ApproveUserFunc                       func(ctx context.Context, accountID, initiatorUserID, targetUserID string) (*types.UserInfo, error)
 	RejectUserFunc                        func(ctx context.Context, accountID, initiatorUserID, targetUserID string) error
+	ReconcileUserPeerGroupsFunc           func(ctx context.Context, accountID, initiatorUserID, targetUserID string, removeStale bool) error
 	GetAllConnectedPeersFunc              func() (map[string]struct{}, error)
 	HasConnectedChannelFunc               func(peerID string) bool
 	GetExternalCacheManagerFunc           func() account.ExternalCacheManager
@@ -106,10 +147,17 @@ type MockAccountManager struct {
 	SavePostureChecksFunc                 func(ctx context.Context, accountID, userID string, postureChecks *posture.Checks, create bool) (*posture.Checks, error)
 	DeletePostureChecksFunc               func(ctx context.Context, accountID, postureChecksID, userID string) error
 	ListPostureChecksFunc                 func(ctx context.Context, accountID, userID string) ([]*posture.Checks, error)
+	GetPeerPostureContextFunc             func(ctx context.Context, accountID, userID, peerID string) ([]*types.PeerPostureCheckSource, error)
 	GetIdpManagerFunc                     func() idp.Manager
 	UpdateIntegratedValidatorFunc         func(ctx context.Context, accountID, userID, validator string, groups []string) error
 	GroupValidationFunc                   func(ctx context.Context, accountId string, groups []string) (bool, error)
 	SyncPeerMetaFunc                      func(ctx context.Context, peerPubKey string, meta nbpeer.PeerSystemMeta) error
+	UpdatePeerLastHandshakeFunc           func(ctx context.Context, peerPubKey string, lastHandshake time.Time) error
+	UpdatePeerAppliedSerialFunc           func(ctx context.Context, peerPubKey string, serial uint64) error
+	GetPeerAppliedSerialFunc              func(ctx context.Context, accountID, peerID, userID string) (uint64, error)
+	UpdatePeerReportedErrorsFunc          func(ctx context.Context, peerPubKey string, reportedErrors []nbpeer.ReportedError) error
+	RecordPeerUsageFunc                   func(ctx context.Context, peerPubKey string, rxCounter, txCounter int64) error
+	GetPeerUsageFunc                      func(ctx context.Context, accountID, userID, peerID string, window time.Duration) (*nbpeer.Usage, error)
 	FindExistingPostureCheckFunc          func(accountID string, checks *posture.ChecksDefinition) (*posture.Checks, error)
 	GetAccountIDForPeerKeyFunc            func(ctx context.Context, peerKey string) (string, error)
 	GetAccountByIDFunc                    func(ctx context.Context, accountID string, userID string) (*types.Account, error)
@@ -129,6 +177,9 @@ type MockAccountManager struct {
 	AllowSyncFunc                  func(string, uint64) bool
 	UpdateAccountPeersFunc         func(ctx context.Context, accountID string)
 	BufferUpdateAccountPeersFunc   func(ctx context.Context, accountID string)
+	ForceAccountResyncFunc         func(ctx context.Context, accountID, userID string) error
+	SetPeerUpdatesPausedFunc       func(ctx context.Context, accountID, peerID string, paused bool, userID string) error
+	RenewExpiredPeerLoginsFunc     func(ctx context.Context, accountID, userID string) (int, error)
 	RecalculateNetworkMapCacheFunc func(ctx context.Context, accountId string) error
 
 	GetIdentityProviderFunc    func(ctx context.Context, accountID, idpID, userID string) (*types.IdentityProvider, error)
@@ -207,6 +258,30 @@ func (am *MockAccountManager) BufferUpdateAccountPeers(ctx context.Context, acco
 	}
 }
 
+// ForceAccountResync mocks ForceAccountResync of the AccountManager interface
+func (am *MockAccountManager) ForceAccountResync(ctx context.Context, accountID, userID string) error {
+	if am.ForceAccountResyncFunc != nil {
+		return am.ForceAccountResyncFunc(ctx, accountID, userID)
+	}
+	return status.Errorf(codes.Unimplemented, "method ForceAccountResync is not implemented")
+}
+
+// SetPeerUpdatesPaused mocks SetPeerUpdatesPaused of the AccountManager interface
+func (am *MockAccountManager) SetPeerUpdatesPaused(ctx context.Context, accountID, peerID string, paused bool, userID string) error {
+	if am.SetPeerUpdatesPausedFunc != nil {
+		return am.SetPeerUpdatesPausedFunc(ctx, accountID, peerID, paused, userID)
+	}
+	return status.Errorf(codes.Unimplemented, "method SetPeerUpdatesPaused is not implemented")
+}
+
+// RenewExpiredPeerLogins mocks RenewExpiredPeerLogins of the AccountManager interface
+func (am *MockAccountManager) RenewExpiredPeerLogins(ctx context.Context, accountID, userID string) (int, error) {
+	if am.RenewExpiredPeerLoginsFunc != nil {
+		return am.RenewExpiredPeerLoginsFunc(ctx, accountID, userID)
+	}
+	return 0, status.Errorf(codes.Unimplemented, "method RenewExpiredPeerLogins is not implemented")
+}
+
 func (am *MockAccountManager) DeleteSetupKey(ctx context.Context, accountID, userID, keyID string) error {
 	if am.DeleteSetupKeyFunc != nil {
 		return am.DeleteSetupKeyFunc(ctx, accountID, userID, keyID)
@@ -214,9 +289,9 @@ func (am *MockAccountManager) DeleteSetupKey(ctx context.Context, accountID, use
 	return status.Errorf(codes.Unimplemented, "method DeleteSetupKey is not implemented")
 }
 
-func (am *MockAccountManager) SyncAndMarkPeer(ctx context.Context, accountID string, peerPubKey string, meta nbpeer.PeerSystemMeta, realIP net.IP) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, int64, error) {
+func (am *MockAccountManager) SyncAndMarkPeer(ctx context.Context, accountID string, peerPubKey string, meta nbpeer.PeerSystemMeta, realIP net.IP, realPort uint16) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, int64, error) {
 	if am.SyncAndMarkPeerFunc != nil {
-		return am.SyncAndMarkPeerFunc(ctx, accountID, peerPubKey, meta, realIP)
+		return am.SyncAndMarkPeerFunc(ctx, accountID, peerPubKey, meta, realIP, realPort)
 	}
 	return nil, nil, nil, 0, status.Errorf(codes.Unimplemented, "method MarkPeerConnected is not implemented")
 }
@@ -294,11 +369,10 @@ func (am *MockAccountManager) CreateSetupKey(
 	autoGroups []string,
 	usageLimit int,
 	userID string,
-	ephemeral bool,
-	allowExtraDNSLabels bool,
+	opts types.SetupKeyOptions,
 ) (*types.SetupKey, error) {
 	if am.CreateSetupKeyFunc != nil {
-		return am.CreateSetupKeyFunc(ctx, accountID, keyName, keyType, expiresIn, autoGroups, usageLimit, userID, ephemeral, allowExtraDNSLabels)
+		return am.CreateSetupKeyFunc(ctx, accountID, keyName, keyType, expiresIn, autoGroups, usageLimit, userID, opts)
 	}
 	return nil, status.Errorf(codes.Unimplemented, "method CreateSetupKey is not implemented")
 }
@@ -323,7 +397,7 @@ func (am *MockAccountManager) GetAccountIDByUserID(ctx context.Context, userAuth
 }
 
 // MarkPeerConnected mock implementation of MarkPeerConnected from server.AccountManager interface
-func (am *MockAccountManager) MarkPeerConnected(ctx context.Context, peerKey string, connected bool, realIP net.IP, accountID string) error {
+func (am *MockAccountManager) MarkPeerConnected(ctx context.Context, peerKey string, connected bool, realIP net.IP, realPort uint16, accountID string) error {
 	if am.MarkPeerConnectedFunc != nil {
 		return am.MarkPeerConnectedFunc(ctx, peerKey, connected, realIP)
 	}
@@ -378,6 +452,78 @@ func (am *MockAccountManager) GetNetworkMap(ctx context.Context, peerKey string)
 	return nil, status.Errorf(codes.Unimplemented, "method GetNetworkMap is not implemented")
 }
 
+// GetPeerNetworkMapStats mocks GetPeerNetworkMapStats of the AccountManager interface
+func (am *MockAccountManager) GetPeerNetworkMapStats(ctx context.Context, peerID string) (*types.NetworkMapStats, error) {
+	if am.GetPeerNetworkMapStatsFunc != nil {
+		return am.GetPeerNetworkMapStatsFunc(ctx, peerID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeerNetworkMapStats is not implemented")
+}
+
+// GetPeerDNSConfig mock implementation of GetPeerDNSConfig from server.AccountManager interface
+func (am *MockAccountManager) GetPeerDNSConfig(ctx context.Context, accountID, userID, peerID string) (*nbdns.Config, error) {
+	if am.GetPeerDNSConfigFunc != nil {
+		return am.GetPeerDNSConfigFunc(ctx, accountID, userID, peerID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeerDNSConfig is not implemented")
+}
+
+// DiffPeerNetworkMaps mock implementation of DiffPeerNetworkMaps from server.AccountManager interface
+func (am *MockAccountManager) DiffPeerNetworkMaps(ctx context.Context, accountID, userID, peerAID, peerBID string) (*types.NetworkMapDiff, error) {
+	if am.DiffPeerNetworkMapsFunc != nil {
+		return am.DiffPeerNetworkMapsFunc(ctx, accountID, userID, peerAID, peerBID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method DiffPeerNetworkMaps is not implemented")
+}
+
+// GenerateDebugWGConfig mock implementation of GenerateDebugWGConfig from server.AccountManager interface
+func (am *MockAccountManager) GenerateDebugWGConfig(ctx context.Context, accountID, userID, peerID string) (string, error) {
+	if am.GenerateDebugWGConfigFunc != nil {
+		return am.GenerateDebugWGConfigFunc(ctx, accountID, userID, peerID)
+	}
+	return "", status.Errorf(codes.Unimplemented, "method GenerateDebugWGConfig is not implemented")
+}
+
+// GetPeerExitNode mock implementation of GetPeerExitNode from server.AccountManager interface
+func (am *MockAccountManager) GetPeerExitNode(ctx context.Context, accountID, userID, peerID string) (*types.PeerExitNode, error) {
+	if am.GetPeerExitNodeFunc != nil {
+		return am.GetPeerExitNodeFunc(ctx, accountID, userID, peerID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeerExitNode is not implemented")
+}
+
+// GetPeersByVersion mock implementation of GetPeersByVersion from server.AccountManager interface
+func (am *MockAccountManager) GetPeersByVersion(ctx context.Context, accountID, userID, versionConstraint string) ([]*nbpeer.Peer, error) {
+	if am.GetPeersByVersionFunc != nil {
+		return am.GetPeersByVersionFunc(ctx, accountID, userID, versionConstraint)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeersByVersion is not implemented")
+}
+
+// GetPeersWithIngressPorts mock implementation of GetPeersWithIngressPorts from server.AccountManager interface
+func (am *MockAccountManager) GetPeersWithIngressPorts(ctx context.Context, accountID, userID string) ([]*types.PeerIngressPorts, error) {
+	if am.GetPeersWithIngressPortsFunc != nil {
+		return am.GetPeersWithIngressPortsFunc(ctx, accountID, userID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeersWithIngressPorts is not implemented")
+}
+
+// GetEphemeralPeersPendingCleanup mock implementation of GetEphemeralPeersPendingCleanup from server.AccountManager interface
+func (am *MockAccountManager) GetEphemeralPeersPendingCleanup(ctx context.Context, accountID, userID string) ([]*types.EphemeralPeerCleanup, error) {
+	if am.GetEphemeralPeersPendingCleanupFunc != nil {
+		return am.GetEphemeralPeersPendingCleanupFunc(ctx, accountID, userID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetEphemeralPeersPendingCleanup is not implemented")
+}
+
+// GetBufferUpdateState mock implementation of GetBufferUpdateState from server.AccountManager interface
+func (am *MockAccountManager) GetBufferUpdateState(ctx context.Context, accountID, userID string) (*network_map.AccountBufferUpdateState, error) {
+	if am.GetBufferUpdateStateFunc != nil {
+		return am.GetBufferUpdateStateFunc(ctx, accountID, userID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetBufferUpdateState is not implemented")
+}
+
 // GetPeerNetwork mock implementation of GetPeerNetwork from server.AccountManager interface
 func (am *MockAccountManager) GetPeerNetwork(ctx context.Context, peerKey string) (*types.Network, error) {
 	if am.GetPeerNetworkFunc != nil {
@@ -457,6 +603,14 @@ func (am *MockAccountManager) GroupDeletePeer(ctx context.Context, accountID, gr
 	return status.Errorf(codes.Unimplemented, "method GroupDeletePeer is not implemented")
 }
 
+// RemovePeersFromGroups mock implementation of RemovePeersFromGroups from server.AccountManager interface
+func (am *MockAccountManager) RemovePeersFromGroups(ctx context.Context, accountID, userID string, peerIDs, groupIDs []string) (int, error) {
+	if am.RemovePeersFromGroupsFunc != nil {
+		return am.RemovePeersFromGroupsFunc(ctx, accountID, userID, peerIDs, groupIDs)
+	}
+	return 0, status.Errorf(codes.Unimplemented, "method RemovePeersFromGroups is not implemented")
+}
+
 // DeleteRule mock implementation of DeleteRule from server.AccountManager interface
 func (am *MockAccountManager) DeleteRule(ctx context.Context, accountID, ruleID, userID string) error {
 	if am.DeleteRuleFunc != nil {
@@ -497,6 +651,14 @@ func (am *MockAccountManager) ListPolicies(ctx context.Context, accountID, userI
 	return nil, status.Errorf(codes.Unimplemented, "method ListPolicies is not implemented")
 }
 
+// ExplainPeerAccess mock implementation of ExplainPeerAccess from server.AccountManager interface
+func (am *MockAccountManager) ExplainPeerAccess(ctx context.Context, accountID, userID, srcPeerID, dstPeerID string) (*types.PeerAccessExplanation, error) {
+	if am.ExplainPeerAccessFunc != nil {
+		return am.ExplainPeerAccessFunc(ctx, accountID, userID, srcPeerID, dstPeerID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method ExplainPeerAccess is not implemented")
+}
+
 // UpdatePeerMeta mock implementation of UpdatePeerMeta from server.AccountManager interface
 func (am *MockAccountManager) UpdatePeerMeta(ctx context.Context, peerID string, meta nbpeer.PeerSystemMeta) error {
 	if am.UpdatePeerMetaFunc != nil {
@@ -535,6 +697,14 @@ func (am *MockAccountManager) UpdatePeerIP(ctx context.Context, accountID, userI
 	return status.Errorf(codes.Unimplemented, "method UpdatePeerIP is not implemented")
 }
 
+// UpdatePeerAdminNotes mock implementation of UpdatePeerAdminNotes from server.AccountManager interface
+func (am *MockAccountManager) UpdatePeerAdminNotes(ctx context.Context, accountID, userID, peerID, notes string) (*nbpeer.Peer, error) {
+	if am.UpdatePeerAdminNotesFunc != nil {
+		return am.UpdatePeerAdminNotesFunc(ctx, accountID, userID, peerID, notes)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method UpdatePeerAdminNotes is not implemented")
+}
+
 // CreateRoute mock implementation of CreateRoute from server.AccountManager interface
 func (am *MockAccountManager) CreateRoute(ctx context.Context, accountID string, prefix netip.Prefix, networkType route.NetworkType, domains domain.List, peerID string, peerGroupIDs []string, description string, netID route.NetID, masquerade bool, metric int, groups, accessControlGroupID []string, enabled bool, userID string, keepRoute bool, isSelected bool) (*route.Route, error) {
 	if am.CreateRouteFunc != nil {
@@ -593,6 +763,23 @@ func (am *MockAccountManager) GetSetupKey(ctx context.Context, accountID, userID
 	return nil, status.Errorf(codes.Unimplemented, "method GetSetupKey is not implemented")
 }
 
+// ValidateSetupKey mocks ValidateSetupKey of the AccountManager interface
+func (am *MockAccountManager) ValidateSetupKey(ctx context.Context, setupKey string) (*types.SetupKeyValidation, error) {
+	if am.ValidateSetupKeyFunc != nil {
+		return am.ValidateSetupKeyFunc(ctx, setupKey)
+	}
+
+	return nil, status.Errorf(codes.Unimplemented, "method ValidateSetupKey is not implemented")
+}
+
+// ReportSchedulerHealth mocks ReportSchedulerHealth of the AccountManager interface
+func (am *MockAccountManager) ReportSchedulerHealth() []*types.AccountSchedulerHealth {
+	if am.ReportSchedulerHealthFunc != nil {
+		return am.ReportSchedulerHealthFunc()
+	}
+	return nil
+}
+
 // ListSetupKeys mocks ListSetupKeys of the AccountManager interface
 func (am *MockAccountManager) ListSetupKeys(ctx context.Context, accountID, userID string) ([]*types.SetupKey, error) {
 	if am.ListSetupKeysFunc != nil {
@@ -671,6 +858,14 @@ func (am *MockAccountManager) RejectUser(ctx context.Context, accountID, initiat
 	return status.Errorf(codes.Unimplemented, "method RejectUser is not implemented")
 }
 
+// ReconcileUserPeerGroups mocks ReconcileUserPeerGroups of the AccountManager interface
+func (am *MockAccountManager) ReconcileUserPeerGroups(ctx context.Context, accountID, initiatorUserID, targetUserID string, removeStale bool) error {
+	if am.ReconcileUserPeerGroupsFunc != nil {
+		return am.ReconcileUserPeerGroupsFunc(ctx, accountID, initiatorUserID, targetUserID, removeStale)
+	}
+	return status.Errorf(codes.Unimplemented, "method ReconcileUserPeerGroups is not implemented")
+}
+
 // GetNameServerGroup mocks GetNameServerGroup of the AccountManager interface
 func (am *MockAccountManager) GetNameServerGroup(ctx context.Context, accountID, userID, nsGroupID string) (*nbdns.NameServerGroup, error) {
 	if am.GetNameServerGroupFunc != nil {
@@ -769,13 +964,141 @@ func (am *MockAccountManager) GetAccountIDFromUserAuth(ctx context.Context, user
 }
 
 // GetPeers mocks GetPeers of the AccountManager interface
-func (am *MockAccountManager) GetPeers(ctx context.Context, accountID, userID, nameFilter, ipFilter string) ([]*nbpeer.Peer, error) {
+func (am *MockAccountManager) GetPeers(ctx context.Context, accountID, userID string, filters store.PeerFilters) ([]*nbpeer.Peer, error) {
 	if am.GetPeersFunc != nil {
-		return am.GetPeersFunc(ctx, accountID, userID, nameFilter, ipFilter)
+		return am.GetPeersFunc(ctx, accountID, userID, filters)
 	}
 	return nil, status.Errorf(codes.Unimplemented, "method GetPeers is not implemented")
 }
 
+// CountPeers mocks CountPeers of the AccountManager interface
+func (am *MockAccountManager) CountPeers(ctx context.Context, accountID, userID string, filters store.PeerFilters) (int, error) {
+	if am.CountPeersFunc != nil {
+		return am.CountPeersFunc(ctx, accountID, userID, filters)
+	}
+	return 0, status.Errorf(codes.Unimplemented, "method CountPeers is not implemented")
+}
+
+// RefreshPeerOwnerEmails mocks RefreshPeerOwnerEmails of the AccountManager interface
+func (am *MockAccountManager) RefreshPeerOwnerEmails(ctx context.Context, accountID, userID string) (int, error) {
+	if am.RefreshPeerOwnerEmailsFunc != nil {
+		return am.RefreshPeerOwnerEmailsFunc(ctx, accountID, userID)
+	}
+	return 0, status.Errorf(codes.Unimplemented, "method RefreshPeerOwnerEmails is not implemented")
+}
+
+// GetPeersMissingGroups mocks GetPeersMissingGroups of the AccountManager interface
+func (am *MockAccountManager) GetPeersMissingGroups(ctx context.Context, accountID, userID string) ([]*nbpeer.Peer, error) {
+	if am.GetPeersMissingGroupsFunc != nil {
+		return am.GetPeersMissingGroupsFunc(ctx, accountID, userID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeersMissingGroups is not implemented")
+}
+
+// GetOrphanedPeers mocks GetOrphanedPeers of the AccountManager interface
+func (am *MockAccountManager) GetOrphanedPeers(ctx context.Context, accountID, userID string) ([]*nbpeer.Peer, error) {
+	if am.GetOrphanedPeersFunc != nil {
+		return am.GetOrphanedPeersFunc(ctx, accountID, userID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrphanedPeers is not implemented")
+}
+
+// ReassignOrphanedPeers mocks ReassignOrphanedPeers of the AccountManager interface
+func (am *MockAccountManager) ReassignOrphanedPeers(ctx context.Context, accountID, userID, newOwnerID string) (int, error) {
+	if am.ReassignOrphanedPeersFunc != nil {
+		return am.ReassignOrphanedPeersFunc(ctx, accountID, userID, newOwnerID)
+	}
+	return 0, status.Errorf(codes.Unimplemented, "method ReassignOrphanedPeers is not implemented")
+}
+
+// DeleteOrphanedPeers mocks DeleteOrphanedPeers of the AccountManager interface
+func (am *MockAccountManager) DeleteOrphanedPeers(ctx context.Context, accountID, userID string) (int, error) {
+	if am.DeleteOrphanedPeersFunc != nil {
+		return am.DeleteOrphanedPeersFunc(ctx, accountID, userID)
+	}
+	return 0, status.Errorf(codes.Unimplemented, "method DeleteOrphanedPeers is not implemented")
+}
+
+// DeletePeersBySetupKey mocks DeletePeersBySetupKey of the AccountManager interface
+func (am *MockAccountManager) DeletePeersBySetupKey(ctx context.Context, accountID, userID, setupKeyID string) (int, []string, int, error) {
+	if am.DeletePeersBySetupKeyFunc != nil {
+		return am.DeletePeersBySetupKeyFunc(ctx, accountID, userID, setupKeyID)
+	}
+	return 0, nil, 0, status.Errorf(codes.Unimplemented, "method DeletePeersBySetupKey is not implemented")
+}
+
+// GetPeersByCountry mocks GetPeersByCountry of the AccountManager interface
+func (am *MockAccountManager) GetPeersByCountry(ctx context.Context, accountID, userID, countryCode string) ([]*nbpeer.Peer, error) {
+	if am.GetPeersByCountryFunc != nil {
+		return am.GetPeersByCountryFunc(ctx, accountID, userID, countryCode)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeersByCountry is not implemented")
+}
+
+// GetPeersByRelay mocks GetPeersByRelay of the AccountManager interface
+func (am *MockAccountManager) GetPeersByRelay(ctx context.Context, accountID, userID, relayID string) ([]*nbpeer.Peer, error) {
+	if am.GetPeersByRelayFunc != nil {
+		return am.GetPeersByRelayFunc(ctx, accountID, userID, relayID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeersByRelay is not implemented")
+}
+
+// GetPeersPendingApproval mocks GetPeersPendingApproval of the AccountManager interface
+func (am *MockAccountManager) GetPeersPendingApproval(ctx context.Context, accountID, userID string) ([]*nbpeer.Peer, error) {
+	if am.GetPeersPendingApprovalFunc != nil {
+		return am.GetPeersPendingApprovalFunc(ctx, accountID, userID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeersPendingApproval is not implemented")
+}
+
+// GetPeerRoles mocks GetPeerRoles of the AccountManager interface
+func (am *MockAccountManager) GetPeerRoles(ctx context.Context, accountID, userID, peerID string) (*types.PeerRoles, error) {
+	if am.GetPeerRolesFunc != nil {
+		return am.GetPeerRolesFunc(ctx, accountID, userID, peerID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeerRoles is not implemented")
+}
+
+// ExportAccountPeers mocks ExportAccountPeers of the AccountManager interface
+func (am *MockAccountManager) ExportAccountPeers(ctx context.Context, accountID, userID string) (*types.PeersExport, error) {
+	if am.ExportAccountPeersFunc != nil {
+		return am.ExportAccountPeersFunc(ctx, accountID, userID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method ExportAccountPeers is not implemented")
+}
+
+// ImportAccountPeers mocks ImportAccountPeers of the AccountManager interface
+func (am *MockAccountManager) ImportAccountPeers(ctx context.Context, accountID, userID string, export *types.PeersExport) ([]*nbpeer.Peer, error) {
+	if am.ImportAccountPeersFunc != nil {
+		return am.ImportAccountPeersFunc(ctx, accountID, userID, export)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method ImportAccountPeers is not implemented")
+}
+
+// TransferPeer mocks TransferPeer of the AccountManager interface
+func (am *MockAccountManager) TransferPeer(ctx context.Context, srcAccountID, dstAccountID, peerID, userID string) (*nbpeer.Peer, error) {
+	if am.TransferPeerFunc != nil {
+		return am.TransferPeerFunc(ctx, srcAccountID, dstAccountID, peerID, userID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method TransferPeer is not implemented")
+}
+
+// UpdatePeerFirewallOverrides mocks UpdatePeerFirewallOverrides of the AccountManager interface
+func (am *MockAccountManager) UpdatePeerFirewallOverrides(ctx context.Context, accountID, userID, peerID string, overrides []nbpeer.FirewallOverride) (*nbpeer.Peer, error) {
+	if am.UpdatePeerFirewallOverridesFunc != nil {
+		return am.UpdatePeerFirewallOverridesFunc(ctx, accountID, userID, peerID, overrides)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method UpdatePeerFirewallOverrides is not implemented")
+}
+
+// SetPeerPinned mocks SetPeerPinned of the AccountManager interface
+func (am *MockAccountManager) SetPeerPinned(ctx context.Context, accountID, userID, peerID string, pinned bool) error {
+	if am.SetPeerPinnedFunc != nil {
+		return am.SetPeerPinnedFunc(ctx, accountID, userID, peerID, pinned)
+	}
+	return status.Errorf(codes.Unimplemented, "method SetPeerPinned is not implemented")
+}
+
 // GetDNSDomain mocks GetDNSDomain of the AccountManager interface
 func (am *MockAccountManager) GetDNSDomain(settings *types.Settings) string {
 	if am.GetDNSDomainFunc != nil {
@@ -792,6 +1115,22 @@ func (am *MockAccountManager) GetEvents(ctx context.Context, accountID, userID s
 	return nil, status.Errorf(codes.Unimplemented, "method GetEvents is not implemented")
 }
 
+// StreamAccountEvents mocks StreamAccountEvents of the AccountManager interface
+func (am *MockAccountManager) StreamAccountEvents(ctx context.Context, accountID, userID string, from time.Time) (*activity.EventsReader, error) {
+	if am.StreamAccountEventsFunc != nil {
+		return am.StreamAccountEventsFunc(ctx, accountID, userID, from)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method StreamAccountEvents is not implemented")
+}
+
+// GetPeerCountHistory mocks GetPeerCountHistory of the AccountManager interface
+func (am *MockAccountManager) GetPeerCountHistory(ctx context.Context, accountID, userID string, from, to time.Time, bucket types.PeerCountHistoryBucket) ([]*types.PeerCountDelta, error) {
+	if am.GetPeerCountHistoryFunc != nil {
+		return am.GetPeerCountHistoryFunc(ctx, accountID, userID, from, to, bucket)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeerCountHistory is not implemented")
+}
+
 // GetDNSSettings mocks GetDNSSettings of the AccountManager interface
 func (am *MockAccountManager) GetDNSSettings(ctx context.Context, accountID string, userID string) (*types.DNSSettings, error) {
 	if am.GetDNSSettingsFunc != nil {
@@ -816,6 +1155,62 @@ func (am *MockAccountManager) GetPeer(ctx context.Context, accountID, peerID, us
 	return nil, status.Errorf(codes.Unimplemented, "method GetPeer is not implemented")
 }
 
+// CanAllocatePeers mocks CanAllocatePeers of the AccountManager interface
+func (am *MockAccountManager) CanAllocatePeers(ctx context.Context, accountID, userID string, count int) (bool, int, error) {
+	if am.CanAllocatePeersFunc != nil {
+		return am.CanAllocatePeersFunc(ctx, accountID, userID, count)
+	}
+	return false, 0, status.Errorf(codes.Unimplemented, "method CanAllocatePeers is not implemented")
+}
+
+// GetPeersByPubKeyPrefix mocks GetPeersByPubKeyPrefix of the AccountManager interface
+func (am *MockAccountManager) GetPeersByPubKeyPrefix(ctx context.Context, accountID, userID, prefix string) ([]*nbpeer.Peer, error) {
+	if am.GetPeersByPubKeyPrefixFunc != nil {
+		return am.GetPeersByPubKeyPrefixFunc(ctx, accountID, userID, prefix)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeersByPubKeyPrefix is not implemented")
+}
+
+// GetPeerFast mocks GetPeerFast of the AccountManager interface
+func (am *MockAccountManager) GetPeerFast(ctx context.Context, accountID, peerID, userID string) (*nbpeer.Peer, error) {
+	if am.GetPeerFastFunc != nil {
+		return am.GetPeerFastFunc(ctx, accountID, peerID, userID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeerFast is not implemented")
+}
+
+// GetPeersByIDs mocks GetPeersByIDs of the AccountManager interface
+func (am *MockAccountManager) GetPeersByIDs(ctx context.Context, accountID, userID string, peerIDs []string) (map[string]*nbpeer.Peer, []string, error) {
+	if am.GetPeersByIDsFunc != nil {
+		return am.GetPeersByIDsFunc(ctx, accountID, userID, peerIDs)
+	}
+	return nil, nil, status.Errorf(codes.Unimplemented, "method GetPeersByIDs is not implemented")
+}
+
+// GetPeerFQDNs mocks GetPeerFQDNs of the AccountManager interface
+func (am *MockAccountManager) GetPeerFQDNs(ctx context.Context, accountID, userID, peerID string) ([]string, error) {
+	if am.GetPeerFQDNsFunc != nil {
+		return am.GetPeerFQDNsFunc(ctx, accountID, userID, peerID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeerFQDNs is not implemented")
+}
+
+// DisconnectPeer mocks DisconnectPeer of the AccountManager interface
+func (am *MockAccountManager) DisconnectPeer(ctx context.Context, accountID, peerID, userID string, markDisconnected bool) error {
+	if am.DisconnectPeerFunc != nil {
+		return am.DisconnectPeerFunc(ctx, accountID, peerID, userID, markDisconnected)
+	}
+	return status.Errorf(codes.Unimplemented, "method DisconnectPeer is not implemented")
+}
+
+// SetGroupSSHEnabled mocks SetGroupSSHEnabled of the AccountManager interface
+func (am *MockAccountManager) SetGroupSSHEnabled(ctx context.Context, accountID, userID, groupID string, enabled bool) (int, error) {
+	if am.SetGroupSSHEnabledFunc != nil {
+		return am.SetGroupSSHEnabledFunc(ctx, accountID, userID, groupID, enabled)
+	}
+	return 0, status.Errorf(codes.Unimplemented, "method SetGroupSSHEnabled is not implemented")
+}
+
 // UpdateAccountSettings mocks UpdateAccountSettings of the AccountManager interface
 func (am *MockAccountManager) UpdateAccountSettings(ctx context.Context, accountID, userID string, newSettings *types.Settings) (*types.Settings, error) {
 	if am.UpdateAccountSettingsFunc != nil {
@@ -905,6 +1300,14 @@ func (am *MockAccountManager) ListPostureChecks(ctx context.Context, accountID,
 	return nil, status.Errorf(codes.Unimplemented, "method ListPostureChecks is not implemented")
 }
 
+// GetPeerPostureContext mocks GetPeerPostureContext of the AccountManager interface
+func (am *MockAccountManager) GetPeerPostureContext(ctx context.Context, accountID, userID, peerID string) ([]*types.PeerPostureCheckSource, error) {
+	if am.GetPeerPostureContextFunc != nil {
+		return am.GetPeerPostureContextFunc(ctx, accountID, userID, peerID)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeerPostureContext is not implemented")
+}
+
 // GetIdpManager mocks GetIdpManager of the AccountManager interface
 func (am *MockAccountManager) GetIdpManager() idp.Manager {
 	if am.GetIdpManagerFunc != nil {
@@ -937,6 +1340,54 @@ func (am *MockAccountManager) SyncPeerMeta(ctx context.Context, peerPubKey strin
 	return status.Errorf(codes.Unimplemented, "method SyncPeerMeta is not implemented")
 }
 
+// UpdatePeerLastHandshake mocks UpdatePeerLastHandshake of the AccountManager interface
+func (am *MockAccountManager) UpdatePeerLastHandshake(ctx context.Context, peerPubKey string, lastHandshake time.Time) error {
+	if am.UpdatePeerLastHandshakeFunc != nil {
+		return am.UpdatePeerLastHandshakeFunc(ctx, peerPubKey, lastHandshake)
+	}
+	return status.Errorf(codes.Unimplemented, "method UpdatePeerLastHandshake is not implemented")
+}
+
+// UpdatePeerAppliedSerial mocks UpdatePeerAppliedSerial of the AccountManager interface
+func (am *MockAccountManager) UpdatePeerAppliedSerial(ctx context.Context, peerPubKey string, serial uint64) error {
+	if am.UpdatePeerAppliedSerialFunc != nil {
+		return am.UpdatePeerAppliedSerialFunc(ctx, peerPubKey, serial)
+	}
+	return status.Errorf(codes.Unimplemented, "method UpdatePeerAppliedSerial is not implemented")
+}
+
+// GetPeerAppliedSerial mocks GetPeerAppliedSerial of the AccountManager interface
+func (am *MockAccountManager) GetPeerAppliedSerial(ctx context.Context, accountID, peerID, userID string) (uint64, error) {
+	if am.GetPeerAppliedSerialFunc != nil {
+		return am.GetPeerAppliedSerialFunc(ctx, accountID, peerID, userID)
+	}
+	return 0, status.Errorf(codes.Unimplemented, "method GetPeerAppliedSerial is not implemented")
+}
+
+// UpdatePeerReportedErrors mocks UpdatePeerReportedErrors of the AccountManager interface
+func (am *MockAccountManager) UpdatePeerReportedErrors(ctx context.Context, peerPubKey string, reportedErrors []nbpeer.ReportedError) error {
+	if am.UpdatePeerReportedErrorsFunc != nil {
+		return am.UpdatePeerReportedErrorsFunc(ctx, peerPubKey, reportedErrors)
+	}
+	return status.Errorf(codes.Unimplemented, "method UpdatePeerReportedErrors is not implemented")
+}
+
+// RecordPeerUsage mocks RecordPeerUsage of the AccountManager interface
+func (am *MockAccountManager) RecordPeerUsage(ctx context.Context, peerPubKey string, rxCounter, txCounter int64) error {
+	if am.RecordPeerUsageFunc != nil {
+		return am.RecordPeerUsageFunc(ctx, peerPubKey, rxCounter, txCounter)
+	}
+	return status.Errorf(codes.Unimplemented, "method RecordPeerUsage is not implemented")
+}
+
+// GetPeerUsage mocks GetPeerUsage of the AccountManager interface
+func (am *MockAccountManager) GetPeerUsage(ctx context.Context, accountID, userID, peerID string, window time.Duration) (*nbpeer.Usage, error) {
+	if am.GetPeerUsageFunc != nil {
+		return am.GetPeerUsageFunc(ctx, accountID, userID, peerID, window)
+	}
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeerUsage is not implemented")
+}
+
 // FindExistingPostureCheck mocks FindExistingPostureCheck of the AccountManager interface
 func (am *MockAccountManager) FindExistingPostureCheck(accountID string, checks *posture.ChecksDefinition) (*posture.Checks, error) {
 	if am.FindExistingPostureCheckFunc != nil {
@@ -2,22 +2,26 @@ package server
 
 import (
 	"context"
-	"crypto/sha256"
-	b64 "encoding/base64"
 	"fmt"
 	"net"
+	"regexp"
 	"slices"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/rs/xid"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/exp/maps"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 
 	nbdns "github.com/netbirdio/netbird/dns"
+	"github.com/netbirdio/netbird/management/internals/controllers/network_map"
+	nbcontext "github.com/netbirdio/netbird/management/server/context"
 	"github.com/netbirdio/netbird/management/server/geolocation"
 	"github.com/netbirdio/netbird/management/server/idp"
-	routerTypes "github.com/netbirdio/netbird/management/server/networks/routers/types"
+	"github.com/netbirdio/netbird/management/server/integrations/port_forwarding"
+	"github.com/netbirdio/netbird/management/server/integrations/webhook"
 	"github.com/netbirdio/netbird/management/server/permissions/modules"
 	"github.com/netbirdio/netbird/management/server/permissions/operations"
 	"github.com/netbirdio/netbird/shared/management/domain"
@@ -31,11 +35,27 @@ import (
 	"github.com/netbirdio/netbird/shared/management/status"
 )
 
-const remoteJobsMinVer = "0.64.0"
+const (
+	remoteJobsMinVer = "0.64.0"
+
+	// maxPeerDescriptionLength is the maximum number of characters allowed in a peer description
+	maxPeerDescriptionLength = 255
+
+	// maxPeerAdminNotesLength is the maximum number of characters allowed in the admin notes of a peer
+	maxPeerAdminNotesLength = 4096
+
+	// peerApprovalTrigger* tell in the approval events what moved the peer into or out of the pending approval state
+	peerApprovalTriggerRegistration = "registration"
+	peerApprovalTriggerLogin        = "login"
+	peerApprovalTriggerSync         = "sync"
+	peerApprovalTriggerUser         = "user"
+)
+
+var countryCodeRegex = regexp.MustCompile("^[A-Z]{2}$")
 
 // GetPeers returns a list of peers under the given account filtering out peers that do not belong to a user if
-// the current user is not an admin.
-func (am *DefaultAccountManager) GetPeers(ctx context.Context, accountID, userID, nameFilter, ipFilter string) ([]*nbpeer.Peer, error) {
+// the current user is not an admin. The peers pinned by the user are listed first when the filters ask for it.
+func (am *DefaultAccountManager) GetPeers(ctx context.Context, accountID, userID string, filters store.PeerFilters) ([]*nbpeer.Peer, error) {
 	user, err := am.Store.GetUserByUserID(ctx, store.LockingStrengthNone, userID)
 	if err != nil {
 		return nil, err
@@ -46,364 +66,331 @@ func (am *DefaultAccountManager) GetPeers(ctx context.Context, accountID, userID
 		return nil, status.NewPermissionValidationError(err)
 	}
 
-	accountPeers, err := am.Store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, nameFilter, ipFilter)
+	// @note if it does not have permission read peers then only display it's own peers and the peers they have access to.
+	if !allowed {
+		filters, err = am.restrictPeerFiltersToUser(ctx, accountID, userID, filters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	peers, err := am.Store.GetFilteredAccountPeers(ctx, store.LockingStrengthNone, accountID, filters)
 	if err != nil {
 		return nil, err
 	}
 
-	// @note if the user has permission to read peers it shows all account peers
-	if allowed {
-		return accountPeers, nil
+	if !filters.PinnedFirst {
+		return peers, nil
 	}
 
-	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get account settings: %w", err)
-	}
+	return sortPinnedPeersFirst(peers, user.PinnedPeers), nil
+}
 
-	if user.IsRestrictable() && settings.RegularUsersViewBlocked {
-		return []*nbpeer.Peer{}, nil
+// sortPinnedPeersFirst moves the pinned peers to the front of the list, keeping the relative order of the rest
+func sortPinnedPeersFirst(peers []*nbpeer.Peer, pinnedPeers []string) []*nbpeer.Peer {
+	if len(pinnedPeers) == 0 {
+		return peers
 	}
 
-	// @note if it does not have permission read peers then only display it's own peers
-	peers := make([]*nbpeer.Peer, 0)
-	peersMap := make(map[string]*nbpeer.Peer)
-
-	for _, peer := range accountPeers {
-		if user.Id != peer.UserID {
-			continue
+	slices.SortStableFunc(peers, func(a, b *nbpeer.Peer) int {
+		aPinned := slices.Contains(pinnedPeers, a.ID)
+		bPinned := slices.Contains(pinnedPeers, b.ID)
+		switch {
+		case aPinned && !bPinned:
+			return -1
+		case !aPinned && bPinned:
+			return 1
+		default:
+			return 0
 		}
-		peers = append(peers, peer)
-		peersMap[peer.ID] = peer
-	}
+	})
 
-	return am.getUserAccessiblePeers(ctx, accountID, peersMap, peers)
+	return peers
 }
 
-func (am *DefaultAccountManager) getUserAccessiblePeers(ctx context.Context, accountID string, peersMap map[string]*nbpeer.Peer, peers []*nbpeer.Peer) ([]*nbpeer.Peer, error) {
-	account, err := am.requestBuffer.GetAccountWithBackpressure(ctx, accountID)
+// CountPeers returns the number of peers visible to the user that match the filters, without loading the peers
+// when the user is allowed to read all of them. When the account excludes the ephemeral peers from limits, they are
+// only counted if the filters explicitly ask for them
+func (am *DefaultAccountManager) CountPeers(ctx context.Context, accountID, userID string, filters store.PeerFilters) (int, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
 	if err != nil {
-		return nil, err
+		return 0, status.NewPermissionValidationError(err)
 	}
 
-	approvedPeersMap, err := am.integratedPeerValidator.GetValidatedPeers(ctx, accountID, maps.Values(account.Groups), maps.Values(account.Peers), account.Settings.Extra)
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
 	if err != nil {
-		return nil, err
+		return 0, fmt.Errorf("failed to get account settings: %w", err)
 	}
 
-	// fetch all the peers that have access to the user's peers
-	for _, peer := range peers {
-		aclPeers, _, _, _ := account.GetPeerConnectionResources(ctx, peer, approvedPeersMap, account.GetActiveGroupUsers())
-		for _, p := range aclPeers {
-			peersMap[p.ID] = p
-		}
-	}
-
-	return maps.Values(peersMap), nil
-}
-
-// MarkPeerConnected marks peer as connected (true) or disconnected (false)
-func (am *DefaultAccountManager) MarkPeerConnected(ctx context.Context, peerPubKey string, connected bool, realIP net.IP, accountID string) error {
-	var peer *nbpeer.Peer
-	var settings *types.Settings
-	var expired bool
-	var err error
+	filters = peerLimitFilters(settings, filters)
 
-	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
-		peer, err = transaction.GetPeerByPeerPubKey(ctx, store.LockingStrengthUpdate, peerPubKey)
+	// the visibility is resolved the same way as in GetPeers
+	if !allowed {
+		filters, err = am.restrictPeerFiltersToUser(ctx, accountID, userID, filters)
 		if err != nil {
-			return err
+			return 0, err
 		}
-
-		expired, err = updatePeerStatusAndLocation(ctx, am.geo, transaction, peer, connected, realIP, accountID)
-		return err
-	})
-	if err != nil {
-		return err
 	}
 
-	if peer.AddedWithSSOLogin() {
-		settings, err = am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
-		if err != nil {
-			return err
-		}
+	count, err := am.Store.CountAccountPeers(ctx, store.LockingStrengthNone, accountID, filters)
+	return int(count), err
+}
 
-		if peer.LoginExpirationEnabled && settings.PeerLoginExpirationEnabled {
-			am.schedulePeerLoginExpiration(ctx, accountID)
-		}
+// peerLimitFilters leaves the ephemeral peers out of the filters when the account excludes them from limits, unless
+// the filters explicitly ask for them
+func peerLimitFilters(settings *types.Settings, filters store.PeerFilters) store.PeerFilters {
+	if settings.ExcludeEphemeralPeersFromLimits && filters.Ephemeral == nil {
+		persistent := false
+		filters.Ephemeral = &persistent
+	}
+	return filters
+}
 
-		if peer.InactivityExpirationEnabled && settings.PeerInactivityExpirationEnabled {
-			am.checkAndSchedulePeerInactivityExpiration(ctx, accountID)
-		}
+// checkPeerLimit rejects a new peer once the account registered as many peers as its peer limit allows. Ephemeral
+// peers are not limited when the account excludes them from limits
+func checkPeerLimit(ctx context.Context, transaction store.Store, settings *types.Settings, accountID string, ephemeral bool) error {
+	if settings.PeerLimit <= 0 || (ephemeral && settings.ExcludeEphemeralPeersFromLimits) {
+		return nil
 	}
 
-	if expired {
-		err = am.networkMapController.OnPeersUpdated(ctx, accountID, []string{peer.ID})
-		if err != nil {
-			return fmt.Errorf("notify network map controller of peer update: %w", err)
-		}
+	count, err := transaction.CountAccountPeers(ctx, store.LockingStrengthNone, accountID, peerLimitFilters(settings, store.PeerFilters{}))
+	if err != nil {
+		return fmt.Errorf("failed to count peers: %w", err)
 	}
 
+	if count >= int64(settings.PeerLimit) {
+		return status.Errorf(status.PreconditionFailed, "couldn't add peer: the account reached its limit of %d peers", settings.PeerLimit)
+	}
 	return nil
 }
 
-func updatePeerStatusAndLocation(ctx context.Context, geo geolocation.Geolocation, transaction store.Store, peer *nbpeer.Peer, connected bool, realIP net.IP, accountID string) (bool, error) {
-	oldStatus := peer.Status.Copy()
-	newStatus := oldStatus
-	newStatus.LastSeen = time.Now().UTC()
-	newStatus.Connected = connected
-	// whenever peer got connected that means that it logged in successfully
-	if newStatus.Connected {
-		newStatus.LoginExpired = false
+// restrictPeerFiltersToUser narrows down the filters to the peers visible to a user without the peers read permission
+func (am *DefaultAccountManager) restrictPeerFiltersToUser(ctx context.Context, accountID, userID string, filters store.PeerFilters) (store.PeerFilters, error) {
+	visiblePeers, err := am.getUserVisiblePeerIDs(ctx, accountID, userID)
+	if err != nil {
+		return filters, err
 	}
-	peer.Status = newStatus
 
-	if geo != nil && realIP != nil {
-		location, err := geo.Lookup(realIP)
-		if err != nil {
-			log.WithContext(ctx).Warnf("failed to get location for peer %s realip: [%s]: %v", peer.ID, realIP.String(), err)
-		} else {
-			peer.Location.ConnectionIP = realIP
-			peer.Location.CountryCode = location.Country.ISOCode
-			peer.Location.CityName = location.City.Names.En
-			peer.Location.GeoNameID = location.City.GeonameID
-			err = transaction.SavePeerLocation(ctx, accountID, peer)
-			if err != nil {
-				log.WithContext(ctx).Warnf("could not store location for peer %s: %s", peer.ID, err)
-			}
+	ids := make([]string, 0, len(visiblePeers))
+	for id := range visiblePeers {
+		if filters.IDs == nil || slices.Contains(filters.IDs, id) {
+			ids = append(ids, id)
 		}
 	}
+	filters.IDs = ids
 
-	log.WithContext(ctx).Debugf("saving peer status for peer %s is connected: %t", peer.ID, connected)
-
-	err := transaction.SavePeerStatus(ctx, accountID, peer.ID, *newStatus)
-	if err != nil {
-		return false, err
-	}
-
-	return oldStatus.LoginExpired, nil
+	return filters, nil
 }
 
-// UpdatePeer updates peer. Only Peer.Name, Peer.SSHEnabled, Peer.LoginExpirationEnabled and Peer.InactivityExpirationEnabled can be updated.
-func (am *DefaultAccountManager) UpdatePeer(ctx context.Context, accountID, userID string, update *nbpeer.Peer) (*nbpeer.Peer, error) {
-	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Update)
-	if err != nil {
-		return nil, status.NewPermissionValidationError(err)
-	}
-	if !allowed {
-		return nil, status.NewPermissionDeniedError()
+// SetPeerPinned pins or unpins a peer in the peer listings of the user. The preference is stored per user
+// and doesn't affect other users or the network map.
+func (am *DefaultAccountManager) SetPeerPinned(ctx context.Context, accountID, userID, peerID string, pinned bool) error {
+	// the user must be able to see the peer to pin it
+	if _, err := am.GetPeer(ctx, accountID, peerID, userID); err != nil {
+		return err
 	}
 
-	var peer *nbpeer.Peer
-	var settings *types.Settings
-	var peerGroupList []string
-	var peerLabelChanged bool
-	var sshChanged bool
-	var loginExpirationChanged bool
-	var inactivityExpirationChanged bool
-	var dnsDomain string
-
-	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
-		peer, err = transaction.GetPeerByID(ctx, store.LockingStrengthUpdate, accountID, update.ID)
+	return am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		user, err := transaction.GetUserByUserID(ctx, store.LockingStrengthUpdate, userID)
 		if err != nil {
 			return err
 		}
 
-		settings, err = transaction.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
-		if err != nil {
-			return err
+		if user.AccountID != accountID {
+			return status.NewUserNotPartOfAccountError()
 		}
 
-		peerGroupList, err = getPeerGroupIDs(ctx, transaction, accountID, update.ID)
-		if err != nil {
-			return err
+		isPinned := slices.Contains(user.PinnedPeers, peerID)
+		switch {
+		case pinned && !isPinned:
+			user.PinnedPeers = append(user.PinnedPeers, peerID)
+		case !pinned && isPinned:
+			user.PinnedPeers = slices.DeleteFunc(user.PinnedPeers, func(id string) bool { return id == peerID })
+		default:
+			return nil
 		}
 
-		dnsDomain = am.networkMapController.GetDNSDomain(settings)
-
-		update, _, err = am.integratedPeerValidator.ValidatePeer(ctx, update, peer, userID, accountID, dnsDomain, peerGroupList, settings.Extra)
-		if err != nil {
-			return err
-		}
+		return transaction.SaveUser(ctx, user)
+	})
+}
 
-		if peer.Name != update.Name {
-			var newLabel string
+// GetPeersByCountry returns the peers of an account whose last connection came from the country with the given
+// ISO 3166-1 alpha-2 code. Users without permission to read peers only get their own peers and the peers they have access to.
+func (am *DefaultAccountManager) GetPeersByCountry(ctx context.Context, accountID, userID, countryCode string) ([]*nbpeer.Peer, error) {
+	countryCode = strings.ToUpper(countryCode)
+	if err := am.validateCountryCode(countryCode); err != nil {
+		return nil, err
+	}
 
-			newLabel, err = nbdns.GetParsedDomainLabel(update.Name)
-			if err != nil {
-				newLabel = ""
-			} else {
-				_, err := transaction.GetPeerIdByLabel(ctx, store.LockingStrengthNone, accountID, update.Name)
-				if err == nil {
-					newLabel = ""
-				}
-			}
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
 
-			if newLabel == "" {
-				newLabel, err = getPeerIPDNSLabel(peer.IP, update.Name)
-				if err != nil {
-					return fmt.Errorf("failed to get free DNS label: %w", err)
-				}
-			}
-			peer.Name = update.Name
-			peer.DNSLabel = newLabel
-			peerLabelChanged = true
-		}
+	if allowed {
+		return am.Store.GetAccountPeersByCountry(ctx, store.LockingStrengthNone, accountID, countryCode)
+	}
 
-		if peer.SSHEnabled != update.SSHEnabled {
-			peer.SSHEnabled = update.SSHEnabled
-			sshChanged = true
-		}
+	visiblePeers, err := am.GetPeers(ctx, accountID, userID, store.PeerFilters{})
+	if err != nil {
+		return nil, err
+	}
 
-		if peer.LoginExpirationEnabled != update.LoginExpirationEnabled {
-			if !peer.AddedWithSSOLogin() {
-				return status.Errorf(status.PreconditionFailed, "this peer hasn't been added with the SSO login, therefore the login expiration can't be updated")
-			}
-			peer.LoginExpirationEnabled = update.LoginExpirationEnabled
-			loginExpirationChanged = true
+	peers := make([]*nbpeer.Peer, 0)
+	for _, peer := range visiblePeers {
+		if peer.Location.CountryCode == countryCode {
+			peers = append(peers, peer)
 		}
+	}
 
-		if peer.InactivityExpirationEnabled != update.InactivityExpirationEnabled {
-			if !peer.AddedWithSSOLogin() {
-				return status.Errorf(status.PreconditionFailed, "this peer hasn't been added with the SSO login, therefore the inactivity expiration can't be updated")
-			}
-			peer.InactivityExpirationEnabled = update.InactivityExpirationEnabled
-			inactivityExpirationChanged = true
-		}
+	return peers, nil
+}
 
-		if err = transaction.IncrementNetworkSerial(ctx, accountID); err != nil {
-			return fmt.Errorf("failed to increment network serial: %w", err)
-		}
+// GetPeersByRelay returns the peers of an account currently connected to the relay server with the given address.
+// Users without permission to read peers only get their own peers and the peers they have access to.
+func (am *DefaultAccountManager) GetPeersByRelay(ctx context.Context, accountID, userID, relayID string) ([]*nbpeer.Peer, error) {
+	if relayID == "" {
+		return nil, status.Errorf(status.InvalidArgument, "relay address can't be empty")
+	}
 
-		return transaction.SavePeer(ctx, accountID, peer)
-	})
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
 	if err != nil {
-		return nil, err
+		return nil, status.NewPermissionValidationError(err)
 	}
 
-	if sshChanged {
-		event := activity.PeerSSHEnabled
-		if !peer.SSHEnabled {
-			event = activity.PeerSSHDisabled
-		}
-		am.StoreEvent(ctx, userID, peer.IP.String(), accountID, event, peer.EventMeta(dnsDomain))
+	if allowed {
+		return am.Store.GetAccountPeersByRelay(ctx, store.LockingStrengthNone, accountID, relayID)
 	}
 
-	if peerLabelChanged {
-		am.StoreEvent(ctx, userID, peer.ID, accountID, activity.PeerRenamed, peer.EventMeta(dnsDomain))
+	visiblePeers, err := am.GetPeers(ctx, accountID, userID, store.PeerFilters{})
+	if err != nil {
+		return nil, err
 	}
 
-	if loginExpirationChanged {
-		event := activity.PeerLoginExpirationEnabled
-		if !peer.LoginExpirationEnabled {
-			event = activity.PeerLoginExpirationDisabled
-		}
-		am.StoreEvent(ctx, userID, peer.IP.String(), accountID, event, peer.EventMeta(dnsDomain))
-
-		if peer.AddedWithSSOLogin() && peer.LoginExpirationEnabled && settings.PeerLoginExpirationEnabled {
-			am.peerLoginExpiry.Cancel(ctx, []string{accountID})
-			am.schedulePeerLoginExpiration(ctx, accountID)
+	peers := make([]*nbpeer.Peer, 0)
+	for _, peer := range visiblePeers {
+		if peer.Meta.RelayAddress == relayID {
+			peers = append(peers, peer)
 		}
 	}
 
-	if inactivityExpirationChanged {
-		event := activity.PeerInactivityExpirationEnabled
-		if !peer.InactivityExpirationEnabled {
-			event = activity.PeerInactivityExpirationDisabled
-		}
-		am.StoreEvent(ctx, userID, peer.IP.String(), accountID, event, peer.EventMeta(dnsDomain))
+	return peers, nil
+}
 
-		if peer.AddedWithSSOLogin() && peer.InactivityExpirationEnabled && settings.PeerInactivityExpirationEnabled {
-			am.checkAndSchedulePeerInactivityExpiration(ctx, accountID)
-		}
+// validateCountryCode checks that the country code is known to the geolocation database
+func (am *DefaultAccountManager) validateCountryCode(countryCode string) error {
+	if !countryCodeRegex.MatchString(countryCode) {
+		return status.Errorf(status.InvalidArgument, "invalid country code %q", countryCode)
 	}
 
-	err = am.networkMapController.OnPeersUpdated(ctx, accountID, []string{peer.ID})
+	if am.geo == nil {
+		return status.Errorf(status.PreconditionFailed, "geo location database is not initialized")
+	}
+
+	countries, err := am.geo.GetAllCountries()
 	if err != nil {
-		return nil, fmt.Errorf("notify network map controller of peer update: %w", err)
+		return status.Errorf(status.Internal, "failed to get countries: %v", err)
 	}
 
-	return peer, nil
+	for _, country := range countries {
+		if strings.EqualFold(country.CountryISOCode, countryCode) {
+			return nil
+		}
+	}
+
+	return status.Errorf(status.InvalidArgument, "unknown country code %q", countryCode)
 }
 
-func (am *DefaultAccountManager) CreatePeerJob(ctx context.Context, accountID, peerID, userID string, job *types.Job) error {
-	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.RemoteJobs, operations.Create)
+// GetPeersMissingGroups returns the peers of an account that are not part of any user-defined group,
+// i.e. peers whose only membership is the All group.
+func (am *DefaultAccountManager) GetPeersMissingGroups(ctx context.Context, accountID, userID string) ([]*nbpeer.Peer, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
 	if err != nil {
-		return status.NewPermissionValidationError(err)
+		return nil, status.NewPermissionValidationError(err)
 	}
 	if !allowed {
-		return status.NewPermissionDeniedError()
+		return nil, status.NewPermissionDeniedError()
 	}
 
-	p, err := am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID)
+	allGroup, err := am.Store.GetGroupByName(ctx, store.LockingStrengthNone, accountID, "All")
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to get All group: %w", err)
 	}
 
-	if p.AccountID != accountID {
-		return status.NewPeerNotPartOfAccountError()
+	groupPeers, err := am.Store.GetAccountGroupPeers(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, err
 	}
 
-	meetMinVer, err := posture.MeetsMinVersion(remoteJobsMinVer, p.Meta.WtVersion)
-	if !strings.Contains(p.Meta.WtVersion, "dev") && (!meetMinVer || err != nil) {
-		return status.Errorf(status.PreconditionFailed, "peer version %s does not meet the minimum required version %s for remote jobs", p.Meta.WtVersion, remoteJobsMinVer)
+	groupedPeers := make(map[string]struct{})
+	for groupID, peerIDs := range groupPeers {
+		if groupID == allGroup.ID {
+			continue
+		}
+		for peerID := range peerIDs {
+			groupedPeers[peerID] = struct{}{}
+		}
 	}
 
-	if !am.jobManager.IsPeerConnected(peerID) {
-		return status.Errorf(status.BadRequest, "peer not connected")
+	accountPeers, err := am.Store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "", nil)
+	if err != nil {
+		return nil, err
 	}
 
-	// check if already has pending jobs
-	// todo: The job checks here are not protected. The user can run this function from multiple threads,
-	// and each thread can think there is no job yet. This means entries in the pending job map will be overwritten,
-	// and only one will be kept, but potentially another one will overwrite it in the queue.
-	if am.jobManager.IsPeerHasPendingJobs(peerID) {
-		return status.Errorf(status.BadRequest, "peer already has pending job")
+	peers := make([]*nbpeer.Peer, 0)
+	for _, peer := range accountPeers {
+		if _, ok := groupedPeers[peer.ID]; !ok {
+			peers = append(peers, peer)
+		}
 	}
 
-	jobStream, err := job.ToStreamJobRequest()
+	return peers, nil
+}
+
+// GetPeersPendingApproval returns the peers of an account that require approval, the longest waiting first.
+// Peers pending since before the approval time was tracked come last
+func (am *DefaultAccountManager) GetPeersPendingApproval(ctx context.Context, accountID, userID string) ([]*nbpeer.Peer, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
 	if err != nil {
-		return status.Errorf(status.BadRequest, "invalid job request %v", err)
+		return nil, status.NewPermissionValidationError(err)
 	}
-
-	// try sending job first
-	if err := am.jobManager.SendJob(ctx, accountID, peerID, jobStream); err != nil {
-		return status.Errorf(status.Internal, "failed to send job: %v", err)
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
 	}
 
-	var peer *nbpeer.Peer
-	var eventsToStore func()
-
-	// persist job in DB only if send succeeded
-	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
-		peer, err = transaction.GetPeerByID(ctx, store.LockingStrengthUpdate, accountID, peerID)
-		if err != nil {
-			return err
-		}
-		if err := transaction.CreatePeerJob(ctx, job); err != nil {
-			return err
-		}
+	accountPeers, err := am.Store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
 
-		jobMeta := map[string]any{
-			"for_peer_name": peer.Name,
-			"job_type":      job.Workload.Type,
+	peers := make([]*nbpeer.Peer, 0)
+	for _, peer := range accountPeers {
+		if peer.Status.IsPendingApproval() {
+			peers = append(peers, peer)
 		}
+	}
 
-		eventsToStore = func() {
-			am.StoreEvent(ctx, userID, peer.ID, accountID, activity.JobCreatedByUser, jobMeta)
+	slices.SortStableFunc(peers, func(a, b *nbpeer.Peer) int {
+		aSince, bSince := a.Status.PendingApprovalSince, b.Status.PendingApprovalSince
+		switch {
+		case aSince.IsZero() && bSince.IsZero():
+			return 0
+		case aSince.IsZero():
+			return 1
+		case bSince.IsZero():
+			return -1
+		default:
+			return aSince.Compare(bSince)
 		}
-		return nil
 	})
-	if err != nil {
-		return err
-	}
-	eventsToStore()
-	return nil
+
+	return peers, nil
 }
 
-func (am *DefaultAccountManager) GetAllPeerJobs(ctx context.Context, accountID, userID, peerID string) ([]*types.Job, error) {
-	// todo: Create permissions for job
-	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.RemoteJobs, operations.Read)
+// GetOrphanedPeers returns the peers of an account owned by a user that no longer exists in the account,
+// e.g. after the user was removed from the IdP. Peers added with a setup key are never orphaned
+func (am *DefaultAccountManager) GetOrphanedPeers(ctx context.Context, accountID, userID string) ([]*nbpeer.Peer, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
 	if err != nil {
 		return nil, status.NewPermissionValidationError(err)
 	}
@@ -411,90 +398,140 @@ func (am *DefaultAccountManager) GetAllPeerJobs(ctx context.Context, accountID,
 		return nil, status.NewPermissionDeniedError()
 	}
 
-	peerAccountID, err := am.Store.GetAccountIDByPeerID(ctx, store.LockingStrengthNone, peerID)
+	return getOrphanedPeers(ctx, am.Store, store.LockingStrengthNone, accountID)
+}
+
+// ReassignOrphanedPeers transfers the ownership of all orphaned peers of an account to an existing user.
+// Returns the number of peers reassigned
+func (am *DefaultAccountManager) ReassignOrphanedPeers(ctx context.Context, accountID, userID, newOwnerID string) (int, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Update)
 	if err != nil {
-		return nil, err
+		return 0, status.NewPermissionValidationError(err)
 	}
-
-	if peerAccountID != accountID {
-		return nil, status.NewPeerNotPartOfAccountError()
+	if !allowed {
+		return 0, status.NewPermissionDeniedError()
 	}
 
-	accountJobs, err := am.Store.GetPeerJobs(ctx, accountID, peerID)
+	newOwner, err := am.Store.GetUserByUserID(ctx, store.LockingStrengthNone, newOwnerID)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	return accountJobs, nil
-}
+	if newOwner.AccountID != accountID {
+		return 0, status.NewUserNotPartOfAccountError()
+	}
 
-func (am *DefaultAccountManager) GetPeerJobByID(ctx context.Context, accountID, userID, peerID, jobID string) (*types.Job, error) {
-	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.RemoteJobs, operations.Read)
-	if err != nil {
-		return nil, status.NewPermissionValidationError(err)
+	if newOwner.IsServiceUser {
+		return 0, status.Errorf(status.InvalidArgument, "peers can't be assigned to a service user")
 	}
-	if !allowed {
-		return nil, status.NewPermissionDeniedError()
+
+	if newOwner.IsBlocked() {
+		return 0, status.Errorf(status.InvalidArgument, "peers can't be assigned to a blocked user")
 	}
 
-	peerAccountID, err := am.Store.GetAccountIDByPeerID(ctx, store.LockingStrengthNone, peerID)
+	ownerEmail := am.getPeerOwnerEmail(ctx, accountID, newOwner)
+
+	var reassignedPeers []*nbpeer.Peer
+	var previousOwners map[string]string
+	var dnsDomain string
+
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		reassignedPeers = nil
+		previousOwners = make(map[string]string)
+
+		settings, err := transaction.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+		if err != nil {
+			return err
+		}
+		dnsDomain = am.networkMapController.GetDNSDomain(settings)
+
+		orphanedPeers, err := getOrphanedPeers(ctx, transaction, store.LockingStrengthUpdate, accountID)
+		if err != nil {
+			return err
+		}
+
+		for _, peer := range orphanedPeers {
+			previousOwners[peer.ID] = peer.UserID
+			peer.UserID = newOwner.Id
+			peer.OwnerEmail = ownerEmail
+			if err = transaction.SavePeer(ctx, accountID, peer); err != nil {
+				return err
+			}
+			reassignedPeers = append(reassignedPeers, peer)
+		}
+
+		if len(reassignedPeers) == 0 {
+			return nil
+		}
+
+		if err = transaction.IncrementNetworkSerial(ctx, accountID); err != nil {
+			return fmt.Errorf("failed to increment network serial: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	if peerAccountID != accountID {
-		return nil, status.NewPeerNotPartOfAccountError()
+	if len(reassignedPeers) == 0 {
+		return 0, nil
 	}
 
-	job, err := am.Store.GetPeerJobByID(ctx, accountID, jobID)
+	peerIDs := make([]string, 0, len(reassignedPeers))
+	for _, peer := range reassignedPeers {
+		meta := peer.EventMeta(dnsDomain)
+		meta["previous_owner"] = previousOwners[peer.ID]
+		meta["owner"] = newOwner.Id
+		am.StoreEvent(ctx, userID, peer.ID, accountID, activity.PeerOwnerReassigned, meta)
+		peerIDs = append(peerIDs, peer.ID)
+	}
+
+	err = am.networkMapController.OnPeersUpdated(ctx, accountID, peerIDs)
 	if err != nil {
-		return nil, err
+		return 0, fmt.Errorf("notify network map controller of peer update: %w", err)
 	}
 
-	return job, nil
+	return len(reassignedPeers), nil
 }
 
-// DeletePeer removes peer from the account by its IP
-func (am *DefaultAccountManager) DeletePeer(ctx context.Context, accountID, peerID, userID string) error {
+// DeleteOrphanedPeers deletes all orphaned peers of an account. Returns the number of peers deleted
+func (am *DefaultAccountManager) DeleteOrphanedPeers(ctx context.Context, accountID, userID string) (int, error) {
 	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Delete)
 	if err != nil {
-		return status.NewPermissionValidationError(err)
+		return 0, status.NewPermissionValidationError(err)
 	}
 	if !allowed {
-		return status.NewPermissionDeniedError()
-	}
-
-	peerAccountID, err := am.Store.GetAccountIDByPeerID(ctx, store.LockingStrengthNone, peerID)
-	if err != nil {
-		return err
-	}
-
-	if peerAccountID != accountID {
-		return status.NewPeerNotPartOfAccountError()
+		return 0, status.NewPermissionDeniedError()
 	}
 
-	var peer *nbpeer.Peer
+	var orphanedPeers []*nbpeer.Peer
 	var settings *types.Settings
 	var eventsToStore []func()
 
 	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
-		peer, err = transaction.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID)
+		settings, err = transaction.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
 		if err != nil {
 			return err
 		}
 
-		settings, err = transaction.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+		orphanedPeers, err = getOrphanedPeers(ctx, transaction, store.LockingStrengthUpdate, accountID)
 		if err != nil {
 			return err
 		}
 
-		if err = am.validatePeerDelete(ctx, transaction, accountID, peerID); err != nil {
-			return err
+		if len(orphanedPeers) == 0 {
+			return nil
 		}
 
-		eventsToStore, err = deletePeers(ctx, am, transaction, accountID, userID, []*nbpeer.Peer{peer}, settings)
+		for _, peer := range orphanedPeers {
+			if err = am.validatePeerDelete(ctx, transaction, accountID, peer.ID); err != nil {
+				return err
+			}
+		}
+
+		eventsToStore, err = deletePeers(ctx, am, transaction, accountID, userID, orphanedPeers, settings)
 		if err != nil {
-			return fmt.Errorf("failed to delete peer: %w", err)
+			return fmt.Errorf("failed to delete orphaned peers: %w", err)
 		}
 
 		if err = transaction.IncrementNetworkSerial(ctx, accountID); err != nil {
@@ -504,587 +541,2587 @@ func (am *DefaultAccountManager) DeletePeer(ctx context.Context, accountID, peer
 		return nil
 	})
 	if err != nil {
-		return err
-	}
-
-	for _, storeEvent := range eventsToStore {
-		storeEvent()
+		return 0, err
 	}
 
-	if err = am.integratedPeerValidator.PeerDeleted(ctx, accountID, peerID, settings.Extra); err != nil {
-		log.WithContext(ctx).Errorf("failed to delete peer %s from integrated validator: %v", peerID, err)
+	if len(orphanedPeers) == 0 {
+		return 0, nil
 	}
 
-	if err = am.networkMapController.OnPeersDeleted(ctx, accountID, []string{peerID}); err != nil {
-		log.WithContext(ctx).Errorf("failed to delete peer %s from network map: %v", peerID, err)
+	for _, storeEvent := range eventsToStore {
+		storeEvent()
 	}
 
-	return nil
-}
+	am.onPeersDeleted(ctx, settings, accountID, userID, orphanedPeers)
 
-// GetNetworkMap returns Network map for a given peer (omits original peer from the Peers result)
-func (am *DefaultAccountManager) GetNetworkMap(ctx context.Context, peerID string) (*types.NetworkMap, error) {
-	return am.networkMapController.GetNetworkMap(ctx, peerID)
+	return len(orphanedPeers), nil
 }
 
-// GetPeerNetwork returns the Network for a given peer
-func (am *DefaultAccountManager) GetPeerNetwork(ctx context.Context, peerID string) (*types.Network, error) {
-	account, err := am.Store.GetAccountByPeerID(ctx, peerID)
+// DeletePeersBySetupKey deletes all peers registered with the given setup key, which may already be revoked.
+// Peers that can't be deleted, e.g. because they are linked to a network router, are skipped and their IDs returned.
+// The setup key of a peer is only recorded since the peers reference it, older peers added with a setup key can't be
+// matched to their key and are never deleted. Their number is returned as unattributed, together with the imported
+// peers, so that the caller knows to review them by hand.
+// Returns the number of peers deleted, the IDs of the skipped peers and the number of unattributed peers
+func (am *DefaultAccountManager) DeletePeersBySetupKey(ctx context.Context, accountID, userID, setupKeyID string) (int, []string, int, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Delete)
 	if err != nil {
-		return nil, err
+		return 0, nil, 0, status.NewPermissionValidationError(err)
 	}
-
-	return account.Network.Copy(), err
-}
-
-// AddPeer adds a new peer to the Store.
-// Each Account has a list of pre-authorized SetupKey and if no Account has a given key err with a code status.PermissionDenied
-// will be returned, meaning the setup key is invalid or not found.
-// If a User ID is provided, it means that we passed the authentication using JWT, then we look for account by User ID and register the peer
-// to it. We also add the User ID to the peer metadata to identify registrant. If no userID provided, then fail with status.PermissionDenied
-// Each new Peer will be assigned a new next net.IP from the Account.Network and Account.Network.LastIP will be updated (IP's are not reused).
-// The peer property is just a placeholder for the Peer properties to pass further
-func (am *DefaultAccountManager) AddPeer(ctx context.Context, accountID, setupKey, userID string, peer *nbpeer.Peer, temporary bool) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, error) {
-	if setupKey == "" && userID == "" {
-		// no auth method provided => reject access
-		return nil, nil, nil, status.Errorf(status.Unauthenticated, "no peer auth method provided, please use a setup key or interactive SSO login")
+	if !allowed {
+		return 0, nil, 0, status.NewPermissionDeniedError()
 	}
 
-	upperKey := strings.ToUpper(setupKey)
-	hashedKey := sha256.Sum256([]byte(upperKey))
-	encodedHashedKey := b64.StdEncoding.EncodeToString(hashedKey[:])
-	addedByUser := len(userID) > 0
-
-	// This is a handling for the case when the same machine (with the same WireGuard pub key) tries to register twice.
-	// Such case is possible when AddPeer function takes long time to finish after AcquireWriteLockByUID (e.g., database is slow)
-	// and the peer disconnects with a timeout and tries to register again.
-	// We just check if this machine has been registered before and reject the second registration.
-	// The connecting peer should be able to recover with a retry.
-	_, err := am.Store.GetPeerByPeerPubKey(ctx, store.LockingStrengthNone, peer.Key)
-	if err == nil {
-		return nil, nil, nil, status.Errorf(status.PreconditionFailed, "peer has been already registered")
-	}
+	var peersToDelete []*nbpeer.Peer
+	var skippedPeerIDs []string
+	var unattributed int
+	var settings *types.Settings
+	var eventsToStore []func()
 
-	opEvent := &activity.Event{
-		Timestamp: time.Now().UTC(),
-	}
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		if _, err = transaction.GetSetupKeyByID(ctx, store.LockingStrengthNone, accountID, setupKeyID); err != nil {
+			return err
+		}
 
-	var newPeer *nbpeer.Peer
+		settings, err = transaction.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+		if err != nil {
+			return err
+		}
 
-	var setupKeyID string
-	var setupKeyName string
-	var ephemeral bool
-	var groupsToAdd []string
-	var allowExtraDNSLabels bool
-	if addedByUser {
-		user, err := am.Store.GetUserByUserID(ctx, store.LockingStrengthNone, userID)
+		peers, err := transaction.GetPeersBySetupKey(ctx, store.LockingStrengthUpdate, accountID, setupKeyID)
 		if err != nil {
-			return nil, nil, nil, status.Errorf(status.NotFound, "failed adding new peer: user not found")
+			return err
 		}
-		if user.PendingApproval {
-			return nil, nil, nil, status.Errorf(status.PermissionDenied, "user pending approval cannot add peers")
+
+		accountPeers, err := transaction.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "", nil)
+		if err != nil {
+			return err
 		}
-		if temporary {
-			allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Create)
-			if err != nil {
-				return nil, nil, nil, status.NewPermissionValidationError(err)
+		for _, peer := range accountPeers {
+			if peer.SetupKeyID == "" && peer.UserID == "" {
+				unattributed++
 			}
+		}
 
-			if !allowed {
-				return nil, nil, nil, status.NewPermissionDeniedError()
+		for _, peer := range peers {
+			if err = am.validatePeerDelete(ctx, transaction, accountID, peer.ID); err != nil {
+				if sErr, ok := status.FromError(err); ok && sErr.Type() == status.PreconditionFailed {
+					log.WithContext(ctx).Debugf("skipping deletion of peer %s registered with setup key %s: %v", peer.ID, setupKeyID, err)
+					skippedPeerIDs = append(skippedPeerIDs, peer.ID)
+					continue
+				}
+				return err
 			}
-		} else {
-			accountID = user.AccountID
-			groupsToAdd = user.AutoGroups
+			peersToDelete = append(peersToDelete, peer)
 		}
-		opEvent.InitiatorID = userID
-		opEvent.Activity = activity.PeerAddedByUser
-	} else {
-		// Validate the setup key
-		sk, err := am.Store.GetSetupKeyBySecret(ctx, store.LockingStrengthNone, encodedHashedKey)
+
+		if len(peersToDelete) == 0 {
+			return nil
+		}
+
+		eventsToStore, err = deletePeers(ctx, am, transaction, accountID, userID, peersToDelete, settings)
 		if err != nil {
-			return nil, nil, nil, status.Errorf(status.NotFound, "couldn't add peer: setup key is invalid")
+			return fmt.Errorf("failed to delete setup key peers: %w", err)
 		}
 
-		// we will check key twice for early return
-		if !sk.IsValid() {
-			return nil, nil, nil, status.Errorf(status.NotFound, "couldn't add peer: setup key is invalid")
+		if err = transaction.IncrementNetworkSerial(ctx, accountID); err != nil {
+			return fmt.Errorf("failed to increment network serial: %w", err)
 		}
 
-		opEvent.InitiatorID = sk.Id
-		opEvent.Activity = activity.PeerAddedWithSetupKey
-		groupsToAdd = sk.AutoGroups
-		ephemeral = sk.Ephemeral
-		setupKeyID = sk.Id
-		setupKeyName = sk.Name
-		allowExtraDNSLabels = sk.AllowExtraDNSLabels
-		accountID = sk.AccountID
-		if !sk.AllowExtraDNSLabels && len(peer.ExtraDNSLabels) > 0 {
-			return nil, nil, nil, status.Errorf(status.PreconditionFailed, "couldn't add peer: setup key doesn't allow extra DNS labels")
-		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, 0, err
 	}
-	opEvent.AccountID = accountID
 
-	if temporary {
-		ephemeral = true
+	if unattributed > 0 {
+		log.WithContext(ctx).Warnf("%d peers of account %s can't be matched to the setup key they were registered with and were not deleted", unattributed, accountID)
 	}
 
-	if (strings.ToLower(peer.Meta.Hostname) == "iphone" || strings.ToLower(peer.Meta.Hostname) == "ipad") && userID != "" {
-		if am.idpManager != nil {
-			userdata, err := am.idpManager.GetUserDataByID(ctx, userID, idp.AppMetadata{WTAccountID: accountID})
-			if err == nil && userdata != nil {
-				peer.Meta.Hostname = fmt.Sprintf("%s-%s", peer.Meta.Hostname, strings.Split(userdata.Email, "@")[0])
-			}
-		}
+	if len(peersToDelete) == 0 {
+		return 0, skippedPeerIDs, unattributed, nil
 	}
 
-	if err := domain.ValidateDomainsList(peer.ExtraDNSLabels); err != nil {
-		return nil, nil, nil, status.Errorf(status.InvalidArgument, "invalid extra DNS labels: %v", err)
+	for _, storeEvent := range eventsToStore {
+		storeEvent()
 	}
 
-	registrationTime := time.Now().UTC()
-	newPeer = &nbpeer.Peer{
-		ID:                          xid.New().String(),
-		AccountID:                   accountID,
-		Key:                         peer.Key,
-		Meta:                        peer.Meta,
-		Name:                        peer.Meta.Hostname,
-		UserID:                      userID,
-		Status:                      &nbpeer.PeerStatus{Connected: false, LastSeen: registrationTime},
-		SSHEnabled:                  false,
-		SSHKey:                      peer.SSHKey,
-		LastLogin:                   &registrationTime,
-		CreatedAt:                   registrationTime,
-		LoginExpirationEnabled:      addedByUser && !temporary,
-		Ephemeral:                   ephemeral,
-		Location:                    peer.Location,
-		InactivityExpirationEnabled: addedByUser && !temporary,
-		ExtraDNSLabels:              peer.ExtraDNSLabels,
-		AllowExtraDNSLabels:         allowExtraDNSLabels,
-	}
-	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to get account settings: %w", err)
-	}
+	am.onPeersDeleted(ctx, settings, accountID, userID, peersToDelete)
 
-	if am.geo != nil && newPeer.Location.ConnectionIP != nil {
-		location, err := am.geo.Lookup(newPeer.Location.ConnectionIP)
-		if err != nil {
-			log.WithContext(ctx).Warnf("failed to get location for new peer realip: [%s]: %v", newPeer.Location.ConnectionIP.String(), err)
-		} else {
-			newPeer.Location.CountryCode = location.Country.ISOCode
-			newPeer.Location.CityName = location.City.Names.En
-			newPeer.Location.GeoNameID = location.City.GeonameID
+	return len(peersToDelete), skippedPeerIDs, unattributed, nil
+}
+
+// onPeersDeleted notifies the webhook, the integrated validator and the network map controller about deleted peers
+func (am *DefaultAccountManager) onPeersDeleted(ctx context.Context, settings *types.Settings, accountID, userID string, peers []*nbpeer.Peer) {
+	peerIDs := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		peerIDs = append(peerIDs, peer.ID)
+		am.notifyPeerWebhook(ctx, settings, webhook.EventPeerDeleted, accountID, userID, peer)
+		if peer.Status.IsPendingApproval() {
+			am.notifyPeerWebhook(ctx, settings, webhook.EventPeerRejected, accountID, userID, peer)
+		}
+		if err := am.integratedPeerValidator.PeerDeleted(ctx, accountID, peer.ID, settings.Extra); err != nil {
+			log.WithContext(ctx).Errorf("failed to delete peer %s from integrated validator: %v", peer.ID, err)
 		}
 	}
 
-	newPeer = am.integratedPeerValidator.PreparePeer(ctx, accountID, newPeer, groupsToAdd, settings.Extra, temporary)
+	if err := am.networkMapController.OnPeersDeleted(ctx, accountID, peerIDs); err != nil {
+		log.WithContext(ctx).Errorf("failed to delete peers %s from network map: %v", peerIDs, err)
+	}
+}
 
-	network, err := am.Store.GetAccountNetwork(ctx, store.LockingStrengthNone, accountID)
+// getOrphanedPeers returns the peers of an account whose owner is not one of the account users
+func getOrphanedPeers(ctx context.Context, s store.Store, lockStrength store.LockingStrength, accountID string) ([]*nbpeer.Peer, error) {
+	users, err := s.GetAccountUsers(ctx, store.LockingStrengthNone, accountID)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed getting network: %w", err)
+		return nil, err
 	}
 
-	maxAttempts := 10
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		var freeIP net.IP
-		freeIP, err = types.AllocateRandomPeerIP(network.Net)
-		if err != nil {
-			return nil, nil, nil, fmt.Errorf("failed to get free IP: %w", err)
-		}
-
-		var freeLabel string
-		if ephemeral || attempt > 1 {
-			freeLabel, err = getPeerIPDNSLabel(freeIP, peer.Meta.Hostname)
-			if err != nil {
-				return nil, nil, nil, fmt.Errorf("failed to get free DNS label: %w", err)
-			}
-		} else {
-			freeLabel, err = nbdns.GetParsedDomainLabel(peer.Meta.Hostname)
-			if err != nil {
-				return nil, nil, nil, fmt.Errorf("failed to get free DNS label: %w", err)
-			}
-		}
-		newPeer.DNSLabel = freeLabel
-		newPeer.IP = freeIP
-
-		err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
-			err = transaction.AddPeerToAccount(ctx, newPeer)
-			if err != nil {
-				return err
-			}
-
-			if len(groupsToAdd) > 0 {
-				for _, g := range groupsToAdd {
-					err = transaction.AddPeerToGroup(ctx, newPeer.AccountID, newPeer.ID, g)
-					if err != nil {
-						return err
-					}
-				}
-			}
-
-			err = transaction.AddPeerToAllGroup(ctx, accountID, newPeer.ID)
-			if err != nil {
-				return fmt.Errorf("failed adding peer to All group: %w", err)
-			}
-
-			if addedByUser {
-				err := transaction.SaveUserLastLogin(ctx, accountID, userID, newPeer.GetLastLogin())
-				if err != nil {
-					log.WithContext(ctx).Debugf("failed to update user last login: %v", err)
-				}
-			} else {
-				sk, err := transaction.GetSetupKeyBySecret(ctx, store.LockingStrengthUpdate, encodedHashedKey)
-				if err != nil {
-					return fmt.Errorf("failed to get setup key: %w", err)
-				}
-
-				// we validate at the end to not block the setup key for too long
-				if !sk.IsValid() {
-					return status.Errorf(status.PreconditionFailed, "couldn't add peer: setup key is invalid")
-				}
-
-				err = transaction.IncrementSetupKeyUsage(ctx, setupKeyID)
-				if err != nil {
-					return fmt.Errorf("failed to increment setup key usage: %w", err)
-				}
-			}
-
-			err = transaction.IncrementNetworkSerial(ctx, accountID)
-			if err != nil {
-				return fmt.Errorf("failed to increment network serial: %w", err)
-			}
-
-			if ephemeral {
-				// we should track ephemeral peers to be able to clean them if the peer doesn't sync and isn't marked as connected
-				am.networkMapController.TrackEphemeralPeer(ctx, newPeer)
-			}
+	userIDs := make(map[string]struct{}, len(users))
+	for _, user := range users {
+		userIDs[user.Id] = struct{}{}
+	}
 
-			log.WithContext(ctx).Debugf("Peer %s added to account %s", newPeer.ID, accountID)
-			return nil
-		})
-		if err == nil {
-			break
-		}
+	accountPeers, err := s.GetAccountPeers(ctx, lockStrength, accountID, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
 
-		if isUniqueConstraintError(err) {
-			log.WithContext(ctx).WithFields(log.Fields{"dns_label": freeLabel, "ip": freeIP}).Tracef("Failed to add peer in attempt %d, retrying: %v", attempt, err)
+	peers := make([]*nbpeer.Peer, 0)
+	for _, peer := range accountPeers {
+		if peer.UserID == "" {
 			continue
 		}
-
-		return nil, nil, nil, fmt.Errorf("failed to add peer to database: %w", err)
-	}
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to add peer to database after %d attempts: %w", maxAttempts, err)
+		if _, ok := userIDs[peer.UserID]; !ok {
+			peers = append(peers, peer)
+		}
 	}
 
-	if newPeer == nil {
-		return nil, nil, nil, fmt.Errorf("new peer is nil")
-	}
+	return peers, nil
+}
 
-	opEvent.TargetID = newPeer.ID
-	opEvent.Meta = newPeer.EventMeta(am.networkMapController.GetDNSDomain(settings))
-	if !addedByUser {
-		opEvent.Meta["setup_key_name"] = setupKeyName
+func (am *DefaultAccountManager) getUserAccessiblePeers(ctx context.Context, accountID string, peersMap map[string]*nbpeer.Peer, peers []*nbpeer.Peer) ([]*nbpeer.Peer, error) {
+	account, err := am.requestBuffer.GetAccountWithBackpressure(ctx, accountID)
+	if err != nil {
+		return nil, err
 	}
 
-	am.StoreEvent(ctx, opEvent.InitiatorID, opEvent.TargetID, opEvent.AccountID, opEvent.Activity, opEvent.Meta)
+	approvedPeersMap, err := am.integratedPeerValidator.GetValidatedPeers(ctx, accountID, maps.Values(account.Groups), maps.Values(account.Peers), account.Settings.Extra)
+	if err != nil {
+		return nil, err
+	}
+	account.RemovePeersPendingApproval(approvedPeersMap)
 
-	if err := am.networkMapController.OnPeersAdded(ctx, accountID, []string{newPeer.ID}); err != nil {
-		log.WithContext(ctx).Errorf("failed to update network map cache for peer %s: %v", newPeer.ID, err)
+	// fetch all the peers that have access to the user's peers
+	for _, peer := range peers {
+		aclPeers, _, _, _ := account.GetPeerConnectionResources(ctx, peer, approvedPeersMap, account.GetActiveGroupUsers())
+		for _, p := range aclPeers {
+			peersMap[p.ID] = p
+		}
 	}
 
-	p, nmap, pc, _, err := am.networkMapController.GetValidatedPeerWithMap(ctx, false, accountID, newPeer)
-	return p, nmap, pc, err
+	return maps.Values(peersMap), nil
 }
 
-func getPeerIPDNSLabel(ip net.IP, peerHostName string) (string, error) {
-	ip = ip.To4()
+// MarkPeerConnected marks peer as connected (true) or disconnected (false). A disconnect of the peer delayed by the
+// disconnect grace period of the account is dropped, and the peer status is left untouched when the peer reconnects
+// within the period from the same address
+func (am *DefaultAccountManager) MarkPeerConnected(ctx context.Context, peerPubKey string, connected bool, realIP net.IP, realPort uint16, accountID string) error {
+	if am.peerDisconnects.cancel(peerPubKey) && connected {
+		peer, err := am.Store.GetPeerByPeerPubKey(ctx, store.LockingStrengthNone, peerPubKey)
+		if err != nil {
+			return err
+		}
 
-	dnsName, err := nbdns.GetParsedDomainLabel(peerHostName)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse peer host name %s: %w", peerHostName, err)
+		if !am.peerConnectionAddressChanged(peer, realIP, realPort) {
+			log.WithContext(ctx).Debugf("peer %s reconnected within the disconnect grace period", peerPubKey)
+			return nil
+		}
 	}
+	return am.markPeerConnected(ctx, peerPubKey, connected, realIP, realPort, accountID)
+}
 
-	return fmt.Sprintf("%s-%d-%d", dnsName, ip[2], ip[3]), nil
+// peerConnectionAddressChanged reports whether the peer connects from another address than the stored one. The IP is
+// only compared when geolocation is enabled, as it isn't stored otherwise
+func (am *DefaultAccountManager) peerConnectionAddressChanged(peer *nbpeer.Peer, realIP net.IP, realPort uint16) bool {
+	if peer.Location.ConnectionPort != realPort {
+		return true
+	}
+	return am.geo != nil && realIP != nil && !realIP.Equal(peer.Location.ConnectionIP)
 }
 
-// SyncPeer checks whether peer is eligible for receiving NetworkMap (authenticated) and returns its NetworkMap if eligible
-func (am *DefaultAccountManager) SyncPeer(ctx context.Context, sync types.PeerSync, accountID string) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, int64, error) {
+func (am *DefaultAccountManager) markPeerConnected(ctx context.Context, peerPubKey string, connected bool, realIP net.IP, realPort uint16, accountID string) error {
 	var peer *nbpeer.Peer
-	var updated, versionChanged bool
+	var settings *types.Settings
+	var expired, connectionChanged bool
 	var err error
-	var postureChecks []*posture.Checks
-	var peerGroupIDs []string
-
-	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
-	if err != nil {
-		return nil, nil, nil, 0, err
-	}
 
 	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
-		peer, err = transaction.GetPeerByPeerPubKey(ctx, store.LockingStrengthUpdate, sync.WireGuardPubKey)
+		peer, err = transaction.GetPeerByPeerPubKey(ctx, store.LockingStrengthUpdate, peerPubKey)
 		if err != nil {
-			return status.NewPeerNotRegisteredError()
-		}
-
-		if peer.UserID != "" {
-			user, err := transaction.GetUserByUserID(ctx, store.LockingStrengthNone, peer.UserID)
-			if err != nil {
-				return err
-			}
-
-			if err = checkIfPeerOwnerIsBlocked(peer, user); err != nil {
-				return err
-			}
+			return err
 		}
 
-		if peerLoginExpired(ctx, peer, settings) {
-			return status.NewPeerLoginExpiredError()
-		}
+		connectionChanged = peer.Status.Connected != connected
+		expired, err = updatePeerStatusAndLocation(ctx, am.geo, transaction, peer, connected, realIP, realPort, accountID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
 
-		peerGroupIDs, err = getPeerGroupIDs(ctx, transaction, accountID, peer.ID)
+	if peer.AddedWithSSOLogin() || connectionChanged {
+		settings, err = am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
 		if err != nil {
 			return err
 		}
+	}
 
-		updated, versionChanged = peer.UpdateMetaIfNew(sync.Meta)
-		if updated {
-			am.metrics.AccountManagerMetrics().CountPeerMetUpdate()
-			log.WithContext(ctx).Tracef("peer %s metadata updated", peer.ID)
-			if err = transaction.SavePeer(ctx, accountID, peer); err != nil {
-				return err
-			}
+	if peer.AddedWithSSOLogin() {
+		if peer.LoginExpirationEnabled && settings.PeerLoginExpirationEnabled {
+			am.schedulePeerLoginExpiration(ctx, accountID)
+		}
 
-			postureChecks, err = getPeerPostureChecks(ctx, transaction, accountID, peer.ID)
-			if err != nil {
-				return err
-			}
+		if peer.InactivityExpirationEnabled && settings.PeerInactivityExpirationEnabled {
+			am.checkAndSchedulePeerInactivityExpiration(ctx, accountID)
 		}
-		return nil
-	})
-	if err != nil {
-		return nil, nil, nil, 0, err
 	}
 
-	peerNotValid, isStatusChanged, err := am.integratedPeerValidator.IsNotValidPeer(ctx, accountID, peer, peerGroupIDs, settings.Extra)
-	if err != nil {
-		return nil, nil, nil, 0, err
+	if expired {
+		err = am.networkMapController.OnPeersUpdated(ctx, accountID, []string{peer.ID})
+		if err != nil {
+			return fmt.Errorf("notify network map controller of peer update: %w", err)
+		}
+		return nil
 	}
 
-	if isStatusChanged || sync.UpdateAccountPeers || (updated && (len(postureChecks) > 0 || versionChanged)) {
-		err = am.networkMapController.OnPeersUpdated(ctx, accountID, []string{peer.ID})
+	// with the network maps limited to connected peers, the peers having the peer in their map have to learn about it (dis)connecting
+	if connectionChanged && settings.NetworkMapConnectedPeersOnly {
+		err = am.networkMapController.OnPeerConnectionChanged(ctx, accountID, peer.ID)
 		if err != nil {
-			return nil, nil, nil, 0, fmt.Errorf("notify network map controller of peer update: %w", err)
+			return fmt.Errorf("notify network map controller of peer connection change: %w", err)
 		}
 	}
 
-	return am.networkMapController.GetValidatedPeerWithMap(ctx, peerNotValid, accountID, peer)
+	return nil
 }
 
-func (am *DefaultAccountManager) handlePeerLoginNotFound(ctx context.Context, login types.PeerLogin, err error) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, error) {
-	if errStatus, ok := status.FromError(err); ok && errStatus.Type() == status.NotFound {
-		// we couldn't find this peer by its public key which can mean that peer hasn't been registered yet.
-		// Try registering it.
-		newPeer := &nbpeer.Peer{
-			Key:            login.WireGuardPubKey,
-			Meta:           login.Meta,
-			SSHKey:         login.SSHKey,
-			Location:       nbpeer.Location{ConnectionIP: login.ConnectionIP},
-			ExtraDNSLabels: login.ExtraDNSLabels,
+func updatePeerStatusAndLocation(ctx context.Context, geo geolocation.Geolocation, transaction store.Store, peer *nbpeer.Peer, connected bool, realIP net.IP, realPort uint16, accountID string) (bool, error) {
+	oldStatus := peer.Status.Copy()
+	newStatus := oldStatus
+	newStatus.LastSeen = time.Now().UTC()
+	newStatus.Connected = connected
+	// whenever peer got connected that means that it logged in successfully
+	if newStatus.Connected {
+		newStatus.LoginExpired = false
+	}
+	peer.Status = newStatus
+
+	if connected && peer.FirstConnectedAt == nil {
+		firstConnectedAt := newStatus.LastSeen
+		peer.FirstConnectedAt = &firstConnectedAt
+		if err := transaction.SavePeerFirstConnectedAt(ctx, accountID, peer.ID, firstConnectedAt); err != nil {
+			return false, err
 		}
+	}
 
-		return am.AddPeer(ctx, "", login.SetupKey, login.UserID, newPeer, false)
+	// the port is saved on its own, so it is recorded without geolocation and cleared when it is no longer known
+	if connected && peer.Location.ConnectionPort != realPort {
+		peer.Location.ConnectionPort = realPort
+		if err := transaction.SavePeerConnectionPort(ctx, accountID, peer.ID, realPort); err != nil {
+			log.WithContext(ctx).Warnf("could not store connection port for peer %s: %s", peer.ID, err)
+		}
 	}
 
-	log.WithContext(ctx).Errorf("failed while logging in peer %s: %v", login.WireGuardPubKey, err)
-	return nil, nil, nil, status.Errorf(status.Internal, "failed while logging in peer")
+	if geo != nil && realIP != nil {
+		location, err := geo.Lookup(realIP)
+		if err != nil {
+			log.WithContext(ctx).Warnf("failed to get location for peer %s realip: [%s]: %v", peer.ID, realIP.String(), err)
+		} else {
+			peer.Location.ConnectionIP = realIP
+			peer.Location.CountryCode = location.Country.ISOCode
+			peer.Location.CityName = location.City.Names.En
+			peer.Location.GeoNameID = location.City.GeonameID
+			peer.Location.SubdivisionCode = location.SubdivisionCode()
+			err = transaction.SavePeerLocation(ctx, accountID, peer)
+			if err != nil {
+				log.WithContext(ctx).Warnf("could not store location for peer %s: %s", peer.ID, err)
+			}
+		}
+	}
+
+	log.WithContext(ctx).Debugf("saving peer status for peer %s is connected: %t", peer.ID, connected)
+
+	err := transaction.SavePeerStatus(ctx, accountID, peer.ID, *newStatus)
+	if err != nil {
+		return false, err
+	}
+
+	return oldStatus.LoginExpired, nil
 }
 
-// LoginPeer logs in or registers a peer.
-// If peer doesn't exist the function checks whether a setup key or a user is present and registers a new peer if so.
-func (am *DefaultAccountManager) LoginPeer(ctx context.Context, login types.PeerLogin) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, error) {
-	accountID, err := am.Store.GetAccountIDByPeerPubKey(ctx, login.WireGuardPubKey)
+// UpdatePeer updates peer. Only Peer.Name, Peer.Description, Peer.SSHEnabled, Peer.LoginExpirationEnabled, Peer.InactivityExpirationEnabled
+// and the approval through Peer.Status.RequiresApproval can be updated, the other fields of the update are ignored.
+func (am *DefaultAccountManager) UpdatePeer(ctx context.Context, accountID, userID string, update *nbpeer.Peer) (*nbpeer.Peer, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Update)
 	if err != nil {
-		return am.handlePeerLoginNotFound(ctx, login, err)
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
 	}
 
-	// when the client sends a login request with a JWT which is used to get the user ID,
-	// it means that the client has already checked if it needs login and had been through the SSO flow
-	// so, we can skip this check and directly proceed with the login
-	if login.UserID == "" {
-		err = am.checkIFPeerNeedsLoginWithoutLock(ctx, accountID, login)
+	var peer *nbpeer.Peer
+	var settings *types.Settings
+	var peerGroupList []string
+	var peerLabelChanged bool
+	var descriptionChanged bool
+	var sshChanged bool
+	var loginExpirationChanged bool
+	var inactivityExpirationChanged bool
+	var approved bool
+	var dnsDomain string
+
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		peer, err = transaction.GetPeerByID(ctx, store.LockingStrengthUpdate, accountID, update.ID)
 		if err != nil {
-			return nil, nil, nil, err
+			return err
+		}
+
+		if peer.ManagedBySetupKeyOnly && peerSettingsChanged(peer, update) {
+			return newPeerManagedBySetupKeyError(peer.ID)
+		}
+
+		settings, err = transaction.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+		if err != nil {
+			return err
+		}
+
+		peerGroupList, err = getPeerGroupIDs(ctx, transaction, accountID, update.ID)
+		if err != nil {
+			return err
+		}
+
+		dnsDomain = am.networkMapController.GetDNSDomain(settings)
+
+		update, _, err = am.integratedPeerValidator.ValidatePeer(ctx, update, peer, userID, accountID, dnsDomain, peerGroupList, settings.Extra)
+		if err != nil {
+			return err
+		}
+
+		if update.Status != nil && !update.Status.RequiresApproval {
+			approved = peer.Status.IsPendingApproval()
+			peer.Status.RequiresApproval = false
+			peer.Status.UpdatePendingApproval(false, time.Now().UTC())
+		}
+
+		if peer.Name != update.Name {
+			var newLabel string
+
+			newLabel, err = getPeerDNSLabel(settings, update.Name)
+			if err != nil {
+				newLabel = ""
+			} else {
+				reserved, err := checkReservedDNSLabel(settings, newLabel)
+				if err != nil {
+					return err
+				}
+
+				_, err = transaction.GetPeerIdByLabel(ctx, store.LockingStrengthNone, accountID, update.Name)
+				if reserved || err == nil {
+					newLabel = ""
+				}
+			}
+
+			if newLabel == "" {
+				newLabel, err = getPeerIPDNSLabel(ctx, transaction, settings, accountID, peer.IP, update.Name)
+				if err != nil {
+					return fmt.Errorf("failed to get free DNS label: %w", err)
+				}
+			}
+			peer.Name = update.Name
+			peer.DNSLabel = newLabel
+			peerLabelChanged = true
+		}
+
+		if peer.Description != update.Description {
+			if utf8.RuneCountInString(update.Description) > maxPeerDescriptionLength {
+				return status.Errorf(status.InvalidArgument, "peer description can't be longer than %d characters", maxPeerDescriptionLength)
+			}
+			peer.Description = update.Description
+			descriptionChanged = true
+		}
+
+		if peer.SSHEnabled != update.SSHEnabled {
+			peer.SSHEnabled = update.SSHEnabled
+			sshChanged = true
+		}
+
+		if peer.LoginExpirationEnabled != update.LoginExpirationEnabled {
+			if !peer.AddedWithSSOLogin() {
+				return status.Errorf(status.PreconditionFailed, "this peer hasn't been added with the SSO login, therefore the login expiration can't be updated")
+			}
+			peer.LoginExpirationEnabled = update.LoginExpirationEnabled
+			loginExpirationChanged = true
+		}
+
+		if peer.InactivityExpirationEnabled != update.InactivityExpirationEnabled {
+			if !peer.AddedWithSSOLogin() {
+				return status.Errorf(status.PreconditionFailed, "this peer hasn't been added with the SSO login, therefore the inactivity expiration can't be updated")
+			}
+			peer.InactivityExpirationEnabled = update.InactivityExpirationEnabled
+			inactivityExpirationChanged = true
+		}
+
+		if err = transaction.IncrementNetworkSerial(ctx, accountID); err != nil {
+			return fmt.Errorf("failed to increment network serial: %w", err)
 		}
+
+		return transaction.SavePeer(ctx, accountID, peer)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	var peer *nbpeer.Peer
-	var updateRemotePeers bool
-	var isPeerUpdated bool
-	var postureChecks []*posture.Checks
-	var peerGroupIDs []string
+	if sshChanged {
+		event := activity.PeerSSHEnabled
+		if !peer.SSHEnabled {
+			event = activity.PeerSSHDisabled
+		}
+		am.StoreEvent(ctx, userID, peer.IP.String(), accountID, event, peer.EventMeta(dnsDomain))
+	}
 
-	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+	if peerLabelChanged {
+		am.StoreEvent(ctx, userID, peer.ID, accountID, activity.PeerRenamed, peer.EventMeta(dnsDomain))
+	}
+
+	if descriptionChanged {
+		am.StoreEvent(ctx, userID, peer.ID, accountID, activity.PeerDescriptionChanged, peer.EventMeta(dnsDomain))
+	}
+
+	if loginExpirationChanged {
+		event := activity.PeerLoginExpirationEnabled
+		if !peer.LoginExpirationEnabled {
+			event = activity.PeerLoginExpirationDisabled
+		}
+		am.StoreEvent(ctx, userID, peer.IP.String(), accountID, event, peer.EventMeta(dnsDomain))
+
+		if peer.AddedWithSSOLogin() && peer.LoginExpirationEnabled && settings.PeerLoginExpirationEnabled {
+			am.peerLoginExpiry.Cancel(ctx, []string{accountID})
+			am.schedulePeerLoginExpiration(ctx, accountID)
+		}
+	}
+
+	if inactivityExpirationChanged {
+		event := activity.PeerInactivityExpirationEnabled
+		if !peer.InactivityExpirationEnabled {
+			event = activity.PeerInactivityExpirationDisabled
+		}
+		am.StoreEvent(ctx, userID, peer.IP.String(), accountID, event, peer.EventMeta(dnsDomain))
+
+		if peer.AddedWithSSOLogin() && peer.InactivityExpirationEnabled && settings.PeerInactivityExpirationEnabled {
+			am.checkAndSchedulePeerInactivityExpiration(ctx, accountID)
+		}
+	}
+
+	if approved {
+		am.onPeerApprovalChanged(ctx, settings, userID, peer, false, peerApprovalTriggerUser)
+	}
+
+	err = am.networkMapController.OnPeersUpdated(ctx, accountID, []string{peer.ID})
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, fmt.Errorf("notify network map controller of peer update: %w", err)
+	}
+
+	return peer, nil
+}
+
+// peerSettingsChanged returns true if the update changes any of the peer settings editable with UpdatePeer.
+// Approving a pending peer isn't considered a settings change
+func peerSettingsChanged(peer, update *nbpeer.Peer) bool {
+	return peer.Name != update.Name ||
+		peer.Description != update.Description ||
+		peer.SSHEnabled != update.SSHEnabled ||
+		peer.LoginExpirationEnabled != update.LoginExpirationEnabled ||
+		peer.InactivityExpirationEnabled != update.InactivityExpirationEnabled
+}
+
+// newPeerManagedBySetupKeyError is returned for changes to the settings of a peer managed by its setup key
+func newPeerManagedBySetupKeyError(peerID string) error {
+	return status.Errorf(status.PreconditionFailed, "peer %s is managed by its setup key, changes must be made through the setup key or its groups", peerID)
+}
+
+// SetGroupSSHEnabled enables or disables the SSH server of every peer in the group in a single transaction and
+// returns the number of peers changed. Peers already in the desired state are left untouched
+func (am *DefaultAccountManager) SetGroupSSHEnabled(ctx context.Context, accountID, userID, groupID string, enabled bool) (int, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Update)
+	if err != nil {
+		return 0, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return 0, status.NewPermissionDeniedError()
 	}
 
+	var changedPeers []*nbpeer.Peer
+	var dnsDomain string
+
 	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
-		peer, err = transaction.GetPeerByPeerPubKey(ctx, store.LockingStrengthUpdate, login.WireGuardPubKey)
+		changedPeers = nil
+
+		group, err := transaction.GetGroupByID(ctx, store.LockingStrengthNone, accountID, groupID)
 		if err != nil {
 			return err
 		}
 
-		// this flag prevents unnecessary calls to the persistent store.
-		shouldStorePeer := false
+		settings, err := transaction.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+		if err != nil {
+			return err
+		}
+		dnsDomain = am.networkMapController.GetDNSDomain(settings)
 
-		if login.UserID != "" {
-			if peer.UserID != login.UserID {
-				log.Warnf("user mismatch when logging in peer %s: peer user %s, login user %s ", peer.ID, peer.UserID, login.UserID)
-				return status.NewPeerLoginMismatchError()
+		peers, err := transaction.GetPeersByIDs(ctx, store.LockingStrengthUpdate, accountID, group.Peers)
+		if err != nil {
+			return err
+		}
+
+		for _, peerID := range group.Peers {
+			peer, ok := peers[peerID]
+			if !ok || peer.SSHEnabled == enabled {
+				continue
 			}
 
-			changed, err := am.handleUserPeer(ctx, transaction, peer, settings)
+			peerGroupList, err := getPeerGroupIDs(ctx, transaction, accountID, peer.ID)
 			if err != nil {
 				return err
 			}
 
-			if changed {
-				shouldStorePeer = true
-				updateRemotePeers = true
+			update := peer.Copy()
+			update.SSHEnabled = enabled
+			update, _, err = am.integratedPeerValidator.ValidatePeer(ctx, update, peer, userID, accountID, dnsDomain, peerGroupList, settings.Extra)
+			if err != nil {
+				return err
 			}
+			if update.SSHEnabled == peer.SSHEnabled {
+				continue
+			}
+
+			peer.SSHEnabled = update.SSHEnabled
+			if err = transaction.SavePeer(ctx, accountID, peer); err != nil {
+				return err
+			}
+			changedPeers = append(changedPeers, peer)
 		}
 
-		peerGroupIDs, err = getPeerGroupIDs(ctx, transaction, accountID, peer.ID)
-		if err != nil {
-			return err
+		if len(changedPeers) == 0 {
+			return nil
 		}
 
-		isPeerUpdated, _ = peer.UpdateMetaIfNew(login.Meta)
-		if isPeerUpdated {
-			am.metrics.AccountManagerMetrics().CountPeerMetUpdate()
-			shouldStorePeer = true
+		if err = transaction.IncrementNetworkSerial(ctx, accountID); err != nil {
+			return fmt.Errorf("failed to increment network serial: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(changedPeers) == 0 {
+		return 0, nil
+	}
+
+	event := activity.PeerSSHEnabled
+	if !enabled {
+		event = activity.PeerSSHDisabled
+	}
+
+	peerIDs := make([]string, 0, len(changedPeers))
+	for _, peer := range changedPeers {
+		am.StoreEvent(ctx, userID, peer.IP.String(), accountID, event, peer.EventMeta(dnsDomain))
+		peerIDs = append(peerIDs, peer.ID)
+	}
+
+	err = am.networkMapController.OnPeersUpdated(ctx, accountID, peerIDs)
+	if err != nil {
+		return 0, fmt.Errorf("notify network map controller of peer update: %w", err)
+	}
+
+	return len(changedPeers), nil
+}
+
+// UpdatePeerFirewallOverrides replaces the firewall overrides of the peer and sends the peer its updated network map
+func (am *DefaultAccountManager) UpdatePeerFirewallOverrides(ctx context.Context, accountID, userID, peerID string, overrides []nbpeer.FirewallOverride) (*nbpeer.Peer, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Update)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	if err = nbpeer.ValidateFirewallOverrides(overrides); err != nil {
+		return nil, status.Errorf(status.InvalidArgument, "%s", err)
+	}
+
+	var peer *nbpeer.Peer
+	var dnsDomain string
+
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		peer, err = transaction.GetPeerByID(ctx, store.LockingStrengthUpdate, accountID, peerID)
+		if err != nil {
+			return err
+		}
+
+		if peer.ManagedBySetupKeyOnly && !slices.Equal(peer.FirewallOverrides, overrides) {
+			return newPeerManagedBySetupKeyError(peer.ID)
+		}
+
+		settings, err := transaction.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+		if err != nil {
+			return err
+		}
+		dnsDomain = am.networkMapController.GetDNSDomain(settings)
+
+		peer.FirewallOverrides = overrides
+
+		if err = transaction.IncrementNetworkSerial(ctx, accountID); err != nil {
+			return fmt.Errorf("failed to increment network serial: %w", err)
+		}
+
+		return transaction.SavePeer(ctx, accountID, peer)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	am.StoreEvent(ctx, userID, peer.ID, accountID, activity.PeerFirewallOverridesUpdated, peer.EventMeta(dnsDomain))
+
+	am.UpdateAccountPeer(ctx, accountID, peer.ID)
+
+	return peer, nil
+}
+
+// UpdatePeerAdminNotes sets the admin notes of the peer. The notes are not part of the network map, so the peers
+// are not updated and the network serial is left untouched
+func (am *DefaultAccountManager) UpdatePeerAdminNotes(ctx context.Context, accountID, userID, peerID, notes string) (*nbpeer.Peer, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Update)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	if utf8.RuneCountInString(notes) > maxPeerAdminNotesLength {
+		return nil, status.Errorf(status.InvalidArgument, "peer admin notes can't be longer than %d characters", maxPeerAdminNotesLength)
+	}
+
+	var peer *nbpeer.Peer
+	var dnsDomain string
+	var changed bool
+
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		peer, err = transaction.GetPeerByID(ctx, store.LockingStrengthUpdate, accountID, peerID)
+		if err != nil {
+			return err
+		}
+
+		if peer.AdminNotes == notes {
+			return nil
+		}
+
+		settings, err := transaction.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+		if err != nil {
+			return err
+		}
+		dnsDomain = am.networkMapController.GetDNSDomain(settings)
+
+		peer.AdminNotes = notes
+		changed = true
+
+		return transaction.SavePeer(ctx, accountID, peer)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		meta := peer.EventMeta(dnsDomain)
+		meta["admin_notes"] = peer.AdminNotes
+		am.StoreEvent(ctx, userID, peer.ID, accountID, activity.PeerAdminNotesChanged, meta)
+	}
+
+	return peer, nil
+}
+
+func (am *DefaultAccountManager) CreatePeerJob(ctx context.Context, accountID, peerID, userID string, job *types.Job) error {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.RemoteJobs, operations.Create)
+	if err != nil {
+		return status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return status.NewPermissionDeniedError()
+	}
+
+	p, err := am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID)
+	if err != nil {
+		return err
+	}
+
+	if p.AccountID != accountID {
+		return status.NewPeerNotPartOfAccountError()
+	}
+
+	meetMinVer, err := posture.MeetsMinVersion(remoteJobsMinVer, p.Meta.WtVersion)
+	if !strings.Contains(p.Meta.WtVersion, "dev") && (!meetMinVer || err != nil) {
+		return status.Errorf(status.PreconditionFailed, "peer version %s does not meet the minimum required version %s for remote jobs", p.Meta.WtVersion, remoteJobsMinVer)
+	}
+
+	if !am.jobManager.IsPeerConnected(peerID) {
+		return status.Errorf(status.BadRequest, "peer not connected")
+	}
+
+	// check if already has pending jobs
+	// todo: The job checks here are not protected. The user can run this function from multiple threads,
+	// and each thread can think there is no job yet. This means entries in the pending job map will be overwritten,
+	// and only one will be kept, but potentially another one will overwrite it in the queue.
+	if am.jobManager.IsPeerHasPendingJobs(peerID) {
+		return status.Errorf(status.BadRequest, "peer already has pending job")
+	}
+
+	jobStream, err := job.ToStreamJobRequest()
+	if err != nil {
+		return status.Errorf(status.BadRequest, "invalid job request %v", err)
+	}
+
+	// try sending job first
+	if err := am.jobManager.SendJob(ctx, accountID, peerID, jobStream); err != nil {
+		return status.Errorf(status.Internal, "failed to send job: %v", err)
+	}
+
+	var peer *nbpeer.Peer
+	var eventsToStore func()
+
+	// persist job in DB only if send succeeded
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		peer, err = transaction.GetPeerByID(ctx, store.LockingStrengthUpdate, accountID, peerID)
+		if err != nil {
+			return err
+		}
+		if err := transaction.CreatePeerJob(ctx, job); err != nil {
+			return err
+		}
+
+		jobMeta := map[string]any{
+			"for_peer_name": peer.Name,
+			"job_type":      job.Workload.Type,
+		}
+
+		eventsToStore = func() {
+			am.StoreEvent(ctx, userID, peer.ID, accountID, activity.JobCreatedByUser, jobMeta)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	eventsToStore()
+	return nil
+}
+
+func (am *DefaultAccountManager) GetAllPeerJobs(ctx context.Context, accountID, userID, peerID string) ([]*types.Job, error) {
+	// todo: Create permissions for job
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.RemoteJobs, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	peerAccountID, err := am.Store.GetAccountIDByPeerID(ctx, store.LockingStrengthNone, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if peerAccountID != accountID {
+		return nil, status.NewPeerNotPartOfAccountError()
+	}
+
+	accountJobs, err := am.Store.GetPeerJobs(ctx, accountID, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return accountJobs, nil
+}
+
+func (am *DefaultAccountManager) GetPeerJobByID(ctx context.Context, accountID, userID, peerID, jobID string) (*types.Job, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.RemoteJobs, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	peerAccountID, err := am.Store.GetAccountIDByPeerID(ctx, store.LockingStrengthNone, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if peerAccountID != accountID {
+		return nil, status.NewPeerNotPartOfAccountError()
+	}
+
+	job, err := am.Store.GetPeerJobByID(ctx, accountID, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// DeletePeer removes peer from the account by its IP
+func (am *DefaultAccountManager) DeletePeer(ctx context.Context, accountID, peerID, userID string) error {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Delete)
+	if err != nil {
+		return status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return status.NewPermissionDeniedError()
+	}
+
+	peerAccountID, err := am.Store.GetAccountIDByPeerID(ctx, store.LockingStrengthNone, peerID)
+	if err != nil {
+		return err
+	}
+
+	if peerAccountID != accountID {
+		return status.NewPeerNotPartOfAccountError()
+	}
+
+	var peer *nbpeer.Peer
+	var settings *types.Settings
+	var eventsToStore []func()
+
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		peer, err = transaction.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID)
+		if err != nil {
+			return err
+		}
+
+		settings, err = transaction.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+		if err != nil {
+			return err
+		}
+
+		if err = am.validatePeerDelete(ctx, transaction, accountID, peerID); err != nil {
+			return err
+		}
+
+		eventsToStore, err = deletePeers(ctx, am, transaction, accountID, userID, []*nbpeer.Peer{peer}, settings)
+		if err != nil {
+			return fmt.Errorf("failed to delete peer: %w", err)
+		}
+
+		if err = transaction.IncrementNetworkSerial(ctx, accountID); err != nil {
+			return fmt.Errorf("failed to increment network serial: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, storeEvent := range eventsToStore {
+		storeEvent()
+	}
+	am.notifyPeerWebhook(ctx, settings, webhook.EventPeerDeleted, accountID, userID, peer)
+	if peer.Status.IsPendingApproval() {
+		am.notifyPeerWebhook(ctx, settings, webhook.EventPeerRejected, accountID, userID, peer)
+	}
+
+	if err = am.integratedPeerValidator.PeerDeleted(ctx, accountID, peerID, settings.Extra); err != nil {
+		log.WithContext(ctx).Errorf("failed to delete peer %s from integrated validator: %v", peerID, err)
+	}
+
+	if err = am.networkMapController.OnPeersDeleted(ctx, accountID, []string{peerID}); err != nil {
+		log.WithContext(ctx).Errorf("failed to delete peer %s from network map: %v", peerID, err)
+	}
+
+	return nil
+}
+
+// notifyPeerWebhook sends the peer event to the account webhook in the background, if the account has one configured
+func (am *DefaultAccountManager) notifyPeerWebhook(ctx context.Context, settings *types.Settings, event, accountID, initiatorID string, peer *nbpeer.Peer) {
+	if settings == nil || settings.PeerWebhookURL == "" {
+		return
+	}
+
+	am.peerWebhooks.Dispatch(ctx, webhook.Endpoint{URL: settings.PeerWebhookURL, Secret: settings.PeerWebhookSecret}, webhook.PeerEvent{
+		Event:       event,
+		Timestamp:   time.Now().UTC(),
+		AccountID:   accountID,
+		PeerID:      peer.ID,
+		PeerName:    peer.Name,
+		PeerIP:      peer.IP.String(),
+		InitiatorID: initiatorID,
+	})
+}
+
+// GetNetworkMap returns Network map for a given peer (omits original peer from the Peers result)
+func (am *DefaultAccountManager) GetNetworkMap(ctx context.Context, peerID string) (*types.NetworkMap, error) {
+	return am.networkMapController.GetNetworkMap(ctx, peerID)
+}
+
+// GetPeerNetworkMapStats returns the size of the network map of a given peer without returning the map itself
+func (am *DefaultAccountManager) GetPeerNetworkMapStats(ctx context.Context, peerID string) (*types.NetworkMapStats, error) {
+	networkMap, err := am.networkMapController.GetNetworkMap(ctx, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := networkMap.Stats()
+	return &stats, nil
+}
+
+// GetPeerDNSConfig returns the DNS configuration the peer receives with its network map: the peers custom zone
+// filtered to the reachable peers, the applied account zones and the nameserver groups with their match domains
+func (am *DefaultAccountManager) GetPeerDNSConfig(ctx context.Context, accountID, userID, peerID string) (*nbdns.Config, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	if _, err = am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID); err != nil {
+		return nil, err
+	}
+
+	networkMap, err := am.networkMapController.GetNetworkMap(ctx, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &networkMap.DNSConfig, nil
+}
+
+// DiffPeerNetworkMaps builds the network maps of two peers of the account and returns their differences in reachable
+// peers, firewall rules, routes and DNS, e.g. to find out why one peer reaches a resource the other one doesn't
+func (am *DefaultAccountManager) DiffPeerNetworkMaps(ctx context.Context, accountID, userID, peerAID, peerBID string) (*types.NetworkMapDiff, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	if peerAID == peerBID {
+		return nil, status.Errorf(status.InvalidArgument, "can't compare the network map of a peer with itself")
+	}
+
+	networkMaps := make([]*types.NetworkMap, 0, 2)
+	for _, peerID := range []string{peerAID, peerBID} {
+		if _, err = am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID); err != nil {
+			return nil, err
+		}
+
+		networkMap, err := am.networkMapController.GetNetworkMap(ctx, peerID)
+		if err != nil {
+			return nil, err
+		}
+		networkMaps = append(networkMaps, networkMap)
+	}
+
+	return types.DiffNetworkMaps(peerAID, networkMaps[0], peerBID, networkMaps[1]), nil
+}
+
+// GenerateDebugWGConfig renders the WireGuard configuration the peer should have according to its network map in the
+// wg-quick format, to be compared with the configuration of the client. The private key is redacted
+func (am *DefaultAccountManager) GenerateDebugWGConfig(ctx context.Context, accountID, userID, peerID string) (string, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return "", status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return "", status.NewPermissionDeniedError()
+	}
+
+	peer, err := am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID)
+	if err != nil {
+		return "", err
+	}
+
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return "", err
+	}
+
+	networkMap, err := am.networkMapController.GetNetworkMap(ctx, peerID)
+	if err != nil {
+		return "", err
+	}
+
+	return types.DebugWGConfig(peer, networkMap, am.networkMapController.GetDNSDomain(settings)), nil
+}
+
+// GetPeerExitNode returns the exit nodes of the peer network map and the effective one, the exit node the peer sends
+// all its traffic through unless another one is selected on the client
+func (am *DefaultAccountManager) GetPeerExitNode(ctx context.Context, accountID, userID, peerID string) (*types.PeerExitNode, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	if _, err = am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID); err != nil {
+		return nil, err
+	}
+
+	networkMap, err := am.networkMapController.GetNetworkMap(ctx, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.PeerExitNode{
+		PeerID:    peerID,
+		Effective: networkMap.EffectiveExitNode(),
+		ExitNodes: networkMap.ExitNodes,
+	}, nil
+}
+
+// GetPeersByVersion returns the peers of the account whose NetBird client version, as reported in their meta, is
+// within the version range, e.g. "< 0.28.0". Peers reporting a version that can't be parsed, like development
+// builds, are left out
+func (am *DefaultAccountManager) GetPeersByVersion(ctx context.Context, accountID, userID, versionConstraint string) ([]*nbpeer.Peer, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	constraints, err := posture.ParseVersionConstraint(versionConstraint)
+	if err != nil {
+		return nil, status.Errorf(status.InvalidArgument, "invalid version constraint %q: %v", versionConstraint, err)
+	}
+
+	peers, err := am.Store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := make([]*nbpeer.Peer, 0)
+	for _, peer := range peers {
+		matches, err := posture.MatchesVersionConstraint(constraints, peer.Meta.WtVersion)
+		if err != nil {
+			log.WithContext(ctx).Tracef("skipping peer %s with unparsable version %q: %v", peer.ID, peer.Meta.WtVersion, err)
+			continue
+		}
+		if matches {
+			matching = append(matching, peer)
+		}
+	}
+
+	return matching, nil
+}
+
+// GetEphemeralPeersPendingCleanup returns the disconnected ephemeral peers of the account tracked by the ephemeral
+// cleanup, together with the time they are scheduled for deletion, ordered by that time
+func (am *DefaultAccountManager) GetEphemeralPeersPendingCleanup(ctx context.Context, accountID, userID string) ([]*types.EphemeralPeerCleanup, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	pending := am.networkMapController.GetEphemeralPeersPendingCleanup(accountID)
+	if len(pending) == 0 {
+		return []*types.EphemeralPeerCleanup{}, nil
+	}
+
+	ephemeral := true
+	peers, err := am.Store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "", &ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	cleanups := make([]*types.EphemeralPeerCleanup, 0, len(pending))
+	for _, peer := range peers {
+		cleanupAt, ok := pending[peer.ID]
+		if !ok {
+			continue
+		}
+		cleanups = append(cleanups, &types.EphemeralPeerCleanup{Peer: peer, CleanupAt: cleanupAt})
+	}
+
+	slices.SortFunc(cleanups, func(a, b *types.EphemeralPeerCleanup) int {
+		return a.CleanupAt.Compare(b.CleanupAt)
+	})
+
+	return cleanups, nil
+}
+
+// GetBufferUpdateState returns the state of the buffered network map updates of the account, to troubleshoot peers
+// not receiving updates. Reading it doesn't interfere with the buffering
+func (am *DefaultAccountManager) GetBufferUpdateState(ctx context.Context, accountID, userID string) (*network_map.AccountBufferUpdateState, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Accounts, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	state := am.networkMapController.GetBufferUpdateState(accountID)
+	return &state, nil
+}
+
+// GetPeerNetwork returns the Network for a given peer
+func (am *DefaultAccountManager) GetPeerNetwork(ctx context.Context, peerID string) (*types.Network, error) {
+	account, err := am.Store.GetAccountByPeerID(ctx, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return account.Network.Copy(), err
+}
+
+// AddPeer adds a new peer to the Store.
+// Each Account has a list of pre-authorized SetupKey and if no Account has a given key err with a code status.PermissionDenied
+// will be returned, meaning the setup key is invalid or not found.
+// If a User ID is provided, it means that we passed the authentication using JWT, then we look for account by User ID and register the peer
+// to it. We also add the User ID to the peer metadata to identify registrant. If no userID provided, then fail with status.PermissionDenied
+// Each new Peer will be assigned a new next net.IP from the Account.Network and Account.Network.LastIP will be updated (IP's are not reused).
+// The peer property is just a placeholder for the Peer properties to pass further
+func (am *DefaultAccountManager) AddPeer(ctx context.Context, accountID, setupKey, userID string, peer *nbpeer.Peer, temporary bool) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, error) {
+	return am.addPeer(ctx, accountID, setupKey, userID, peer, temporary, addPeerOptions{})
+}
+
+// addPeerOptions holds the optional registration data provided by the connecting client
+type addPeerOptions struct {
+	// idempotencyKey makes the registration safe to retry. When a previous registration with the same key and
+	// credentials succeeded within peerRegistrationTTL, the originally registered peer is returned instead.
+	idempotencyKey string
+	// attestation is the platform attestation passed to the attestation verifier
+	attestation []byte
+	// requestedGroups are the IDs of the groups the peer is added to in addition to the auto groups. A setup key has
+	// to list them in its requestable groups, a registering user has to be allowed to update groups
+	requestedGroups []string
+}
+
+// addPeer registers a new peer
+func (am *DefaultAccountManager) addPeer(ctx context.Context, accountID, setupKey, userID string, peer *nbpeer.Peer, temporary bool, opts addPeerOptions) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, error) {
+	if setupKey == "" && userID == "" {
+		// no auth method provided => reject access
+		return nil, nil, nil, status.Errorf(status.Unauthenticated, "no peer auth method provided, please use a setup key or interactive SSO login")
+	}
+
+	if err := validateWireGuardPubKey(peer.Key); err != nil {
+		return nil, nil, nil, err
+	}
+
+	encodedHashedKey := types.HashSetupKey(setupKey)
+	addedByUser := len(userID) > 0
+
+	registrationKey := idempotencyCacheKey(opts.idempotencyKey, encodedHashedKey, userID)
+	if reg, ok := am.peerRegistrations.get(registrationKey); ok {
+		if reg.peerKey != peer.Key {
+			return nil, nil, nil, status.Errorf(status.PreconditionFailed, "idempotency key has already been used to register a different peer")
+		}
+
+		registeredPeer, err := am.Store.GetPeerByID(ctx, store.LockingStrengthNone, reg.accountID, reg.peerID)
+		if err == nil {
+			log.WithContext(ctx).Debugf("peer %s registration replayed with idempotency key", registeredPeer.ID)
+			p, nmap, pc, _, err := am.networkMapController.GetValidatedPeerWithMap(ctx, false, reg.accountID, registeredPeer)
+			return p, nmap, pc, err
+		}
+		// the peer has been deleted in the meantime, proceed with a regular registration
+	}
+
+	// This is a handling for the case when the same machine (with the same WireGuard pub key) tries to register twice.
+	// Such case is possible when AddPeer function takes long time to finish after AcquireWriteLockByUID (e.g., database is slow)
+	// and the peer disconnects with a timeout and tries to register again.
+	// We just check if this machine has been registered before and reject the second registration.
+	// The connecting peer should be able to recover with a retry.
+	_, err := am.Store.GetPeerByPeerPubKey(ctx, store.LockingStrengthNone, peer.Key)
+	if err == nil {
+		return nil, nil, nil, status.Errorf(status.PreconditionFailed, "peer has been already registered")
+	}
+
+	opEvent := &activity.Event{
+		Timestamp: time.Now().UTC(),
+	}
+
+	var newPeer *nbpeer.Peer
+
+	var setupKeyID string
+	var setupKeyName string
+	var ephemeral bool
+	var groupsToAdd []string
+	var userAutoGroups []string
+	var allowExtraDNSLabels bool
+	var requiresApproval bool
+	var allowOutdatedOSVersion bool
+	var managedBySetupKeyOnly bool
+	var ownerEmail string
+	var peerSetupKey *types.SetupKey
+	if addedByUser {
+		user, err := am.Store.GetUserByUserID(ctx, store.LockingStrengthNone, userID)
+		if err != nil {
+			return nil, nil, nil, status.Errorf(status.NotFound, "failed adding new peer: user not found")
+		}
+		if user.PendingApproval {
+			return nil, nil, nil, status.Errorf(status.PermissionDenied, "user pending approval cannot add peers")
+		}
+		if temporary {
+			allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Create)
+			if err != nil {
+				return nil, nil, nil, status.NewPermissionValidationError(err)
+			}
+
+			if !allowed {
+				return nil, nil, nil, status.NewPermissionDeniedError()
+			}
+		} else {
+			accountID = user.AccountID
+			groupsToAdd = user.AutoGroups
+			userAutoGroups = user.AutoGroups
+		}
+		opEvent.InitiatorID = userID
+		opEvent.Activity = activity.PeerAddedByUser
+		ownerEmail = am.getPeerOwnerEmail(ctx, accountID, user)
+	} else {
+		// Validate the setup key
+		sk, err := am.Store.GetSetupKeyBySecret(ctx, store.LockingStrengthNone, encodedHashedKey)
+		if err != nil {
+			return nil, nil, nil, status.Errorf(status.NotFound, "couldn't add peer: setup key is invalid")
+		}
+
+		// we will check key twice for early return
+		if !sk.IsValid() {
+			return nil, nil, nil, status.Errorf(status.NotFound, "couldn't add peer: setup key is invalid")
+		}
+
+		opEvent.InitiatorID = sk.Id
+		opEvent.Activity = activity.PeerAddedWithSetupKey
+		groupsToAdd = sk.AutoGroups
+		ephemeral = sk.Ephemeral
+		setupKeyID = sk.Id
+		setupKeyName = sk.Name
+		allowExtraDNSLabels = sk.AllowExtraDNSLabels
+		requiresApproval = sk.RequiresApproval
+		allowOutdatedOSVersion = sk.AllowOutdatedOSVersion
+		managedBySetupKeyOnly = sk.ManagedPeers
+		peerSetupKey = sk
+		accountID = sk.AccountID
+		if !sk.AllowExtraDNSLabels && len(peer.ExtraDNSLabels) > 0 {
+			return nil, nil, nil, status.Errorf(status.PreconditionFailed, "couldn't add peer: setup key doesn't allow extra DNS labels")
+		}
+	}
+	opEvent.AccountID = accountID
+	// the account of a registering peer is only known from here on, so the following logs can be correlated with it
+	//nolint
+	ctx = context.WithValue(ctx, nbcontext.AccountIDKey, accountID)
+
+	release, err := am.peerAdmission.acquire(ctx, accountID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer release()
+
+	if temporary {
+		ephemeral = true
+	}
+
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get account settings: %w", err)
+	}
+
+	if settings.RegistrationFrozen {
+		return nil, nil, nil, status.Errorf(status.PreconditionFailed, "couldn't add peer: the registration of new peers is frozen in the account")
+	}
+
+	if settings.PeerRegistrationOSVersionCheck != nil && !allowOutdatedOSVersion {
+		if err := peerRegistrationOSVersionError(ctx, settings.PeerRegistrationOSVersionCheck, peer); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if err := validatePeerExtraDNSLabels(settings, peer.ExtraDNSLabels); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(opts.requestedGroups) > 0 {
+		if addedByUser {
+			allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Groups, operations.Update)
+			if err != nil {
+				return nil, nil, nil, status.NewPermissionValidationError(err)
+			}
+			if !allowed {
+				return nil, nil, nil, status.Errorf(status.PermissionDenied, "couldn't add peer: user is not allowed to assign groups")
+			}
+		} else {
+			for _, groupID := range opts.requestedGroups {
+				if !slices.Contains(peerSetupKey.RequestableGroups, groupID) && !slices.Contains(peerSetupKey.AutoGroups, groupID) {
+					return nil, nil, nil, status.Errorf(status.PermissionDenied, "couldn't add peer: setup key doesn't allow requesting group %s", groupID)
+				}
+			}
+		}
+
+		if err := validatePeerRequestedGroups(ctx, am.Store, accountID, opts.requestedGroups); err != nil {
+			return nil, nil, nil, err
+		}
+
+		groupsToAdd = mergeGroupIDs(groupsToAdd, opts.requestedGroups)
+	}
+
+	var attestationResult *nbpeer.Attestation
+	if am.attestationVerifier != nil {
+		attestationResult, err = am.attestationVerifier.Verify(ctx, accountID, peer.Meta, opts.attestation)
+		if err != nil {
+			log.WithContext(ctx).Warnf("peer %s attestation verification failed: %v", peer.Key, err)
+			return nil, nil, nil, status.Errorf(status.PermissionDenied, "couldn't add peer: attestation verification failed")
+		}
+	}
+
+	if !addedByUser {
+		// the checks above may take a while, so re-validate the key before doing the expensive IdP, geo and validator work
+		sk, err := am.Store.GetSetupKeyBySecret(ctx, store.LockingStrengthNone, encodedHashedKey)
+		if err != nil {
+			return nil, nil, nil, status.Errorf(status.NotFound, "couldn't add peer: setup key is invalid")
+		}
+		if err := setupKeyRegistrationError(sk); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if !temporary {
+		claimed, err := am.claimImportedPeer(ctx, accountID, encodedHashedKey, setupKeyID, userID, peer)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to claim imported peer: %w", err)
+		}
+		if claimed != nil {
+			meta := claimed.EventMeta(am.networkMapController.GetDNSDomain(settings))
+			if !addedByUser {
+				meta["setup_key_name"] = setupKeyName
+			}
+			am.StoreEvent(ctx, opEvent.InitiatorID, claimed.ID, accountID, activity.PeerImportClaimed, meta)
+			am.peerRegistrations.put(registrationKey, accountID, claimed.ID, claimed.Key)
+
+			if err := am.networkMapController.OnPeersUpdated(ctx, accountID, []string{claimed.ID}); err != nil {
+				log.WithContext(ctx).Errorf("failed to update network map cache for claimed peer %s: %v", claimed.ID, err)
+			}
+
+			p, nmap, pc, _, err := am.networkMapController.GetValidatedPeerWithMap(ctx, false, accountID, claimed)
+			return p, nmap, pc, err
+		}
+	}
+
+	if settings.PeerNamingTemplate == "" && (strings.ToLower(peer.Meta.Hostname) == "iphone" || strings.ToLower(peer.Meta.Hostname) == "ipad") && userID != "" {
+		if userdata := am.getIdPUserData(ctx, accountID, userID); userdata != nil && userdata.Email != "" {
+			peer.Meta.Hostname = fmt.Sprintf("%s-%s", peer.Meta.Hostname, strings.Split(userdata.Email, "@")[0])
+		}
+	}
+
+	peerName := am.getNewPeerName(ctx, settings.PeerNamingTemplate, accountID, userID, peer)
+
+	// temporary peers are removed once they disconnect, they never expire
+	var expiration types.PeerExpirationDefaults
+	if !temporary {
+		expiration = settings.GetNewPeerExpiration(addedByUser, peerSetupKey)
+	}
+
+	registrationTime := time.Now().UTC()
+	newPeer = &nbpeer.Peer{
+		ID:                          xid.New().String(),
+		AccountID:                   accountID,
+		Key:                         peer.Key,
+		Meta:                        peer.Meta,
+		Name:                        peerName,
+		UserID:                      userID,
+		SetupKeyID:                  setupKeyID,
+		OwnerEmail:                  ownerEmail,
+		Status:                      &nbpeer.PeerStatus{Connected: false, LastSeen: registrationTime},
+		SSHEnabled:                  false,
+		SSHKey:                      peer.SSHKey,
+		LastLogin:                   &registrationTime,
+		CreatedAt:                   registrationTime,
+		LoginExpirationEnabled:      expiration.LoginExpirationEnabled,
+		Ephemeral:                   ephemeral,
+		Location:                    peer.Location,
+		InactivityExpirationEnabled: expiration.InactivityExpirationEnabled,
+		ExtraDNSLabels:              peer.ExtraDNSLabels,
+		AllowExtraDNSLabels:         allowExtraDNSLabels,
+		ManagedBySetupKeyOnly:       managedBySetupKeyOnly,
+	}
+	if attestationResult != nil {
+		newPeer.Attestation = *attestationResult
+	}
+
+	if am.geo != nil && newPeer.Location.ConnectionIP != nil {
+		location, err := am.geo.Lookup(newPeer.Location.ConnectionIP)
+		if err != nil {
+			log.WithContext(ctx).Warnf("failed to get location for new peer realip: [%s]: %v", newPeer.Location.ConnectionIP.String(), err)
+		} else {
+			newPeer.Location.CountryCode = location.Country.ISOCode
+			newPeer.Location.CityName = location.City.Names.En
+			newPeer.Location.GeoNameID = location.City.GeonameID
+			newPeer.Location.SubdivisionCode = location.SubdivisionCode()
+		}
+	}
+
+	newPeer = am.integratedPeerValidator.PreparePeer(ctx, accountID, newPeer, groupsToAdd, settings.Extra, temporary)
+
+	// the setup key may require approval even when the integrated validator doesn't
+	if requiresApproval {
+		newPeer.Status.RequiresApproval = true
+		newPeer.Status.UpdatePendingApproval(true, registrationTime)
+	}
+
+	network, err := am.Store.GetAccountNetwork(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed getting network: %w", err)
+	}
+
+	maxAttempts := 10
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var freeIP net.IP
+		var freeLabel string
+		useIPLabel := ephemeral || attempt > 1
+		if !useIPLabel {
+			freeLabel, err = getPeerDNSLabel(settings, peerName)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to get free DNS label: %w", err)
+			}
+			useIPLabel, err = checkReservedDNSLabel(settings, freeLabel)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
+		err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+			// counted in the transaction, so that concurrent registrations can't exceed the limit
+			if err = checkPeerLimit(ctx, transaction, settings, accountID, ephemeral); err != nil {
+				return err
+			}
+
+			freeIP, err = am.allocatePeerIP(ctx, transaction, accountID, network.Net)
+			if err != nil {
+				return fmt.Errorf("failed to get free IP: %w", err)
+			}
+			if useIPLabel {
+				freeLabel, err = getPeerIPDNSLabel(ctx, transaction, settings, accountID, freeIP, peerName)
+				if err != nil {
+					return fmt.Errorf("failed to get free DNS label: %w", err)
+				}
+			}
+			newPeer.DNSLabel = freeLabel
+			newPeer.IP = freeIP
+
+			if len(opts.requestedGroups) > 0 {
+				if err = validatePeerRequestedGroups(ctx, transaction, accountID, opts.requestedGroups); err != nil {
+					return err
+				}
+			}
+
+			err = transaction.AddPeerToAccount(ctx, newPeer)
+			if err != nil {
+				return err
+			}
+
+			if len(groupsToAdd) > 0 {
+				for _, g := range groupsToAdd {
+					if slices.Contains(userAutoGroups, g) {
+						err = transaction.AddPeerToAutoGroup(ctx, newPeer.AccountID, newPeer.ID, g)
+					} else {
+						err = transaction.AddPeerToGroup(ctx, newPeer.AccountID, newPeer.ID, g)
+					}
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			err = transaction.AddPeerToAllGroup(ctx, accountID, newPeer.ID)
+			if err != nil {
+				return fmt.Errorf("failed adding peer to All group: %w", err)
+			}
+
+			if addedByUser {
+				err := transaction.SaveUserLastLogin(ctx, accountID, userID, newPeer.GetLastLogin())
+				if err != nil {
+					log.WithContext(ctx).Debugf("failed to update user last login: %v", err)
+				}
+			} else {
+				sk, err := transaction.GetSetupKeyBySecret(ctx, store.LockingStrengthUpdate, encodedHashedKey)
+				if err != nil {
+					return fmt.Errorf("failed to get setup key: %w", err)
+				}
+
+				// we validate at the end to not block the setup key for too long
+				if err := setupKeyRegistrationError(sk); err != nil {
+					return err
+				}
+
+				err = transaction.IncrementSetupKeyUsage(ctx, setupKeyID)
+				if err != nil {
+					return fmt.Errorf("failed to increment setup key usage: %w", err)
+				}
+			}
+
+			err = transaction.IncrementNetworkSerial(ctx, accountID)
+			if err != nil {
+				return fmt.Errorf("failed to increment network serial: %w", err)
+			}
+
+			if ephemeral {
+				// we should track ephemeral peers to be able to clean them if the peer doesn't sync and isn't marked as connected
+				am.networkMapController.TrackEphemeralPeer(ctx, newPeer)
+			}
+
+			log.WithContext(ctx).Debugf("Peer %s added to account %s", newPeer.ID, accountID)
+			return nil
+		})
+		if err == nil {
+			break
+		}
+
+		if isUniqueConstraintError(err) {
+			log.WithContext(ctx).WithFields(log.Fields{"dns_label": freeLabel, "ip": freeIP}).Tracef("Failed to add peer in attempt %d, retrying: %v", attempt, err)
+			continue
+		}
+
+		return nil, nil, nil, fmt.Errorf("failed to add peer to database: %w", err)
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to add peer to database after %d attempts: %w", maxAttempts, err)
+	}
+
+	if newPeer == nil {
+		return nil, nil, nil, fmt.Errorf("new peer is nil")
+	}
+
+	opEvent.TargetID = newPeer.ID
+	opEvent.Meta = newPeer.EventMeta(am.networkMapController.GetDNSDomain(settings))
+	if !addedByUser {
+		opEvent.Meta["setup_key_name"] = setupKeyName
+	}
+	if newPeer.Attestation.Verifier != "" {
+		opEvent.Meta["attestation_verifier"] = newPeer.Attestation.Verifier
+	}
+	if len(opts.requestedGroups) > 0 {
+		opEvent.Meta["requested_groups"] = opts.requestedGroups
+	}
+
+	am.StoreEvent(ctx, opEvent.InitiatorID, opEvent.TargetID, opEvent.AccountID, opEvent.Activity, opEvent.Meta)
+	am.notifyPeerWebhook(ctx, settings, webhook.EventPeerAdded, accountID, opEvent.InitiatorID, newPeer)
+	if !newPeer.Status.PendingApprovalSince.IsZero() {
+		am.onPeerApprovalChanged(ctx, settings, opEvent.InitiatorID, newPeer, true, peerApprovalTriggerRegistration)
+	}
+
+	am.peerRegistrations.put(registrationKey, accountID, newPeer.ID, newPeer.Key)
+
+	if err := am.networkMapController.OnPeersAdded(ctx, accountID, []string{newPeer.ID}); err != nil {
+		log.WithContext(ctx).Errorf("failed to update network map cache for peer %s: %v", newPeer.ID, err)
+	}
+
+	p, nmap, pc, _, err := am.networkMapController.GetValidatedPeerWithMap(ctx, requiresApproval, accountID, newPeer)
+	return p, nmap, pc, err
+}
+
+// validatePeerRequestedGroups checks that the groups requested by a registering peer exist in the account.
+// The All group can't be requested, every peer is part of it
+func validatePeerRequestedGroups(ctx context.Context, s store.Store, accountID string, groupIDs []string) error {
+	groups, err := s.GetGroupsByIDs(ctx, store.LockingStrengthNone, accountID, groupIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, groupID := range groupIDs {
+		group, ok := groups[groupID]
+		if !ok {
+			return status.Errorf(status.InvalidArgument, "couldn't add peer: requested group %s doesn't exist", groupID)
+		}
+		if group.IsGroupAll() {
+			return status.Errorf(status.InvalidArgument, "couldn't add peer: can't request the All group")
+		}
+	}
+
+	return nil
+}
+
+// mergeGroupIDs returns the group IDs of both lists without duplicates, keeping their order
+func mergeGroupIDs(groupIDs, additional []string) []string {
+	merged := make([]string, 0, len(groupIDs)+len(additional))
+	for _, groupID := range slices.Concat(groupIDs, additional) {
+		if !slices.Contains(merged, groupID) {
+			merged = append(merged, groupID)
+		}
+	}
+	return merged
+}
+
+// setupKeyRegistrationError returns an error if the setup key can't be used to register a peer.
+// A key revoked while the registration is in progress gets a distinct error, so the caller can tell it apart from
+// an expired or overused one.
+func setupKeyRegistrationError(sk *types.SetupKey) error {
+	if sk.IsRevoked() {
+		return status.NewSetupKeyRevokedError()
+	}
+	if !sk.IsValid() {
+		return status.Errorf(status.PreconditionFailed, "couldn't add peer: setup key is invalid")
+	}
+	return nil
+}
+
+// peerRegistrationOSVersionError returns a PreconditionFailed error when the OS version of a peer being registered
+// is below the minimum version the account requires for its platform or can't be compared against it
+func peerRegistrationOSVersionError(ctx context.Context, check *posture.OSVersionCheck, peer *nbpeer.Peer) error {
+	osVersion := peer.Meta.OSVersion
+	if peer.Meta.GoOS == "linux" || peer.Meta.GoOS == "windows" {
+		osVersion = peer.Meta.KernelVersion
+	}
+
+	allowed, err := check.CheckMinVersion(ctx, *peer)
+	if err != nil {
+		log.WithContext(ctx).Debugf("failed to check the OS version %s of peer %s: %v", osVersion, peer.Key, err)
+		return status.Errorf(status.PreconditionFailed, "couldn't add peer: %s version %q can't be checked against the minimum version required by the account", peer.Meta.GoOS, osVersion)
+	}
+	if !allowed {
+		return status.Errorf(status.PreconditionFailed, "couldn't add peer: %s version %s is below the minimum version required by the account", peer.Meta.GoOS, osVersion)
+	}
+	return nil
+}
+
+// getNewPeerName returns the name for a peer being registered. If the account has a peer naming template,
+// the name is rendered from it, falling back to the peer hostname when the template can't be rendered.
+func (am *DefaultAccountManager) getNewPeerName(ctx context.Context, template, accountID, userID string, peer *nbpeer.Peer) string {
+	if template == "" {
+		return peer.Meta.Hostname
+	}
+
+	vars := types.PeerNamingTemplateVars{
+		Hostname: peer.Meta.Hostname,
+		OS:       peer.Meta.GoOS,
+	}
+	if userID != "" && strings.Contains(template, "{user}") {
+		vars.User = strings.Split(am.getUserEmail(ctx, accountID, userID), "@")[0]
+	}
+
+	name, err := types.RenderPeerNamingTemplate(template, vars)
+	if err != nil {
+		log.WithContext(ctx).Warnf("failed to render peer naming template for account %s, using hostname: %v", accountID, err)
+		return peer.Meta.Hostname
+	}
+
+	return name
+}
+
+// getUserEmail returns the email of the user from the IdP, or from the store when the IdP is not available
+func (am *DefaultAccountManager) getUserEmail(ctx context.Context, accountID, userID string) string {
+	if userdata := am.getIdPUserData(ctx, accountID, userID); userdata != nil && userdata.Email != "" {
+		return userdata.Email
+	}
+
+	user, err := am.Store.GetUserByUserID(ctx, store.LockingStrengthNone, userID)
+	if err != nil {
+		return ""
+	}
+	return user.Email
+}
+
+// getIdPUserData returns the user data from the IdP for optional enrichment in the peer flows.
+// Returns nil when no IdP is configured or the lookup fails, so an unavailable IdP never blocks peer registration.
+func (am *DefaultAccountManager) getIdPUserData(ctx context.Context, accountID, userID string) *idp.UserData {
+	if isNil(am.idpManager) {
+		return nil
+	}
+
+	userdata, err := am.idpManager.GetUserDataByID(ctx, userID, idp.AppMetadata{WTAccountID: accountID})
+	if err != nil {
+		log.WithContext(ctx).Debugf("failed to get user %s data from the IdP, skipping enrichment: %v", userID, err)
+		return nil
+	}
+
+	return userdata
+}
+
+// RefreshPeerOwnerEmails resolves the emails of the account users in one batch and updates the owner email of the
+// peers where it changed. Returns the number of peers updated
+func (am *DefaultAccountManager) RefreshPeerOwnerEmails(ctx context.Context, accountID, userID string) (int, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Update)
+	if err != nil {
+		return 0, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return 0, status.NewPermissionDeniedError()
+	}
+
+	users, err := am.Store.GetAccountUsers(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return 0, err
+	}
+
+	userInfos, err := am.BuildUserInfosForAccount(ctx, accountID, userID, users)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve account users: %w", err)
+	}
+
+	peers, err := am.Store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, peer := range peers {
+		userInfo, ok := userInfos[peer.UserID]
+		if !ok || userInfo.IsServiceUser || userInfo.Email == "" || userInfo.Email == peer.OwnerEmail {
+			continue
+		}
+
+		if err = am.Store.SavePeerOwnerEmail(ctx, accountID, peer.ID, userInfo.Email); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, nil
+}
+
+// getPeerOwnerEmail returns the email of the user owning a peer, or empty when it can't be resolved
+func (am *DefaultAccountManager) getPeerOwnerEmail(ctx context.Context, accountID string, user *types.User) string {
+	if user.IsServiceUser {
+		return ""
+	}
+
+	userInfo, err := am.getUserInfo(ctx, user, accountID)
+	if err != nil || userInfo == nil {
+		log.WithContext(ctx).Debugf("failed to resolve the email of user %s for its peers: %v", user.Id, err)
+		return ""
+	}
+
+	return userInfo.Email
+}
+
+// getPeerDNSLabel returns the DNS label of the peer host name, truncated to the account max label length
+func getPeerDNSLabel(settings *types.Settings, peerHostName string) (string, error) {
+	dnsName, err := nbdns.GetParsedDomainLabel(peerHostName)
+	if err != nil {
+		return "", err
+	}
+
+	return types.TruncatePeerDNSLabel(dnsName, settings.GetPeerDNSLabelMaxLength()), nil
+}
+
+// checkReservedDNSLabel returns true if the label is reserved in the account and the peer has to get a label built
+// with the suffix strategy instead, as for a taken label. It fails when the account rejects the reserved labels
+func checkReservedDNSLabel(settings *types.Settings, label string) (bool, error) {
+	if !settings.IsReservedDNSLabel(label) {
+		return false, nil
+	}
+
+	if settings.GetReservedDNSLabelAction() == types.ReservedDNSLabelActionReject {
+		return false, status.Errorf(status.InvalidArgument, "DNS label %s is reserved in the account", label)
+	}
+
+	return true, nil
+}
+
+// validateWireGuardPubKey checks that the key is a base64 encoded 32 bytes Curve25519 public key, so that malformed
+// keys are rejected before they are stored or looked up. The all-zero key is rejected as well
+func validateWireGuardPubKey(key string) error {
+	parsed, err := wgtypes.ParseKey(key)
+	if err != nil {
+		return status.Errorf(status.InvalidArgument, "invalid WireGuard public key: %v", err)
+	}
+	if parsed == (wgtypes.Key{}) {
+		return status.Errorf(status.InvalidArgument, "invalid WireGuard public key: the all-zero key is not allowed")
+	}
+	return nil
+}
+
+// validatePeerExtraDNSLabels checks the format of the extra DNS labels and that the peer doesn't claim more of them
+// than the account allows, keeping the custom DNS zone bounded
+func validatePeerExtraDNSLabels(settings *types.Settings, labels []string) error {
+	if err := domain.ValidateDomainsList(labels); err != nil {
+		return status.Errorf(status.InvalidArgument, "invalid extra DNS labels: %v", err)
+	}
+
+	if limit := settings.GetPeerExtraDNSLabelsLimit(); len(labels) > limit {
+		return status.Errorf(status.InvalidArgument, "too many extra DNS labels: %d, the account allows at most %d", len(labels), limit)
+	}
+
+	return nil
+}
+
+// getPeerIPDNSLabel returns a DNS label made of the peer host name and a suffix built with the account suffix strategy
+func getPeerIPDNSLabel(ctx context.Context, transaction store.Store, settings *types.Settings, accountID string, ip net.IP, peerHostName string) (string, error) {
+	dnsName, err := nbdns.GetParsedDomainLabel(peerHostName)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse peer host name %s: %w", peerHostName, err)
+	}
+
+	return types.BuildPeerDNSLabel(dnsName, ip, settings.PeerDNSLabelSuffix, settings.GetPeerDNSLabelMaxLength(), func(prefix string) ([]string, error) {
+		return transaction.GetPeerLabelsInAccount(ctx, store.LockingStrengthNone, accountID, prefix)
+	})
+}
+
+// SyncPeer checks whether peer is eligible for receiving NetworkMap (authenticated) and returns its NetworkMap if eligible
+func (am *DefaultAccountManager) SyncPeer(ctx context.Context, sync types.PeerSync, accountID string) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, int64, error) {
+	var peer *nbpeer.Peer
+	var updated, versionChanged bool
+	var err error
+	var postureChecks []*posture.Checks
+	var peerGroupIDs []string
+	var peerNotValid, isStatusChanged, approvalChanged, quarantined bool
+
+	if err = validateWireGuardPubKey(sync.WireGuardPubKey); err != nil {
+		return nil, nil, nil, 0, err
+	}
+
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		peer, err = transaction.GetPeerByPeerPubKey(ctx, store.LockingStrengthUpdate, sync.WireGuardPubKey)
+		if err != nil {
+			return status.NewPeerNotRegisteredError()
+		}
+
+		if peer.UserID != "" {
+			user, err := transaction.GetUserByUserID(ctx, store.LockingStrengthNone, peer.UserID)
+			if err != nil {
+				return err
+			}
+
+			quarantined, err = handleBlockedPeerOwner(peer, user, settings)
+			if err != nil {
+				return err
+			}
+		}
+
+		expired, err := peerLoginExpired(ctx, transaction, peer, settings)
+		if err != nil {
+			return err
+		}
+		if expired {
+			return status.NewPeerLoginExpiredError()
+		}
+
+		peerGroupIDs, err = getPeerGroupIDs(ctx, transaction, accountID, peer.ID)
+		if err != nil {
+			return err
+		}
+
+		var insignificant bool
+		updated, versionChanged, insignificant = peer.UpdateMetaIfNew(sync.Meta, settings.SignificantPeerMetaFields)
+		if updated || insignificant {
+			am.metrics.AccountManagerMetrics().CountPeerMetUpdate()
+			log.WithContext(ctx).Tracef("peer %s metadata updated", peer.ID)
+			if err = transaction.SavePeerMeta(ctx, accountID, peer.ID, peer.Meta); err != nil {
+				return err
+			}
+		}
+		if updated {
+			postureChecks, err = getPeerPostureChecks(ctx, transaction, accountID, peer.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		peerNotValid, isStatusChanged, approvalChanged, err = am.validatePeerApproval(ctx, transaction, peer, peerGroupIDs, settings)
+		return err
+	})
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+
+	if approvalChanged {
+		am.onPeerApprovalChanged(ctx, settings, activity.SystemInitiator, peer, peerNotValid, peerApprovalTriggerSync)
+	}
+
+	if isStatusChanged || sync.UpdateAccountPeers || (updated && (len(postureChecks) > 0 || versionChanged)) {
+		err = am.networkMapController.OnPeersUpdated(ctx, accountID, []string{peer.ID})
+		if err != nil {
+			return nil, nil, nil, 0, fmt.Errorf("notify network map controller of peer update: %w", err)
+		}
+	}
+
+	return am.networkMapController.GetValidatedPeerWithMap(ctx, peerNotValid || quarantined, accountID, peer)
+}
+
+func (am *DefaultAccountManager) handlePeerLoginNotFound(ctx context.Context, login types.PeerLogin, err error) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, error) {
+	if errStatus, ok := status.FromError(err); ok && errStatus.Type() == status.NotFound {
+		// we couldn't find this peer by its public key which can mean that peer hasn't been registered yet.
+		// Try registering it.
+		newPeer := &nbpeer.Peer{
+			Key:            login.WireGuardPubKey,
+			Meta:           login.Meta,
+			SSHKey:         login.SSHKey,
+			Location:       nbpeer.Location{ConnectionIP: login.ConnectionIP},
+			ExtraDNSLabels: login.ExtraDNSLabels,
+		}
+
+		return am.addPeer(ctx, "", login.SetupKey, login.UserID, newPeer, false, addPeerOptions{
+			idempotencyKey:  login.IdempotencyKey,
+			attestation:     login.Attestation,
+			requestedGroups: login.RequestedGroups,
+		})
+	}
+
+	log.WithContext(ctx).Errorf("failed while logging in peer %s: %v", login.WireGuardPubKey, err)
+	return nil, nil, nil, status.Errorf(status.Internal, "failed while logging in peer")
+}
+
+// LoginPeer logs in or registers a peer.
+// If peer doesn't exist the function checks whether a setup key or a user is present and registers a new peer if so.
+func (am *DefaultAccountManager) LoginPeer(ctx context.Context, login types.PeerLogin) (*nbpeer.Peer, *types.NetworkMap, []*posture.Checks, error) {
+	if err := validateWireGuardPubKey(login.WireGuardPubKey); err != nil {
+		return nil, nil, nil, err
+	}
+
+	accountID, err := am.Store.GetAccountIDByPeerPubKey(ctx, login.WireGuardPubKey)
+	if err != nil {
+		return am.handlePeerLoginNotFound(ctx, login, err)
+	}
+
+	// when the client sends a login request with a JWT which is used to get the user ID,
+	// it means that the client has already checked if it needs login and had been through the SSO flow
+	// so, we can skip this check and directly proceed with the login
+	if login.UserID == "" {
+		err = am.checkIFPeerNeedsLoginWithoutLock(ctx, accountID, login)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	var peer *nbpeer.Peer
+	var updateRemotePeers bool
+	var isPeerUpdated bool
+	var postureChecks []*posture.Checks
+	var peerGroupIDs []string
+	var isRequiresApproval, isStatusChanged, approvalChanged, quarantined bool
+
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// the owner email is resolved before the transaction as it may require an IdP lookup
+	var ownerEmail string
+	if login.UserID != "" {
+		if user, err := am.Store.GetUserByUserID(ctx, store.LockingStrengthNone, login.UserID); err == nil {
+			ownerEmail = am.getPeerOwnerEmail(ctx, accountID, user)
+		}
+	}
+
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		peer, err = transaction.GetPeerByPeerPubKey(ctx, store.LockingStrengthUpdate, login.WireGuardPubKey)
+		if err != nil {
+			return err
+		}
+
+		// this flag prevents unnecessary calls to the persistent store.
+		shouldStorePeer := false
+
+		if login.UserID != "" {
+			if peer.UserID != login.UserID {
+				log.Warnf("user mismatch when logging in peer %s: peer user %s, login user %s ", peer.ID, peer.UserID, login.UserID)
+				return status.NewPeerLoginMismatchError()
+			}
+
+			if ownerEmail != "" && peer.OwnerEmail != ownerEmail {
+				peer.OwnerEmail = ownerEmail
+				shouldStorePeer = true
+			}
+
+			var changed bool
+			changed, quarantined, err = am.handleUserPeer(ctx, transaction, peer, settings)
+			if err != nil {
+				return err
+			}
+
+			if changed {
+				shouldStorePeer = true
+				updateRemotePeers = true
+			}
+		}
+
+		peerGroupIDs, err = getPeerGroupIDs(ctx, transaction, accountID, peer.ID)
+		if err != nil {
+			return err
+		}
+
+		var insignificantMetaUpdate bool
+		isPeerUpdated, _, insignificantMetaUpdate = peer.UpdateMetaIfNew(login.Meta, settings.SignificantPeerMetaFields)
+		if insignificantMetaUpdate {
+			am.metrics.AccountManagerMetrics().CountPeerMetUpdate()
+			shouldStorePeer = true
+		}
+		if isPeerUpdated {
+			am.metrics.AccountManagerMetrics().CountPeerMetUpdate()
+			shouldStorePeer = true
+
+			postureChecks, err = getPeerPostureChecks(ctx, transaction, accountID, peer.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		if peer.SSHKey != login.SSHKey {
+			peer.SSHKey = login.SSHKey
+			shouldStorePeer = true
+			updateRemotePeers = true
+		}
+
+		if !peer.AllowExtraDNSLabels && len(login.ExtraDNSLabels) > 0 {
+			return status.Errorf(status.PreconditionFailed, "couldn't login peer: setup key doesn't allow extra DNS labels")
+		}
+
+		if shouldStorePeer {
+			if err = transaction.SavePeer(ctx, accountID, peer); err != nil {
+				return err
+			}
+		}
+
+		isRequiresApproval, isStatusChanged, approvalChanged, err = am.validatePeerApproval(ctx, transaction, peer, peerGroupIDs, settings)
+		return err
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if approvalChanged {
+		initiatorID := activity.SystemInitiator
+		if login.UserID != "" {
+			initiatorID = login.UserID
+		}
+		am.onPeerApprovalChanged(ctx, settings, initiatorID, peer, isRequiresApproval, peerApprovalTriggerLogin)
+	}
+
+	if updateRemotePeers || isStatusChanged || (isPeerUpdated && len(postureChecks) > 0) {
+		err = am.networkMapController.OnPeersUpdated(ctx, accountID, []string{peer.ID})
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("notify network map controller of peer update: %w", err)
+		}
+	}
+
+	p, nmap, pc, _, err := am.networkMapController.GetValidatedPeerWithMap(ctx, isRequiresApproval || quarantined, accountID, peer)
+	return p, nmap, pc, err
+}
+
+// validatePeerApproval checks whether the peer requires approval and stamps the time it started requiring it,
+// or clears it once the peer is approved. Returns whether the peer is not valid, whether its status changed and
+// whether the peer moved into or out of the pending approval state
+func (am *DefaultAccountManager) validatePeerApproval(ctx context.Context, transaction store.Store, peer *nbpeer.Peer, peerGroupIDs []string, settings *types.Settings) (bool, bool, bool, error) {
+	notValid, statusChanged, err := am.integratedPeerValidator.IsNotValidPeer(ctx, peer.AccountID, peer, peerGroupIDs, settings.Extra)
+	if err != nil {
+		return false, false, false, err
+	}
+	// peers registered with a setup key that requires approval stay pending until approved, whatever the validator says
+	notValid = notValid || peer.Status.RequiresApproval
+
+	approvalChanged := peer.Status.UpdatePendingApproval(notValid, time.Now().UTC())
+	if approvalChanged {
+		if err = transaction.SavePeerPendingApprovalSince(ctx, peer.AccountID, peer.ID, peer.Status.PendingApprovalSince); err != nil {
+			return false, false, false, err
+		}
+	}
+
+	return notValid, statusChanged, approvalChanged, nil
+}
+
+// onPeerApprovalChanged records the transition of the peer into or out of the pending approval state together with
+// what triggered it, and notifies the account webhook
+func (am *DefaultAccountManager) onPeerApprovalChanged(ctx context.Context, settings *types.Settings, initiatorID string, peer *nbpeer.Peer, pending bool, trigger string) {
+	event, webhookEvent := activity.PeerApproved, webhook.EventPeerApproved
+	if pending {
+		event, webhookEvent = activity.PeerPendingApproval, webhook.EventPeerPendingApproval
+	}
+
+	meta := peer.EventMeta(am.networkMapController.GetDNSDomain(settings))
+	meta["trigger"] = trigger
+	meta["hostname"] = peer.Meta.Hostname
+	meta["os"] = peer.Meta.GoOS
+	meta["os_version"] = peer.Meta.OSVersion
+	meta["version"] = peer.Meta.WtVersion
+
+	am.StoreEvent(ctx, initiatorID, peer.ID, peer.AccountID, event, meta)
+	am.notifyPeerWebhook(ctx, settings, webhookEvent, peer.AccountID, initiatorID, peer)
+}
+
+// getPeerPostureChecks returns the posture checks for the peer.
+func getPeerPostureChecks(ctx context.Context, transaction store.Store, accountID, peerID string) ([]*posture.Checks, error) {
+	policies, err := transaction.GetAccountPolicies(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	var peerPostureChecksIDs []string
+
+	for _, policy := range policies {
+		if !policy.Enabled || len(policy.SourcePostureChecks) == 0 {
+			continue
+		}
+
+		postureChecksIDs, err := processPeerPostureChecks(ctx, transaction, policy, accountID, peerID)
+		if err != nil {
+			return nil, err
+		}
+
+		peerPostureChecksIDs = append(peerPostureChecksIDs, postureChecksIDs...)
+	}
+
+	peerPostureChecks, err := transaction.GetPostureChecksByIDs(ctx, store.LockingStrengthNone, accountID, peerPostureChecksIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return maps.Values(peerPostureChecks), nil
+}
+
+// processPeerPostureChecks checks if the peer is in the source group of the policy and returns the posture checks.
+func processPeerPostureChecks(ctx context.Context, transaction store.Store, policy *types.Policy, accountID, peerID string) ([]string, error) {
+	rule, err := getPeerPolicySourceRule(ctx, transaction, policy, accountID, peerID)
+	if err != nil || rule == nil {
+		return nil, err
+	}
+	return policy.SourcePostureChecks, nil
+}
+
+// getPeerPolicySourceRule returns the first enabled rule of the policy with the peer in one of its source groups,
+// or nil if the peer isn't a source of the policy
+func getPeerPolicySourceRule(ctx context.Context, transaction store.Store, policy *types.Policy, accountID, peerID string) (*types.PolicyRule, error) {
+	for _, rule := range policy.Rules {
+		if !rule.Enabled {
+			continue
+		}
+
+		sourceGroups, err := transaction.GetGroupsByIDs(ctx, store.LockingStrengthNone, accountID, rule.Sources)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sourceGroup := range rule.Sources {
+			group, ok := sourceGroups[sourceGroup]
+			if !ok {
+				return nil, fmt.Errorf("failed to check peer in policy source group")
+			}
+
+			if slices.Contains(group.Peers, peerID) {
+				return rule, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// checkIFPeerNeedsLoginWithoutLock checks if the peer needs login without acquiring the account lock. The check validate if the peer was not added via SSO
+// and if the peer login is expired.
+// The NetBird client doesn't have a way to check if the peer needs login besides sending a login request
+// with no JWT token and usually no setup-key. As the client can send up to two login request to check if it is expired
+// and before starting the engine, we do the checks without an account lock to avoid piling up requests.
+func (am *DefaultAccountManager) checkIFPeerNeedsLoginWithoutLock(ctx context.Context, accountID string, login types.PeerLogin) error {
+	peer, err := am.Store.GetPeerByPeerPubKey(ctx, store.LockingStrengthNone, login.WireGuardPubKey)
+	if err != nil {
+		return err
+	}
+
+	// if the peer was not added with SSO login we can exit early because peers activated with setup-key
+	// doesn't expire, and we avoid extra databases calls.
+	if !peer.AddedWithSSOLogin() {
+		return nil
+	}
+
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return err
+	}
+
+	expired, err := peerLoginExpired(ctx, am.Store, peer, settings)
+	if err != nil {
+		return err
+	}
+	if expired {
+		return status.NewPeerLoginExpiredError()
+	}
+
+	return nil
+}
+
+func (am *DefaultAccountManager) handleExpiredPeer(ctx context.Context, transaction store.Store, user *types.User, peer *nbpeer.Peer) error {
+	err := checkAuth(ctx, user.Id, peer)
+	if err != nil {
+		return err
+	}
+	// If peer was expired before and if it reached this point, it is re-authenticated.
+	// UserID is present, meaning that JWT validation passed successfully in the API layer.
+	peer = peer.UpdateLastLogin()
+	err = transaction.SavePeer(ctx, peer.AccountID, peer)
+	if err != nil {
+		return err
+	}
+
+	err = transaction.SaveUserLastLogin(ctx, user.AccountID, user.Id, peer.GetLastLogin())
+	if err != nil {
+		log.WithContext(ctx).Debugf("failed to update user last login: %v", err)
+	}
+
+	settings, err := transaction.GetAccountSettings(ctx, store.LockingStrengthNone, peer.AccountID)
+	if err != nil {
+		return fmt.Errorf("failed to get account settings: %w", err)
+	}
+
+	am.StoreEvent(ctx, user.Id, peer.ID, user.AccountID, activity.UserLoggedInPeer, peer.EventMeta(am.networkMapController.GetDNSDomain(settings)))
+	return nil
+}
+
+func checkIfPeerOwnerIsBlocked(peer *nbpeer.Peer, user *types.User) error {
+	if peer.AddedWithSSOLogin() {
+		if user.IsBlocked() {
+			return status.Errorf(status.PermissionDenied, "user is blocked")
+		}
+	}
+	return nil
+}
+
+// handleBlockedPeerOwner applies the blocked peer owner behavior of the account to a peer that syncs or logs in.
+// It returns whether the peer is quarantined and has to receive an empty network map.
+func handleBlockedPeerOwner(peer *nbpeer.Peer, user *types.User, settings *types.Settings) (bool, error) {
+	err := checkIfPeerOwnerIsBlocked(peer, user)
+	if err == nil {
+		return false, nil
+	}
+
+	switch settings.GetBlockedPeerOwnerBehavior() {
+	case types.BlockedPeerOwnerQuarantine:
+		return true, nil
+	case types.BlockedPeerOwnerAllowUntilExpiry:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func checkAuth(ctx context.Context, loginUserID string, peer *nbpeer.Peer) error {
+	if loginUserID == "" {
+		// absence of a user ID indicates that JWT wasn't provided.
+		return status.NewPeerLoginExpiredError()
+	}
+	if peer.UserID != loginUserID {
+		log.WithContext(ctx).Warnf("user mismatch when logging in peer %s: peer user %s, login user %s ", peer.ID, peer.UserID, loginUserID)
+		return status.NewPeerLoginMismatchError()
+	}
+	return nil
+}
+
+// peerLoginExpired checks whether the peer login has expired. The expiration of the account settings applies unless
+// the peer is a member of groups overriding it with a shorter one, in which case the shortest group expiration applies.
+func peerLoginExpired(ctx context.Context, transaction store.Store, peer *nbpeer.Peer, settings *types.Settings) (bool, error) {
+	if peer.Status.LoginExpired {
+		log.WithContext(ctx).Debugf("peer's %s login is marked as expired", peer.ID)
+		return true, nil
+	}
+
+	// only peers added with SSO login can expire, avoid looking up the groups of the others
+	if !settings.PeerLoginExpirationEnabled || !peer.AddedWithSSOLogin() || !peer.LoginExpirationEnabled {
+		return false, nil
+	}
+
+	if expired, expiresIn := peer.LoginExpired(settings.PeerLoginExpiration, settings.GetPeerExpirationTolerance()); expired {
+		log.WithContext(ctx).Debugf("peer's %s login expired %v ago", peer.ID, expiresIn)
+		return true, nil
+	}
+
+	// group overrides only shorten the account expiration and are never shorter than MinGroupPeerLoginExpiration,
+	// so a more recent login can't have expired and the override lookup is skipped on most syncs
+	if expired, _ := peer.LoginExpired(types.MinGroupPeerLoginExpiration, settings.GetPeerExpirationTolerance()); !expired {
+		return false, nil
+	}
+
+	override, err := transaction.GetPeerLoginExpirationOverride(ctx, store.LockingStrengthNone, peer.AccountID, peer.ID)
+	if err != nil {
+		return false, err
+	}
+
+	expired, expiresIn := peer.LoginExpired(settings.ApplyPeerLoginExpirationOverride(override), settings.GetPeerExpirationTolerance())
+	if expired {
+		log.WithContext(ctx).Debugf("peer's %s login expired %v ago", peer.ID, expiresIn)
+		return true, nil
+	}
+	return false, nil
+}
+
+// minPeerKeyPrefixLength is the minimum length of a WireGuard public key prefix peers can be looked up by,
+// so that a lookup can't match every peer of the account
+const minPeerKeyPrefixLength = 6
+
+// CanAllocatePeers reports whether count more peers fit into the network of the account and returns the number of
+// IPs still available for peers, e.g. to check a mass onboarding before it fails halfway through with IP exhaustion
+func (am *DefaultAccountManager) CanAllocatePeers(ctx context.Context, accountID, userID string, count int) (bool, int, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return false, 0, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return false, 0, status.NewPermissionDeniedError()
+	}
+
+	if count < 0 {
+		return false, 0, status.Errorf(status.InvalidArgument, "peer count can't be negative")
+	}
+
+	network, err := am.Store.GetAccountNetwork(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return false, 0, err
+	}
+
+	takenIPs, err := am.Store.GetTakenIPs(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return false, 0, err
+	}
+
+	remaining := types.FreePeerIPs(network.Net, takenIPs)
+
+	return count <= remaining, remaining, nil
+}
+
+// GetPeersByPubKeyPrefix returns the peers of the account whose WireGuard public key starts with the given base64
+// prefix, e.g. a partial key taken from a log
+func (am *DefaultAccountManager) GetPeersByPubKeyPrefix(ctx context.Context, accountID, userID, prefix string) ([]*nbpeer.Peer, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	if len(prefix) < minPeerKeyPrefixLength {
+		return nil, status.Errorf(status.InvalidArgument, "public key prefix must be at least %d characters long", minPeerKeyPrefixLength)
+	}
+	if !isBase64Prefix(prefix) {
+		return nil, status.Errorf(status.InvalidArgument, "public key prefix must be base64 encoded")
+	}
+
+	return am.Store.GetPeersByKeyPrefix(ctx, store.LockingStrengthNone, accountID, prefix)
+}
+
+// isBase64Prefix reports whether the prefix only contains characters of the standard base64 alphabet WireGuard keys
+// are encoded with
+func isBase64Prefix(prefix string) bool {
+	for _, c := range prefix {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/' || c == '=') {
+			return false
+		}
+	}
+	return true
+}
+
+// GetPeer for a given accountID, peerID and userID error if not found.
+func (am *DefaultAccountManager) GetPeer(ctx context.Context, accountID, peerID, userID string) (*nbpeer.Peer, error) {
+	peer, allowed, err := am.getPeerWithReadPermission(ctx, accountID, peerID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if allowed {
+		return peer, nil
+	}
+
+	user, err := am.Store.GetUserByUserID(ctx, store.LockingStrengthNone, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// if admin or user owns this peer, return peer
+	if user.IsAdminOrServiceUser() || peer.UserID == userID {
+		return peer, nil
+	}
+
+	return am.checkIfUserOwnsPeer(ctx, accountID, userID, peer)
+}
+
+// GetPeerFast returns the peer for users allowed to read all the account peers. It goes through the same permission
+// check as GetPeer, but fails for other users instead of checking peer ownership and calling the integrated validator
+func (am *DefaultAccountManager) GetPeerFast(ctx context.Context, accountID, peerID, userID string) (*nbpeer.Peer, error) {
+	peer, allowed, err := am.getPeerWithReadPermission(ctx, accountID, peerID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	return peer, nil
+}
+
+// getPeerWithReadPermission returns the peer and whether the user is allowed to read all the account peers
+func (am *DefaultAccountManager) getPeerWithReadPermission(ctx context.Context, accountID, peerID, userID string) (*nbpeer.Peer, bool, error) {
+	peer, err := am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return nil, false, status.NewPermissionValidationError(err)
+	}
+
+	return peer, allowed, nil
+}
+
+// GetPeersByIDs returns the requested peers visible to the user keyed by peer ID, reading them in a single store query.
+// The IDs of peers that don't exist or that the user is not allowed to see are returned as the second value
+func (am *DefaultAccountManager) GetPeersByIDs(ctx context.Context, accountID, userID string, peerIDs []string) (map[string]*nbpeer.Peer, []string, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return nil, nil, status.NewPermissionValidationError(err)
+	}
 
-			postureChecks, err = getPeerPostureChecks(ctx, transaction, accountID, peer.ID)
+	peers := make(map[string]*nbpeer.Peer)
+	if len(peerIDs) > 0 {
+		filters := store.PeerFilters{IDs: peerIDs}
+		if !allowed {
+			filters, err = am.restrictPeerFiltersToUser(ctx, accountID, userID, filters)
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
 		}
 
-		if peer.SSHKey != login.SSHKey {
-			peer.SSHKey = login.SSHKey
-			shouldStorePeer = true
-			updateRemotePeers = true
+		visiblePeers, err := am.Store.GetFilteredAccountPeers(ctx, store.LockingStrengthNone, accountID, filters)
+		if err != nil {
+			return nil, nil, err
 		}
-
-		if !peer.AllowExtraDNSLabels && len(login.ExtraDNSLabels) > 0 {
-			return status.Errorf(status.PreconditionFailed, "couldn't login peer: setup key doesn't allow extra DNS labels")
+		for _, peer := range visiblePeers {
+			peers[peer.ID] = peer
 		}
+	}
 
-		if shouldStorePeer {
-			if err = transaction.SavePeer(ctx, accountID, peer); err != nil {
-				return err
-			}
+	missing := make([]string, 0)
+	for _, id := range peerIDs {
+		if _, ok := peers[id]; !ok && !slices.Contains(missing, id) {
+			missing = append(missing, id)
 		}
+	}
 
-		return nil
-	})
+	return peers, missing, nil
+}
+
+// getUserVisiblePeerIDs returns the IDs of the peers a user without the peers read permission can see: the user peers
+// and the peers they have access to. Whether the user can see all the account peers is decided by the peers read
+// permission only, so the user role isn't checked here
+func (am *DefaultAccountManager) getUserVisiblePeerIDs(ctx context.Context, accountID, userID string) (map[string]struct{}, error) {
+	user, err := am.Store.GetUserByUserID(ctx, store.LockingStrengthNone, userID)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 
-	isRequiresApproval, isStatusChanged, err := am.integratedPeerValidator.IsNotValidPeer(ctx, accountID, peer, peerGroupIDs, settings.Extra)
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, fmt.Errorf("failed to get account settings: %w", err)
 	}
 
-	if updateRemotePeers || isStatusChanged || (isPeerUpdated && len(postureChecks) > 0) {
-		err = am.networkMapController.OnPeersUpdated(ctx, accountID, []string{peer.ID})
-		if err != nil {
-			return nil, nil, nil, fmt.Errorf("notify network map controller of peer update: %w", err)
-		}
+	if user.IsRestrictable() && settings.RegularUsersViewBlocked {
+		return map[string]struct{}{}, nil
 	}
 
-	p, nmap, pc, _, err := am.networkMapController.GetValidatedPeerWithMap(ctx, isRequiresApproval, accountID, peer)
-	return p, nmap, pc, err
-}
-
-// getPeerPostureChecks returns the posture checks for the peer.
-func getPeerPostureChecks(ctx context.Context, transaction store.Store, accountID, peerID string) ([]*posture.Checks, error) {
-	policies, err := transaction.GetAccountPolicies(ctx, store.LockingStrengthNone, accountID)
+	userPeers, err := am.Store.GetUserPeers(ctx, store.LockingStrengthNone, accountID, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(policies) == 0 {
-		return nil, nil
+	peersMap := make(map[string]*nbpeer.Peer, len(userPeers))
+	for _, peer := range userPeers {
+		peersMap[peer.ID] = peer
 	}
 
-	var peerPostureChecksIDs []string
+	accessiblePeers, err := am.getUserAccessiblePeers(ctx, accountID, peersMap, userPeers)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, policy := range policies {
-		if !policy.Enabled || len(policy.SourcePostureChecks) == 0 {
-			continue
-		}
+	visiblePeers := make(map[string]struct{}, len(accessiblePeers))
+	for _, peer := range accessiblePeers {
+		visiblePeers[peer.ID] = struct{}{}
+	}
 
-		postureChecksIDs, err := processPeerPostureChecks(ctx, transaction, policy, accountID, peerID)
-		if err != nil {
-			return nil, err
-		}
+	return visiblePeers, nil
+}
 
-		peerPostureChecksIDs = append(peerPostureChecksIDs, postureChecksIDs...)
+// GetPeerFQDNs returns all the names the peer resolves to: its DNS label and its extra DNS labels under the account
+// DNS domain, as served by the account custom zone. Extra labels that don't form a valid domain are left out
+func (am *DefaultAccountManager) GetPeerFQDNs(ctx context.Context, accountID, userID, peerID string) ([]string, error) {
+	peer, err := am.GetPeer(ctx, accountID, peerID, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	peerPostureChecks, err := transaction.GetPostureChecksByIDs(ctx, store.LockingStrengthNone, accountID, peerPostureChecksIDs)
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
 	if err != nil {
 		return nil, err
 	}
 
-	return maps.Values(peerPostureChecks), nil
-}
+	dnsDomain := am.networkMapController.GetDNSDomain(settings)
+	fqdns := make([]string, 0, len(peer.ExtraDNSLabels)+1)
+	if dnsDomain == "" || peer.DNSLabel == "" {
+		return fqdns, nil
+	}
 
-// processPeerPostureChecks checks if the peer is in the source group of the policy and returns the posture checks.
-func processPeerPostureChecks(ctx context.Context, transaction store.Store, policy *types.Policy, accountID, peerID string) ([]string, error) {
-	for _, rule := range policy.Rules {
-		if !rule.Enabled {
+	fqdns = append(fqdns, peer.FQDN(dnsDomain))
+	for _, label := range peer.ExtraDNSLabels {
+		fqdn := label + "." + dnsDomain
+		if !domain.IsValidDomainNoWildcard(fqdn) {
+			log.WithContext(ctx).Debugf("skipping invalid extra DNS label %s of peer %s", label, peer.ID)
 			continue
 		}
-
-		sourceGroups, err := transaction.GetGroupsByIDs(ctx, store.LockingStrengthNone, accountID, rule.Sources)
-		if err != nil {
-			return nil, err
+		if !slices.Contains(fqdns, fqdn) {
+			fqdns = append(fqdns, fqdn)
 		}
+	}
 
-		for _, sourceGroup := range rule.Sources {
-			group, ok := sourceGroups[sourceGroup]
-			if !ok {
-				return nil, fmt.Errorf("failed to check peer in policy source group")
-			}
+	return fqdns, nil
+}
 
-			if slices.Contains(group.Peers, peerID) {
-				return policy.SourcePostureChecks, nil
-			}
-		}
+// DisconnectPeer closes the management update channel of the peer so it has to reconnect and authenticate again.
+// When markDisconnected is set, the peer is also marked as disconnected right away instead of waiting for its
+// stream to end. Unlike deleting the peer, the peer keeps its configuration and can connect again
+func (am *DefaultAccountManager) DisconnectPeer(ctx context.Context, accountID, peerID, userID string, markDisconnected bool) error {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Update)
+	if err != nil {
+		return status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return status.NewPermissionDeniedError()
 	}
-	return nil, nil
-}
 
-// checkIFPeerNeedsLoginWithoutLock checks if the peer needs login without acquiring the account lock. The check validate if the peer was not added via SSO
-// and if the peer login is expired.
-// The NetBird client doesn't have a way to check if the peer needs login besides sending a login request
-// with no JWT token and usually no setup-key. As the client can send up to two login request to check if it is expired
-// and before starting the engine, we do the checks without an account lock to avoid piling up requests.
-func (am *DefaultAccountManager) checkIFPeerNeedsLoginWithoutLock(ctx context.Context, accountID string, login types.PeerLogin) error {
-	peer, err := am.Store.GetPeerByPeerPubKey(ctx, store.LockingStrengthNone, login.WireGuardPubKey)
+	peer, err := am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID)
 	if err != nil {
 		return err
 	}
 
-	// if the peer was not added with SSO login we can exit early because peers activated with setup-key
-	// doesn't expire, and we avoid extra databases calls.
-	if !peer.AddedWithSSOLogin() {
-		return nil
+	am.networkMapController.DisconnectPeers(ctx, accountID, []string{peer.ID})
+
+	if markDisconnected {
+		if err = am.MarkPeerConnected(ctx, peer.Key, false, nil, 0, accountID); err != nil {
+			return fmt.Errorf("failed to mark peer %s as disconnected: %w", peer.ID, err)
+		}
 	}
 
 	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
@@ -1092,127 +3129,199 @@ func (am *DefaultAccountManager) checkIFPeerNeedsLoginWithoutLock(ctx context.Co
 		return err
 	}
 
-	if peerLoginExpired(ctx, peer, settings) {
-		return status.NewPeerLoginExpiredError()
-	}
+	am.StoreEvent(ctx, userID, peer.ID, accountID, activity.PeerDisconnectedByUser, peer.EventMeta(am.networkMapController.GetDNSDomain(settings)))
 
 	return nil
 }
 
-func (am *DefaultAccountManager) handleExpiredPeer(ctx context.Context, transaction store.Store, user *types.User, peer *nbpeer.Peer) error {
-	err := checkAuth(ctx, user.Id, peer)
-	if err != nil {
-		return err
-	}
-	// If peer was expired before and if it reached this point, it is re-authenticated.
-	// UserID is present, meaning that JWT validation passed successfully in the API layer.
-	peer = peer.UpdateLastLogin()
-	err = transaction.SavePeer(ctx, peer.AccountID, peer)
+func (am *DefaultAccountManager) checkIfUserOwnsPeer(ctx context.Context, accountID, userID string, peer *nbpeer.Peer) (*nbpeer.Peer, error) {
+	account, err := am.requestBuffer.GetAccountWithBackpressure(ctx, accountID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = transaction.SaveUserLastLogin(ctx, user.AccountID, user.Id, peer.GetLastLogin())
+	approvedPeersMap, err := am.integratedPeerValidator.GetValidatedPeers(ctx, accountID, maps.Values(account.Groups), maps.Values(account.Peers), account.Settings.Extra)
 	if err != nil {
-		log.WithContext(ctx).Debugf("failed to update user last login: %v", err)
+		return nil, err
 	}
+	account.RemovePeersPendingApproval(approvedPeersMap)
 
-	settings, err := transaction.GetAccountSettings(ctx, store.LockingStrengthNone, peer.AccountID)
+	// it is also possible that user doesn't own the peer but some of his peers have access to it,
+	// this is a valid case, show the peer as well.
+	userPeers, err := am.Store.GetUserPeers(ctx, store.LockingStrengthNone, accountID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to get account settings: %w", err)
+		return nil, err
 	}
 
-	am.StoreEvent(ctx, user.Id, peer.ID, user.AccountID, activity.UserLoggedInPeer, peer.EventMeta(am.networkMapController.GetDNSDomain(settings)))
-	return nil
-}
-
-func checkIfPeerOwnerIsBlocked(peer *nbpeer.Peer, user *types.User) error {
-	if peer.AddedWithSSOLogin() {
-		if user.IsBlocked() {
-			return status.Errorf(status.PermissionDenied, "user is blocked")
+	for _, p := range userPeers {
+		aclPeers, _, _, _ := account.GetPeerConnectionResources(ctx, p, approvedPeersMap, account.GetActiveGroupUsers())
+		for _, aclPeer := range aclPeers {
+			if aclPeer.ID == peer.ID {
+				return peer, nil
+			}
 		}
 	}
-	return nil
+
+	return nil, status.Errorf(status.Internal, "user %s has no access to peer %s under account %s", userID, peer.ID, accountID)
 }
 
-func checkAuth(ctx context.Context, loginUserID string, peer *nbpeer.Peer) error {
-	if loginUserID == "" {
-		// absence of a user ID indicates that JWT wasn't provided.
-		return status.NewPeerLoginExpiredError()
+// ForceAccountResync bumps the network serial of the account and pushes the network map to all its peers, so they
+// refetch their configuration, e.g. after the store was fixed manually
+func (am *DefaultAccountManager) ForceAccountResync(ctx context.Context, accountID, userID string) error {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Update)
+	if err != nil {
+		return status.NewPermissionValidationError(err)
 	}
-	if peer.UserID != loginUserID {
-		log.WithContext(ctx).Warnf("user mismatch when logging in peer %s: peer user %s, login user %s ", peer.ID, peer.UserID, loginUserID)
-		return status.NewPeerLoginMismatchError()
+	if !allowed {
+		return status.NewPermissionDeniedError()
 	}
-	return nil
-}
 
-func peerLoginExpired(ctx context.Context, peer *nbpeer.Peer, settings *types.Settings) bool {
-	expired, expiresIn := peer.LoginExpired(settings.PeerLoginExpiration)
-	expired = settings.PeerLoginExpirationEnabled && expired
-	if expired || peer.Status.LoginExpired {
-		log.WithContext(ctx).Debugf("peer's %s login expired %v ago", peer.ID, expiresIn)
-		return true
+	var network *types.Network
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		if err = transaction.IncrementNetworkSerial(ctx, accountID); err != nil {
+			return fmt.Errorf("failed to increment network serial: %w", err)
+		}
+
+		network, err = transaction.GetAccountNetwork(ctx, store.LockingStrengthNone, accountID)
+		return err
+	})
+	if err != nil {
+		return err
 	}
-	return false
+
+	am.StoreEvent(ctx, userID, accountID, accountID, activity.AccountResyncForced, map[string]any{"network_serial": network.CurrentSerial()})
+
+	am.UpdateAccountPeers(ctx, accountID)
+
+	return nil
 }
 
-// GetPeer for a given accountID, peerID and userID error if not found.
-func (am *DefaultAccountManager) GetPeer(ctx context.Context, accountID, peerID, userID string) (*nbpeer.Peer, error) {
-	peer, err := am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID)
+// RenewExpiredPeerLogins renews the login of every expired peer of the account whose owner is still valid, e.g. after
+// an identity provider outage expired many peers. Peers of removed or blocked users stay expired.
+// Returns the number of renewed peers
+func (am *DefaultAccountManager) RenewExpiredPeerLogins(ctx context.Context, accountID, userID string) (int, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Update)
 	if err != nil {
-		return nil, err
+		return 0, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return 0, status.NewPermissionDeniedError()
 	}
 
-	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	var renewedPeers []*nbpeer.Peer
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		peers, err := transaction.GetAccountPeers(ctx, store.LockingStrengthUpdate, accountID, "", "", nil)
+		if err != nil {
+			return err
+		}
+
+		users, err := transaction.GetAccountUsers(ctx, store.LockingStrengthNone, accountID)
+		if err != nil {
+			return err
+		}
+
+		owners := make(map[string]*types.User, len(users))
+		for _, user := range users {
+			owners[user.Id] = user
+		}
+
+		for _, peer := range peers {
+			if !peer.AddedWithSSOLogin() || !peer.Status.LoginExpired {
+				continue
+			}
+
+			owner, ok := owners[peer.UserID]
+			if !ok {
+				log.WithContext(ctx).Debugf("skipping login renewal of peer %s, its owner %s doesn't exist", peer.ID, peer.UserID)
+				continue
+			}
+			if err = checkIfPeerOwnerIsBlocked(peer, owner); err != nil {
+				log.WithContext(ctx).Debugf("skipping login renewal of peer %s: %v", peer.ID, err)
+				continue
+			}
+
+			peer.UpdateLastLogin()
+			if err = transaction.SavePeer(ctx, accountID, peer); err != nil {
+				return err
+			}
+			renewedPeers = append(renewedPeers, peer)
+		}
+
+		if len(renewedPeers) == 0 {
+			return nil
+		}
+
+		return transaction.IncrementNetworkSerial(ctx, accountID)
+	})
 	if err != nil {
-		return nil, status.NewPermissionValidationError(err)
+		return 0, err
 	}
-	if allowed {
-		return peer, nil
+
+	if len(renewedPeers) == 0 {
+		return 0, nil
 	}
 
-	user, err := am.Store.GetUserByUserID(ctx, store.LockingStrengthNone, userID)
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	dnsDomain := am.networkMapController.GetDNSDomain(settings)
 
-	// if admin or user owns this peer, return peer
-	if user.IsAdminOrServiceUser() || peer.UserID == userID {
-		return peer, nil
+	events := make([]*activity.Event, 0, len(renewedPeers))
+	for _, peer := range renewedPeers {
+		events = append(events, &activity.Event{
+			Activity:    activity.PeerLoginRenewedByUser,
+			InitiatorID: userID,
+			TargetID:    peer.ID,
+			AccountID:   accountID,
+			Meta:        peer.EventMeta(dnsDomain),
+		})
 	}
+	am.storeEvents(ctx, events)
 
-	return am.checkIfUserOwnsPeer(ctx, accountID, userID, peer)
+	if settings.PeerLoginExpirationEnabled {
+		am.peerLoginExpiry.Cancel(ctx, []string{accountID})
+		am.schedulePeerLoginExpiration(ctx, accountID)
+	}
+
+	am.UpdateAccountPeers(ctx, accountID)
+
+	return len(renewedPeers), nil
 }
 
-func (am *DefaultAccountManager) checkIfUserOwnsPeer(ctx context.Context, accountID, userID string, peer *nbpeer.Peer) (*nbpeer.Peer, error) {
-	account, err := am.requestBuffer.GetAccountWithBackpressure(ctx, accountID)
+// SetPeerUpdatesPaused stops or resumes pushing network map updates to the peer without disconnecting it, so that
+// the state of the client stays frozen while it is debugged. On resume the peer receives a fresh network map
+func (am *DefaultAccountManager) SetPeerUpdatesPaused(ctx context.Context, accountID, peerID string, paused bool, userID string) error {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Update)
 	if err != nil {
-		return nil, err
+		return status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return status.NewPermissionDeniedError()
 	}
 
-	approvedPeersMap, err := am.integratedPeerValidator.GetValidatedPeers(ctx, accountID, maps.Values(account.Groups), maps.Values(account.Peers), account.Settings.Extra)
+	peer, err := am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// it is also possible that user doesn't own the peer but some of his peers have access to it,
-	// this is a valid case, show the peer as well.
-	userPeers, err := am.Store.GetUserPeers(ctx, store.LockingStrengthNone, accountID, userID)
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	for _, p := range userPeers {
-		aclPeers, _, _, _ := account.GetPeerConnectionResources(ctx, p, approvedPeersMap, account.GetActiveGroupUsers())
-		for _, aclPeer := range aclPeers {
-			if aclPeer.ID == peer.ID {
-				return peer, nil
-			}
-		}
+	am.networkMapController.SetPeerUpdatesPaused(peer.ID, paused)
+
+	eventMeta := peer.EventMeta(am.networkMapController.GetDNSDomain(settings))
+	if paused {
+		am.StoreEvent(ctx, userID, peer.ID, accountID, activity.PeerUpdatesPaused, eventMeta)
+		return nil
 	}
 
-	return nil, status.Errorf(status.Internal, "user %s has no access to peer %s under account %s", userID, peer.ID, accountID)
+	am.StoreEvent(ctx, userID, peer.ID, accountID, activity.PeerUpdatesResumed, eventMeta)
+	am.UpdateAccountPeer(ctx, accountID, peer.ID)
+
+	return nil
 }
 
 // UpdateAccountPeers updates all peers that belong to an account.
@@ -1232,6 +3341,8 @@ func (am *DefaultAccountManager) UpdateAccountPeer(ctx context.Context, accountI
 }
 
 // getNextPeerExpiration returns the minimum duration in which the next peer of the account will expire if it was found.
+// When the account has a login expiration lead time, the duration until a peer enters the lead time is used instead,
+// so that the peer is asked to re-authenticate on time.
 // If there is no peer that expires this function returns false and a duration of 0.
 // This function only considers peers that haven't been expired yet and that are connected.
 func (am *DefaultAccountManager) getNextPeerExpiration(ctx context.Context, accountID string) (time.Duration, bool) {
@@ -1251,13 +3362,25 @@ func (am *DefaultAccountManager) getNextPeerExpiration(ctx context.Context, acco
 		return peerSchedulerRetryInterval, true
 	}
 
+	expirationOverrides, err := am.getPeerLoginExpirationOverrides(ctx, accountID)
+	if err != nil {
+		log.WithContext(ctx).Errorf("failed to get peer login expiration overrides: %v", err)
+		return peerSchedulerRetryInterval, true
+	}
+
 	var nextExpiry *time.Duration
 	for _, peer := range peersWithExpiry {
 		// consider only connected peers because others will require login on connecting to the management server
 		if peer.Status.LoginExpired || !peer.Status.Connected {
 			continue
 		}
-		_, duration := peer.LoginExpired(settings.PeerLoginExpiration)
+		expiration, _, duration := settings.GetPeerExpiration(peer, expirationOverrides)
+		if expiration != types.PeerExpirationLogin {
+			continue
+		}
+		if leadTime := settings.PeerLoginExpirationLeadTime; leadTime > 0 && duration > leadTime {
+			duration -= leadTime
+		}
 		if nextExpiry == nil || duration < *nextExpiry {
 			// if expiration is below 1s return 1s duration
 			// this avoids issues with ticker that can't be set to < 0
@@ -1275,6 +3398,44 @@ func (am *DefaultAccountManager) getNextPeerExpiration(ctx context.Context, acco
 	return *nextExpiry, true
 }
 
+// hintPeerLoginExpiration sends a network map update to the connected peers that entered the login expiration lead
+// time within the given period, so that they learn that their login expires soon and ask to re-authenticate
+func (am *DefaultAccountManager) hintPeerLoginExpiration(ctx context.Context, accountID string, period time.Duration) {
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		log.WithContext(ctx).Errorf("failed to get account settings: %v", err)
+		return
+	}
+
+	leadTime := settings.PeerLoginExpirationLeadTime
+	if leadTime <= 0 {
+		return
+	}
+
+	peersWithExpiry, err := am.Store.GetAccountPeersWithExpiration(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		log.WithContext(ctx).Errorf("failed to get peers with expiration: %v", err)
+		return
+	}
+
+	expirationOverrides, err := am.getPeerLoginExpirationOverrides(ctx, accountID)
+	if err != nil {
+		log.WithContext(ctx).Errorf("failed to get peer login expiration overrides: %v", err)
+		return
+	}
+
+	for _, peer := range peersWithExpiry {
+		if peer.Status.LoginExpired || !peer.Status.Connected {
+			continue
+		}
+		expiration, expired, duration := settings.GetPeerExpiration(peer, expirationOverrides)
+		if expiration != types.PeerExpirationLogin || expired || duration > leadTime || leadTime-duration > period {
+			continue
+		}
+		am.UpdateAccountPeer(ctx, accountID, peer.ID)
+	}
+}
+
 // GetNextInactivePeerExpiration returns the minimum duration in which the next peer of the account will expire if it was found.
 // If there is no peer that expires this function returns false and a duration of 0.
 // This function only considers peers that haven't been expired yet and that are not connected.
@@ -1295,12 +3456,21 @@ func (am *DefaultAccountManager) getNextInactivePeerExpiration(ctx context.Conte
 		return peerSchedulerRetryInterval, true
 	}
 
+	expirationOverrides, err := am.getPeerLoginExpirationOverrides(ctx, accountID)
+	if err != nil {
+		log.WithContext(ctx).Errorf("failed to get peer login expiration overrides: %v", err)
+		return peerSchedulerRetryInterval, true
+	}
+
 	var nextExpiry *time.Duration
 	for _, peer := range peersWithInactivity {
 		if peer.Status.LoginExpired || peer.Status.Connected {
 			continue
 		}
-		_, duration := peer.SessionExpired(settings.PeerInactivityExpiration)
+		expiration, _, duration := settings.GetPeerExpiration(peer, expirationOverrides)
+		if expiration != types.PeerExpirationInactivity {
+			continue
+		}
 		if nextExpiry == nil || duration < *nextExpiry {
 			// if expiration is below 1s return 1s duration
 			// this avoids issues with ticker that can't be set to < 0
@@ -1330,10 +3500,15 @@ func (am *DefaultAccountManager) getExpiredPeers(ctx context.Context, accountID
 		return nil, err
 	}
 
+	expirationOverrides, err := am.getPeerLoginExpirationOverrides(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
 	var peers []*nbpeer.Peer
 	for _, peer := range peersWithExpiry {
-		expired, _ := peer.LoginExpired(settings.PeerLoginExpiration)
-		if expired {
+		expiration, expired, _ := settings.GetPeerExpiration(peer, expirationOverrides)
+		if expiration == types.PeerExpirationLogin && expired {
 			peers = append(peers, peer)
 		}
 	}
@@ -1341,6 +3516,15 @@ func (am *DefaultAccountManager) getExpiredPeers(ctx context.Context, accountID
 	return peers, nil
 }
 
+// getPeerLoginExpirationOverrides returns the peer login expiration overrides defined by the account groups, keyed by peer ID
+func (am *DefaultAccountManager) getPeerLoginExpirationOverrides(ctx context.Context, accountID string) (map[string]time.Duration, error) {
+	groups, err := am.Store.GetAccountGroups(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return types.PeerLoginExpirationOverrides(groups), nil
+}
+
 // getInactivePeers returns peers that have been expired by inactivity
 func (am *DefaultAccountManager) getInactivePeers(ctx context.Context, accountID string) ([]*nbpeer.Peer, error) {
 	peersWithInactivity, err := am.Store.GetAccountPeersWithInactivity(ctx, store.LockingStrengthNone, accountID)
@@ -1353,10 +3537,15 @@ func (am *DefaultAccountManager) getInactivePeers(ctx context.Context, accountID
 		return nil, err
 	}
 
+	expirationOverrides, err := am.getPeerLoginExpirationOverrides(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
 	var peers []*nbpeer.Peer
 	for _, inactivePeer := range peersWithInactivity {
-		inactive, _ := inactivePeer.SessionExpired(settings.PeerInactivityExpiration)
-		if inactive {
+		expiration, inactive, _ := settings.GetPeerExpiration(inactivePeer, expirationOverrides)
+		if expiration == types.PeerExpirationInactivity && inactive {
 			peers = append(peers, inactivePeer)
 		}
 	}
@@ -1375,9 +3564,18 @@ func getPeerGroupIDs(ctx context.Context, transaction store.Store, accountID str
 }
 
 // deletePeers deletes all specified peers and sends updates to the remote peers.
-// Returns a slice of functions to save events after successful peer deletion.
+// Returns a slice of functions to save events after successful peer deletion, the events are stored with a single write.
 func deletePeers(ctx context.Context, am *DefaultAccountManager, transaction store.Store, accountID, userID string, peers []*nbpeer.Peer, settings *types.Settings) ([]func(), error) {
-	var peerDeletedEvents []func()
+	var peerDeletedEvents []*activity.Event
+	addEvent := func(targetID string, activityID activity.Activity, meta map[string]any) {
+		peerDeletedEvents = append(peerDeletedEvents, &activity.Event{
+			Activity:    activityID,
+			InitiatorID: userID,
+			TargetID:    targetID,
+			AccountID:   accountID,
+			Meta:        meta,
+		})
+	}
 
 	dnsDomain := am.networkMapController.GetDNSDomain(settings)
 
@@ -1401,54 +3599,392 @@ func deletePeers(ctx context.Context, am *DefaultAccountManager, transaction sto
 				return nil, err
 			}
 
-			peerDeletedEvents = append(peerDeletedEvents, func() {
-				am.StoreEvent(ctx, userID, peer.ID, accountID, activity.PolicyRemoved, policy.EventMeta())
-			})
+			addEvent(peer.ID, activity.PolicyRemoved, policy.EventMeta())
 		}
 
 		if err = transaction.DeletePeer(ctx, accountID, peer.ID); err != nil {
 			return nil, err
 		}
-		peerDeletedEvents = append(peerDeletedEvents, func() {
-			am.StoreEvent(ctx, userID, peer.ID, accountID, activity.PeerRemovedByUser, peer.EventMeta(dnsDomain))
+		addEvent(peer.ID, activity.PeerRemovedByUser, peer.EventMeta(dnsDomain))
+		if peer.Status.IsPendingApproval() {
+			addEvent(peer.ID, activity.PeerRejected, peer.EventMeta(dnsDomain))
+		}
+	}
+
+	if err := unpinDeletedPeers(ctx, transaction, accountID, peers); err != nil {
+		return nil, err
+	}
+
+	return []func(){
+		func() {
+			am.storeEvents(ctx, peerDeletedEvents)
+		},
+	}, nil
+}
+
+// unpinDeletedPeers removes the deleted peers from the pinned peers of the account users
+func unpinDeletedPeers(ctx context.Context, transaction store.Store, accountID string, peers []*nbpeer.Peer) error {
+	deleted := make(map[string]struct{}, len(peers))
+	for _, peer := range peers {
+		deleted[peer.ID] = struct{}{}
+	}
+
+	users, err := transaction.GetAccountUsers(ctx, store.LockingStrengthUpdate, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to get account users: %w", err)
+	}
+
+	var changed []*types.User
+	for _, user := range users {
+		pinned := slices.DeleteFunc(slices.Clone(user.PinnedPeers), func(id string) bool {
+			_, ok := deleted[id]
+			return ok
 		})
+		if len(pinned) == len(user.PinnedPeers) {
+			continue
+		}
+		user.PinnedPeers = pinned
+		changed = append(changed, user)
 	}
 
-	return peerDeletedEvents, nil
+	if len(changed) == 0 {
+		return nil
+	}
+
+	return transaction.SaveUsers(ctx, changed)
 }
 
 // validatePeerDelete checks if the peer can be deleted.
 func (am *DefaultAccountManager) validatePeerDelete(ctx context.Context, transaction store.Store, accountId, peerId string) error {
-	linkedInIngressPorts, err := am.proxyController.IsPeerInIngressPorts(ctx, accountId, peerId)
+	roles, err := am.getPeerRoles(ctx, transaction, accountId, peerId)
 	if err != nil {
 		return err
 	}
 
-	if linkedInIngressPorts {
+	if roles.IngressPorts {
 		return status.Errorf(status.PreconditionFailed, "peer is linked to ingress ports: %s", peerId)
 	}
 
-	linked, router := isPeerLinkedToNetworkRouter(ctx, transaction, accountId, peerId)
-	if linked {
-		return status.Errorf(status.PreconditionFailed, "peer is linked to a network router: %s", router.ID)
+	if roles.IsNetworkRouter() {
+		return status.Errorf(status.PreconditionFailed, "peer is linked to a network router: %s", roles.NetworkRouterIDs[0])
 	}
 
 	return nil
 }
 
-// isPeerLinkedToNetworkRouter checks if a peer is linked to any network router in the account.
-func isPeerLinkedToNetworkRouter(ctx context.Context, transaction store.Store, accountID string, peerID string) (bool, *routerTypes.NetworkRouter) {
-	routers, err := transaction.GetNetworkRoutersByAccountID(ctx, store.LockingStrengthNone, accountID)
+// UpdatePeerLastHandshake stores the last WireGuard handshake reported by the peer if it is newer than the stored one
+func (am *DefaultAccountManager) UpdatePeerLastHandshake(ctx context.Context, peerPubKey string, lastHandshake time.Time) error {
+	if lastHandshake.IsZero() {
+		return nil
+	}
+
+	peer, err := am.Store.GetPeerByPeerPubKey(ctx, store.LockingStrengthNone, peerPubKey)
 	if err != nil {
-		log.WithContext(ctx).Errorf("error retrieving network routers while checking peer linkage: %v", err)
-		return false, nil
+		return err
+	}
+
+	if !lastHandshake.After(peer.Status.LastHandshake) {
+		return nil
+	}
+
+	return am.Store.SavePeerLastHandshake(ctx, peer.AccountID, peer.ID, lastHandshake.UTC())
+}
+
+// UpdatePeerAppliedSerial records the serial of the network map the peer acknowledged to have applied. The serials
+// are buffered and written to the store every appliedSerialFlushInterval
+func (am *DefaultAccountManager) UpdatePeerAppliedSerial(ctx context.Context, peerPubKey string, serial uint64) error {
+	if serial == 0 {
+		return nil
+	}
+
+	am.appliedSerials.add(peerPubKey, serial)
+	return nil
+}
+
+// GetPeerAppliedSerial returns the serial of the last network map the peer acknowledged to have applied,
+// zero when the peer never acknowledged a network map
+func (am *DefaultAccountManager) GetPeerAppliedSerial(ctx context.Context, accountID, peerID, userID string) (uint64, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return 0, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return 0, status.NewPermissionDeniedError()
+	}
+
+	peer, err := am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID)
+	if err != nil {
+		return 0, err
+	}
+
+	return max(peer.AppliedNetworkSerial, am.appliedSerials.get(peer.Key)), nil
+}
+
+// UpdatePeerReportedErrors merges the errors reported by the peer into the stored ones, keeping only the most recent
+// nbpeer.MaxReportedErrors of them. The peer is locked while merging so concurrent reports don't overwrite each other
+func (am *DefaultAccountManager) UpdatePeerReportedErrors(ctx context.Context, peerPubKey string, reportedErrors []nbpeer.ReportedError) error {
+	if len(reportedErrors) == 0 {
+		return nil
+	}
+
+	return am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		peer, err := transaction.GetPeerByPeerPubKey(ctx, store.LockingStrengthUpdate, peerPubKey)
+		if err != nil {
+			return err
+		}
+
+		merged := nbpeer.MergeReportedErrors(peer.ReportedErrors, reportedErrors)
+		if slices.Equal(merged, peer.ReportedErrors) {
+			return nil
+		}
+
+		return transaction.SavePeerReportedErrors(ctx, peer.AccountID, peer.ID, merged)
+	})
+}
+
+const (
+	// peerUsageRollupInterval is how often the usage samples of all the peers are rolled up and expired
+	peerUsageRollupInterval = time.Hour
+	peerUsageRollupJobID    = "peer-usage-rollup"
+)
+
+// peerUsageRollupJob drops the usage samples older than the usage retention and merges the ones older than
+// nbpeer.UsageRollupAge into nbpeer.UsageRollupBucket samples, which keeps the samples table bounded by the number
+// of peers instead of the number of usage reports
+func (am *DefaultAccountManager) peerUsageRollupJob(ctx context.Context) func() (time.Duration, bool) {
+	return func() (time.Duration, bool) {
+		now := time.Now().UTC()
+
+		if err := am.Store.DeleteUsageSamplesBefore(ctx, now.Add(-nbpeer.UsageRetention)); err != nil {
+			log.WithContext(ctx).Errorf("failed to delete expired peer usage samples: %v", err)
+		}
+
+		if err := am.Store.RollupUsageSamples(ctx, now.Add(-nbpeer.UsageRollupAge), nbpeer.UsageRollupBucket); err != nil {
+			log.WithContext(ctx).Errorf("failed to roll up peer usage samples: %v", err)
+		}
+
+		return peerUsageRollupInterval, true
+	}
+}
+
+// RecordPeerUsage stores the data transferred by the peer since its previous report, given the cumulative counters
+// reported by the peer. Old samples are rolled up and dropped by the usage rollup job. When the account caps the peer usage,
+// the peer is marked for quarantine while its usage within the cap window exceeds the cap
+func (am *DefaultAccountManager) RecordPeerUsage(ctx context.Context, peerPubKey string, rxCounter, txCounter int64) error {
+	if rxCounter < 0 || txCounter < 0 {
+		return status.Errorf(status.InvalidArgument, "peer usage counters can't be negative")
+	}
+
+	peer, err := am.Store.GetPeerByPeerPubKey(ctx, store.LockingStrengthNone, peerPubKey)
+	if err != nil {
+		return err
+	}
+
+	var settings *types.Settings
+	var capExceeded bool
+	var capChanged bool
+
+	now := time.Now().UTC()
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		capChanged = false
+
+		peer, err = transaction.GetPeerByID(ctx, store.LockingStrengthUpdate, peer.AccountID, peer.ID)
+		if err != nil {
+			return err
+		}
+
+		previous, err := transaction.GetPeerLastUsageSample(ctx, store.LockingStrengthNone, peer.AccountID, peer.ID)
+		if err != nil {
+			if sErr, ok := status.FromError(err); !ok || sErr.Type() != status.NotFound {
+				return err
+			}
+		}
+
+		if previous == nil || previous.RxCounter != rxCounter || previous.TxCounter != txCounter {
+			sample := nbpeer.NewUsageSample(previous, peer.AccountID, peer.ID, rxCounter, txCounter, now)
+			if err = transaction.AddPeerUsageSample(ctx, sample); err != nil {
+				return err
+			}
+		}
+
+		settings, err = transaction.GetAccountSettings(ctx, store.LockingStrengthNone, peer.AccountID)
+		if err != nil {
+			return err
+		}
+
+		capExceeded = false
+		if settings.PeerUsageCap > 0 {
+			rx, tx, err := transaction.GetPeerUsage(ctx, store.LockingStrengthNone, peer.AccountID, peer.ID, now.Add(-settings.PeerUsageCapWindow))
+			if err != nil {
+				return err
+			}
+			capExceeded = rx+tx > settings.PeerUsageCap
+		}
+
+		if capExceeded == peer.Status.UsageCapExceeded {
+			return nil
+		}
+		capChanged = true
+
+		return transaction.SavePeerUsageCapExceeded(ctx, peer.AccountID, peer.ID, capExceeded)
+	})
+	if err != nil {
+		return err
+	}
+
+	if capChanged && capExceeded {
+		log.WithContext(ctx).Infof("peer %s exceeded the usage cap of %d bytes within %s and is marked for quarantine",
+			peer.ID, settings.PeerUsageCap, settings.PeerUsageCapWindow)
+
+		meta := peer.EventMeta(am.networkMapController.GetDNSDomain(settings))
+		meta["cap_bytes"] = settings.PeerUsageCap
+		meta["window_seconds"] = int64(settings.PeerUsageCapWindow.Seconds())
+		am.StoreEvent(ctx, activity.SystemInitiator, peer.ID, peer.AccountID, activity.PeerUsageCapExceeded, meta)
+	}
+
+	return nil
+}
+
+// GetPeerUsage returns the data transferred by a peer within the given time window, which can't exceed the usage retention
+// Windows reaching further back than nbpeer.UsageRollupAge are only as precise as nbpeer.UsageRollupBucket
+func (am *DefaultAccountManager) GetPeerUsage(ctx context.Context, accountID, userID, peerID string, window time.Duration) (*nbpeer.Usage, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	if window <= 0 || window > nbpeer.UsageRetention {
+		return nil, status.Errorf(status.InvalidArgument, "usage window must be positive and at most %s", nbpeer.UsageRetention)
+	}
+
+	peer, err := am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().UTC().Add(-window)
+	rx, tx, err := am.Store.GetPeerUsage(ctx, store.LockingStrengthNone, accountID, peerID, since)
+	if err != nil {
+		return nil, err
 	}
 
+	return &nbpeer.Usage{
+		PeerID:      peer.ID,
+		Since:       since,
+		RxBytes:     rx,
+		TxBytes:     tx,
+		CapExceeded: peer.Status.UsageCapExceeded,
+	}, nil
+}
+
+// GetPeerRoles returns whether the peer is a network router, linked to ingress ports and/or an exit node
+func (am *DefaultAccountManager) GetPeerRoles(ctx context.Context, accountID, userID, peerID string) (*types.PeerRoles, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	if _, err = am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID); err != nil {
+		return nil, err
+	}
+
+	return am.getPeerRoles(ctx, am.Store, accountID, peerID)
+}
+
+// GetPeersWithIngressPorts returns the peers of the account linked to ingress port configurations, together with the
+// configurations when the port controller can describe them
+func (am *DefaultAccountManager) GetPeersWithIngressPorts(ctx context.Context, accountID, userID string) ([]*types.PeerIngressPorts, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	peers, err := am.Store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	portsProvider, _ := am.proxyController.(port_forwarding.IngressPortsProvider)
+
+	linkedPeers := make([]*types.PeerIngressPorts, 0)
+	for _, peer := range peers {
+		linked, err := am.proxyController.IsPeerInIngressPorts(ctx, accountID, peer.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check ingress ports of peer %s: %w", peer.ID, err)
+		}
+		if !linked {
+			continue
+		}
+
+		linkedPeer := &types.PeerIngressPorts{Peer: peer, Ports: []*types.IngressPort{}}
+		if portsProvider != nil {
+			ports, err := portsProvider.GetPeerIngressPorts(ctx, accountID, peer.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get ingress ports of peer %s: %w", peer.ID, err)
+			}
+			linkedPeer.Ports = ports
+		}
+		linkedPeers = append(linkedPeers, linkedPeer)
+	}
+
+	return linkedPeers, nil
+}
+
+// getPeerRoles collects the infrastructure roles of the peer in the account.
+func (am *DefaultAccountManager) getPeerRoles(ctx context.Context, transaction store.Store, accountID, peerID string) (*types.PeerRoles, error) {
+	roles := &types.PeerRoles{}
+
+	linkedInIngressPorts, err := am.proxyController.IsPeerInIngressPorts(ctx, accountID, peerID)
+	if err != nil {
+		return nil, err
+	}
+	roles.IngressPorts = linkedInIngressPorts
+
+	routers, err := transaction.GetNetworkRoutersByAccountID(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network routers: %w", err)
+	}
 	for _, router := range routers {
 		if router.Peer == peerID {
-			return true, router
+			roles.NetworkRouterIDs = append(roles.NetworkRouterIDs, router.ID)
 		}
 	}
 
-	return false, nil
+	routes, err := transaction.GetAccountRoutes(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get routes: %w", err)
+	}
+
+	var peerGroupIDs []string
+	peerGroupsLoaded := false
+	for _, r := range routes {
+		if !r.Enabled || !r.IsExitNode() {
+			continue
+		}
+
+		if r.Peer != peerID && len(r.PeerGroups) > 0 && !peerGroupsLoaded {
+			peerGroupIDs, err = transaction.GetPeerGroupIDs(ctx, store.LockingStrengthNone, accountID, peerID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get peer groups: %w", err)
+			}
+			peerGroupsLoaded = true
+		}
+
+		if r.Peer == peerID || slices.ContainsFunc(r.PeerGroups, func(groupID string) bool {
+			return slices.Contains(peerGroupIDs, groupID)
+		}) {
+			roles.ExitNodeRouteIDs = append(roles.ExitNodeRouteIDs, string(r.ID))
+		}
+	}
+
+	return roles, nil
 }
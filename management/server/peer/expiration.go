@@ -0,0 +1,30 @@
+package peer
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// DefaultExpirationTolerance is the grace period added to the login and inactivity expiration of peers, so a peer
+	// isn't expired early because of timestamp rounding or a small clock drift between management servers
+	DefaultExpirationTolerance = time.Second
+	// MaxExpirationTolerance caps the expiration tolerance of an account
+	MaxExpirationTolerance = time.Minute
+)
+
+// expirationTimeLeft returns the time left until an expiration of expiresIn, extended by tolerance, counted from
+// since as seen at now. The elapsed time is measured with now.Sub, which relies on the monotonic clock when both
+// times carry it, and a since in the future comes from a skewed clock and counts as no elapsed time, so a skewed
+// timestamp can't postpone the expiration beyond expiresIn. A negative expiresIn is treated as zero
+func expirationTimeLeft(since time.Time, expiresIn, tolerance time.Duration, now time.Time) time.Duration {
+	expiresIn = max(expiresIn, 0)
+	tolerance = max(tolerance, 0)
+	if expiresIn > math.MaxInt64-tolerance {
+		expiresIn = math.MaxInt64 - tolerance
+	}
+
+	// the difference saturates instead of overflowing for zero or far away timestamps
+	elapsed := max(now.Sub(since), 0)
+	return expiresIn + tolerance - elapsed
+}
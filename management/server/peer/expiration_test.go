@@ -0,0 +1,113 @@
+package peer
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpirationTimeLeft(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tolerance := DefaultExpirationTolerance
+
+	tests := []struct {
+		name      string
+		since     time.Time
+		expiresIn time.Duration
+		expected  time.Duration
+	}{
+		{
+			name:      "not expired",
+			since:     now.Add(-30 * time.Minute),
+			expiresIn: time.Hour,
+			expected:  30*time.Minute + tolerance,
+		},
+		{
+			name:      "within the tolerance",
+			since:     now.Add(-time.Hour),
+			expiresIn: time.Hour,
+			expected:  tolerance,
+		},
+		{
+			name:      "expired",
+			since:     now.Add(-2 * time.Hour),
+			expiresIn: time.Hour,
+			expected:  -time.Hour + tolerance,
+		},
+		{
+			name:      "since in the future is counted from now",
+			since:     now.Add(24 * time.Hour),
+			expiresIn: time.Hour,
+			expected:  time.Hour + tolerance,
+		},
+		{
+			name:      "negative expiration is treated as zero",
+			since:     now.Add(-time.Minute),
+			expiresIn: -time.Hour,
+			expected:  -time.Minute + tolerance,
+		},
+		{
+			name:      "zero since saturates",
+			since:     time.Time{},
+			expiresIn: time.Hour,
+			expected:  time.Hour + tolerance - time.Duration(math.MaxInt64),
+		},
+		{
+			name:      "huge expiration doesn't overflow",
+			since:     now,
+			expiresIn: time.Duration(math.MaxInt64),
+			expected:  time.Duration(math.MaxInt64),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, expirationTimeLeft(tt.since, tt.expiresIn, tolerance, now))
+		})
+	}
+}
+
+func TestPeer_LoginExpired_SkewedLastLogin(t *testing.T) {
+	newPeer := func(lastLogin time.Time) *Peer {
+		return &Peer{UserID: "user", LoginExpirationEnabled: true, LastLogin: &lastLogin, Status: &PeerStatus{}}
+	}
+
+	// a last login reported ahead of the server clock must not postpone the expiration
+	expired, timeLeft := newPeer(time.Now().Add(48*time.Hour)).LoginExpired(time.Hour, DefaultExpirationTolerance)
+	assert.False(t, expired)
+	assert.LessOrEqual(t, timeLeft, time.Hour+DefaultExpirationTolerance)
+
+	// a peer right at its expiration isn't expired before the tolerance passed
+	expired, _ = newPeer(time.Now().Add(-time.Hour)).LoginExpired(time.Hour, DefaultExpirationTolerance)
+	assert.False(t, expired)
+
+	expired, timeLeft = newPeer(time.Now().Add(-time.Hour-2*DefaultExpirationTolerance)).LoginExpired(time.Hour, DefaultExpirationTolerance)
+	assert.True(t, expired)
+	assert.Negative(t, timeLeft)
+}
+
+func TestPeer_LoginExpired_Tolerance(t *testing.T) {
+	lastLogin := time.Now().Add(-time.Hour - 10*time.Second)
+	peer := &Peer{UserID: "user", LoginExpirationEnabled: true, LastLogin: &lastLogin, Status: &PeerStatus{}}
+
+	expired, _ := peer.LoginExpired(time.Hour, DefaultExpirationTolerance)
+	assert.True(t, expired)
+
+	expired, _ = peer.LoginExpired(time.Hour, 30*time.Second)
+	assert.False(t, expired, "the tolerance of the account must postpone the expiration")
+}
+
+func TestPeer_GetLastLogin(t *testing.T) {
+	future := time.Now().UTC().Add(48 * time.Hour)
+	peer := &Peer{LastLogin: &future}
+	assert.WithinDuration(t, time.Now().UTC(), peer.GetLastLogin(), time.Minute, "a future last login must be clamped to now")
+
+	past := time.Now().UTC().Add(-time.Hour)
+	peer.LastLogin = &past
+	assert.Equal(t, past, peer.GetLastLogin())
+
+	peer.LastLogin = nil
+	assert.True(t, peer.GetLastLogin().IsZero())
+}
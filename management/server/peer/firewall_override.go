@@ -0,0 +1,109 @@
+package peer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+)
+
+const (
+	// FirewallOverrideDirectionIN applies the override to the traffic coming to the peer
+	FirewallOverrideDirectionIN = "in"
+	// FirewallOverrideDirectionOUT applies the override to the traffic leaving the peer
+	FirewallOverrideDirectionOUT = "out"
+
+	// MaxFirewallOverrides is the maximum number of firewall overrides a peer can have
+	MaxFirewallOverrides = 50
+)
+
+var (
+	firewallOverrideActions   = []string{"accept", "drop"}
+	firewallOverrideProtocols = []string{"all", "tcp", "udp", "icmp"}
+)
+
+// FirewallOverride is a firewall rule scoped to a single peer. Overrides are layered on top of the rules derived
+// from the account policies and replace the policy rules whose traffic they fully cover: same direction, the same
+// remote peer or all peers, the same protocol or all protocols, and a port range containing the one of the rule.
+type FirewallOverride struct {
+	// PeerIP is the IP of the remote peer the rule applies to, 0.0.0.0 matches all peers
+	PeerIP string
+	// Direction of the traffic, either FirewallOverrideDirectionIN or FirewallOverrideDirectionOUT
+	Direction string
+	// Action of the traffic, accept or drop
+	Action string
+	// Protocol of the traffic, all, tcp, udp or icmp
+	Protocol string
+	// Port of the traffic, only for tcp and udp. Empty matches all ports
+	Port string
+	// PortRange of the traffic, only for tcp and udp. Can't be combined with Port
+	PortRange FirewallOverridePortRange
+}
+
+// FirewallOverridePortRange is an inclusive range of ports, an empty range matches all ports
+type FirewallOverridePortRange struct {
+	Start uint16
+	End   uint16
+}
+
+// Validate checks whether the override is a valid firewall rule
+func (o *FirewallOverride) Validate() error {
+	if net.ParseIP(o.PeerIP).To4() == nil {
+		return fmt.Errorf("invalid peer IP %q", o.PeerIP)
+	}
+
+	if o.Direction != FirewallOverrideDirectionIN && o.Direction != FirewallOverrideDirectionOUT {
+		return fmt.Errorf("invalid direction %q", o.Direction)
+	}
+
+	if !slices.Contains(firewallOverrideActions, o.Action) {
+		return fmt.Errorf("invalid action %q", o.Action)
+	}
+
+	if !slices.Contains(firewallOverrideProtocols, o.Protocol) {
+		return fmt.Errorf("invalid protocol %q", o.Protocol)
+	}
+
+	hasPortRange := o.PortRange != FirewallOverridePortRange{}
+	if o.Port == "" && !hasPortRange {
+		return nil
+	}
+
+	if o.Protocol != "tcp" && o.Protocol != "udp" {
+		return errors.New("ports can only be set for tcp and udp protocols")
+	}
+
+	if o.Port != "" && hasPortRange {
+		return errors.New("port and port range can't be set together")
+	}
+
+	if o.Port != "" {
+		port, err := strconv.ParseUint(o.Port, 10, 16)
+		if err != nil || port == 0 {
+			return fmt.Errorf("invalid port %q", o.Port)
+		}
+		return nil
+	}
+
+	if o.PortRange.Start == 0 || o.PortRange.Start > o.PortRange.End {
+		return fmt.Errorf("invalid port range %d-%d", o.PortRange.Start, o.PortRange.End)
+	}
+
+	return nil
+}
+
+// ValidateFirewallOverrides checks the list of firewall overrides of a peer
+func ValidateFirewallOverrides(overrides []FirewallOverride) error {
+	if len(overrides) > MaxFirewallOverrides {
+		return fmt.Errorf("a peer can't have more than %d firewall overrides", MaxFirewallOverrides)
+	}
+
+	for i := range overrides {
+		if err := overrides[i].Validate(); err != nil {
+			return fmt.Errorf("invalid firewall override %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package peer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirewallOverride_Validate(t *testing.T) {
+	valid := FirewallOverride{PeerIP: "100.64.0.10", Direction: FirewallOverrideDirectionIN, Action: "accept", Protocol: "tcp", Port: "22"}
+
+	tests := []struct {
+		name    string
+		modify  func(o *FirewallOverride)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(o *FirewallOverride) {}},
+		{name: "all peers", modify: func(o *FirewallOverride) { o.PeerIP = "0.0.0.0" }},
+		{name: "port range", modify: func(o *FirewallOverride) { o.Port = ""; o.PortRange = FirewallOverridePortRange{Start: 80, End: 90} }},
+		{name: "all protocols without ports", modify: func(o *FirewallOverride) { o.Protocol = "all"; o.Port = "" }},
+		{name: "invalid peer IP", modify: func(o *FirewallOverride) { o.PeerIP = "peer" }, wantErr: true},
+		{name: "invalid direction", modify: func(o *FirewallOverride) { o.Direction = "both" }, wantErr: true},
+		{name: "invalid action", modify: func(o *FirewallOverride) { o.Action = "reject" }, wantErr: true},
+		{name: "invalid protocol", modify: func(o *FirewallOverride) { o.Protocol = "sctp" }, wantErr: true},
+		{name: "port with icmp", modify: func(o *FirewallOverride) { o.Protocol = "icmp" }, wantErr: true},
+		{name: "invalid port", modify: func(o *FirewallOverride) { o.Port = "70000" }, wantErr: true},
+		{name: "port and range", modify: func(o *FirewallOverride) { o.PortRange = FirewallOverridePortRange{Start: 80, End: 90} }, wantErr: true},
+		{name: "reversed range", modify: func(o *FirewallOverride) { o.Port = ""; o.PortRange = FirewallOverridePortRange{Start: 90, End: 80} }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			override := valid
+			tt.modify(&override)
+			err := override.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestValidateFirewallOverrides_Limit(t *testing.T) {
+	override := FirewallOverride{PeerIP: "0.0.0.0", Direction: FirewallOverrideDirectionOUT, Action: "drop", Protocol: "all"}
+
+	overrides := make([]FirewallOverride, MaxFirewallOverrides)
+	for i := range overrides {
+		overrides[i] = override
+	}
+	assert.NoError(t, ValidateFirewallOverrides(overrides))
+	assert.Error(t, ValidateFirewallOverrides(append(overrides, override)))
+}
@@ -0,0 +1,126 @@
+package peer
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Names of the peer system meta fields that can be configured as significant
+const (
+	MetaFieldHostname           = "hostname"
+	MetaFieldGoOS               = "go_os"
+	MetaFieldKernel             = "kernel"
+	MetaFieldCore               = "core"
+	MetaFieldPlatform           = "platform"
+	MetaFieldOS                 = "os"
+	MetaFieldOSVersion          = "os_version"
+	MetaFieldWtVersion          = "wt_version"
+	MetaFieldUIVersion          = "ui_version"
+	MetaFieldKernelVersion      = "kernel_version"
+	MetaFieldNetworkAddresses   = "network_addresses"
+	MetaFieldSystemSerialNumber = "system_serial_number"
+	MetaFieldSystemProductName  = "system_product_name"
+	MetaFieldSystemManufacturer = "system_manufacturer"
+	MetaFieldEnvironment        = "environment"
+	MetaFieldFlags              = "flags"
+	MetaFieldFiles              = "files"
+	MetaFieldRelayAddress       = "relay_address"
+)
+
+// systemMetaFields lists every field of PeerSystemMeta
+var systemMetaFields = []string{
+	MetaFieldHostname, MetaFieldGoOS, MetaFieldKernel, MetaFieldCore, MetaFieldPlatform, MetaFieldOS, MetaFieldOSVersion,
+	MetaFieldWtVersion, MetaFieldUIVersion, MetaFieldKernelVersion, MetaFieldNetworkAddresses, MetaFieldSystemSerialNumber,
+	MetaFieldSystemProductName, MetaFieldSystemManufacturer, MetaFieldEnvironment, MetaFieldFlags, MetaFieldFiles,
+	MetaFieldRelayAddress,
+}
+
+// postureMetaFields are evaluated by posture checks, so their changes always trigger a peer update
+var postureMetaFields = []string{
+	MetaFieldGoOS, MetaFieldOSVersion, MetaFieldKernelVersion, MetaFieldWtVersion, MetaFieldNetworkAddresses, MetaFieldFiles,
+}
+
+// ValidateSignificantMetaFields validates the significant peer meta fields of an account.
+// The fields used by posture checks can't be left out of a non-empty list
+func ValidateSignificantMetaFields(fields []string) error {
+	for _, field := range fields {
+		if !slices.Contains(systemMetaFields, field) {
+			return fmt.Errorf("unknown peer meta field %q", field)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	for _, field := range postureMetaFields {
+		if !slices.Contains(fields, field) {
+			return fmt.Errorf("peer meta field %q is used by posture checks and must be significant", field)
+		}
+	}
+	return nil
+}
+
+// IsSignificantMetaField reports whether changes of the field trigger a peer update given the significant fields of
+// the account. When no fields are configured, every field of the system meta is significant
+func IsSignificantMetaField(significantFields []string, field string) bool {
+	if slices.Contains(postureMetaFields, field) {
+		return true
+	}
+	if len(significantFields) == 0 {
+		return true
+	}
+	return slices.Contains(significantFields, field)
+}
+
+// isSignificantlyEqual reports whether the meta only differs from the other one by insignificant fields
+func (p PeerSystemMeta) isSignificantlyEqual(other PeerSystemMeta, significantFields []string) bool {
+	for _, field := range systemMetaFields {
+		if !IsSignificantMetaField(significantFields, field) {
+			p.copyMetaField(&other, field)
+		}
+	}
+	return p.isEqual(other)
+}
+
+// copyMetaField overwrites the given field of dst with the value of the meta
+func (p PeerSystemMeta) copyMetaField(dst *PeerSystemMeta, field string) {
+	switch field {
+	case MetaFieldHostname:
+		dst.Hostname = p.Hostname
+	case MetaFieldGoOS:
+		dst.GoOS = p.GoOS
+	case MetaFieldKernel:
+		dst.Kernel = p.Kernel
+	case MetaFieldCore:
+		dst.Core = p.Core
+	case MetaFieldPlatform:
+		dst.Platform = p.Platform
+	case MetaFieldOS:
+		dst.OS = p.OS
+	case MetaFieldOSVersion:
+		dst.OSVersion = p.OSVersion
+	case MetaFieldWtVersion:
+		dst.WtVersion = p.WtVersion
+	case MetaFieldUIVersion:
+		dst.UIVersion = p.UIVersion
+	case MetaFieldKernelVersion:
+		dst.KernelVersion = p.KernelVersion
+	case MetaFieldNetworkAddresses:
+		dst.NetworkAddresses = p.NetworkAddresses
+	case MetaFieldSystemSerialNumber:
+		dst.SystemSerialNumber = p.SystemSerialNumber
+	case MetaFieldSystemProductName:
+		dst.SystemProductName = p.SystemProductName
+	case MetaFieldSystemManufacturer:
+		dst.SystemManufacturer = p.SystemManufacturer
+	case MetaFieldEnvironment:
+		dst.Environment = p.Environment
+	case MetaFieldFlags:
+		dst.Flags = p.Flags
+	case MetaFieldFiles:
+		dst.Files = p.Files
+	case MetaFieldRelayAddress:
+		dst.RelayAddress = p.RelayAddress
+	}
+}
@@ -0,0 +1,53 @@
+package peer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSignificantMetaFields(t *testing.T) {
+	require.NoError(t, ValidateSignificantMetaFields(nil), "no fields should make every field significant")
+
+	require.Error(t, ValidateSignificantMetaFields([]string{MetaFieldHostname, "uptime"}), "unknown fields should be rejected")
+	require.Error(t, ValidateSignificantMetaFields([]string{MetaFieldHostname}), "posture check fields should not be insignificant")
+
+	require.Error(t, ValidateSignificantMetaFields(append([]string{"last_handshake"}, postureMetaFields...)), "only system meta fields should be accepted")
+
+	fields := append([]string{MetaFieldHostname}, postureMetaFields...)
+	require.NoError(t, ValidateSignificantMetaFields(fields))
+}
+
+func TestIsSignificantMetaField(t *testing.T) {
+	require.True(t, IsSignificantMetaField(nil, MetaFieldKernel), "every meta field should be significant by default")
+
+	fields := []string{MetaFieldHostname}
+	require.True(t, IsSignificantMetaField(fields, MetaFieldHostname))
+	require.False(t, IsSignificantMetaField(fields, MetaFieldKernel))
+	require.True(t, IsSignificantMetaField(fields, MetaFieldOSVersion), "posture check fields should always be significant")
+}
+
+func TestUpdateMetaIfNew_SignificantFields(t *testing.T) {
+	significant := append([]string{MetaFieldHostname}, postureMetaFields...)
+
+	meta := PeerSystemMeta{Hostname: "peer", OSVersion: "14.1", SystemProductName: "laptop", WtVersion: "0.60.0"}
+	p := &Peer{Meta: meta}
+
+	noisy := meta
+	noisy.SystemProductName = "laptop 2"
+	updated, _, insignificant := p.UpdateMetaIfNew(noisy, significant)
+	require.False(t, updated, "an insignificant change should not report an update")
+	require.True(t, insignificant, "an insignificant change should still be reported to be stored")
+	require.Equal(t, noisy.SystemProductName, p.Meta.SystemProductName, "an insignificant change should be applied")
+
+	upgraded := noisy
+	upgraded.OSVersion = "14.2"
+	updated, _, insignificant = p.UpdateMetaIfNew(upgraded, significant)
+	require.True(t, updated, "a significant change should report an update")
+	require.False(t, insignificant)
+	require.Equal(t, upgraded, p.Meta)
+
+	updated, _, insignificant = p.UpdateMetaIfNew(upgraded, significant)
+	require.False(t, updated)
+	require.False(t, insignificant, "unchanged meta should not be stored")
+}
@@ -1,14 +1,17 @@
 package peer
 
 import (
+	"fmt"
 	"net"
 	"net/netip"
 	"slices"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/netbirdio/netbird/management/server/util"
 	"github.com/netbirdio/netbird/shared/management/http/api"
+	"github.com/netbirdio/netbird/util/crypt"
 )
 
 // Peer represents a machine connected to the network.
@@ -26,6 +29,10 @@ type Peer struct {
 	Meta PeerSystemMeta `gorm:"embedded;embeddedPrefix:meta_"`
 	// Name is peer's name (machine name)
 	Name string `gorm:"index"`
+	// Description is a free-form human-readable description of the peer. Unlike Name it is not used for DNS resolution
+	Description string
+	// AdminNotes is an internal annotation of the peer editable by admins only. It is never sent to the peer
+	AdminNotes string
 	// DNSLabel is the parsed peer name for domain resolution. It is used to form an FQDN by appending the account's
 	// domain to the peer label. e.g. peer-dns-label.netbird.cloud
 	DNSLabel string // uniqueness index per accountID (check migrations)
@@ -33,6 +40,11 @@ type Peer struct {
 	Status *PeerStatus `gorm:"embedded;embeddedPrefix:peer_status_"`
 	// The user ID that registered the peer
 	UserID string
+	// SetupKeyID is the ID of the setup key the peer was registered with. Empty for peers added by a user
+	SetupKeyID string `gorm:"index"`
+	// OwnerEmail is the email of the user that registered the peer, kept on the peer to avoid IdP lookups.
+	// It is refreshed when the peer logs in and may lag behind the IdP in between
+	OwnerEmail string `gorm:"default:''"`
 	// SSHKey is a public SSH key of the peer
 	SSHKey string
 	// SSHEnabled indicates whether SSH server is enabled on the peer
@@ -46,6 +58,11 @@ type Peer struct {
 	LastLogin *time.Time
 	// CreatedAt records the time the peer was created
 	CreatedAt time.Time
+	// FirstConnectedAt records the time the peer connected to management for the first time. Nil if it never connected
+	FirstConnectedAt *time.Time
+	// AppliedNetworkSerial is the serial of the last network map the peer acknowledged to have applied.
+	// Zero for clients that don't acknowledge network maps
+	AppliedNetworkSerial uint64
 	// Indicate ephemeral peer attribute
 	Ephemeral bool `gorm:"index"`
 	// Geo location based on connection IP
@@ -55,8 +72,24 @@ type Peer struct {
 	ExtraDNSLabels []string `gorm:"serializer:json"`
 	// AllowExtraDNSLabels indicates whether the peer allows extra DNS labels to be used for resolving the peer
 	AllowExtraDNSLabels bool
+	// ManagedBySetupKeyOnly indicates that the peer was registered with a setup key that manages its settings.
+	// The peer can't be edited individually, but it can still be deleted
+	ManagedBySetupKeyOnly bool
+	// Attestation is the result of the platform attestation verified on registration, kept for audit
+	Attestation Attestation `gorm:"embedded;embeddedPrefix:attestation_"`
+	// FirewallOverrides are firewall rules scoped to this peer, layered on top of the policy derived rules
+	FirewallOverrides []FirewallOverride `gorm:"serializer:json"`
+	// ReportedErrors are the most recent errors and warnings reported by the client, oldest first
+	ReportedErrors []ReportedError `gorm:"serializer:json"`
+	// Unclaimed indicates that the peer was imported from another account with a placeholder key and that no client
+	// registered for it yet. The first client registering with the identity of the peer takes it over
+	Unclaimed bool `gorm:"default:false"`
 }
 
+// HandshakeStaleThreshold is the age after which the last WireGuard handshake of a connected peer is considered stale.
+// Clients report the handshake every 5 minutes and WireGuard renews it every 2 minutes on an active tunnel
+const HandshakeStaleThreshold = 15 * time.Minute
+
 type PeerStatus struct { //nolint:revive
 	// LastSeen is the last time peer was connected to the management service
 	LastSeen time.Time
@@ -66,22 +99,56 @@ type PeerStatus struct { //nolint:revive
 	LoginExpired bool
 	// RequiresApproval indicates whether peer requires approval or not
 	RequiresApproval bool
+	// LastHandshake is the most recent WireGuard handshake with any remote peer reported by the peer.
+	// Unlike Connected, it reflects the state of the data plane
+	LastHandshake time.Time
+	// PendingApprovalSince is the time the peer started requiring approval. Zero when the peer doesn't require approval
+	PendingApprovalSince time.Time
+	// UsageCapExceeded indicates that the peer transferred more data than the account usage cap allows and is marked
+	// for quarantine. It is reporting only, the peer isn't restricted
+	UsageCapExceeded bool
 }
 
 // Location is a geo location information of a Peer based on public connection IP
 type Location struct {
 	ConnectionIP net.IP `gorm:"serializer:json"` // from grpc peer or reverse proxy headers depends on setup
-	CountryCode  string
-	CityName     string
-	GeoNameID    uint // city level geoname id
+	// ConnectionPort is the source port observed on the gRPC connection, 0 when unknown (e.g. behind a reverse proxy)
+	ConnectionPort uint16
+	CountryCode    string
+	CityName       string
+	GeoNameID      uint // city level geoname id
+	// SubdivisionCode is the ISO 3166-2 code of the region, e.g. US-CA
+	SubdivisionCode string
+}
+
+// Attestation is the result of verifying the platform attestation (e.g. TPM quote or MDM token) provided by a peer on registration
+type Attestation struct {
+	// Verifier is the name of the verifier that checked the attestation. Empty when no attestation was verified
+	Verifier string
+	// Details is a verifier specific summary of the verified attestation
+	Details string
+	// VerifiedAt is the time the attestation was verified
+	VerifiedAt *time.Time
 }
 
+// MaxNetworkAddresses is the maximum number of local network addresses stored for a peer
+const MaxNetworkAddresses = 32
+
 // NetworkAddress is the IP address with network and MAC address of a network interface
 type NetworkAddress struct {
 	NetIP netip.Prefix `gorm:"serializer:json"`
 	Mac   string
 }
 
+// compareNetworkAddresses orders network addresses by MAC address and then by IP,
+// so interfaces with several addresses are always sorted the same way
+func compareNetworkAddresses(a, b NetworkAddress) int {
+	if a.Mac != b.Mac {
+		return strings.Compare(a.Mac, b.Mac)
+	}
+	return strings.Compare(a.NetIP.String(), b.NetIP.String())
+}
+
 // Environment is a system environment information
 type Environment struct {
 	Cloud    string
@@ -130,15 +197,13 @@ type PeerSystemMeta struct { //nolint:revive
 	Environment        Environment `gorm:"serializer:json"`
 	Flags              Flags       `gorm:"serializer:json"`
 	Files              []File      `gorm:"serializer:json"`
+	// RelayAddress is the address of the relay server instance the peer is currently connected to
+	RelayAddress string
 }
 
 func (p PeerSystemMeta) isEqual(other PeerSystemMeta) bool {
-	sort.Slice(p.NetworkAddresses, func(i, j int) bool {
-		return p.NetworkAddresses[i].Mac < p.NetworkAddresses[j].Mac
-	})
-	sort.Slice(other.NetworkAddresses, func(i, j int) bool {
-		return other.NetworkAddresses[i].Mac < other.NetworkAddresses[j].Mac
-	})
+	slices.SortFunc(p.NetworkAddresses, compareNetworkAddresses)
+	slices.SortFunc(other.NetworkAddresses, compareNetworkAddresses)
 	equalNetworkAddresses := slices.EqualFunc(p.NetworkAddresses, other.NetworkAddresses, func(addr NetworkAddress, oAddr NetworkAddress) bool {
 		return addr.Mac == oAddr.Mac && addr.NetIP == oAddr.NetIP
 	})
@@ -174,9 +239,17 @@ func (p PeerSystemMeta) isEqual(other PeerSystemMeta) bool {
 		p.SystemManufacturer == other.SystemManufacturer &&
 		p.Environment.Cloud == other.Environment.Cloud &&
 		p.Environment.Platform == other.Environment.Platform &&
+		p.RelayAddress == other.RelayAddress &&
 		p.Flags.isEqual(other.Flags)
 }
 
+// IsEqualIgnoringRelay reports whether the meta only differs from the other one by the relay address,
+// which changes often and doesn't affect the network map of the peer
+func (p PeerSystemMeta) IsEqualIgnoringRelay(other PeerSystemMeta) bool {
+	other.RelayAddress = p.RelayAddress
+	return p.isEqual(other)
+}
+
 func (p PeerSystemMeta) isEmpty() bool {
 	return p.Hostname == "" &&
 		p.GoOS == "" &&
@@ -215,27 +288,70 @@ func (p *Peer) Copy() *Peer {
 		IP:                          p.IP,
 		Meta:                        p.Meta,
 		Name:                        p.Name,
+		Description:                 p.Description,
+		AdminNotes:                  p.AdminNotes,
 		DNSLabel:                    p.DNSLabel,
 		Status:                      peerStatus,
 		UserID:                      p.UserID,
+		SetupKeyID:                  p.SetupKeyID,
+		OwnerEmail:                  p.OwnerEmail,
 		SSHKey:                      p.SSHKey,
 		SSHEnabled:                  p.SSHEnabled,
 		LoginExpirationEnabled:      p.LoginExpirationEnabled,
 		LastLogin:                   p.LastLogin,
 		CreatedAt:                   p.CreatedAt,
+		FirstConnectedAt:            p.FirstConnectedAt,
+		AppliedNetworkSerial:        p.AppliedNetworkSerial,
 		Ephemeral:                   p.Ephemeral,
 		Location:                    p.Location,
 		InactivityExpirationEnabled: p.InactivityExpirationEnabled,
 		ExtraDNSLabels:              slices.Clone(p.ExtraDNSLabels),
 		AllowExtraDNSLabels:         p.AllowExtraDNSLabels,
+		ManagedBySetupKeyOnly:       p.ManagedBySetupKeyOnly,
+		Attestation:                 p.Attestation,
+		FirewallOverrides:           slices.Clone(p.FirewallOverrides),
+		ReportedErrors:              slices.Clone(p.ReportedErrors),
+		Unclaimed:                   p.Unclaimed,
+	}
+}
+
+// EncryptSensitiveData encrypts the peer's sensitive fields (OwnerEmail) in place.
+func (p *Peer) EncryptSensitiveData(enc *crypt.FieldEncrypt) error {
+	if enc == nil || p.OwnerEmail == "" {
+		return nil
+	}
+
+	var err error
+	p.OwnerEmail, err = enc.Encrypt(p.OwnerEmail)
+	if err != nil {
+		return fmt.Errorf("encrypt owner email: %w", err)
+	}
+
+	return nil
+}
+
+// DecryptSensitiveData decrypts the peer's sensitive fields (OwnerEmail) in place.
+func (p *Peer) DecryptSensitiveData(enc *crypt.FieldEncrypt) error {
+	if enc == nil || p.OwnerEmail == "" {
+		return nil
+	}
+
+	var err error
+	p.OwnerEmail, err = enc.Decrypt(p.OwnerEmail)
+	if err != nil {
+		return fmt.Errorf("decrypt owner email: %w", err)
 	}
+
+	return nil
 }
 
-// UpdateMetaIfNew updates peer's system metadata if new information is provided
-// returns true if meta was updated, false otherwise
-func (p *Peer) UpdateMetaIfNew(meta PeerSystemMeta) (updated, versionChanged bool) {
+// UpdateMetaIfNew updates peer's system metadata if new information is provided.
+// Returns updated true if a significant meta field of the account changed (see IsSignificantMetaField), false otherwise.
+// insignificant is true when the meta was updated, but only fields that don't require a peer update changed,
+// so the caller only has to store it
+func (p *Peer) UpdateMetaIfNew(meta PeerSystemMeta, significantFields []string) (updated, versionChanged, insignificant bool) {
 	if meta.isEmpty() {
-		return updated, versionChanged
+		return updated, versionChanged, insignificant
 	}
 
 	versionChanged = p.Meta.WtVersion != meta.WtVersion
@@ -246,20 +362,28 @@ func (p *Peer) UpdateMetaIfNew(meta PeerSystemMeta) (updated, versionChanged boo
 	}
 
 	if p.Meta.isEqual(meta) {
-		return updated, versionChanged
+		return updated, versionChanged, insignificant
 	}
+	significantlyEqual := p.Meta.isSignificantlyEqual(meta, significantFields)
 	p.Meta = meta
+	if significantlyEqual {
+		insignificant = true
+		return updated, versionChanged, insignificant
+	}
 	updated = true
-	return updated, versionChanged
+	return updated, versionChanged, insignificant
 }
 
 // GetLastLogin returns the last login time of the peer.
+// A last login in the future comes from a skewed clock and is clamped to now
 func (p *Peer) GetLastLogin() time.Time {
-	if p.LastLogin != nil {
-		return *p.LastLogin
+	if p.LastLogin == nil {
+		return time.Time{}
 	}
-	return time.Time{}
-
+	if now := time.Now().UTC(); p.LastLogin.After(now) {
+		return now
+	}
+	return *p.LastLogin
 }
 
 // MarkLoginExpired marks peer's status expired or not
@@ -275,32 +399,30 @@ func (p *Peer) MarkLoginExpired(expired bool) {
 // SessionExpired indicates whether the peer's session has expired or not.
 // If Peer.LastLogin plus the expiresIn duration has happened already; then session has expired.
 // Return true if a session has expired, false otherwise, and time left to expiration (negative when expired).
+// The expiration is extended by the tolerance grace period of the account.
 // Session expiration can be disabled/enabled on a Peer level via Peer.LoginExpirationEnabled property.
 // Session expiration can also be disabled/enabled globally on the Account level via Settings.PeerLoginExpirationEnabled.
 // Only peers added by interactive SSO login can be expired.
-func (p *Peer) SessionExpired(expiresIn time.Duration) (bool, time.Duration) {
+func (p *Peer) SessionExpired(expiresIn, tolerance time.Duration) (bool, time.Duration) {
 	if !p.AddedWithSSOLogin() || !p.InactivityExpirationEnabled || p.Status.Connected {
 		return false, 0
 	}
-	expiresAt := p.Status.LastSeen.Add(expiresIn)
-	now := time.Now()
-	timeLeft := expiresAt.Sub(now)
+	timeLeft := expirationTimeLeft(p.Status.LastSeen, expiresIn, tolerance, time.Now())
 	return timeLeft <= 0, timeLeft
 }
 
 // LoginExpired indicates whether the peer's login has expired or not.
 // If Peer.LastLogin plus the expiresIn duration has happened already; then login has expired.
 // Return true if a login has expired, false otherwise, and time left to expiration (negative when expired).
+// The expiration is extended by the tolerance grace period of the account.
 // Login expiration can be disabled/enabled on a Peer level via Peer.LoginExpirationEnabled property.
 // Login expiration can also be disabled/enabled globally on the Account level via Settings.PeerLoginExpirationEnabled.
 // Only peers added by interactive SSO login can be expired.
-func (p *Peer) LoginExpired(expiresIn time.Duration) (bool, time.Duration) {
+func (p *Peer) LoginExpired(expiresIn, tolerance time.Duration) (bool, time.Duration) {
 	if !p.AddedWithSSOLogin() || !p.LoginExpirationEnabled {
 		return false, 0
 	}
-	expiresAt := p.GetLastLogin().Add(expiresIn)
-	now := time.Now()
-	timeLeft := expiresAt.Sub(now)
+	timeLeft := expirationTimeLeft(p.GetLastLogin(), expiresIn, tolerance, time.Now())
 	return timeLeft <= 0, timeLeft
 }
 
@@ -314,19 +436,56 @@ func (p *Peer) FQDN(dnsDomain string) string {
 
 // EventMeta returns activity event meta related to the peer
 func (p *Peer) EventMeta(dnsDomain string) map[string]any {
-	return map[string]any{"name": p.Name, "fqdn": p.FQDN(dnsDomain), "ip": p.IP, "created_at": p.CreatedAt,
+	return map[string]any{"name": p.Name, "description": p.Description, "fqdn": p.FQDN(dnsDomain), "ip": p.IP, "created_at": p.CreatedAt,
 		"location_city_name": p.Location.CityName, "location_country_code": p.Location.CountryCode,
-		"location_geo_name_id": p.Location.GeoNameID, "location_connection_ip": p.Location.ConnectionIP}
+		"location_subdivision_code": p.Location.SubdivisionCode, "location_geo_name_id": p.Location.GeoNameID,
+		"location_connection_ip": p.Location.ConnectionIP, "location_connection_port": p.Location.ConnectionPort}
 }
 
 // Copy PeerStatus
 func (p *PeerStatus) Copy() *PeerStatus {
 	return &PeerStatus{
-		LastSeen:         p.LastSeen,
-		Connected:        p.Connected,
-		LoginExpired:     p.LoginExpired,
-		RequiresApproval: p.RequiresApproval,
+		LastSeen:             p.LastSeen,
+		Connected:            p.Connected,
+		LoginExpired:         p.LoginExpired,
+		RequiresApproval:     p.RequiresApproval,
+		LastHandshake:        p.LastHandshake,
+		PendingApprovalSince: p.PendingApprovalSince,
+		UsageCapExceeded:     p.UsageCapExceeded,
+	}
+}
+
+// IsPendingApproval returns true if the peer waits for approval, either required by its setup key or by the
+// integrated validator
+func (p *PeerStatus) IsPendingApproval() bool {
+	if p == nil {
+		return false
+	}
+	return p.RequiresApproval || !p.PendingApprovalSince.IsZero()
+}
+
+// UpdatePendingApproval stamps PendingApprovalSince when the peer starts requiring approval and clears it once the peer
+// no longer requires it. Returns true if PendingApprovalSince changed
+func (p *PeerStatus) UpdatePendingApproval(pending bool, now time.Time) bool {
+	switch {
+	case pending && p.PendingApprovalSince.IsZero():
+		p.PendingApprovalSince = now
+		return true
+	case !pending && !p.PendingApprovalSince.IsZero():
+		p.PendingApprovalSince = time.Time{}
+		return true
+	default:
+		return false
+	}
+}
+
+// HasStaleHandshake returns true if the peer is connected to the management service but hasn't reported
+// a WireGuard handshake within HandshakeStaleThreshold. Peers that never reported a handshake aren't considered stale
+func (p *Peer) HasStaleHandshake(now time.Time) bool {
+	if p.Status == nil || !p.Status.Connected || p.Status.LastHandshake.IsZero() {
+		return false
 	}
+	return now.Sub(p.Status.LastHandshake) > HandshakeStaleThreshold
 }
 
 // UpdateLastLogin and set login expired false
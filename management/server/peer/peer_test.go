@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/netip"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -86,6 +87,48 @@ func TestIsEqual(t *testing.T) {
 	}
 }
 
+func TestIsEqual_NetworkAddressesSameMac(t *testing.T) {
+	meta1 := PeerSystemMeta{
+		NetworkAddresses: []NetworkAddress{
+			{NetIP: netip.MustParsePrefix("192.168.1.2/24"), Mac: "1"},
+			{NetIP: netip.MustParsePrefix("10.0.0.2/8"), Mac: "1"},
+		},
+	}
+	meta2 := PeerSystemMeta{
+		NetworkAddresses: []NetworkAddress{
+			{NetIP: netip.MustParsePrefix("10.0.0.2/8"), Mac: "1"},
+			{NetIP: netip.MustParsePrefix("192.168.1.2/24"), Mac: "1"},
+		},
+	}
+	require.True(t, meta1.isEqual(meta2), "addresses sharing a MAC should be compared regardless of order")
+
+	meta2.NetworkAddresses[0].NetIP = netip.MustParsePrefix("10.0.0.3/8")
+	require.False(t, meta1.isEqual(meta2), "a changed local network should be detected")
+}
+
+func TestUpdateMetaIfNew_RelayChange(t *testing.T) {
+	meta := PeerSystemMeta{Hostname: "peer", WtVersion: "0.60.0", RelayAddress: "rels://relay-eu.example.com:443"}
+	p := &Peer{Meta: meta}
+
+	updated, versionChanged, insignificant := p.UpdateMetaIfNew(meta, nil)
+	require.False(t, updated)
+	require.False(t, versionChanged)
+	require.False(t, insignificant)
+
+	moved := meta
+	moved.RelayAddress = "rels://relay-us.example.com:443"
+	require.True(t, meta.IsEqualIgnoringRelay(moved))
+
+	updated, versionChanged, insignificant = p.UpdateMetaIfNew(moved, nil)
+	require.True(t, updated, "a relay change should update the meta")
+	require.False(t, versionChanged)
+	require.False(t, insignificant)
+	require.Equal(t, moved.RelayAddress, p.Meta.RelayAddress)
+
+	moved.Hostname = "renamed"
+	require.False(t, meta.IsEqualIgnoringRelay(moved))
+}
+
 func TestFlags_IsEqual(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -141,3 +184,41 @@ func TestFlags_IsEqual(t *testing.T) {
 		})
 	}
 }
+
+func TestPeer_HasStaleHandshake(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		status *PeerStatus
+		expect bool
+	}{
+		{
+			name:   "recent handshake",
+			status: &PeerStatus{Connected: true, LastHandshake: now.Add(-time.Minute)},
+			expect: false,
+		},
+		{
+			name:   "old handshake",
+			status: &PeerStatus{Connected: true, LastHandshake: now.Add(-HandshakeStaleThreshold - time.Second)},
+			expect: true,
+		},
+		{
+			name:   "old handshake of a disconnected peer",
+			status: &PeerStatus{Connected: false, LastHandshake: now.Add(-time.Hour)},
+			expect: false,
+		},
+		{
+			name:   "no handshake reported",
+			status: &PeerStatus{Connected: true},
+			expect: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Peer{Status: tt.status}
+			require.Equal(t, tt.expect, p.HasStaleHandshake(now))
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package peer
+
+import (
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// ReportedErrorLevelError marks an error reported by the client
+	ReportedErrorLevelError = "error"
+	// ReportedErrorLevelWarning marks a warning reported by the client
+	ReportedErrorLevelWarning = "warning"
+
+	// MaxReportedErrors is the maximum number of reported errors stored for a peer, older ones are dropped
+	MaxReportedErrors = 5
+	// MaxReportedErrorMessageLength is the maximum length in bytes of a stored error message, longer ones are truncated
+	MaxReportedErrorMessageLength = 512
+)
+
+// ReportedError is an error or warning the client ran into, e.g. a route conflict, kept for troubleshooting
+type ReportedError struct {
+	// Time the client ran into the error
+	Time time.Time
+	// Level is either ReportedErrorLevelError or ReportedErrorLevelWarning
+	Level string
+	// Message describes the error
+	Message string
+}
+
+// MergeReportedErrors adds the reported errors to the stored ones and returns the most recent MaxReportedErrors of them,
+// oldest first. Clients resend their recent errors on every sync, so errors that are already stored are skipped.
+// Messages are truncated to MaxReportedErrorMessageLength
+func MergeReportedErrors(stored, reported []ReportedError) []ReportedError {
+	merged := slices.Clone(stored)
+	for _, reportedError := range reported {
+		reportedError.Message = truncateReportedErrorMessage(reportedError.Message)
+		reportedError.Time = reportedError.Time.UTC()
+		if !slices.ContainsFunc(merged, func(e ReportedError) bool {
+			return e.Time.Equal(reportedError.Time) && e.Message == reportedError.Message
+		}) {
+			merged = append(merged, reportedError)
+		}
+	}
+
+	slices.SortStableFunc(merged, func(a, b ReportedError) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	if len(merged) > MaxReportedErrors {
+		merged = merged[len(merged)-MaxReportedErrors:]
+	}
+	return merged
+}
+
+func truncateReportedErrorMessage(message string) string {
+	message = strings.TrimSpace(message)
+	if len(message) <= MaxReportedErrorMessageLength {
+		return message
+	}
+
+	message = message[:MaxReportedErrorMessageLength]
+	for !utf8.ValidString(message) {
+		message = message[:len(message)-1]
+	}
+	return message
+}
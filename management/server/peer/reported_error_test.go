@@ -0,0 +1,51 @@
+package peer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeReportedErrors(t *testing.T) {
+	now := time.Now().UTC()
+	reportedError := func(age time.Duration, message string) ReportedError {
+		return ReportedError{Time: now.Add(-age), Level: ReportedErrorLevelWarning, Message: message}
+	}
+
+	stored := []ReportedError{
+		reportedError(5*time.Minute, "route conflict for 10.0.0.0/24"),
+	}
+
+	t.Run("already stored errors are skipped", func(t *testing.T) {
+		merged := MergeReportedErrors(stored, []ReportedError{
+			reportedError(5*time.Minute, "route conflict for 10.0.0.0/24"),
+			reportedError(time.Minute, "dns server unreachable"),
+		})
+		require.Len(t, merged, 2)
+		assert.Equal(t, "route conflict for 10.0.0.0/24", merged[0].Message)
+		assert.Equal(t, "dns server unreachable", merged[1].Message)
+	})
+
+	t.Run("only the most recent errors are kept", func(t *testing.T) {
+		var reported []ReportedError
+		for i := 0; i < MaxReportedErrors+2; i++ {
+			reported = append(reported, reportedError(time.Duration(i)*time.Second, "error "+string(rune('a'+i))))
+		}
+		merged := MergeReportedErrors(stored, reported)
+		require.Len(t, merged, MaxReportedErrors)
+		assert.Equal(t, "error e", merged[0].Message, "the oldest errors should be dropped")
+		assert.Equal(t, "error a", merged[MaxReportedErrors-1].Message, "the newest error should be last")
+	})
+
+	t.Run("long messages are truncated", func(t *testing.T) {
+		merged := MergeReportedErrors(nil, []ReportedError{
+			reportedError(0, strings.Repeat("ä", MaxReportedErrorMessageLength)),
+		})
+		require.Len(t, merged, 1)
+		assert.LessOrEqual(t, len(merged[0].Message), MaxReportedErrorMessageLength)
+		assert.True(t, strings.HasPrefix(strings.Repeat("ä", MaxReportedErrorMessageLength), merged[0].Message))
+	})
+}
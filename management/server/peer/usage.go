@@ -0,0 +1,117 @@
+package peer
+
+import (
+	"time"
+)
+
+const (
+	// UsageRetention is how long the usage samples of a peer are kept. Usage can't be queried over a longer window
+	UsageRetention = 30 * 24 * time.Hour
+
+	// UsageRollupAge is the age from which the usage samples of a peer are rolled up into UsageRollupBucket samples.
+	// Usage windows reaching further back are only as precise as the bucket
+	UsageRollupAge = 24 * time.Hour
+	// UsageRollupBucket is the time span of the samples older than UsageRollupAge
+	UsageRollupBucket = time.Hour
+)
+
+// UsageSample is the data transferred by a peer over the WireGuard interface between two of its reports
+type UsageSample struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	AccountID string `gorm:"index"`
+	PeerID    string `gorm:"index:idx_peer_usage_samples_peer_time"`
+	// Timestamp is the time the peer reported the usage
+	Timestamp time.Time `gorm:"index:idx_peer_usage_samples_peer_time"`
+	// RxBytes and TxBytes are the bytes received and sent since the previous sample
+	RxBytes int64
+	TxBytes int64
+	// RxCounter and TxCounter are the cumulative counters reported by the peer, used to compute the next sample
+	RxCounter int64
+	TxCounter int64
+}
+
+// TableName returns the name of the table holding the usage samples
+func (UsageSample) TableName() string {
+	return "peer_usage_samples"
+}
+
+// NewUsageSample returns the sample for the cumulative counters reported by a peer, relative to its previous sample.
+// A counter lower than the previous one was reset, e.g. by a client restart, and counts in full. previous can be nil
+func NewUsageSample(previous *UsageSample, accountID, peerID string, rxCounter, txCounter int64, timestamp time.Time) *UsageSample {
+	sample := &UsageSample{
+		AccountID: accountID,
+		PeerID:    peerID,
+		Timestamp: timestamp,
+		RxBytes:   rxCounter,
+		TxBytes:   txCounter,
+		RxCounter: rxCounter,
+		TxCounter: txCounter,
+	}
+
+	if previous == nil {
+		return sample
+	}
+
+	if rxCounter >= previous.RxCounter {
+		sample.RxBytes = rxCounter - previous.RxCounter
+	}
+	if txCounter >= previous.TxCounter {
+		sample.TxBytes = txCounter - previous.TxCounter
+	}
+
+	return sample
+}
+
+// RollupUsageSamples merges the samples of a peer, sorted by time, that fall into the same bucket. A merged sample
+// sums the bytes of the bucket and takes the time and the counters of its latest sample, so the next sample of the
+// peer is still computed from the right counters. It returns the merged samples and the IDs of the samples they replace
+func RollupUsageSamples(samples []*UsageSample, bucket time.Duration) ([]*UsageSample, []uint) {
+	var merged []*UsageSample
+	var replaced []uint
+
+	for start := 0; start < len(samples); {
+		bucketStart := samples[start].Timestamp.Truncate(bucket)
+		end := start + 1
+		for end < len(samples) && samples[end].Timestamp.Truncate(bucket).Equal(bucketStart) {
+			end++
+		}
+
+		if end-start > 1 {
+			latest := samples[end-1]
+			rollup := &UsageSample{
+				AccountID: latest.AccountID,
+				PeerID:    latest.PeerID,
+				Timestamp: latest.Timestamp,
+				RxCounter: latest.RxCounter,
+				TxCounter: latest.TxCounter,
+			}
+			for _, sample := range samples[start:end] {
+				rollup.RxBytes += sample.RxBytes
+				rollup.TxBytes += sample.TxBytes
+				replaced = append(replaced, sample.ID)
+			}
+			merged = append(merged, rollup)
+		}
+
+		start = end
+	}
+
+	return merged, replaced
+}
+
+// Usage is the data transferred by a peer within a time window
+type Usage struct {
+	PeerID string
+	// Since is the start of the window, the window ends at the time the usage was requested
+	Since time.Time
+	// RxBytes and TxBytes are the bytes received and sent by the peer within the window
+	RxBytes int64
+	TxBytes int64
+	// CapExceeded indicates whether the peer exceeded the account usage cap and is marked for quarantine
+	CapExceeded bool
+}
+
+// Total returns the bytes transferred by the peer in both directions
+func (u *Usage) Total() int64 {
+	return u.RxBytes + u.TxBytes
+}
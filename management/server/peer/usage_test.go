@@ -0,0 +1,50 @@
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewUsageSample(t *testing.T) {
+	now := time.Now().UTC()
+
+	first := NewUsageSample(nil, "account", "peer", 100, 10, now)
+	assert.Equal(t, int64(100), first.RxBytes)
+	assert.Equal(t, int64(10), first.TxBytes)
+
+	next := NewUsageSample(first, "account", "peer", 150, 30, now.Add(time.Minute))
+	assert.Equal(t, int64(50), next.RxBytes)
+	assert.Equal(t, int64(20), next.TxBytes)
+	assert.Equal(t, int64(150), next.RxCounter)
+	assert.Equal(t, int64(30), next.TxCounter)
+
+	reset := NewUsageSample(next, "account", "peer", 40, 35, now.Add(2*time.Minute))
+	assert.Equal(t, int64(40), reset.RxBytes, "a reset counter must count in full")
+	assert.Equal(t, int64(5), reset.TxBytes)
+}
+
+func TestRollupUsageSamples(t *testing.T) {
+	bucketStart := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	samples := []*UsageSample{
+		{ID: 1, PeerID: "peer", Timestamp: bucketStart.Add(10 * time.Minute), RxBytes: 100, TxBytes: 10, RxCounter: 100, TxCounter: 10},
+		{ID: 2, PeerID: "peer", Timestamp: bucketStart.Add(20 * time.Minute), RxBytes: 50, TxBytes: 5, RxCounter: 150, TxCounter: 15},
+		{ID: 3, PeerID: "peer", Timestamp: bucketStart.Add(30 * time.Minute), RxBytes: 25, TxBytes: 1, RxCounter: 175, TxCounter: 16},
+		{ID: 4, PeerID: "peer", Timestamp: bucketStart.Add(70 * time.Minute), RxBytes: 5, TxBytes: 5, RxCounter: 180, TxCounter: 21},
+	}
+
+	merged, replaced := RollupUsageSamples(samples, time.Hour)
+	assert.Equal(t, []uint{1, 2, 3}, replaced, "a sample alone in its bucket is kept")
+	if assert.Len(t, merged, 1) {
+		assert.Equal(t, int64(175), merged[0].RxBytes)
+		assert.Equal(t, int64(16), merged[0].TxBytes)
+		assert.Equal(t, int64(175), merged[0].RxCounter, "the counters of the latest sample must be kept")
+		assert.Equal(t, samples[2].Timestamp, merged[0].Timestamp)
+		assert.Zero(t, merged[0].ID)
+	}
+
+	merged, replaced = RollupUsageSamples(samples[3:], time.Hour)
+	assert.Empty(t, merged)
+	assert.Empty(t, replaced)
+}
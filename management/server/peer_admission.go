@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/shared/management/status"
+)
+
+const defaultAddPeerQueueTimeout = 5 * time.Second
+
+// accountAdmissionSlots holds the in-flight slots of a single account
+type accountAdmissionSlots struct {
+	slots chan struct{}
+	// refs is the number of requests holding or waiting for a slot, the entry is dropped once it reaches zero
+	refs int
+}
+
+// peerAdmissionControl bounds the number of concurrent AddPeer operations per account, so that a burst of
+// registrations to one account queues up here instead of contending on the account store transactions.
+// Requests exceeding the limit wait for a free slot up to queueTimeout, or fail right away when it is zero.
+type peerAdmissionControl struct {
+	mu           sync.Mutex
+	maxInFlight  int
+	queueTimeout time.Duration
+	accounts     map[string]*accountAdmissionSlots
+	// depth is the number of requests currently waiting for a slot
+	depth atomic.Int64
+}
+
+func newPeerAdmissionControl(maxInFlight int, queueTimeout time.Duration) *peerAdmissionControl {
+	return &peerAdmissionControl{
+		maxInFlight:  maxInFlight,
+		queueTimeout: queueTimeout,
+		accounts:     make(map[string]*accountAdmissionSlots),
+	}
+}
+
+// newPeerAdmissionControlFromEnv creates the admission control configured with NB_ACCOUNT_ADD_PEER_CONCURRENCY and
+// NB_ACCOUNT_ADD_PEER_QUEUE_TIMEOUT. A concurrency of zero, the default, disables the limit.
+func newPeerAdmissionControlFromEnv(ctx context.Context) *peerAdmissionControl {
+	maxInFlightStr := os.Getenv("NB_ACCOUNT_ADD_PEER_CONCURRENCY")
+	maxInFlight, err := strconv.Atoi(maxInFlightStr)
+	if err != nil || maxInFlight < 0 {
+		if maxInFlightStr != "" {
+			log.WithContext(ctx).Warnf("failed to parse add peer concurrency %q, disabling the limit", maxInFlightStr)
+		}
+		maxInFlight = 0
+	}
+
+	queueTimeoutStr := os.Getenv("NB_ACCOUNT_ADD_PEER_QUEUE_TIMEOUT")
+	queueTimeout, err := time.ParseDuration(queueTimeoutStr)
+	if err != nil || queueTimeout < 0 {
+		if queueTimeoutStr != "" {
+			log.WithContext(ctx).Warnf("failed to parse add peer queue timeout %q, using default", queueTimeoutStr)
+		}
+		queueTimeout = defaultAddPeerQueueTimeout
+	}
+
+	if maxInFlight > 0 {
+		log.WithContext(ctx).Infof("set add peer concurrency per account to %d and queue timeout to %s", maxInFlight, queueTimeout)
+	}
+
+	return newPeerAdmissionControl(maxInFlight, queueTimeout)
+}
+
+// Depth returns the number of AddPeer requests currently waiting for a slot
+func (c *peerAdmissionControl) Depth() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.depth.Load()
+}
+
+// acquire takes an in-flight slot of the account and returns the function releasing it.
+// Returns status.TooManyRequests when no slot became free within the queue timeout or the context was done.
+func (c *peerAdmissionControl) acquire(ctx context.Context, accountID string) (func(), error) {
+	if c == nil || c.maxInFlight <= 0 {
+		return func() {}, nil
+	}
+
+	c.mu.Lock()
+	account, ok := c.accounts[accountID]
+	if !ok {
+		account = &accountAdmissionSlots{slots: make(chan struct{}, c.maxInFlight)}
+		c.accounts[accountID] = account
+	}
+	account.refs++
+	c.mu.Unlock()
+
+	select {
+	case account.slots <- struct{}{}:
+		return c.releaseFunc(accountID, account), nil
+	default:
+	}
+
+	if c.queueTimeout == 0 {
+		c.unref(accountID, account)
+		return nil, status.Errorf(status.TooManyRequests, "too many concurrent peer registrations for the account, please retry later")
+	}
+
+	c.depth.Add(1)
+	defer c.depth.Add(-1)
+
+	timer := time.NewTimer(c.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case account.slots <- struct{}{}:
+		return c.releaseFunc(accountID, account), nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	c.unref(accountID, account)
+	return nil, status.Errorf(status.TooManyRequests, "timed out waiting for a concurrent peer registration slot of the account, please retry later")
+}
+
+func (c *peerAdmissionControl) releaseFunc(accountID string, account *accountAdmissionSlots) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-account.slots
+			c.unref(accountID, account)
+		})
+	}
+}
+
+func (c *peerAdmissionControl) unref(accountID string, account *accountAdmissionSlots) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	account.refs--
+	if account.refs == 0 {
+		delete(c.accounts, accountID)
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/shared/management/status"
+)
+
+func TestPeerAdmissionControl_FastFail(t *testing.T) {
+	admission := newPeerAdmissionControl(1, 0)
+
+	release, err := admission.acquire(context.Background(), "account1")
+	require.NoError(t, err)
+
+	_, err = admission.acquire(context.Background(), "account1")
+	require.Error(t, err)
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.TooManyRequests, sErr.Type())
+
+	otherRelease, err := admission.acquire(context.Background(), "account2")
+	require.NoError(t, err, "the limit should be applied per account")
+	otherRelease()
+
+	release()
+	release()
+
+	release, err = admission.acquire(context.Background(), "account1")
+	require.NoError(t, err, "a released slot should be available again")
+	release()
+
+	assert.Empty(t, admission.accounts, "accounts without in-flight registrations should be dropped")
+}
+
+func TestPeerAdmissionControl_Queue(t *testing.T) {
+	admission := newPeerAdmissionControl(1, time.Minute)
+
+	release, err := admission.acquire(context.Background(), "account1")
+	require.NoError(t, err)
+
+	acquired := make(chan error, 1)
+	go func() {
+		queuedRelease, err := admission.acquire(context.Background(), "account1")
+		if err == nil {
+			queuedRelease()
+		}
+		acquired <- err
+	}()
+
+	require.Eventually(t, func() bool { return admission.Depth() == 1 }, time.Second, 10*time.Millisecond)
+
+	release()
+
+	select {
+	case err := <-acquired:
+		require.NoError(t, err, "the queued registration should get the released slot")
+	case <-time.After(time.Second):
+		t.Fatal("the queued registration didn't get the released slot")
+	}
+	assert.Equal(t, int64(0), admission.Depth())
+
+	release, err = admission.acquire(context.Background(), "account1")
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = admission.acquire(ctx, "account1")
+	require.Error(t, err, "the queued registration should give up when its context is done")
+	assert.Equal(t, int64(0), admission.Depth())
+}
+
+func TestPeerAdmissionControl_Disabled(t *testing.T) {
+	admission := newPeerAdmissionControl(0, 0)
+
+	for i := 0; i < 10; i++ {
+		_, err := admission.acquire(context.Background(), "account1")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int64(0), admission.Depth())
+}
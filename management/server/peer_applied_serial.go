@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// appliedSerialFlushInterval is how often the network map acknowledgements of the peers are written to the store
+	appliedSerialFlushInterval = 5 * time.Second
+	appliedSerialFlushJobID    = "peer-applied-serial-flush"
+)
+
+// appliedSerialBuffer collects the network map serials acknowledged by the peers, so that they are written to the
+// store in batches instead of with a read and a write per acknowledgement
+type appliedSerialBuffer struct {
+	mu      sync.Mutex
+	serials map[string]uint64
+}
+
+func newAppliedSerialBuffer() *appliedSerialBuffer {
+	return &appliedSerialBuffer{
+		serials: make(map[string]uint64),
+	}
+}
+
+// add records the serial acknowledged by the peer with the given WireGuard key, keeping the newest one
+func (b *appliedSerialBuffer) add(peerKey string, serial uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if serial > b.serials[peerKey] {
+		b.serials[peerKey] = serial
+	}
+}
+
+// get returns the serial acknowledged by the peer that wasn't written to the store yet, zero if there is none
+func (b *appliedSerialBuffer) get(peerKey string) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.serials[peerKey]
+}
+
+// take returns the buffered serials and empties the buffer
+func (b *appliedSerialBuffer) take() map[string]uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	serials := b.serials
+	b.serials = make(map[string]uint64)
+	return serials
+}
+
+// flushAppliedSerials writes the buffered network map acknowledgements to the store
+func (am *DefaultAccountManager) flushAppliedSerials(ctx context.Context) {
+	serials := am.appliedSerials.take()
+	if len(serials) == 0 {
+		return
+	}
+
+	if err := am.Store.SavePeerAppliedNetworkSerials(ctx, serials); err != nil {
+		log.WithContext(ctx).Warnf("failed to save the applied serials of %d peers: %v", len(serials), err)
+		// keep the serials for the next flush, unless a newer one was acknowledged in the meantime
+		for peerKey, serial := range serials {
+			am.appliedSerials.add(peerKey, serial)
+		}
+	}
+}
+
+// appliedSerialFlushJob periodically writes the buffered network map acknowledgements to the store
+func (am *DefaultAccountManager) appliedSerialFlushJob(ctx context.Context) func() (time.Duration, bool) {
+	return func() (time.Duration, bool) {
+		am.flushAppliedSerials(ctx)
+		return appliedSerialFlushInterval, true
+	}
+}
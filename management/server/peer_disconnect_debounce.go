@@ -0,0 +1,92 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// pendingPeerDisconnect is a disconnect waiting for the grace period of the account to pass
+type pendingPeerDisconnect struct {
+	timer *time.Timer
+	// committing is set once the grace period has passed and the disconnect is being committed
+	committing bool
+	// mu is held while the disconnect is committed, so that a reconnect waits for it instead of racing with it
+	mu sync.Mutex
+}
+
+// peerDisconnectDebouncer delays marking the peers as disconnected, so that a peer reconnecting within the grace
+// period keeps its connected status and the flaps of unstable connections don't cause status writes and updates
+type peerDisconnectDebouncer struct {
+	mu      sync.Mutex
+	pending map[string]*pendingPeerDisconnect
+}
+
+func newPeerDisconnectDebouncer() *peerDisconnectDebouncer {
+	return &peerDisconnectDebouncer{
+		pending: make(map[string]*pendingPeerDisconnect),
+	}
+}
+
+// schedule runs disconnect once the grace period has passed unless the peer reconnects in the meantime.
+// A disconnect already pending for the peer is replaced
+func (d *peerDisconnectDebouncer) schedule(peerKey string, gracePeriod time.Duration, disconnect func()) {
+	if d == nil {
+		disconnect()
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if existing, ok := d.pending[peerKey]; ok {
+		existing.timer.Stop()
+	}
+
+	entry := &pendingPeerDisconnect{}
+	entry.timer = time.AfterFunc(gracePeriod, func() {
+		d.mu.Lock()
+		if d.pending[peerKey] != entry {
+			d.mu.Unlock()
+			return
+		}
+		entry.committing = true
+		entry.mu.Lock()
+		d.mu.Unlock()
+
+		disconnect()
+
+		d.mu.Lock()
+		if d.pending[peerKey] == entry {
+			delete(d.pending, peerKey)
+		}
+		d.mu.Unlock()
+		entry.mu.Unlock()
+	})
+	d.pending[peerKey] = entry
+}
+
+// cancel drops the disconnect pending for the peer and returns true if the peer kept its connected status.
+// When the disconnect is being committed at the moment, cancel waits for it to finish and returns false
+func (d *peerDisconnectDebouncer) cancel(peerKey string) bool {
+	if d == nil {
+		return false
+	}
+
+	d.mu.Lock()
+	entry, ok := d.pending[peerKey]
+	if !ok {
+		d.mu.Unlock()
+		return false
+	}
+	entry.timer.Stop()
+	delete(d.pending, peerKey)
+	committing := entry.committing
+	d.mu.Unlock()
+
+	if committing {
+		entry.mu.Lock()
+		defer entry.mu.Unlock()
+		return false
+	}
+	return true
+}
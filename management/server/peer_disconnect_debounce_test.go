@@ -0,0 +1,52 @@
+package server
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerDisconnectDebouncer(t *testing.T) {
+	debouncer := newPeerDisconnectDebouncer()
+
+	var disconnects atomic.Int32
+	disconnect := func() { disconnects.Add(1) }
+
+	debouncer.schedule("peer1", 50*time.Millisecond, disconnect)
+	assert.True(t, debouncer.cancel("peer1"), "a reconnect within the grace period should drop the disconnect")
+	assert.False(t, debouncer.cancel("peer1"))
+
+	debouncer.schedule("peer1", 50*time.Millisecond, disconnect)
+	debouncer.schedule("peer1", 50*time.Millisecond, disconnect)
+	require.Eventually(t, func() bool { return disconnects.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), disconnects.Load(), "a rescheduled disconnect should be committed once")
+	assert.False(t, debouncer.cancel("peer1"), "a committed disconnect can't be dropped")
+	assert.Empty(t, debouncer.pending)
+}
+
+func TestPeerDisconnectDebouncer_CancelWaitsForCommit(t *testing.T) {
+	debouncer := newPeerDisconnectDebouncer()
+
+	committing := make(chan struct{})
+	release := make(chan struct{})
+	var committed atomic.Bool
+	debouncer.schedule("peer1", time.Millisecond, func() {
+		close(committing)
+		<-release
+		committed.Store(true)
+	})
+
+	<-committing
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+
+	assert.False(t, debouncer.cancel("peer1"))
+	assert.True(t, committed.Load(), "cancel should return once the disconnect being committed has finished")
+}
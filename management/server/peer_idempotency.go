@@ -0,0 +1,90 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// peerRegistrationTTL defines for how long a successful registration can be replayed with the same idempotency key
+const peerRegistrationTTL = 10 * time.Minute
+
+// peerRegistration is the outcome of a successful AddPeer call remembered under an idempotency key
+type peerRegistration struct {
+	accountID string
+	peerID    string
+	peerKey   string
+	expiresAt time.Time
+}
+
+// peerRegistrationCache keeps recently used AddPeer idempotency keys so that a client that timed out
+// mid-registration can retry and receive its original peer instead of a duplicate registration error.
+type peerRegistrationCache struct {
+	mu            sync.Mutex
+	ttl           time.Duration
+	registrations map[string]peerRegistration
+}
+
+func newPeerRegistrationCache(ttl time.Duration) *peerRegistrationCache {
+	return &peerRegistrationCache{
+		ttl:           ttl,
+		registrations: make(map[string]peerRegistration),
+	}
+}
+
+// get returns the registration stored under the key if it hasn't expired yet
+func (c *peerRegistrationCache) get(key string) (peerRegistration, bool) {
+	if c == nil || key == "" {
+		return peerRegistration{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reg, ok := c.registrations[key]
+	if !ok {
+		return peerRegistration{}, false
+	}
+
+	if time.Now().After(reg.expiresAt) {
+		delete(c.registrations, key)
+		return peerRegistration{}, false
+	}
+
+	return reg, true
+}
+
+// put remembers a successful registration under the key and drops expired entries
+func (c *peerRegistrationCache) put(key, accountID, peerID, peerKey string) {
+	if c == nil || key == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, reg := range c.registrations {
+		if now.After(reg.expiresAt) {
+			delete(c.registrations, k)
+		}
+	}
+
+	c.registrations[key] = peerRegistration{
+		accountID: accountID,
+		peerID:    peerID,
+		peerKey:   peerKey,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+// idempotencyCacheKey scopes the client provided idempotency key to the credential used for the registration,
+// so that the same key used with different setup keys or users never collides.
+func idempotencyCacheKey(idempotencyKey, encodedHashedSetupKey, userID string) string {
+	if idempotencyKey == "" {
+		return ""
+	}
+	if userID != "" {
+		return "user/" + userID + "/" + idempotencyKey
+	}
+	return "setupkey/" + encodedHashedSetupKey + "/" + idempotencyKey
+}
@@ -0,0 +1,604 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"github.com/netbirdio/netbird/management/server/activity"
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/management/server/permissions/modules"
+	"github.com/netbirdio/netbird/management/server/permissions/operations"
+	"github.com/netbirdio/netbird/management/server/store"
+	"github.com/netbirdio/netbird/management/server/types"
+	"github.com/netbirdio/netbird/shared/management/status"
+)
+
+// ExportAccountPeers returns a snapshot of the account peers that can be imported into another account.
+// Keys, IPs and attestation results are left out and ephemeral peers are skipped.
+func (am *DefaultAccountManager) ExportAccountPeers(ctx context.Context, accountID, userID string) (*types.PeersExport, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	peers, err := am.Store.GetAccountPeers(ctx, store.LockingStrengthNone, accountID, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := am.Store.GetAccountGroups(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	peerGroups := make(map[string][]string)
+	for _, group := range groups {
+		if group.IsGroupAll() {
+			continue
+		}
+		for _, peerID := range group.Peers {
+			peerGroups[peerID] = append(peerGroups[peerID], group.Name)
+		}
+	}
+
+	export := &types.PeersExport{
+		Version:    types.PeersExportVersion,
+		AccountID:  accountID,
+		ExportedAt: time.Now().UTC(),
+		Peers:      make([]*types.ExportedPeer, 0, len(peers)),
+	}
+
+	for _, peer := range peers {
+		if peer.Ephemeral {
+			continue
+		}
+
+		groupNames := peerGroups[peer.ID]
+		slices.Sort(groupNames)
+
+		export.Peers = append(export.Peers, &types.ExportedPeer{
+			ID:                          peer.ID,
+			Name:                        peer.Name,
+			Description:                 peer.Description,
+			DNSLabel:                    peer.DNSLabel,
+			ExtraDNSLabels:              peer.ExtraDNSLabels,
+			AllowExtraDNSLabels:         peer.AllowExtraDNSLabels,
+			UserID:                      peer.UserID,
+			Groups:                      groupNames,
+			Meta:                        peer.Meta,
+			SSHEnabled:                  peer.SSHEnabled,
+			LoginExpirationEnabled:      peer.LoginExpirationEnabled,
+			InactivityExpirationEnabled: peer.InactivityExpirationEnabled,
+			FirewallOverrides:           peer.FirewallOverrides,
+			CreatedAt:                   peer.CreatedAt,
+		})
+	}
+
+	slices.SortFunc(export.Peers, func(a, b *types.ExportedPeer) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return export, nil
+}
+
+// ImportAccountPeers recreates the exported peers in the account. Peers get IPs from the account network and keep
+// their names and DNS labels unless they are already taken. Groups are matched by name and created when missing.
+// The imported peers get a placeholder WireGuard key and are left unclaimed until the client registers again:
+// the first registration matching the exported identity of a peer takes it over, see claimImportedPeer.
+func (am *DefaultAccountManager) ImportAccountPeers(ctx context.Context, accountID, userID string, export *types.PeersExport) ([]*nbpeer.Peer, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Peers, operations.Create)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	if export == nil || export.Version != types.PeersExportVersion {
+		return nil, status.Errorf(status.InvalidArgument, "unsupported peers export version, expected %d", types.PeersExportVersion)
+	}
+
+	settings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	network, err := am.Store.GetAccountNetwork(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting network: %w", err)
+	}
+
+	users, err := am.Store.GetAccountUsers(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, err
+	}
+	accountUsers := make(map[string]struct{}, len(users))
+	for _, user := range users {
+		accountUsers[user.Id] = struct{}{}
+	}
+
+	groupIDs, err := am.prepareImportGroups(ctx, accountID, userID, export.Peers)
+	if err != nil {
+		return nil, err
+	}
+
+	dnsDomain := am.networkMapController.GetDNSDomain(settings)
+	importTime := time.Now().UTC()
+	imported := make([]*nbpeer.Peer, 0, len(export.Peers))
+	importedIDs := make([]string, 0, len(export.Peers))
+
+	for _, exported := range export.Peers {
+		if exported == nil {
+			continue
+		}
+
+		if err = nbpeer.ValidateFirewallOverrides(exported.FirewallOverrides); err != nil {
+			return imported, status.Errorf(status.InvalidArgument, "peer %s: %v", exported.Name, err)
+		}
+
+		if err = validatePeerExtraDNSLabels(settings, exported.ExtraDNSLabels); err != nil {
+			return imported, fmt.Errorf("peer %s: %w", exported.Name, err)
+		}
+
+		key, err := newPlaceholderPeerKey()
+		if err != nil {
+			return imported, err
+		}
+
+		peerUserID := exported.UserID
+		if _, ok := accountUsers[peerUserID]; !ok {
+			peerUserID = ""
+		}
+
+		peerGroupIDs := make([]string, 0, len(exported.Groups))
+		for _, name := range exported.Groups {
+			if id, ok := groupIDs[name]; ok {
+				peerGroupIDs = append(peerGroupIDs, id)
+			}
+		}
+
+		newPeer := &nbpeer.Peer{
+			ID:                          xid.New().String(),
+			AccountID:                   accountID,
+			Key:                         key,
+			Meta:                        exported.Meta,
+			Name:                        exported.Name,
+			Description:                 exported.Description,
+			UserID:                      peerUserID,
+			Status:                      &nbpeer.PeerStatus{Connected: false, LoginExpired: true, LastSeen: importTime},
+			Unclaimed:                   true,
+			SSHEnabled:                  exported.SSHEnabled,
+			LastLogin:                   &importTime,
+			CreatedAt:                   importTime,
+			LoginExpirationEnabled:      exported.LoginExpirationEnabled,
+			InactivityExpirationEnabled: exported.InactivityExpirationEnabled,
+			ExtraDNSLabels:              exported.ExtraDNSLabels,
+			AllowExtraDNSLabels:         exported.AllowExtraDNSLabels,
+			FirewallOverrides:           exported.FirewallOverrides,
+		}
+
+		newPeer = am.integratedPeerValidator.PreparePeer(ctx, accountID, newPeer, peerGroupIDs, settings.Extra, false)
+
+		if err = am.addImportedPeer(ctx, settings, network, newPeer, exported.DNSLabel, peerGroupIDs, nil); err != nil {
+			return imported, err
+		}
+
+		meta := newPeer.EventMeta(dnsDomain)
+		meta["source_account_id"] = export.AccountID
+		meta["source_peer_id"] = exported.ID
+		am.StoreEvent(ctx, userID, newPeer.ID, accountID, activity.PeerImported, meta)
+
+		imported = append(imported, newPeer)
+		importedIDs = append(importedIDs, newPeer.ID)
+	}
+
+	if len(importedIDs) > 0 {
+		if err = am.networkMapController.OnPeersAdded(ctx, accountID, importedIDs); err != nil {
+			log.WithContext(ctx).Errorf("failed to update network map cache for imported peers: %v", err)
+		}
+	}
+
+	return imported, nil
+}
+
+// newPlaceholderPeerKey returns the public key of a random WireGuard key pair for the peers imported from other
+// accounts. The private key is dropped, so no client can connect with it until the peer is claimed
+func newPlaceholderPeerKey() (string, error) {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate placeholder key: %w", err)
+	}
+	return key.PublicKey().String(), nil
+}
+
+// claimImportedPeer binds a registering client to the unclaimed imported peer matching its identity: the same hostname,
+// the same system serial number when it was exported, and the same owner for peers added with SSO login or a setup
+// key registration for the others. The peer takes the key and meta of the client and keeps its IP, name, DNS label
+// and groups. Returns nil when no unclaimed peer matches, in which case the client is registered as a new peer
+func (am *DefaultAccountManager) claimImportedPeer(ctx context.Context, accountID, encodedHashedKey, setupKeyID, userID string, peer *nbpeer.Peer) (*nbpeer.Peer, error) {
+	unclaimed, err := am.Store.GetUnclaimedPeers(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	index := slices.IndexFunc(unclaimed, func(p *nbpeer.Peer) bool {
+		return p.UserID == userID && p.Meta.Hostname == peer.Meta.Hostname &&
+			(p.Meta.SystemSerialNumber == "" || p.Meta.SystemSerialNumber == peer.Meta.SystemSerialNumber)
+	})
+	if index < 0 {
+		return nil, nil
+	}
+
+	var claimed *nbpeer.Peer
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		imported, err := transaction.GetPeerByID(ctx, store.LockingStrengthUpdate, accountID, unclaimed[index].ID)
+		if err != nil {
+			return err
+		}
+
+		// another client claimed the peer in the meantime
+		if !imported.Unclaimed {
+			return nil
+		}
+
+		claimTime := time.Now().UTC()
+		imported.Key = peer.Key
+		imported.Meta = peer.Meta
+		imported.SSHKey = peer.SSHKey
+		imported.Location = peer.Location
+		imported.SetupKeyID = setupKeyID
+		imported.Status = &nbpeer.PeerStatus{Connected: false, LastSeen: claimTime}
+		imported.LastLogin = &claimTime
+		imported.Unclaimed = false
+
+		if err = transaction.SavePeer(ctx, accountID, imported); err != nil {
+			return err
+		}
+
+		if userID != "" {
+			if err = transaction.SaveUserLastLogin(ctx, accountID, userID, claimTime); err != nil {
+				log.WithContext(ctx).Debugf("failed to update user last login: %v", err)
+			}
+		} else {
+			sk, err := transaction.GetSetupKeyBySecret(ctx, store.LockingStrengthUpdate, encodedHashedKey)
+			if err != nil {
+				return fmt.Errorf("failed to get setup key: %w", err)
+			}
+			if err = setupKeyRegistrationError(sk); err != nil {
+				return err
+			}
+			if err = transaction.IncrementSetupKeyUsage(ctx, setupKeyID); err != nil {
+				return fmt.Errorf("failed to increment setup key usage: %w", err)
+			}
+		}
+
+		claimed = imported
+		return transaction.IncrementNetworkSerial(ctx, accountID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claimed, nil
+}
+
+// prepareImportGroups returns the IDs of the account groups by name, creating the groups referenced
+// by the exported peers that don't exist in the account
+func (am *DefaultAccountManager) prepareImportGroups(ctx context.Context, accountID, userID string, peers []*types.ExportedPeer) (map[string]string, error) {
+	groups, err := am.Store.GetAccountGroups(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	groupIDs := make(map[string]string, len(groups))
+	for _, group := range groups {
+		if group.IsGroupAll() {
+			continue
+		}
+		groupIDs[group.Name] = group.ID
+	}
+
+	var newGroups []*types.Group
+	for _, peer := range peers {
+		if peer == nil {
+			continue
+		}
+		for _, name := range peer.Groups {
+			if _, ok := groupIDs[name]; ok || name == "" || name == "All" {
+				continue
+			}
+			group := &types.Group{
+				ID:        xid.New().String(),
+				AccountID: accountID,
+				Name:      name,
+				Issued:    types.GroupIssuedAPI,
+			}
+			groupIDs[name] = group.ID
+			newGroups = append(newGroups, group)
+		}
+	}
+
+	if len(newGroups) == 0 {
+		return groupIDs, nil
+	}
+
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Groups, operations.Create)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	if err = am.Store.CreateGroups(ctx, accountID, newGroups); err != nil {
+		return nil, err
+	}
+
+	for _, group := range newGroups {
+		am.StoreEvent(ctx, userID, group.ID, accountID, activity.GroupCreated, group.EventMeta())
+	}
+
+	return groupIDs, nil
+}
+
+// addImportedPeer stores the peer with a free IP of the network, keeping the DNS label when it isn't taken.
+// When set, beforeAdd runs in the transaction adding the peer, so its changes are rolled back with a failed add
+func (am *DefaultAccountManager) addImportedPeer(ctx context.Context, settings *types.Settings, network *types.Network, newPeer *nbpeer.Peer, dnsLabel string, groupIDs []string, beforeAdd func(transaction store.Store) error) error {
+	var err error
+
+	maxAttempts := 10
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var freeIP net.IP
+		var freeLabel string
+		useIPLabel := attempt > 1
+		if !useIPLabel {
+			if dnsLabel != "" {
+				freeLabel = types.TruncatePeerDNSLabel(dnsLabel, settings.GetPeerDNSLabelMaxLength())
+			} else {
+				freeLabel, err = getPeerDNSLabel(settings, newPeer.Name)
+				if err != nil {
+					return fmt.Errorf("failed to get free DNS label: %w", err)
+				}
+			}
+			useIPLabel, err = checkReservedDNSLabel(settings, freeLabel)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+			if beforeAdd != nil {
+				if err := beforeAdd(transaction); err != nil {
+					return err
+				}
+			}
+
+			freeIP, err = am.allocatePeerIP(ctx, transaction, newPeer.AccountID, network.Net)
+			if err != nil {
+				return fmt.Errorf("failed to get free IP: %w", err)
+			}
+			if useIPLabel {
+				freeLabel, err = getPeerIPDNSLabel(ctx, transaction, settings, newPeer.AccountID, freeIP, newPeer.Name)
+				if err != nil {
+					return fmt.Errorf("failed to get free DNS label: %w", err)
+				}
+			}
+			newPeer.DNSLabel = freeLabel
+			newPeer.IP = freeIP
+
+			if err := transaction.AddPeerToAccount(ctx, newPeer); err != nil {
+				return err
+			}
+
+			for _, groupID := range groupIDs {
+				if err := transaction.AddPeerToGroup(ctx, newPeer.AccountID, newPeer.ID, groupID); err != nil {
+					return err
+				}
+			}
+
+			if err := transaction.AddPeerToAllGroup(ctx, newPeer.AccountID, newPeer.ID); err != nil {
+				return fmt.Errorf("failed adding peer to All group: %w", err)
+			}
+
+			return transaction.IncrementNetworkSerial(ctx, newPeer.AccountID)
+		})
+		if err == nil {
+			return nil
+		}
+
+		if isUniqueConstraintError(err) {
+			log.WithContext(ctx).WithFields(log.Fields{"dns_label": freeLabel, "ip": freeIP}).Tracef("Failed to import peer in attempt %d, retrying: %v", attempt, err)
+			continue
+		}
+
+		return fmt.Errorf("failed to add imported peer to database: %w", err)
+	}
+
+	return fmt.Errorf("failed to add imported peer to database after %d attempts: %w", maxAttempts, err)
+}
+
+// TransferPeer moves the peer from the source account to the destination account. The peer is removed from the
+// source account with its group memberships and recreated in the destination account with a new IP, keeping its
+// WireGuard key, name, DNS label and meta, so the client connects to the destination account with its current key.
+// As users belong to a single account, a peer added with SSO login is owned by the user initiating the transfer when
+// they are a user of the destination account, or by the destination account owner. Its login is marked as expired,
+// so the new owner has to authenticate again before the peer joins the destination network.
+// The user initiating the transfer must be allowed to delete peers of the source account and to create peers in the
+// destination account.
+func (am *DefaultAccountManager) TransferPeer(ctx context.Context, srcAccountID, dstAccountID, peerID, userID string) (*nbpeer.Peer, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, srcAccountID, userID, modules.Peers, operations.Delete)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	allowed, err = am.permissionsManager.ValidateUserPermissions(ctx, dstAccountID, userID, modules.Peers, operations.Create)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	if srcAccountID == dstAccountID {
+		return nil, status.Errorf(status.InvalidArgument, "source and destination accounts must differ")
+	}
+
+	peer, err := am.Store.GetPeerByID(ctx, store.LockingStrengthNone, srcAccountID, peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	srcSettings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, srcAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	dstSettings, err := am.Store.GetAccountSettings(ctx, store.LockingStrengthNone, dstAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	dstNetwork, err := am.Store.GetAccountNetwork(ctx, store.LockingStrengthNone, dstAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting network: %w", err)
+	}
+
+	ownerID, err := am.getTransferredPeerOwner(ctx, dstAccountID, peer.UserID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	transferTime := time.Now().UTC()
+	newPeer := &nbpeer.Peer{
+		ID:                          xid.New().String(),
+		AccountID:                   dstAccountID,
+		Key:                         peer.Key,
+		Meta:                        peer.Meta,
+		Name:                        peer.Name,
+		Description:                 peer.Description,
+		UserID:                      ownerID,
+		Status:                      &nbpeer.PeerStatus{Connected: false, LoginExpired: ownerID != "", LastSeen: transferTime},
+		SSHEnabled:                  peer.SSHEnabled,
+		SSHKey:                      peer.SSHKey,
+		LastLogin:                   &transferTime,
+		CreatedAt:                   transferTime,
+		LoginExpirationEnabled:      peer.LoginExpirationEnabled,
+		InactivityExpirationEnabled: peer.InactivityExpirationEnabled,
+	}
+
+	newPeer = am.integratedPeerValidator.PreparePeer(ctx, dstAccountID, newPeer, nil, dstSettings.Extra, false)
+
+	var eventsToStore []func()
+
+	// the peer is removed in the transaction adding it to the destination account, so it never ends up in both
+	// accounts or in none of them
+	err = am.addImportedPeer(ctx, dstSettings, dstNetwork, newPeer, peer.DNSLabel, nil, func(transaction store.Store) error {
+		peer, err = transaction.GetPeerByID(ctx, store.LockingStrengthUpdate, srcAccountID, peerID)
+		if err != nil {
+			return err
+		}
+
+		if err = am.validatePeerTransfer(ctx, transaction, srcAccountID, peerID); err != nil {
+			return err
+		}
+
+		eventsToStore, err = deletePeers(ctx, am, transaction, srcAccountID, userID, []*nbpeer.Peer{peer}, srcSettings)
+		if err != nil {
+			return fmt.Errorf("failed to delete peer: %w", err)
+		}
+
+		return transaction.IncrementNetworkSerial(ctx, srcAccountID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, storeEvent := range eventsToStore {
+		storeEvent()
+	}
+
+	am.networkMapController.DisconnectPeers(ctx, srcAccountID, []string{peerID})
+	am.onPeersDeleted(ctx, srcSettings, srcAccountID, userID, []*nbpeer.Peer{peer})
+
+	outMeta := peer.EventMeta(am.networkMapController.GetDNSDomain(srcSettings))
+	outMeta["destination_account_id"] = dstAccountID
+	outMeta["destination_peer_id"] = newPeer.ID
+	am.StoreEvent(ctx, userID, peerID, srcAccountID, activity.PeerTransferredOut, outMeta)
+
+	inMeta := newPeer.EventMeta(am.networkMapController.GetDNSDomain(dstSettings))
+	inMeta["source_account_id"] = srcAccountID
+	inMeta["source_peer_id"] = peerID
+	am.StoreEvent(ctx, userID, newPeer.ID, dstAccountID, activity.PeerTransferredIn, inMeta)
+
+	if err = am.networkMapController.OnPeersAdded(ctx, dstAccountID, []string{newPeer.ID}); err != nil {
+		log.WithContext(ctx).Errorf("failed to update network map cache for transferred peer %s: %v", newPeer.ID, err)
+	}
+
+	return newPeer, nil
+}
+
+// getTransferredPeerOwner returns the owner of a peer transferred to the account. Peers added with a setup key stay
+// without owner. The other peers are owned by the user initiating the transfer when they are a regular user of the
+// account, or by the account owner
+func (am *DefaultAccountManager) getTransferredPeerOwner(ctx context.Context, accountID, ownerID, userID string) (string, error) {
+	if ownerID == "" {
+		return "", nil
+	}
+
+	user, err := am.Store.GetUserByUserID(ctx, store.LockingStrengthNone, userID)
+	if err != nil {
+		if s, ok := status.FromError(err); !ok || s.Type() != status.NotFound {
+			return "", err
+		}
+	}
+	if user != nil && user.AccountID == accountID && !user.IsServiceUser {
+		return user.Id, nil
+	}
+
+	owner, err := am.Store.GetAccountOwner(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get account owner: %w", err)
+	}
+	return owner.Id, nil
+}
+
+// validatePeerTransfer checks that the peer can be deleted and doesn't route traffic for the account
+func (am *DefaultAccountManager) validatePeerTransfer(ctx context.Context, transaction store.Store, accountID, peerID string) error {
+	if err := am.validatePeerDelete(ctx, transaction, accountID, peerID); err != nil {
+		return err
+	}
+
+	routes, err := transaction.GetAccountRoutes(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to get routes: %w", err)
+	}
+
+	peerGroupIDs, err := transaction.GetPeerGroupIDs(ctx, store.LockingStrengthNone, accountID, peerID)
+	if err != nil {
+		return fmt.Errorf("failed to get peer groups: %w", err)
+	}
+
+	for _, r := range routes {
+		if r.Peer == peerID || slices.ContainsFunc(r.PeerGroups, func(groupID string) bool {
+			return slices.Contains(peerGroupIDs, groupID)
+		}) {
+			return status.Errorf(status.PreconditionFailed, "peer is a routing peer of route: %s", r.ID)
+		}
+	}
+
+	return nil
+}
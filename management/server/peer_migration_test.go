@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/management/server/activity"
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/management/server/permissions"
+	"github.com/netbirdio/netbird/management/server/permissions/modules"
+	"github.com/netbirdio/netbird/management/server/permissions/operations"
+	"github.com/netbirdio/netbird/management/server/store"
+	"github.com/netbirdio/netbird/management/server/types"
+	"github.com/netbirdio/netbird/route"
+)
+
+func TestDefaultAccountManager_ExportImportAccountPeers(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	_, err = createAccount(manager, "source-account", "source-user", "source.com")
+	require.NoError(t, err)
+	_, err = createAccount(manager, "target-account", "target-user", "target.com")
+	require.NoError(t, err)
+
+	addPeer := func(hostname string) *nbpeer.Peer {
+		return addTestPeer(t, manager, "", "source-user", nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux", WtVersion: "0.40.0"})
+	}
+
+	server := addPeer("server")
+	laptop := addPeer("laptop")
+
+	require.NoError(t, manager.Store.CreateGroup(ctx, &types.Group{
+		ID:        "devs",
+		AccountID: "source-account",
+		Name:      "developers",
+	}))
+	require.NoError(t, manager.Store.AddPeerToGroup(ctx, "source-account", laptop.ID, "devs"))
+
+	_, err = manager.ExportAccountPeers(ctx, "source-account", "target-user")
+	require.Error(t, err, "user of another account must not export the peers")
+
+	export, err := manager.ExportAccountPeers(ctx, "source-account", "source-user")
+	require.NoError(t, err)
+	require.Len(t, export.Peers, 2)
+
+	data, err := json.Marshal(export)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), server.Key, "export must not contain the peer keys")
+
+	var decoded types.PeersExport
+	require.NoError(t, json.Unmarshal(data, &decoded))
+
+	manager.permissionsManager = denyPermission{manager.permissionsManager, modules.Groups, operations.Create}
+	_, err = manager.ImportAccountPeers(ctx, "target-account", "target-user", &decoded)
+	require.Error(t, err, "user without permission to create groups must not import peers into new groups")
+	manager.permissionsManager = manager.permissionsManager.(denyPermission).Manager
+
+	imported, err := manager.ImportAccountPeers(ctx, "target-account", "target-user", &decoded)
+	require.NoError(t, err)
+	require.Len(t, imported, 2)
+
+	network, err := manager.Store.GetAccountNetwork(ctx, store.LockingStrengthNone, "target-account")
+	require.NoError(t, err)
+
+	for _, peer := range imported {
+		assert.True(t, peer.Status.LoginExpired, "imported peer must be registered again")
+		assert.True(t, peer.Unclaimed)
+		assert.NotEqual(t, server.Key, peer.Key)
+		assert.NotEqual(t, laptop.Key, peer.Key)
+		assert.Empty(t, peer.UserID, "user doesn't exist in the target account")
+		assert.Equal(t, "0.40.0", peer.Meta.WtVersion)
+		assert.True(t, network.Net.Contains(peer.IP))
+	}
+
+	importedLaptop := imported[0]
+	if importedLaptop.Name != laptop.Name {
+		importedLaptop = imported[1]
+	}
+	assert.Equal(t, laptop.Name, importedLaptop.Name)
+	assert.Equal(t, laptop.DNSLabel, importedLaptop.DNSLabel)
+
+	groups, err := manager.Store.GetAccountGroups(ctx, store.LockingStrengthNone, "target-account")
+	require.NoError(t, err)
+	var developers *types.Group
+	for _, group := range groups {
+		if group.Name == "developers" {
+			developers = group
+		}
+	}
+	require.NotNil(t, developers, "missing group should be created in the target account")
+	assert.Equal(t, []string{importedLaptop.ID}, developers.Peers)
+
+	setupKey, err := manager.CreateSetupKey(ctx, "target-account", "key", types.SetupKeyReusable, time.Hour, nil, 999, "target-user", types.SetupKeyOptions{})
+	require.NoError(t, err)
+
+	claimed := addTestPeer(t, manager, setupKey.Key, "", nbpeer.PeerSystemMeta{Hostname: "laptop", GoOS: "linux", WtVersion: "0.41.0"})
+	assert.Equal(t, importedLaptop.ID, claimed.ID, "the registration matching the imported peer must claim it")
+	assert.NotEqual(t, importedLaptop.Key, claimed.Key)
+	assert.Equal(t, importedLaptop.IP.String(), claimed.IP.String())
+	assert.Equal(t, importedLaptop.DNSLabel, claimed.DNSLabel)
+	assert.Equal(t, "0.41.0", claimed.Meta.WtVersion)
+	assert.False(t, claimed.Unclaimed)
+	assert.False(t, claimed.Status.LoginExpired)
+
+	stored, err := manager.Store.GetPeerByPeerPubKey(ctx, store.LockingStrengthNone, claimed.Key)
+	require.NoError(t, err)
+	assert.Equal(t, importedLaptop.ID, stored.ID)
+	developers, err = manager.Store.GetGroupByID(ctx, store.LockingStrengthNone, "target-account", developers.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{importedLaptop.ID}, developers.Peers, "the claimed peer must keep its groups")
+
+	another := addTestPeer(t, manager, setupKey.Key, "", nbpeer.PeerSystemMeta{Hostname: "laptop", GoOS: "linux", WtVersion: "0.41.0"})
+	assert.NotEqual(t, importedLaptop.ID, another.ID, "an imported peer must only be claimed once")
+
+	reimported, err := manager.ImportAccountPeers(ctx, "target-account", "target-user", &decoded)
+	require.NoError(t, err)
+	require.Len(t, reimported, 2)
+	for _, peer := range reimported {
+		assert.NotEqual(t, importedLaptop.DNSLabel, peer.DNSLabel, "taken DNS labels must not be reused")
+	}
+
+	_, err = manager.ImportAccountPeers(ctx, "target-account", "target-user", &types.PeersExport{Version: 42})
+	require.Error(t, err)
+}
+
+// denyPermission is a permissions manager that doesn't allow one operation on a module to any user
+type denyPermission struct {
+	permissions.Manager
+	module    modules.Module
+	operation operations.Operation
+}
+
+func (d denyPermission) ValidateUserPermissions(ctx context.Context, accountID, userID string, module modules.Module, operation operations.Operation) (bool, error) {
+	if module == d.module && operation == d.operation {
+		return false, nil
+	}
+	return d.Manager.ValidateUserPermissions(ctx, accountID, userID, module, operation)
+}
+
+// allowInAccounts is a permissions manager that allows a user everything in the given accounts
+type allowInAccounts struct {
+	permissions.Manager
+	userID     string
+	accountIDs []string
+}
+
+func (a allowInAccounts) ValidateUserPermissions(ctx context.Context, accountID, userID string, module modules.Module, operation operations.Operation) (bool, error) {
+	if userID == a.userID && slices.Contains(a.accountIDs, accountID) {
+		return true, nil
+	}
+	return a.Manager.ValidateUserPermissions(ctx, accountID, userID, module, operation)
+}
+
+func TestDefaultAccountManager_TransferPeer(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	_, err = createAccount(manager, "source-account", "source-user", "source.com")
+	require.NoError(t, err)
+	_, err = createAccount(manager, "target-account", "target-user", "target.com")
+	require.NoError(t, err)
+
+	setupKey, err := manager.CreateSetupKey(ctx, "source-account", "key", types.SetupKeyReusable, time.Hour, nil, 999, "source-user", types.SetupKeyOptions{})
+	require.NoError(t, err)
+
+	addPeer := func(setupKey, userID, hostname string) *nbpeer.Peer {
+		return addTestPeer(t, manager, setupKey, userID, nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux", WtVersion: "0.40.0"})
+	}
+
+	laptop := addPeer("", "source-user", "laptop")
+	server := addPeer(setupKey.Key, "", "server")
+	router := addPeer("", "source-user", "router")
+
+	require.NoError(t, manager.Store.CreateGroup(ctx, &types.Group{
+		ID:        "devs",
+		AccountID: "source-account",
+		Name:      "developers",
+	}))
+	require.NoError(t, manager.Store.AddPeerToGroup(ctx, "source-account", laptop.ID, "devs"))
+
+	require.NoError(t, manager.Store.SaveRoute(ctx, &route.Route{
+		ID:        "route",
+		AccountID: "source-account",
+		Network:   netip.MustParsePrefix("10.10.0.0/16"),
+		NetID:     "office",
+		Peer:      router.ID,
+		Enabled:   true,
+		Groups:    []string{"devs"},
+	}))
+
+	_, err = manager.TransferPeer(ctx, "source-account", "target-account", laptop.ID, "source-user")
+	require.Error(t, err, "user of the source account must not add peers to another account")
+
+	_, err = manager.TransferPeer(ctx, "source-account", "target-account", laptop.ID, "target-user")
+	require.Error(t, err, "user of the target account must not remove peers of another account")
+
+	// the initiator administers both accounts
+	manager.permissionsManager = allowInAccounts{manager.permissionsManager, "target-user", []string{"source-account", "target-account"}}
+
+	_, err = manager.TransferPeer(ctx, "source-account", "target-account", router.ID, "target-user")
+	require.Error(t, err, "routing peer must not be transferred")
+	_, err = manager.Store.GetPeerByID(ctx, store.LockingStrengthNone, "source-account", router.ID)
+	require.NoError(t, err, "routing peer must stay in the source account")
+
+	transferred, err := manager.TransferPeer(ctx, "source-account", "target-account", laptop.ID, "target-user")
+	require.NoError(t, err)
+
+	_, err = manager.Store.GetPeerByID(ctx, store.LockingStrengthNone, "source-account", laptop.ID)
+	require.Error(t, err, "peer must be removed from the source account")
+
+	devs, err := manager.Store.GetGroupByID(ctx, store.LockingStrengthNone, "source-account", "devs")
+	require.NoError(t, err)
+	assert.Empty(t, devs.Peers)
+
+	network, err := manager.Store.GetAccountNetwork(ctx, store.LockingStrengthNone, "target-account")
+	require.NoError(t, err)
+
+	stored, err := manager.Store.GetPeerByPeerPubKey(ctx, store.LockingStrengthNone, laptop.Key)
+	require.NoError(t, err, "client must connect to the target account with its key")
+	assert.Equal(t, transferred.ID, stored.ID)
+	assert.Equal(t, "target-account", stored.AccountID)
+	assert.Equal(t, laptop.Name, stored.Name)
+	assert.Equal(t, laptop.DNSLabel, stored.DNSLabel)
+	assert.Equal(t, "0.40.0", stored.Meta.WtVersion)
+	assert.True(t, network.Net.Contains(stored.IP))
+	assert.Equal(t, "target-user", stored.UserID, "peer must be owned by a user of the target account")
+	assert.True(t, stored.Status.LoginExpired, "the new owner must authenticate the peer again")
+
+	transferred, err = manager.TransferPeer(ctx, "source-account", "target-account", server.ID, "target-user")
+	require.NoError(t, err)
+	assert.Equal(t, server.Key, transferred.Key)
+	assert.Empty(t, transferred.UserID, "peer added with a setup key must stay without owner")
+	assert.False(t, transferred.Status.LoginExpired)
+
+	hasEvent := func(accountID string, eventType activity.Activity) bool {
+		events, err := manager.eventStore.Get(ctx, accountID, 0, 100, false)
+		require.NoError(t, err)
+		for _, event := range events {
+			if event.Activity == eventType {
+				return true
+			}
+		}
+		return false
+	}
+	assert.Eventually(t, func() bool {
+		return hasEvent("source-account", activity.PeerTransferredOut) && hasEvent("target-account", activity.PeerTransferredIn)
+	}, time.Second, 10*time.Millisecond)
+}
@@ -4,17 +4,23 @@ import (
 	"context"
 	"crypto/sha256"
 	b64 "encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/netip"
 	"os"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
 	"time"
+	"unicode"
 
 	"github.com/golang/mock/gomock"
 	"github.com/rs/xid"
@@ -32,12 +38,18 @@ import (
 	ephemeral_manager "github.com/netbirdio/netbird/management/internals/modules/peers/ephemeral/manager"
 	"github.com/netbirdio/netbird/management/internals/server/config"
 	"github.com/netbirdio/netbird/management/internals/shared/grpc"
+	"github.com/netbirdio/netbird/management/server/geolocation"
 	"github.com/netbirdio/netbird/management/server/http/testing/testing_tools"
+	"github.com/netbirdio/netbird/management/server/idp"
 	"github.com/netbirdio/netbird/management/server/integrations/port_forwarding"
+	"github.com/netbirdio/netbird/management/server/integrations/webhook"
 	"github.com/netbirdio/netbird/management/server/job"
 	"github.com/netbirdio/netbird/management/server/permissions"
+	"github.com/netbirdio/netbird/management/server/permissions/modules"
+	"github.com/netbirdio/netbird/management/server/permissions/operations"
 	"github.com/netbirdio/netbird/management/server/settings"
 	"github.com/netbirdio/netbird/shared/management/status"
+	"github.com/netbirdio/netbird/util/crypt"
 
 	"github.com/netbirdio/netbird/management/server/util"
 
@@ -105,7 +117,7 @@ func TestPeer_LoginExpired(t *testing.T) {
 				UserID:                 userID,
 			}
 
-			expired, _ := peer.LoginExpired(c.accountSettings.PeerLoginExpiration)
+			expired, _ := peer.LoginExpired(c.accountSettings.PeerLoginExpiration, c.accountSettings.GetPeerExpirationTolerance())
 			assert.Equal(t, expired, c.expected)
 		})
 	}
@@ -167,7 +179,7 @@ func TestPeer_SessionExpired(t *testing.T) {
 				UserID:                      userID,
 			}
 
-			expired, _ := peer.SessionExpired(c.accountSettings.PeerInactivityExpiration)
+			expired, _ := peer.SessionExpired(c.accountSettings.PeerInactivityExpiration, c.accountSettings.GetPeerExpirationTolerance())
 			assert.Equal(t, expired, c.expected)
 		})
 	}
@@ -196,7 +208,7 @@ func testGetNetworkMapGeneral(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	setupKey, err := manager.CreateSetupKey(context.Background(), account.Id, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, userId, false, false)
+	setupKey, err := manager.CreateSetupKey(context.Background(), account.Id, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, userId, types.SetupKeyOptions{})
 	if err != nil {
 		t.Fatal("error creating setup key")
 		return
@@ -250,6 +262,11 @@ func testGetNetworkMapGeneral(t *testing.T) {
 			networkMap.Peers[0].Key,
 		)
 	}
+
+	stats, err := manager.GetPeerNetworkMapStats(context.Background(), peer1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, networkMap.Stats(), *stats)
+	assert.Equal(t, 1, stats.Peers)
 }
 
 func TestAccountManager_GetNetworkMapWithPolicy(t *testing.T) {
@@ -445,7 +462,7 @@ func TestAccountManager_GetPeerNetwork(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	setupKey, err := manager.CreateSetupKey(context.Background(), account.Id, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, userId, false, false)
+	setupKey, err := manager.CreateSetupKey(context.Background(), account.Id, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, userId, types.SetupKeyOptions{})
 	if err != nil {
 		t.Fatal("error creating setup key")
 		return
@@ -517,7 +534,7 @@ func TestDefaultAccountManager_GetPeer(t *testing.T) {
 	}
 
 	// two peers one added by a regular user and one with a setup key
-	setupKey, err := manager.CreateSetupKey(context.Background(), account.Id, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, adminUser, false, false)
+	setupKey, err := manager.CreateSetupKey(context.Background(), account.Id, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, adminUser, types.SetupKeyOptions{})
 	if err != nil {
 		t.Fatal("error creating setup key")
 		return
@@ -735,7 +752,7 @@ func TestDefaultAccountManager_GetPeers(t *testing.T) {
 				return
 			}
 
-			peers, err := manager.GetPeers(context.Background(), accountID, someUser, "", "")
+			peers, err := manager.GetPeers(context.Background(), accountID, someUser, store.PeerFilters{})
 			if err != nil {
 				t.Fatal(err)
 				return
@@ -748,6 +765,151 @@ func TestDefaultAccountManager_GetPeers(t *testing.T) {
 	}
 }
 
+func TestDefaultAccountManager_CountPeers(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "test_account"
+	adminUser := "account_creator"
+	someUser := "some_user"
+	account := newAccountWithId(context.Background(), accountID, adminUser, "", "", "", false)
+	account.Users[someUser] = &types.User{
+		Id:   someUser,
+		Role: types.UserRoleUser,
+	}
+	account.Policies = []*types.Policy{}
+	account.Settings.RegularUsersViewBlocked = false
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	var adminPeer *nbpeer.Peer
+	for i, userID := range []string{someUser, adminUser, adminUser} {
+		adminPeer = addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: fmt.Sprintf("count-peer-%d", i)})
+	}
+	require.NoError(t, manager.MarkPeerConnected(context.Background(), adminPeer.Key, true, nil, 0, accountID))
+
+	connected, persistent := true, false
+
+	count, err := manager.CountPeers(context.Background(), accountID, adminUser, store.PeerFilters{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	count, err = manager.CountPeers(context.Background(), accountID, adminUser, store.PeerFilters{Connected: &connected})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	count, err = manager.CountPeers(context.Background(), accountID, adminUser, store.PeerFilters{Name: "count-peer-1", Ephemeral: &persistent})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// without policies the regular user only sees its own peer
+	count, err = manager.CountPeers(context.Background(), accountID, someUser, store.PeerFilters{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	peers, err := manager.GetPeers(context.Background(), accountID, someUser, store.PeerFilters{})
+	require.NoError(t, err)
+	assert.Len(t, peers, count)
+
+	count, err = manager.CountPeers(context.Background(), accountID, someUser, store.PeerFilters{Connected: &connected})
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	account.Settings.RegularUsersViewBlocked = true
+	require.NoError(t, manager.Store.SaveAccountSettings(context.Background(), accountID, account.Settings))
+
+	count, err = manager.CountPeers(context.Background(), accountID, someUser, store.PeerFilters{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestDefaultAccountManager_CountPeers_ExcludeEphemeralPeersFromLimits(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	account, err := createAccount(manager, accountID, userID, "domain.com")
+	require.NoError(t, err)
+
+	for i, temporary := range []bool{false, false, true} {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+		_, _, _, err = manager.AddPeer(context.Background(), accountID, "", userID, &nbpeer.Peer{
+			Key:  key.PublicKey().String(),
+			Meta: nbpeer.PeerSystemMeta{Hostname: fmt.Sprintf("runner-%d", i)},
+		}, temporary)
+		require.NoError(t, err)
+	}
+
+	count, err := manager.CountPeers(context.Background(), accountID, userID, store.PeerFilters{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count, "ephemeral peers should be counted by default")
+
+	settings := account.Settings.Copy()
+	settings.ExcludeEphemeralPeersFromLimits = true
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, settings)
+	require.NoError(t, err)
+
+	count, err = manager.CountPeers(context.Background(), accountID, userID, store.PeerFilters{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "ephemeral peers should not be counted when excluded from limits")
+
+	ephemeral := true
+	count, err = manager.CountPeers(context.Background(), accountID, userID, store.PeerFilters{Ephemeral: &ephemeral})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "ephemeral peers should still be counted when asked for explicitly")
+
+	ev := getEvent(t, accountID, manager, activity.AccountEphemeralPeersExcludedFromLimits)
+	assert.Equal(t, accountID, ev.TargetID)
+}
+
+func TestDefaultAccountManager_AddPeer_PeerLimit(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	account, err := createAccount(manager, accountID, userID, "domain.com")
+	require.NoError(t, err)
+
+	settings := account.Settings.Copy()
+	settings.PeerLimit = 2
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, settings)
+	require.NoError(t, err)
+
+	addPeer := func(name string, temporary bool) error {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+		_, _, _, err = manager.AddPeer(context.Background(), accountID, "", userID, &nbpeer.Peer{
+			Key:  key.PublicKey().String(),
+			Meta: nbpeer.PeerSystemMeta{Hostname: name},
+		}, temporary)
+		return err
+	}
+
+	require.NoError(t, addPeer("peer-1", false))
+	require.NoError(t, addPeer("runner-1", true))
+
+	err = addPeer("peer-2", false)
+	require.Error(t, err, "the peer limit should include the ephemeral peers by default")
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.PreconditionFailed, sErr.Type())
+
+	settings.ExcludeEphemeralPeersFromLimits = true
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, settings)
+	require.NoError(t, err)
+
+	require.NoError(t, addPeer("peer-2", false), "ephemeral peers should not count towards the limit when excluded")
+	require.NoError(t, addPeer("runner-2", true), "ephemeral peers should not be limited when excluded")
+	require.Error(t, addPeer("peer-3", false), "persistent peers should still be limited")
+
+	ev := getEvent(t, accountID, manager, activity.AccountPeerLimitUpdated)
+	assert.Equal(t, 2, ev.Meta["new_limit"])
+
+	settings.PeerLimit = -1
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, settings)
+	require.Error(t, err, "a negative peer limit should be rejected")
+}
+
 func setupTestAccountManager(b testing.TB, peers int, groups int) (*DefaultAccountManager, *update_channel.PeersUpdateManager, string, string, error) {
 	b.Helper()
 
@@ -941,7 +1103,7 @@ func BenchmarkGetPeers(b *testing.B) {
 
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				_, err := manager.GetPeers(context.Background(), accountID, userID, "", "")
+				_, err := manager.GetPeers(context.Background(), accountID, userID, store.PeerFilters{})
 				if err != nil {
 					b.Fatalf("GetPeers failed: %v", err)
 				}
@@ -1180,7 +1342,7 @@ func TestToSyncResponse(t *testing.T) {
 	}
 	dnsCache := &cache.DNSConfigCache{}
 	accountSettings := &types.Settings{RoutingPeerDNSResolutionEnabled: true}
-	response := grpc.ToSyncResponse(context.Background(), config, config.HttpConfig, config.DeviceAuthorizationFlow, peer, turnRelayToken, turnRelayToken, networkMap, dnsName, checks, dnsCache, accountSettings, nil, []string{}, int64(dnsForwarderPort))
+	response := grpc.ToSyncResponse(context.Background(), config, config.HttpConfig, config.DeviceAuthorizationFlow, peer, turnRelayToken, turnRelayToken, networkMap, dnsName, checks, dnsCache, accountSettings, accountSettings.PeerLoginExpiration, nil, []string{}, int64(dnsForwarderPort))
 
 	assert.NotNil(t, response)
 	// assert peer config
@@ -1306,10 +1468,13 @@ func Test_RegisterPeerByUser(t *testing.T) {
 	_, err = s.GetAccount(context.Background(), existingAccountID)
 	require.NoError(t, err)
 
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
 	newPeer := &nbpeer.Peer{
 		ID:        xid.New().String(),
 		AccountID: existingAccountID,
-		Key:       "newPeerKey",
+		Key:       key.PublicKey().String(),
 		IP:        net.IP{123, 123, 123, 123},
 		Meta: nbpeer.PeerSystemMeta{
 			Hostname: "newPeer",
@@ -1441,10 +1606,13 @@ func Test_RegisterPeerBySetupKey(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
+			key, err := wgtypes.GeneratePrivateKey()
+			require.NoError(t, err)
+
 			currentPeer := &nbpeer.Peer{
 				ID:             xid.New().String(),
 				AccountID:      newPeerTemplate.AccountID,
-				Key:            "newPeerKey_" + xid.New().String(),
+				Key:            key.PublicKey().String(),
 				UserID:         newPeerTemplate.UserID,
 				IP:             newPeerTemplate.IP,
 				Meta:           newPeerTemplate.Meta,
@@ -1546,10 +1714,13 @@ func Test_RegisterPeerRollbackOnFailure(t *testing.T) {
 	_, err = s.GetAccount(context.Background(), existingAccountID)
 	require.NoError(t, err)
 
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
 	newPeer := &nbpeer.Peer{
 		ID:        xid.New().String(),
 		AccountID: existingAccountID,
-		Key:       "newPeerKey",
+		Key:       key.PublicKey().String(),
 		UserID:    "",
 		IP:        net.IP{123, 123, 123, 123},
 		Meta: nbpeer.PeerSystemMeta{
@@ -1679,7 +1850,9 @@ func Test_LoginPeer(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		currentWireGuardPubKey := "testPubKey_" + xid.New().String()
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+		currentWireGuardPubKey := key.PublicKey().String()
 
 		t.Run(tc.name, func(t *testing.T) {
 			upperKey := strings.ToUpper(tc.setupKey)
@@ -2234,7 +2407,7 @@ func Test_AddPeer(t *testing.T) {
 		return
 	}
 
-	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "test-key", types.SetupKeyReusable, time.Hour, nil, 10000, userID, false, false)
+	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "test-key", types.SetupKeyReusable, time.Hour, nil, 10000, userID, types.SetupKeyOptions{})
 	if err != nil {
 		t.Fatal("error creating setup key")
 		return
@@ -2251,15 +2424,21 @@ func Test_AddPeer(t *testing.T) {
 		go func(i int) {
 			defer wg.Done()
 
+			key, err := wgtypes.GeneratePrivateKey()
+			if err != nil {
+				errs <- err
+				return
+			}
+
 			newPeer := &nbpeer.Peer{
 				AccountID: accountID,
-				Key:       "key" + strconv.Itoa(i),
+				Key:       key.PublicKey().String(),
 				Meta:      nbpeer.PeerSystemMeta{Hostname: "peer" + strconv.Itoa(i), GoOS: "linux"},
 			}
 
 			<-start
 
-			_, _, _, err := manager.AddPeer(context.Background(), "", setupKey.Key, "", newPeer, false)
+			_, _, _, err = manager.AddPeer(context.Background(), "", setupKey.Key, "", newPeer, false)
 			if err != nil {
 				errs <- fmt.Errorf("AddPeer failed for peer %d: %w", i, err)
 				return
@@ -2489,3 +2668,3046 @@ func TestLoginPeer_ApprovedUserCanLogin(t *testing.T) {
 	_, _, _, err = manager.LoginPeer(context.Background(), login)
 	require.NoError(t, err, "Regular user should be able to login peers")
 }
+
+func TestDefaultAccountManager_UpdatePeer_Description(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	newPeer := &nbpeer.Peer{
+		Key:  key.PublicKey().String(),
+		Meta: nbpeer.PeerSystemMeta{Hostname: "test-peer", GoOS: "linux"},
+	}
+	addedPeer, _, _, err := manager.AddPeer(context.Background(), "", "", userID, newPeer, false)
+	require.NoError(t, err)
+
+	update := addedPeer.Copy()
+	update.Description = "office printer gateway"
+	updated, err := manager.UpdatePeer(context.Background(), accountID, userID, update)
+	require.NoError(t, err)
+	assert.Equal(t, "office printer gateway", updated.Description)
+	assert.Equal(t, addedPeer.Name, updated.Name, "name should not change when only the description is updated")
+
+	stored, err := manager.GetPeer(context.Background(), accountID, addedPeer.ID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "office printer gateway", stored.Description)
+
+	update = stored.Copy()
+	update.Description = strings.Repeat("a", maxPeerDescriptionLength+1)
+	_, err = manager.UpdatePeer(context.Background(), accountID, userID, update)
+	require.Error(t, err)
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.InvalidArgument, sErr.Type())
+}
+
+func TestDefaultAccountManager_UpdatePeerAdminNotes(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+
+	_, err = createAccount(manager, accountID, userID, "domain.com")
+	require.NoError(t, err)
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	newPeer := &nbpeer.Peer{
+		Key:  key.PublicKey().String(),
+		Meta: nbpeer.PeerSystemMeta{Hostname: "test-peer", GoOS: "linux"},
+	}
+	addedPeer, _, _, err := manager.AddPeer(context.Background(), "", "", userID, newPeer, false)
+	require.NoError(t, err)
+
+	network, err := manager.Store.GetAccountNetwork(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err)
+
+	updated, err := manager.UpdatePeerAdminNotes(context.Background(), accountID, userID, addedPeer.ID, "replaced the disk")
+	require.NoError(t, err)
+	assert.Equal(t, "replaced the disk", updated.AdminNotes)
+
+	stored, err := manager.GetPeer(context.Background(), accountID, addedPeer.ID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "replaced the disk", stored.AdminNotes)
+	assert.Equal(t, addedPeer.Description, stored.Description, "description should not change with the admin notes")
+
+	networkAfter, err := manager.Store.GetAccountNetwork(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, network.Serial, networkAfter.Serial, "admin notes should not change the network serial")
+
+	event := getEvent(t, accountID, manager, activity.PeerAdminNotesChanged)
+	assert.Equal(t, addedPeer.ID, event.TargetID)
+	assert.Equal(t, "replaced the disk", event.Meta["admin_notes"])
+
+	_, err = manager.UpdatePeerAdminNotes(context.Background(), accountID, userID, addedPeer.ID, strings.Repeat("a", maxPeerAdminNotesLength+1))
+	require.Error(t, err)
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.InvalidArgument, sErr.Type())
+
+	regularUser := types.NewRegularUser("regular-user", "", "")
+	regularUser.AccountID = accountID
+	err = manager.Store.SaveUser(context.Background(), regularUser)
+	require.NoError(t, err)
+
+	_, err = manager.UpdatePeerAdminNotes(context.Background(), accountID, regularUser.Id, addedPeer.ID, "not allowed")
+	require.Error(t, err)
+	sErr, ok = status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.PermissionDenied, sErr.Type())
+}
+
+func TestDefaultAccountManager_ReservedDNSLabels(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+
+	_, err = createAccount(manager, accountID, userID, "domain.com")
+	require.NoError(t, err)
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration: time.Hour,
+		ReservedDNSLabels:   []string{"Gateway"},
+		Extra:               &types.ExtraSettings{},
+	})
+	require.Error(t, err, "reserved labels must be lowercase")
+
+	settings, err := manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration: time.Hour,
+		ReservedDNSLabels:   []string{"gateway", "dns"},
+		Extra:               &types.ExtraSettings{},
+	})
+	require.NoError(t, err)
+
+	addPeer := func(hostname string) (*nbpeer.Peer, error) {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+		peer, _, _, err := manager.AddPeer(context.Background(), "", "", userID, &nbpeer.Peer{
+			Key:  key.PublicKey().String(),
+			Meta: nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"},
+		}, false)
+		return peer, err
+	}
+
+	t.Run("reserved label gets a suffix", func(t *testing.T) {
+		peer, err := addPeer("Gateway")
+		require.NoError(t, err)
+		assert.NotEqual(t, "gateway", peer.DNSLabel)
+		assert.True(t, strings.HasPrefix(peer.DNSLabel, "gateway-"), "unexpected label %s", peer.DNSLabel)
+
+		other, err := addPeer("office")
+		require.NoError(t, err)
+		assert.Equal(t, "office", other.DNSLabel)
+
+		update := other.Copy()
+		update.Name = "dns"
+		updated, err := manager.UpdatePeer(context.Background(), accountID, userID, update)
+		require.NoError(t, err)
+		assert.Equal(t, "dns", updated.Name)
+		assert.True(t, strings.HasPrefix(updated.DNSLabel, "dns-"), "unexpected label %s", updated.DNSLabel)
+	})
+
+	settings.ReservedDNSLabelAction = types.ReservedDNSLabelActionReject
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, settings)
+	require.NoError(t, err)
+
+	t.Run("reserved label is rejected", func(t *testing.T) {
+		_, err := addPeer("gateway")
+		require.Error(t, err)
+		sErr, ok := status.FromError(err)
+		require.True(t, ok)
+		assert.Equal(t, status.InvalidArgument, sErr.Type())
+
+		peer, err := addPeer("printer")
+		require.NoError(t, err)
+		assert.Equal(t, "printer", peer.DNSLabel)
+
+		update := peer.Copy()
+		update.Name = "gateway"
+		_, err = manager.UpdatePeer(context.Background(), accountID, userID, update)
+		require.Error(t, err)
+		sErr, ok = status.FromError(err)
+		require.True(t, ok)
+		assert.Equal(t, status.InvalidArgument, sErr.Type())
+	})
+}
+
+func TestDefaultAccountManager_RegistrationFrozen(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+
+	_, err = createAccount(manager, accountID, userID, "domain.com")
+	require.NoError(t, err)
+
+	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{})
+	require.NoError(t, err)
+
+	newPeer := func() *nbpeer.Peer {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+		return &nbpeer.Peer{
+			Key:  key.PublicKey().String(),
+			Meta: nbpeer.PeerSystemMeta{Hostname: "test-peer", GoOS: "linux"},
+		}
+	}
+
+	existingPeer, _, _, err := manager.AddPeer(context.Background(), "", setupKey.Key, "", newPeer(), false)
+	require.NoError(t, err)
+
+	settings, err := manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration: time.Hour,
+		RegistrationFrozen:  true,
+		Extra:               &types.ExtraSettings{},
+	})
+	require.NoError(t, err)
+	getEvent(t, accountID, manager, activity.AccountRegistrationFrozen)
+
+	_, _, _, err = manager.AddPeer(context.Background(), "", setupKey.Key, "", newPeer(), false)
+	require.Error(t, err)
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.PreconditionFailed, sErr.Type(), "setup key registration must be rejected")
+
+	_, _, _, err = manager.AddPeer(context.Background(), "", "", userID, newPeer(), false)
+	require.Error(t, err)
+	sErr, ok = status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.PreconditionFailed, sErr.Type(), "user registration must be rejected")
+
+	_, _, _, _, err = manager.SyncPeer(context.Background(), types.PeerSync{WireGuardPubKey: existingPeer.Key, Meta: existingPeer.Meta}, accountID)
+	require.NoError(t, err, "existing peers must keep syncing")
+
+	_, _, _, err = manager.LoginPeer(context.Background(), types.PeerLogin{
+		WireGuardPubKey: existingPeer.Key,
+		Meta:            existingPeer.Meta,
+		SetupKey:        setupKey.Key,
+	})
+	require.NoError(t, err, "existing peers must keep logging in")
+
+	settings.RegistrationFrozen = false
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, settings)
+	require.NoError(t, err)
+	getEvent(t, accountID, manager, activity.AccountRegistrationUnfrozen)
+
+	_, _, _, err = manager.AddPeer(context.Background(), "", setupKey.Key, "", newPeer(), false)
+	require.NoError(t, err)
+}
+
+func TestDefaultAccountManager_AddPeer_ExpirationDefaults(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+
+	_, err = createAccount(manager, accountID, userID, "domain.com")
+	require.NoError(t, err)
+
+	newPeer := func() *nbpeer.Peer {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+		return &nbpeer.Peer{
+			Key:  key.PublicKey().String(),
+			Meta: nbpeer.PeerSystemMeta{Hostname: "test-peer", GoOS: "linux"},
+		}
+	}
+
+	loginExpiration := &types.PeerExpirationDefaults{LoginExpirationEnabled: true}
+	_, err = manager.CreateSetupKey(context.Background(), accountID, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{PeerExpiration: loginExpiration})
+	require.Error(t, err, "setup key peers must not expire unless the account allows it")
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration:            time.Hour,
+		SetupKeyPeerExpirationDefaults: loginExpiration,
+		Extra:                          &types.ExtraSettings{},
+	})
+	require.Error(t, err, "setup key peer defaults must not enable the expiration unless the account allows it")
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration:           time.Hour,
+		UserPeerExpirationDefaults:    &types.PeerExpirationDefaults{},
+		SetupKeyPeerExpirationAllowed: true,
+		Extra:                         &types.ExtraSettings{},
+	})
+	require.NoError(t, err)
+	getEvent(t, accountID, manager, activity.AccountPeerExpirationDefaultsUpdated)
+
+	plainKey, err := manager.CreateSetupKey(context.Background(), accountID, "plain-key", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{})
+	require.NoError(t, err)
+	expiringKey, err := manager.CreateSetupKey(context.Background(), accountID, "expiring-key", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{PeerExpiration: loginExpiration})
+	require.NoError(t, err)
+
+	userPeer, _, _, err := manager.AddPeer(context.Background(), "", "", userID, newPeer(), false)
+	require.NoError(t, err)
+	assert.False(t, userPeer.LoginExpirationEnabled, "user peers should get the user peer defaults of the account")
+	assert.False(t, userPeer.InactivityExpirationEnabled)
+
+	plainPeer, _, _, err := manager.AddPeer(context.Background(), "", plainKey.Key, "", newPeer(), false)
+	require.NoError(t, err)
+	assert.False(t, plainPeer.LoginExpirationEnabled, "setup key peers shouldn't expire by default")
+	assert.False(t, plainPeer.InactivityExpirationEnabled)
+
+	expiringPeer, _, _, err := manager.AddPeer(context.Background(), "", expiringKey.Key, "", newPeer(), false)
+	require.NoError(t, err)
+	assert.True(t, expiringPeer.LoginExpirationEnabled, "setup key peers should get the override of the key")
+	assert.False(t, expiringPeer.InactivityExpirationEnabled)
+}
+
+func TestDefaultAccountManager_AddPeer_IdempotencyKey(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "test-key", types.SetupKeyReusable, time.Hour, nil, 0, userID, types.SetupKeyOptions{})
+	require.NoError(t, err)
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	newPeer := &nbpeer.Peer{
+		Key:  key.PublicKey().String(),
+		Meta: nbpeer.PeerSystemMeta{Hostname: "test-peer", GoOS: "linux"},
+	}
+
+	added, _, _, err := manager.addPeer(context.Background(), "", setupKey.Key, "", newPeer, false, addPeerOptions{idempotencyKey: "retry-key"})
+	require.NoError(t, err)
+
+	_, _, _, err = manager.AddPeer(context.Background(), "", setupKey.Key, "", newPeer, false)
+	require.Error(t, err, "registration without idempotency key should be rejected as duplicate")
+
+	replayed, _, _, err := manager.addPeer(context.Background(), "", setupKey.Key, "", newPeer, false, addPeerOptions{idempotencyKey: "retry-key"})
+	require.NoError(t, err, "retry with the same idempotency key should return the original peer")
+	assert.Equal(t, added.ID, replayed.ID)
+
+	otherKey, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	otherPeer := &nbpeer.Peer{
+		Key:  otherKey.PublicKey().String(),
+		Meta: nbpeer.PeerSystemMeta{Hostname: "other-peer", GoOS: "linux"},
+	}
+	_, _, _, err = manager.addPeer(context.Background(), "", setupKey.Key, "", otherPeer, false, addPeerOptions{idempotencyKey: "retry-key"})
+	require.Error(t, err)
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.PreconditionFailed, sErr.Type())
+
+	peers, err := manager.Store.GetAccountPeers(context.Background(), store.LockingStrengthNone, accountID, "", "", nil)
+	require.NoError(t, err)
+	assert.Len(t, peers, 1)
+
+	usedKey, err := manager.Store.GetSetupKeyByID(context.Background(), store.LockingStrengthNone, accountID, setupKey.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, usedKey.UsedTimes, "replayed registration should not consume the setup key again")
+}
+
+func TestDefaultAccountManager_AddPeer_RequestedGroups(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	adminUser := "testuser"
+	regularUser := "regular_user"
+
+	account := newAccountWithId(context.Background(), accountID, adminUser, "domain.com", "", "", false)
+	account.Users[regularUser] = &types.User{Id: regularUser, AccountID: accountID, Role: types.UserRoleUser}
+	account.Groups["auto-group"] = &types.Group{ID: "auto-group", AccountID: accountID, Name: "auto", Issued: types.GroupIssuedAPI}
+	account.Groups["extra-group"] = &types.Group{ID: "extra-group", AccountID: accountID, Name: "extra", Issued: types.GroupIssuedAPI}
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	allGroup, err := manager.Store.GetGroupByName(context.Background(), store.LockingStrengthNone, accountID, "All")
+	require.NoError(t, err)
+
+	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "test-key", types.SetupKeyReusable, time.Hour, []string{"auto-group"}, 0, adminUser, types.SetupKeyOptions{})
+	require.NoError(t, err)
+
+	newPeer := func(hostname string) *nbpeer.Peer {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+		return &nbpeer.Peer{Key: key.PublicKey().String(), Meta: nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"}}
+	}
+
+	for _, requested := range [][]string{{"missing-group"}, {allGroup.ID}} {
+		_, _, _, err = manager.addPeer(context.Background(), "", "", adminUser, newPeer("invalid"), false, addPeerOptions{requestedGroups: requested})
+		require.Error(t, err)
+		sErr, ok := status.FromError(err)
+		require.True(t, ok)
+		assert.Equal(t, status.InvalidArgument, sErr.Type())
+	}
+
+	_, _, _, err = manager.addPeer(context.Background(), "", "", regularUser, newPeer("regular"), false, addPeerOptions{requestedGroups: []string{"extra-group"}})
+	require.Error(t, err, "regular users must not be able to assign groups to their peers")
+
+	_, _, _, err = manager.addPeer(context.Background(), "", setupKey.Key, "", newPeer("unlisted"), false, addPeerOptions{requestedGroups: []string{"extra-group"}})
+	require.Error(t, err, "a setup key without requestable groups must reject requested groups")
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.PermissionDenied, sErr.Type())
+
+	manager.permissionsManager = denyPermission{manager.permissionsManager, modules.Groups, operations.Update}
+	_, err = manager.SaveSetupKey(context.Background(), accountID, &types.SetupKey{Id: setupKey.Id, AutoGroups: []string{"auto-group"}, RequestableGroups: []string{"extra-group"}}, adminUser)
+	require.Error(t, err, "users that can't assign groups must not be able to make them requestable")
+	manager.permissionsManager = manager.permissionsManager.(denyPermission).Manager
+	_, err = manager.SaveSetupKey(context.Background(), accountID, &types.SetupKey{Id: setupKey.Id, AutoGroups: []string{"auto-group"}, RequestableGroups: []string{allGroup.ID}}, adminUser)
+	require.Error(t, err, "the All group can't be requestable")
+	_, err = manager.SaveSetupKey(context.Background(), accountID, &types.SetupKey{Id: setupKey.Id, AutoGroups: []string{"auto-group"}, RequestableGroups: []string{"extra-group"}}, adminUser)
+	require.NoError(t, err)
+
+	manager.permissionsManager = denyPermission{manager.permissionsManager, modules.Groups, operations.Update}
+	_, err = manager.CreateSetupKey(context.Background(), accountID, "requestable-key", types.SetupKeyReusable, time.Hour, nil, 0, adminUser, types.SetupKeyOptions{RequestableGroups: []string{"extra-group"}})
+	require.Error(t, err, "users that can't assign groups must not be able to create a key with requestable groups")
+	manager.permissionsManager = manager.permissionsManager.(denyPermission).Manager
+	_, err = manager.CreateSetupKey(context.Background(), accountID, "requestable-key", types.SetupKeyReusable, time.Hour, nil, 0, adminUser, types.SetupKeyOptions{RequestableGroups: []string{"missing-group"}})
+	require.Error(t, err, "unknown groups can't be requestable")
+	requestableKey, err := manager.CreateSetupKey(context.Background(), accountID, "requestable-key", types.SetupKeyReusable, time.Hour, nil, 0, adminUser, types.SetupKeyOptions{RequestableGroups: []string{"extra-group"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"extra-group"}, requestableKey.RequestableGroups)
+
+	peers, err := manager.Store.GetAccountPeers(context.Background(), store.LockingStrengthNone, accountID, "", "", nil)
+	require.NoError(t, err)
+	assert.Empty(t, peers, "rejected registrations must not add peers")
+
+	added, _, _, err := manager.addPeer(context.Background(), "", setupKey.Key, "", newPeer("provisioned"), false, addPeerOptions{requestedGroups: []string{"extra-group", "auto-group"}})
+	require.NoError(t, err)
+
+	groups, err := manager.GetPeerGroups(context.Background(), accountID, added.ID)
+	require.NoError(t, err)
+	groupIDs := make([]string, 0, len(groups))
+	for _, group := range groups {
+		groupIDs = append(groupIDs, group.ID)
+	}
+	assert.ElementsMatch(t, []string{allGroup.ID, "auto-group", "extra-group"}, groupIDs)
+
+	added, _, _, err = manager.addPeer(context.Background(), "", "", adminUser, newPeer("admin"), false, addPeerOptions{requestedGroups: []string{"extra-group"}})
+	require.NoError(t, err)
+
+	groups, err = manager.GetPeerGroups(context.Background(), accountID, added.ID)
+	require.NoError(t, err)
+	groupIDs = groupIDs[:0]
+	for _, group := range groups {
+		groupIDs = append(groupIDs, group.ID)
+	}
+	assert.ElementsMatch(t, []string{allGroup.ID, "extra-group"}, groupIDs)
+}
+
+func TestDefaultAccountManager_AddPeer_NamingTemplate(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	settings, err := manager.Store.GetAccountSettings(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err)
+
+	invalid := settings.Copy()
+	invalid.PeerNamingTemplate = "{os}-{unknown}"
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, invalid)
+	require.Error(t, err, "template with unknown variables should be rejected")
+
+	updated := settings.Copy()
+	updated.PeerNamingTemplate = "{os}-{hostname}"
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, updated)
+	require.NoError(t, err)
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	newPeer := &nbpeer.Peer{
+		Key:  key.PublicKey().String(),
+		Meta: nbpeer.PeerSystemMeta{Hostname: "workstation", GoOS: "linux"},
+	}
+	added, _, _, err := manager.AddPeer(context.Background(), "", "", userID, newPeer, false)
+	require.NoError(t, err)
+	assert.Equal(t, "linux-workstation", added.Name)
+	assert.Equal(t, "linux-workstation", added.DNSLabel)
+	assert.Equal(t, "workstation", added.Meta.Hostname)
+}
+
+func TestDefaultAccountManager_GetPeersMissingGroups(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	addPeer := func(hostname string) *nbpeer.Peer {
+		return addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"})
+	}
+
+	grouped := addPeer("grouped")
+	ungrouped := addPeer("ungrouped")
+
+	err := manager.CreateGroup(context.Background(), accountID, userID, &types.Group{
+		ID:    "group1",
+		Name:  "servers",
+		Peers: []string{grouped.ID},
+	})
+	require.NoError(t, err)
+
+	peers, err := manager.GetPeersMissingGroups(context.Background(), accountID, userID)
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	assert.Equal(t, ungrouped.ID, peers[0].ID)
+
+	_, err = manager.GetPeersMissingGroups(context.Background(), accountID, "unknown-user")
+	require.Error(t, err)
+}
+
+type countriesGeolocation struct {
+	geolocation.Mock
+	countries []geolocation.Country
+}
+
+func (g *countriesGeolocation) GetAllCountries() ([]geolocation.Country, error) {
+	return g.countries, nil
+}
+
+func TestDefaultAccountManager_GetPeersByCountry(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	addPeer := func(hostname, countryCode string) *nbpeer.Peer {
+		p := addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"})
+
+		p.Location.CountryCode = countryCode
+		require.NoError(t, manager.Store.SavePeerLocation(context.Background(), accountID, p))
+		return p
+	}
+
+	german := addPeer("berlin", "DE")
+	addPeer("new-york", "US")
+
+	_, err := manager.GetPeersByCountry(context.Background(), accountID, userID, "DE")
+	require.Error(t, err, "should fail without a geolocation database")
+
+	manager.geo = &countriesGeolocation{countries: []geolocation.Country{
+		{CountryISOCode: "DE", CountryName: "Germany"},
+		{CountryISOCode: "US", CountryName: "United States"},
+	}}
+
+	peers, err := manager.GetPeersByCountry(context.Background(), accountID, userID, "de")
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	assert.Equal(t, german.ID, peers[0].ID)
+
+	_, err = manager.GetPeersByCountry(context.Background(), accountID, userID, "FR")
+	require.Error(t, err, "country missing from the geolocation database should be rejected")
+
+	_, err = manager.GetPeersByCountry(context.Background(), accountID, userID, "DEU")
+	require.Error(t, err, "malformed country code should be rejected")
+}
+
+func TestDefaultAccountManager_GetPeersByRelay(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	euRelay := "rels://relay-eu.example.com:443"
+	usRelay := "rels://relay-us.example.com:443"
+
+	addPeer := func(hostname, relayAddress string) *nbpeer.Peer {
+		return addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux", RelayAddress: relayAddress})
+	}
+
+	berlin := addPeer("berlin", euRelay)
+	newYork := addPeer("new-york", usRelay)
+
+	peers, err := manager.GetPeersByRelay(context.Background(), accountID, userID, euRelay)
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	assert.Equal(t, berlin.ID, peers[0].ID)
+
+	// a relay change reported with the meta is stored
+	meta := newYork.Meta
+	meta.RelayAddress = euRelay
+	require.NoError(t, manager.SyncPeerMeta(context.Background(), newYork.Key, meta))
+
+	peers, err = manager.GetPeersByRelay(context.Background(), accountID, userID, euRelay)
+	require.NoError(t, err)
+	assert.Len(t, peers, 2)
+
+	peers, err = manager.GetPeersByRelay(context.Background(), accountID, userID, usRelay)
+	require.NoError(t, err)
+	assert.Empty(t, peers)
+
+	_, err = manager.GetPeersByRelay(context.Background(), accountID, userID, "")
+	require.Error(t, err, "empty relay address should be rejected")
+}
+
+func TestDefaultAccountManager_PeerWebhook(t *testing.T) {
+	// the test receiver listens on loopback, which is refused by default
+	t.Setenv(webhook.EnvAllowedPrivateHosts, "127.0.0.1")
+
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	encryptionKey, err := crypt.GenerateKey()
+	require.NoError(t, err)
+	fieldEncrypt, err := crypt.NewFieldEncrypt(encryptionKey)
+	require.NoError(t, err)
+	manager.Store.SetFieldEncrypt(fieldEncrypt)
+
+	accountID := "testaccount"
+	userID := "testuser"
+
+	_, err = createAccount(manager, accountID, userID, "domain.com")
+	require.NoError(t, err)
+
+	events := make(chan webhook.PeerEvent, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhook.PeerEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events <- event
+	}))
+	defer server.Close()
+
+	settings, err := manager.Store.GetAccountSettings(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err)
+
+	settings.PeerWebhookURL = server.URL
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, settings.Copy())
+	require.Error(t, err, "webhook without a secret should be rejected")
+
+	settings.PeerWebhookSecret = "secret"
+	for _, privateURL := range []string{"http://169.254.169.254/latest/meta-data", "http://10.0.0.1/hook", "http://localhost:8080/hook"} {
+		invalid := settings.Copy()
+		invalid.PeerWebhookURL = privateURL
+		_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, invalid)
+		require.Error(t, err, "webhook to %s should be rejected", privateURL)
+	}
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, settings.Copy())
+	require.NoError(t, err)
+
+	var storedSecret string
+	require.NoError(t, manager.Store.(*store.SqlStore).GetDB().Model(&types.Account{}).
+		Where("id = ?", accountID).Select("settings_peer_webhook_secret").Scan(&storedSecret).Error)
+	assert.NotEmpty(t, storedSecret)
+	assert.NotEqual(t, "secret", storedSecret, "the webhook secret should be encrypted at rest")
+
+	storedSettings, err := manager.Store.GetAccountSettings(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", storedSettings.PeerWebhookSecret)
+
+	peer := addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: "webhook-peer", GoOS: "linux"})
+
+	require.NoError(t, manager.DeletePeer(context.Background(), accountID, peer.ID, userID))
+
+	// deliveries are asynchronous and may arrive in any order
+	received := make(map[string]webhook.PeerEvent)
+	for len(received) < 2 {
+		select {
+		case event := <-events:
+			received[event.Event] = event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected two webhooks, got %d", len(received))
+		}
+	}
+
+	for _, eventType := range []string{webhook.EventPeerAdded, webhook.EventPeerDeleted} {
+		event, ok := received[eventType]
+		require.True(t, ok, "missing %s webhook", eventType)
+		assert.Equal(t, peer.ID, event.PeerID)
+		assert.Equal(t, accountID, event.AccountID)
+		assert.Equal(t, userID, event.InitiatorID)
+		assert.Equal(t, peer.IP.String(), event.PeerIP)
+	}
+}
+
+func TestDefaultAccountManager_SetPeerPinned(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	var peerIDs []string
+	for _, hostname := range []string{"first", "second", "third"} {
+		p := addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"})
+		peerIDs = append(peerIDs, p.ID)
+	}
+
+	peers, err := manager.GetPeers(context.Background(), accountID, userID, store.PeerFilters{})
+	require.NoError(t, err)
+	require.Len(t, peers, 3)
+	lastID := peers[2].ID
+
+	require.NoError(t, manager.SetPeerPinned(context.Background(), accountID, userID, lastID, true))
+	// pinning twice is a no-op
+	require.NoError(t, manager.SetPeerPinned(context.Background(), accountID, userID, lastID, true))
+
+	user, err := manager.Store.GetUserByUserID(context.Background(), store.LockingStrengthNone, userID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{lastID}, user.PinnedPeers)
+
+	peers, err = manager.GetPeers(context.Background(), accountID, userID, store.PeerFilters{})
+	require.NoError(t, err)
+	require.Len(t, peers, 3)
+	assert.Equal(t, lastID, peers[2].ID, "pinned peers should keep their order unless asked otherwise")
+
+	peers, err = manager.GetPeers(context.Background(), accountID, userID, store.PeerFilters{PinnedFirst: true})
+	require.NoError(t, err)
+	require.Len(t, peers, 3)
+	assert.Equal(t, lastID, peers[0].ID)
+
+	require.NoError(t, manager.SetPeerPinned(context.Background(), accountID, userID, lastID, false))
+	user, err = manager.Store.GetUserByUserID(context.Background(), store.LockingStrengthNone, userID)
+	require.NoError(t, err)
+	assert.Empty(t, user.PinnedPeers)
+
+	err = manager.SetPeerPinned(context.Background(), accountID, userID, "unknown-peer", true)
+	require.Error(t, err)
+
+	require.NoError(t, manager.SetPeerPinned(context.Background(), accountID, userID, peerIDs[0], true))
+	require.NoError(t, manager.SetPeerPinned(context.Background(), accountID, userID, peerIDs[1], true))
+	require.NoError(t, manager.DeletePeer(context.Background(), accountID, peerIDs[0], userID))
+	user, err = manager.Store.GetUserByUserID(context.Background(), store.LockingStrengthNone, userID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{peerIDs[1]}, user.PinnedPeers, "deleted peers should be unpinned")
+}
+
+// revokingPeerValidator revokes the setup key while the peer is being prepared, simulating a revocation
+// that happens in the middle of the registration
+type revokingPeerValidator struct {
+	MockIntegratedValidator
+	revoke func()
+}
+
+func (v revokingPeerValidator) PreparePeer(_ context.Context, _ string, peer *nbpeer.Peer, _ []string, _ *types.ExtraSettings, _ bool) *nbpeer.Peer {
+	v.revoke()
+	return peer
+}
+
+func TestDefaultAccountManager_AddPeer_SetupKeyRevokedDuringRegistration(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{})
+	require.NoError(t, err)
+
+	manager.integratedPeerValidator = revokingPeerValidator{
+		revoke: func() {
+			sk, err := manager.Store.GetSetupKeyByID(context.Background(), store.LockingStrengthNone, accountID, setupKey.Id)
+			require.NoError(t, err)
+			sk.Revoked = true
+			require.NoError(t, manager.Store.SaveSetupKey(context.Background(), sk))
+		},
+	}
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	_, _, _, err = manager.AddPeer(context.Background(), "", setupKey.Key, "", &nbpeer.Peer{
+		Key:  key.PublicKey().String(),
+		Meta: nbpeer.PeerSystemMeta{Hostname: "revoked"},
+	}, false)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, status.NewSetupKeyRevokedError().Error())
+
+	_, err = manager.Store.GetPeerByPeerPubKey(context.Background(), store.LockingStrengthNone, key.PublicKey().String())
+	require.Error(t, err, "peer should not be registered with a revoked setup key")
+
+	sk, err := manager.Store.GetSetupKeyByID(context.Background(), store.LockingStrengthNone, accountID, setupKey.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 0, sk.UsedTimes)
+}
+
+type testAttestationVerifier struct {
+	expected []byte
+}
+
+func (v *testAttestationVerifier) Verify(_ context.Context, _ string, _ nbpeer.PeerSystemMeta, attestation []byte) (*nbpeer.Attestation, error) {
+	if string(attestation) != string(v.expected) {
+		return nil, fmt.Errorf("invalid attestation")
+	}
+	verifiedAt := time.Now().UTC()
+	return &nbpeer.Attestation{Verifier: "test", Details: "quote ok", VerifiedAt: &verifiedAt}, nil
+}
+
+func TestDefaultAccountManager_AddPeer_Attestation(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	manager.SetPeerAttestationVerifier(&testAttestationVerifier{expected: []byte("valid-quote")})
+
+	newLogin := func(attestation []byte) types.PeerLogin {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+		return types.PeerLogin{
+			WireGuardPubKey: key.PublicKey().String(),
+			UserID:          userID,
+			Meta:            nbpeer.PeerSystemMeta{Hostname: "attested", GoOS: "linux"},
+			Attestation:     attestation,
+		}
+	}
+
+	_, _, _, err := manager.LoginPeer(context.Background(), newLogin([]byte("forged-quote")))
+	require.Error(t, err)
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.PermissionDenied, sErr.Type())
+
+	added, _, _, err := manager.LoginPeer(context.Background(), newLogin([]byte("valid-quote")))
+	require.NoError(t, err)
+
+	stored, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, added.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "test", stored.Attestation.Verifier)
+	assert.Equal(t, "quote ok", stored.Attestation.Details)
+	assert.NotNil(t, stored.Attestation.VerifiedAt)
+}
+
+func TestDefaultAccountManager_UpdatePeerFirewallOverrides(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	var peers []*nbpeer.Peer
+	for _, hostname := range []string{"first", "second"} {
+		p := addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"})
+		peers = append(peers, p)
+	}
+
+	_, err := manager.UpdatePeerFirewallOverrides(context.Background(), accountID, userID, peers[0].ID, []nbpeer.FirewallOverride{
+		{PeerIP: peers[1].IP.String(), Direction: "sideways", Action: "drop", Protocol: "all"},
+	})
+	require.Error(t, err)
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.InvalidArgument, sErr.Type())
+
+	// the default policy allows all traffic between the peers, the override drops the traffic coming from the second peer
+	override := nbpeer.FirewallOverride{PeerIP: peers[1].IP.String(), Direction: nbpeer.FirewallOverrideDirectionIN, Action: "drop", Protocol: "all"}
+	updated, err := manager.UpdatePeerFirewallOverrides(context.Background(), accountID, userID, peers[0].ID, []nbpeer.FirewallOverride{override})
+	require.NoError(t, err)
+	assert.Equal(t, []nbpeer.FirewallOverride{override}, updated.FirewallOverrides)
+
+	account, err := manager.Store.GetAccount(context.Background(), accountID)
+	require.NoError(t, err)
+	assert.Equal(t, []nbpeer.FirewallOverride{override}, account.Peers[peers[0].ID].FirewallOverrides)
+
+	validatedPeers := map[string]struct{}{peers[0].ID: {}, peers[1].ID: {}}
+	networkMap := account.GetPeerNetworkMap(context.Background(), peers[0].ID, nbdns.CustomZone{}, nil, validatedPeers, account.GetResourcePoliciesMap(), account.GetResourceRoutersMap(), nil, account.GetActiveGroupUsers())
+
+	var inRules []*types.FirewallRule
+	for _, rule := range networkMap.FirewallRules {
+		if rule.PeerIP == peers[1].IP.String() && rule.Direction == types.FirewallRuleDirectionIN {
+			inRules = append(inRules, rule)
+		}
+	}
+	require.Len(t, inRules, 1, "the override should replace the policy rule for the same traffic")
+	assert.Equal(t, types.PeerFirewallOverridePolicyID, inRules[0].PolicyID)
+	assert.Equal(t, "drop", inRules[0].Action)
+}
+
+func TestDefaultAccountManager_GetPeersByPubKeyPrefix(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	regularUser := types.NewRegularUser("regular-user", "", "")
+	regularUser.AccountID = accountID
+	require.NoError(t, manager.Store.SaveUser(context.Background(), regularUser))
+
+	var peers []*nbpeer.Peer
+	for _, hostname := range []string{"peer-1", "peer-2"} {
+		p := addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: hostname})
+		peers = append(peers, p)
+	}
+
+	prefix := peers[0].Key[:8]
+	found, err := manager.GetPeersByPubKeyPrefix(context.Background(), accountID, userID, prefix)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, peers[0].ID, found[0].ID)
+	assert.Equal(t, peers[0].Name, found[0].Name)
+
+	found, err = manager.GetPeersByPubKeyPrefix(context.Background(), accountID, userID, peers[1].Key)
+	require.NoError(t, err)
+	require.Len(t, found, 1, "the full key should match as well")
+	assert.Equal(t, peers[1].ID, found[0].ID)
+
+	if swapped := swapCase(prefix); swapped != prefix {
+		found, err = manager.GetPeersByPubKeyPrefix(context.Background(), accountID, userID, swapped)
+		require.NoError(t, err)
+		assert.Empty(t, found, "the prefix should be matched case-sensitively")
+	}
+
+	_, err = manager.GetPeersByPubKeyPrefix(context.Background(), accountID, userID, prefix[:3])
+	require.Error(t, err, "a too short prefix should be rejected")
+
+	_, err = manager.GetPeersByPubKeyPrefix(context.Background(), accountID, userID, "abc%def")
+	require.Error(t, err, "a prefix with non base64 characters should be rejected")
+
+	_, err = manager.GetPeersByPubKeyPrefix(context.Background(), accountID, regularUser.Id, prefix)
+	require.Error(t, err, "regular users should not be able to look up peers")
+}
+
+func TestDefaultAccountManager_UpdatePeerAppliedSerial(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	regularUser := types.NewRegularUser("regular-user", "", "")
+	regularUser.AccountID = accountID
+	require.NoError(t, manager.Store.SaveUser(context.Background(), regularUser))
+
+	peer := addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: "peer"})
+
+	serial, err := manager.GetPeerAppliedSerial(context.Background(), accountID, peer.ID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), serial, "a peer that never acknowledged a network map should have no applied serial")
+
+	require.NoError(t, manager.UpdatePeerAppliedSerial(context.Background(), peer.Key, 5))
+	serial, err = manager.GetPeerAppliedSerial(context.Background(), accountID, peer.ID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), serial, "a buffered serial should be returned before it is written to the store")
+
+	manager.flushAppliedSerials(context.Background())
+	stored, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), stored.AppliedNetworkSerial, "the buffered serial should be written on flush")
+
+	require.NoError(t, manager.UpdatePeerAppliedSerial(context.Background(), peer.Key, 3))
+	require.NoError(t, manager.UpdatePeerAppliedSerial(context.Background(), peer.Key, 0))
+	serial, err = manager.GetPeerAppliedSerial(context.Background(), accountID, peer.ID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), serial, "an older serial should not replace the applied one")
+
+	_, err = manager.GetPeerAppliedSerial(context.Background(), accountID, peer.ID, regularUser.Id)
+	require.Error(t, err, "regular users should not be able to read the applied serial")
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+func TestDefaultAccountManager_DeletePeersBySetupKey(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	leakedKey, err := manager.CreateSetupKey(context.Background(), accountID, "leaked", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{})
+	require.NoError(t, err)
+	otherKey, err := manager.CreateSetupKey(context.Background(), accountID, "other", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{})
+	require.NoError(t, err)
+
+	addPeer := func(setupKey, hostname string) *nbpeer.Peer {
+		return addTestPeer(t, manager, setupKey, "", nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"})
+	}
+
+	leaked1 := addPeer(leakedKey.Key, "leaked-1")
+	leaked2 := addPeer(leakedKey.Key, "leaked-2")
+	router := addPeer(leakedKey.Key, "leaked-router")
+	kept := addPeer(otherKey.Key, "kept")
+	assert.Equal(t, leakedKey.Id, leaked1.SetupKeyID, "the peer should reference the setup key it was registered with")
+
+	// a peer registered before the setup key of the peers was recorded
+	legacy := addPeer(leakedKey.Key, "legacy")
+	legacy.SetupKeyID = ""
+	require.NoError(t, manager.Store.SavePeer(context.Background(), accountID, legacy))
+
+	require.NoError(t, manager.Store.SaveNetworkRouter(context.Background(), &routerTypes.NetworkRouter{
+		ID:        "router1",
+		NetworkID: "network1",
+		AccountID: accountID,
+		Peer:      router.ID,
+		Enabled:   true,
+	}))
+
+	// revoked keys can still be used to find the peers they onboarded
+	leakedKey.Revoked = true
+	_, err = manager.SaveSetupKey(context.Background(), accountID, leakedKey, userID)
+	require.NoError(t, err)
+
+	_, _, _, err = manager.DeletePeersBySetupKey(context.Background(), accountID, userID, "unknown-key")
+	require.Error(t, err)
+
+	deleted, skipped, unattributed, err := manager.DeletePeersBySetupKey(context.Background(), accountID, userID, leakedKey.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	assert.Equal(t, []string{router.ID}, skipped, "peers linked to a network router should be reported")
+	assert.Equal(t, 1, unattributed, "peers that can't be matched to their setup key should be reported")
+
+	for _, peerID := range []string{leaked1.ID, leaked2.ID} {
+		_, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peerID)
+		require.Error(t, err, "peer %s should be deleted", peerID)
+	}
+	for _, peerID := range []string{router.ID, kept.ID, legacy.ID} {
+		_, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peerID)
+		require.NoError(t, err, "peer %s should be kept", peerID)
+	}
+}
+
+func TestDefaultAccountManager_GetPeerRoles(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	addPeer := func(hostname string) *nbpeer.Peer {
+		return addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"})
+	}
+
+	router := addPeer("router")
+	exitNode := addPeer("exit-node")
+	client := addPeer("client")
+
+	require.NoError(t, manager.Store.CreateGroup(context.Background(), &types.Group{
+		ID:        "exit-nodes",
+		AccountID: accountID,
+		Name:      "exit nodes",
+	}))
+	require.NoError(t, manager.Store.AddPeerToGroup(context.Background(), accountID, exitNode.ID, "exit-nodes"))
+	require.NoError(t, manager.Store.SaveNetworkRouter(context.Background(), &routerTypes.NetworkRouter{
+		ID:        "router1",
+		NetworkID: "network1",
+		AccountID: accountID,
+		Peer:      router.ID,
+		Enabled:   true,
+	}))
+	require.NoError(t, manager.Store.SaveRoute(context.Background(), &nbroute.Route{
+		ID:          "exit-route",
+		AccountID:   accountID,
+		Network:     netip.MustParsePrefix("0.0.0.0/0"),
+		NetID:       "exit",
+		NetworkType: nbroute.IPv4Network,
+		PeerGroups:  []string{"exit-nodes"},
+		Enabled:     true,
+	}))
+	require.NoError(t, manager.Store.SaveRoute(context.Background(), &nbroute.Route{
+		ID:          "disabled-exit-route",
+		AccountID:   accountID,
+		Network:     netip.MustParsePrefix("::/0"),
+		NetID:       "exit6",
+		NetworkType: nbroute.IPv6Network,
+		Peer:        client.ID,
+	}))
+	require.NoError(t, manager.Store.SaveRoute(context.Background(), &nbroute.Route{
+		ID:          "lan-route",
+		AccountID:   accountID,
+		Network:     netip.MustParsePrefix("192.168.0.0/24"),
+		NetID:       "lan",
+		NetworkType: nbroute.IPv4Network,
+		Peer:        client.ID,
+		Enabled:     true,
+	}))
+
+	roles, err := manager.GetPeerRoles(context.Background(), accountID, userID, router.ID)
+	require.NoError(t, err)
+	assert.True(t, roles.IsNetworkRouter())
+	assert.Equal(t, []string{"router1"}, roles.NetworkRouterIDs)
+	assert.False(t, roles.IsExitNode())
+	assert.False(t, roles.IngressPorts)
+
+	roles, err = manager.GetPeerRoles(context.Background(), accountID, userID, exitNode.ID)
+	require.NoError(t, err)
+	assert.False(t, roles.IsNetworkRouter())
+	assert.Equal(t, []string{"exit-route"}, roles.ExitNodeRouteIDs)
+
+	roles, err = manager.GetPeerRoles(context.Background(), accountID, userID, client.ID)
+	require.NoError(t, err)
+	assert.False(t, roles.IsNetworkRouter())
+	assert.False(t, roles.IsExitNode(), "disabled exit routes and regular routes should not count")
+
+	_, err = manager.GetPeerRoles(context.Background(), accountID, userID, "unknown")
+	require.Error(t, err)
+
+	err = manager.DeletePeer(context.Background(), accountID, router.ID, userID)
+	require.Error(t, err, "network router peer should not be deletable")
+}
+
+func TestDefaultAccountManager_AddPeerWithoutIdP(t *testing.T) {
+	manager, _, userID := createManagerWithAccount(t)
+
+	testCases := []struct {
+		name             string
+		idpManager       idp.Manager
+		expectedHostname string
+	}{
+		{
+			name:             "nil IdP manager",
+			idpManager:       nil,
+			expectedHostname: "iPhone",
+		},
+		{
+			name:             "typed nil IdP manager",
+			idpManager:       (*idp.MockIDP)(nil),
+			expectedHostname: "iPhone",
+		},
+		{
+			name: "failing IdP manager",
+			idpManager: &idp.MockIDP{
+				GetUserDataByIDFunc: func(_ context.Context, _ string, _ idp.AppMetadata) (*idp.UserData, error) {
+					return nil, errors.New("idp unavailable")
+				},
+			},
+			expectedHostname: "iPhone",
+		},
+		{
+			name: "working IdP manager",
+			idpManager: &idp.MockIDP{
+				GetUserDataByIDFunc: func(_ context.Context, _ string, _ idp.AppMetadata) (*idp.UserData, error) {
+					return &idp.UserData{Email: "alice@domain.com"}, nil
+				},
+			},
+			expectedHostname: "iPhone-alice",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			manager.idpManager = tc.idpManager
+
+			key, err := wgtypes.GeneratePrivateKey()
+			require.NoError(t, err)
+
+			peer, _, _, err := manager.AddPeer(context.Background(), "", "", userID, &nbpeer.Peer{
+				Key:  key.PublicKey().String(),
+				Meta: nbpeer.PeerSystemMeta{Hostname: "iPhone", GoOS: "ios"},
+			}, false)
+			require.NoError(t, err, "IdP problems must not block peer registration")
+			assert.Equal(t, tc.expectedHostname, peer.Meta.Hostname)
+		})
+	}
+}
+
+func TestDefaultAccountManager_UpdatePeerLastHandshake(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	meta := nbpeer.PeerSystemMeta{Hostname: "laptop", GoOS: "linux"}
+	peer, _, _, err := manager.AddPeer(context.Background(), "", "", userID, &nbpeer.Peer{
+		Key:  key.PublicKey().String(),
+		Meta: meta,
+	}, false)
+	require.NoError(t, err)
+
+	handshake := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, manager.UpdatePeerLastHandshake(context.Background(), peer.Key, handshake))
+
+	stored, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.True(t, handshake.Equal(stored.Status.LastHandshake))
+
+	require.NoError(t, manager.UpdatePeerLastHandshake(context.Background(), peer.Key, handshake.Add(-time.Hour)))
+	stored, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.True(t, handshake.Equal(stored.Status.LastHandshake), "older handshake should not overwrite a newer one")
+
+	// marking the peer connected must keep the reported handshake
+	require.NoError(t, manager.MarkPeerConnected(context.Background(), peer.Key, true, nil, 0, accountID))
+	stored, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.True(t, handshake.Equal(stored.Status.LastHandshake))
+
+	require.NoError(t, manager.SyncPeerMeta(context.Background(), peer.Key, stored.Meta), "unchanged meta should be accepted")
+}
+
+type testPeerAuthorizer struct {
+	mu       sync.Mutex
+	decision network_map.PeerAuthorizationDecision
+	requests []network_map.PeerAuthorizationRequest
+}
+
+func (a *testPeerAuthorizer) AuthorizePeer(_ context.Context, request network_map.PeerAuthorizationRequest) (network_map.PeerAuthorizationDecision, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests = append(a.requests, request)
+	return a.decision, nil
+}
+
+func (a *testPeerAuthorizer) setDecision(decision network_map.PeerAuthorizationDecision) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.decision = decision
+}
+
+func (a *testPeerAuthorizer) getRequests() []network_map.PeerAuthorizationRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.Clone(a.requests)
+}
+
+func TestDefaultAccountManager_PeerAuthorizer(t *testing.T) {
+	manager, updateManager, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID, userID := "testaccount", "testuser"
+	_, err = createAccount(manager, accountID, userID, "domain.com")
+	require.NoError(t, err)
+
+	var peers []*nbpeer.Peer
+	for _, hostname := range []string{"laptop", "server"} {
+		peer := addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: hostname})
+		peers = append(peers, peer)
+	}
+
+	networkMapController, ok := manager.networkMapController.(*controller.Controller)
+	require.True(t, ok)
+	authorizer := &testPeerAuthorizer{decision: network_map.PeerAuthorizationDenied}
+	networkMapController.SetPeerAuthorizer(authorizer)
+	t.Cleanup(func() {
+		networkMapController.SetPeerAuthorizer(nil)
+	})
+
+	_, networkMap, _, _, err := networkMapController.GetValidatedPeerWithMap(context.Background(), false, accountID, peers[0])
+	require.NoError(t, err)
+	assert.Empty(t, networkMap.Peers, "a denied peer should get an empty map")
+	assert.NotNil(t, networkMap.Network)
+	requests := authorizer.getRequests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, peers[0].ID, requests[0].Peer.ID)
+	assert.Equal(t, accountID, requests[0].Account.Id, "the authorizer should get the account to decide on")
+
+	authorizer.setDecision(network_map.PeerAuthorizationRestricted)
+	_, networkMap, _, _, err = networkMapController.GetValidatedPeerWithMap(context.Background(), false, accountID, peers[0])
+	require.NoError(t, err)
+	assert.Len(t, networkMap.Peers, 1, "a restricted peer should still get its peers")
+	assert.Empty(t, networkMap.Routes)
+
+	// peers pending approval get an empty map before the authorizer is consulted
+	_, networkMap, _, _, err = networkMapController.GetValidatedPeerWithMap(context.Background(), true, accountID, peers[0])
+	require.NoError(t, err)
+	assert.Empty(t, networkMap.Peers)
+	assert.Len(t, authorizer.getRequests(), 2)
+
+	// the pushed updates are authorized the same way as the syncs
+	updates := updateManager.CreateChannel(context.Background(), peers[0].ID)
+	t.Cleanup(func() {
+		updateManager.CloseChannel(context.Background(), peers[0].ID)
+	})
+	receiveUpdate := func() *network_map.UpdateMessage {
+		select {
+		case update := <-updates:
+			return update
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the peer update")
+			return nil
+		}
+	}
+
+	authorizer.setDecision(network_map.PeerAuthorizationDenied)
+	require.NoError(t, networkMapController.UpdateAccountPeer(context.Background(), accountID, peers[0].ID))
+	assert.Empty(t, receiveUpdate().Update.NetworkMap.RemotePeers, "a denied peer should get an empty map pushed")
+
+	authorizer.setDecision(network_map.PeerAuthorizationFull)
+	require.NoError(t, networkMapController.UpdateAccountPeers(context.Background(), accountID))
+	assert.Len(t, receiveUpdate().Update.NetworkMap.RemotePeers, 1)
+
+	authorizer.setDecision(network_map.PeerAuthorizationDenied)
+	require.NoError(t, networkMapController.UpdateAccountPeers(context.Background(), accountID))
+	assert.Empty(t, receiveUpdate().Update.NetworkMap.RemotePeers, "a denied peer should get an empty map pushed to all account peers")
+}
+
+func TestDefaultAccountManager_MarkPeerConnected_FirstConnectedAt(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	peer := addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: "laptop"})
+	assert.Nil(t, peer.FirstConnectedAt, "a new peer should not have a first connection time")
+
+	// a disconnect doesn't count as a connection
+	require.NoError(t, manager.MarkPeerConnected(context.Background(), peer.Key, false, nil, 0, accountID))
+	stored, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.Nil(t, stored.FirstConnectedAt)
+
+	require.NoError(t, manager.MarkPeerConnected(context.Background(), peer.Key, true, nil, 0, accountID))
+	stored, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.FirstConnectedAt)
+	firstConnectedAt := *stored.FirstConnectedAt
+
+	require.NoError(t, manager.MarkPeerConnected(context.Background(), peer.Key, false, nil, 0, accountID))
+	require.NoError(t, manager.MarkPeerConnected(context.Background(), peer.Key, true, nil, 0, accountID))
+	stored, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.FirstConnectedAt)
+	assert.True(t, firstConnectedAt.Equal(*stored.FirstConnectedAt), "later connections should not change the first connection time")
+	assert.False(t, stored.Status.LastSeen.Before(firstConnectedAt))
+}
+
+func TestDefaultAccountManager_MarkPeerConnected_ConnectionPort(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	peer := addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: "laptop"})
+	realIP := net.ParseIP("203.0.113.7")
+
+	// the manager has no geolocation, the port is stored regardless
+	require.NoError(t, manager.MarkPeerConnected(context.Background(), peer.Key, true, realIP, 41641, accountID))
+	stored, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(41641), stored.Location.ConnectionPort)
+
+	// a disconnect keeps the last observed port
+	require.NoError(t, manager.MarkPeerConnected(context.Background(), peer.Key, false, nil, 0, accountID))
+	stored, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(41641), stored.Location.ConnectionPort)
+
+	require.NoError(t, manager.MarkPeerConnected(context.Background(), peer.Key, true, realIP, 0, accountID))
+	stored, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.Zero(t, stored.Location.ConnectionPort, "an unknown port should clear the stored port")
+}
+
+func TestDefaultAccountManager_UpdatePeerReportedErrors(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	peer := addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: "laptop"})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	routeConflict := nbpeer.ReportedError{Time: now.Add(-5 * time.Minute), Level: nbpeer.ReportedErrorLevelWarning, Message: "route conflict"}
+	require.NoError(t, manager.UpdatePeerReportedErrors(context.Background(), peer.Key, []nbpeer.ReportedError{routeConflict}))
+
+	// the client resends its recent errors on every sync
+	for i := 0; i < nbpeer.MaxReportedErrors; i++ {
+		reportedError := nbpeer.ReportedError{Time: now.Add(time.Duration(i) * time.Second), Level: nbpeer.ReportedErrorLevelError, Message: fmt.Sprintf("error %d", i)}
+		require.NoError(t, manager.UpdatePeerReportedErrors(context.Background(), peer.Key, []nbpeer.ReportedError{routeConflict, reportedError}))
+	}
+
+	stored, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	require.Len(t, stored.ReportedErrors, nbpeer.MaxReportedErrors)
+	for i, reportedError := range stored.ReportedErrors {
+		assert.Equal(t, fmt.Sprintf("error %d", i), reportedError.Message, "only the most recent errors should be kept, oldest first")
+		assert.True(t, now.Add(time.Duration(i)*time.Second).Equal(reportedError.Time))
+	}
+
+	// concurrent reports should all be merged instead of overwriting each other
+	later := now.Add(time.Hour)
+	var wg sync.WaitGroup
+	for i := 0; i < nbpeer.MaxReportedErrors; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reportedError := nbpeer.ReportedError{Time: later.Add(time.Duration(i) * time.Second), Level: nbpeer.ReportedErrorLevelError, Message: fmt.Sprintf("concurrent error %d", i)}
+			assert.NoError(t, manager.UpdatePeerReportedErrors(context.Background(), peer.Key, []nbpeer.ReportedError{reportedError}))
+		}(i)
+	}
+	wg.Wait()
+
+	stored, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	require.Len(t, stored.ReportedErrors, nbpeer.MaxReportedErrors)
+	for i, reportedError := range stored.ReportedErrors {
+		assert.Equal(t, fmt.Sprintf("concurrent error %d", i), reportedError.Message)
+	}
+}
+
+func TestDefaultAccountManager_SyncPeerMeta_InsignificantFields(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	settings, err := manager.Store.GetAccountSettings(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err)
+	settings.SignificantPeerMetaFields = []string{nbpeer.MetaFieldHostname}
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, settings)
+	require.Error(t, err, "the fields used by posture checks should not be insignificant")
+
+	settings.SignificantPeerMetaFields = []string{
+		nbpeer.MetaFieldHostname, nbpeer.MetaFieldGoOS, nbpeer.MetaFieldOSVersion, nbpeer.MetaFieldKernelVersion,
+		nbpeer.MetaFieldWtVersion, nbpeer.MetaFieldNetworkAddresses, nbpeer.MetaFieldFiles,
+	}
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, settings)
+	require.NoError(t, err)
+
+	peer := addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: "laptop", GoOS: "linux", SystemProductName: "x1"})
+
+	meta := peer.Meta
+	meta.SystemProductName = "x2"
+	require.NoError(t, manager.SyncPeerMeta(context.Background(), peer.Key, meta))
+
+	stored, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "x2", stored.Meta.SystemProductName, "insignificant meta changes should still be stored")
+	assert.Equal(t, peer.Name, stored.Name, "storing the meta should not touch the other fields of the peer")
+}
+
+type pendingApprovalValidator struct {
+	MockIntegratedValidator
+	pending map[string]bool
+}
+
+func (v *pendingApprovalValidator) IsNotValidPeer(_ context.Context, _ string, peer *nbpeer.Peer, _ []string, _ *types.ExtraSettings) (bool, bool, error) {
+	return v.pending[peer.ID], false, nil
+}
+
+func TestDefaultAccountManager_PeerPendingApprovalSince(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	addPeer := func(hostname string) *nbpeer.Peer {
+		return addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"})
+	}
+
+	older := addPeer("older")
+	newer := addPeer("newer")
+	addPeer("approved")
+
+	validator := &pendingApprovalValidator{pending: map[string]bool{older.ID: true, newer.ID: true}}
+	manager.integratedPeerValidator = validator
+
+	syncPeer := func(peer *nbpeer.Peer) {
+		_, _, _, _, err := manager.SyncPeer(context.Background(), types.PeerSync{WireGuardPubKey: peer.Key, Meta: peer.Meta}, accountID)
+		require.NoError(t, err)
+	}
+
+	syncPeer(older)
+	syncPeer(newer)
+
+	stored, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, older.ID)
+	require.NoError(t, err)
+	pendingSince := stored.Status.PendingApprovalSince
+	require.False(t, pendingSince.IsZero(), "pending approval time should be stamped")
+
+	syncPeer(older)
+	stored, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, older.ID)
+	require.NoError(t, err)
+	assert.True(t, pendingSince.Equal(stored.Status.PendingApprovalSince), "pending approval time should be kept while pending")
+
+	peers, err := manager.GetPeersPendingApproval(context.Background(), accountID, userID)
+	require.NoError(t, err)
+	require.Len(t, peers, 2)
+	assert.Equal(t, older.ID, peers[0].ID)
+	assert.Equal(t, newer.ID, peers[1].ID)
+
+	validator.pending[older.ID] = false
+	syncPeer(older)
+
+	stored, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, older.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Status.PendingApprovalSince.IsZero(), "pending approval time should be cleared on approval")
+
+	peers, err = manager.GetPeersPendingApproval(context.Background(), accountID, userID)
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	assert.Equal(t, newer.ID, peers[0].ID)
+
+	_, err = manager.GetPeersPendingApproval(context.Background(), accountID, "unknown-user")
+	require.Error(t, err)
+}
+
+type countingValidator struct {
+	MockIntegratedValidator
+	validatedPeersCalls int
+}
+
+func (v *countingValidator) GetValidatedPeers(ctx context.Context, accountID string, groups []*types.Group, peers []*nbpeer.Peer, extraSettings *types.ExtraSettings) (map[string]struct{}, error) {
+	v.validatedPeersCalls++
+	return v.MockIntegratedValidator.GetValidatedPeers(ctx, accountID, groups, peers, extraSettings)
+}
+
+func TestDefaultAccountManager_GetPeerFast(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "test_account"
+	adminUser := "account_creator"
+	someUser := "some_user"
+	account := newAccountWithId(context.Background(), accountID, adminUser, "", "", "", false)
+	account.Users[someUser] = &types.User{
+		Id:   someUser,
+		Role: types.UserRoleUser,
+	}
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	userPeer := addTestPeer(t, manager, "", someUser, nbpeer.PeerSystemMeta{Hostname: "user-peer"})
+
+	validator := &countingValidator{}
+	manager.integratedPeerValidator = validator
+
+	peer, err := manager.GetPeerFast(context.Background(), accountID, userPeer.ID, adminUser)
+	require.NoError(t, err)
+	assert.Equal(t, userPeer.ID, peer.ID)
+	assert.Zero(t, validator.validatedPeersCalls, "the fast path must not call the validator")
+
+	_, err = manager.GetPeerFast(context.Background(), accountID, userPeer.ID, someUser)
+	require.Error(t, err, "regular users must use GetPeer even for their own peers")
+
+	_, err = manager.GetPeerFast(context.Background(), accountID, "unknown-peer", adminUser)
+	require.Error(t, err)
+}
+
+func TestDefaultAccountManager_DisconnectPeer(t *testing.T) {
+	manager, updateManager, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "test_account"
+	adminUser := "account_creator"
+	someUser := "some_user"
+	account := newAccountWithId(context.Background(), accountID, adminUser, "", "", "", false)
+	account.Users[someUser] = &types.User{
+		Id:   someUser,
+		Role: types.UserRoleUser,
+	}
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	peer := addTestPeer(t, manager, "", someUser, nbpeer.PeerSystemMeta{Hostname: "kicked-peer"})
+
+	connect := func() {
+		updateManager.CreateChannel(context.Background(), peer.ID)
+		require.NoError(t, manager.MarkPeerConnected(context.Background(), peer.Key, true, nil, 0, accountID))
+	}
+
+	connect()
+	err = manager.DisconnectPeer(context.Background(), accountID, peer.ID, someUser, true)
+	require.Error(t, err, "regular users must not be able to disconnect peers")
+	assert.True(t, updateManager.HasChannel(peer.ID))
+
+	err = manager.DisconnectPeer(context.Background(), accountID, peer.ID, adminUser, false)
+	require.NoError(t, err)
+	assert.False(t, updateManager.HasChannel(peer.ID))
+	stored, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Status.Connected, "the peer must stay connected until its stream ends")
+
+	connect()
+	err = manager.DisconnectPeer(context.Background(), accountID, peer.ID, adminUser, true)
+	require.NoError(t, err)
+	assert.False(t, updateManager.HasChannel(peer.ID))
+	stored, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.Status.Connected)
+
+	err = manager.DisconnectPeer(context.Background(), accountID, "unknown-peer", adminUser, true)
+	require.Error(t, err)
+}
+
+func TestDefaultAccountManager_SetGroupSSHEnabled(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "test_account"
+	adminUser := "account_creator"
+	someUser := "some_user"
+	account := newAccountWithId(context.Background(), accountID, adminUser, "", "", "", false)
+	account.Users[someUser] = &types.User{
+		Id:   someUser,
+		Role: types.UserRoleUser,
+	}
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	var peerIDs []string
+	for i := 0; i < 3; i++ {
+		peer := addTestPeer(t, manager, "", adminUser, nbpeer.PeerSystemMeta{Hostname: fmt.Sprintf("ssh-peer-%d", i)})
+		peerIDs = append(peerIDs, peer.ID)
+	}
+
+	_, err = manager.UpdatePeer(context.Background(), accountID, adminUser, &nbpeer.Peer{
+		ID:         peerIDs[0],
+		Name:       "ssh-peer-0",
+		SSHEnabled: true,
+	})
+	require.NoError(t, err)
+
+	group := &types.Group{
+		ID:    "ssh-group",
+		Name:  "SSH",
+		Peers: peerIDs[:2],
+	}
+	require.NoError(t, manager.CreateGroup(context.Background(), accountID, adminUser, group))
+
+	_, err = manager.SetGroupSSHEnabled(context.Background(), accountID, someUser, group.ID, true)
+	require.Error(t, err, "regular users must not be able to change the SSH state of peers")
+
+	changed, err := manager.SetGroupSSHEnabled(context.Background(), accountID, adminUser, group.ID, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, changed, "peers already having SSH enabled must be skipped")
+
+	changed, err = manager.SetGroupSSHEnabled(context.Background(), accountID, adminUser, group.ID, true)
+	require.NoError(t, err)
+	assert.Equal(t, 0, changed)
+
+	expected := map[string]bool{peerIDs[0]: true, peerIDs[1]: true, peerIDs[2]: false}
+	for peerID, sshEnabled := range expected {
+		peer, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peerID)
+		require.NoError(t, err)
+		assert.Equal(t, sshEnabled, peer.SSHEnabled, peerID)
+	}
+
+	changed, err = manager.SetGroupSSHEnabled(context.Background(), accountID, adminUser, group.ID, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed)
+
+	_, err = manager.SetGroupSSHEnabled(context.Background(), accountID, adminUser, "unknown-group", true)
+	require.Error(t, err)
+}
+
+func TestDefaultAccountManager_PeerOwnerEmail(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "test_account"
+	adminUser := "account_creator"
+	someUser := "some_user"
+	account := newAccountWithId(context.Background(), accountID, adminUser, "", "", "", false)
+	account.Users[someUser] = &types.User{
+		Id:    someUser,
+		Role:  types.UserRoleUser,
+		Email: "some.user@example.com",
+	}
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	peer := addTestPeer(t, manager, "", someUser, nbpeer.PeerSystemMeta{Hostname: "owned-peer"})
+	assert.Equal(t, "some.user@example.com", peer.OwnerEmail)
+
+	peers, err := manager.GetPeers(context.Background(), accountID, adminUser, store.PeerFilters{})
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	assert.Equal(t, "some.user@example.com", peers[0].OwnerEmail)
+
+	user, err := manager.Store.GetUserByUserID(context.Background(), store.LockingStrengthNone, someUser)
+	require.NoError(t, err)
+	user.Email = "renamed.user@example.com"
+	require.NoError(t, manager.Store.SaveUser(context.Background(), user))
+
+	_, err = manager.RefreshPeerOwnerEmails(context.Background(), accountID, someUser)
+	require.Error(t, err, "regular users must not be able to refresh the peer owner emails")
+
+	updated, err := manager.RefreshPeerOwnerEmails(context.Background(), accountID, adminUser)
+	require.NoError(t, err)
+	assert.Equal(t, 1, updated)
+
+	updated, err = manager.RefreshPeerOwnerEmails(context.Background(), accountID, adminUser)
+	require.NoError(t, err)
+	assert.Equal(t, 0, updated)
+
+	stored, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed.user@example.com", stored.OwnerEmail)
+}
+
+func TestDefaultAccountManager_OrphanedPeers(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "test_account"
+	adminUser := "account_creator"
+	someUser := "some_user"
+	account := newAccountWithId(context.Background(), accountID, adminUser, "", "", "", false)
+	account.Users[someUser] = &types.User{
+		Id:        someUser,
+		AccountID: accountID,
+		Role:      types.UserRoleUser,
+	}
+	account.Peers = map[string]*nbpeer.Peer{
+		"owned":     {ID: "owned", AccountID: accountID, Key: "owned-key", UserID: someUser, IP: net.IP{100, 64, 0, 1}, DNSLabel: "owned"},
+		"orphan1":   {ID: "orphan1", AccountID: accountID, Key: "orphan1-key", UserID: "departed_user", IP: net.IP{100, 64, 0, 2}, DNSLabel: "orphan1"},
+		"orphan2":   {ID: "orphan2", AccountID: accountID, Key: "orphan2-key", UserID: "departed_user", IP: net.IP{100, 64, 0, 3}, DNSLabel: "orphan2"},
+		"setup-key": {ID: "setup-key", AccountID: accountID, Key: "setup-key-key", IP: net.IP{100, 64, 0, 4}, DNSLabel: "setup-key"},
+	}
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	_, err = manager.GetOrphanedPeers(context.Background(), accountID, someUser)
+	require.Error(t, err, "regular users must not be able to list orphaned peers")
+
+	orphans, err := manager.GetOrphanedPeers(context.Background(), accountID, adminUser)
+	require.NoError(t, err)
+	orphanIDs := make([]string, 0, len(orphans))
+	for _, peer := range orphans {
+		orphanIDs = append(orphanIDs, peer.ID)
+	}
+	assert.ElementsMatch(t, []string{"orphan1", "orphan2"}, orphanIDs)
+
+	_, err = manager.ReassignOrphanedPeers(context.Background(), accountID, adminUser, "unknown_user")
+	require.Error(t, err, "peers must not be reassigned to a missing user")
+
+	_, err = manager.DeleteOrphanedPeers(context.Background(), accountID, someUser)
+	require.Error(t, err, "regular users must not be able to delete orphaned peers")
+
+	reassigned, err := manager.ReassignOrphanedPeers(context.Background(), accountID, adminUser, someUser)
+	require.NoError(t, err)
+	assert.Equal(t, 2, reassigned)
+
+	orphans, err = manager.GetOrphanedPeers(context.Background(), accountID, adminUser)
+	require.NoError(t, err)
+	assert.Empty(t, orphans)
+
+	userPeers, err := manager.Store.GetUserPeers(context.Background(), store.LockingStrengthNone, accountID, someUser)
+	require.NoError(t, err)
+	assert.Len(t, userPeers, 3)
+
+	peer, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, "orphan1")
+	require.NoError(t, err)
+	peer.UserID = "departed_user"
+	require.NoError(t, manager.Store.SavePeer(context.Background(), accountID, peer))
+
+	deleted, err := manager.DeleteOrphanedPeers(context.Background(), accountID, adminUser)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	_, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, "orphan1")
+	require.Error(t, err)
+
+	peers, err := manager.Store.GetAccountPeers(context.Background(), store.LockingStrengthNone, accountID, "", "", nil)
+	require.NoError(t, err)
+	assert.Len(t, peers, 3)
+}
+
+func TestDefaultAccountManager_PeerUsage(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "test_account"
+	adminUser := "account_creator"
+	someUser := "some_user"
+	account := newAccountWithId(context.Background(), accountID, adminUser, "", "", "", false)
+	account.Users[someUser] = &types.User{
+		Id:        someUser,
+		AccountID: accountID,
+		Role:      types.UserRoleUser,
+	}
+	account.Peers = map[string]*nbpeer.Peer{
+		"peer1": {ID: "peer1", AccountID: accountID, Key: "peer1-key", UserID: someUser, IP: net.IP{100, 64, 0, 1}, DNSLabel: "peer1", Status: &nbpeer.PeerStatus{}},
+	}
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	require.NoError(t, manager.RecordPeerUsage(context.Background(), "peer1-key", 1000, 100))
+	require.NoError(t, manager.RecordPeerUsage(context.Background(), "peer1-key", 1500, 300))
+	// the client restarted and its counters were reset
+	require.NoError(t, manager.RecordPeerUsage(context.Background(), "peer1-key", 200, 50))
+	require.Error(t, manager.RecordPeerUsage(context.Background(), "peer1-key", -1, 0))
+
+	_, err = manager.GetPeerUsage(context.Background(), accountID, someUser, "peer1", time.Hour)
+	require.Error(t, err, "regular users must not be able to read the peer usage")
+
+	_, err = manager.GetPeerUsage(context.Background(), accountID, adminUser, "peer1", nbpeer.UsageRetention+time.Hour)
+	require.Error(t, err, "the usage window can't exceed the usage retention")
+
+	usage, err := manager.GetPeerUsage(context.Background(), accountID, adminUser, "peer1", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700), usage.RxBytes)
+	assert.Equal(t, int64(350), usage.TxBytes)
+	assert.False(t, usage.CapExceeded)
+
+	settings, err := manager.Store.GetAccountSettings(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err)
+
+	invalidSettings := settings.Copy()
+	invalidSettings.PeerUsageCap = 1000
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, adminUser, invalidSettings)
+	require.Error(t, err, "a usage cap requires a window")
+
+	cappedSettings := settings.Copy()
+	cappedSettings.PeerUsageCap = 2100
+	cappedSettings.PeerUsageCapWindow = time.Hour
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, adminUser, cappedSettings)
+	require.NoError(t, err)
+
+	require.NoError(t, manager.RecordPeerUsage(context.Background(), "peer1-key", 240, 60))
+	usage, err = manager.GetPeerUsage(context.Background(), accountID, adminUser, "peer1", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2100), usage.Total())
+	assert.False(t, usage.CapExceeded, "usage equal to the cap must not exceed it")
+
+	require.NoError(t, manager.RecordPeerUsage(context.Background(), "peer1-key", 241, 60))
+	usage, err = manager.GetPeerUsage(context.Background(), accountID, adminUser, "peer1", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, usage.CapExceeded)
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, adminUser, settings.Copy())
+	require.NoError(t, err)
+
+	require.NoError(t, manager.RecordPeerUsage(context.Background(), "peer1-key", 242, 60))
+	usage, err = manager.GetPeerUsage(context.Background(), accountID, adminUser, "peer1", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, usage.CapExceeded, "the peer must not stay marked once the cap is disabled")
+}
+
+func TestDefaultAccountManager_GetPeerFQDNs(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "extra-labels", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{AllowExtraDNSLabels: true})
+	require.NoError(t, err)
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	peer, _, _, err := manager.AddPeer(context.Background(), "", setupKey.Key, "", &nbpeer.Peer{
+		Key:            key.PublicKey().String(),
+		Meta:           nbpeer.PeerSystemMeta{Hostname: "web-server"},
+		ExtraDNSLabels: []string{"web", "api.internal"},
+	}, false)
+	require.NoError(t, err)
+
+	fqdns, err := manager.GetPeerFQDNs(context.Background(), accountID, userID, peer.ID)
+	require.NoError(t, err)
+
+	settings, err := manager.Store.GetAccountSettings(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err)
+	dnsDomain := manager.networkMapController.GetDNSDomain(settings)
+	require.NotEmpty(t, dnsDomain)
+
+	assert.Equal(t, []string{peer.FQDN(dnsDomain), "web." + dnsDomain, "api.internal." + dnsDomain}, fqdns)
+
+	account, err := manager.Store.GetAccount(context.Background(), accountID)
+	require.NoError(t, err)
+
+	var zoneNames []string
+	for _, record := range account.GetPeersCustomZone(context.Background(), dnsDomain).Records {
+		if record.RData == peer.IP.String() {
+			zoneNames = append(zoneNames, record.Name)
+		}
+	}
+	assert.ElementsMatch(t, zoneNames, fqdns, "the FQDNs must match the custom zone records of the peer")
+
+	_, err = manager.GetPeerFQDNs(context.Background(), accountID, userID, "unknown-peer")
+	require.Error(t, err)
+}
+
+func TestDefaultAccountManager_AddPeer_ExtraDNSLabelsLimit(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	userID := "testuser"
+
+	account := newAccountWithId(context.Background(), accountID, userID, "domain.com", "", "", false)
+	account.Settings.PeerExtraDNSLabelsLimit = 2
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "extra-labels", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{AllowExtraDNSLabels: true})
+	require.NoError(t, err)
+
+	addPeer := func(hostname string, labels []string) error {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+		_, _, _, err = manager.AddPeer(context.Background(), "", setupKey.Key, "", &nbpeer.Peer{
+			Key:            key.PublicKey().String(),
+			Meta:           nbpeer.PeerSystemMeta{Hostname: hostname},
+			ExtraDNSLabels: labels,
+		}, false)
+		return err
+	}
+
+	err = addPeer("too-many", []string{"web", "api", "db"})
+	require.Error(t, err)
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.InvalidArgument, sErr.Type())
+
+	require.NoError(t, addPeer("within-limit", []string{"web", "api"}))
+
+	_, err = manager.UpdateAccountSettings(context.Background(), accountID, userID, &types.Settings{
+		PeerLoginExpiration:     time.Hour,
+		PeerExtraDNSLabelsLimit: types.MaxPeerExtraDNSLabels + 1,
+	})
+	require.ErrorContains(t, err, "extra DNS labels limit", "the limit must not exceed the domains list limit")
+}
+
+func TestDefaultAccountManager_GetPeersEphemeralFilter(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "test_account"
+	adminUser := "account_creator"
+	someUser := "some_user"
+	account := newAccountWithId(context.Background(), accountID, adminUser, "", "", "", false)
+	account.Users[someUser] = &types.User{
+		Id:   someUser,
+		Role: types.UserRoleUser,
+	}
+	account.Settings.RegularUsersViewBlocked = false
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	persistentKey, err := manager.CreateSetupKey(context.Background(), accountID, "persistent", types.SetupKeyReusable, time.Hour, nil, 999, adminUser, types.SetupKeyOptions{})
+	require.NoError(t, err)
+	ephemeralKey, err := manager.CreateSetupKey(context.Background(), accountID, "ephemeral", types.SetupKeyReusable, time.Hour, nil, 999, adminUser, types.SetupKeyOptions{Ephemeral: true})
+	require.NoError(t, err)
+
+	addPeer := func(setupKey, userID, hostname string) *nbpeer.Peer {
+		return addTestPeer(t, manager, setupKey, userID, nbpeer.PeerSystemMeta{Hostname: hostname})
+	}
+
+	addPeer("", someUser, "laptop")
+	runner := addPeer(ephemeralKey.Key, "", "ci-runner")
+	database := addPeer(persistentKey.Key, "", "database")
+
+	ephemeral, persistent := true, false
+
+	peers, err := manager.GetPeers(context.Background(), accountID, adminUser, store.PeerFilters{Ephemeral: &ephemeral})
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	assert.Equal(t, runner.ID, peers[0].ID)
+
+	peers, err = manager.GetPeers(context.Background(), accountID, adminUser, store.PeerFilters{Ephemeral: &persistent})
+	require.NoError(t, err)
+	assert.Len(t, peers, 2)
+
+	// the regular user sees the setup key peers through the default all-to-all policy of its own peer
+	peers, err = manager.GetPeers(context.Background(), accountID, someUser, store.PeerFilters{Ephemeral: &ephemeral})
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	assert.Equal(t, runner.ID, peers[0].ID)
+
+	peers, err = manager.GetPeers(context.Background(), accountID, someUser, store.PeerFilters{Name: "data", Ephemeral: &persistent})
+	require.NoError(t, err)
+	require.Len(t, peers, 1, "filters must not hide the user peers the access is resolved from")
+	assert.Equal(t, database.ID, peers[0].ID)
+
+	peers, err = manager.GetPeers(context.Background(), accountID, someUser, store.PeerFilters{Name: "ci", Ephemeral: &persistent})
+	require.NoError(t, err)
+	assert.Empty(t, peers)
+}
+
+func TestDefaultAccountManager_GetPeersGroupFilter(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "test_account"
+	adminUser := "account_creator"
+	someUser := "some_user"
+	account := newAccountWithId(context.Background(), accountID, adminUser, "", "", "", false)
+	account.Users[someUser] = &types.User{
+		Id:   someUser,
+		Role: types.UserRoleUser,
+	}
+	account.Settings.RegularUsersViewBlocked = false
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "servers", types.SetupKeyReusable, time.Hour, nil, 999, adminUser, types.SetupKeyOptions{})
+	require.NoError(t, err)
+
+	addPeer := func(setupKey, userID, hostname string) *nbpeer.Peer {
+		return addTestPeer(t, manager, setupKey, userID, nbpeer.PeerSystemMeta{Hostname: hostname})
+	}
+
+	laptop := addPeer("", someUser, "laptop")
+	database := addPeer(setupKey.Key, "", "database")
+	webServer := addPeer(setupKey.Key, "", "web-server")
+
+	require.NoError(t, manager.CreateGroup(context.Background(), accountID, adminUser, &types.Group{ID: "monitored", Name: "monitored", Issued: types.GroupIssuedAPI}))
+	require.NoError(t, manager.CreateGroup(context.Background(), accountID, adminUser, &types.Group{ID: "servers", Name: "servers", Issued: types.GroupIssuedAPI}))
+	require.NoError(t, manager.GroupAddPeer(context.Background(), accountID, "monitored", database.ID))
+	require.NoError(t, manager.GroupAddPeer(context.Background(), accountID, "servers", database.ID))
+	require.NoError(t, manager.GroupAddPeer(context.Background(), accountID, "servers", webServer.ID))
+
+	peerIDs := func(peers []*nbpeer.Peer) []string {
+		ids := make([]string, 0, len(peers))
+		for _, p := range peers {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+
+	peers, err := manager.GetPeers(context.Background(), accountID, adminUser, store.PeerFilters{ExcludeGroupID: "monitored"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{laptop.ID, webServer.ID}, peerIDs(peers))
+
+	peers, err = manager.GetPeers(context.Background(), accountID, adminUser, store.PeerFilters{GroupID: "servers", ExcludeGroupID: "monitored"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{webServer.ID}, peerIDs(peers))
+
+	peers, err = manager.GetPeers(context.Background(), accountID, adminUser, store.PeerFilters{Name: "laptop", ExcludeGroupID: "monitored"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{laptop.ID}, peerIDs(peers))
+
+	peers, err = manager.GetPeers(context.Background(), accountID, adminUser, store.PeerFilters{ExcludeGroupID: "nonexistent"})
+	require.NoError(t, err)
+	assert.Len(t, peers, 3, "excluding a group without members should keep all the peers")
+
+	// the regular user only sees the peers it has access to, narrowed down by the group filters
+	peers, err = manager.GetPeers(context.Background(), accountID, someUser, store.PeerFilters{GroupID: "servers", ExcludeGroupID: "monitored"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{webServer.ID}, peerIDs(peers))
+}
+
+func TestDefaultAccountManager_AddPeer_SequentialIPAllocator(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+	manager.SetPeerIPAllocator(types.SequentialPeerIPAllocator{})
+
+	accountID := "testaccount"
+	userID := "testuser"
+
+	account := newAccountWithId(context.Background(), accountID, userID, "domain.com", "", "", false)
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "test-key", types.SetupKeyReusable, time.Hour, nil, 0, userID, types.SetupKeyOptions{})
+	require.NoError(t, err)
+
+	network, err := manager.Store.GetAccountNetwork(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err)
+	baseIP := network.Net.IP.Mask(network.Net.Mask).To4()
+
+	for i := 1; i <= 3; i++ {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+
+		peer := &nbpeer.Peer{Key: key.PublicKey().String(), Meta: nbpeer.PeerSystemMeta{Hostname: fmt.Sprintf("peer-%d", i), GoOS: "linux"}}
+		added, _, _, err := manager.AddPeer(context.Background(), "", setupKey.Key, "", peer, false)
+		require.NoError(t, err)
+
+		expected := net.IPv4(baseIP[0], baseIP[1], baseIP[2], baseIP[3]+byte(i))
+		assert.Equal(t, expected.String(), added.IP.String(), "peers should get consecutive IPs")
+	}
+
+	// a peer added by another management instance moves the next IP
+	otherKey, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	require.NoError(t, manager.Store.AddPeerToAccount(context.Background(), &nbpeer.Peer{
+		ID:        "other-instance-peer",
+		AccountID: accountID,
+		Key:       otherKey.PublicKey().String(),
+		IP:        net.IPv4(baseIP[0], baseIP[1], baseIP[2], baseIP[3]+10),
+		DNSLabel:  "other-instance-peer",
+		Status:    &nbpeer.PeerStatus{},
+	}))
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	peer := &nbpeer.Peer{Key: key.PublicKey().String(), Meta: nbpeer.PeerSystemMeta{Hostname: "peer-after", GoOS: "linux"}}
+	added, _, _, err := manager.AddPeer(context.Background(), "", setupKey.Key, "", peer, false)
+	require.NoError(t, err)
+	expected := net.IPv4(baseIP[0], baseIP[1], baseIP[2], baseIP[3]+11)
+	assert.Equal(t, expected.String(), added.IP.String(), "the next IP should be derived from the stored peers")
+}
+
+func TestDefaultAccountManager_GetPeersByIDs(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "test_account"
+	adminUser := "account_creator"
+	someUser := "some_user"
+	account := newAccountWithId(context.Background(), accountID, adminUser, "", "", "", false)
+	account.Users[someUser] = &types.User{
+		Id:   someUser,
+		Role: types.UserRoleUser,
+	}
+	// without the default policy the user peer has no access to other peers
+	account.Policies = nil
+	account.Settings.RegularUsersViewBlocked = false
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "test-key", types.SetupKeyReusable, time.Hour, nil, 999, adminUser, types.SetupKeyOptions{})
+	require.NoError(t, err)
+
+	userPeer := addTestPeer(t, manager, "", someUser, nbpeer.PeerSystemMeta{Hostname: "user-peer"})
+
+	keyPeer := addTestPeer(t, manager, setupKey.Key, "", nbpeer.PeerSystemMeta{Hostname: "key-peer"})
+
+	requested := []string{userPeer.ID, keyPeer.ID, "unknown-peer", "unknown-peer"}
+
+	peers, missing, err := manager.GetPeersByIDs(context.Background(), accountID, adminUser, requested)
+	require.NoError(t, err)
+	assert.Len(t, peers, 2)
+	assert.Equal(t, []string{"unknown-peer"}, missing)
+
+	peers, missing, err = manager.GetPeersByIDs(context.Background(), accountID, someUser, requested)
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	assert.Equal(t, userPeer.ID, peers[userPeer.ID].ID)
+	assert.ElementsMatch(t, []string{keyPeer.ID, "unknown-peer"}, missing, "peers the user can't see should be reported as missing")
+
+	manager.permissionsManager = denyPermission{manager.permissionsManager, modules.Peers, operations.Read}
+	peers, missing, err = manager.GetPeersByIDs(context.Background(), accountID, adminUser, requested)
+	manager.permissionsManager = manager.permissionsManager.(denyPermission).Manager
+	require.NoError(t, err)
+	assert.Empty(t, peers, "an admin without the peers read permission should only see its own and accessible peers")
+	assert.ElementsMatch(t, []string{userPeer.ID, keyPeer.ID, "unknown-peer"}, missing)
+
+	settings, err := manager.Store.GetAccountSettings(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err)
+	settings.RegularUsersViewBlocked = true
+	require.NoError(t, manager.Store.SaveAccountSettings(context.Background(), accountID, settings))
+
+	peers, missing, err = manager.GetPeersByIDs(context.Background(), accountID, someUser, requested)
+	require.NoError(t, err)
+	assert.Empty(t, peers)
+	assert.ElementsMatch(t, []string{userPeer.ID, keyPeer.ID, "unknown-peer"}, missing)
+}
+
+func TestDefaultAccountManager_AddPeer_SetupKeyRequiresApproval(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	userID := "testuser"
+
+	account := newAccountWithId(context.Background(), accountID, userID, "domain.com", "", "", false)
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	openKey, err := manager.CreateSetupKey(context.Background(), accountID, "open", types.SetupKeyReusable, time.Hour, nil, 0, userID, types.SetupKeyOptions{})
+	require.NoError(t, err)
+	approvalKey, err := manager.CreateSetupKey(context.Background(), accountID, "approval", types.SetupKeyReusable, time.Hour, nil, 0, userID, types.SetupKeyOptions{RequiresApproval: true})
+	require.NoError(t, err)
+	assert.True(t, approvalKey.RequiresApproval)
+
+	addPeer := func(setupKey, hostname string) (*nbpeer.Peer, *types.NetworkMap) {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+		p, nmap, _, err := manager.AddPeer(context.Background(), "", setupKey, "", &nbpeer.Peer{
+			Key:  key.PublicKey().String(),
+			Meta: nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"},
+		}, false)
+		require.NoError(t, err)
+		return p, nmap
+	}
+
+	open, nmap := addPeer(openKey.Key, "open")
+	assert.Empty(t, nmap.Peers)
+
+	pending, nmap := addPeer(approvalKey.Key, "pending")
+	assert.Empty(t, nmap.Peers, "a peer pending approval should get a network map without peers")
+	assert.True(t, pending.Status.RequiresApproval)
+
+	peers, err := manager.GetPeersPendingApproval(context.Background(), accountID, userID)
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	assert.Equal(t, pending.ID, peers[0].ID)
+	assert.False(t, peers[0].Status.PendingApprovalSince.IsZero())
+
+	_, nmap, _, _, err = manager.SyncPeer(context.Background(), types.PeerSync{WireGuardPubKey: pending.Key, Meta: pending.Meta}, accountID)
+	require.NoError(t, err)
+	assert.Empty(t, nmap.Peers, "the peer should stay pending on sync")
+
+	_, nmap, _, _, err = manager.SyncPeer(context.Background(), types.PeerSync{WireGuardPubKey: open.Key, Meta: open.Meta}, accountID)
+	require.NoError(t, err)
+	assert.Empty(t, nmap.Peers, "a peer pending approval should not be visible to the other peers")
+
+	validPeers, invalidPeers, err := manager.GetValidatedPeers(context.Background(), accountID)
+	require.NoError(t, err)
+	assert.NotContains(t, validPeers, pending.ID, "the API should report the peer as requiring approval")
+	assert.Contains(t, invalidPeers, pending.ID)
+
+	update := pending.Copy()
+	update.Status = &nbpeer.PeerStatus{RequiresApproval: false}
+	_, err = manager.UpdatePeer(context.Background(), accountID, userID, update)
+	require.NoError(t, err)
+
+	peers, err = manager.GetPeersPendingApproval(context.Background(), accountID, userID)
+	require.NoError(t, err)
+	assert.Empty(t, peers, "the approved peer should leave the approval queue")
+
+	_, nmap, _, _, err = manager.SyncPeer(context.Background(), types.PeerSync{WireGuardPubKey: pending.Key, Meta: pending.Meta}, accountID)
+	require.NoError(t, err)
+	assert.Len(t, nmap.Peers, 1, "the approved peer should get the network map")
+
+	_, nmap, _, _, err = manager.SyncPeer(context.Background(), types.PeerSync{WireGuardPubKey: open.Key, Meta: open.Meta}, accountID)
+	require.NoError(t, err)
+	assert.Len(t, nmap.Peers, 1, "the approved peer should be visible to the other peers")
+
+	validPeers, _, err = manager.GetValidatedPeers(context.Background(), accountID)
+	require.NoError(t, err)
+	assert.Contains(t, validPeers, pending.ID)
+}
+
+func TestDefaultAccountManager_InvalidWireGuardPubKey(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	account, err := createAccount(manager, "testaccount", userID, "domain.com")
+	require.NoError(t, err)
+
+	setupKey, err := manager.CreateSetupKey(context.Background(), account.Id, "default", types.SetupKeyReusable, time.Hour, nil, 0, userID, types.SetupKeyOptions{})
+	require.NoError(t, err)
+
+	validKey, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	validPubKey := validKey.PublicKey().String()
+
+	invalidKeys := map[string]string{
+		"empty":      "",
+		"truncated":  validPubKey[:len(validPubKey)-4],
+		"too long":   b64.StdEncoding.EncodeToString(make([]byte, 33)),
+		"not base64": "not a base64 encoded key!!!!!!!!!!!!!!!!!!!",
+		"all-zero":   wgtypes.Key{}.String(),
+	}
+
+	assertInvalidArgument := func(t *testing.T, err error) {
+		t.Helper()
+		require.Error(t, err)
+		sErr, ok := status.FromError(err)
+		require.True(t, ok)
+		assert.Equal(t, status.InvalidArgument, sErr.Type())
+	}
+
+	for name, key := range invalidKeys {
+		t.Run(name, func(t *testing.T) {
+			_, _, _, err := manager.AddPeer(context.Background(), "", setupKey.Key, "", &nbpeer.Peer{
+				Key:  key,
+				Meta: nbpeer.PeerSystemMeta{Hostname: "invalid", GoOS: "linux"},
+			}, false)
+			assertInvalidArgument(t, err)
+
+			_, _, _, err = manager.LoginPeer(context.Background(), types.PeerLogin{
+				WireGuardPubKey: key,
+				Meta:            nbpeer.PeerSystemMeta{Hostname: "invalid", GoOS: "linux"},
+				SetupKey:        setupKey.Key,
+			})
+			assertInvalidArgument(t, err)
+
+			_, _, _, _, err = manager.SyncPeer(context.Background(), types.PeerSync{WireGuardPubKey: key}, account.Id)
+			assertInvalidArgument(t, err)
+		})
+	}
+
+	peers, err := manager.Store.GetAccountPeers(context.Background(), store.LockingStrengthNone, account.Id, "", "", nil)
+	require.NoError(t, err)
+	assert.Empty(t, peers, "no peer should be registered with an invalid key")
+
+	_, _, _, err = manager.AddPeer(context.Background(), "", setupKey.Key, "", &nbpeer.Peer{
+		Key:  validPubKey,
+		Meta: nbpeer.PeerSystemMeta{Hostname: "valid", GoOS: "linux"},
+	}, false)
+	require.NoError(t, err)
+}
+
+func TestDefaultAccountManager_PeerApprovalEvents(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	userID := "testuser"
+
+	account := newAccountWithId(context.Background(), accountID, userID, "domain.com", "", "", false)
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	approvalKey, err := manager.CreateSetupKey(context.Background(), accountID, "approval", types.SetupKeyReusable, time.Hour, nil, 0, userID, types.SetupKeyOptions{RequiresApproval: true})
+	require.NoError(t, err)
+
+	addPeer := func(hostname string) *nbpeer.Peer {
+		return addTestPeer(t, manager, approvalKey.Key, "", nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"})
+	}
+
+	eventsOf := func(activityID activity.Activity, peerID string) []*activity.Event {
+		events, err := manager.GetEvents(context.Background(), accountID, userID)
+		require.NoError(t, err)
+		var matching []*activity.Event
+		for _, event := range events {
+			if event.Activity == activityID && event.TargetID == peerID {
+				matching = append(matching, event)
+			}
+		}
+		return matching
+	}
+
+	pending := addPeer("pending")
+	require.Eventually(t, func() bool { return len(eventsOf(activity.PeerPendingApproval, pending.ID)) == 1 }, time.Second, 10*time.Millisecond)
+	event := eventsOf(activity.PeerPendingApproval, pending.ID)[0]
+	assert.Equal(t, approvalKey.Id, event.InitiatorID)
+	assert.Equal(t, peerApprovalTriggerRegistration, event.Meta["trigger"])
+	assert.Equal(t, "pending", event.Meta["hostname"])
+	assert.Equal(t, "linux", event.Meta["os"])
+
+	for i := 0; i < 2; i++ {
+		_, _, _, _, err = manager.SyncPeer(context.Background(), types.PeerSync{WireGuardPubKey: pending.Key, Meta: pending.Meta}, accountID)
+		require.NoError(t, err)
+	}
+
+	update := pending.Copy()
+	update.Status = &nbpeer.PeerStatus{RequiresApproval: false}
+	_, err = manager.UpdatePeer(context.Background(), accountID, userID, update)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(eventsOf(activity.PeerApproved, pending.ID)) == 1 }, time.Second, 10*time.Millisecond)
+	event = eventsOf(activity.PeerApproved, pending.ID)[0]
+	assert.Equal(t, userID, event.InitiatorID)
+	assert.Equal(t, peerApprovalTriggerUser, event.Meta["trigger"])
+
+	// neither syncing while pending nor after the approval nor approving again is a transition
+	_, _, _, _, err = manager.SyncPeer(context.Background(), types.PeerSync{WireGuardPubKey: pending.Key, Meta: pending.Meta}, accountID)
+	require.NoError(t, err)
+	update = pending.Copy()
+	update.Status = &nbpeer.PeerStatus{RequiresApproval: false}
+	_, err = manager.UpdatePeer(context.Background(), accountID, userID, update)
+	require.NoError(t, err)
+	assert.Len(t, eventsOf(activity.PeerPendingApproval, pending.ID), 1)
+	assert.Len(t, eventsOf(activity.PeerApproved, pending.ID), 1)
+
+	rejected := addPeer("rejected")
+	require.NoError(t, manager.DeletePeer(context.Background(), accountID, rejected.ID, userID))
+	require.Eventually(t, func() bool { return len(eventsOf(activity.PeerRejected, rejected.ID)) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, userID, eventsOf(activity.PeerRejected, rejected.ID)[0].InitiatorID)
+
+	require.NoError(t, manager.DeletePeer(context.Background(), accountID, pending.ID, userID))
+	assert.Empty(t, eventsOf(activity.PeerRejected, pending.ID), "deleting an approved peer isn't a rejection")
+}
+
+func TestDefaultAccountManager_AddPeer_RegistrationOSVersionCheck(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	userID := "testuser"
+
+	account := newAccountWithId(context.Background(), accountID, userID, "domain.com", "", "", false)
+	account.Settings.PeerRegistrationOSVersionCheck = &posture.OSVersionCheck{
+		Darwin: &posture.MinVersionCheck{MinVersion: "14.0"},
+		Linux:  &posture.MinKernelVersionCheck{MinKernelVersion: "5.15"},
+	}
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "default", types.SetupKeyReusable, time.Hour, nil, 0, userID, types.SetupKeyOptions{})
+	require.NoError(t, err)
+	labKey, err := manager.CreateSetupKey(context.Background(), accountID, "lab", types.SetupKeyReusable, time.Hour, nil, 0, userID, types.SetupKeyOptions{AllowOutdatedOSVersion: true})
+	require.NoError(t, err)
+	assert.True(t, labKey.AllowOutdatedOSVersion)
+
+	addPeer := func(setupKey string, meta nbpeer.PeerSystemMeta) error {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+		_, _, _, err = manager.AddPeer(context.Background(), "", setupKey, "", &nbpeer.Peer{Key: key.PublicKey().String(), Meta: meta}, false)
+		return err
+	}
+
+	outdatedMac := nbpeer.PeerSystemMeta{Hostname: "outdated-mac", GoOS: "darwin", OSVersion: "13.6.1"}
+	outdatedLinux := nbpeer.PeerSystemMeta{Hostname: "outdated-linux", GoOS: "linux", KernelVersion: "5.4.0-150-generic"}
+
+	for _, meta := range []nbpeer.PeerSystemMeta{outdatedMac, outdatedLinux} {
+		err = addPeer(setupKey.Key, meta)
+		require.Error(t, err, meta.Hostname)
+		sErr, ok := status.FromError(err)
+		require.True(t, ok)
+		assert.Equal(t, status.PreconditionFailed, sErr.Type(), meta.Hostname)
+	}
+
+	peers, err := manager.Store.GetAccountPeers(context.Background(), store.LockingStrengthNone, accountID, "", "", nil)
+	require.NoError(t, err)
+	assert.Empty(t, peers, "the outdated peers should not be created")
+
+	require.NoError(t, addPeer(setupKey.Key, nbpeer.PeerSystemMeta{Hostname: "mac", GoOS: "darwin", OSVersion: "14.2"}))
+	require.NoError(t, addPeer(setupKey.Key, nbpeer.PeerSystemMeta{Hostname: "windows", GoOS: "windows", KernelVersion: "10.0.19045"}),
+		"platforms without a minimum version should be allowed")
+	require.NoError(t, addPeer(labKey.Key, outdatedMac), "the lab setup key should allow outdated OS versions")
+}
+
+func requirePreconditionFailed(t *testing.T, err error) {
+	t.Helper()
+	require.Error(t, err)
+	sErr, ok := status.FromError(err)
+	require.True(t, ok, "expected a status error, got %v", err)
+	assert.Equal(t, status.PreconditionFailed, sErr.Type())
+}
+
+func TestDefaultAccountManager_UpdatePeer_ManagedBySetupKeyOnly(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+
+	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "default", types.SetupKeyReusable, time.Hour, nil, 0, userID, types.SetupKeyOptions{})
+	require.NoError(t, err)
+	managedKey, err := manager.CreateSetupKey(context.Background(), accountID, "fleet", types.SetupKeyReusable, time.Hour, nil, 0, userID, types.SetupKeyOptions{ManagedPeers: true})
+	require.NoError(t, err)
+	assert.True(t, managedKey.ManagedPeers)
+
+	addPeer := func(setupKey, hostname string) *nbpeer.Peer {
+		return addTestPeer(t, manager, setupKey, "", nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"})
+	}
+
+	regular := addPeer(setupKey.Key, "regular")
+	managed := addPeer(managedKey.Key, "managed")
+	assert.False(t, regular.ManagedBySetupKeyOnly)
+	assert.True(t, managed.ManagedBySetupKeyOnly)
+
+	update := regular.Copy()
+	update.Name = "renamed"
+	_, err = manager.UpdatePeer(context.Background(), accountID, userID, update)
+	require.NoError(t, err)
+
+	for name, edit := range map[string]func(p *nbpeer.Peer){
+		"name":        func(p *nbpeer.Peer) { p.Name = "renamed-managed" },
+		"description": func(p *nbpeer.Peer) { p.Description = "manual edit" },
+		"ssh":         func(p *nbpeer.Peer) { p.SSHEnabled = true },
+	} {
+		update = managed.Copy()
+		edit(update)
+		_, err = manager.UpdatePeer(context.Background(), accountID, userID, update)
+		require.Error(t, err, name)
+		sErr, ok := status.FromError(err)
+		require.True(t, ok)
+		assert.Equal(t, status.PreconditionFailed, sErr.Type(), name)
+	}
+
+	stored, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, managed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, managed.Name, stored.Name)
+	assert.False(t, stored.SSHEnabled)
+	assert.True(t, stored.ManagedBySetupKeyOnly)
+
+	_, err = manager.UpdatePeer(context.Background(), accountID, userID, managed.Copy())
+	require.NoError(t, err, "an update without settings changes should be allowed")
+
+	newIP := netip.MustParseAddr("100.64.250.250")
+	err = manager.UpdatePeerIP(context.Background(), accountID, userID, managed.ID, newIP)
+	requirePreconditionFailed(t, err)
+	require.NoError(t, manager.UpdatePeerIP(context.Background(), accountID, userID, managed.ID, netip.MustParseAddr(managed.IP.String())),
+		"keeping the IP should be allowed")
+
+	overrides := []nbpeer.FirewallOverride{{PeerIP: "0.0.0.0", Direction: nbpeer.FirewallOverrideDirectionIN, Action: "drop", Protocol: "all"}}
+	_, err = manager.UpdatePeerFirewallOverrides(context.Background(), accountID, userID, managed.ID, overrides)
+	requirePreconditionFailed(t, err)
+	_, err = manager.UpdatePeerFirewallOverrides(context.Background(), accountID, userID, regular.ID, overrides)
+	require.NoError(t, err)
+
+	stored, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, managed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, managed.IP.String(), stored.IP.String())
+	assert.Empty(t, stored.FirewallOverrides)
+
+	require.NoError(t, manager.DeletePeer(context.Background(), accountID, managed.ID, userID), "managed peers can still be deleted")
+}
+
+func TestDefaultAccountManager_ForceAccountResync(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	regularUser := "regular_user"
+
+	account := newAccountWithId(context.Background(), accountID, userID, "domain.com", "", "", false)
+	account.Users[regularUser] = &types.User{Id: regularUser, AccountID: accountID, Role: types.UserRoleUser}
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	network, err := manager.Store.GetAccountNetwork(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err)
+	serial := network.CurrentSerial()
+
+	err = manager.ForceAccountResync(context.Background(), accountID, regularUser)
+	require.Error(t, err, "regular users must not be able to force a resync")
+
+	require.NoError(t, manager.ForceAccountResync(context.Background(), accountID, userID))
+
+	network, err = manager.Store.GetAccountNetwork(context.Background(), store.LockingStrengthNone, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, serial+1, network.CurrentSerial(), "the network serial should be bumped once")
+
+	ev := getEvent(t, accountID, manager, activity.AccountResyncForced)
+	assert.Equal(t, userID, ev.InitiatorID)
+	assert.Equal(t, accountID, ev.TargetID)
+}
+
+func TestDefaultAccountManager_SetPeerUpdatesPaused(t *testing.T) {
+	manager, updateManager, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	regularUser := "regular_user"
+
+	account := newAccountWithId(context.Background(), accountID, userID, "domain.com", "", "", false)
+	account.Users[regularUser] = &types.User{Id: regularUser, AccountID: accountID, Role: types.UserRoleUser}
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	peer, _, _, err := manager.AddPeer(context.Background(), accountID, "", userID, &nbpeer.Peer{
+		Key:  key.PublicKey().String(),
+		Meta: nbpeer.PeerSystemMeta{Hostname: "peer"},
+	}, false)
+	require.NoError(t, err)
+
+	updMsg := updateManager.CreateChannel(context.Background(), peer.ID)
+	t.Cleanup(func() {
+		updateManager.CloseChannel(context.Background(), peer.ID)
+	})
+
+	err = manager.SetPeerUpdatesPaused(context.Background(), accountID, peer.ID, true, regularUser)
+	require.Error(t, err, "regular users must not be able to pause peer updates")
+
+	require.NoError(t, manager.SetPeerUpdatesPaused(context.Background(), accountID, peer.ID, true, userID))
+	ev := getEvent(t, accountID, manager, activity.PeerUpdatesPaused)
+	assert.Equal(t, peer.ID, ev.TargetID)
+
+	manager.UpdateAccountPeers(context.Background(), accountID)
+	peerShouldNotReceiveUpdate(t, updMsg)
+
+	manager.UpdateAccountPeer(context.Background(), accountID, peer.ID)
+	peerShouldNotReceiveUpdate(t, updMsg)
+
+	require.NoError(t, manager.SetPeerUpdatesPaused(context.Background(), accountID, peer.ID, false, userID))
+	peerShouldReceiveUpdate(t, updMsg)
+	ev = getEvent(t, accountID, manager, activity.PeerUpdatesResumed)
+	assert.Equal(t, peer.ID, ev.TargetID)
+
+	manager.UpdateAccountPeers(context.Background(), accountID)
+	peerShouldReceiveUpdate(t, updMsg)
+}
+
+func TestDefaultAccountManager_CanAllocatePeers(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	regularUser := "regular_user"
+
+	account := newAccountWithId(context.Background(), accountID, userID, "domain.com", "", "", false)
+	account.Users[regularUser] = &types.User{Id: regularUser, AccountID: accountID, Role: types.UserRoleUser}
+	account.Network.Net = net.IPNet{IP: net.ParseIP("100.64.0.0"), Mask: net.CIDRMask(29, 32)}
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	_, _, _, err = manager.AddPeer(context.Background(), accountID, "", userID, &nbpeer.Peer{
+		Key:  key.PublicKey().String(),
+		Meta: nbpeer.PeerSystemMeta{Hostname: "peer"},
+	}, false)
+	require.NoError(t, err)
+
+	fits, remaining, err := manager.CanAllocatePeers(context.Background(), accountID, userID, 5)
+	require.NoError(t, err)
+	assert.True(t, fits)
+	assert.Equal(t, 5, remaining, "a /29 network should have 6 IPs for peers, one of them taken")
+
+	fits, remaining, err = manager.CanAllocatePeers(context.Background(), accountID, userID, 6)
+	require.NoError(t, err)
+	assert.False(t, fits)
+	assert.Equal(t, 5, remaining)
+
+	_, _, err = manager.CanAllocatePeers(context.Background(), accountID, userID, -1)
+	require.Error(t, err, "a negative count should be rejected")
+
+	_, _, err = manager.CanAllocatePeers(context.Background(), accountID, regularUser, 1)
+	require.Error(t, err, "regular users must not be able to check the network capacity")
+}
+
+func TestDefaultAccountManager_RenewExpiredPeerLogins(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	regularUser := "regular_user"
+	blockedUser := "blocked_user"
+
+	account := newAccountWithId(context.Background(), accountID, userID, "domain.com", "", "", false)
+	account.Users[regularUser] = &types.User{Id: regularUser, AccountID: accountID, Role: types.UserRoleUser}
+	account.Users[blockedUser] = &types.User{Id: blockedUser, AccountID: accountID, Role: types.UserRoleUser}
+	require.NoError(t, manager.Store.SaveAccount(context.Background(), account))
+
+	addExpiredPeer := func(ownerID string) *nbpeer.Peer {
+		key, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+		peer, _, _, err := manager.AddPeer(context.Background(), accountID, "", ownerID, &nbpeer.Peer{
+			Key:                    key.PublicKey().String(),
+			Meta:                   nbpeer.PeerSystemMeta{Hostname: ownerID},
+			LoginExpirationEnabled: true,
+		}, false)
+		require.NoError(t, err)
+		require.NoError(t, manager.Store.SavePeerStatus(context.Background(), accountID, peer.ID, nbpeer.PeerStatus{LoginExpired: true}))
+		return peer
+	}
+	ownerPeer := addExpiredPeer(userID)
+	blockedPeer := addExpiredPeer(blockedUser)
+
+	user, err := manager.Store.GetUserByUserID(context.Background(), store.LockingStrengthNone, blockedUser)
+	require.NoError(t, err)
+	user.Blocked = true
+	require.NoError(t, manager.Store.SaveUser(context.Background(), user))
+
+	_, err = manager.RenewExpiredPeerLogins(context.Background(), accountID, regularUser)
+	require.Error(t, err, "regular users must not be able to renew peer logins")
+
+	renewed, err := manager.RenewExpiredPeerLogins(context.Background(), accountID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, renewed)
+
+	peer, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, ownerPeer.ID)
+	require.NoError(t, err)
+	assert.False(t, peer.Status.LoginExpired, "the login of a valid owner's peer should be renewed")
+	assert.WithinDuration(t, time.Now().UTC(), peer.GetLastLogin(), time.Minute)
+
+	peer, err = manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, accountID, blockedPeer.ID)
+	require.NoError(t, err)
+	assert.True(t, peer.Status.LoginExpired, "the peer of a blocked user should stay expired")
+
+	ev := getEvent(t, accountID, manager, activity.PeerLoginRenewedByUser)
+	assert.Equal(t, ownerPeer.ID, ev.TargetID)
+
+	renewed, err = manager.RenewExpiredPeerLogins(context.Background(), accountID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, renewed, "already renewed peers should not be renewed again")
+}
+
+func TestDefaultAccountManager_NetworkMapConnectedPeersOnly(t *testing.T) {
+	manager, updateManager, account, peer1, peer2, peer3 := setupNetworkMapTest(t)
+	ctx := context.Background()
+
+	for _, p := range []*nbpeer.Peer{peer1, peer2, peer3} {
+		require.NoError(t, manager.MarkPeerConnected(ctx, p.Key, false, nil, 0, account.Id))
+	}
+
+	settings, err := manager.Store.GetAccountSettings(ctx, store.LockingStrengthNone, account.Id)
+	require.NoError(t, err)
+	settings.NetworkMapConnectedPeersOnly = true
+	require.NoError(t, manager.Store.SaveAccountSettings(ctx, account.Id, settings))
+
+	updMsg := updateManager.CreateChannel(ctx, peer1.ID)
+	t.Cleanup(func() {
+		updateManager.CloseChannel(ctx, peer1.ID)
+	})
+
+	_, networkMap, _, _, err := manager.networkMapController.GetValidatedPeerWithMap(ctx, false, account.Id, peer1)
+	require.NoError(t, err)
+	assert.Empty(t, networkMap.Peers, "disconnected peers should be left out of the network map")
+
+	require.NoError(t, manager.MarkPeerConnected(ctx, peer2.Key, true, nil, 0, account.Id))
+
+	select {
+	case msg := <-updMsg:
+		remotePeers := msg.Update.GetNetworkMap().GetRemotePeers()
+		require.Len(t, remotePeers, 1, "the network map should only contain the connected peer")
+		assert.Equal(t, peer2.Key, remotePeers[0].GetWgPubKey())
+	case <-time.After(time.Second):
+		t.Fatal("the peers should be updated when a peer connects")
+	}
+
+	require.NoError(t, manager.MarkPeerConnected(ctx, peer2.Key, true, nil, 0, account.Id))
+	peerShouldNotReceiveUpdate(t, updMsg)
+
+	settings.NetworkMapConnectedPeersOnly = false
+	require.NoError(t, manager.Store.SaveAccountSettings(ctx, account.Id, settings))
+	_, networkMap, _, _, err = manager.networkMapController.GetValidatedPeerWithMap(ctx, false, account.Id, peer1)
+	require.NoError(t, err)
+	assert.Len(t, networkMap.Peers, 2, "by default the network map should contain the disconnected peers")
+}
+
+func TestDefaultAccountManager_GetPeerDNSConfig(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	accountID := "testaccount"
+	userID := "testuser"
+
+	account, err := createAccount(manager, accountID, userID, "domain.com")
+	require.NoError(t, err)
+	_, err = createAccount(manager, "otheraccount", "otheruser", "other.com")
+	require.NoError(t, err)
+
+	addPeer := func(hostname string) *nbpeer.Peer {
+		return addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"})
+	}
+
+	peer1 := addPeer("peer1")
+	peer2 := addPeer("peer2")
+
+	groupAll, err := account.GetGroupAll()
+	require.NoError(t, err)
+
+	_, err = manager.CreateNameServerGroup(context.Background(), accountID, "corp", "corp resolvers", []nbdns.NameServer{{
+		IP:     netip.MustParseAddr("10.0.0.53"),
+		NSType: nbdns.UDPNameServerType,
+		Port:   nbdns.DefaultDNSPort,
+	}}, []string{groupAll.ID}, false, []string{"corp.example.com"}, true, userID, false)
+	require.NoError(t, err)
+
+	_, err = manager.GetPeerDNSConfig(context.Background(), accountID, "otheruser", peer1.ID)
+	require.Error(t, err, "user of another account must not read the DNS config")
+
+	_, err = manager.GetPeerDNSConfig(context.Background(), "otheraccount", "otheruser", peer1.ID)
+	require.Error(t, err, "peer of another account must not be found")
+
+	dnsConfig, err := manager.GetPeerDNSConfig(context.Background(), accountID, userID, peer1.ID)
+	require.NoError(t, err)
+
+	assert.True(t, dnsConfig.ServiceEnable)
+	require.Len(t, dnsConfig.NameServerGroups, 1)
+	assert.Equal(t, []string{"corp.example.com"}, dnsConfig.NameServerGroups[0].Domains)
+
+	networkMap, err := manager.GetNetworkMap(context.Background(), peer1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, networkMap.DNSConfig, *dnsConfig)
+
+	require.NotEmpty(t, dnsConfig.CustomZones)
+	var peer2Found bool
+	for _, record := range dnsConfig.CustomZones[0].Records {
+		if record.RData == peer2.IP.String() {
+			peer2Found = true
+		}
+	}
+	assert.True(t, peer2Found, "custom zone must contain the reachable peer")
+}
+
+func TestDefaultAccountManager_GetEphemeralPeersPendingCleanup(t *testing.T) {
+	manager, accountID, userID := createManagerWithAccount(t)
+	_, err := createAccount(manager, "otheraccount", "otheruser", "other.com")
+	require.NoError(t, err)
+
+	setupKey, err := manager.CreateSetupKey(context.Background(), accountID, "ephemeral-key", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{Ephemeral: true})
+	require.NoError(t, err)
+
+	addPeer := func(hostname, key string) *nbpeer.Peer {
+		wgKey, err := wgtypes.GeneratePrivateKey()
+		require.NoError(t, err)
+		p, _, _, err := manager.AddPeer(context.Background(), "", key, "", &nbpeer.Peer{
+			Key:  wgKey.PublicKey().String(),
+			Meta: nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux"},
+		}, false)
+		require.NoError(t, err)
+		return p
+	}
+
+	ephemeralPeer1 := addPeer("ephemeral1", setupKey.Key)
+	ephemeralPeer2 := addPeer("ephemeral2", setupKey.Key)
+	require.True(t, ephemeralPeer1.Ephemeral)
+
+	regularKey, err := manager.CreateSetupKey(context.Background(), accountID, "regular-key", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{})
+	require.NoError(t, err)
+	addPeer("regular", regularKey.Key)
+
+	_, err = manager.GetEphemeralPeersPendingCleanup(context.Background(), accountID, "otheruser")
+	require.Error(t, err, "user of another account must not read the pending cleanups")
+
+	cleanups, err := manager.GetEphemeralPeersPendingCleanup(context.Background(), accountID, userID)
+	require.NoError(t, err)
+	require.Len(t, cleanups, 2)
+	assert.ElementsMatch(t, []string{ephemeralPeer1.ID, ephemeralPeer2.ID}, []string{cleanups[0].Peer.ID, cleanups[1].Peer.ID})
+	assert.False(t, cleanups[1].CleanupAt.Before(cleanups[0].CleanupAt))
+	assert.True(t, cleanups[0].CleanupAt.After(time.Now()), "cleanup must be scheduled in the future")
+
+	cleanups, err = manager.GetEphemeralPeersPendingCleanup(context.Background(), "otheraccount", "otheruser")
+	require.NoError(t, err)
+	assert.Empty(t, cleanups)
+}
+
+func TestDefaultAccountManager_BlockedPeerOwnerBehavior(t *testing.T) {
+	ctx := context.Background()
+	blockedUser := "blocked_user"
+
+	setup := func(t *testing.T, behavior types.BlockedPeerOwnerBehavior) (*DefaultAccountManager, *nbpeer.Peer, *nbpeer.Peer) {
+		t.Helper()
+
+		manager, _, err := createManager(t)
+		require.NoError(t, err)
+
+		account := newAccountWithId(ctx, "testaccount", userID, "domain.com", "", "", false)
+		account.Users[blockedUser] = &types.User{Id: blockedUser, AccountID: account.Id, Role: types.UserRoleUser}
+		account.Settings.PeerLoginExpirationEnabled = true
+		account.Settings.PeerLoginExpiration = 24 * time.Hour
+		require.NoError(t, manager.Store.SaveAccount(ctx, account))
+
+		addPeer := func(ownerID string) *nbpeer.Peer {
+			key, err := wgtypes.GeneratePrivateKey()
+			require.NoError(t, err)
+			peer, _, _, err := manager.AddPeer(ctx, account.Id, "", ownerID, &nbpeer.Peer{
+				Key:                    key.PublicKey().String(),
+				Meta:                   nbpeer.PeerSystemMeta{Hostname: ownerID, GoOS: "linux"},
+				LoginExpirationEnabled: true,
+			}, false)
+			require.NoError(t, err)
+			return peer
+		}
+		ownerPeer := addPeer(userID)
+		blockedPeer := addPeer(blockedUser)
+
+		settings, err := manager.Store.GetAccountSettings(ctx, store.LockingStrengthNone, account.Id)
+		require.NoError(t, err)
+		settings.BlockedPeerOwnerBehavior = behavior
+		_, err = manager.UpdateAccountSettings(ctx, account.Id, userID, settings)
+		require.NoError(t, err)
+
+		_, err = manager.SaveUser(ctx, account.Id, userID, &types.User{Id: blockedUser, Role: types.UserRoleUser, Blocked: true})
+		require.NoError(t, err)
+
+		return manager, ownerPeer, blockedPeer
+	}
+
+	sync := func(manager *DefaultAccountManager, peer *nbpeer.Peer) (*types.NetworkMap, error) {
+		_, networkMap, _, _, err := manager.SyncPeer(ctx, types.PeerSync{WireGuardPubKey: peer.Key, Meta: peer.Meta}, peer.AccountID)
+		return networkMap, err
+	}
+
+	login := func(manager *DefaultAccountManager, peer *nbpeer.Peer) (*types.NetworkMap, error) {
+		_, networkMap, _, err := manager.LoginPeer(ctx, types.PeerLogin{WireGuardPubKey: peer.Key, Meta: peer.Meta, UserID: peer.UserID})
+		return networkMap, err
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		manager, _, blockedPeer := setup(t, types.BlockedPeerOwnerReject)
+
+		peer, err := manager.Store.GetPeerByID(ctx, store.LockingStrengthNone, blockedPeer.AccountID, blockedPeer.ID)
+		require.NoError(t, err)
+		assert.True(t, peer.Status.LoginExpired, "the peers should be expired when their owner is blocked")
+
+		_, err = sync(manager, blockedPeer)
+		require.Error(t, err)
+		_, err = login(manager, blockedPeer)
+		require.Error(t, err)
+	})
+
+	t.Run("quarantine", func(t *testing.T) {
+		manager, ownerPeer, blockedPeer := setup(t, types.BlockedPeerOwnerQuarantine)
+
+		peer, err := manager.Store.GetPeerByID(ctx, store.LockingStrengthNone, blockedPeer.AccountID, blockedPeer.ID)
+		require.NoError(t, err)
+		assert.False(t, peer.Status.LoginExpired, "quarantined peers should not be expired")
+
+		networkMap, err := sync(manager, blockedPeer)
+		require.NoError(t, err)
+		assert.Empty(t, networkMap.Peers, "quarantined peers should receive an empty network map")
+
+		networkMap, err = login(manager, blockedPeer)
+		require.NoError(t, err)
+		assert.Empty(t, networkMap.Peers)
+
+		networkMap, err = sync(manager, ownerPeer)
+		require.NoError(t, err)
+		for _, p := range networkMap.Peers {
+			assert.NotEqual(t, blockedPeer.ID, p.ID, "quarantined peers should not be visible to the other peers")
+		}
+	})
+
+	t.Run("allow until expiry", func(t *testing.T) {
+		manager, ownerPeer, blockedPeer := setup(t, types.BlockedPeerOwnerAllowUntilExpiry)
+
+		networkMap, err := sync(manager, blockedPeer)
+		require.NoError(t, err)
+		require.Len(t, networkMap.Peers, 1)
+		assert.Equal(t, ownerPeer.ID, networkMap.Peers[0].ID)
+
+		_, err = login(manager, blockedPeer)
+		require.NoError(t, err)
+
+		require.NoError(t, manager.Store.SavePeerStatus(ctx, blockedPeer.AccountID, blockedPeer.ID, nbpeer.PeerStatus{LoginExpired: true}))
+		_, err = login(manager, blockedPeer)
+		require.Error(t, err, "the login of a peer of a blocked user should not be renewed")
+
+		settings, err := manager.Store.GetAccountSettings(ctx, store.LockingStrengthNone, blockedPeer.AccountID)
+		require.NoError(t, err)
+		settings.PeerLoginExpirationEnabled = false
+		_, err = manager.UpdateAccountSettings(ctx, blockedPeer.AccountID, userID, settings)
+		require.ErrorContains(t, err, "peer login expiration must be enabled")
+	})
+
+	t.Run("switching back to reject expires the peers", func(t *testing.T) {
+		manager, _, blockedPeer := setup(t, types.BlockedPeerOwnerQuarantine)
+
+		settings, err := manager.Store.GetAccountSettings(ctx, store.LockingStrengthNone, blockedPeer.AccountID)
+		require.NoError(t, err)
+		settings.BlockedPeerOwnerBehavior = types.BlockedPeerOwnerReject
+		_, err = manager.UpdateAccountSettings(ctx, blockedPeer.AccountID, userID, settings)
+		require.NoError(t, err)
+
+		peer, err := manager.Store.GetPeerByID(ctx, store.LockingStrengthNone, blockedPeer.AccountID, blockedPeer.ID)
+		require.NoError(t, err)
+		assert.True(t, peer.Status.LoginExpired)
+	})
+}
+
+func TestDefaultAccountManager_DiffPeerNetworkMaps(t *testing.T) {
+	manager, _, account, peer1, peer2, peer3 := setupNetworkMapTest(t)
+
+	policies, err := manager.Store.GetAccountPolicies(context.Background(), store.LockingStrengthNone, account.Id)
+	require.NoError(t, err)
+	for _, policy := range policies {
+		require.NoError(t, manager.DeletePolicy(context.Background(), account.Id, policy.ID, userID))
+	}
+
+	for _, group := range []*types.Group{
+		{ID: "groupA", Name: "GroupA", Peers: []string{peer1.ID}},
+		{ID: "groupC", Name: "GroupC", Peers: []string{peer3.ID}},
+	} {
+		require.NoError(t, manager.CreateGroup(context.Background(), account.Id, userID, group))
+	}
+
+	_, err = manager.SavePolicy(context.Background(), account.Id, userID, &types.Policy{
+		Name:    "peer1 to peer3",
+		Enabled: true,
+		Rules: []*types.PolicyRule{{
+			Name:          "rule",
+			Enabled:       true,
+			Sources:       []string{"groupA"},
+			Destinations:  []string{"groupC"},
+			Bidirectional: true,
+			Action:        types.PolicyTrafficActionAccept,
+			Protocol:      types.PolicyRuleProtocolALL,
+		}},
+	}, true)
+	require.NoError(t, err)
+
+	_, err = manager.CreateNameServerGroup(context.Background(), account.Id, "corp", "corp resolvers", []nbdns.NameServer{{
+		IP:     netip.MustParseAddr("10.0.0.53"),
+		NSType: nbdns.UDPNameServerType,
+		Port:   nbdns.DefaultDNSPort,
+	}}, []string{"groupA"}, false, []string{"corp.example.com"}, true, userID, false)
+	require.NoError(t, err)
+
+	_, err = manager.DiffPeerNetworkMaps(context.Background(), account.Id, "unknownUser", peer1.ID, peer2.ID)
+	require.Error(t, err)
+
+	_, err = manager.DiffPeerNetworkMaps(context.Background(), account.Id, userID, peer1.ID, peer1.ID)
+	require.Error(t, err, "a peer can't be compared with itself")
+
+	_, err = manager.DiffPeerNetworkMaps(context.Background(), account.Id, userID, peer1.ID, "unknownPeer")
+	require.Error(t, err)
+
+	diff, err := manager.DiffPeerNetworkMaps(context.Background(), account.Id, userID, peer1.ID, peer2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, peer1.ID, diff.PeerAID)
+	assert.Equal(t, peer2.ID, diff.PeerBID)
+
+	require.Len(t, diff.Peers.OnlyA, 1)
+	assert.Equal(t, peer3.ID, diff.Peers.OnlyA[0].ID)
+	assert.Empty(t, diff.Peers.OnlyB)
+
+	assert.NotEmpty(t, diff.FirewallRules.OnlyA)
+	for _, rule := range diff.FirewallRules.OnlyA {
+		assert.Equal(t, peer3.IP.String(), rule.PeerIP)
+	}
+	assert.Empty(t, diff.FirewallRules.OnlyB)
+
+	require.Len(t, diff.NameServerGroups.OnlyA, 1)
+	assert.Equal(t, []string{"corp.example.com"}, diff.NameServerGroups.OnlyA[0].Domains)
+	assert.Empty(t, diff.NameServerGroups.OnlyB)
+
+	assert.True(t, diff.Routes.Empty())
+	assert.True(t, slices.ContainsFunc(diff.DNSRecords.OnlyA, func(record nbdns.SimpleRecord) bool {
+		return record.RData == peer3.IP.String()
+	}), "the record of the peer reachable by peer1 only should be in the diff")
+}
+
+func TestDefaultAccountManager_GenerateDebugWGConfig(t *testing.T) {
+	manager, _, account, peer1, peer2, peer3 := setupNetworkMapTest(t)
+
+	_, err := manager.GenerateDebugWGConfig(context.Background(), account.Id, "unknownUser", peer1.ID)
+	require.Error(t, err)
+
+	_, err = manager.GenerateDebugWGConfig(context.Background(), account.Id, userID, "unknownPeer")
+	require.Error(t, err)
+
+	config, err := manager.GenerateDebugWGConfig(context.Background(), account.Id, userID, peer1.ID)
+	require.NoError(t, err)
+
+	assert.Contains(t, config, "PrivateKey = <redacted")
+	assert.NotContains(t, config, "\nPublicKey = "+peer1.Key+"\n", "the peer itself must not be listed as a WireGuard peer")
+	for _, remotePeer := range []*nbpeer.Peer{peer2, peer3} {
+		assert.Contains(t, config, "PublicKey = "+remotePeer.Key+"\n")
+		assert.Contains(t, config, "AllowedIPs = "+remotePeer.IP.String()+"/32\n")
+	}
+}
+
+func TestDefaultAccountManager_GetPeerExitNode(t *testing.T) {
+	manager, _, account, peer1, peer2, _ := setupNetworkMapTest(t)
+
+	_, err := manager.GetPeerExitNode(context.Background(), account.Id, "unknownUser", peer1.ID)
+	require.Error(t, err)
+
+	_, err = manager.GetPeerExitNode(context.Background(), account.Id, userID, "unknownPeer")
+	require.Error(t, err)
+
+	exitNode, err := manager.GetPeerExitNode(context.Background(), account.Id, userID, peer1.ID)
+	require.NoError(t, err)
+	assert.Nil(t, exitNode.Effective)
+	assert.Empty(t, exitNode.ExitNodes)
+
+	allGroup, err := manager.GetGroupByName(context.Background(), "All", account.Id)
+	require.NoError(t, err)
+
+	exitRoute, err := manager.CreateRoute(context.Background(), account.Id, netip.MustParsePrefix("0.0.0.0/0"), nbroute.IPv4Network, nil,
+		peer2.ID, nil, "exit node", "exit", true, 100, []string{allGroup.ID}, []string{}, true, userID, false, false)
+	require.NoError(t, err)
+
+	exitNode, err = manager.GetPeerExitNode(context.Background(), account.Id, userID, peer1.ID)
+	require.NoError(t, err)
+	require.NotNil(t, exitNode.Effective)
+	assert.Equal(t, exitRoute.ID, exitNode.Effective.RouteID)
+	assert.Equal(t, peer2.ID, exitNode.Effective.PeerID)
+	assert.Len(t, exitNode.ExitNodes, 1)
+
+	exitNode, err = manager.GetPeerExitNode(context.Background(), account.Id, userID, peer2.ID)
+	require.NoError(t, err)
+	assert.Nil(t, exitNode.Effective, "the exit node itself should not use its own exit node")
+	assert.Empty(t, exitNode.ExitNodes)
+}
+
+func TestDefaultAccountManager_GetPeersByVersion(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	account, err := createAccount(manager, "testaccount", userID, "domain.com")
+	require.NoError(t, err)
+
+	addPeer := func(hostname, version string) *nbpeer.Peer {
+		return addTestPeer(t, manager, "", userID, nbpeer.PeerSystemMeta{Hostname: hostname, GoOS: "linux", WtVersion: version})
+	}
+
+	oldPeer := addPeer("old", "0.27.4")
+	addPeer("new", "0.28.1")
+	addPeer("dev", "development")
+	preRelease := addPeer("prerelease", "0.27.0-dev")
+
+	_, err = manager.GetPeersByVersion(context.Background(), account.Id, "unknownUser", "<0.28.0")
+	require.Error(t, err)
+
+	_, err = manager.GetPeersByVersion(context.Background(), account.Id, userID, "not a version")
+	require.Error(t, err)
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, status.InvalidArgument, sErr.Type())
+
+	peers, err := manager.GetPeersByVersion(context.Background(), account.Id, userID, "<0.28.0")
+	require.NoError(t, err)
+	peerIDs := make([]string, 0, len(peers))
+	for _, p := range peers {
+		peerIDs = append(peerIDs, p.ID)
+	}
+	assert.ElementsMatch(t, []string{oldPeer.ID, preRelease.ID}, peerIDs)
+
+	peers, err = manager.GetPeersByVersion(context.Background(), account.Id, userID, ">= 1.0.0")
+	require.NoError(t, err)
+	assert.Empty(t, peers)
+}
+
+func TestDefaultAccountManager_PeerDisconnectGracePeriod(t *testing.T) {
+	manager, _, account, peer1, _, _ := setupNetworkMapTest(t)
+
+	_, err := manager.UpdateAccountSettings(context.Background(), account.Id, userID, &types.Settings{
+		PeerLoginExpiration:       time.Hour,
+		PeerDisconnectGracePeriod: types.MaxPeerDisconnectGracePeriod + time.Second,
+		Extra:                     &types.ExtraSettings{},
+	})
+	require.Error(t, err, "grace period above the maximum should be rejected")
+
+	_, err = manager.UpdateAccountSettings(context.Background(), account.Id, userID, &types.Settings{
+		PeerLoginExpiration:       time.Hour,
+		PeerDisconnectGracePeriod: 200 * time.Millisecond,
+		Extra:                     &types.ExtraSettings{},
+	})
+	require.NoError(t, err)
+	getEvent(t, account.Id, manager, activity.AccountPeerDisconnectGracePeriodUpdated)
+
+	getPeer := func() *nbpeer.Peer {
+		peer, err := manager.Store.GetPeerByID(context.Background(), store.LockingStrengthNone, account.Id, peer1.ID)
+		require.NoError(t, err)
+		return peer
+	}
+	isConnected := func() bool {
+		return getPeer().Status.Connected
+	}
+
+	require.NoError(t, manager.MarkPeerConnected(context.Background(), peer1.Key, true, nil, 0, account.Id))
+	require.True(t, isConnected())
+	lastSeen := getPeer().Status.LastSeen
+
+	// a flap within the grace period keeps the peer connected
+	require.NoError(t, manager.OnPeerDisconnected(context.Background(), account.Id, peer1.Key))
+	assert.True(t, isConnected(), "the peer should show its last stable status during the grace period")
+	require.NoError(t, manager.MarkPeerConnected(context.Background(), peer1.Key, true, nil, 0, account.Id))
+	assert.True(t, lastSeen.Equal(getPeer().Status.LastSeen), "a reconnect from the same address should not rewrite the peer status")
+	time.Sleep(400 * time.Millisecond)
+	assert.True(t, isConnected(), "the peer reconnected within the grace period")
+
+	// a reconnect from another port within the grace period is stored
+	require.NoError(t, manager.OnPeerDisconnected(context.Background(), account.Id, peer1.Key))
+	require.NoError(t, manager.MarkPeerConnected(context.Background(), peer1.Key, true, nil, 51820, account.Id))
+	assert.Equal(t, uint16(51820), getPeer().Location.ConnectionPort)
+	assert.True(t, isConnected())
+
+	require.NoError(t, manager.OnPeerDisconnected(context.Background(), account.Id, peer1.Key))
+	assert.True(t, isConnected())
+	require.Eventually(t, func() bool { return !isConnected() }, 2*time.Second, 20*time.Millisecond,
+		"the peer should be marked as disconnected once the grace period has passed")
+}
+
+// ingressPortsControllerStub links the given peers to ingress ports
+type ingressPortsControllerStub struct {
+	*port_forwarding.ControllerMock
+	ports map[string][]*types.IngressPort
+}
+
+func (c *ingressPortsControllerStub) IsPeerInIngressPorts(_ context.Context, _, peerID string) (bool, error) {
+	_, ok := c.ports[peerID]
+	return ok, nil
+}
+
+func (c *ingressPortsControllerStub) GetPeerIngressPorts(_ context.Context, _, peerID string) ([]*types.IngressPort, error) {
+	return c.ports[peerID], nil
+}
+
+func TestDefaultAccountManager_GetPeersWithIngressPorts(t *testing.T) {
+	manager, _, account, peer1, _, _ := setupNetworkMapTest(t)
+
+	peers, err := manager.GetPeersWithIngressPorts(context.Background(), account.Id, userID)
+	require.NoError(t, err)
+	assert.Empty(t, peers)
+
+	webPort := &types.IngressPort{ID: "web", Name: "web", Protocol: "tcp", PortRange: types.RulePortRange{Start: 8080, End: 8080}}
+	manager.proxyController = &ingressPortsControllerStub{
+		ControllerMock: port_forwarding.NewControllerMock(),
+		ports:          map[string][]*types.IngressPort{peer1.ID: {webPort}},
+	}
+
+	_, err = manager.GetPeersWithIngressPorts(context.Background(), account.Id, "unknownUser")
+	require.Error(t, err)
+
+	peers, err = manager.GetPeersWithIngressPorts(context.Background(), account.Id, userID)
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	assert.Equal(t, peer1.ID, peers[0].Peer.ID)
+	assert.Equal(t, []*types.IngressPort{webPort}, peers[0].Ports)
+}
@@ -5,6 +5,7 @@ import (
 	_ "embed"
 
 	"github.com/rs/xid"
+	"golang.org/x/exp/maps"
 
 	"github.com/netbirdio/netbird/management/server/permissions/modules"
 	"github.com/netbirdio/netbird/management/server/permissions/operations"
@@ -138,6 +139,37 @@ func (am *DefaultAccountManager) ListPolicies(ctx context.Context, accountID, us
 	return am.Store.GetAccountPolicies(ctx, store.LockingStrengthNone, accountID)
 }
 
+// ExplainPeerAccess evaluates the account policies for the traffic from the source peer to the destination peer
+// and returns the matching rules together with the result of the posture checks.
+func (am *DefaultAccountManager) ExplainPeerAccess(ctx context.Context, accountID, userID, srcPeerID, dstPeerID string) (*types.PeerAccessExplanation, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Policies, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	for _, peerID := range []string{srcPeerID, dstPeerID} {
+		if _, err = am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID); err != nil {
+			return nil, err
+		}
+	}
+
+	account, err := am.requestBuffer.GetAccountWithBackpressure(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	validatedPeersMap, err := am.integratedPeerValidator.GetValidatedPeers(ctx, accountID, maps.Values(account.Groups), maps.Values(account.Peers), account.Settings.Extra)
+	if err != nil {
+		return nil, err
+	}
+	account.RemovePeersPendingApproval(validatedPeersMap)
+
+	return account.ExplainPeerAccess(ctx, srcPeerID, dstPeerID, validatedPeersMap), nil
+}
+
 // arePolicyChangesAffectPeers checks if changes to a policy will affect any associated peers.
 func arePolicyChangesAffectPeers(ctx context.Context, transaction store.Store, accountID string, policy *types.Policy, isUpdate bool) (bool, error) {
 	if isUpdate {
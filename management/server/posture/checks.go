@@ -69,23 +69,7 @@ func (cd ChecksDefinition) Copy() ChecksDefinition {
 		}
 	}
 	if cd.OSVersionCheck != nil {
-		cdCopy.OSVersionCheck = &OSVersionCheck{}
-		osCheck := cd.OSVersionCheck
-		if osCheck.Android != nil {
-			cdCopy.OSVersionCheck.Android = &MinVersionCheck{MinVersion: osCheck.Android.MinVersion}
-		}
-		if osCheck.Darwin != nil {
-			cdCopy.OSVersionCheck.Darwin = &MinVersionCheck{MinVersion: osCheck.Darwin.MinVersion}
-		}
-		if osCheck.Ios != nil {
-			cdCopy.OSVersionCheck.Ios = &MinVersionCheck{MinVersion: osCheck.Ios.MinVersion}
-		}
-		if osCheck.Linux != nil {
-			cdCopy.OSVersionCheck.Linux = &MinKernelVersionCheck{MinKernelVersion: osCheck.Linux.MinKernelVersion}
-		}
-		if osCheck.Windows != nil {
-			cdCopy.OSVersionCheck.Windows = &MinKernelVersionCheck{MinKernelVersion: osCheck.Windows.MinKernelVersion}
-		}
+		cdCopy.OSVersionCheck = cd.OSVersionCheck.Copy()
 	}
 	if cd.GeoLocationCheck != nil {
 		geoCheck := cd.GeoLocationCheck
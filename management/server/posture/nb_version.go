@@ -53,6 +53,25 @@ func (n *NBVersionCheck) Validate() error {
 	return nil
 }
 
+// ParseVersionConstraint parses a NetBird version range like "< 0.28.0" or ">= 0.25.0, < 0.28.0"
+func ParseVersionConstraint(constraint string) (version.Constraints, error) {
+	if strings.TrimSpace(constraint) == "" {
+		return nil, fmt.Errorf("version constraint shouldn't be empty")
+	}
+	return version.NewConstraint(constraint)
+}
+
+// MatchesVersionConstraint checks if the peer's version is within the version range. As with the minimum version,
+// the pre-release tag of the peer's version is ignored
+func MatchesVersionConstraint(constraints version.Constraints, peerVer string) (bool, error) {
+	peerNBVer, err := version.NewVersion(sanitizeVersion(peerVer))
+	if err != nil {
+		return false, err
+	}
+
+	return constraints.Check(peerNBVer), nil
+}
+
 // MeetsMinVersion checks if the peer's version meets or exceeds the minimum required version
 func MeetsMinVersion(minVer, peerVer string) (bool, error) {
 	peerVer = sanitizeVersion(peerVer)
@@ -204,3 +204,41 @@ func TestMeetsMinVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestMatchesVersionConstraint(t *testing.T) {
+	tests := []struct {
+		name         string
+		constraint   string
+		peerVer      string
+		want         bool
+		wantParseErr bool
+		wantMatchErr bool
+	}{
+		{name: "older version", constraint: "<0.28.0", peerVer: "0.27.4", want: true},
+		{name: "newer version", constraint: "<0.28.0", peerVer: "0.28.1"},
+		{name: "within range", constraint: ">= 0.25.0, < 0.28.0", peerVer: "0.26.0", want: true},
+		{name: "pre-release tag ignored", constraint: "<0.28.0", peerVer: "0.27.0-dev", want: true},
+		{name: "unparsable peer version", constraint: "<0.28.0", peerVer: "development", wantMatchErr: true},
+		{name: "empty constraint", constraint: " ", wantParseErr: true},
+		{name: "invalid constraint", constraint: "<<0.28", wantParseErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constraints, err := ParseVersionConstraint(tt.constraint)
+			if tt.wantParseErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			got, err := MatchesVersionConstraint(constraints, tt.peerVer)
+			if tt.wantMatchErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -47,6 +47,55 @@ func (c *OSVersionCheck) Check(ctx context.Context, peer nbpeer.Peer) (bool, err
 	return true, nil
 }
 
+// CheckMinVersion checks the peer against the minimum version of its platform. Unlike Check, peers of platforms
+// without a minimum version pass
+func (c *OSVersionCheck) CheckMinVersion(ctx context.Context, peer nbpeer.Peer) (bool, error) {
+	switch peer.Meta.GoOS {
+	case "android":
+		if c.Android == nil {
+			return true, nil
+		}
+	case "darwin":
+		if c.Darwin == nil {
+			return true, nil
+		}
+	case "ios":
+		if c.Ios == nil {
+			return true, nil
+		}
+	case "linux":
+		if c.Linux == nil {
+			return true, nil
+		}
+	case "windows":
+		if c.Windows == nil {
+			return true, nil
+		}
+	}
+	return c.Check(ctx, peer)
+}
+
+// Copy returns a deep copy of the check
+func (c *OSVersionCheck) Copy() *OSVersionCheck {
+	osCheck := &OSVersionCheck{}
+	if c.Android != nil {
+		osCheck.Android = &MinVersionCheck{MinVersion: c.Android.MinVersion}
+	}
+	if c.Darwin != nil {
+		osCheck.Darwin = &MinVersionCheck{MinVersion: c.Darwin.MinVersion}
+	}
+	if c.Ios != nil {
+		osCheck.Ios = &MinVersionCheck{MinVersion: c.Ios.MinVersion}
+	}
+	if c.Linux != nil {
+		osCheck.Linux = &MinKernelVersionCheck{MinKernelVersion: c.Linux.MinKernelVersion}
+	}
+	if c.Windows != nil {
+		osCheck.Windows = &MinKernelVersionCheck{MinKernelVersion: c.Windows.MinKernelVersion}
+	}
+	return osCheck
+}
+
 func (c *OSVersionCheck) Name() string {
 	return OSVersionCheckName
 }
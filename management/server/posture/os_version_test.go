@@ -152,6 +152,59 @@ func TestOSVersionCheck_Check(t *testing.T) {
 	}
 }
 
+func TestOSVersionCheck_CheckMinVersion(t *testing.T) {
+	check := OSVersionCheck{
+		Darwin: &MinVersionCheck{MinVersion: "14.0"},
+		Linux:  &MinKernelVersionCheck{MinKernelVersion: "5.15"},
+	}
+
+	tests := []struct {
+		name    string
+		meta    peer.PeerSystemMeta
+		wantErr bool
+		isValid bool
+	}{
+		{
+			name:    "Peer darwin version above the minimum",
+			meta:    peer.PeerSystemMeta{GoOS: "darwin", OSVersion: "14.2.1"},
+			isValid: true,
+		},
+		{
+			name:    "Peer darwin version below the minimum",
+			meta:    peer.PeerSystemMeta{GoOS: "darwin", OSVersion: "13.6"},
+			isValid: false,
+		},
+		{
+			name:    "Peer linux kernel version below the minimum",
+			meta:    peer.PeerSystemMeta{GoOS: "linux", KernelVersion: "5.4.0-150-generic"},
+			isValid: false,
+		},
+		{
+			name:    "Peer platform without a minimum version",
+			meta:    peer.PeerSystemMeta{GoOS: "windows", KernelVersion: "10.0.19045"},
+			isValid: true,
+		},
+		{
+			name:    "Invalid peer darwin version",
+			meta:    peer.PeerSystemMeta{GoOS: "darwin", OSVersion: "unknown"},
+			wantErr: true,
+			isValid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isValid, err := check.CheckMinVersion(context.Background(), peer.Peer{Meta: tt.meta})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.isValid, isValid)
+		})
+	}
+}
+
 func TestOSVersionCheck_Validate(t *testing.T) {
 	testCases := []struct {
 		name          string
@@ -11,6 +11,7 @@ import (
 	"github.com/netbirdio/netbird/management/server/permissions/operations"
 	"github.com/netbirdio/netbird/management/server/posture"
 	"github.com/netbirdio/netbird/management/server/store"
+	"github.com/netbirdio/netbird/management/server/types"
 	"github.com/netbirdio/netbird/shared/management/status"
 )
 
@@ -132,6 +133,75 @@ func (am *DefaultAccountManager) ListPostureChecks(ctx context.Context, accountI
 	return am.Store.GetAccountPostureChecks(ctx, store.LockingStrengthNone, accountID)
 }
 
+// GetPeerPostureContext returns the posture checks applying to the peer, each paired with the policy rule that brought
+// it in, in the order of the policies. A posture check required by several policies is returned once per policy
+func (am *DefaultAccountManager) GetPeerPostureContext(ctx context.Context, accountID, userID, peerID string) ([]*types.PeerPostureCheckSource, error) {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Policies, operations.Read)
+	if err != nil {
+		return nil, status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return nil, status.NewPermissionDeniedError()
+	}
+
+	if _, err = am.Store.GetPeerByID(ctx, store.LockingStrengthNone, accountID, peerID); err != nil {
+		return nil, err
+	}
+
+	policies, err := am.Store.GetAccountPolicies(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []*types.PeerPostureCheckSource
+	var checkIDs []string
+	for _, policy := range policies {
+		if !policy.Enabled || len(policy.SourcePostureChecks) == 0 {
+			continue
+		}
+
+		rule, err := getPeerPolicySourceRule(ctx, am.Store, policy, accountID, peerID)
+		if err != nil {
+			return nil, err
+		}
+		if rule == nil {
+			continue
+		}
+
+		for _, checkID := range policy.SourcePostureChecks {
+			sources = append(sources, &types.PeerPostureCheckSource{
+				PolicyID:   policy.ID,
+				PolicyName: policy.Name,
+				RuleID:     rule.ID,
+				RuleName:   rule.Name,
+			})
+			checkIDs = append(checkIDs, checkID)
+		}
+	}
+
+	if len(sources) == 0 {
+		return sources, nil
+	}
+
+	checks, err := am.Store.GetPostureChecksByIDs(ctx, store.LockingStrengthNone, accountID, checkIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*types.PeerPostureCheckSource, 0, len(sources))
+	for i, source := range sources {
+		// skip the checks deleted since they were attached to the policy, as getPeerPostureChecks does
+		check, ok := checks[checkIDs[i]]
+		if !ok {
+			continue
+		}
+		source.Checks = check
+		result = append(result, source)
+	}
+
+	return result, nil
+}
+
 // arePostureCheckChangesAffectPeers checks if the changes in posture checks are affecting peers.
 func arePostureCheckChangesAffectPeers(ctx context.Context, transaction store.Store, accountID, postureCheckID string) (bool, error) {
 	policies, err := transaction.GetAccountPolicies(ctx, store.LockingStrengthNone, accountID)
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"slices"
 	"testing"
 	"time"
 
@@ -563,3 +564,77 @@ func TestArePostureCheckChangesAffectPeers(t *testing.T) {
 		assert.False(t, result)
 	})
 }
+
+func TestDefaultAccountManager_GetPeerPostureContext(t *testing.T) {
+	manager, _, account, peer1, peer2, _ := setupNetworkMapTest(t)
+
+	for _, group := range []*types.Group{
+		{ID: "groupA", Name: "GroupA", Peers: []string{peer1.ID}},
+		{ID: "groupB", Name: "GroupB", Peers: []string{peer2.ID}},
+	} {
+		require.NoError(t, manager.CreateGroup(context.Background(), account.Id, userID, group))
+	}
+
+	checkA, err := manager.SavePostureChecks(context.Background(), account.Id, userID, &posture.Checks{
+		Name:   "checkA",
+		Checks: posture.ChecksDefinition{NBVersionCheck: &posture.NBVersionCheck{MinVersion: "0.28.0"}},
+	}, true)
+	require.NoError(t, err)
+	checkB, err := manager.SavePostureChecks(context.Background(), account.Id, userID, &posture.Checks{
+		Name:   "checkB",
+		Checks: posture.ChecksDefinition{NBVersionCheck: &posture.NBVersionCheck{MinVersion: "0.29.0"}},
+	}, true)
+	require.NoError(t, err)
+
+	savePolicy := func(name string, enabled bool, checks []string, rules ...*types.PolicyRule) *types.Policy {
+		policy, err := manager.SavePolicy(context.Background(), account.Id, userID, &types.Policy{
+			Name:                name,
+			Enabled:             enabled,
+			Rules:               rules,
+			SourcePostureChecks: checks,
+		}, true)
+		require.NoError(t, err)
+		return policy
+	}
+	rule := func(name string, enabled bool, source string) *types.PolicyRule {
+		return &types.PolicyRule{
+			Name:          name,
+			Enabled:       enabled,
+			Sources:       []string{source},
+			Destinations:  []string{source},
+			Bidirectional: true,
+			Action:        types.PolicyTrafficActionAccept,
+		}
+	}
+
+	both := savePolicy("both checks", true, []string{checkA.ID, checkB.ID}, rule("rule", true, "groupA"))
+	second := savePolicy("second", true, []string{checkA.ID}, rule("second rule", true, "groupA"))
+	savePolicy("other group", true, []string{checkB.ID}, rule("rule", true, "groupB"))
+	savePolicy("disabled", false, []string{checkB.ID}, rule("rule", true, "groupA"))
+	savePolicy("disabled rule", true, []string{checkB.ID}, rule("rule", false, "groupA"))
+	savePolicy("no checks", true, nil, rule("rule", true, "groupA"))
+
+	_, err = manager.GetPeerPostureContext(context.Background(), account.Id, "unknownUser", peer1.ID)
+	require.Error(t, err)
+
+	sources, err := manager.GetPeerPostureContext(context.Background(), account.Id, userID, peer1.ID)
+	require.NoError(t, err)
+	require.Len(t, sources, 3)
+
+	expected := []struct {
+		checkID, policyID, ruleName string
+	}{
+		{checkA.ID, both.ID, "rule"},
+		{checkB.ID, both.ID, "rule"},
+		{checkA.ID, second.ID, "second rule"},
+	}
+	for _, want := range expected {
+		assert.True(t, slices.ContainsFunc(sources, func(source *types.PeerPostureCheckSource) bool {
+			return source.Checks.ID == want.checkID && source.PolicyID == want.policyID && source.RuleName == want.ruleName
+		}), "missing check %s of policy %s", want.checkID, want.policyID)
+	}
+
+	sources, err = manager.GetPeerPostureContext(context.Background(), account.Id, userID, "unknownPeer")
+	require.Error(t, err)
+	assert.Empty(t, sources)
+}
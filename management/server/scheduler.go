@@ -2,10 +2,13 @@ package server
 
 import (
 	"context"
+	"maps"
 	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/management/server/types"
 )
 
 // Scheduler is an interface which implementations can schedule and cancel jobs
@@ -14,6 +17,7 @@ type Scheduler interface {
 	CancelAll(ctx context.Context)
 	Schedule(ctx context.Context, in time.Duration, ID string, job func() (nextRunIn time.Duration, reschedule bool))
 	IsSchedulerRunning(ID string) bool
+	JobsHealth() map[string]types.ScheduledJobHealth
 }
 
 // MockScheduler is a mock implementation of  Scheduler
@@ -22,6 +26,7 @@ type MockScheduler struct {
 	CancelAllFunc          func(ctx context.Context)
 	ScheduleFunc           func(ctx context.Context, in time.Duration, ID string, job func() (nextRunIn time.Duration, reschedule bool))
 	IsSchedulerRunningFunc func(ID string) bool
+	JobsHealthFunc         func() map[string]types.ScheduledJobHealth
 }
 
 // Cancel mocks the Cancel function of the Scheduler interface
@@ -59,11 +64,21 @@ func (mock *MockScheduler) IsSchedulerRunning(ID string) bool {
 	return false
 }
 
+// JobsHealth mocks the JobsHealth function of the Scheduler interface
+func (mock *MockScheduler) JobsHealth() map[string]types.ScheduledJobHealth {
+	if mock.JobsHealthFunc != nil {
+		return mock.JobsHealthFunc()
+	}
+	return nil
+}
+
 // DefaultScheduler is a generic structure that allows to schedule jobs (functions) to run in the future and cancel them.
 type DefaultScheduler struct {
 	// jobs map holds cancellation channels indexed by the job ID
 	jobs map[string]chan struct{}
-	mu   *sync.Mutex
+	// health holds the next and last run times of the scheduled jobs indexed by the job ID
+	health map[string]types.ScheduledJobHealth
+	mu     *sync.Mutex
 }
 
 func (wm *DefaultScheduler) CancelAll(ctx context.Context) {
@@ -78,8 +93,9 @@ func (wm *DefaultScheduler) CancelAll(ctx context.Context) {
 // NewDefaultScheduler creates an instance of a DefaultScheduler
 func NewDefaultScheduler() *DefaultScheduler {
 	return &DefaultScheduler{
-		jobs: make(map[string]chan struct{}),
-		mu:   &sync.Mutex{},
+		jobs:   make(map[string]chan struct{}),
+		health: make(map[string]types.ScheduledJobHealth),
+		mu:     &sync.Mutex{},
 	}
 }
 
@@ -87,6 +103,7 @@ func (wm *DefaultScheduler) cancel(ctx context.Context, ID string) bool {
 	cancel, ok := wm.jobs[ID]
 	if ok {
 		delete(wm.jobs, ID)
+		delete(wm.health, ID)
 		close(cancel)
 		log.WithContext(ctx).Debugf("cancelled scheduled job %s", ID)
 	}
@@ -119,6 +136,7 @@ func (wm *DefaultScheduler) Schedule(ctx context.Context, in time.Duration, ID s
 	ticker := time.NewTicker(in)
 
 	wm.jobs[ID] = cancel
+	wm.health[ID] = types.ScheduledJobHealth{NextRun: time.Now().Add(in)}
 	log.WithContext(ctx).Debugf("scheduled a job %s to run in %s. There are %d total jobs scheduled.", ID, in.String(), len(wm.jobs))
 	go func() {
 		for {
@@ -137,10 +155,12 @@ func (wm *DefaultScheduler) Schedule(ctx context.Context, in time.Duration, ID s
 					wm.mu.Lock()
 					defer wm.mu.Unlock()
 					delete(wm.jobs, ID)
+					delete(wm.health, ID)
 					log.WithContext(ctx).Debugf("job %s is not scheduled to run again", ID)
 					ticker.Stop()
 					return
 				}
+				wm.recordRun(ID, cancel, runIn)
 				// we need this comparison to avoid resetting the ticker with the same duration and missing the current elapsesed time
 				if runIn != in {
 					ticker.Reset(runIn)
@@ -162,3 +182,24 @@ func (wm *DefaultScheduler) IsSchedulerRunning(ID string) bool {
 	_, ok := wm.jobs[ID]
 	return ok
 }
+
+// recordRun stores the run times of the job unless it was canceled in the meantime
+func (wm *DefaultScheduler) recordRun(ID string, cancel chan struct{}, nextRunIn time.Duration) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	if wm.jobs[ID] != cancel {
+		return
+	}
+
+	now := time.Now()
+	wm.health[ID] = types.ScheduledJobHealth{NextRun: now.Add(nextRunIn), LastRun: now}
+}
+
+// JobsHealth returns the next and last run times of the scheduled jobs indexed by the job ID
+func (wm *DefaultScheduler) JobsHealth() map[string]types.ScheduledJobHealth {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	return maps.Clone(wm.health)
+}
@@ -150,3 +150,40 @@ func TestScheduler_Schedule(t *testing.T) {
 	scheduler.cancel(context.Background(), jobID)
 
 }
+
+func TestScheduler_JobsHealth(t *testing.T) {
+	scheduler := NewDefaultScheduler()
+	jobID := "test-scheduler-job"
+	ran := make(chan struct{}, 1)
+
+	start := time.Now()
+	scheduler.Schedule(context.Background(), 10*time.Millisecond, jobID, func() (nextRunIn time.Duration, reschedule bool) {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		return time.Hour, true
+	})
+	defer scheduler.CancelAll(context.Background())
+
+	health, ok := scheduler.JobsHealth()[jobID]
+	assert.True(t, ok)
+	assert.True(t, health.LastRun.IsZero())
+	assert.WithinDuration(t, start.Add(10*time.Millisecond), health.NextRun, time.Second)
+
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out while waiting for the job to run")
+	}
+
+	assert.Eventually(t, func() bool {
+		return !scheduler.JobsHealth()[jobID].LastRun.IsZero()
+	}, time.Second, 5*time.Millisecond)
+	health = scheduler.JobsHealth()[jobID]
+	assert.WithinDuration(t, health.LastRun.Add(time.Hour), health.NextRun, time.Second)
+	assert.False(t, health.IsStuck(time.Now()))
+
+	scheduler.Cancel(context.Background(), []string{jobID})
+	assert.Empty(t, scheduler.JobsHealth())
+}
@@ -52,9 +52,10 @@ type SetupKeyUpdateOperation struct {
 }
 
 // CreateSetupKey generates a new setup key with a given name, type, list of groups IDs to auto-assign to peers registered with this key,
-// and adds it to the specified account. A list of autoGroups IDs can be empty.
+// and adds it to the specified account. A list of autoGroups IDs can be empty. The requestable groups of the options
+// can only be set by users allowed to update groups.
 func (am *DefaultAccountManager) CreateSetupKey(ctx context.Context, accountID string, keyName string, keyType types.SetupKeyType,
-	expiresIn time.Duration, autoGroups []string, usageLimit int, userID string, ephemeral bool, allowExtraDNSLabels bool) (*types.SetupKey, error) {
+	expiresIn time.Duration, autoGroups []string, usageLimit int, userID string, opts types.SetupKeyOptions) (*types.SetupKey, error) {
 
 	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.SetupKeys, operations.Create)
 	if err != nil {
@@ -64,6 +65,14 @@ func (am *DefaultAccountManager) CreateSetupKey(ctx context.Context, accountID s
 		return nil, status.NewPermissionDeniedError()
 	}
 
+	var canAssignGroups bool
+	if len(opts.RequestableGroups) > 0 {
+		canAssignGroups, err = am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Groups, operations.Update)
+		if err != nil {
+			return nil, status.NewPermissionValidationError(err)
+		}
+	}
+
 	var setupKey *types.SetupKey
 	var plainKey string
 	var eventsToStore []func()
@@ -73,8 +82,27 @@ func (am *DefaultAccountManager) CreateSetupKey(ctx context.Context, accountID s
 			return status.Errorf(status.InvalidArgument, "invalid auto groups: %v", err)
 		}
 
-		setupKey, plainKey = types.GenerateSetupKey(keyName, keyType, expiresIn, autoGroups, usageLimit, ephemeral, allowExtraDNSLabels)
+		if err = validateSetupKeyRequestableGroups(ctx, transaction, accountID, opts.RequestableGroups, canAssignGroups); err != nil {
+			return err
+		}
+
+		if opts.PeerExpiration.Enabled() {
+			settings, err := transaction.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+			if err != nil {
+				return err
+			}
+			if !settings.SetupKeyPeerExpirationAllowed {
+				return status.Errorf(status.PreconditionFailed, "the account doesn't allow the expiration of the peers added with a setup key, these peers can't re-authenticate with SSO")
+			}
+		}
+
+		setupKey, plainKey = types.GenerateSetupKey(keyName, keyType, expiresIn, autoGroups, usageLimit, opts.Ephemeral, opts.AllowExtraDNSLabels)
 		setupKey.AccountID = accountID
+		setupKey.RequiresApproval = opts.RequiresApproval
+		setupKey.AllowOutdatedOSVersion = opts.AllowOutdatedOSVersion
+		setupKey.ManagedPeers = opts.ManagedPeers
+		setupKey.PeerExpirationDefaults = opts.PeerExpiration.Copy()
+		setupKey.RequestableGroups = slices.Clone(opts.RequestableGroups)
 
 		events := am.prepareSetupKeyEvents(ctx, transaction, accountID, userID, autoGroups, nil, setupKey)
 		eventsToStore = append(eventsToStore, events...)
@@ -100,6 +128,7 @@ func (am *DefaultAccountManager) CreateSetupKey(ctx context.Context, accountID s
 // Due to the unique nature of a SetupKey certain properties must not be overwritten
 // (e.g. the key itself, creation date, ID, etc).
 // These properties are overwritten: AutoGroups, Revoked (only from false to true), and the UpdatedAt. The rest is copied from the existing key.
+// RequestableGroups are overwritten when not nil, only with groups the user is allowed to assign.
 func (am *DefaultAccountManager) SaveSetupKey(ctx context.Context, accountID string, keyToSave *types.SetupKey, userID string) (*types.SetupKey, error) {
 	if keyToSave == nil {
 		return nil, status.Errorf(status.InvalidArgument, "provided setup key to update is nil")
@@ -113,6 +142,14 @@ func (am *DefaultAccountManager) SaveSetupKey(ctx context.Context, accountID str
 		return nil, status.NewPermissionDeniedError()
 	}
 
+	var canAssignGroups bool
+	if len(keyToSave.RequestableGroups) > 0 {
+		canAssignGroups, err = am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.Groups, operations.Update)
+		if err != nil {
+			return nil, status.NewPermissionValidationError(err)
+		}
+	}
+
 	var oldKey *types.SetupKey
 	var newKey *types.SetupKey
 	var eventsToStore []func()
@@ -131,12 +168,20 @@ func (am *DefaultAccountManager) SaveSetupKey(ctx context.Context, accountID str
 			return status.Errorf(status.InvalidArgument, "can't un-revoke a revoked setup key")
 		}
 
-		// only auto groups, revoked status (from false to true) can be updated
+		// only auto groups, requestable groups, revoked status (from false to true) can be updated
 		newKey = oldKey.Copy()
 		newKey.AutoGroups = keyToSave.AutoGroups
 		newKey.Revoked = keyToSave.Revoked
 		newKey.UpdatedAt = time.Now().UTC()
 
+		if keyToSave.RequestableGroups != nil {
+			addedRequestable := util.Difference(keyToSave.RequestableGroups, oldKey.RequestableGroups)
+			if err = validateSetupKeyRequestableGroups(ctx, transaction, accountID, addedRequestable, canAssignGroups); err != nil {
+				return err
+			}
+			newKey.RequestableGroups = keyToSave.RequestableGroups
+		}
+
 		addedGroups := util.Difference(newKey.AutoGroups, oldKey.AutoGroups)
 		removedGroups := util.Difference(oldKey.AutoGroups, newKey.AutoGroups)
 
@@ -196,6 +241,30 @@ func (am *DefaultAccountManager) GetSetupKey(ctx context.Context, accountID, use
 	return setupKey, nil
 }
 
+// ValidateSetupKey checks whether the plain setup key can be used to register a peer without consuming it.
+// An unknown key is reported the same way as a revoked, expired or overused one.
+func (am *DefaultAccountManager) ValidateSetupKey(ctx context.Context, setupKey string) (*types.SetupKeyValidation, error) {
+	sk, err := am.Store.GetSetupKeyBySecret(ctx, store.LockingStrengthNone, types.HashSetupKey(setupKey))
+	if err != nil {
+		// the store reports unknown keys as a failed precondition
+		if s, ok := status.FromError(err); ok && (s.Type() == status.PreconditionFailed || s.Type() == status.NotFound) {
+			return &types.SetupKeyValidation{}, nil
+		}
+		return nil, err
+	}
+
+	if !sk.IsValid() {
+		return &types.SetupKeyValidation{}, nil
+	}
+
+	return &types.SetupKeyValidation{
+		Valid:               true,
+		RemainingUses:       sk.RemainingUses(),
+		ExpiresAt:           sk.ExpiresAt,
+		AllowExtraDNSLabels: sk.AllowExtraDNSLabels,
+	}, nil
+}
+
 // DeleteSetupKey removes the setup key from the account
 func (am *DefaultAccountManager) DeleteSetupKey(ctx context.Context, accountID, userID, keyID string) error {
 	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, userID, modules.SetupKeys, operations.Delete)
@@ -245,6 +314,24 @@ func validateSetupKeyAutoGroups(ctx context.Context, transaction store.Store, ac
 	return nil
 }
 
+// validateSetupKeyRequestableGroups checks that the groups added to the requestable groups of a setup key exist and
+// that the user could assign them to peers directly. A setup key must not let its peers join groups its editor can't
+func validateSetupKeyRequestableGroups(ctx context.Context, transaction store.Store, accountID string, groupIDs []string, canAssignGroups bool) error {
+	if len(groupIDs) == 0 {
+		return nil
+	}
+
+	if !canAssignGroups {
+		return status.Errorf(status.PermissionDenied, "user is not allowed to assign the requestable groups of the setup key")
+	}
+
+	if err := validateSetupKeyAutoGroups(ctx, transaction, accountID, groupIDs); err != nil {
+		return status.Errorf(status.InvalidArgument, "invalid requestable groups: %v", err)
+	}
+
+	return nil
+}
+
 // prepareSetupKeyEvents prepares a list of event functions to be stored.
 func (am *DefaultAccountManager) prepareSetupKeyEvents(ctx context.Context, transaction store.Store, accountID, userID string, addedGroups, removedGroups []string, key *types.SetupKey) []func() {
 	var eventsToStore []func()
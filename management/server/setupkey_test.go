@@ -14,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/netbirdio/netbird/management/server/activity"
+	"github.com/netbirdio/netbird/management/server/store"
 	"github.com/netbirdio/netbird/management/server/types"
 	"github.com/netbirdio/netbird/shared/auth"
 )
@@ -50,7 +51,7 @@ func TestDefaultAccountManager_SaveSetupKey(t *testing.T) {
 	keyName := "my-test-key"
 
 	key, err := manager.CreateSetupKey(context.Background(), account.Id, keyName, types.SetupKeyReusable, expiresIn, []string{},
-		types.SetupKeyUnlimitedUsage, userID, false, false)
+		types.SetupKeyUnlimitedUsage, userID, types.SetupKeyOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -168,7 +169,7 @@ func TestDefaultAccountManager_CreateSetupKey(t *testing.T) {
 	for _, tCase := range []testCase{testCase1, testCase2, testCase3} {
 		t.Run(tCase.name, func(t *testing.T) {
 			key, err := manager.CreateSetupKey(context.Background(), account.Id, tCase.expectedKeyName, types.SetupKeyReusable, expiresIn,
-				tCase.expectedGroups, types.SetupKeyUnlimitedUsage, userID, false, false)
+				tCase.expectedGroups, types.SetupKeyUnlimitedUsage, userID, types.SetupKeyOptions{})
 
 			if tCase.expectedFailure {
 				if err == nil {
@@ -210,7 +211,7 @@ func TestGetSetupKeys(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	plainKey, err := manager.CreateSetupKey(context.Background(), account.Id, "key1", types.SetupKeyReusable, time.Hour, nil, types.SetupKeyUnlimitedUsage, userID, false, false)
+	plainKey, err := manager.CreateSetupKey(context.Background(), account.Id, "key1", types.SetupKeyReusable, time.Hour, nil, types.SetupKeyUnlimitedUsage, userID, types.SetupKeyOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -436,7 +437,7 @@ func TestSetupKeyAccountPeersUpdate(t *testing.T) {
 			close(done)
 		}()
 
-		setupKey, err = manager.CreateSetupKey(context.Background(), account.Id, "key1", types.SetupKeyReusable, time.Hour, nil, 999, userID, false, false)
+		setupKey, err = manager.CreateSetupKey(context.Background(), account.Id, "key1", types.SetupKeyReusable, time.Hour, nil, 999, userID, types.SetupKeyOptions{})
 		assert.NoError(t, err)
 
 		select {
@@ -477,7 +478,7 @@ func TestDefaultAccountManager_CreateSetupKey_ShouldNotAllowToUpdateRevokedKey(t
 		t.Fatal(err)
 	}
 
-	key, err := manager.CreateSetupKey(context.Background(), account.Id, "testName", types.SetupKeyReusable, time.Hour, nil, types.SetupKeyUnlimitedUsage, userID, false, false)
+	key, err := manager.CreateSetupKey(context.Background(), account.Id, "testName", types.SetupKeyReusable, time.Hour, nil, types.SetupKeyUnlimitedUsage, userID, types.SetupKeyOptions{})
 	assert.NoError(t, err)
 
 	// revoke the key
@@ -492,3 +493,38 @@ func TestDefaultAccountManager_CreateSetupKey_ShouldNotAllowToUpdateRevokedKey(t
 	assert.Error(t, err, "should not allow to update revoked key")
 
 }
+
+func TestDefaultAccountManager_ValidateSetupKey(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	userID := "testingUser"
+	account, err := manager.GetOrCreateAccountByUser(context.Background(), auth.UserAuth{UserId: userID})
+	require.NoError(t, err)
+
+	key, err := manager.CreateSetupKey(context.Background(), account.Id, "testName", types.SetupKeyReusable, time.Hour, nil, 3, userID, types.SetupKeyOptions{AllowExtraDNSLabels: true})
+	require.NoError(t, err)
+
+	validation, err := manager.ValidateSetupKey(context.Background(), strings.ToLower(key.Key))
+	require.NoError(t, err)
+	assert.True(t, validation.Valid)
+	assert.Equal(t, 3, validation.RemainingUses)
+	assert.True(t, validation.AllowExtraDNSLabels)
+	require.NotNil(t, validation.ExpiresAt)
+
+	storedKey, err := manager.Store.GetSetupKeyByID(context.Background(), store.LockingStrengthNone, account.Id, key.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 0, storedKey.UsedTimes, "validation must not consume the key")
+
+	validation, err = manager.ValidateSetupKey(context.Background(), "unknown-key")
+	require.NoError(t, err)
+	assert.Equal(t, &types.SetupKeyValidation{}, validation)
+
+	storedKey.Revoked = true
+	_, err = manager.SaveSetupKey(context.Background(), account.Id, storedKey, userID)
+	require.NoError(t, err)
+
+	validation, err = manager.ValidateSetupKey(context.Background(), key.Key)
+	require.NoError(t, err)
+	assert.Equal(t, &types.SetupKeyValidation{}, validation, "an invalid key must not be distinguishable from an unknown one")
+}
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -126,7 +127,7 @@ func NewSqlStore(ctx context.Context, db *gorm.DB, storeEngine types.Engine, met
 		&types.Account{}, &types.Policy{}, &types.PolicyRule{}, &route.Route{}, &nbdns.NameServerGroup{},
 		&installation{}, &types.ExtraSettings{}, &posture.Checks{}, &nbpeer.NetworkAddress{},
 		&networkTypes.Network{}, &routerTypes.NetworkRouter{}, &resourceTypes.NetworkResource{}, &types.AccountOnboarding{},
-		&types.Job{}, &zones.Zone{}, &records.Record{}, &types.UserInviteRecord{},
+		&types.Job{}, &zones.Zone{}, &records.Record{}, &types.UserInviteRecord{}, &nbpeer.UsageSample{},
 	)
 	if err != nil {
 		return nil, fmt.Errorf("auto migratePreAuto: %w", err)
@@ -278,6 +279,22 @@ func (s *SqlStore) SaveAccount(ctx context.Context, account *types.Account) erro
 		}
 	}
 
+	for i := range account.PeersG {
+		if err := account.PeersG[i].EncryptSensitiveData(s.fieldEncrypt); err != nil {
+			return fmt.Errorf("encrypt peer: %w", err)
+		}
+	}
+
+	if account.Settings != nil {
+		settings := account.Settings.Copy()
+		if err := settings.EncryptSensitiveData(s.fieldEncrypt); err != nil {
+			return fmt.Errorf("encrypt settings: %w", err)
+		}
+		plainSettings := account.Settings
+		account.Settings = settings
+		defer func() { account.Settings = plainSettings }()
+	}
+
 	for _, group := range account.GroupsG {
 		group.StoreGroupPeers()
 	}
@@ -426,6 +443,9 @@ func (s *SqlStore) SavePeer(ctx context.Context, accountID string, peer *nbpeer.
 	// To maintain data integrity, we create a copy of the peer's to prevent unintended updates to other fields.
 	peerCopy := peer.Copy()
 	peerCopy.AccountID = accountID
+	if err := peerCopy.EncryptSensitiveData(s.fieldEncrypt); err != nil {
+		return fmt.Errorf("encrypt peer: %w", err)
+	}
 
 	err := s.transaction(func(tx *gorm.DB) error {
 		// check if peer exists before saving
@@ -503,6 +523,307 @@ func (s *SqlStore) SavePeerStatus(ctx context.Context, accountID, peerID string,
 	return nil
 }
 
+// SavePeerPendingApprovalSince updates the time the peer started requiring approval
+func (s *SqlStore) SavePeerPendingApprovalSince(ctx context.Context, accountID, peerID string, since time.Time) error {
+	result := s.db.Model(&nbpeer.Peer{}).
+		Where(accountAndIDQueryCondition, accountID, peerID).
+		Update("peer_status_pending_approval_since", since)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to save peer pending approval time to store: %v", result.Error)
+		return status.Errorf(status.Internal, "failed to save peer pending approval time to store")
+	}
+
+	if result.RowsAffected == 0 {
+		return status.Errorf(status.NotFound, peerNotFoundFMT, peerID)
+	}
+
+	return nil
+}
+
+// SavePeerFirstConnectedAt stores the time the peer connected for the first time.
+// It is a no-op when the peer already has a first connection time
+func (s *SqlStore) SavePeerFirstConnectedAt(ctx context.Context, accountID, peerID string, connectedAt time.Time) error {
+	result := s.db.Model(&nbpeer.Peer{}).
+		Where(accountAndIDQueryCondition+" AND first_connected_at IS NULL", accountID, peerID).
+		Update("first_connected_at", connectedAt)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to save peer first connection time to store: %v", result.Error)
+		return status.Errorf(status.Internal, "failed to save peer first connection time to store")
+	}
+
+	return nil
+}
+
+// SavePeerMeta stores the system meta of the peer without touching its other fields
+func (s *SqlStore) SavePeerMeta(ctx context.Context, accountID, peerID string, meta nbpeer.PeerSystemMeta) error {
+	var peerCopy nbpeer.Peer
+	peerCopy.Meta = meta
+
+	fieldsToUpdate := []string{
+		"meta_hostname", "meta_go_os", "meta_kernel", "meta_core", "meta_platform", "meta_os", "meta_os_version",
+		"meta_wt_version", "meta_ui_version", "meta_kernel_version", "meta_network_addresses", "meta_system_serial_number",
+		"meta_system_product_name", "meta_system_manufacturer", "meta_environment", "meta_flags", "meta_files",
+		"meta_relay_address",
+	}
+	result := s.db.Model(&nbpeer.Peer{}).
+		Select(fieldsToUpdate).
+		Where(accountAndIDQueryCondition, accountID, peerID).
+		Updates(&peerCopy)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to save peer meta to store: %v", result.Error)
+		return status.Errorf(status.Internal, "failed to save peer meta to store")
+	}
+
+	if result.RowsAffected == 0 {
+		return status.Errorf(status.NotFound, peerNotFoundFMT, peerID)
+	}
+
+	return nil
+}
+
+// SavePeerConnectionPort stores the source port the peer connected from, a port of 0 clears it
+func (s *SqlStore) SavePeerConnectionPort(ctx context.Context, accountID, peerID string, port uint16) error {
+	result := s.db.Model(&nbpeer.Peer{}).
+		Where(accountAndIDQueryCondition, accountID, peerID).
+		Update("location_connection_port", port)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to save peer connection port to store: %v", result.Error)
+		return status.Errorf(status.Internal, "failed to save peer connection port to store")
+	}
+
+	if result.RowsAffected == 0 {
+		return status.Errorf(status.NotFound, peerNotFoundFMT, peerID)
+	}
+
+	return nil
+}
+
+// SavePeerAppliedNetworkSerials stores the serials of the network maps the peers applied, keyed by the WireGuard
+// public key of the peer, in a single transaction. Serials older than the stored ones and unknown peers are skipped
+func (s *SqlStore) SavePeerAppliedNetworkSerials(ctx context.Context, serials map[string]uint64) error {
+	if len(serials) == 0 {
+		return nil
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for peerKey, serial := range serials {
+			result := tx.Model(&nbpeer.Peer{}).
+				Where(GetKeyQueryCondition(s)+" AND COALESCE(applied_network_serial, 0) < ?", peerKey, serial).
+				Update("applied_network_serial", serial)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithContext(ctx).Errorf("failed to save peer applied network serials to store: %v", err)
+		return status.Errorf(status.Internal, "failed to save peer applied network serials to store")
+	}
+
+	return nil
+}
+
+// SavePeerReportedErrors replaces the errors reported by the peer
+func (s *SqlStore) SavePeerReportedErrors(ctx context.Context, accountID, peerID string, reportedErrors []nbpeer.ReportedError) error {
+	var peerCopy nbpeer.Peer
+	peerCopy.ReportedErrors = reportedErrors
+	result := s.db.Model(&nbpeer.Peer{}).
+		Select("reported_errors").
+		Where(accountAndIDQueryCondition, accountID, peerID).
+		Updates(&peerCopy)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to save peer reported errors to store: %v", result.Error)
+		return status.Errorf(status.Internal, "failed to save peer reported errors to store")
+	}
+
+	if result.RowsAffected == 0 {
+		return status.Errorf(status.NotFound, peerNotFoundFMT, peerID)
+	}
+
+	return nil
+}
+
+// SavePeerRelayAddress updates the address of the relay server the peer is connected to
+func (s *SqlStore) SavePeerRelayAddress(ctx context.Context, accountID, peerID, relayAddress string) error {
+	result := s.db.Model(&nbpeer.Peer{}).
+		Where(accountAndIDQueryCondition, accountID, peerID).
+		Update("meta_relay_address", relayAddress)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to save peer relay address to store: %v", result.Error)
+		return status.Errorf(status.Internal, "failed to save peer relay address to store")
+	}
+
+	if result.RowsAffected == 0 {
+		return status.Errorf(status.NotFound, peerNotFoundFMT, peerID)
+	}
+
+	return nil
+}
+
+// SavePeerOwnerEmail updates the email of the user that owns the peer
+func (s *SqlStore) SavePeerOwnerEmail(ctx context.Context, accountID, peerID, email string) error {
+	peer := nbpeer.Peer{OwnerEmail: email}
+	if err := peer.EncryptSensitiveData(s.fieldEncrypt); err != nil {
+		return fmt.Errorf("encrypt peer: %w", err)
+	}
+
+	result := s.db.Model(&nbpeer.Peer{}).
+		Where(accountAndIDQueryCondition, accountID, peerID).
+		Update("owner_email", peer.OwnerEmail)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to save peer owner email to store: %v", result.Error)
+		return status.Errorf(status.Internal, "failed to save peer owner email to store")
+	}
+
+	if result.RowsAffected == 0 {
+		return status.Errorf(status.NotFound, peerNotFoundFMT, peerID)
+	}
+
+	return nil
+}
+
+// SavePeerLastHandshake updates the last WireGuard handshake reported by the peer
+func (s *SqlStore) SavePeerLastHandshake(ctx context.Context, accountID, peerID string, lastHandshake time.Time) error {
+	result := s.db.Model(&nbpeer.Peer{}).
+		Where(accountAndIDQueryCondition, accountID, peerID).
+		Update("peer_status_last_handshake", lastHandshake)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to save peer last handshake to store: %v", result.Error)
+		return status.Errorf(status.Internal, "failed to save peer last handshake to store")
+	}
+
+	if result.RowsAffected == 0 {
+		return status.Errorf(status.NotFound, peerNotFoundFMT, peerID)
+	}
+
+	return nil
+}
+
+// SavePeerUsageCapExceeded updates whether the peer exceeded the account usage cap
+func (s *SqlStore) SavePeerUsageCapExceeded(ctx context.Context, accountID, peerID string, exceeded bool) error {
+	result := s.db.Model(&nbpeer.Peer{}).
+		Where(accountAndIDQueryCondition, accountID, peerID).
+		Update("peer_status_usage_cap_exceeded", exceeded)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to save peer usage cap state to store: %v", result.Error)
+		return status.Errorf(status.Internal, "failed to save peer usage cap state to store")
+	}
+
+	if result.RowsAffected == 0 {
+		return status.Errorf(status.NotFound, peerNotFoundFMT, peerID)
+	}
+
+	return nil
+}
+
+// AddPeerUsageSample stores a usage sample reported by a peer
+func (s *SqlStore) AddPeerUsageSample(ctx context.Context, sample *nbpeer.UsageSample) error {
+	result := s.db.Create(sample)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to save peer usage sample to store: %v", result.Error)
+		return status.Errorf(status.Internal, "failed to save peer usage sample to store")
+	}
+	return nil
+}
+
+// GetPeerLastUsageSample returns the most recent usage sample of a peer
+func (s *SqlStore) GetPeerLastUsageSample(ctx context.Context, lockStrength LockingStrength, accountID, peerID string) (*nbpeer.UsageSample, error) {
+	tx := s.db
+	if lockStrength != LockingStrengthNone {
+		tx = tx.Clauses(clause.Locking{Strength: string(lockStrength)})
+	}
+
+	var sample nbpeer.UsageSample
+	result := tx.
+		Where(accountAndPeerIDQueryCondition, accountID, peerID).
+		Order("timestamp DESC, id DESC").
+		Take(&sample)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, status.Errorf(status.NotFound, "usage sample of peer %s not found", peerID)
+		}
+		log.WithContext(ctx).Errorf("failed to get peer usage sample from store: %v", result.Error)
+		return nil, status.Errorf(status.Internal, "failed to get peer usage sample from store")
+	}
+
+	return &sample, nil
+}
+
+// GetPeerUsage returns the bytes received and sent by a peer in the samples reported since the given time
+func (s *SqlStore) GetPeerUsage(ctx context.Context, lockStrength LockingStrength, accountID, peerID string, since time.Time) (int64, int64, error) {
+	tx := s.db
+	if lockStrength != LockingStrengthNone {
+		tx = tx.Clauses(clause.Locking{Strength: string(lockStrength)})
+	}
+
+	var usage struct {
+		RxBytes int64
+		TxBytes int64
+	}
+	result := tx.Model(&nbpeer.UsageSample{}).
+		Select("COALESCE(SUM(rx_bytes), 0) AS rx_bytes, COALESCE(SUM(tx_bytes), 0) AS tx_bytes").
+		Where(accountAndPeerIDQueryCondition+" AND timestamp > ?", accountID, peerID, since).
+		Scan(&usage)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to get peer usage from store: %v", result.Error)
+		return 0, 0, status.Errorf(status.Internal, "failed to get peer usage from store")
+	}
+
+	return usage.RxBytes, usage.TxBytes, nil
+}
+
+// DeleteUsageSamplesBefore deletes the usage samples of all the peers reported before the given time
+func (s *SqlStore) DeleteUsageSamplesBefore(ctx context.Context, before time.Time) error {
+	result := s.db.Where("timestamp < ?", before).Delete(&nbpeer.UsageSample{})
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to delete peer usage samples from store: %v", result.Error)
+		return status.Errorf(status.Internal, "failed to delete peer usage samples from store")
+	}
+	return nil
+}
+
+// RollupUsageSamples merges the usage samples reported before the given time into one sample per peer and bucket,
+// see nbpeer.RollupUsageSamples. Every peer is rolled up in its own transaction, locking its samples, so that
+// concurrent rollups of several management instances don't count the same samples twice
+func (s *SqlStore) RollupUsageSamples(ctx context.Context, before time.Time, bucket time.Duration) error {
+	var peerIDs []string
+	result := s.db.Model(&nbpeer.UsageSample{}).Where("timestamp < ?", before).Distinct().Pluck("peer_id", &peerIDs)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to get peers with usage samples from store: %v", result.Error)
+		return status.Errorf(status.Internal, "failed to get peer usage samples from store")
+	}
+
+	for _, peerID := range peerIDs {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var samples []*nbpeer.UsageSample
+			err := tx.Clauses(clause.Locking{Strength: string(LockingStrengthUpdate)}).
+				Where("peer_id = ? AND timestamp < ?", peerID, before).
+				Order("timestamp, id").
+				Find(&samples).Error
+			if err != nil {
+				return err
+			}
+
+			merged, replaced := nbpeer.RollupUsageSamples(samples, bucket)
+			if len(replaced) == 0 {
+				return nil
+			}
+
+			if err = tx.Delete(&nbpeer.UsageSample{}, replaced).Error; err != nil {
+				return err
+			}
+			return tx.Create(merged).Error
+		})
+		if err != nil {
+			log.WithContext(ctx).Errorf("failed to roll up usage samples of peer %s: %v", peerID, err)
+			return status.Errorf(status.Internal, "failed to roll up peer usage samples")
+		}
+	}
+
+	return nil
+}
+
 func (s *SqlStore) SavePeerLocation(ctx context.Context, accountID string, peerWithLocation *nbpeer.Peer) error {
 	// To maintain data integrity, we create a copy of the peer's location to prevent unintended updates to other fields.
 	var peerCopy nbpeer.Peer
@@ -529,7 +850,10 @@ func (s *SqlStore) SavePeerLocation(ctx context.Context, accountID string, peerW
 func (s *SqlStore) ApproveAccountPeers(ctx context.Context, accountID string) (int, error) {
 	result := s.db.Model(&nbpeer.Peer{}).
 		Where("account_id = ? AND peer_status_requires_approval = ?", accountID, true).
-		Update("peer_status_requires_approval", false)
+		Updates(map[string]any{
+			"peer_status_requires_approval":      false,
+			"peer_status_pending_approval_since": time.Time{},
+		})
 	if result.Error != nil {
 		return 0, status.Errorf(status.Internal, "failed to approve pending account peers: %v", result.Error)
 	}
@@ -1115,8 +1439,17 @@ func (s *SqlStore) getAccountGorm(ctx context.Context, accountID string) (*types
 	}
 	account.SetupKeysG = nil
 
+	if account.Settings != nil {
+		if err := account.Settings.DecryptSensitiveData(s.fieldEncrypt); err != nil {
+			return nil, fmt.Errorf("decrypt settings: %w", err)
+		}
+	}
+
 	account.Peers = make(map[string]*nbpeer.Peer, len(account.PeersG))
 	for _, peer := range account.PeersG {
+		if err := peer.DecryptSensitiveData(s.fieldEncrypt); err != nil {
+			return nil, fmt.Errorf("decrypt peer: %w", err)
+		}
 		account.Peers[peer.ID] = &peer
 	}
 	account.PeersG = nil
@@ -1402,6 +1735,9 @@ func (s *SqlStore) getAccountPgx(ctx context.Context, accountID string) (*types.
 	account.Peers = make(map[string]*nbpeer.Peer, len(account.PeersG))
 	for i := range account.PeersG {
 		peer := &account.PeersG[i]
+		if err := peer.DecryptSensitiveData(s.fieldEncrypt); err != nil {
+			return nil, fmt.Errorf("decrypt peer: %w", err)
+		}
 		account.Peers[peer.ID] = peer
 	}
 
@@ -1472,11 +1808,13 @@ func (s *SqlStore) getAccount(ctx context.Context, accountID string) (*types.Acc
 			dns_settings_disabled_management_groups,
 			-- Embedded Settings
 			settings_peer_login_expiration_enabled, settings_peer_login_expiration,
+			settings_peer_login_expiration_lead_time, settings_peer_expiration_tolerance,
 			settings_peer_inactivity_expiration_enabled, settings_peer_inactivity_expiration,
 			settings_regular_users_view_blocked, settings_groups_propagation_enabled,
 			settings_jwt_groups_enabled, settings_jwt_groups_claim_name, settings_jwt_allow_groups,
 			settings_routing_peer_dns_resolution_enabled, settings_dns_domain, settings_network_range,
-			settings_lazy_connection_enabled,
+			settings_lazy_connection_enabled, settings_blocked_peer_owner_behavior,
+			settings_significant_peer_meta_fields, settings_network_map_connected_peers_only,
 			-- Embedded ExtraSettings
 			settings_extra_peer_approval_enabled, settings_extra_user_approval_required,
 			settings_extra_integrated_validator, settings_extra_integrated_validator_groups
@@ -1485,6 +1823,8 @@ func (s *SqlStore) getAccount(ctx context.Context, accountID string) (*types.Acc
 	var (
 		sPeerLoginExpirationEnabled      sql.NullBool
 		sPeerLoginExpiration             sql.NullInt64
+		sPeerLoginExpirationLeadTime     sql.NullInt64
+		sPeerExpirationTolerance         sql.NullInt64
 		sPeerInactivityExpirationEnabled sql.NullBool
 		sPeerInactivityExpiration        sql.NullInt64
 		sRegularUsersViewBlocked         sql.NullBool
@@ -1496,6 +1836,9 @@ func (s *SqlStore) getAccount(ctx context.Context, accountID string) (*types.Acc
 		sDNSDomain                       sql.NullString
 		sNetworkRange                    sql.NullString
 		sLazyConnectionEnabled           sql.NullBool
+		sBlockedPeerOwnerBehavior        sql.NullString
+		sSignificantPeerMetaFields       sql.NullString
+		sNetworkMapConnectedPeersOnly    sql.NullBool
 		sExtraPeerApprovalEnabled        sql.NullBool
 		sExtraUserApprovalRequired       sql.NullBool
 		sExtraIntegratedValidator        sql.NullString
@@ -1512,11 +1855,13 @@ func (s *SqlStore) getAccount(ctx context.Context, accountID string) (*types.Acc
 		&networkIdentifier, &networkNet, &networkDns, &networkSerial,
 		&dnsSettingsDisabledGroups,
 		&sPeerLoginExpirationEnabled, &sPeerLoginExpiration,
+		&sPeerLoginExpirationLeadTime, &sPeerExpirationTolerance,
 		&sPeerInactivityExpirationEnabled, &sPeerInactivityExpiration,
 		&sRegularUsersViewBlocked, &sGroupsPropagationEnabled,
 		&sJWTGroupsEnabled, &sJWTGroupsClaimName, &sJWTAllowGroups,
 		&sRoutingPeerDNSResolutionEnabled, &sDNSDomain, &sNetworkRange,
-		&sLazyConnectionEnabled,
+		&sLazyConnectionEnabled, &sBlockedPeerOwnerBehavior,
+		&sSignificantPeerMetaFields, &sNetworkMapConnectedPeersOnly,
 		&sExtraPeerApprovalEnabled, &sExtraUserApprovalRequired,
 		&sExtraIntegratedValidator, &sExtraIntegratedValidatorGroups,
 	)
@@ -1552,6 +1897,12 @@ func (s *SqlStore) getAccount(ctx context.Context, accountID string) (*types.Acc
 	if sPeerLoginExpiration.Valid {
 		account.Settings.PeerLoginExpiration = time.Duration(sPeerLoginExpiration.Int64)
 	}
+	if sPeerLoginExpirationLeadTime.Valid {
+		account.Settings.PeerLoginExpirationLeadTime = time.Duration(sPeerLoginExpirationLeadTime.Int64)
+	}
+	if sPeerExpirationTolerance.Valid {
+		account.Settings.PeerExpirationTolerance = time.Duration(sPeerExpirationTolerance.Int64)
+	}
 	if sPeerInactivityExpirationEnabled.Valid {
 		account.Settings.PeerInactivityExpirationEnabled = sPeerInactivityExpirationEnabled.Bool
 	}
@@ -1579,9 +1930,18 @@ func (s *SqlStore) getAccount(ctx context.Context, accountID string) (*types.Acc
 	if sLazyConnectionEnabled.Valid {
 		account.Settings.LazyConnectionEnabled = sLazyConnectionEnabled.Bool
 	}
+	if sBlockedPeerOwnerBehavior.Valid {
+		account.Settings.BlockedPeerOwnerBehavior = types.BlockedPeerOwnerBehavior(sBlockedPeerOwnerBehavior.String)
+	}
 	if sJWTAllowGroups.Valid {
 		_ = json.Unmarshal([]byte(sJWTAllowGroups.String), &account.Settings.JWTAllowGroups)
 	}
+	if sSignificantPeerMetaFields.Valid {
+		_ = json.Unmarshal([]byte(sSignificantPeerMetaFields.String), &account.Settings.SignificantPeerMetaFields)
+	}
+	if sNetworkMapConnectedPeersOnly.Valid {
+		account.Settings.NetworkMapConnectedPeersOnly = sNetworkMapConnectedPeersOnly.Bool
+	}
 	if sNetworkRange.Valid {
 		_ = json.Unmarshal([]byte(sNetworkRange.String), &account.Settings.NetworkRange)
 	}
@@ -1604,7 +1964,7 @@ func (s *SqlStore) getAccount(ctx context.Context, accountID string) (*types.Acc
 
 func (s *SqlStore) getSetupKeys(ctx context.Context, accountID string) ([]types.SetupKey, error) {
 	const query = `SELECT id, account_id, key, key_secret, name, type, created_at, expires_at, updated_at, 
-	revoked, used_times, last_used, auto_groups, usage_limit, ephemeral, allow_extra_dns_labels FROM setup_keys WHERE account_id = $1`
+	revoked, used_times, last_used, auto_groups, usage_limit, ephemeral, allow_extra_dns_labels, requires_approval, allow_outdated_os_version, managed_peers, requestable_groups FROM setup_keys WHERE account_id = $1`
 	rows, err := s.pool.Query(ctx, query, accountID)
 	if err != nil {
 		return nil, err
@@ -1612,13 +1972,13 @@ func (s *SqlStore) getSetupKeys(ctx context.Context, accountID string) ([]types.
 
 	keys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (types.SetupKey, error) {
 		var sk types.SetupKey
-		var autoGroups []byte
+		var autoGroups, requestableGroups []byte
 		var skCreatedAt, expiresAt, updatedAt, lastUsed sql.NullTime
-		var revoked, ephemeral, allowExtraDNSLabels sql.NullBool
+		var revoked, ephemeral, allowExtraDNSLabels, requiresApproval, allowOutdatedOSVersion, managedPeers sql.NullBool
 		var usedTimes, usageLimit sql.NullInt64
 
 		err := row.Scan(&sk.Id, &sk.AccountID, &sk.Key, &sk.KeySecret, &sk.Name, &sk.Type, &skCreatedAt,
-			&expiresAt, &updatedAt, &revoked, &usedTimes, &lastUsed, &autoGroups, &usageLimit, &ephemeral, &allowExtraDNSLabels)
+			&expiresAt, &updatedAt, &revoked, &usedTimes, &lastUsed, &autoGroups, &usageLimit, &ephemeral, &allowExtraDNSLabels, &requiresApproval, &allowOutdatedOSVersion, &managedPeers, &requestableGroups)
 
 		if err == nil {
 			if expiresAt.Valid {
@@ -1651,11 +2011,23 @@ func (s *SqlStore) getSetupKeys(ctx context.Context, accountID string) ([]types.
 			if allowExtraDNSLabels.Valid {
 				sk.AllowExtraDNSLabels = allowExtraDNSLabels.Bool
 			}
+			if requiresApproval.Valid {
+				sk.RequiresApproval = requiresApproval.Bool
+			}
+			if allowOutdatedOSVersion.Valid {
+				sk.AllowOutdatedOSVersion = allowOutdatedOSVersion.Bool
+			}
+			if managedPeers.Valid {
+				sk.ManagedPeers = managedPeers.Bool
+			}
 			if autoGroups != nil {
 				_ = json.Unmarshal(autoGroups, &sk.AutoGroups)
 			} else {
 				sk.AutoGroups = []string{}
 			}
+			if requestableGroups != nil {
+				_ = json.Unmarshal(requestableGroups, &sk.RequestableGroups)
+			}
 		}
 		return sk, err
 	})
@@ -1666,13 +2038,13 @@ func (s *SqlStore) getSetupKeys(ctx context.Context, accountID string) ([]types.
 }
 
 func (s *SqlStore) getPeers(ctx context.Context, accountID string) ([]nbpeer.Peer, error) {
-	const query = `SELECT id, account_id, key, ip, name, dns_label, user_id, ssh_key, ssh_enabled, login_expiration_enabled,
-	inactivity_expiration_enabled, last_login, created_at, ephemeral, extra_dns_labels, allow_extra_dns_labels, meta_hostname, 
+	const query = `SELECT id, account_id, key, ip, name, description, admin_notes, dns_label, user_id, setup_key_id, owner_email, ssh_key, ssh_enabled, login_expiration_enabled,
+	inactivity_expiration_enabled, last_login, created_at, first_connected_at, applied_network_serial, ephemeral, extra_dns_labels, allow_extra_dns_labels, managed_by_setup_key_only, meta_hostname, 
 	meta_go_os, meta_kernel, meta_core, meta_platform, meta_os, meta_os_version, meta_wt_version, meta_ui_version, 
 	meta_kernel_version, meta_network_addresses, meta_system_serial_number, meta_system_product_name, meta_system_manufacturer,
-	meta_environment, meta_flags, meta_files, peer_status_last_seen, peer_status_connected, peer_status_login_expired, 
-	peer_status_requires_approval, location_connection_ip, location_country_code, location_city_name, 
-	location_geo_name_id FROM peers WHERE account_id = $1`
+	meta_environment, meta_flags, meta_files, meta_relay_address, peer_status_last_seen, peer_status_connected, peer_status_login_expired, 
+	peer_status_requires_approval, peer_status_last_handshake, peer_status_pending_approval_since, peer_status_usage_cap_exceeded, location_connection_ip, location_country_code, location_city_name, 
+	location_geo_name_id, location_subdivision_code, location_connection_port, attestation_verifier, attestation_details, attestation_verified_at, firewall_overrides, reported_errors, unclaimed FROM peers WHERE account_id = $1`
 	rows, err := s.pool.Query(ctx, query, accountID)
 	if err != nil {
 		return nil, err
@@ -1682,30 +2054,54 @@ func (s *SqlStore) getPeers(ctx context.Context, accountID string) ([]nbpeer.Pee
 		var p nbpeer.Peer
 		p.Status = &nbpeer.PeerStatus{}
 		var (
-			lastLogin, createdAt                                                                            sql.NullTime
+			lastLogin, createdAt, firstConnectedAt                                                          sql.NullTime
 			sshEnabled, loginExpirationEnabled, inactivityExpirationEnabled, ephemeral, allowExtraDNSLabels sql.NullBool
-			peerStatusLastSeen                                                                              sql.NullTime
+			managedBySetupKeyOnly, unclaimed                                                                sql.NullBool
+			peerStatusLastSeen, peerStatusLastHandshake, peerStatusPendingApprovalSince                     sql.NullTime
 			peerStatusConnected, peerStatusLoginExpired, peerStatusRequiresApproval                         sql.NullBool
-			ip, extraDNS, netAddr, env, flags, files, connIP                                                []byte
+			peerStatusUsageCapExceeded                                                                      sql.NullBool
+			ip, extraDNS, netAddr, env, flags, files, connIP, firewallOverrides, reportedErrors             []byte
 			metaHostname, metaGoOS, metaKernel, metaCore, metaPlatform                                      sql.NullString
 			metaOS, metaOSVersion, metaWtVersion, metaUIVersion, metaKernelVersion                          sql.NullString
-			metaSystemSerialNumber, metaSystemProductName, metaSystemManufacturer                           sql.NullString
-			locationCountryCode, locationCityName                                                           sql.NullString
-			locationGeoNameID                                                                               sql.NullInt64
+			metaSystemSerialNumber, metaSystemProductName, metaSystemManufacturer, metaRelayAddress         sql.NullString
+			description, adminNotes, ownerEmail, setupKeyID                                                 sql.NullString
+			locationCountryCode, locationCityName, locationSubdivisionCode                                  sql.NullString
+			locationGeoNameID, locationConnectionPort, appliedNetworkSerial                                 sql.NullInt64
+			attestationVerifier, attestationDetails                                                         sql.NullString
+			attestationVerifiedAt                                                                           sql.NullTime
 		)
 
-		err := row.Scan(&p.ID, &p.AccountID, &p.Key, &ip, &p.Name, &p.DNSLabel, &p.UserID, &p.SSHKey, &sshEnabled,
-			&loginExpirationEnabled, &inactivityExpirationEnabled, &lastLogin, &createdAt, &ephemeral, &extraDNS,
-			&allowExtraDNSLabels, &metaHostname, &metaGoOS, &metaKernel, &metaCore, &metaPlatform,
+		err := row.Scan(&p.ID, &p.AccountID, &p.Key, &ip, &p.Name, &description, &adminNotes, &p.DNSLabel, &p.UserID, &setupKeyID, &ownerEmail, &p.SSHKey, &sshEnabled,
+			&loginExpirationEnabled, &inactivityExpirationEnabled, &lastLogin, &createdAt, &firstConnectedAt, &appliedNetworkSerial, &ephemeral, &extraDNS,
+			&allowExtraDNSLabels, &managedBySetupKeyOnly, &metaHostname, &metaGoOS, &metaKernel, &metaCore, &metaPlatform,
 			&metaOS, &metaOSVersion, &metaWtVersion, &metaUIVersion, &metaKernelVersion, &netAddr,
-			&metaSystemSerialNumber, &metaSystemProductName, &metaSystemManufacturer, &env, &flags, &files,
-			&peerStatusLastSeen, &peerStatusConnected, &peerStatusLoginExpired, &peerStatusRequiresApproval, &connIP,
-			&locationCountryCode, &locationCityName, &locationGeoNameID)
+			&metaSystemSerialNumber, &metaSystemProductName, &metaSystemManufacturer, &env, &flags, &files, &metaRelayAddress,
+			&peerStatusLastSeen, &peerStatusConnected, &peerStatusLoginExpired, &peerStatusRequiresApproval, &peerStatusLastHandshake, &peerStatusPendingApprovalSince, &peerStatusUsageCapExceeded, &connIP,
+			&locationCountryCode, &locationCityName, &locationGeoNameID, &locationSubdivisionCode, &locationConnectionPort, &attestationVerifier, &attestationDetails,
+			&attestationVerifiedAt, &firewallOverrides, &reportedErrors, &unclaimed)
 
 		if err == nil {
+			if description.Valid {
+				p.Description = description.String
+			}
+			if adminNotes.Valid {
+				p.AdminNotes = adminNotes.String
+			}
+			if ownerEmail.Valid {
+				p.OwnerEmail = ownerEmail.String
+			}
+			if setupKeyID.Valid {
+				p.SetupKeyID = setupKeyID.String
+			}
 			if lastLogin.Valid {
 				p.LastLogin = &lastLogin.Time
 			}
+			if firstConnectedAt.Valid {
+				p.FirstConnectedAt = &firstConnectedAt.Time
+			}
+			if appliedNetworkSerial.Valid {
+				p.AppliedNetworkSerial = uint64(appliedNetworkSerial.Int64)
+			}
 			if createdAt.Valid {
 				p.CreatedAt = createdAt.Time
 			}
@@ -1724,6 +2120,12 @@ func (s *SqlStore) getPeers(ctx context.Context, accountID string) ([]nbpeer.Pee
 			if allowExtraDNSLabels.Valid {
 				p.AllowExtraDNSLabels = allowExtraDNSLabels.Bool
 			}
+			if managedBySetupKeyOnly.Valid {
+				p.ManagedBySetupKeyOnly = managedBySetupKeyOnly.Bool
+			}
+			if unclaimed.Valid {
+				p.Unclaimed = unclaimed.Bool
+			}
 			if peerStatusLastSeen.Valid {
 				p.Status.LastSeen = peerStatusLastSeen.Time
 			}
@@ -1736,6 +2138,15 @@ func (s *SqlStore) getPeers(ctx context.Context, accountID string) ([]nbpeer.Pee
 			if peerStatusRequiresApproval.Valid {
 				p.Status.RequiresApproval = peerStatusRequiresApproval.Bool
 			}
+			if peerStatusLastHandshake.Valid {
+				p.Status.LastHandshake = peerStatusLastHandshake.Time
+			}
+			if peerStatusPendingApprovalSince.Valid {
+				p.Status.PendingApprovalSince = peerStatusPendingApprovalSince.Time
+			}
+			if peerStatusUsageCapExceeded.Valid {
+				p.Status.UsageCapExceeded = peerStatusUsageCapExceeded.Bool
+			}
 			if metaHostname.Valid {
 				p.Meta.Hostname = metaHostname.String
 			}
@@ -1775,6 +2186,9 @@ func (s *SqlStore) getPeers(ctx context.Context, accountID string) ([]nbpeer.Pee
 			if metaSystemManufacturer.Valid {
 				p.Meta.SystemManufacturer = metaSystemManufacturer.String
 			}
+			if metaRelayAddress.Valid {
+				p.Meta.RelayAddress = metaRelayAddress.String
+			}
 			if locationCountryCode.Valid {
 				p.Location.CountryCode = locationCountryCode.String
 			}
@@ -1784,6 +2198,21 @@ func (s *SqlStore) getPeers(ctx context.Context, accountID string) ([]nbpeer.Pee
 			if locationGeoNameID.Valid {
 				p.Location.GeoNameID = uint(locationGeoNameID.Int64)
 			}
+			if locationSubdivisionCode.Valid {
+				p.Location.SubdivisionCode = locationSubdivisionCode.String
+			}
+			if locationConnectionPort.Valid {
+				p.Location.ConnectionPort = uint16(locationConnectionPort.Int64)
+			}
+			if attestationVerifier.Valid {
+				p.Attestation.Verifier = attestationVerifier.String
+			}
+			if attestationDetails.Valid {
+				p.Attestation.Details = attestationDetails.String
+			}
+			if attestationVerifiedAt.Valid {
+				p.Attestation.VerifiedAt = &attestationVerifiedAt.Time
+			}
 			if ip != nil {
 				_ = json.Unmarshal(ip, &p.IP)
 			}
@@ -1805,6 +2234,12 @@ func (s *SqlStore) getPeers(ctx context.Context, accountID string) ([]nbpeer.Pee
 			if connIP != nil {
 				_ = json.Unmarshal(connIP, &p.Location.ConnectionIP)
 			}
+			if firewallOverrides != nil {
+				_ = json.Unmarshal(firewallOverrides, &p.FirewallOverrides)
+			}
+			if reportedErrors != nil {
+				_ = json.Unmarshal(reportedErrors, &p.ReportedErrors)
+			}
 		}
 		return p, err
 	})
@@ -1815,17 +2250,17 @@ func (s *SqlStore) getPeers(ctx context.Context, accountID string) ([]nbpeer.Pee
 }
 
 func (s *SqlStore) getUsers(ctx context.Context, accountID string) ([]types.User, error) {
-	const query = `SELECT id, account_id, role, is_service_user, non_deletable, service_user_name, auto_groups, blocked, pending_approval, last_login, created_at, issued, integration_ref_id, integration_ref_integration_type, email, name FROM users WHERE account_id = $1`
+	const query = `SELECT id, account_id, role, is_service_user, non_deletable, service_user_name, auto_groups, blocked, pending_approval, last_login, created_at, issued, integration_ref_id, integration_ref_integration_type, email, name, pinned_peers FROM users WHERE account_id = $1`
 	rows, err := s.pool.Query(ctx, query, accountID)
 	if err != nil {
 		return nil, err
 	}
 	users, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (types.User, error) {
 		var u types.User
-		var autoGroups []byte
+		var autoGroups, pinnedPeers []byte
 		var lastLogin, createdAt sql.NullTime
 		var isServiceUser, nonDeletable, blocked, pendingApproval sql.NullBool
-		err := row.Scan(&u.Id, &u.AccountID, &u.Role, &isServiceUser, &nonDeletable, &u.ServiceUserName, &autoGroups, &blocked, &pendingApproval, &lastLogin, &createdAt, &u.Issued, &u.IntegrationReference.ID, &u.IntegrationReference.IntegrationType, &u.Email, &u.Name)
+		err := row.Scan(&u.Id, &u.AccountID, &u.Role, &isServiceUser, &nonDeletable, &u.ServiceUserName, &autoGroups, &blocked, &pendingApproval, &lastLogin, &createdAt, &u.Issued, &u.IntegrationReference.ID, &u.IntegrationReference.IntegrationType, &u.Email, &u.Name, &pinnedPeers)
 		if err == nil {
 			if lastLogin.Valid {
 				u.LastLogin = &lastLogin.Time
@@ -1850,6 +2285,9 @@ func (s *SqlStore) getUsers(ctx context.Context, accountID string) ([]types.User
 			} else {
 				u.AutoGroups = []string{}
 			}
+			if pinnedPeers != nil {
+				_ = json.Unmarshal(pinnedPeers, &u.PinnedPeers)
+			}
 		}
 		return u, err
 	})
@@ -1860,7 +2298,7 @@ func (s *SqlStore) getUsers(ctx context.Context, accountID string) ([]types.User
 }
 
 func (s *SqlStore) getGroups(ctx context.Context, accountID string) ([]*types.Group, error) {
-	const query = `SELECT id, account_id, name, issued, resources, integration_ref_id, integration_ref_integration_type FROM groups WHERE account_id = $1`
+	const query = `SELECT id, account_id, name, issued, resources, peer_login_expiration, integration_ref_id, integration_ref_integration_type FROM groups WHERE account_id = $1`
 	rows, err := s.pool.Query(ctx, query, accountID)
 	if err != nil {
 		return nil, err
@@ -1870,8 +2308,12 @@ func (s *SqlStore) getGroups(ctx context.Context, accountID string) ([]*types.Gr
 		var resources []byte
 		var refID sql.NullInt64
 		var refType sql.NullString
-		err := row.Scan(&g.ID, &g.AccountID, &g.Name, &g.Issued, &resources, &refID, &refType)
+		var peerLoginExpiration sql.NullInt64
+		err := row.Scan(&g.ID, &g.AccountID, &g.Name, &g.Issued, &resources, &peerLoginExpiration, &refID, &refType)
 		if err == nil {
+			if peerLoginExpiration.Valid {
+				g.PeerLoginExpiration = time.Duration(peerLoginExpiration.Int64)
+			}
 			if refID.Valid {
 				g.IntegrationReference.ID = int(refID.Int64)
 			}
@@ -2245,7 +2687,7 @@ func (s *SqlStore) getGroupPeers(ctx context.Context, groupIDs []string) ([]type
 	if len(groupIDs) == 0 {
 		return nil, nil
 	}
-	const query = `SELECT account_id, group_id, peer_id FROM group_peers WHERE group_id = ANY($1)`
+	const query = `SELECT account_id, group_id, peer_id, auto_assigned FROM group_peers WHERE group_id = ANY($1)`
 	rows, err := s.pool.Query(ctx, query, groupIDs)
 	if err != nil {
 		return nil, err
@@ -2478,6 +2920,10 @@ func (s *SqlStore) GetPeerByPeerPubKey(ctx context.Context, lockStrength Locking
 		return nil, status.Errorf(status.Internal, "issue getting peer from store: %s", result.Error)
 	}
 
+	if err := peer.DecryptSensitiveData(s.fieldEncrypt); err != nil {
+		return nil, fmt.Errorf("decrypt peer: %w", err)
+	}
+
 	return &peer, nil
 }
 
@@ -2494,6 +2940,11 @@ func (s *SqlStore) GetAccountSettings(ctx context.Context, lockStrength LockingS
 		}
 		return nil, status.Errorf(status.Internal, "issue getting settings from store: %s", err)
 	}
+
+	if err := accountSettings.Settings.DecryptSensitiveData(s.fieldEncrypt); err != nil {
+		return nil, fmt.Errorf("decrypt settings: %w", err)
+	}
+
 	return accountSettings.Settings, nil
 }
 
@@ -2865,6 +3316,29 @@ func (s *SqlStore) AddPeerToGroup(ctx context.Context, accountID, peerID, groupI
 	return nil
 }
 
+// AddPeerToAutoGroup adds a peer to a group as a membership derived from the auto groups of the peer's user.
+// An existing membership is left untouched, so manually added memberships stay manual
+func (s *SqlStore) AddPeerToAutoGroup(ctx context.Context, accountID, peerID, groupID string) error {
+	peer := &types.GroupPeer{
+		AccountID:    accountID,
+		GroupID:      groupID,
+		PeerID:       peerID,
+		AutoAssigned: true,
+	}
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "group_id"}, {Name: "peer_id"}},
+		DoNothing: true,
+	}).Create(peer).Error
+
+	if err != nil {
+		log.WithContext(ctx).Errorf("failed to add peer %s to auto group %s for account %s: %v", peerID, groupID, accountID, err)
+		return status.Errorf(status.Internal, "failed to add peer to group")
+	}
+
+	return nil
+}
+
 // RemovePeerFromGroup removes a peer from a group
 func (s *SqlStore) RemovePeerFromGroup(ctx context.Context, peerID string, groupID string) error {
 	err := s.db.
@@ -2969,6 +3443,29 @@ func (s *SqlStore) GetPeerGroups(ctx context.Context, lockStrength LockingStreng
 	return groups, nil
 }
 
+// GetPeerLoginExpirationOverride returns the shortest peer login expiration override of the groups of the peer,
+// zero when none of its groups overrides the account setting. Only the override column is read, not the group members.
+func (s *SqlStore) GetPeerLoginExpirationOverride(ctx context.Context, lockStrength LockingStrength, accountID string, peerID string) (time.Duration, error) {
+	tx := s.db
+	if lockStrength != LockingStrengthNone {
+		tx = tx.Clauses(clause.Locking{Strength: string(lockStrength)})
+	}
+
+	var override sql.NullInt64
+	result := tx.
+		Model(&types.Group{}).
+		Select("MIN(groups.peer_login_expiration)").
+		Joins("JOIN group_peers ON group_peers.group_id = groups.id").
+		Where("group_peers.account_id = ? AND group_peers.peer_id = ? AND groups.peer_login_expiration > 0", accountID, peerID).
+		Scan(&override)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to get peer login expiration override from store: %v", result.Error)
+		return 0, status.Errorf(status.Internal, "failed to get peer login expiration override from store")
+	}
+
+	return time.Duration(override.Int64), nil
+}
+
 // GetPeerGroupIDs retrieves all group IDs assigned to a specific peer in a given account.
 func (s *SqlStore) GetPeerGroupIDs(ctx context.Context, lockStrength LockingStrength, accountId string, peerId string) ([]string, error) {
 	tx := s.db
@@ -2993,27 +3490,144 @@ func (s *SqlStore) GetPeerGroupIDs(ctx context.Context, lockStrength LockingStre
 	return groupIDs, nil
 }
 
+// GetPeerAutoGroupIDs returns the IDs of the groups the peer was added to from the auto groups of its user
+func (s *SqlStore) GetPeerAutoGroupIDs(ctx context.Context, lockStrength LockingStrength, accountID string, peerID string) ([]string, error) {
+	tx := s.db
+	if lockStrength != LockingStrengthNone {
+		tx = tx.Clauses(clause.Locking{Strength: string(lockStrength)})
+	}
+
+	var groupIDs []string
+	result := tx.
+		Model(&types.GroupPeer{}).
+		Where("account_id = ? AND peer_id = ? AND auto_assigned = ?", accountID, peerID, true).
+		Pluck("group_id", &groupIDs)
+	if result.Error != nil {
+		log.WithContext(ctx).Errorf("failed to get auto group IDs for peer %s in account %s: %v", peerID, accountID, result.Error)
+		return nil, status.Errorf(status.Internal, "failed to get auto group IDs for peer from store")
+	}
+
+	return groupIDs, nil
+}
+
 // GetAccountPeers retrieves peers for an account.
-func (s *SqlStore) GetAccountPeers(ctx context.Context, lockStrength LockingStrength, accountID, nameFilter, ipFilter string) ([]*nbpeer.Peer, error) {
+func (s *SqlStore) GetAccountPeers(ctx context.Context, lockStrength LockingStrength, accountID, nameFilter, ipFilter string, ephemeralFilter *bool) ([]*nbpeer.Peer, error) {
+	return s.GetFilteredAccountPeers(ctx, lockStrength, accountID, PeerFilters{Name: nameFilter, IP: ipFilter, Ephemeral: ephemeralFilter})
+}
+
+// GetFilteredAccountPeers retrieves the peers of an account matching the filters.
+func (s *SqlStore) GetFilteredAccountPeers(ctx context.Context, lockStrength LockingStrength, accountID string, filters PeerFilters) ([]*nbpeer.Peer, error) {
 	var peers []*nbpeer.Peer
 	tx := s.db
 	if lockStrength != LockingStrengthNone {
 		tx = tx.Clauses(clause.Locking{Strength: string(lockStrength)})
 	}
-	query := tx.Where(accountIDCondition, accountID)
+	if err := filteredPeersQuery(tx, accountID, filters).Find(&peers).Error; err != nil {
+		log.WithContext(ctx).Errorf("failed to get peers from the store: %s", err)
+		return nil, status.Errorf(status.Internal, "failed to get peers from store")
+	}
 
-	if nameFilter != "" {
-		query = query.Where("name LIKE ?", "%"+nameFilter+"%")
+	if err := s.decryptPeers(peers); err != nil {
+		return nil, err
+	}
+
+	return peers, nil
+}
+
+// filteredPeersQuery returns the query on the peers of the account matching the filters, shared by the peer listing
+// and counting. The group filters are resolved with subqueries on the group memberships, so the set subtraction
+// happens in the database
+func filteredPeersQuery(tx *gorm.DB, accountID string, filters PeerFilters) *gorm.DB {
+	query := tx.Model(&nbpeer.Peer{}).Where(accountIDCondition, accountID)
+	if filters.IDs != nil {
+		query = query.Where("id IN ?", filters.IDs)
+	}
+	if filters.Name != "" {
+		query = query.Where("name LIKE ?", "%"+filters.Name+"%")
+	}
+	if filters.IP != "" {
+		query = query.Where("ip LIKE ?", "%"+filters.IP+"%")
+	}
+	if filters.Connected != nil {
+		query = query.Where("peer_status_connected = ?", *filters.Connected)
+	}
+	if filters.Ephemeral != nil {
+		query = query.Where("ephemeral = ?", *filters.Ephemeral)
+	}
+	if filters.GroupID != "" {
+		query = query.Where("id IN (SELECT peer_id FROM group_peers WHERE group_id = ?)", filters.GroupID)
 	}
-	if ipFilter != "" {
-		query = query.Where("ip LIKE ?", "%"+ipFilter+"%")
+	if filters.ExcludeGroupID != "" {
+		query = query.Where("id NOT IN (SELECT peer_id FROM group_peers WHERE group_id = ?)", filters.ExcludeGroupID)
 	}
+	return query
+}
 
-	if err := query.Find(&peers).Error; err != nil {
-		log.WithContext(ctx).Errorf("failed to get peers from the store: %s", err)
+// CountAccountPeers counts the peers of an account matching the filters.
+func (s *SqlStore) CountAccountPeers(ctx context.Context, lockStrength LockingStrength, accountID string, filters PeerFilters) (int64, error) {
+	tx := s.db
+	if lockStrength != LockingStrengthNone {
+		tx = tx.Clauses(clause.Locking{Strength: string(lockStrength)})
+	}
+
+	var count int64
+	if err := filteredPeersQuery(tx, accountID, filters).Count(&count).Error; err != nil {
+		log.WithContext(ctx).Errorf("failed to count peers in the store: %s", err)
+		return 0, status.Errorf(status.Internal, "failed to count peers in store")
+	}
+
+	return count, nil
+}
+
+// GetPeersBySetupKey returns the peers registered with the given setup key
+func (s *SqlStore) GetPeersBySetupKey(ctx context.Context, lockStrength LockingStrength, accountID, setupKeyID string) ([]*nbpeer.Peer, error) {
+	tx := s.db
+	if lockStrength != LockingStrengthNone {
+		tx = tx.Clauses(clause.Locking{Strength: string(lockStrength)})
+	}
+
+	var peers []*nbpeer.Peer
+	result := tx.Find(&peers, "account_id = ? AND setup_key_id = ?", accountID, setupKeyID)
+	if err := result.Error; err != nil {
+		log.WithContext(ctx).Errorf("failed to get peers by setup key from the store: %s", err)
 		return nil, status.Errorf(status.Internal, "failed to get peers from store")
 	}
 
+	if err := s.decryptPeers(peers); err != nil {
+		return nil, err
+	}
+
+	return peers, nil
+}
+
+// GetPeersByKeyPrefix returns the peers whose WireGuard public key starts with the given prefix
+func (s *SqlStore) GetPeersByKeyPrefix(ctx context.Context, lockStrength LockingStrength, accountID, keyPrefix string) ([]*nbpeer.Peer, error) {
+	tx := s.db
+	if lockStrength != LockingStrengthNone {
+		tx = tx.Clauses(clause.Locking{Strength: string(lockStrength)})
+	}
+
+	keyColumn := "key"
+	if s.storeEngine == types.MysqlStoreEngine {
+		keyColumn = "`key`"
+	}
+
+	var peers []*nbpeer.Peer
+	result := tx.Find(&peers, "account_id = ? AND "+keyColumn+" LIKE ?", accountID, keyPrefix+"%")
+	if err := result.Error; err != nil {
+		log.WithContext(ctx).Errorf("failed to get peers by key prefix from the store: %s", err)
+		return nil, status.Errorf(status.Internal, "failed to get peers from store")
+	}
+
+	// LIKE is case-insensitive on some engines, while keys are case-sensitive
+	peers = slices.DeleteFunc(peers, func(peer *nbpeer.Peer) bool {
+		return !strings.HasPrefix(peer.Key, keyPrefix)
+	})
+
+	if err := s.decryptPeers(peers); err != nil {
+		return nil, err
+	}
+
 	return peers, nil
 }
 
@@ -3038,10 +3652,42 @@ func (s *SqlStore) GetUserPeers(ctx context.Context, lockStrength LockingStrengt
 		return nil, status.Errorf(status.Internal, "failed to get peers from store")
 	}
 
+	if err := s.decryptPeers(peers); err != nil {
+		return nil, err
+	}
+
+	return peers, nil
+}
+
+// GetUnclaimedPeers retrieves the imported peers of an account no client registered for yet.
+func (s *SqlStore) GetUnclaimedPeers(ctx context.Context, lockStrength LockingStrength, accountID string) ([]*nbpeer.Peer, error) {
+	tx := s.db
+	if lockStrength != LockingStrengthNone {
+		tx = tx.Clauses(clause.Locking{Strength: string(lockStrength)})
+	}
+
+	var peers []*nbpeer.Peer
+	result := tx.Find(&peers, "account_id = ? AND unclaimed = ?", accountID, true)
+	if err := result.Error; err != nil {
+		log.WithContext(ctx).Errorf("failed to get unclaimed peers from the store: %s", err)
+		return nil, status.Errorf(status.Internal, "failed to get unclaimed peers from store")
+	}
+
+	if err := s.decryptPeers(peers); err != nil {
+		return nil, err
+	}
+
 	return peers, nil
 }
 
 func (s *SqlStore) AddPeerToAccount(ctx context.Context, peer *nbpeer.Peer) error {
+	ownerEmail := peer.OwnerEmail
+	if err := peer.EncryptSensitiveData(s.fieldEncrypt); err != nil {
+		return fmt.Errorf("encrypt peer: %w", err)
+	}
+	// the caller keeps using the peer, restore the plain owner email once it is stored
+	defer func() { peer.OwnerEmail = ownerEmail }()
+
 	if err := s.db.Create(peer).Error; err != nil {
 		return status.Errorf(status.Internal, "issue adding peer to account: %s", err)
 	}
@@ -3049,6 +3695,16 @@ func (s *SqlStore) AddPeerToAccount(ctx context.Context, peer *nbpeer.Peer) erro
 	return nil
 }
 
+// decryptPeers decrypts the sensitive fields of the peers read from the store in place
+func (s *SqlStore) decryptPeers(peers []*nbpeer.Peer) error {
+	for _, peer := range peers {
+		if err := peer.DecryptSensitiveData(s.fieldEncrypt); err != nil {
+			return fmt.Errorf("decrypt peer: %w", err)
+		}
+	}
+	return nil
+}
+
 // GetPeerByID retrieves a peer by its ID and account ID.
 func (s *SqlStore) GetPeerByID(ctx context.Context, lockStrength LockingStrength, accountID, peerID string) (*nbpeer.Peer, error) {
 	tx := s.db
@@ -3066,6 +3722,10 @@ func (s *SqlStore) GetPeerByID(ctx context.Context, lockStrength LockingStrength
 		return nil, status.Errorf(status.Internal, "failed to get peer from store")
 	}
 
+	if err := peer.DecryptSensitiveData(s.fieldEncrypt); err != nil {
+		return nil, fmt.Errorf("decrypt peer: %w", err)
+	}
+
 	return peer, nil
 }
 
@@ -3083,6 +3743,10 @@ func (s *SqlStore) GetPeersByIDs(ctx context.Context, lockStrength LockingStreng
 		return nil, status.Errorf(status.Internal, "failed to get peers by ID's from the store")
 	}
 
+	if err := s.decryptPeers(peers); err != nil {
+		return nil, err
+	}
+
 	peersMap := make(map[string]*nbpeer.Peer)
 	for _, peer := range peers {
 		peersMap[peer.ID] = peer
@@ -3107,6 +3771,56 @@ func (s *SqlStore) GetAccountPeersWithExpiration(ctx context.Context, lockStreng
 		return nil, status.Errorf(status.Internal, "failed to get peers with expiration from store")
 	}
 
+	if err := s.decryptPeers(peers); err != nil {
+		return nil, err
+	}
+
+	return peers, nil
+}
+
+// GetAccountPeersByCountry retrieves the peers of an account whose last connection came from the given country.
+func (s *SqlStore) GetAccountPeersByCountry(ctx context.Context, lockStrength LockingStrength, accountID, countryCode string) ([]*nbpeer.Peer, error) {
+	tx := s.db
+	if lockStrength != LockingStrengthNone {
+		tx = tx.Clauses(clause.Locking{Strength: string(lockStrength)})
+	}
+
+	var peers []*nbpeer.Peer
+	result := tx.
+		Where("location_country_code = ?", countryCode).
+		Find(&peers, accountIDCondition, accountID)
+	if err := result.Error; err != nil {
+		log.WithContext(ctx).Errorf("failed to get peers by country from the store: %s", result.Error)
+		return nil, status.Errorf(status.Internal, "failed to get peers by country from store")
+	}
+
+	if err := s.decryptPeers(peers); err != nil {
+		return nil, err
+	}
+
+	return peers, nil
+}
+
+// GetAccountPeersByRelay retrieves the peers of an account currently connected to the given relay server.
+func (s *SqlStore) GetAccountPeersByRelay(ctx context.Context, lockStrength LockingStrength, accountID, relayAddress string) ([]*nbpeer.Peer, error) {
+	tx := s.db
+	if lockStrength != LockingStrengthNone {
+		tx = tx.Clauses(clause.Locking{Strength: string(lockStrength)})
+	}
+
+	var peers []*nbpeer.Peer
+	result := tx.
+		Where("meta_relay_address = ?", relayAddress).
+		Find(&peers, accountIDCondition, accountID)
+	if err := result.Error; err != nil {
+		log.WithContext(ctx).Errorf("failed to get peers by relay from the store: %s", result.Error)
+		return nil, status.Errorf(status.Internal, "failed to get peers by relay from store")
+	}
+
+	if err := s.decryptPeers(peers); err != nil {
+		return nil, err
+	}
+
 	return peers, nil
 }
 
@@ -3126,6 +3840,10 @@ func (s *SqlStore) GetAccountPeersWithInactivity(ctx context.Context, lockStreng
 		return nil, status.Errorf(status.Internal, "failed to get peers with inactivity from store")
 	}
 
+	if err := s.decryptPeers(peers); err != nil {
+		return nil, err
+	}
+
 	return peers, nil
 }
 
@@ -3149,6 +3867,10 @@ func (s *SqlStore) GetAllEphemeralPeers(ctx context.Context, lockStrength Lockin
 		return nil, fmt.Errorf("failed to retrieve ephemeral peers")
 	}
 
+	if err := s.decryptPeers(allEphemeralPeers); err != nil {
+		return nil, err
+	}
+
 	return allEphemeralPeers, nil
 }
 
@@ -3164,6 +3886,11 @@ func (s *SqlStore) DeletePeer(ctx context.Context, accountID string, peerID stri
 		return status.NewPeerNotFoundError(peerID)
 	}
 
+	if err := s.db.Delete(&nbpeer.UsageSample{}, accountAndPeerIDQueryCondition, accountID, peerID).Error; err != nil {
+		log.WithContext(ctx).Errorf("failed to delete peer usage samples from the store: %s", err)
+		return status.Errorf(status.Internal, "failed to delete peer usage samples from store")
+	}
+
 	return nil
 }
 
@@ -3875,6 +4602,11 @@ func (s *SqlStore) SaveDNSSettings(ctx context.Context, accountID string, settin
 
 // SaveAccountSettings stores the account settings in DB.
 func (s *SqlStore) SaveAccountSettings(ctx context.Context, accountID string, settings *types.Settings) error {
+	settings = settings.Copy()
+	if err := settings.EncryptSensitiveData(s.fieldEncrypt); err != nil {
+		return fmt.Errorf("encrypt settings: %w", err)
+	}
+
 	result := s.db.Model(&types.Account{}).
 		Select("*").Where(idQueryCondition, accountID).Updates(&types.AccountSettings{Settings: settings})
 	if result.Error != nil {
@@ -4246,6 +4978,10 @@ func (s *SqlStore) GetPeerByIP(ctx context.Context, lockStrength LockingStrength
 		return nil, status.Errorf(status.Internal, "failed to get peer from store")
 	}
 
+	if err := peer.DecryptSensitiveData(s.fieldEncrypt); err != nil {
+		return nil, fmt.Errorf("decrypt peer: %w", err)
+	}
+
 	return &peer, nil
 }
 
@@ -4378,6 +5114,10 @@ func (s *SqlStore) GetPeersByGroupIDs(ctx context.Context, accountID string, gro
 		return nil, status.Errorf(status.Internal, "failed to get peers by group IDs")
 	}
 
+	if err := s.decryptPeers(peers); err != nil {
+		return nil, err
+	}
+
 	return peers, nil
 }
 
@@ -547,6 +547,41 @@ func TestSqlStore_SavePeerStatus(t *testing.T) {
 	assert.WithinDurationf(t, newStatus.LastSeen, actual.LastSeen.UTC(), time.Millisecond, "LastSeen should be equal")
 }
 
+func TestSqlStore_SavePeerMeta(t *testing.T) {
+	store, cleanUp, err := NewTestStoreFromSQL(context.Background(), "../testdata/store.sql", t.TempDir())
+	t.Cleanup(cleanUp)
+	assert.NoError(t, err)
+
+	account, err := store.GetAccount(context.Background(), "bf1c8084-ba50-4ce7-9439-34653001fc3b")
+	require.NoError(t, err)
+
+	err = store.SavePeerMeta(context.Background(), account.Id, "non-existing-peer", nbpeer.PeerSystemMeta{Hostname: "peer"})
+	parsedErr, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, status.NotFound, parsedErr.Type(), "should return not found error")
+
+	account.Peers["testpeer"] = &nbpeer.Peer{
+		Key:    "peerkey",
+		ID:     "testpeer",
+		IP:     net.IP{127, 0, 0, 1},
+		Meta:   nbpeer.PeerSystemMeta{Hostname: "peer", SystemProductName: "x1", RelayAddress: "rels://relay.example.com:443"},
+		Name:   "peer name",
+		Status: &nbpeer.PeerStatus{Connected: true, LastSeen: time.Now().UTC()},
+	}
+	err = store.SaveAccount(context.Background(), account)
+	require.NoError(t, err)
+
+	meta := nbpeer.PeerSystemMeta{Hostname: "peer", SystemProductName: "x2"}
+	err = store.SavePeerMeta(context.Background(), account.Id, "testpeer", meta)
+	require.NoError(t, err)
+
+	peer, err := store.GetPeerByID(context.Background(), LockingStrengthNone, account.Id, "testpeer")
+	require.NoError(t, err)
+	assert.Equal(t, meta, peer.Meta, "emptied fields should be stored as well")
+	assert.Equal(t, "peer name", peer.Name)
+	assert.True(t, peer.Status.Connected)
+}
+
 func TestSqlStore_SavePeerLocation(t *testing.T) {
 	store, cleanUp, err := NewTestStoreFromSQL(context.Background(), "../testdata/store.sql", t.TempDir())
 	t.Cleanup(cleanUp)
@@ -576,9 +611,11 @@ func TestSqlStore_SavePeerLocation(t *testing.T) {
 	require.NoError(t, err)
 
 	peer.Location.ConnectionIP = net.ParseIP("35.1.1.1")
+	peer.Location.ConnectionPort = 51820
 	peer.Location.CountryCode = "DE"
 	peer.Location.CityName = "Berlin"
 	peer.Location.GeoNameID = 2950159
+	peer.Location.SubdivisionCode = "DE-BE"
 
 	err = store.SavePeerLocation(context.Background(), account.Id, account.Peers[peer.ID])
 	assert.NoError(t, err)
@@ -589,6 +626,14 @@ func TestSqlStore_SavePeerLocation(t *testing.T) {
 	actual := account.Peers[peer.ID].Location
 	assert.Equal(t, peer.Location, actual)
 
+	err = store.SavePeerConnectionPort(context.Background(), account.Id, peer.ID, 0)
+	require.NoError(t, err)
+
+	account, err = store.GetAccount(context.Background(), account.Id)
+	require.NoError(t, err)
+	assert.Zero(t, account.Peers[peer.ID].Location.ConnectionPort, "a port of 0 should clear the stored port")
+	assert.Equal(t, "DE", account.Peers[peer.ID].Location.CountryCode)
+
 	peer.ID = "non-existing-peer"
 	err = store.SavePeerLocation(context.Background(), account.Id, peer)
 	assert.Error(t, err)
@@ -597,6 +642,61 @@ func TestSqlStore_SavePeerLocation(t *testing.T) {
 	require.Equal(t, status.NotFound, parsedErr.Type(), "should return not found error")
 }
 
+func TestSqlStore_SavePeerReportedErrors(t *testing.T) {
+	store, cleanUp, err := NewTestStoreFromSQL(context.Background(), "../testdata/store.sql", t.TempDir())
+	t.Cleanup(cleanUp)
+	require.NoError(t, err)
+
+	accountID := "bf1c8084-ba50-4ce7-9439-34653001fc3b"
+	peers, err := store.GetAccountPeers(context.Background(), LockingStrengthNone, accountID, "", "", nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, peers)
+	peerID := peers[0].ID
+
+	reportedErrors := []nbpeer.ReportedError{
+		{Time: time.Now().UTC().Add(-5 * time.Minute).Truncate(time.Second), Level: nbpeer.ReportedErrorLevelWarning, Message: "route conflict"},
+		{Time: time.Now().UTC().Truncate(time.Second), Level: nbpeer.ReportedErrorLevelError, Message: "dns server unreachable"},
+	}
+	err = store.SavePeerReportedErrors(context.Background(), accountID, peerID, reportedErrors)
+	require.NoError(t, err)
+
+	peer, err := store.GetPeerByID(context.Background(), LockingStrengthNone, accountID, peerID)
+	require.NoError(t, err)
+	require.Len(t, peer.ReportedErrors, len(reportedErrors))
+	for i, reportedError := range reportedErrors {
+		assert.True(t, reportedError.Time.Equal(peer.ReportedErrors[i].Time))
+		assert.Equal(t, reportedError.Level, peer.ReportedErrors[i].Level)
+		assert.Equal(t, reportedError.Message, peer.ReportedErrors[i].Message)
+	}
+
+	err = store.SavePeerReportedErrors(context.Background(), accountID, "non-existing-peer", reportedErrors)
+	parsedErr, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, status.NotFound, parsedErr.Type(), "should return not found error")
+}
+
+func TestSqlStore_SavePeerAppliedNetworkSerials(t *testing.T) {
+	store, cleanUp, err := NewTestStoreFromSQL(context.Background(), "../testdata/store.sql", t.TempDir())
+	t.Cleanup(cleanUp)
+	require.NoError(t, err)
+
+	accountID := "bf1c8084-ba50-4ce7-9439-34653001fc3b"
+	peers, err := store.GetAccountPeers(context.Background(), LockingStrengthNone, accountID, "", "", nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, peers)
+	peer := peers[0]
+
+	require.NoError(t, store.SavePeerAppliedNetworkSerials(context.Background(), map[string]uint64{peer.Key: 5}))
+	require.NoError(t, store.SavePeerAppliedNetworkSerials(context.Background(), map[string]uint64{
+		peer.Key:       3,
+		"unknown-peer": 7,
+	}), "unknown peers should be skipped")
+
+	peer, err = store.GetPeerByID(context.Background(), LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), peer.AppliedNetworkSerial, "an older serial should not replace the applied one")
+}
+
 func Test_TestGetAccountByPrivateDomain(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("The SQLite store is not properly supported by Windows yet")
@@ -2671,12 +2771,15 @@ func TestSqlStore_GetAccountPeers(t *testing.T) {
 	t.Cleanup(cleanup)
 	require.NoError(t, err)
 
+	ephemeral, persistent := true, false
+
 	tests := []struct {
-		name          string
-		accountID     string
-		nameFilter    string
-		ipFilter      string
-		expectedCount int
+		name            string
+		accountID       string
+		nameFilter      string
+		ipFilter        string
+		ephemeralFilter *bool
+		expectedCount   int
 	}{
 		{
 			name:          "should retrieve peers for an existing account ID",
@@ -2711,11 +2814,24 @@ func TestSqlStore_GetAccountPeers(t *testing.T) {
 			ipFilter:      "100.64.39.54",
 			expectedCount: 1,
 		},
+		{
+			name:            "should filter ephemeral peers",
+			accountID:       "bf1c8084-ba50-4ce7-9439-34653001fc3b",
+			ephemeralFilter: &ephemeral,
+			expectedCount:   0,
+		},
+		{
+			name:            "should filter persistent peers combined with name",
+			accountID:       "bf1c8084-ba50-4ce7-9439-34653001fc3b",
+			nameFilter:      "host",
+			ephemeralFilter: &persistent,
+			expectedCount:   3,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			peers, err := store.GetAccountPeers(context.Background(), LockingStrengthNone, tt.accountID, tt.nameFilter, tt.ipFilter)
+			peers, err := store.GetAccountPeers(context.Background(), LockingStrengthNone, tt.accountID, tt.nameFilter, tt.ipFilter, tt.ephemeralFilter)
 			require.NoError(t, err)
 			require.Len(t, peers, tt.expectedCount)
 		})
@@ -2723,6 +2839,76 @@ func TestSqlStore_GetAccountPeers(t *testing.T) {
 
 }
 
+func TestSqlStore_CountAccountPeers(t *testing.T) {
+	store, cleanup, err := NewTestStoreFromSQL(context.Background(), "../testdata/store_with_expired_peers.sql", t.TempDir())
+	t.Cleanup(cleanup)
+	require.NoError(t, err)
+
+	connected, disconnected, persistent := true, false, false
+
+	tests := []struct {
+		name          string
+		accountID     string
+		filters       PeerFilters
+		expectedCount int64
+	}{
+		{
+			name:          "should count peers for an existing account ID",
+			accountID:     "bf1c8084-ba50-4ce7-9439-34653001fc3b",
+			expectedCount: 4,
+		},
+		{
+			name:          "should count no peers for a non-existing account ID",
+			accountID:     "nonexistent",
+			expectedCount: 0,
+		},
+		{
+			name:          "should count peers filtered by partial name",
+			accountID:     "bf1c8084-ba50-4ce7-9439-34653001fc3b",
+			filters:       PeerFilters{Name: "host"},
+			expectedCount: 3,
+		},
+		{
+			name:          "should count peers filtered by ip",
+			accountID:     "bf1c8084-ba50-4ce7-9439-34653001fc3b",
+			filters:       PeerFilters{IP: "100.64.39.54"},
+			expectedCount: 1,
+		},
+		{
+			name:          "should count connected peers",
+			accountID:     "bf1c8084-ba50-4ce7-9439-34653001fc3b",
+			filters:       PeerFilters{Connected: &connected},
+			expectedCount: 0,
+		},
+		{
+			name:          "should count disconnected persistent peers",
+			accountID:     "bf1c8084-ba50-4ce7-9439-34653001fc3b",
+			filters:       PeerFilters{Connected: &disconnected, Ephemeral: &persistent},
+			expectedCount: 4,
+		},
+		{
+			name:          "should count only the given peers",
+			accountID:     "bf1c8084-ba50-4ce7-9439-34653001fc3b",
+			filters:       PeerFilters{Name: "host", IDs: []string{"cfvprsrlo1hqoo49ohog", "cg05lnblo1hkg2j514p0"}},
+			expectedCount: 1,
+		},
+		{
+			name:          "should count no peers for an empty peer list",
+			accountID:     "bf1c8084-ba50-4ce7-9439-34653001fc3b",
+			filters:       PeerFilters{IDs: []string{}},
+			expectedCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := store.CountAccountPeers(context.Background(), LockingStrengthNone, tt.accountID, tt.filters)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedCount, count)
+		})
+	}
+}
+
 func TestSqlStore_GetAccountPeersWithExpiration(t *testing.T) {
 	store, cleanup, err := NewTestStoreFromSQL(context.Background(), "../testdata/store_with_expired_peers.sql", t.TempDir())
 	t.Cleanup(cleanup)
@@ -2874,6 +3060,66 @@ func TestSqlStore_DeletePeer(t *testing.T) {
 	require.Nil(t, peer)
 }
 
+func TestSqlStore_PeerUsageSamples(t *testing.T) {
+	store, cleanup, err := NewTestStoreFromSQL(context.Background(), "../testdata/store_with_expired_peers.sql", t.TempDir())
+	t.Cleanup(cleanup)
+	require.NoError(t, err)
+
+	accountID := "bf1c8084-ba50-4ce7-9439-34653001fc3b"
+	peerID := "csrnkiq7qv9d8aitqd50"
+	// the first two samples share a 4h bucket
+	now := time.Now().UTC().Truncate(4 * time.Hour).Add(3 * time.Hour)
+
+	_, err = store.GetPeerLastUsageSample(context.Background(), LockingStrengthNone, accountID, peerID)
+	sErr, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, status.NotFound, sErr.Type())
+
+	var previous *nbpeer.UsageSample
+	for i, counters := range [][2]int64{{100, 10}, {300, 30}, {600, 60}} {
+		sample := nbpeer.NewUsageSample(previous, accountID, peerID, counters[0], counters[1], now.Add(time.Duration(i-2)*time.Hour))
+		require.NoError(t, store.AddPeerUsageSample(context.Background(), sample))
+		previous = sample
+	}
+
+	last, err := store.GetPeerLastUsageSample(context.Background(), LockingStrengthNone, accountID, peerID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(600), last.RxCounter)
+	assert.Equal(t, int64(300), last.RxBytes)
+
+	rx, tx, err := store.GetPeerUsage(context.Background(), LockingStrengthNone, accountID, peerID, now.Add(-90*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(500), rx)
+	assert.Equal(t, int64(50), tx)
+
+	rx, tx, err = store.GetPeerUsage(context.Background(), LockingStrengthNone, accountID, "other-peer", now.Add(-90*time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, rx)
+	assert.Zero(t, tx)
+
+	require.NoError(t, store.RollupUsageSamples(context.Background(), now.Add(-30*time.Minute), 4*time.Hour))
+	rx, tx, err = store.GetPeerUsage(context.Background(), LockingStrengthNone, accountID, peerID, now.Add(-3*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(600), rx, "a rollup must keep the total usage")
+	assert.Equal(t, int64(60), tx)
+	rx, _, err = store.GetPeerUsage(context.Background(), LockingStrengthNone, accountID, peerID, now.Add(-90*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(600), rx, "the rolled up sample takes the time of the latest sample of its bucket")
+
+	last, err = store.GetPeerLastUsageSample(context.Background(), LockingStrengthNone, accountID, peerID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(600), last.RxCounter)
+
+	require.NoError(t, store.DeleteUsageSamplesBefore(context.Background(), now.Add(-30*time.Minute)))
+	rx, _, err = store.GetPeerUsage(context.Background(), LockingStrengthNone, accountID, peerID, now.Add(-3*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(300), rx)
+
+	require.NoError(t, store.DeletePeer(context.Background(), accountID, peerID))
+	_, err = store.GetPeerLastUsageSample(context.Background(), LockingStrengthNone, accountID, peerID)
+	require.Error(t, err, "usage samples must be deleted with the peer")
+}
+
 func TestSqlStore_DatabaseBlocking(t *testing.T) {
 	store, cleanup, err := NewTestStoreFromSQL(context.Background(), "../testdata/store_with_expired_peers.sql", t.TempDir())
 	t.Cleanup(cleanup)
@@ -3124,6 +3370,76 @@ func TestSqlStore_SaveUsers(t *testing.T) {
 	require.Equal(t, users[1].AutoGroups, user.AutoGroups)
 }
 
+func TestSqlStore_PeerOwnerEmailWithEncryption(t *testing.T) {
+	store, cleanup, err := NewTestStoreFromSQL(context.Background(), "../testdata/store_policy_migrate.sql", t.TempDir())
+	t.Cleanup(cleanup)
+	require.NoError(t, err)
+
+	key, err := crypt.GenerateKey()
+	require.NoError(t, err)
+	fieldEncrypt, err := crypt.NewFieldEncrypt(key)
+	require.NoError(t, err)
+	store.SetFieldEncrypt(fieldEncrypt)
+
+	accountID := "bf1c8084-ba50-4ce7-9439-34653001fc3b"
+	ownerEmail := "owner@example.com"
+
+	rawOwnerEmail := func(peerID string) string {
+		var raw string
+		err := store.(*SqlStore).db.Table("peers").Select("owner_email").Where("id = ?", peerID).Scan(&raw).Error
+		require.NoError(t, err)
+		return raw
+	}
+
+	peer := &nbpeer.Peer{
+		ID:         "owned-peer",
+		AccountID:  accountID,
+		Key:        "owned-peer-key",
+		IP:         net.IP{1, 1, 1, 1},
+		Name:       "owned-peer",
+		DNSLabel:   "owned-peer",
+		UserID:     "edafee4e-63fb-11ec-90d6-0242ac120003",
+		OwnerEmail: ownerEmail,
+		Status:     &nbpeer.PeerStatus{},
+		CreatedAt:  time.Now().UTC(),
+	}
+	err = store.AddPeerToAccount(context.Background(), peer)
+	require.NoError(t, err)
+	assert.Equal(t, ownerEmail, peer.OwnerEmail, "the caller's peer must keep the plain email")
+
+	raw := rawOwnerEmail(peer.ID)
+	assert.NotEmpty(t, raw)
+	assert.NotEqual(t, ownerEmail, raw, "the owner email must be encrypted in the database")
+
+	stored, err := store.GetPeerByID(context.Background(), LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ownerEmail, stored.OwnerEmail)
+
+	// saving the peer read from the store must not encrypt the email twice
+	require.NoError(t, store.SavePeer(context.Background(), accountID, stored))
+	peers, err := store.GetAccountPeers(context.Background(), LockingStrengthNone, accountID, "owned-peer", "", nil)
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	assert.Equal(t, ownerEmail, peers[0].OwnerEmail)
+
+	updatedEmail := "new-owner@example.com"
+	require.NoError(t, store.SavePeerOwnerEmail(context.Background(), accountID, peer.ID, updatedEmail))
+	assert.NotEqual(t, updatedEmail, rawOwnerEmail(peer.ID))
+
+	account, err := store.GetAccount(context.Background(), accountID)
+	require.NoError(t, err)
+	require.Contains(t, account.Peers, peer.ID)
+	assert.Equal(t, updatedEmail, account.Peers[peer.ID].OwnerEmail)
+
+	require.NoError(t, store.SaveAccount(context.Background(), account))
+	stored, err = store.GetPeerByID(context.Background(), LockingStrengthNone, accountID, peer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, updatedEmail, stored.OwnerEmail)
+
+	err = store.SavePeerOwnerEmail(context.Background(), accountID, "unknown-peer", updatedEmail)
+	require.Error(t, err)
+}
+
 func TestSqlStore_SaveUserWithEncryption(t *testing.T) {
 	store, cleanup, err := NewTestStoreFromSQL(context.Background(), "../testdata/extended-store.sql", t.TempDir())
 	t.Cleanup(cleanup)
@@ -3979,7 +4295,7 @@ func TestSqlStore_ApproveAccountPeers(t *testing.T) {
 			require.NoError(t, err)
 			assert.Equal(t, 2, count)
 
-			allPeers, err := store.GetAccountPeers(ctx, LockingStrengthNone, accountID, "", "")
+			allPeers, err := store.GetAccountPeers(ctx, LockingStrengthNone, accountID, "", "", nil)
 			require.NoError(t, err)
 
 			for _, peer := range allPeers {
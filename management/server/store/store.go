@@ -50,6 +50,23 @@ const (
 	LockingStrengthNone        LockingStrength = "NONE"          // No locking, allowing all transactions to proceed without restrictions.
 )
 
+// PeerFilters narrows down the peers returned by GetFilteredAccountPeers and counted by CountAccountPeers.
+// Empty fields are ignored
+type PeerFilters struct {
+	// IDs keeps the peers with the given IDs when not nil, an empty list matches no peers
+	IDs       []string
+	Name      string
+	IP        string
+	Connected *bool
+	Ephemeral *bool
+	// GroupID keeps the peers that are members of the group
+	GroupID string
+	// ExcludeGroupID keeps the peers that are not members of the group
+	ExcludeGroupID string
+	// PinnedFirst lists the peers pinned by the requesting user first. It only orders the peers, it doesn't filter them
+	PinnedFirst bool
+}
+
 type Store interface {
 	GetAccountsCounter(ctx context.Context) (int64, error)
 	GetAllAccounts(ctx context.Context) []*types.Account
@@ -134,27 +151,52 @@ type Store interface {
 	GetPeerLabelsInAccount(ctx context.Context, lockStrength LockingStrength, accountId string, hostname string) ([]string, error)
 	AddPeerToAllGroup(ctx context.Context, accountID string, peerID string) error
 	AddPeerToGroup(ctx context.Context, accountID, peerId string, groupID string) error
+	AddPeerToAutoGroup(ctx context.Context, accountID, peerID string, groupID string) error
 	RemovePeerFromGroup(ctx context.Context, peerID string, groupID string) error
 	RemovePeerFromAllGroups(ctx context.Context, peerID string) error
 	GetPeerGroups(ctx context.Context, lockStrength LockingStrength, accountId string, peerId string) ([]*types.Group, error)
 	GetPeerGroupIDs(ctx context.Context, lockStrength LockingStrength, accountId string, peerId string) ([]string, error)
+	GetPeerLoginExpirationOverride(ctx context.Context, lockStrength LockingStrength, accountID string, peerID string) (time.Duration, error)
+	GetPeerAutoGroupIDs(ctx context.Context, lockStrength LockingStrength, accountID string, peerID string) ([]string, error)
 	AddResourceToGroup(ctx context.Context, accountId string, groupID string, resource *types.Resource) error
 	RemoveResourceFromGroup(ctx context.Context, accountId string, groupID string, resourceID string) error
 	AddPeerToAccount(ctx context.Context, peer *nbpeer.Peer) error
 	GetPeerByPeerPubKey(ctx context.Context, lockStrength LockingStrength, peerKey string) (*nbpeer.Peer, error)
-	GetAccountPeers(ctx context.Context, lockStrength LockingStrength, accountID, nameFilter, ipFilter string) ([]*nbpeer.Peer, error)
+	GetAccountPeers(ctx context.Context, lockStrength LockingStrength, accountID, nameFilter, ipFilter string, ephemeralFilter *bool) ([]*nbpeer.Peer, error)
+	GetFilteredAccountPeers(ctx context.Context, lockStrength LockingStrength, accountID string, filters PeerFilters) ([]*nbpeer.Peer, error)
+	CountAccountPeers(ctx context.Context, lockStrength LockingStrength, accountID string, filters PeerFilters) (int64, error)
 	GetUserPeers(ctx context.Context, lockStrength LockingStrength, accountID, userID string) ([]*nbpeer.Peer, error)
+	GetUnclaimedPeers(ctx context.Context, lockStrength LockingStrength, accountID string) ([]*nbpeer.Peer, error)
+	GetPeersBySetupKey(ctx context.Context, lockStrength LockingStrength, accountID, setupKeyID string) ([]*nbpeer.Peer, error)
+	GetPeersByKeyPrefix(ctx context.Context, lockStrength LockingStrength, accountID, keyPrefix string) ([]*nbpeer.Peer, error)
 	GetPeerByID(ctx context.Context, lockStrength LockingStrength, accountID string, peerID string) (*nbpeer.Peer, error)
 	GetPeersByIDs(ctx context.Context, lockStrength LockingStrength, accountID string, peerIDs []string) (map[string]*nbpeer.Peer, error)
 	GetPeersByGroupIDs(ctx context.Context, accountID string, groupIDs []string) ([]*nbpeer.Peer, error)
 	GetAccountPeersWithExpiration(ctx context.Context, lockStrength LockingStrength, accountID string) ([]*nbpeer.Peer, error)
 	GetAccountPeersWithInactivity(ctx context.Context, lockStrength LockingStrength, accountID string) ([]*nbpeer.Peer, error)
+	GetAccountPeersByCountry(ctx context.Context, lockStrength LockingStrength, accountID, countryCode string) ([]*nbpeer.Peer, error)
+	GetAccountPeersByRelay(ctx context.Context, lockStrength LockingStrength, accountID, relayAddress string) ([]*nbpeer.Peer, error)
 	GetAllEphemeralPeers(ctx context.Context, lockStrength LockingStrength) ([]*nbpeer.Peer, error)
 	SavePeer(ctx context.Context, accountID string, peer *nbpeer.Peer) error
 	SavePeerStatus(ctx context.Context, accountID, peerID string, status nbpeer.PeerStatus) error
 	SavePeerLocation(ctx context.Context, accountID string, peer *nbpeer.Peer) error
+	SavePeerLastHandshake(ctx context.Context, accountID, peerID string, lastHandshake time.Time) error
+	SavePeerUsageCapExceeded(ctx context.Context, accountID, peerID string, exceeded bool) error
+	SavePeerRelayAddress(ctx context.Context, accountID, peerID, relayAddress string) error
+	SavePeerOwnerEmail(ctx context.Context, accountID, peerID, email string) error
+	SavePeerPendingApprovalSince(ctx context.Context, accountID, peerID string, since time.Time) error
+	SavePeerFirstConnectedAt(ctx context.Context, accountID, peerID string, connectedAt time.Time) error
+	SavePeerMeta(ctx context.Context, accountID, peerID string, meta nbpeer.PeerSystemMeta) error
+	SavePeerConnectionPort(ctx context.Context, accountID, peerID string, port uint16) error
+	SavePeerAppliedNetworkSerials(ctx context.Context, serials map[string]uint64) error
+	SavePeerReportedErrors(ctx context.Context, accountID, peerID string, reportedErrors []nbpeer.ReportedError) error
 	ApproveAccountPeers(ctx context.Context, accountID string) (int, error)
 	DeletePeer(ctx context.Context, accountID string, peerID string) error
+	AddPeerUsageSample(ctx context.Context, sample *nbpeer.UsageSample) error
+	GetPeerLastUsageSample(ctx context.Context, lockStrength LockingStrength, accountID, peerID string) (*nbpeer.UsageSample, error)
+	GetPeerUsage(ctx context.Context, lockStrength LockingStrength, accountID, peerID string, since time.Time) (int64, int64, error)
+	DeleteUsageSamplesBefore(ctx context.Context, before time.Time) error
+	RollupUsageSamples(ctx context.Context, before time.Time, bucket time.Duration) error
 
 	GetSetupKeyBySecret(ctx context.Context, lockStrength LockingStrength, key string) (*types.SetupKey, error)
 	IncrementSetupKeyUsage(ctx context.Context, setupKeyID string) error
@@ -384,6 +426,9 @@ func getMigrationsPreAuto(ctx context.Context) []migrationFunc {
 		func(db *gorm.DB) error {
 			return migration.RemoveDuplicatePeerKeys(ctx, db)
 		},
+		func(db *gorm.DB) error {
+			return migration.MigrateGroupPeersAutoAssigned[types.GroupPeer](ctx, db)
+		},
 	}
 }
 
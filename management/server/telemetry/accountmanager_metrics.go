@@ -2,6 +2,7 @@ package telemetry
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/otel/metric"
@@ -10,10 +11,16 @@ import (
 // AccountManagerMetrics represents all metrics related to the AccountManager
 type AccountManagerMetrics struct {
 	ctx                          context.Context
+	meter                        metric.Meter
 	updateAccountPeersDurationMs metric.Float64Histogram
 	getPeerNetworkMapDurationMs  metric.Float64Histogram
 	networkMapObjectCount        metric.Int64Histogram
+	networkMapMaxObjectGauge     metric.Int64ObservableGauge
+	networkMapMaxObjectCount     atomic.Int64
 	peerMetaUpdateCount          metric.Int64Counter
+	laggingPeersCount            metric.Int64Counter
+	requestBufferDepthGauge      metric.Int64ObservableGauge
+	addPeerQueueDepthGauge       metric.Int64ObservableGauge
 }
 
 // NewAccountManagerMetrics creates an instance of AccountManagerMetrics
@@ -48,6 +55,13 @@ func NewAccountManagerMetrics(ctx context.Context, meter metric.Meter) (*Account
 		return nil, err
 	}
 
+	networkMapMaxObjectGauge, err := meter.Int64ObservableGauge("management.account.network.map.max.object.count",
+		metric.WithUnit("objects"),
+		metric.WithDescription("Largest number of objects in a network map calculated since the last collection"))
+	if err != nil {
+		return nil, err
+	}
+
 	peerMetaUpdateCount, err := meter.Int64Counter("management.account.peer.meta.update.counter",
 		metric.WithUnit("1"),
 		metric.WithDescription("Number of updates with new meta data from the peers"))
@@ -55,14 +69,52 @@ func NewAccountManagerMetrics(ctx context.Context, meter metric.Meter) (*Account
 		return nil, err
 	}
 
-	return &AccountManagerMetrics{
+	laggingPeersCount, err := meter.Int64Counter("management.account.lagging.peers.counter",
+		metric.WithUnit("1"),
+		metric.WithDescription("Number of connected peers that didn't acknowledge the network map sent with the previous account peers update"))
+	if err != nil {
+		return nil, err
+	}
+
+	requestBufferDepthGauge, err := meter.Int64ObservableGauge("management.account.request.buffer.depth",
+		metric.WithUnit("1"),
+		metric.WithDescription("Number of get account requests waiting in the account request buffer"))
+	if err != nil {
+		return nil, err
+	}
+
+	addPeerQueueDepthGauge, err := meter.Int64ObservableGauge("management.account.add.peer.queue.depth",
+		metric.WithUnit("1"),
+		metric.WithDescription("Number of peer registrations waiting for a free per account registration slot"))
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := &AccountManagerMetrics{
 		ctx:                          ctx,
+		meter:                        meter,
 		getPeerNetworkMapDurationMs:  getPeerNetworkMapDurationMs,
 		updateAccountPeersDurationMs: updateAccountPeersDurationMs,
 		networkMapObjectCount:        networkMapObjectCount,
+		networkMapMaxObjectGauge:     networkMapMaxObjectGauge,
 		peerMetaUpdateCount:          peerMetaUpdateCount,
-	}, nil
+		laggingPeersCount:            laggingPeersCount,
+		requestBufferDepthGauge:      requestBufferDepthGauge,
+		addPeerQueueDepthGauge:       addPeerQueueDepthGauge,
+	}
 
+	_, err = meter.RegisterCallback(
+		func(ctx context.Context, observer metric.Observer) error {
+			observer.ObserveInt64(networkMapMaxObjectGauge, metrics.networkMapMaxObjectCount.Swap(0))
+			return nil
+		},
+		networkMapMaxObjectGauge,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
 }
 
 // CountUpdateAccountPeersDuration counts the duration of updating account peers
@@ -78,9 +130,49 @@ func (metrics *AccountManagerMetrics) CountGetPeerNetworkMapDuration(duration ti
 // CountNetworkMapObjects counts the number of network map objects
 func (metrics *AccountManagerMetrics) CountNetworkMapObjects(count int64) {
 	metrics.networkMapObjectCount.Record(metrics.ctx, count)
+	metrics.trackMaxNetworkMapObjects(count)
+}
+
+// trackMaxNetworkMapObjects keeps the largest network map object count until the next gauge collection
+func (metrics *AccountManagerMetrics) trackMaxNetworkMapObjects(count int64) {
+	for {
+		current := metrics.networkMapMaxObjectCount.Load()
+		if count <= current || metrics.networkMapMaxObjectCount.CompareAndSwap(current, count) {
+			return
+		}
+	}
 }
 
 // CountPeerMetUpdate counts the number of peer meta updates
 func (metrics *AccountManagerMetrics) CountPeerMetUpdate() {
 	metrics.peerMetaUpdateCount.Add(metrics.ctx, 1)
 }
+
+// CountLaggingPeers counts the connected peers that didn't acknowledge the previously sent network map
+func (metrics *AccountManagerMetrics) CountLaggingPeers(count int) {
+	metrics.laggingPeersCount.Add(metrics.ctx, int64(count))
+}
+
+// RegisterRequestBufferDepth registers a function that collects the number of pending account requests and feeds it to the metrics gauge.
+func (metrics *AccountManagerMetrics) RegisterRequestBufferDepth(producer func() int64) error {
+	_, err := metrics.meter.RegisterCallback(
+		func(ctx context.Context, observer metric.Observer) error {
+			observer.ObserveInt64(metrics.requestBufferDepthGauge, producer())
+			return nil
+		},
+		metrics.requestBufferDepthGauge,
+	)
+	return err
+}
+
+// RegisterAddPeerQueueDepth registers a function that collects the number of peer registrations waiting for a slot and feeds it to the metrics gauge.
+func (metrics *AccountManagerMetrics) RegisterAddPeerQueueDepth(producer func() int64) error {
+	_, err := metrics.meter.RegisterCallback(
+		func(ctx context.Context, observer metric.Observer) error {
+			observer.ObserveInt64(metrics.addPeerQueueDepthGauge, producer())
+			return nil
+		},
+		metrics.addPeerQueueDepthGauge,
+	)
+	return err
+}
@@ -23,6 +23,7 @@ type MockAppMetrics struct {
 	GetMeterFunc                 func() metric2.Meter
 	CloseFunc                    func() error
 	ExposeFunc                   func(ctx context.Context, port int, endpoint string) error
+	HandleFunc                   func(endpoint string, handler http.Handler)
 	IDPMetricsFunc               func() *IDPMetrics
 	HTTPMiddlewareFunc           func() *HTTPMiddleware
 	GRPCMetricsFunc              func() *GRPCMetrics
@@ -55,6 +56,13 @@ func (mock *MockAppMetrics) Expose(ctx context.Context, port int, endpoint strin
 	return fmt.Errorf("unimplemented")
 }
 
+// Handle mocks the Handle function of the AppMetrics interface
+func (mock *MockAppMetrics) Handle(endpoint string, handler http.Handler) {
+	if mock.HandleFunc != nil {
+		mock.HandleFunc(endpoint, handler)
+	}
+}
+
 // IDPMetrics mocks the IDPMetrics function of the IDPMetrics interface
 func (mock *MockAppMetrics) IDPMetrics() *IDPMetrics {
 	if mock.IDPMetricsFunc != nil {
@@ -108,6 +116,7 @@ type AppMetrics interface {
 	GetMeter() metric2.Meter
 	Close() error
 	Expose(ctx context.Context, port int, endpoint string) error
+	Handle(endpoint string, handler http.Handler)
 	IDPMetrics() *IDPMetrics
 	HTTPMiddleware() *HTTPMiddleware
 	GRPCMetrics() *GRPCMetrics
@@ -128,6 +137,8 @@ type defaultAppMetrics struct {
 	storeMetrics          *StoreMetrics
 	updateChannelMetrics  *UpdateChannelMetrics
 	accountManagerMetrics *AccountManagerMetrics
+	// handlers are additional handlers served next to the metrics endpoint, e.g. health checks
+	handlers map[string]http.Handler
 }
 
 // IDPMetrics returns metrics for the idp package
@@ -178,6 +189,9 @@ func (appMetrics *defaultAppMetrics) Expose(ctx context.Context, port int, endpo
 	rootRouter.Handle(endpoint, promhttp.HandlerFor(
 		prometheus2.DefaultGatherer,
 		promhttp.HandlerOpts{EnableOpenMetrics: true}))
+	for handlerEndpoint, handler := range appMetrics.handlers {
+		rootRouter.Handle(handlerEndpoint, handler)
+	}
 	listener, err := net.Listen("tcp4", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return err
@@ -195,6 +209,11 @@ func (appMetrics *defaultAppMetrics) Expose(ctx context.Context, port int, endpo
 	return nil
 }
 
+// Handle registers an additional handler served on the metrics port. It has to be called before Expose.
+func (appMetrics *defaultAppMetrics) Handle(endpoint string, handler http.Handler) {
+	appMetrics.handlers[endpoint] = handler
+}
+
 // GetMeter returns metrics meter that can be used to add various counters
 func (appMetrics *defaultAppMetrics) GetMeter() metric2.Meter {
 	return appMetrics.Meter
@@ -250,5 +269,6 @@ func NewDefaultAppMetrics(ctx context.Context) (AppMetrics, error) {
 		storeMetrics:          storeMetrics,
 		updateChannelMetrics:  updateChannelMetrics,
 		accountManagerMetrics: accountManagerMetrics,
+		handlers:              make(map[string]http.Handler),
 	}, nil
 }
@@ -8,6 +8,10 @@ import (
 	"go.opentelemetry.io/otel/metric"
 )
 
+// SlowPeerNetworkMapThreshold is the network map calculation duration from which a peer is counted as an outlier
+// of its account
+const SlowPeerNetworkMapThreshold = time.Second
+
 // UpdateChannelMetrics represents all metrics related to the UpdateChannel
 type UpdateChannelMetrics struct {
 	createChannelDurationMicro        metric.Int64Histogram
@@ -20,6 +24,7 @@ type UpdateChannelMetrics struct {
 	hasChannelDurationMicro           metric.Int64Histogram
 	calcPostureChecksDurationMicro    metric.Int64Histogram
 	calcPeerNetworkMapDurationMs      metric.Int64Histogram
+	calcPeerNetworkMapSlowCounter     metric.Int64Counter
 	mergeNetworkMapDurationMicro      metric.Int64Histogram
 	toSyncResponseDurationMicro       metric.Int64Histogram
 	ctx                               context.Context
@@ -109,6 +114,14 @@ func NewUpdateChannelMetrics(ctx context.Context, meter metric.Meter) (*UpdateCh
 		return nil, err
 	}
 
+	calcPeerNetworkMapSlowCounter, err := meter.Int64Counter("management.updatechannel.calc.networkmap.slow.counter",
+		metric.WithUnit("1"),
+		metric.WithDescription("Number of peer network maps that took longer than the threshold to calculate, by account"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	mergeNetworkMapDurationMicro, err := meter.Int64Histogram("management.updatechannel.merge.networkmap.duration.micro",
 		metric.WithUnit("microseconds"),
 		metric.WithDescription("Duration of how long it takes to merge the network maps for a peer"),
@@ -136,6 +149,7 @@ func NewUpdateChannelMetrics(ctx context.Context, meter metric.Meter) (*UpdateCh
 		hasChannelDurationMicro:           hasChannelDurationMicro,
 		calcPostureChecksDurationMicro:    calcPostureChecksDurationMicro,
 		calcPeerNetworkMapDurationMs:      calcPeerNetworkMapDurationMs,
+		calcPeerNetworkMapSlowCounter:     calcPeerNetworkMapSlowCounter,
 		mergeNetworkMapDurationMicro:      mergeNetworkMapDurationMicro,
 		toSyncResponseDurationMicro:       toSyncResponseDurationMicro,
 		ctx:                               ctx,
@@ -182,8 +196,14 @@ func (metrics *UpdateChannelMetrics) CountCalcPostureChecksDuration(duration tim
 	metrics.calcPostureChecksDurationMicro.Record(metrics.ctx, duration.Microseconds())
 }
 
-func (metrics *UpdateChannelMetrics) CountCalcPeerNetworkMapDuration(duration time.Duration) {
+// CountCalcPeerNetworkMapDuration counts the duration of the network map calculation of a peer.
+// Calculations slower than SlowPeerNetworkMapThreshold are also counted by account, so that the accounts with
+// expensive network maps surface without labeling the duration histogram by account or peer
+func (metrics *UpdateChannelMetrics) CountCalcPeerNetworkMapDuration(duration time.Duration, accountID string) {
 	metrics.calcPeerNetworkMapDurationMs.Record(metrics.ctx, duration.Milliseconds())
+	if duration > SlowPeerNetworkMapThreshold {
+		metrics.calcPeerNetworkMapSlowCounter.Add(metrics.ctx, 1, metric.WithAttributes(attribute.String(AccountIDLabel, accountID)))
+	}
 }
 
 func (metrics *UpdateChannelMetrics) CountMergeNetworkMapDuration(duration time.Duration) {
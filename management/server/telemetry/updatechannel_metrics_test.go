@@ -0,0 +1,53 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestUpdateChannelMetrics_CountCalcPeerNetworkMapDuration(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	metrics, err := NewUpdateChannelMetrics(context.Background(), provider.Meter("test"))
+	require.NoError(t, err)
+
+	metrics.CountCalcPeerNetworkMapDuration(10*time.Millisecond, "account1")
+	metrics.CountCalcPeerNetworkMapDuration(SlowPeerNetworkMapThreshold+time.Millisecond, "account1")
+	metrics.CountCalcPeerNetworkMapDuration(SlowPeerNetworkMapThreshold+time.Second, "account1")
+	metrics.CountCalcPeerNetworkMapDuration(SlowPeerNetworkMapThreshold+time.Millisecond, "account2")
+
+	var data metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &data))
+
+	slow := make(map[string]int64)
+	var calculations uint64
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			switch m.Name {
+			case "management.updatechannel.calc.networkmap.slow.counter":
+				sum, ok := m.Data.(metricdata.Sum[int64])
+				require.True(t, ok)
+				for _, point := range sum.DataPoints {
+					accountID, _ := point.Attributes.Value(attribute.Key(AccountIDLabel))
+					slow[accountID.AsString()] = point.Value
+				}
+			case "management.updatechannel.calc.networkmap.duration.ms":
+				histogram, ok := m.Data.(metricdata.Histogram[int64])
+				require.True(t, ok)
+				for _, point := range histogram.DataPoints {
+					calculations += point.Count
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, uint64(4), calculations, "every calculation should be recorded")
+	assert.Equal(t, map[string]int64{"account1": 2, "account2": 1}, slow, "only the slow calculations should be counted by account")
+}
@@ -299,11 +299,13 @@ func (a *Account) GetPeerNetworkMap(
 	peerGroups := a.GetPeerGroups(peerID)
 
 	aclPeers, firewallRules, authorizedUsers, enableSSH := a.GetPeerConnectionResources(ctx, peer, validatedPeersMap, groupIDToUserIDs)
+	firewallRules = applyPeerFirewallOverrides(peer, firewallRules)
 	// exclude expired peers
 	var peersToConnect []*nbpeer.Peer
 	var expiredPeers []*nbpeer.Peer
+	expirationOverrides := a.GetPeerLoginExpirationOverrides()
 	for _, p := range aclPeers {
-		expired, _ := p.LoginExpired(a.Settings.PeerLoginExpiration)
+		expired, _ := p.LoginExpired(a.Settings.GetPeerLoginExpiration(expirationOverrides, p.ID), a.Settings.GetPeerExpirationTolerance())
 		if a.Settings.PeerLoginExpirationEnabled && expired {
 			expiredPeers = append(expiredPeers, p)
 			continue
@@ -354,6 +356,7 @@ func (a *Account) GetPeerNetworkMap(
 		AuthorizedUsers:     authorizedUsers,
 		EnableSSH:           enableSSH,
 	}
+	nm.SetAccessPaths(peer)
 
 	if metrics != nil {
 		objectCount := int64(len(peersToConnectIncludingRouters) + len(expiredPeers) + len(routesUpdate) + len(networkResourcesRoutes) + len(firewallRules) + +len(networkResourcesFirewallRules) + len(routesFirewallRules))
@@ -554,11 +557,21 @@ func (a *Account) GetPeersCustomZone(ctx context.Context, dnsDomain string) nbdn
 	return customZone
 }
 
+// GetPeerLoginExpirationOverrides returns the peer login expiration overrides defined by the account groups, keyed by peer ID
+func (a *Account) GetPeerLoginExpirationOverrides() map[string]time.Duration {
+	overrides := make(map[string]time.Duration)
+	for _, g := range a.Groups {
+		g.addPeerLoginExpirationOverrides(overrides)
+	}
+	return overrides
+}
+
 // GetExpiredPeers returns peers that have been expired
 func (a *Account) GetExpiredPeers() []*nbpeer.Peer {
 	var peers []*nbpeer.Peer
+	expirationOverrides := a.GetPeerLoginExpirationOverrides()
 	for _, peer := range a.GetPeersWithExpiration() {
-		expired, _ := peer.LoginExpired(a.Settings.PeerLoginExpiration)
+		expired, _ := peer.LoginExpired(a.Settings.GetPeerLoginExpiration(expirationOverrides, peer.ID), a.Settings.GetPeerExpirationTolerance())
 		if expired {
 			peers = append(peers, peer)
 		}
@@ -576,12 +589,13 @@ func (a *Account) GetNextPeerExpiration() (time.Duration, bool) {
 		return 0, false
 	}
 	var nextExpiry *time.Duration
+	expirationOverrides := a.GetPeerLoginExpirationOverrides()
 	for _, peer := range peersWithExpiry {
 		// consider only connected peers because others will require login on connecting to the management server
 		if peer.Status.LoginExpired || !peer.Status.Connected {
 			continue
 		}
-		_, duration := peer.LoginExpired(a.Settings.PeerLoginExpiration)
+		_, duration := peer.LoginExpired(a.Settings.GetPeerLoginExpiration(expirationOverrides, peer.ID), a.Settings.GetPeerExpirationTolerance())
 		if nextExpiry == nil || duration < *nextExpiry {
 			// if expiration is below 1s return 1s duration
 			// this avoids issues with ticker that can't be set to < 0
@@ -614,7 +628,7 @@ func (a *Account) GetPeersWithExpiration() []*nbpeer.Peer {
 func (a *Account) GetInactivePeers() []*nbpeer.Peer {
 	var peers []*nbpeer.Peer
 	for _, inactivePeer := range a.GetPeersWithInactivity() {
-		inactive, _ := inactivePeer.SessionExpired(a.Settings.PeerInactivityExpiration)
+		inactive, _ := inactivePeer.SessionExpired(a.Settings.PeerInactivityExpiration, a.Settings.GetPeerExpirationTolerance())
 		if inactive {
 			peers = append(peers, inactivePeer)
 		}
@@ -635,7 +649,7 @@ func (a *Account) GetNextInactivePeerExpiration() (time.Duration, bool) {
 		if peer.Status.LoginExpired || peer.Status.Connected {
 			continue
 		}
-		_, duration := peer.SessionExpired(a.Settings.PeerInactivityExpiration)
+		_, duration := peer.SessionExpired(a.Settings.PeerInactivityExpiration, a.Settings.GetPeerExpirationTolerance())
 		if nextExpiry == nil || duration < *nextExpiry {
 			// if expiration is below 1s return 1s duration
 			// this avoids issues with ticker that can't be set to < 0
@@ -1114,6 +1128,33 @@ func (a *Account) GetPeerConnectionResources(ctx context.Context, peer *nbpeer.P
 	return peers, fwRules, authorizedUsers, sshEnabled
 }
 
+// RemoveQuarantinedPeers removes from the validated peers the peers added with SSO login whose owner is blocked, when
+// the account quarantines them. These peers then receive an empty network map and are not visible to the other peers
+func (a *Account) RemoveQuarantinedPeers(validatedPeers map[string]struct{}) {
+	if a.Settings == nil || a.Settings.GetBlockedPeerOwnerBehavior() != BlockedPeerOwnerQuarantine {
+		return
+	}
+
+	for peerID, peer := range a.Peers {
+		if !peer.AddedWithSSOLogin() {
+			continue
+		}
+		if owner, ok := a.Users[peer.UserID]; ok && owner.IsBlocked() {
+			delete(validatedPeers, peerID)
+		}
+	}
+}
+
+// RemovePeersPendingApproval removes from the validated peers the peers waiting for the approval required by their
+// setup key. Like the peers rejected by the integrated validator, they are not visible to the other peers
+func (a *Account) RemovePeersPendingApproval(validatedPeers map[string]struct{}) {
+	for peerID, peer := range a.Peers {
+		if peer.Status != nil && peer.Status.RequiresApproval {
+			delete(validatedPeers, peerID)
+		}
+	}
+}
+
 func (a *Account) getAllowedUserIDs() map[string]struct{} {
 	users := make(map[string]struct{})
 	for _, nbUser := range a.Users {
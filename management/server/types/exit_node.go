@@ -0,0 +1,84 @@
+package types
+
+import (
+	"cmp"
+	"net/netip"
+	"slices"
+
+	"github.com/netbirdio/netbird/route"
+)
+
+// ExitNode is an exit node route of the network map of a peer, a default route served by another peer
+type ExitNode struct {
+	RouteID route.ID
+	NetID   route.NetID
+	Network netip.Prefix
+	// PeerID is the ID of the routing peer serving the route
+	PeerID string
+	Metric int
+	// AutoApply is false when the route is only offered to the peer and has to be selected on the client
+	AutoApply bool
+}
+
+func newExitNode(r *route.Route, peerID string) ExitNode {
+	return ExitNode{
+		RouteID:   r.ID,
+		NetID:     r.NetID,
+		Network:   r.Network,
+		PeerID:    peerID,
+		Metric:    r.Metric,
+		AutoApply: !r.SkipAutoApply,
+	}
+}
+
+// PeerExitNode is the exit node configuration of a peer as resolved from its network map
+type PeerExitNode struct {
+	PeerID string
+	// Effective is the exit node the peer sends its traffic through unless another one is selected on the client,
+	// nil if the peer has no auto applied exit node
+	Effective *ExitNode
+	// ExitNodes are all the exit nodes of the network map of the peer
+	ExitNodes []ExitNode
+}
+
+// EffectiveExitNode returns the exit node the client applies by default: the auto applied exit node route with the
+// lowest metric, IPv4 routes first on a tie. Returns nil if the network map has no auto applied exit node
+func (nm *NetworkMap) EffectiveExitNode() *ExitNode {
+	var effective *ExitNode
+	for i := range nm.ExitNodes {
+		exitNode := &nm.ExitNodes[i]
+		if !exitNode.AutoApply {
+			continue
+		}
+		if effective == nil || compareExitNodes(exitNode, effective) < 0 {
+			effective = exitNode
+		}
+	}
+	if effective == nil {
+		return nil
+	}
+	exitNode := *effective
+	return &exitNode
+}
+
+func compareExitNodes(a, b *ExitNode) int {
+	if c := cmp.Compare(a.Metric, b.Metric); c != 0 {
+		return c
+	}
+	if a.Network.Addr().Is4() != b.Network.Addr().Is4() {
+		if a.Network.Addr().Is4() {
+			return -1
+		}
+		return 1
+	}
+	return cmp.Compare(a.RouteID, b.RouteID)
+}
+
+// mergeExitNodes adds the exit nodes of the other map that are missing in the map
+func (nm *NetworkMap) mergeExitNodes(other *NetworkMap) {
+	for _, exitNode := range other.ExitNodes {
+		if !slices.ContainsFunc(nm.ExitNodes, func(e ExitNode) bool { return e.RouteID == exitNode.RouteID }) {
+			nm.ExitNodes = append(nm.ExitNodes, exitNode)
+		}
+	}
+}
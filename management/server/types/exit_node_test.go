@@ -0,0 +1,63 @@
+package types
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/route"
+)
+
+func TestNetworkMap_ExitNodes(t *testing.T) {
+	self := &nbpeer.Peer{ID: "self", Key: "self-key"}
+	primary := &nbpeer.Peer{ID: "primary", Key: "primary-key"}
+	backup := &nbpeer.Peer{ID: "backup", Key: "backup-key"}
+	manual := &nbpeer.Peer{ID: "manual", Key: "manual-key"}
+
+	nm := &NetworkMap{
+		Peers:        []*nbpeer.Peer{primary, manual},
+		OfflinePeers: []*nbpeer.Peer{backup},
+		Routes: []*route.Route{
+			{ID: "office", Network: netip.MustParsePrefix("10.10.0.0/16"), Peer: primary.Key},
+			{ID: "backup-v4", NetID: "backup", Network: netip.MustParsePrefix("0.0.0.0/0"), Peer: backup.Key, Metric: 200},
+			{ID: "primary-v6", NetID: "primary", Network: netip.MustParsePrefix("::/0"), Peer: primary.Key, Metric: 100},
+			{ID: "primary-v4", NetID: "primary", Network: netip.MustParsePrefix("0.0.0.0/0"), Peer: primary.Key, Metric: 100},
+			{ID: "manual-v4", NetID: "manual", Network: netip.MustParsePrefix("0.0.0.0/0"), Peer: manual.Key, Metric: 1, SkipAutoApply: true},
+			{ID: "own", Network: netip.MustParsePrefix("0.0.0.0/0"), Peer: self.Key, Metric: 1},
+		},
+	}
+	nm.SetAccessPaths(self)
+
+	routeIDs := make([]route.ID, 0, len(nm.ExitNodes))
+	for _, exitNode := range nm.ExitNodes {
+		routeIDs = append(routeIDs, exitNode.RouteID)
+	}
+	assert.ElementsMatch(t, []route.ID{"backup-v4", "primary-v6", "primary-v4", "manual-v4"}, routeIDs,
+		"exit nodes served by the peer itself and other routes should be left out")
+
+	effective := nm.EffectiveExitNode()
+	require.NotNil(t, effective)
+	assert.Equal(t, ExitNode{
+		RouteID:   "primary-v4",
+		NetID:     "primary",
+		Network:   netip.MustParsePrefix("0.0.0.0/0"),
+		PeerID:    "primary",
+		Metric:    100,
+		AutoApply: true,
+	}, *effective, "the auto applied IPv4 exit node with the lowest metric should be effective")
+
+	nm.Merge(&NetworkMap{ExitNodes: []ExitNode{{RouteID: "primary-v4"}, {RouteID: "proxy", AutoApply: true, Metric: 50}}})
+	assert.Len(t, nm.ExitNodes, 5, "merged exit nodes should be unique by route")
+	assert.Equal(t, route.ID("proxy"), nm.EffectiveExitNode().RouteID)
+
+	nm = &NetworkMap{
+		Peers:  []*nbpeer.Peer{manual},
+		Routes: []*route.Route{{ID: "manual-v4", Network: netip.MustParsePrefix("0.0.0.0/0"), Peer: manual.Key, SkipAutoApply: true}},
+	}
+	nm.SetAccessPaths(self)
+	assert.Len(t, nm.ExitNodes, 1)
+	assert.Nil(t, nm.EffectiveExitNode(), "exit nodes that aren't auto applied should not be effective")
+}
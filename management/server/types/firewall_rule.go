@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -16,6 +17,9 @@ import (
 const (
 	FirewallRuleDirectionIN  = 0
 	FirewallRuleDirectionOUT = 1
+
+	// PeerFirewallOverridePolicyID is the policy ID of the firewall rules created from peer firewall overrides
+	PeerFirewallOverridePolicyID = "peer-override"
 )
 
 // FirewallRule is a rule of the firewall.
@@ -47,6 +51,95 @@ func (r *FirewallRule) Equal(other *FirewallRule) bool {
 	return reflect.DeepEqual(r, other)
 }
 
+// applyPeerFirewallOverrides layers the firewall overrides of the peer on top of the policy derived rules.
+// The overrides are appended after the policy rules and replace every policy rule whose traffic they fully cover,
+// see firewallOverrideCovers, so the override action wins. Policy rules only partially covered by an override are kept.
+func applyPeerFirewallOverrides(peer *nbpeer.Peer, rules []*FirewallRule) []*FirewallRule {
+	if len(peer.FirewallOverrides) == 0 {
+		return rules
+	}
+
+	overrides := make([]*FirewallRule, 0, len(peer.FirewallOverrides))
+	for _, override := range peer.FirewallOverrides {
+		rule := &FirewallRule{
+			PolicyID:  PeerFirewallOverridePolicyID,
+			PeerIP:    override.PeerIP,
+			Direction: FirewallRuleDirectionIN,
+			Action:    override.Action,
+			Protocol:  override.Protocol,
+			Port:      override.Port,
+			PortRange: RulePortRange{Start: override.PortRange.Start, End: override.PortRange.End},
+		}
+		if override.Direction == nbpeer.FirewallOverrideDirectionOUT {
+			rule.Direction = FirewallRuleDirectionOUT
+		}
+		overrides = append(overrides, rule)
+	}
+
+	merged := make([]*FirewallRule, 0, len(rules)+len(overrides))
+	for _, rule := range rules {
+		covered := slices.ContainsFunc(overrides, func(override *FirewallRule) bool {
+			return firewallOverrideCovers(override, rule)
+		})
+		if !covered {
+			merged = append(merged, rule)
+		}
+	}
+
+	return append(merged, overrides...)
+}
+
+// firewallOverrideCovers reports whether the override matches all the traffic of the policy rule, regardless of
+// their actions. This is the case when both have the same direction and the override
+//   - targets the same remote peer IP or all peers (0.0.0.0),
+//   - uses the same protocol or all protocols,
+//   - has no ports, or its port or port range contains the port or port range of the rule.
+//
+// A single port is treated as a range starting and ending at that port.
+func firewallOverrideCovers(override, rule *FirewallRule) bool {
+	if override.Direction != rule.Direction {
+		return false
+	}
+
+	if override.PeerIP != allPeers && override.PeerIP != rule.PeerIP {
+		return false
+	}
+
+	if override.Protocol != string(PolicyRuleProtocolALL) && override.Protocol != rule.Protocol {
+		return false
+	}
+
+	overrideRange, ok := firewallRulePorts(override)
+	if !ok {
+		return false
+	}
+	if overrideRange == (RulePortRange{}) {
+		return true
+	}
+
+	ruleRange, ok := firewallRulePorts(rule)
+	if !ok || ruleRange == (RulePortRange{}) {
+		return false
+	}
+
+	return overrideRange.Start <= ruleRange.Start && ruleRange.End <= overrideRange.End
+}
+
+// firewallRulePorts returns the ports of the rule as a range, the empty range when the rule matches all ports.
+// It returns false if the port of the rule is not a valid port number.
+func firewallRulePorts(rule *FirewallRule) (RulePortRange, bool) {
+	if rule.Port == "" {
+		return rule.PortRange, true
+	}
+
+	port, err := strconv.ParseUint(rule.Port, 10, 16)
+	if err != nil {
+		return RulePortRange{}, false
+	}
+
+	return RulePortRange{Start: uint16(port), End: uint16(port)}, true
+}
+
 // generateRouteFirewallRules generates a list of firewall rules for a given route.
 func generateRouteFirewallRules(ctx context.Context, route *nbroute.Route, rule *PolicyRule, groupPeers []*nbpeer.Peer, direction int) []*RouteFirewallRule {
 	rulesExists := make(map[string]struct{})
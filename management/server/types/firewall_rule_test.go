@@ -0,0 +1,122 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+)
+
+func TestFirewallOverrideCovers(t *testing.T) {
+	rule := &FirewallRule{PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "accept", Protocol: "tcp", Port: "443"}
+	rangeRule := &FirewallRule{PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "accept", Protocol: "tcp", PortRange: RulePortRange{Start: 8000, End: 8100}}
+	allPortsRule := &FirewallRule{PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "accept", Protocol: "tcp"}
+
+	tests := []struct {
+		name     string
+		override *FirewallRule
+		rule     *FirewallRule
+		covers   bool
+	}{
+		{
+			name:     "same traffic",
+			override: &FirewallRule{PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "drop", Protocol: "tcp", Port: "443"},
+			rule:     rule,
+			covers:   true,
+		},
+		{
+			name:     "port range containing the port",
+			override: &FirewallRule{PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "drop", Protocol: "tcp", PortRange: RulePortRange{Start: 400, End: 500}},
+			rule:     rule,
+			covers:   true,
+		},
+		{
+			name:     "single port range equal to the port",
+			override: &FirewallRule{PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "drop", Protocol: "tcp", PortRange: RulePortRange{Start: 443, End: 443}},
+			rule:     rule,
+			covers:   true,
+		},
+		{
+			name:     "port range containing the rule range",
+			override: &FirewallRule{PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "drop", Protocol: "tcp", PortRange: RulePortRange{Start: 8000, End: 9000}},
+			rule:     rangeRule,
+			covers:   true,
+		},
+		{
+			name:     "port range overlapping the rule range",
+			override: &FirewallRule{PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "drop", Protocol: "tcp", PortRange: RulePortRange{Start: 8050, End: 9000}},
+			rule:     rangeRule,
+			covers:   false,
+		},
+		{
+			name:     "all ports",
+			override: &FirewallRule{PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "drop", Protocol: "tcp"},
+			rule:     rangeRule,
+			covers:   true,
+		},
+		{
+			name:     "port doesn't cover all ports",
+			override: &FirewallRule{PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "drop", Protocol: "tcp", Port: "443"},
+			rule:     allPortsRule,
+			covers:   false,
+		},
+		{
+			name:     "other direction",
+			override: &FirewallRule{PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionOUT, Action: "drop", Protocol: "tcp", Port: "443"},
+			rule:     rule,
+			covers:   false,
+		},
+		{
+			name:     "other protocol",
+			override: &FirewallRule{PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "drop", Protocol: "udp", Port: "443"},
+			rule:     rule,
+			covers:   false,
+		},
+		{
+			name:     "all protocols and peers",
+			override: &FirewallRule{PeerIP: allPeers, Direction: FirewallRuleDirectionIN, Action: "drop", Protocol: string(PolicyRuleProtocolALL)},
+			rule:     rule,
+			covers:   true,
+		},
+		{
+			name:     "other peer",
+			override: &FirewallRule{PeerIP: "100.64.0.3", Direction: FirewallRuleDirectionIN, Action: "drop", Protocol: "tcp", Port: "443"},
+			rule:     rule,
+			covers:   false,
+		},
+		{
+			name:     "override for a single peer doesn't cover a rule for all peers",
+			override: &FirewallRule{PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "drop", Protocol: "tcp", Port: "443"},
+			rule:     &FirewallRule{PeerIP: allPeers, Direction: FirewallRuleDirectionIN, Action: "accept", Protocol: "tcp", Port: "443"},
+			covers:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.covers, firewallOverrideCovers(tt.override, tt.rule))
+		})
+	}
+}
+
+func TestApplyPeerFirewallOverrides(t *testing.T) {
+	peer := &nbpeer.Peer{
+		FirewallOverrides: []nbpeer.FirewallOverride{
+			{PeerIP: "100.64.0.2", Direction: nbpeer.FirewallOverrideDirectionIN, Action: "drop", Protocol: "tcp", PortRange: nbpeer.FirewallOverridePortRange{Start: 1, End: 1024}},
+		},
+	}
+	rules := []*FirewallRule{
+		{PolicyID: "policy", PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "accept", Protocol: "tcp", Port: "22"},
+		{PolicyID: "policy", PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionOUT, Action: "accept", Protocol: "tcp", Port: "22"},
+		{PolicyID: "policy", PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "accept", Protocol: "tcp", Port: "8080"},
+	}
+
+	merged := applyPeerFirewallOverrides(peer, rules)
+
+	assert.Equal(t, []*FirewallRule{
+		rules[1],
+		rules[2],
+		{PolicyID: PeerFirewallOverridePolicyID, PeerIP: "100.64.0.2", Direction: FirewallRuleDirectionIN, Action: "drop", Protocol: "tcp", PortRange: RulePortRange{Start: 1, End: 1024}},
+	}, merged)
+}
@@ -1,6 +1,8 @@
 package types
 
 import (
+	"time"
+
 	"github.com/netbirdio/netbird/management/server/integration_reference"
 	"github.com/netbirdio/netbird/management/server/networks/resources/types"
 )
@@ -9,6 +11,11 @@ const (
 	GroupIssuedAPI         = "api"
 	GroupIssuedJWT         = "jwt"
 	GroupIssuedIntegration = "integration"
+
+	// MinGroupPeerLoginExpiration is the shortest peer login expiration a group can override the account setting with
+	MinGroupPeerLoginExpiration = time.Hour
+	// MaxGroupPeerLoginExpiration is the longest peer login expiration a group can override the account setting with
+	MaxGroupPeerLoginExpiration = 180 * 24 * time.Hour
 )
 
 // Group of the peers for ACL
@@ -32,6 +39,10 @@ type Group struct {
 	// Resources contains a list of resources in that group
 	Resources []Resource `gorm:"serializer:json"`
 
+	// PeerLoginExpiration overrides the account peer login expiration for the peers of the group.
+	// It can only shorten the account setting. Zero means the account setting applies.
+	PeerLoginExpiration time.Duration
+
 	IntegrationReference integration_reference.IntegrationReference `gorm:"embedded;embeddedPrefix:integration_ref_"`
 }
 
@@ -39,6 +50,9 @@ type GroupPeer struct {
 	AccountID string `gorm:"index"`
 	GroupID   string `gorm:"primaryKey"`
 	PeerID    string `gorm:"primaryKey"`
+	// AutoAssigned indicates that the membership was added from the auto groups of the peer's user
+	// rather than manually, so it can be removed once the group is no longer one of the user's auto groups
+	AutoAssigned bool
 }
 
 func (g *Group) LoadGroupPeers() {
@@ -79,6 +93,7 @@ func (g *Group) Copy() *Group {
 		Peers:                make([]string, len(g.Peers)),
 		GroupPeers:           make([]GroupPeer, len(g.GroupPeers)),
 		Resources:            make([]Resource, len(g.Resources)),
+		PeerLoginExpiration:  g.PeerLoginExpiration,
 		IntegrationReference: g.IntegrationReference,
 	}
 	copy(group.Peers, g.Peers)
@@ -87,6 +102,27 @@ func (g *Group) Copy() *Group {
 	return group
 }
 
+// PeerLoginExpirationOverrides maps the IDs of the peers that are members of groups overriding the peer login
+// expiration to the shortest override among their groups.
+func PeerLoginExpirationOverrides(groups []*Group) map[string]time.Duration {
+	overrides := make(map[string]time.Duration)
+	for _, g := range groups {
+		g.addPeerLoginExpirationOverrides(overrides)
+	}
+	return overrides
+}
+
+func (g *Group) addPeerLoginExpirationOverrides(overrides map[string]time.Duration) {
+	if g.PeerLoginExpiration <= 0 {
+		return
+	}
+	for _, peerID := range g.Peers {
+		if expiration, ok := overrides[peerID]; !ok || g.PeerLoginExpiration < expiration {
+			overrides[peerID] = g.PeerLoginExpiration
+		}
+	}
+}
+
 // HasPeers checks if the group has any peers.
 func (g *Group) HasPeers() bool {
 	return len(g.Peers) > 0
@@ -2,6 +2,7 @@ package types
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -88,3 +89,23 @@ func TestRemovePeer(t *testing.T) {
 		assert.Equal(t, 2, len(group.Peers))
 	})
 }
+
+func TestPeerLoginExpirationOverrides(t *testing.T) {
+	groups := []*Group{
+		{ID: "employees", Peers: []string{"peer1", "peer2"}},
+		{ID: "contractors", Peers: []string{"peer2", "peer3"}, PeerLoginExpiration: 24 * time.Hour},
+		{ID: "temporary", Peers: []string{"peer3"}, PeerLoginExpiration: 2 * time.Hour},
+	}
+
+	overrides := PeerLoginExpirationOverrides(groups)
+	assert.Equal(t, map[string]time.Duration{"peer2": 24 * time.Hour, "peer3": 2 * time.Hour}, overrides)
+
+	settings := &Settings{PeerLoginExpiration: 7 * 24 * time.Hour}
+	assert.Equal(t, 7*24*time.Hour, settings.GetPeerLoginExpiration(overrides, "peer1"), "peer without override should use the account setting")
+	assert.Equal(t, 2*time.Hour, settings.GetPeerLoginExpiration(overrides, "peer3"), "shortest group override should apply")
+
+	settings.PeerLoginExpiration = 12 * time.Hour
+	assert.Equal(t, 12*time.Hour, settings.GetPeerLoginExpiration(overrides, "peer2"), "a longer group override should be capped to the account setting")
+	assert.Equal(t, 2*time.Hour, settings.GetPeerLoginExpiration(overrides, "peer3"))
+	assert.Equal(t, 12*time.Hour, settings.ApplyPeerLoginExpirationOverride(0), "no override should use the account setting")
+}
@@ -0,0 +1,69 @@
+package types
+
+import (
+	"net"
+
+	"github.com/netbirdio/netbird/shared/management/status"
+)
+
+// PeerIPAllocator picks the IP of a new peer from the account network. It is called in the registration transaction,
+// takenIPs returns the IPs of the account peers as stored in that transaction. The IP doesn't have to be free, a taken
+// IP is rejected by the store and the registration retries in a new transaction
+type PeerIPAllocator interface {
+	AllocatePeerIP(ipNet net.IPNet, takenIPs func() ([]net.IP, error)) (net.IP, error)
+}
+
+// RandomPeerIPAllocator picks a random IP of the network
+type RandomPeerIPAllocator struct{}
+
+// AllocatePeerIP returns a random IP of the network, excluding the network and broadcast addresses. It doesn't read
+// the taken IPs, a collision is unlikely in large networks
+func (RandomPeerIPAllocator) AllocatePeerIP(ipNet net.IPNet, _ func() ([]net.IP, error)) (net.IP, error) {
+	return AllocateRandomPeerIP(ipNet)
+}
+
+// SequentialPeerIPAllocator hands out the IPs of a network in ascending order. It derives the next IP from the highest
+// IP taken in the network and starts over at the first free IP after the last one, so the allocated IPs don't depend
+// on the management instance or its uptime
+type SequentialPeerIPAllocator struct{}
+
+// AllocatePeerIP returns the first free IP following the highest taken IP of the network, excluding the network and
+// broadcast addresses
+func (SequentialPeerIPAllocator) AllocatePeerIP(ipNet net.IPNet, takenIPs func() ([]net.IP, error)) (net.IP, error) {
+	baseIP := ipToUint32(ipNet.IP.Mask(ipNet.Mask))
+
+	ones, bits := ipNet.Mask.Size()
+	totalIPs := uint64(1) << (bits - ones)
+	if totalIPs < 3 {
+		return nil, status.Errorf(status.PreconditionFailed, "network %s is out of IPs", ipNet.String())
+	}
+
+	ips, err := takenIPs()
+	if err != nil {
+		return nil, err
+	}
+
+	taken := make(map[uint64]struct{}, len(ips))
+	var lastOffset uint64
+	for _, ip := range ips {
+		if ip.To4() == nil || !ipNet.Contains(ip) {
+			continue
+		}
+		offset := uint64(ipToUint32(ip) - baseIP)
+		taken[offset] = struct{}{}
+		lastOffset = max(lastOffset, offset)
+	}
+
+	offset := lastOffset
+	for range totalIPs - 2 {
+		offset++
+		if offset >= totalIPs-1 {
+			offset = 1
+		}
+		if _, ok := taken[offset]; !ok {
+			return uint32ToIP(baseIP + uint32(offset)), nil
+		}
+	}
+
+	return nil, status.Errorf(status.PreconditionFailed, "network %s is out of IPs", ipNet.String())
+}
@@ -0,0 +1,48 @@
+package types
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequentialPeerIPAllocator(t *testing.T) {
+	allocator := SequentialPeerIPAllocator{}
+	ipNet := net.IPNet{IP: net.ParseIP("100.64.0.0"), Mask: net.IPMask{255, 255, 255, 248}}
+	taken := func(ips ...string) func() ([]net.IP, error) {
+		return func() ([]net.IP, error) {
+			var parsed []net.IP
+			for _, ip := range ips {
+				parsed = append(parsed, net.ParseIP(ip))
+			}
+			return parsed, nil
+		}
+	}
+
+	tests := []struct {
+		name     string
+		taken    []string
+		expected string
+	}{
+		{name: "empty network", expected: "100.64.0.1"},
+		{name: "follows the highest taken IP", taken: []string{"100.64.0.4", "100.64.0.1"}, expected: "100.64.0.5"},
+		{name: "ignores IPs outside of the network", taken: []string{"100.64.0.2", "100.65.0.1"}, expected: "100.64.0.3"},
+		{name: "starts over after the last IP", taken: []string{"100.64.0.1", "100.64.0.6"}, expected: "100.64.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := allocator.AllocatePeerIP(ipNet, taken(tt.taken...))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ip.String())
+		})
+	}
+
+	_, err := allocator.AllocatePeerIP(ipNet, taken("100.64.0.1", "100.64.0.2", "100.64.0.3", "100.64.0.4", "100.64.0.5", "100.64.0.6"))
+	assert.Error(t, err, "should fail when all host IPs are taken")
+
+	_, err = allocator.AllocatePeerIP(net.IPNet{IP: net.ParseIP("100.64.0.0"), Mask: net.IPMask{255, 255, 255, 254}}, taken())
+	assert.Error(t, err, "should fail when the network has no host IPs")
+}
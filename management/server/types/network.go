@@ -40,6 +40,30 @@ type NetworkMap struct {
 	ForwardingRules     []*ForwardingRule
 	AuthorizedUsers     map[string]map[string]struct{}
 	EnableSSH           bool
+	// AccessPaths tells how the peer reaches the entries of the map, keyed by the peer ID for the Peers entries
+	// and by the route ID for the Routes entries. Routes served by the peer itself have no access path
+	AccessPaths map[string]AccessPath
+	// ExitNodes are the exit node routes the peer can send all its traffic through, served by other peers
+	ExitNodes []ExitNode
+}
+
+// AccessPathType is the way a peer reaches a network map entry
+type AccessPathType string
+
+const (
+	// AccessPathDirect is a peer-to-peer connection to the remote peer
+	AccessPathDirect AccessPathType = "direct"
+	// AccessPathRouted is a network or resource reached through a routing peer
+	AccessPathRouted AccessPathType = "routed"
+	// AccessPathExitNode is the default route through an exit node
+	AccessPathExitNode AccessPathType = "exit-node"
+)
+
+// AccessPath describes how a peer reaches a network map entry
+type AccessPath struct {
+	Type AccessPathType
+	// ViaPeerID is the ID of the routing peer for routed and exit node paths
+	ViaPeerID string
 }
 
 func (nm *NetworkMap) Merge(other *NetworkMap) {
@@ -49,6 +73,124 @@ func (nm *NetworkMap) Merge(other *NetworkMap) {
 	nm.FirewallRules = util.MergeUnique(nm.FirewallRules, other.FirewallRules)
 	nm.RoutesFirewallRules = util.MergeUnique(nm.RoutesFirewallRules, other.RoutesFirewallRules)
 	nm.ForwardingRules = util.MergeUnique(nm.ForwardingRules, other.ForwardingRules)
+	nm.mergeAccessPaths(other)
+	nm.mergeExitNodes(other)
+}
+
+// SetAccessPaths annotates the peers and routes of the network map of the given peer with their access paths and
+// collects the exit nodes of the peer. Routes carry the key of their routing peer, so it is resolved to the peer ID
+// through the peers of the map
+func (nm *NetworkMap) SetAccessPaths(peer *nbpeer.Peer) {
+	nm.AccessPaths = make(map[string]AccessPath, len(nm.Peers)+len(nm.Routes))
+	nm.ExitNodes = nil
+
+	peerIDsByKey := make(map[string]string, len(nm.Peers)+len(nm.OfflinePeers))
+	for _, p := range nm.Peers {
+		nm.AccessPaths[p.ID] = AccessPath{Type: AccessPathDirect}
+		peerIDsByKey[p.Key] = p.ID
+	}
+	for _, p := range nm.OfflinePeers {
+		peerIDsByKey[p.Key] = p.ID
+	}
+
+	for _, r := range nm.Routes {
+		viaPeerID := r.PeerID
+		if viaPeerID == "" {
+			viaPeerID = peerIDsByKey[r.Peer]
+		}
+		if viaPeerID == "" || viaPeerID == peer.ID || r.Peer == peer.Key {
+			continue
+		}
+
+		pathType := AccessPathRouted
+		if r.IsExitNode() {
+			pathType = AccessPathExitNode
+			nm.ExitNodes = append(nm.ExitNodes, newExitNode(r, viaPeerID))
+		}
+		nm.AccessPaths[string(r.ID)] = AccessPath{Type: pathType, ViaPeerID: viaPeerID}
+	}
+}
+
+// mergeAccessPaths adds the access paths of the other map, the merged peers without an access path are reached directly
+func (nm *NetworkMap) mergeAccessPaths(other *NetworkMap) {
+	if len(other.AccessPaths) == 0 && len(other.Peers) == 0 {
+		return
+	}
+	if nm.AccessPaths == nil {
+		nm.AccessPaths = make(map[string]AccessPath, len(other.AccessPaths)+len(other.Peers))
+	}
+	for id, path := range other.AccessPaths {
+		if _, ok := nm.AccessPaths[id]; !ok {
+			nm.AccessPaths[id] = path
+		}
+	}
+	for _, p := range other.Peers {
+		if _, ok := nm.AccessPaths[p.ID]; !ok {
+			nm.AccessPaths[p.ID] = AccessPath{Type: AccessPathDirect}
+		}
+	}
+}
+
+// NetworkMapStats holds the size of a peer network map without its content
+type NetworkMapStats struct {
+	Peers               int
+	OfflinePeers        int
+	Routes              int
+	FirewallRules       int
+	RoutesFirewallRules int
+	ForwardingRules     int
+	DNSRecords          int
+}
+
+// ObjectCount returns the total number of objects in the network map
+func (s NetworkMapStats) ObjectCount() int {
+	return s.Peers + s.OfflinePeers + s.Routes + s.FirewallRules + s.RoutesFirewallRules + s.ForwardingRules + s.DNSRecords
+}
+
+// Stats returns the number of peers, rules, routes and DNS records in the network map
+func (nm *NetworkMap) Stats() NetworkMapStats {
+	stats := NetworkMapStats{
+		Peers:               len(nm.Peers),
+		OfflinePeers:        len(nm.OfflinePeers),
+		Routes:              len(nm.Routes),
+		FirewallRules:       len(nm.FirewallRules),
+		RoutesFirewallRules: len(nm.RoutesFirewallRules),
+		ForwardingRules:     len(nm.ForwardingRules),
+	}
+	for _, zone := range nm.DNSConfig.CustomZones {
+		stats.DNSRecords += len(zone.Records)
+	}
+	return stats
+}
+
+// RemoveDisconnectedPeers drops the peers that are not connected to management from the network map, together with
+// the firewall rules for their IPs, as dialing them is pointless. The offline peers with an expired login are kept,
+// so the clients keep listing them. The DNS records and routes are kept as well: the names of the dropped peers keep
+// resolving and the peers become reachable with the network map update sent when they connect
+func (nm *NetworkMap) RemoveDisconnectedPeers() {
+	connected := make([]*nbpeer.Peer, 0, len(nm.Peers))
+	removedIPs := make(map[string]struct{})
+	for _, peer := range nm.Peers {
+		if peer.Status != nil && peer.Status.Connected {
+			connected = append(connected, peer)
+			continue
+		}
+		removedIPs[peer.IP.String()] = struct{}{}
+		delete(nm.AccessPaths, peer.ID)
+	}
+	if len(removedIPs) == 0 {
+		return
+	}
+	nm.Peers = connected
+
+	// the map may share its rules with other network maps, so the rules are filtered into a new slice
+	rules := make([]*FirewallRule, 0, len(nm.FirewallRules))
+	for _, rule := range nm.FirewallRules {
+		if _, ok := removedIPs[rule.PeerIP]; !ok {
+			rules = append(rules, rule)
+		}
+	}
+	nm.FirewallRules = rules
 }
 
 func mergeUniquePeersByID(peers1, peers2 []*nbpeer.Peer) []*nbpeer.Peer {
@@ -199,6 +341,30 @@ func AllocatePeerIP(ipNet net.IPNet, takenIps []net.IP) (net.IP, error) {
 	return nil, status.Errorf(status.PreconditionFailed, "network %s is out of IPs", ipNet.String())
 }
 
+// FreePeerIPs returns the number of IPs of the net.IPNet that are still available for peers.
+// The network and broadcast IPs as well as the takenIps are not counted, taken IPs outside the net are ignored
+func FreePeerIPs(ipNet net.IPNet, takenIps []net.IP) int {
+	baseIP := ipToUint32(ipNet.IP.Mask(ipNet.Mask))
+
+	ones, bits := ipNet.Mask.Size()
+	hostBits := bits - ones
+	totalIPs := uint32(1 << hostBits)
+	if totalIPs <= 2 {
+		return 0
+	}
+
+	taken := make(map[uint32]struct{}, len(takenIps))
+	for _, ip := range takenIps {
+		candidate := ipToUint32(ip)
+		if candidate <= baseIP || candidate >= baseIP+totalIPs-1 {
+			continue
+		}
+		taken[candidate] = struct{}{}
+	}
+
+	return int(totalIPs-2) - len(taken)
+}
+
 func AllocateRandomPeerIP(ipNet net.IPNet) (net.IP, error) {
 	baseIP := ipToUint32(ipNet.IP.Mask(ipNet.Mask))
 
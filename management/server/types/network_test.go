@@ -2,10 +2,15 @@ package types
 
 import (
 	"net"
+	"net/netip"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/route"
 )
 
 func TestNewNetwork(t *testing.T) {
@@ -140,6 +145,29 @@ func TestAllocatePeerIPVariousCIDRs(t *testing.T) {
 	}
 }
 
+func TestFreePeerIPs(t *testing.T) {
+	ipNet := net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.IPMask{255, 255, 255, 224}}
+	assert.Equal(t, 30, FreePeerIPs(ipNet, nil))
+
+	takenIPs := []net.IP{
+		net.ParseIP("10.0.0.1"),
+		net.ParseIP("10.0.0.2"),
+		net.ParseIP("10.0.0.2"),  // duplicates are counted once
+		net.ParseIP("10.0.0.0"),  // network IP
+		net.ParseIP("10.0.0.31"), // broadcast IP
+		net.ParseIP("10.0.1.1"),  // outside the net
+	}
+	assert.Equal(t, 28, FreePeerIPs(ipNet, takenIPs))
+
+	var allocated []net.IP
+	for i := 0; i < 30; i++ {
+		ip, err := AllocatePeerIP(ipNet, allocated)
+		require.NoError(t, err)
+		allocated = append(allocated, ip)
+	}
+	assert.Equal(t, 0, FreePeerIPs(ipNet, allocated))
+}
+
 func TestGenerateIPs(t *testing.T) {
 	ipNet := net.IPNet{IP: net.ParseIP("100.64.0.0"), Mask: net.IPMask{255, 255, 255, 0}}
 	ips, ipsLen := generateIPs(&ipNet, map[string]struct{}{"100.64.0.0": {}})
@@ -151,3 +179,84 @@ func TestGenerateIPs(t *testing.T) {
 		t.Errorf("expected last ip to be: 100.64.0.253, got %s", ips[len(ips)-1].String())
 	}
 }
+
+func TestNetworkMap_Stats(t *testing.T) {
+	nm := &NetworkMap{
+		Peers:               []*nbpeer.Peer{{ID: "peer-1"}, {ID: "peer-2"}},
+		OfflinePeers:        []*nbpeer.Peer{{ID: "peer-3"}},
+		Routes:              []*route.Route{{ID: "route-1"}},
+		FirewallRules:       []*FirewallRule{{PeerIP: "100.64.0.1"}, {PeerIP: "100.64.0.2"}, {PeerIP: "100.64.0.3"}},
+		RoutesFirewallRules: []*RouteFirewallRule{{Destination: "10.0.0.0/8"}},
+		DNSConfig: nbdns.Config{
+			CustomZones: []nbdns.CustomZone{
+				{Domain: "netbird.cloud.", Records: []nbdns.SimpleRecord{{Name: "peer-1.netbird.cloud."}, {Name: "peer-2.netbird.cloud."}}},
+				{Domain: "example.com.", Records: []nbdns.SimpleRecord{{Name: "app.example.com."}}},
+			},
+		},
+	}
+
+	stats := nm.Stats()
+	assert.Equal(t, NetworkMapStats{
+		Peers:               2,
+		OfflinePeers:        1,
+		Routes:              1,
+		FirewallRules:       3,
+		RoutesFirewallRules: 1,
+		DNSRecords:          3,
+	}, stats)
+	assert.Equal(t, 11, stats.ObjectCount())
+	assert.Zero(t, (&NetworkMap{}).Stats().ObjectCount())
+}
+
+func TestNetworkMap_RemoveDisconnectedPeers(t *testing.T) {
+	connected := &nbpeer.Peer{ID: "connected", IP: net.ParseIP("100.64.0.1"), Status: &nbpeer.PeerStatus{Connected: true}}
+	disconnected := &nbpeer.Peer{ID: "disconnected", IP: net.ParseIP("100.64.0.2"), Status: &nbpeer.PeerStatus{}}
+	expired := &nbpeer.Peer{ID: "expired", IP: net.ParseIP("100.64.0.3"), Status: &nbpeer.PeerStatus{LoginExpired: true}}
+	rules := []*FirewallRule{{PeerIP: "100.64.0.1"}, {PeerIP: "100.64.0.2"}, {PeerIP: "0.0.0.0"}}
+	records := []nbdns.SimpleRecord{{Name: "connected.netbird.cloud."}, {Name: "disconnected.netbird.cloud."}}
+
+	nm := &NetworkMap{
+		Peers:         []*nbpeer.Peer{connected, disconnected},
+		OfflinePeers:  []*nbpeer.Peer{expired},
+		FirewallRules: rules,
+		DNSConfig:     nbdns.Config{CustomZones: []nbdns.CustomZone{{Domain: "netbird.cloud.", Records: records}}},
+	}
+	nm.RemoveDisconnectedPeers()
+
+	assert.Equal(t, []*nbpeer.Peer{connected}, nm.Peers)
+	assert.Equal(t, []*nbpeer.Peer{expired}, nm.OfflinePeers, "offline peers with an expired login should be kept")
+	assert.Equal(t, []*FirewallRule{{PeerIP: "100.64.0.1"}, {PeerIP: "0.0.0.0"}}, nm.FirewallRules)
+	assert.Len(t, rules, 3, "the original rules should not be modified")
+	assert.Equal(t, records, nm.DNSConfig.CustomZones[0].Records, "DNS records should be kept")
+}
+
+func TestNetworkMap_SetAccessPaths(t *testing.T) {
+	self := &nbpeer.Peer{ID: "self", Key: "self-key"}
+	remote := &nbpeer.Peer{ID: "remote", Key: "remote-key"}
+	router := &nbpeer.Peer{ID: "router", Key: "router-key"}
+	exitNode := &nbpeer.Peer{ID: "exit-node", Key: "exit-node-key"}
+
+	nm := &NetworkMap{
+		Peers: []*nbpeer.Peer{remote, router, exitNode},
+		Routes: []*route.Route{
+			{ID: "office", Network: netip.MustParsePrefix("10.10.0.0/16"), Peer: router.Key},
+			{ID: "resource", Network: netip.MustParsePrefix("10.20.0.1/32"), Peer: router.Key, PeerID: router.ID},
+			{ID: "default", Network: netip.MustParsePrefix("0.0.0.0/0"), Peer: exitNode.Key},
+			{ID: "own", Network: netip.MustParsePrefix("10.30.0.0/16"), Peer: self.Key},
+		},
+	}
+	nm.SetAccessPaths(self)
+
+	assert.Equal(t, map[string]AccessPath{
+		"remote":    {Type: AccessPathDirect},
+		"router":    {Type: AccessPathDirect},
+		"exit-node": {Type: AccessPathDirect},
+		"office":    {Type: AccessPathRouted, ViaPeerID: "router"},
+		"resource":  {Type: AccessPathRouted, ViaPeerID: "router"},
+		"default":   {Type: AccessPathExitNode, ViaPeerID: "exit-node"},
+	}, nm.AccessPaths, "routes served by the peer itself should not have an access path")
+
+	proxyPeer := &nbpeer.Peer{ID: "proxy", Key: "proxy-key"}
+	nm.Merge(&NetworkMap{Peers: []*nbpeer.Peer{proxyPeer}})
+	assert.Equal(t, AccessPath{Type: AccessPathDirect}, nm.AccessPaths["proxy"], "merged peers should be reached directly")
+}
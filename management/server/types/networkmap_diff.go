@@ -0,0 +1,111 @@
+package types
+
+import (
+	"fmt"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/route"
+)
+
+// NetworkMapEntriesDiff holds the entries found in only one of the two compared network maps
+type NetworkMapEntriesDiff[T any] struct {
+	// OnlyA are the entries of the network map of the first peer missing in the network map of the second peer
+	OnlyA []T
+	// OnlyB are the entries of the network map of the second peer missing in the network map of the first peer
+	OnlyB []T
+}
+
+// Empty returns true if both network maps have the same entries
+func (d NetworkMapEntriesDiff[T]) Empty() bool {
+	return len(d.OnlyA) == 0 && len(d.OnlyB) == 0
+}
+
+// NetworkMapDiff is the difference between the network maps of two peers, e.g. to explain why one peer
+// reaches a resource the other one doesn't
+type NetworkMapDiff struct {
+	PeerAID string
+	PeerBID string
+
+	// Peers are the reachable peers. The two compared peers are left out
+	Peers NetworkMapEntriesDiff[*nbpeer.Peer]
+	// FirewallRules are compared on all their fields, rules towards the same remote peer with a different action
+	// or port show up on both sides
+	FirewallRules      NetworkMapEntriesDiff[*FirewallRule]
+	Routes             NetworkMapEntriesDiff[*route.Route]
+	RouteFirewallRules NetworkMapEntriesDiff[*RouteFirewallRule]
+	DNSRecords         NetworkMapEntriesDiff[nbdns.SimpleRecord]
+	NameServerGroups   NetworkMapEntriesDiff[*nbdns.NameServerGroup]
+}
+
+// DiffNetworkMaps compares the network map a of the peer peerAID with the network map b of the peer peerBID
+func DiffNetworkMaps(peerAID string, a *NetworkMap, peerBID string, b *NetworkMap) *NetworkMapDiff {
+	comparedPeer := func(p *nbpeer.Peer) bool {
+		return p.ID == peerAID || p.ID == peerBID
+	}
+
+	return &NetworkMapDiff{
+		PeerAID: peerAID,
+		PeerBID: peerBID,
+		Peers: diffNetworkMapEntries(filterPeers(a.Peers, comparedPeer), filterPeers(b.Peers, comparedPeer), func(p *nbpeer.Peer) string {
+			return p.ID
+		}),
+		FirewallRules: diffNetworkMapEntries(a.FirewallRules, b.FirewallRules, func(r *FirewallRule) string {
+			return fmt.Sprintf("%+v", *r)
+		}),
+		Routes: diffNetworkMapEntries(a.Routes, b.Routes, func(r *route.Route) string {
+			return string(r.ID)
+		}),
+		RouteFirewallRules: diffNetworkMapEntries(a.RoutesFirewallRules, b.RoutesFirewallRules, func(r *RouteFirewallRule) string {
+			return fmt.Sprintf("%+v", *r)
+		}),
+		DNSRecords: diffNetworkMapEntries(customZoneRecords(a.DNSConfig), customZoneRecords(b.DNSConfig), func(r nbdns.SimpleRecord) string {
+			return r.String()
+		}),
+		NameServerGroups: diffNetworkMapEntries(a.DNSConfig.NameServerGroups, b.DNSConfig.NameServerGroups, func(g *nbdns.NameServerGroup) string {
+			return g.ID
+		}),
+	}
+}
+
+func diffNetworkMapEntries[T any](a, b []T, key func(T) string) NetworkMapEntriesDiff[T] {
+	keysA := make(map[string]struct{}, len(a))
+	for _, entry := range a {
+		keysA[key(entry)] = struct{}{}
+	}
+	keysB := make(map[string]struct{}, len(b))
+	for _, entry := range b {
+		keysB[key(entry)] = struct{}{}
+	}
+
+	var diff NetworkMapEntriesDiff[T]
+	for _, entry := range a {
+		if _, ok := keysB[key(entry)]; !ok {
+			diff.OnlyA = append(diff.OnlyA, entry)
+		}
+	}
+	for _, entry := range b {
+		if _, ok := keysA[key(entry)]; !ok {
+			diff.OnlyB = append(diff.OnlyB, entry)
+		}
+	}
+	return diff
+}
+
+func filterPeers(peers []*nbpeer.Peer, exclude func(*nbpeer.Peer) bool) []*nbpeer.Peer {
+	filtered := make([]*nbpeer.Peer, 0, len(peers))
+	for _, p := range peers {
+		if !exclude(p) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+func customZoneRecords(config nbdns.Config) []nbdns.SimpleRecord {
+	var records []nbdns.SimpleRecord
+	for _, zone := range config.CustomZones {
+		records = append(records, zone.Records...)
+	}
+	return records
+}
@@ -1082,6 +1082,7 @@ func (b *NetworkMapBuilder) assembleNetworkMap(
 	var peersToConnect []*nbpeer.Peer
 	var expiredPeers []*nbpeer.Peer
 
+	expirationOverrides := account.GetPeerLoginExpirationOverrides()
 	for _, peerID := range aclView.ConnectedPeerIDs {
 		if _, ok := validatedPeers[peerID]; !ok {
 			continue
@@ -1092,7 +1093,7 @@ func (b *NetworkMapBuilder) assembleNetworkMap(
 			continue
 		}
 
-		expired, _ := peer.LoginExpired(account.Settings.PeerLoginExpiration)
+		expired, _ := peer.LoginExpired(account.Settings.GetPeerLoginExpiration(expirationOverrides, peerID), account.Settings.GetPeerExpirationTolerance())
 		if account.Settings.PeerLoginExpirationEnabled && expired {
 			expiredPeers = append(expiredPeers, peer)
 		} else {
@@ -1117,6 +1118,7 @@ func (b *NetworkMapBuilder) assembleNetworkMap(
 			log.Debugf("NetworkMapBuilder: peer %s assembling network map has no fwrule %s in globalRules", peer.ID, ruleID)
 		}
 	}
+	firewallRules = applyPeerFirewallOverrides(peer, firewallRules)
 
 	var routesFirewallRules []*RouteFirewallRule
 	for _, ruleID := range routesView.RouteFirewallRuleIDs {
@@ -1163,6 +1165,7 @@ func (b *NetworkMapBuilder) assembleNetworkMap(
 		nm.EnableSSH = sshView.EnableSSH
 		nm.AuthorizedUsers = sshView.AuthorizedUsers
 	}
+	nm.SetAccessPaths(peer)
 
 	return nm
 }
@@ -2,6 +2,7 @@ package types
 
 import (
 	"net"
+	"time"
 
 	nbpeer "github.com/netbirdio/netbird/management/server/peer"
 )
@@ -34,4 +35,87 @@ type PeerLogin struct {
 
 	// ExtraDNSLabels is a list of extra DNS labels that the peer wants to use
 	ExtraDNSLabels []string
+
+	// IdempotencyKey is an optional client generated key that makes a registration safe to retry.
+	// A repeated registration with the same key returns the originally registered peer.
+	IdempotencyKey string
+
+	// Attestation is an optional platform attestation (e.g. TPM quote or MDM token) verified on registration
+	Attestation []byte
+
+	// RequestedGroups is an optional list of group IDs the peer is added to on registration, in addition to the
+	// setup key or user auto groups
+	RequestedGroups []string
+}
+
+// PeerRoles describes the infrastructure roles a peer has in an account
+type PeerRoles struct {
+	// NetworkRouterIDs are the network routers the peer is directly assigned to
+	NetworkRouterIDs []string
+	// IngressPorts indicates that the peer is linked to ingress port allocations
+	IngressPorts bool
+	// ExitNodeRouteIDs are the enabled exit node routes served by the peer, directly or through its groups
+	ExitNodeRouteIDs []string
+}
+
+// IsNetworkRouter returns true if the peer routes traffic of a network
+func (r *PeerRoles) IsNetworkRouter() bool {
+	return len(r.NetworkRouterIDs) > 0
+}
+
+// IsExitNode returns true if the peer serves an exit node route
+func (r *PeerRoles) IsExitNode() bool {
+	return len(r.ExitNodeRouteIDs) > 0
+}
+
+// IngressPort is an ingress port configuration publishing a service through a peer
+type IngressPort struct {
+	ID   string
+	Name string
+	// Protocol is the transport protocol of the published ports, e.g. "tcp" or "udp"
+	Protocol string
+	// PortRange are the ports published on the ingress. Start and End are equal for a single port
+	PortRange RulePortRange
+}
+
+// PeerIngressPorts is a peer backing ingress port configurations
+type PeerIngressPorts struct {
+	Peer *nbpeer.Peer
+	// Ports are the ingress port configurations of the peer. Empty when the port controller can't describe them
+	Ports []*IngressPort
+}
+
+// EphemeralPeerCleanup describes an inactive ephemeral peer waiting to be removed by the ephemeral cleanup
+type EphemeralPeerCleanup struct {
+	Peer *nbpeer.Peer
+	// CleanupAt is the time after which the peer is deleted: its disconnection time plus the ephemeral lifetime
+	CleanupAt time.Time
+}
+
+// PeerCountHistoryBucket is the length of the periods the peer count history is grouped by
+type PeerCountHistoryBucket string
+
+const (
+	PeerCountHistoryBucketHour PeerCountHistoryBucket = "hour"
+	PeerCountHistoryBucketDay  PeerCountHistoryBucket = "day"
+)
+
+// Duration returns the length of the bucket, or zero if the bucket is not supported
+func (b PeerCountHistoryBucket) Duration() time.Duration {
+	switch b {
+	case PeerCountHistoryBucketHour:
+		return time.Hour
+	case PeerCountHistoryBucketDay:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// PeerCountDelta is the number of peers added to and removed from an account within a bucket of the peer count history
+type PeerCountDelta struct {
+	// Start is the beginning of the bucket (UTC)
+	Start   time.Time
+	Added   int
+	Removed int
 }
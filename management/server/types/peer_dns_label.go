@@ -0,0 +1,179 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+// PeerDNSLabelSuffix is the strategy used to build a unique DNS label for a peer whose hostname label is already taken
+type PeerDNSLabelSuffix string
+
+const (
+	// PeerDNSLabelSuffixOctets appends the last two octets of the peer IP, e.g. host-10-20. It is the default strategy
+	PeerDNSLabelSuffixOctets PeerDNSLabelSuffix = "octets"
+	// PeerDNSLabelSuffixHash appends a short hash of the peer IP, e.g. host-1a2b3c
+	PeerDNSLabelSuffixHash PeerDNSLabelSuffix = "hash"
+	// PeerDNSLabelSuffixCounter appends the lowest counter not used by another peer label, e.g. host-2
+	PeerDNSLabelSuffixCounter PeerDNSLabelSuffix = "counter"
+)
+
+// ReservedDNSLabelAction is what happens when the DNS label of a peer name is reserved in the account
+type ReservedDNSLabelAction string
+
+const (
+	// ReservedDNSLabelActionSuffix gives the peer a label built with the suffix strategy, as for a taken label.
+	// It is the default action
+	ReservedDNSLabelActionSuffix ReservedDNSLabelAction = "suffix"
+	// ReservedDNSLabelActionReject rejects adding or renaming the peer
+	ReservedDNSLabelActionReject ReservedDNSLabelAction = "reject"
+)
+
+const (
+	// MaxDNSLabelLength is the maximum length of a DNS label defined by RFC 1035
+	MaxDNSLabelLength = 63
+	// MinPeerDNSLabelMaxLength is the smallest max length an account can configure for peer DNS labels.
+	// It leaves room for the longest suffix and a few characters of the hostname
+	MinPeerDNSLabelMaxLength = 16
+	// MaxPeerExtraDNSLabels is the maximum number of extra DNS labels a peer can register, matching the number of
+	// domains accepted by domain.ValidateDomainsList
+	MaxPeerExtraDNSLabels = 32
+	// MaxReservedDNSLabels is the maximum number of DNS labels an account can reserve
+	MaxReservedDNSLabels = 100
+
+	peerDNSLabelHashLength  = 6
+	peerDNSLabelMaxCounter  = 99999
+	peerDNSLabelDefaultBase = "peer"
+)
+
+// ValidatePeerDNSLabelSuffix checks that the suffix strategy is supported. An empty strategy selects the default one
+func ValidatePeerDNSLabelSuffix(strategy PeerDNSLabelSuffix) error {
+	switch strategy {
+	case "", PeerDNSLabelSuffixOctets, PeerDNSLabelSuffixHash, PeerDNSLabelSuffixCounter:
+		return nil
+	default:
+		return fmt.Errorf("unsupported DNS label suffix strategy %q", strategy)
+	}
+}
+
+// ValidatePeerDNSLabelMaxLength checks that the max length leaves room for the suffix and fits a DNS label.
+// Zero selects MaxDNSLabelLength
+func ValidatePeerDNSLabelMaxLength(maxLength int) error {
+	if maxLength == 0 {
+		return nil
+	}
+	if maxLength < MinPeerDNSLabelMaxLength || maxLength > MaxDNSLabelLength {
+		return fmt.Errorf("DNS label max length must be between %d and %d", MinPeerDNSLabelMaxLength, MaxDNSLabelLength)
+	}
+	return nil
+}
+
+// ValidatePeerExtraDNSLabelsLimit checks that the limit of extra DNS labels per peer is within MaxPeerExtraDNSLabels.
+// Zero selects MaxPeerExtraDNSLabels
+func ValidatePeerExtraDNSLabelsLimit(limit int) error {
+	if limit < 0 || limit > MaxPeerExtraDNSLabels {
+		return fmt.Errorf("extra DNS labels limit must be between 0 and %d", MaxPeerExtraDNSLabels)
+	}
+	return nil
+}
+
+// ValidateReservedDNSLabelAction checks that the reserved DNS label action is supported. An empty action selects
+// the default one
+func ValidateReservedDNSLabelAction(action ReservedDNSLabelAction) error {
+	switch action {
+	case "", ReservedDNSLabelActionSuffix, ReservedDNSLabelActionReject:
+		return nil
+	default:
+		return fmt.Errorf("unsupported reserved DNS label action %q", action)
+	}
+}
+
+// ValidateReservedDNSLabels checks that the reserved labels are lowercase DNS labels, as the peer labels they are
+// compared with, and that there are at most MaxReservedDNSLabels of them
+func ValidateReservedDNSLabels(labels []string) error {
+	if len(labels) > MaxReservedDNSLabels {
+		return fmt.Errorf("too many reserved DNS labels: %d, at most %d are allowed", len(labels), MaxReservedDNSLabels)
+	}
+
+	for _, label := range labels {
+		if label == "" || len(label) > MaxDNSLabelLength {
+			return fmt.Errorf("invalid reserved DNS label %q", label)
+		}
+		parsed, err := nbdns.GetParsedDomainLabel(label)
+		if err != nil || parsed != label || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return fmt.Errorf("invalid reserved DNS label %q, it must be a lowercase DNS label", label)
+		}
+	}
+	return nil
+}
+
+// TruncatePeerDNSLabel shortens a parsed hostname label to maxLength, dropping trailing hyphens so the result stays
+// a valid DNS label. The truncation is deterministic, the same label always gives the same result
+func TruncatePeerDNSLabel(label string, maxLength int) string {
+	if len(label) > maxLength {
+		label = label[:maxLength]
+	}
+	label = strings.TrimRight(label, "-")
+	if label == "" {
+		return peerDNSLabelDefaultBase
+	}
+	return label
+}
+
+// BuildPeerDNSLabel returns the label "<hostname label>-<suffix>" of a peer with the given IP, truncating the hostname
+// label so the whole label fits maxLength. takenLabels returns the account labels starting with the given prefix;
+// it is only used by the counter strategy, the other strategies rely on the uniqueness of the peer IP
+func BuildPeerDNSLabel(label string, ip net.IP, strategy PeerDNSLabelSuffix, maxLength int, takenLabels func(prefix string) ([]string, error)) (string, error) {
+	if maxLength <= 0 || maxLength > MaxDNSLabelLength {
+		maxLength = MaxDNSLabelLength
+	}
+
+	switch strategy {
+	case PeerDNSLabelSuffixHash:
+		hash := sha256.Sum256([]byte(ip.String()))
+		return withPeerDNSLabelSuffix(label, hex.EncodeToString(hash[:])[:peerDNSLabelHashLength], maxLength), nil
+	case PeerDNSLabelSuffixCounter:
+		return buildPeerDNSLabelWithCounter(label, maxLength, takenLabels)
+	case "", PeerDNSLabelSuffixOctets:
+		ip4 := ip.To4()
+		if ip4 == nil {
+			return "", fmt.Errorf("invalid peer IP %s", ip)
+		}
+		return withPeerDNSLabelSuffix(label, fmt.Sprintf("%d-%d", ip4[2], ip4[3]), maxLength), nil
+	default:
+		return "", fmt.Errorf("unsupported DNS label suffix strategy %q", strategy)
+	}
+}
+
+func buildPeerDNSLabelWithCounter(label string, maxLength int, takenLabels func(prefix string) ([]string, error)) (string, error) {
+	// every candidate starts with the label truncated for the longest counter
+	prefix := TruncatePeerDNSLabel(label, maxLength-1-len(strconv.Itoa(peerDNSLabelMaxCounter)))
+
+	labels, err := takenLabels(prefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to get taken DNS labels: %w", err)
+	}
+
+	taken := make(map[string]struct{}, len(labels))
+	for _, l := range labels {
+		taken[l] = struct{}{}
+	}
+
+	for i := 2; i <= peerDNSLabelMaxCounter; i++ {
+		candidate := withPeerDNSLabelSuffix(label, strconv.Itoa(i), maxLength)
+		if _, ok := taken[candidate]; !ok {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("couldn't find a free DNS label for %s", label)
+}
+
+func withPeerDNSLabelSuffix(label, suffix string, maxLength int) string {
+	return TruncatePeerDNSLabel(label, maxLength-len(suffix)-1) + "-" + suffix
+}
@@ -0,0 +1,118 @@
+package types
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+)
+
+var validDNSLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+func TestBuildPeerDNSLabel_LongHostname(t *testing.T) {
+	hostname := strings.Repeat("a", 30) + "-" + strings.Repeat("b", 39)
+	require.Len(t, hostname, 70)
+
+	label, err := nbdns.GetParsedDomainLabel(hostname)
+	require.NoError(t, err)
+
+	ip := net.IP{100, 64, 10, 20}
+	noLabels := func(string) ([]string, error) { return nil, nil }
+
+	tests := []struct {
+		name      string
+		strategy  PeerDNSLabelSuffix
+		maxLength int
+		suffix    string
+	}{
+		{name: "default strategy", strategy: "", suffix: "-10-20"},
+		{name: "octets", strategy: PeerDNSLabelSuffixOctets, suffix: "-10-20"},
+		{name: "hash", strategy: PeerDNSLabelSuffixHash},
+		{name: "counter", strategy: PeerDNSLabelSuffixCounter, suffix: "-2"},
+		{name: "octets with custom max length", strategy: PeerDNSLabelSuffixOctets, maxLength: 32, suffix: "-10-20"},
+		{name: "counter with hyphen at the cut", strategy: PeerDNSLabelSuffixCounter, maxLength: 33, suffix: "-2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := BuildPeerDNSLabel(label, ip, tt.strategy, tt.maxLength, noLabels)
+			require.NoError(t, err)
+
+			maxLength := tt.maxLength
+			if maxLength == 0 {
+				maxLength = MaxDNSLabelLength
+			}
+			assert.LessOrEqual(t, len(result), maxLength)
+			assert.Regexp(t, validDNSLabel, result)
+			assert.True(t, strings.HasPrefix(result, "aaaa"))
+			assert.True(t, strings.HasSuffix(result, tt.suffix))
+
+			again, err := BuildPeerDNSLabel(label, ip, tt.strategy, tt.maxLength, noLabels)
+			require.NoError(t, err)
+			assert.Equal(t, result, again, "truncation must be deterministic")
+		})
+	}
+}
+
+func TestBuildPeerDNSLabel_Collisions(t *testing.T) {
+	label := strings.Repeat("x", 59)
+	first := net.IP{100, 64, 1, 2}
+	second := net.IP{100, 64, 3, 4}
+	noLabels := func(string) ([]string, error) { return nil, nil }
+
+	for _, strategy := range []PeerDNSLabelSuffix{PeerDNSLabelSuffixOctets, PeerDNSLabelSuffixHash} {
+		a, err := BuildPeerDNSLabel(label, first, strategy, 0, noLabels)
+		require.NoError(t, err)
+		b, err := BuildPeerDNSLabel(label, second, strategy, 0, noLabels)
+		require.NoError(t, err)
+		assert.NotEqual(t, a, b, "truncated labels of different peers must not collide with %s", strategy)
+	}
+
+	var requestedPrefix string
+	taken := func(prefix string) ([]string, error) {
+		requestedPrefix = prefix
+		return []string{label, label + "-2", label + "-3"}, nil
+	}
+
+	result, err := BuildPeerDNSLabel(label, first, PeerDNSLabelSuffixCounter, 0, taken)
+	require.NoError(t, err)
+	assert.Equal(t, label+"-4", result)
+	assert.True(t, strings.HasPrefix(result, requestedPrefix), "taken labels must be looked up by a prefix of the candidates")
+
+	_, err = BuildPeerDNSLabel(label, first, "random", 0, noLabels)
+	assert.Error(t, err)
+}
+
+func TestValidatePeerDNSLabelSettings(t *testing.T) {
+	assert.NoError(t, ValidatePeerDNSLabelSuffix(""))
+	assert.NoError(t, ValidatePeerDNSLabelSuffix(PeerDNSLabelSuffixHash))
+	assert.Error(t, ValidatePeerDNSLabelSuffix("random"))
+
+	assert.NoError(t, ValidatePeerDNSLabelMaxLength(0))
+	assert.NoError(t, ValidatePeerDNSLabelMaxLength(MinPeerDNSLabelMaxLength))
+	assert.NoError(t, ValidatePeerDNSLabelMaxLength(MaxDNSLabelLength))
+	assert.Error(t, ValidatePeerDNSLabelMaxLength(MinPeerDNSLabelMaxLength-1))
+	assert.Error(t, ValidatePeerDNSLabelMaxLength(MaxDNSLabelLength+1))
+
+	assert.NoError(t, ValidatePeerExtraDNSLabelsLimit(0))
+	assert.NoError(t, ValidatePeerExtraDNSLabelsLimit(MaxPeerExtraDNSLabels))
+	assert.Error(t, ValidatePeerExtraDNSLabelsLimit(-1))
+	assert.Error(t, ValidatePeerExtraDNSLabelsLimit(MaxPeerExtraDNSLabels+1))
+
+	assert.NoError(t, ValidateReservedDNSLabelAction(""))
+	assert.NoError(t, ValidateReservedDNSLabelAction(ReservedDNSLabelActionReject))
+	assert.Error(t, ValidateReservedDNSLabelAction("ignore"))
+
+	assert.NoError(t, ValidateReservedDNSLabels(nil))
+	assert.NoError(t, ValidateReservedDNSLabels([]string{"gateway", "dns", "ns-1"}))
+	assert.Error(t, ValidateReservedDNSLabels([]string{"Gateway"}))
+	assert.Error(t, ValidateReservedDNSLabels([]string{"gateway.internal"}))
+	assert.Error(t, ValidateReservedDNSLabels([]string{"-gateway"}))
+	assert.Error(t, ValidateReservedDNSLabels([]string{""}))
+	assert.Error(t, ValidateReservedDNSLabels(make([]string, MaxReservedDNSLabels+1)))
+}
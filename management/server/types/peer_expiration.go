@@ -0,0 +1,41 @@
+package types
+
+import (
+	"time"
+
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+)
+
+// PeerExpiration tells which expiration governs a peer
+type PeerExpiration int
+
+const (
+	// PeerExpirationNone means that neither the login nor the inactivity expiration applies to the peer
+	PeerExpirationNone PeerExpiration = iota
+	// PeerExpirationLogin means that the peer is governed by the login expiration
+	PeerExpirationLogin
+	// PeerExpirationInactivity means that the peer is governed by the inactivity expiration
+	PeerExpirationInactivity
+)
+
+// GetPeerExpiration returns the expiration that governs the peer, whether the peer expired by it and the time left
+// until it expires. When both the login and the inactivity expiration apply to the peer, the one that expires first
+// governs, the login expiration on a tie. The login and the inactivity expiration jobs both rely on it, so that a peer
+// is never handled by both of them.
+func (s *Settings) GetPeerExpiration(peer *nbpeer.Peer, loginExpirationOverrides map[string]time.Duration) (PeerExpiration, bool, time.Duration) {
+	loginApplies := s.PeerLoginExpirationEnabled && peer.AddedWithSSOLogin() && peer.LoginExpirationEnabled
+	inactivityApplies := s.PeerInactivityExpirationEnabled && peer.AddedWithSSOLogin() && peer.InactivityExpirationEnabled &&
+		!peer.Status.Connected
+
+	loginExpired, loginTimeLeft := peer.LoginExpired(s.GetPeerLoginExpiration(loginExpirationOverrides, peer.ID), s.GetPeerExpirationTolerance())
+	inactivityExpired, inactivityTimeLeft := peer.SessionExpired(s.PeerInactivityExpiration, s.GetPeerExpirationTolerance())
+
+	switch {
+	case loginApplies && (!inactivityApplies || loginTimeLeft <= inactivityTimeLeft):
+		return PeerExpirationLogin, loginExpired, loginTimeLeft
+	case inactivityApplies:
+		return PeerExpirationInactivity, inactivityExpired, inactivityTimeLeft
+	default:
+		return PeerExpirationNone, false, 0
+	}
+}
@@ -0,0 +1,46 @@
+package types
+
+// PeerExpirationDefaults are the login and inactivity expiration flags new peers are registered with
+type PeerExpirationDefaults struct {
+	LoginExpirationEnabled      bool
+	InactivityExpirationEnabled bool
+}
+
+// Enabled returns true if any of the expirations is enabled
+func (d *PeerExpirationDefaults) Enabled() bool {
+	return d != nil && (d.LoginExpirationEnabled || d.InactivityExpirationEnabled)
+}
+
+// Copy copies PeerExpirationDefaults to a new object
+func (d *PeerExpirationDefaults) Copy() *PeerExpirationDefaults {
+	if d == nil {
+		return nil
+	}
+	c := *d
+	return &c
+}
+
+// GetNewPeerExpiration returns the expiration flags of a new peer. Peers added with SSO login get the user peer
+// defaults of the account, both expirations enabled unless configured otherwise. Peers added with a setup key get the
+// override of the key or the setup key peer defaults of the account, both expirations disabled unless configured
+// otherwise. These peers can't re-authenticate with SSO, so their expiration is only enabled while the account
+// allows it with SetupKeyPeerExpirationAllowed.
+func (s *Settings) GetNewPeerExpiration(addedByUser bool, setupKey *SetupKey) PeerExpirationDefaults {
+	if addedByUser {
+		if s.UserPeerExpirationDefaults != nil {
+			return *s.UserPeerExpirationDefaults
+		}
+		return PeerExpirationDefaults{LoginExpirationEnabled: true, InactivityExpirationEnabled: true}
+	}
+
+	if !s.SetupKeyPeerExpirationAllowed {
+		return PeerExpirationDefaults{}
+	}
+	if setupKey != nil && setupKey.PeerExpirationDefaults != nil {
+		return *setupKey.PeerExpirationDefaults
+	}
+	if s.SetupKeyPeerExpirationDefaults != nil {
+		return *s.SetupKeyPeerExpirationDefaults
+	}
+	return PeerExpirationDefaults{}
+}
@@ -0,0 +1,64 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettings_GetNewPeerExpiration(t *testing.T) {
+	both := PeerExpirationDefaults{LoginExpirationEnabled: true, InactivityExpirationEnabled: true}
+	loginOnly := PeerExpirationDefaults{LoginExpirationEnabled: true}
+	keyOverride := &SetupKey{PeerExpirationDefaults: &PeerExpirationDefaults{InactivityExpirationEnabled: true}}
+
+	tests := []struct {
+		name        string
+		settings    *Settings
+		addedByUser bool
+		setupKey    *SetupKey
+		expected    PeerExpirationDefaults
+	}{
+		{
+			name:        "user peers expire by default",
+			settings:    &Settings{},
+			addedByUser: true,
+			expected:    both,
+		},
+		{
+			name:        "user peer defaults of the account",
+			settings:    &Settings{UserPeerExpirationDefaults: &PeerExpirationDefaults{}},
+			addedByUser: true,
+			expected:    PeerExpirationDefaults{},
+		},
+		{
+			name:     "setup key peers don't expire by default",
+			settings: &Settings{SetupKeyPeerExpirationAllowed: true},
+			setupKey: &SetupKey{},
+			expected: PeerExpirationDefaults{},
+		},
+		{
+			name:     "setup key peer defaults of the account",
+			settings: &Settings{SetupKeyPeerExpirationAllowed: true, SetupKeyPeerExpirationDefaults: &loginOnly},
+			setupKey: &SetupKey{},
+			expected: loginOnly,
+		},
+		{
+			name:     "setup key override",
+			settings: &Settings{SetupKeyPeerExpirationAllowed: true, SetupKeyPeerExpirationDefaults: &loginOnly},
+			setupKey: keyOverride,
+			expected: *keyOverride.PeerExpirationDefaults,
+		},
+		{
+			name:     "setup key peers don't expire unless allowed",
+			settings: &Settings{SetupKeyPeerExpirationDefaults: &both},
+			setupKey: keyOverride,
+			expected: PeerExpirationDefaults{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.settings.GetNewPeerExpiration(tt.addedByUser, tt.setupKey))
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+)
+
+func TestSettings_GetPeerExpiration(t *testing.T) {
+	settings := &Settings{
+		PeerLoginExpirationEnabled:      true,
+		PeerLoginExpiration:             24 * time.Hour,
+		PeerInactivityExpirationEnabled: true,
+		PeerInactivityExpiration:        time.Hour,
+	}
+
+	newPeer := func(lastLogin, lastSeen time.Duration, connected bool) *nbpeer.Peer {
+		login := time.Now().UTC().Add(-lastLogin)
+		return &nbpeer.Peer{
+			ID:                          "peer",
+			UserID:                      "user",
+			LoginExpirationEnabled:      true,
+			InactivityExpirationEnabled: true,
+			LastLogin:                   &login,
+			Status:                      &nbpeer.PeerStatus{Connected: connected, LastSeen: time.Now().UTC().Add(-lastSeen)},
+		}
+	}
+
+	tt := []struct {
+		name               string
+		settings           *Settings
+		peer               *nbpeer.Peer
+		expectedExpiration PeerExpiration
+		expectedExpired    bool
+	}{
+		{
+			name:               "connected peer is only subject to the login expiration",
+			settings:           settings,
+			peer:               newPeer(48*time.Hour, 0, true),
+			expectedExpiration: PeerExpirationLogin,
+			expectedExpired:    true,
+		},
+		{
+			name:               "disconnected peer with an earlier inactivity expiration",
+			settings:           settings,
+			peer:               newPeer(time.Hour, 2*time.Hour, false),
+			expectedExpiration: PeerExpirationInactivity,
+			expectedExpired:    true,
+		},
+		{
+			name:               "disconnected peer with an earlier login expiration",
+			settings:           settings,
+			peer:               newPeer(48*time.Hour, 2*time.Hour, false),
+			expectedExpiration: PeerExpirationLogin,
+			expectedExpired:    true,
+		},
+		{
+			name:               "disconnected peer eligible for both that didn't expire yet",
+			settings:           settings,
+			peer:               newPeer(time.Hour, 30*time.Minute, false),
+			expectedExpiration: PeerExpirationInactivity,
+			expectedExpired:    false,
+		},
+		{
+			name: "inactivity expiration disabled on the account",
+			settings: &Settings{
+				PeerLoginExpirationEnabled: true,
+				PeerLoginExpiration:        24 * time.Hour,
+				PeerInactivityExpiration:   time.Hour,
+			},
+			peer:               newPeer(time.Hour, 2*time.Hour, false),
+			expectedExpiration: PeerExpirationLogin,
+			expectedExpired:    false,
+		},
+		{
+			name:               "peer added with a setup key",
+			settings:           settings,
+			peer:               &nbpeer.Peer{ID: "peer", LoginExpirationEnabled: true, InactivityExpirationEnabled: true, Status: &nbpeer.PeerStatus{}},
+			expectedExpiration: PeerExpirationNone,
+			expectedExpired:    false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			expiration, expired, _ := tc.settings.GetPeerExpiration(tc.peer, nil)
+			assert.Equal(t, tc.expectedExpiration, expiration)
+			assert.Equal(t, tc.expectedExpired, expired)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package types
+
+import (
+	"time"
+
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+)
+
+// PeersExportVersion is the version of the PeersExport format
+const PeersExportVersion = 1
+
+// PeersExport is a serializable snapshot of the peers of an account used to migrate them to another account,
+// possibly on another management instance
+type PeersExport struct {
+	Version    int             `json:"version"`
+	AccountID  string          `json:"account_id"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Peers      []*ExportedPeer `json:"peers"`
+}
+
+// ExportedPeer is a peer without its keys, IP and attestation. Groups are referenced by name,
+// so they can be matched in the target account.
+type ExportedPeer struct {
+	ID                          string                    `json:"id"`
+	Name                        string                    `json:"name"`
+	Description                 string                    `json:"description"`
+	DNSLabel                    string                    `json:"dns_label"`
+	ExtraDNSLabels              []string                  `json:"extra_dns_labels"`
+	AllowExtraDNSLabels         bool                      `json:"allow_extra_dns_labels"`
+	UserID                      string                    `json:"user_id"`
+	Groups                      []string                  `json:"groups"`
+	Meta                        nbpeer.PeerSystemMeta     `json:"meta"`
+	SSHEnabled                  bool                      `json:"ssh_enabled"`
+	LoginExpirationEnabled      bool                      `json:"login_expiration_enabled"`
+	InactivityExpirationEnabled bool                      `json:"inactivity_expiration_enabled"`
+	FirewallOverrides           []nbpeer.FirewallOverride `json:"firewall_overrides"`
+	CreatedAt                   time.Time                 `json:"created_at"`
+}
@@ -0,0 +1,99 @@
+package types
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// PeerNamingTemplateVars holds the values available to an account peer naming template
+type PeerNamingTemplateVars struct {
+	// Hostname is the hostname reported by the peer
+	Hostname string
+	// OS is the operating system reported by the peer, e.g. linux or darwin
+	OS string
+	// User is the local part of the email of the user registering the peer. Empty for setup key registrations
+	User string
+}
+
+const peerNamingRandomBytes = 2
+
+// peerNamingTemplateVariables is the whitelist of variables supported by peer naming templates
+var peerNamingTemplateVariables = map[string]func(vars PeerNamingTemplateVars) (string, error){
+	"hostname": func(vars PeerNamingTemplateVars) (string, error) { return vars.Hostname, nil },
+	"os":       func(vars PeerNamingTemplateVars) (string, error) { return vars.OS, nil },
+	"user":     func(vars PeerNamingTemplateVars) (string, error) { return vars.User, nil },
+	"random": func(_ PeerNamingTemplateVars) (string, error) {
+		b := make([]byte, peerNamingRandomBytes)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(b), nil
+	},
+}
+
+// ValidatePeerNamingTemplate checks that the template is well-formed and uses only supported variables
+func ValidatePeerNamingTemplate(template string) error {
+	_, err := renderPeerNamingTemplate(template, func(name string) (string, error) {
+		if _, ok := peerNamingTemplateVariables[name]; !ok {
+			return "", fmt.Errorf("unknown variable {%s}", name)
+		}
+		return "", nil
+	})
+	return err
+}
+
+// RenderPeerNamingTemplate renders a peer naming template like "{os}-{user}-{random}".
+// Returns an error if the template is malformed, uses an unknown variable or renders to an empty name.
+func RenderPeerNamingTemplate(template string, vars PeerNamingTemplateVars) (string, error) {
+	name, err := renderPeerNamingTemplate(template, func(name string) (string, error) {
+		resolve, ok := peerNamingTemplateVariables[name]
+		if !ok {
+			return "", fmt.Errorf("unknown variable {%s}", name)
+		}
+		return resolve(vars)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	name = strings.Trim(name, "-_. ")
+	if name == "" {
+		return "", fmt.Errorf("template rendered an empty name")
+	}
+
+	return name, nil
+}
+
+func renderPeerNamingTemplate(template string, resolve func(name string) (string, error)) (string, error) {
+	var sb strings.Builder
+	rest := template
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open == -1 {
+			sb.WriteString(rest)
+			break
+		}
+		if rest[open] == '}' {
+			return "", fmt.Errorf("unexpected '}' in template")
+		}
+
+		sb.WriteString(rest[:open])
+		rest = rest[open+1:]
+
+		closing := strings.IndexAny(rest, "{}")
+		if closing == -1 || rest[closing] != '}' {
+			return "", fmt.Errorf("unterminated variable in template")
+		}
+
+		value, err := resolve(rest[:closing])
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(value)
+		rest = rest[closing+1:]
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,54 @@
+package types
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderPeerNamingTemplate(t *testing.T) {
+	vars := PeerNamingTemplateVars{Hostname: "laptop", OS: "linux", User: "alice"}
+	noUser := PeerNamingTemplateVars{Hostname: "laptop", OS: "linux"}
+
+	tests := []struct {
+		name     string
+		template string
+		vars     PeerNamingTemplateVars
+		expected string
+		wantErr  bool
+	}{
+		{name: "static text", template: "office", vars: vars, expected: "office"},
+		{name: "all variables", template: "{os}-{user}-{hostname}", vars: vars, expected: "linux-alice-laptop"},
+		{name: "unknown variable", template: "{os}-{group}", vars: vars, wantErr: true},
+		{name: "unterminated variable", template: "{os-{user}", vars: vars, wantErr: true},
+		{name: "unopened variable", template: "os}-{user}", vars: vars, wantErr: true},
+		{name: "empty user is trimmed", template: "{user}-{os}", vars: noUser, expected: "linux"},
+		{name: "renders empty name", template: "{user}", vars: noUser, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := RenderPeerNamingTemplate(tt.template, tt.vars)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, name)
+		})
+	}
+}
+
+func TestRenderPeerNamingTemplate_Random(t *testing.T) {
+	name, err := RenderPeerNamingTemplate("{os}-{random}", PeerNamingTemplateVars{OS: "darwin"})
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^darwin-[0-9a-f]{4}$`), name)
+}
+
+func TestValidatePeerNamingTemplate(t *testing.T) {
+	assert.NoError(t, ValidatePeerNamingTemplate("{os}-{user}-{random}"))
+	assert.Error(t, ValidatePeerNamingTemplate("{os}-{unknown}"))
+	assert.Error(t, ValidatePeerNamingTemplate("{os"))
+}
@@ -0,0 +1,179 @@
+package types
+
+import (
+	"context"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/netbirdio/netbird/management/server/posture"
+)
+
+// PeerPostureCheckSource is a posture check applying to a peer together with the policy rule that brought it in
+type PeerPostureCheckSource struct {
+	Checks     *posture.Checks
+	PolicyID   string
+	PolicyName string
+	// RuleID and RuleName identify the first enabled rule of the policy with the peer in its source groups
+	RuleID   string
+	RuleName string
+}
+
+// PeerAccessExplanation describes how the account policies apply to the traffic from a source peer to a destination peer
+type PeerAccessExplanation struct {
+	SourcePeerID      string
+	DestinationPeerID string
+	// SourcePeerValidated and DestinationPeerValidated are false when the peer is excluded from the network map,
+	// e.g. while waiting for approval, in which case no rule applies to it
+	SourcePeerValidated      bool
+	DestinationPeerValidated bool
+	// Allowed is true when at least one accept rule applies to the path
+	Allowed bool
+	// Rules are the enabled policy rules matching the source and destination peers, in the order of the policies
+	Rules []*PolicyRuleExplanation
+}
+
+// PolicyRuleExplanation describes a policy rule matching the source and destination peers
+type PolicyRuleExplanation struct {
+	PolicyID   string
+	PolicyName string
+	RuleID     string
+	RuleName   string
+	Action     PolicyTrafficActionType
+	Protocol   PolicyRuleProtocolType
+	Ports      []string
+	PortRanges []RulePortRange
+	// Reverse is set when the rule matches the destination peer as source, only for bidirectional rules
+	Reverse bool
+	// PostureChecks are the source posture checks of the policy evaluated on the source side of the rule
+	PostureChecks []*PostureCheckExplanation
+	// Applied is false when the rule matches the peers but is skipped, because a posture check failed
+	// or one of the peers isn't validated
+	Applied bool
+}
+
+// PostureCheckExplanation is the result of a policy posture check evaluated on a peer
+type PostureCheckExplanation struct {
+	ID     string
+	Name   string
+	PeerID string
+	Passed bool
+	// FailedChecks are the names of the checks the peer didn't pass
+	FailedChecks []string
+}
+
+// ExplainPeerAccess evaluates the account policies in the same way as GetPeerConnectionResources and returns the
+// rules matching the traffic from the source peer to the destination peer.
+func (a *Account) ExplainPeerAccess(ctx context.Context, srcPeerID, dstPeerID string, validatedPeersMap map[string]struct{}) *PeerAccessExplanation {
+	_, srcValidated := validatedPeersMap[srcPeerID]
+	_, dstValidated := validatedPeersMap[dstPeerID]
+
+	explanation := &PeerAccessExplanation{
+		SourcePeerID:             srcPeerID,
+		DestinationPeerID:        dstPeerID,
+		SourcePeerValidated:      srcValidated,
+		DestinationPeerValidated: dstValidated,
+		Rules:                    make([]*PolicyRuleExplanation, 0),
+	}
+
+	for _, policy := range a.Policies {
+		if !policy.Enabled {
+			continue
+		}
+
+		for _, rule := range policy.Rules {
+			if !rule.Enabled {
+				continue
+			}
+
+			ruleSrc, ruleDst := srcPeerID, dstPeerID
+			reverse := false
+			if !a.ruleMatchesPeers(ctx, rule, ruleSrc, ruleDst) {
+				if !rule.Bidirectional || !a.ruleMatchesPeers(ctx, rule, dstPeerID, srcPeerID) {
+					continue
+				}
+				ruleSrc, ruleDst = dstPeerID, srcPeerID
+				reverse = true
+			}
+
+			ruleExplanation := &PolicyRuleExplanation{
+				PolicyID:   policy.ID,
+				PolicyName: policy.Name,
+				RuleID:     rule.ID,
+				RuleName:   rule.Name,
+				Action:     rule.Action,
+				Protocol:   rule.Protocol,
+				Ports:      rule.Ports,
+				PortRanges: rule.PortRanges,
+				Reverse:    reverse,
+				Applied:    srcValidated && dstValidated,
+			}
+
+			// posture checks are applied only to the peers of the rule sources, a resource source isn't checked
+			if rule.SourceResource.Type != ResourceTypePeer || rule.SourceResource.ID == "" {
+				ruleExplanation.PostureChecks = a.explainPostureChecks(ctx, policy.SourcePostureChecks, ruleSrc)
+			}
+			for _, check := range ruleExplanation.PostureChecks {
+				if !check.Passed {
+					ruleExplanation.Applied = false
+				}
+			}
+
+			if ruleExplanation.Applied && rule.Action == PolicyTrafficActionAccept {
+				explanation.Allowed = true
+			}
+
+			explanation.Rules = append(explanation.Rules, ruleExplanation)
+		}
+	}
+
+	return explanation
+}
+
+// ruleMatchesPeers checks whether the rule sources contain the source peer and the rule destinations contain the destination peer
+func (a *Account) ruleMatchesPeers(ctx context.Context, rule *PolicyRule, srcPeerID, dstPeerID string) bool {
+	return a.ruleSideContainsPeer(ctx, rule.SourceResource, rule.Sources, srcPeerID) &&
+		a.ruleSideContainsPeer(ctx, rule.DestinationResource, rule.Destinations, dstPeerID)
+}
+
+func (a *Account) ruleSideContainsPeer(ctx context.Context, resource Resource, groups []string, peerID string) bool {
+	if resource.Type == ResourceTypePeer && resource.ID != "" {
+		return resource.ID == peerID
+	}
+	return slices.Contains(a.getUniquePeerIDsFromGroupsIDs(ctx, groups), peerID)
+}
+
+func (a *Account) explainPostureChecks(ctx context.Context, postureChecksIDs []string, peerID string) []*PostureCheckExplanation {
+	peer, ok := a.Peers[peerID]
+	if !ok || peer == nil {
+		return nil
+	}
+
+	explanations := make([]*PostureCheckExplanation, 0, len(postureChecksIDs))
+	for _, postureChecksID := range postureChecksIDs {
+		postureChecks := a.GetPostureChecks(postureChecksID)
+		if postureChecks == nil {
+			continue
+		}
+
+		explanation := &PostureCheckExplanation{
+			ID:     postureChecks.ID,
+			Name:   postureChecks.Name,
+			PeerID: peerID,
+			Passed: true,
+		}
+		for _, check := range postureChecks.GetChecks() {
+			isValid, err := check.Check(ctx, *peer)
+			if err != nil {
+				log.WithContext(ctx).Debugf("an error occurred check %s: on peer: %s :%s", check.Name(), peer.ID, err.Error())
+			}
+			if !isValid {
+				explanation.Passed = false
+				explanation.FailedChecks = append(explanation.FailedChecks, check.Name())
+			}
+		}
+		explanations = append(explanations, explanation)
+	}
+
+	return explanations
+}
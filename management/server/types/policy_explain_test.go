@@ -0,0 +1,95 @@
+package types
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/management/server/posture"
+)
+
+func TestAccount_ExplainPeerAccess(t *testing.T) {
+	account := getBasicAccountsWithResource()
+	account.Policies = append(account.Policies,
+		&Policy{
+			ID:                  "policy2ID",
+			Name:                "peers",
+			Enabled:             true,
+			SourcePostureChecks: []string{accNetResourceRestrictPostureCheckID},
+			Rules: []*PolicyRule{
+				{
+					ID:           "rule2ID",
+					Name:         "ssh",
+					Enabled:      true,
+					Sources:      []string{group1ID},
+					Destinations: []string{group1ID},
+					Protocol:     PolicyRuleProtocolTCP,
+					Ports:        []string{"22"},
+					Action:       PolicyTrafficActionAccept,
+				},
+			},
+		},
+		&Policy{
+			ID:      "policy3ID",
+			Name:    "router",
+			Enabled: true,
+			Rules: []*PolicyRule{
+				{
+					ID:                  "rule3ID",
+					Enabled:             true,
+					Bidirectional:       true,
+					SourceResource:      Resource{ID: accNetResourceRouter1ID, Type: ResourceTypePeer},
+					DestinationResource: Resource{ID: accNetResourcePeer2ID, Type: ResourceTypePeer},
+					Protocol:            PolicyRuleProtocolALL,
+					Action:              PolicyTrafficActionDrop,
+				},
+			},
+		},
+	)
+
+	validatedPeers := map[string]struct{}{
+		accNetResourcePeer1ID:   {},
+		accNetResourcePeer2ID:   {},
+		accNetResourceRouter1ID: {},
+	}
+
+	t.Run("source passing posture checks", func(t *testing.T) {
+		explanation := account.ExplainPeerAccess(context.Background(), accNetResourcePeer1ID, accNetResourcePeer2ID, validatedPeers)
+		assert.True(t, explanation.Allowed)
+		require.Len(t, explanation.Rules, 1)
+		assert.Equal(t, "rule2ID", explanation.Rules[0].RuleID)
+		assert.True(t, explanation.Rules[0].Applied)
+		require.Len(t, explanation.Rules[0].PostureChecks, 1)
+		assert.True(t, explanation.Rules[0].PostureChecks[0].Passed)
+	})
+
+	t.Run("source failing posture checks", func(t *testing.T) {
+		explanation := account.ExplainPeerAccess(context.Background(), accNetResourcePeer2ID, accNetResourcePeer1ID, validatedPeers)
+		assert.False(t, explanation.Allowed)
+		require.Len(t, explanation.Rules, 1)
+		assert.False(t, explanation.Rules[0].Applied)
+		require.Len(t, explanation.Rules[0].PostureChecks, 1)
+		assert.Equal(t, accNetResourcePeer2ID, explanation.Rules[0].PostureChecks[0].PeerID)
+		assert.Equal(t, []string{posture.NBVersionCheckName}, explanation.Rules[0].PostureChecks[0].FailedChecks)
+	})
+
+	t.Run("bidirectional rule matching in reverse", func(t *testing.T) {
+		explanation := account.ExplainPeerAccess(context.Background(), accNetResourcePeer2ID, accNetResourceRouter1ID, validatedPeers)
+		assert.False(t, explanation.Allowed)
+		require.Len(t, explanation.Rules, 1)
+		assert.Equal(t, "rule3ID", explanation.Rules[0].RuleID)
+		assert.True(t, explanation.Rules[0].Reverse)
+		assert.True(t, explanation.Rules[0].Applied)
+		assert.Equal(t, PolicyTrafficActionDrop, explanation.Rules[0].Action)
+	})
+
+	t.Run("peer not validated", func(t *testing.T) {
+		explanation := account.ExplainPeerAccess(context.Background(), accNetResourcePeer1ID, accNetResourcePeer2ID, map[string]struct{}{accNetResourcePeer1ID: {}})
+		assert.False(t, explanation.Allowed)
+		assert.False(t, explanation.DestinationPeerValidated)
+		require.Len(t, explanation.Rules, 1)
+		assert.False(t, explanation.Rules[0].Applied)
+	})
+}
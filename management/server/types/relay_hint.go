@@ -0,0 +1,42 @@
+package types
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// MaxRelayCountryMappings is the largest number of countries an account can map to a preferred relay
+const MaxRelayCountryMappings = 250
+
+// ValidateRelayCountryMapping checks that the mapping keys are ISO 3166-1 alpha-2 country codes, as stored in the
+// peer locations, and that the values are relay URLs
+func ValidateRelayCountryMapping(mapping map[string]string) error {
+	if len(mapping) > MaxRelayCountryMappings {
+		return fmt.Errorf("relay country mapping can't have more than %d countries", MaxRelayCountryMappings)
+	}
+
+	for countryCode, relayURL := range mapping {
+		if !isCountryCode(countryCode) {
+			return fmt.Errorf("invalid country code %q in the relay country mapping, expected two uppercase letters", countryCode)
+		}
+
+		u, err := url.Parse(relayURL)
+		if err != nil || (u.Scheme != "rel" && u.Scheme != "rels") || u.Host == "" {
+			return fmt.Errorf("invalid relay URL %q for country %s, expected rel://host:port or rels://host:port", relayURL, countryCode)
+		}
+	}
+
+	return nil
+}
+
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRelayCountryMapping(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i <= MaxRelayCountryMappings; i++ {
+		tooMany[string(rune('A'+i/26))+string(rune('A'+i%26))] = "rels://relay.example.com:443"
+	}
+
+	tests := []struct {
+		name    string
+		mapping map[string]string
+		wantErr bool
+	}{
+		{name: "empty mapping"},
+		{name: "valid mapping", mapping: map[string]string{"DE": "rels://relay-eu.example.com:443", "US": "rel://relay-us.example.com:80"}},
+		{name: "lowercase country code", mapping: map[string]string{"de": "rels://relay-eu.example.com:443"}, wantErr: true},
+		{name: "long country code", mapping: map[string]string{"DEU": "rels://relay-eu.example.com:443"}, wantErr: true},
+		{name: "non relay scheme", mapping: map[string]string{"DE": "https://relay-eu.example.com:443"}, wantErr: true},
+		{name: "missing host", mapping: map[string]string{"DE": "rels://"}, wantErr: true},
+		{name: "too many countries", mapping: tooMany, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRelayCountryMapping(tc.mapping)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSettings_GetPreferredRelay(t *testing.T) {
+	settings := &Settings{RelayCountryMapping: map[string]string{"DE": "rels://relay-eu.example.com:443"}}
+
+	assert.Equal(t, "rels://relay-eu.example.com:443", settings.GetPreferredRelay("DE"))
+	assert.Empty(t, settings.GetPreferredRelay("US"), "unmapped countries should get no hint")
+	assert.Empty(t, settings.GetPreferredRelay(""), "unknown locations should get no hint")
+	assert.Empty(t, (&Settings{}).GetPreferredRelay("DE"))
+}
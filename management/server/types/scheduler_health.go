@@ -0,0 +1,28 @@
+package types
+
+import "time"
+
+// SchedulerStuckThreshold is how long a scheduled job can be overdue before its scheduler is considered stuck
+const SchedulerStuckThreshold = 5 * time.Minute
+
+// ScheduledJobHealth describes the state of a scheduled background job
+type ScheduledJobHealth struct {
+	// NextRun is the time the job is scheduled to run next
+	NextRun time.Time
+	// LastRun is the time the job last completed, zero if it hasn't run yet
+	LastRun time.Time
+}
+
+// IsStuck reports whether the job is overdue for longer than SchedulerStuckThreshold without having run
+func (h ScheduledJobHealth) IsStuck(now time.Time) bool {
+	return now.Sub(h.NextRun) > SchedulerStuckThreshold && h.LastRun.Before(h.NextRun)
+}
+
+// AccountSchedulerHealth is the state of the peer expiration jobs scheduled for an account
+type AccountSchedulerHealth struct {
+	AccountID string
+	// LoginExpiration is the peer login expiration job, nil if it isn't scheduled
+	LoginExpiration *ScheduledJobHealth
+	// InactivityExpiration is the peer inactivity expiration job, nil if it isn't scheduled
+	InactivityExpiration *ScheduledJobHealth
+}
@@ -1,20 +1,64 @@
 package types
 
 import (
+	"fmt"
+	"maps"
 	"net/netip"
 	"slices"
 	"time"
+
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/management/server/posture"
+	"github.com/netbirdio/netbird/util/crypt"
+)
+
+// MaxPeerUpdateBufferInterval is the largest peer update buffer interval an account can configure
+const MaxPeerUpdateBufferInterval = time.Minute
+
+// MaxPeerDisconnectGracePeriod is the largest peer disconnect grace period an account can configure
+const MaxPeerDisconnectGracePeriod = 10 * time.Minute
+
+// BlockedPeerOwnerBehavior is how the peers added with SSO login are handled once their owner is blocked
+type BlockedPeerOwnerBehavior string
+
+const (
+	// BlockedPeerOwnerReject expires the peers when their owner is blocked and rejects their login and sync.
+	// It is the default behavior
+	BlockedPeerOwnerReject BlockedPeerOwnerBehavior = "reject"
+	// BlockedPeerOwnerQuarantine keeps the peers registered and connected with an empty network map
+	BlockedPeerOwnerQuarantine BlockedPeerOwnerBehavior = "quarantine"
+	// BlockedPeerOwnerAllowUntilExpiry keeps the peers working until their login expires, the login can't be renewed
+	BlockedPeerOwnerAllowUntilExpiry BlockedPeerOwnerBehavior = "allow-until-expiry"
 )
 
+// ValidateBlockedPeerOwnerBehavior checks that the behavior is supported. An empty behavior selects the default one
+func ValidateBlockedPeerOwnerBehavior(behavior BlockedPeerOwnerBehavior) error {
+	switch behavior {
+	case "", BlockedPeerOwnerReject, BlockedPeerOwnerQuarantine, BlockedPeerOwnerAllowUntilExpiry:
+		return nil
+	default:
+		return fmt.Errorf("unsupported blocked peer owner behavior %q", behavior)
+	}
+}
+
 // Settings represents Account settings structure that can be modified via API and Dashboard
 type Settings struct {
 	// PeerLoginExpirationEnabled globally enables or disables peer login expiration
 	PeerLoginExpirationEnabled bool
 
 	// PeerLoginExpiration is a setting that indicates when peer login expires.
-	// Applies to all peers that have Peer.LoginExpirationEnabled set to true.
+	// Applies to all peers that have Peer.LoginExpirationEnabled set to true,
+	// unless one of the peer's groups overrides it with Group.PeerLoginExpiration.
 	PeerLoginExpiration time.Duration
 
+	// PeerLoginExpirationLeadTime is how long before the login expiration the peers are asked to re-authenticate.
+	// When zero, the peers are not asked to re-authenticate before their login expires
+	PeerLoginExpirationLeadTime time.Duration
+
+	// PeerExpirationTolerance is the grace period added to the login and inactivity expiration of the peers, so a peer
+	// isn't expired early because of a small clock drift between management servers. Zero means the default tolerance
+	PeerExpirationTolerance time.Duration
+
 	// PeerInactivityExpirationEnabled globally enables or disables peer inactivity expiration
 	PeerInactivityExpirationEnabled bool
 
@@ -55,6 +99,199 @@ type Settings struct {
 
 	// AutoUpdateVersion client auto-update version
 	AutoUpdateVersion string `gorm:"default:'disabled'"`
+
+	// PeerNamingTemplate is an optional template like "{os}-{user}-{random}" used to name newly registered peers.
+	// When empty, peers are named after their hostname.
+	PeerNamingTemplate string
+
+	// PeerWebhookURL is an optional HTTP endpoint notified when peers are added or deleted
+	PeerWebhookURL string
+
+	// PeerWebhookSecret is the key used to sign the payloads sent to PeerWebhookURL. It is encrypted at rest
+	PeerWebhookSecret string
+
+	// PeerUpdateBufferInterval is the window used to coalesce the network map updates of the account peers.
+	// When zero, the global interval is used
+	PeerUpdateBufferInterval time.Duration
+
+	// PeerDNSLabelSuffix is the strategy used to build a unique DNS label for a peer whose hostname label is taken.
+	// When empty, the last two octets of the peer IP are used
+	PeerDNSLabelSuffix PeerDNSLabelSuffix
+
+	// PeerDNSLabelMaxLength is the maximum length of the peer DNS labels. When zero, MaxDNSLabelLength is used
+	PeerDNSLabelMaxLength int
+
+	// PeerExtraDNSLabelsLimit is the maximum number of extra DNS labels a peer can register. When zero,
+	// MaxPeerExtraDNSLabels is used
+	PeerExtraDNSLabelsLimit int
+
+	// PeerUsageCap is the maximum number of bytes a peer may transfer within PeerUsageCapWindow before it is marked
+	// for quarantine. When zero, the usage of the peers is not capped
+	PeerUsageCap int64
+
+	// PeerUsageCapWindow is the time window over which the usage of a peer is compared against PeerUsageCap
+	PeerUsageCapWindow time.Duration
+
+	// ExcludeEphemeralPeersFromLimits excludes the ephemeral peers from the peer counts used for billing and limits,
+	// e.g. for short-lived CI runners. The ephemeral peers are still tracked and can be counted explicitly
+	ExcludeEphemeralPeersFromLimits bool `gorm:"default:false"`
+
+	// PeerLimit is the maximum number of peers the account can register. With ExcludeEphemeralPeersFromLimits set,
+	// the ephemeral peers are neither counted nor rejected. When zero, the number of peers is not limited
+	PeerLimit int
+
+	// PeerRegistrationOSVersionCheck holds the minimum OS versions per platform a peer must run to be registered.
+	// Unlike the posture checks, it is enforced once when the peer is added and platforms without a minimum
+	// version are allowed. When nil, the OS version is not checked at registration
+	PeerRegistrationOSVersionCheck *posture.OSVersionCheck `gorm:"serializer:json"`
+
+	// NetworkMapConnectedPeersOnly limits the network maps to the peers connected to management, reducing their size
+	// in large, mostly idle accounts. See NetworkMap.RemoveDisconnectedPeers for how offline peers are handled
+	NetworkMapConnectedPeersOnly bool `gorm:"default:false"`
+
+	// BlockedPeerOwnerBehavior is how the peers added with SSO login are handled once their owner is blocked.
+	// When empty, BlockedPeerOwnerReject is used
+	BlockedPeerOwnerBehavior BlockedPeerOwnerBehavior
+
+	// ReservedDNSLabels are the DNS labels that can't be given to peers, e.g. the labels meant for infrastructure.
+	// Peers already holding one of them keep it
+	ReservedDNSLabels []string `gorm:"serializer:json"`
+
+	// ReservedDNSLabelAction is what happens when a peer is added or renamed with a reserved DNS label.
+	// When empty, ReservedDNSLabelActionSuffix is used
+	ReservedDNSLabelAction ReservedDNSLabelAction
+
+	// RegistrationFrozen rejects the registration of new peers, e.g. during an incident with compromised setup keys.
+	// The peers already registered keep logging in and syncing
+	RegistrationFrozen bool `gorm:"default:false"`
+
+	// RelayCountryMapping maps the country codes of the peer locations to the relay URL the peers of the country
+	// should prefer. Peers with an unknown or unmapped location get no hint and pick the relay on their own
+	RelayCountryMapping map[string]string `gorm:"serializer:json"`
+
+	// PeerDisconnectGracePeriod is how long a peer has to stay disconnected before it is marked as disconnected.
+	// A peer reconnecting within the period keeps its connected status, collapsing the flaps of unstable
+	// connections. When zero, the peers are marked as disconnected right away
+	PeerDisconnectGracePeriod time.Duration
+
+	// UserPeerExpirationDefaults are the expiration flags of the new peers added with SSO login.
+	// When nil, both expirations are enabled
+	UserPeerExpirationDefaults *PeerExpirationDefaults `gorm:"serializer:json"`
+
+	// SetupKeyPeerExpirationDefaults are the expiration flags of the new peers added with a setup key, unless the key
+	// overrides them. When nil, both expirations are disabled
+	SetupKeyPeerExpirationDefaults *PeerExpirationDefaults `gorm:"serializer:json"`
+
+	// SetupKeyPeerExpirationAllowed allows registering the peers added with a setup key with their expiration
+	// enabled. It has to be set explicitly as these peers can't re-authenticate with SSO once expired. Note that the
+	// login and inactivity expiration jobs still only expire the peers added with SSO login
+	SetupKeyPeerExpirationAllowed bool `gorm:"default:false"`
+
+	// SignificantPeerMetaFields lists the peer meta fields (e.g. "hostname", "system_product_name")
+	// whose changes trigger an update of the account peers. Changes of the other fields are only stored. When empty,
+	// every system meta field is significant. The fields used by posture checks are always significant
+	SignificantPeerMetaFields []string `gorm:"serializer:json"`
+}
+
+// GetBlockedPeerOwnerBehavior returns how the peers of blocked owners are handled in the account
+func (s *Settings) GetBlockedPeerOwnerBehavior() BlockedPeerOwnerBehavior {
+	if s.BlockedPeerOwnerBehavior == "" {
+		return BlockedPeerOwnerReject
+	}
+	return s.BlockedPeerOwnerBehavior
+}
+
+// IsReservedDNSLabel returns true if the peer DNS label is reserved in the account
+func (s *Settings) IsReservedDNSLabel(label string) bool {
+	return slices.Contains(s.ReservedDNSLabels, label)
+}
+
+// GetReservedDNSLabelAction returns what happens when a peer gets a reserved DNS label in the account
+func (s *Settings) GetReservedDNSLabelAction() ReservedDNSLabelAction {
+	if s.ReservedDNSLabelAction == "" {
+		return ReservedDNSLabelActionSuffix
+	}
+	return s.ReservedDNSLabelAction
+}
+
+// GetPreferredRelay returns the relay URL hinted to the peers located in the country, or an empty string when
+// the country is unknown or not mapped
+func (s *Settings) GetPreferredRelay(countryCode string) string {
+	if countryCode == "" {
+		return ""
+	}
+	return s.RelayCountryMapping[countryCode]
+}
+
+// GetPeerDNSLabelMaxLength returns the maximum length of the peer DNS labels of the account
+func (s *Settings) GetPeerDNSLabelMaxLength() int {
+	if s.PeerDNSLabelMaxLength <= 0 {
+		return MaxDNSLabelLength
+	}
+	return s.PeerDNSLabelMaxLength
+}
+
+// GetPeerExtraDNSLabelsLimit returns the maximum number of extra DNS labels a peer of the account can register
+func (s *Settings) GetPeerExtraDNSLabelsLimit() int {
+	if s.PeerExtraDNSLabelsLimit <= 0 {
+		return MaxPeerExtraDNSLabels
+	}
+	return s.PeerExtraDNSLabelsLimit
+}
+
+// GetPeerExpirationTolerance returns the grace period added to the peer expirations, nbpeer.DefaultExpirationTolerance
+// when not set
+func (s *Settings) GetPeerExpirationTolerance() time.Duration {
+	if s.PeerExpirationTolerance <= 0 {
+		return nbpeer.DefaultExpirationTolerance
+	}
+	return min(s.PeerExpirationTolerance, nbpeer.MaxExpirationTolerance)
+}
+
+// GetPeerLoginExpiration returns the login expiration of the peer given the group overrides built by
+// PeerLoginExpirationOverrides, see ApplyPeerLoginExpirationOverride.
+func (s *Settings) GetPeerLoginExpiration(overrides map[string]time.Duration, peerID string) time.Duration {
+	return s.ApplyPeerLoginExpirationOverride(overrides[peerID])
+}
+
+// ApplyPeerLoginExpirationOverride returns the login expiration of a peer whose groups override it with the given
+// expiration. A group override can only shorten the account setting, so that group admins can't keep peers
+// logged in past the account policy. Zero means no override.
+func (s *Settings) ApplyPeerLoginExpirationOverride(override time.Duration) time.Duration {
+	if override > 0 && override < s.PeerLoginExpiration {
+		return override
+	}
+	return s.PeerLoginExpiration
+}
+
+// EncryptSensitiveData encrypts the settings' sensitive fields (PeerWebhookSecret) in place.
+func (s *Settings) EncryptSensitiveData(enc *crypt.FieldEncrypt) error {
+	if enc == nil || s.PeerWebhookSecret == "" {
+		return nil
+	}
+
+	var err error
+	s.PeerWebhookSecret, err = enc.Encrypt(s.PeerWebhookSecret)
+	if err != nil {
+		return fmt.Errorf("encrypt peer webhook secret: %w", err)
+	}
+
+	return nil
+}
+
+// DecryptSensitiveData decrypts the settings' sensitive fields (PeerWebhookSecret) in place.
+func (s *Settings) DecryptSensitiveData(enc *crypt.FieldEncrypt) error {
+	if enc == nil || s.PeerWebhookSecret == "" {
+		return nil
+	}
+
+	var err error
+	s.PeerWebhookSecret, err = enc.Decrypt(s.PeerWebhookSecret)
+	if err != nil {
+		return fmt.Errorf("decrypt peer webhook secret: %w", err)
+	}
+
+	return nil
 }
 
 // Copy copies the Settings struct
@@ -62,11 +299,15 @@ func (s *Settings) Copy() *Settings {
 	settings := &Settings{
 		PeerLoginExpirationEnabled: s.PeerLoginExpirationEnabled,
 		PeerLoginExpiration:        s.PeerLoginExpiration,
-		JWTGroupsEnabled:           s.JWTGroupsEnabled,
-		JWTGroupsClaimName:         s.JWTGroupsClaimName,
-		GroupsPropagationEnabled:   s.GroupsPropagationEnabled,
-		JWTAllowGroups:             s.JWTAllowGroups,
-		RegularUsersViewBlocked:    s.RegularUsersViewBlocked,
+
+		PeerLoginExpirationLeadTime: s.PeerLoginExpirationLeadTime,
+		PeerExpirationTolerance:     s.PeerExpirationTolerance,
+
+		JWTGroupsEnabled:         s.JWTGroupsEnabled,
+		JWTGroupsClaimName:       s.JWTGroupsClaimName,
+		GroupsPropagationEnabled: s.GroupsPropagationEnabled,
+		JWTAllowGroups:           s.JWTAllowGroups,
+		RegularUsersViewBlocked:  s.RegularUsersViewBlocked,
 
 		PeerInactivityExpirationEnabled: s.PeerInactivityExpirationEnabled,
 		PeerInactivityExpiration:        s.PeerInactivityExpiration,
@@ -76,10 +317,35 @@ func (s *Settings) Copy() *Settings {
 		DNSDomain:                       s.DNSDomain,
 		NetworkRange:                    s.NetworkRange,
 		AutoUpdateVersion:               s.AutoUpdateVersion,
+		PeerNamingTemplate:              s.PeerNamingTemplate,
+		PeerWebhookURL:                  s.PeerWebhookURL,
+		PeerWebhookSecret:               s.PeerWebhookSecret,
+		PeerUpdateBufferInterval:        s.PeerUpdateBufferInterval,
+		PeerDNSLabelSuffix:              s.PeerDNSLabelSuffix,
+		PeerDNSLabelMaxLength:           s.PeerDNSLabelMaxLength,
+		PeerExtraDNSLabelsLimit:         s.PeerExtraDNSLabelsLimit,
+		PeerUsageCap:                    s.PeerUsageCap,
+		PeerUsageCapWindow:              s.PeerUsageCapWindow,
+		ExcludeEphemeralPeersFromLimits: s.ExcludeEphemeralPeersFromLimits,
+		PeerLimit:                       s.PeerLimit,
+		NetworkMapConnectedPeersOnly:    s.NetworkMapConnectedPeersOnly,
+		BlockedPeerOwnerBehavior:        s.BlockedPeerOwnerBehavior,
+		ReservedDNSLabels:               slices.Clone(s.ReservedDNSLabels),
+		ReservedDNSLabelAction:          s.ReservedDNSLabelAction,
+		RegistrationFrozen:              s.RegistrationFrozen,
+		RelayCountryMapping:             maps.Clone(s.RelayCountryMapping),
+		PeerDisconnectGracePeriod:       s.PeerDisconnectGracePeriod,
+		UserPeerExpirationDefaults:      s.UserPeerExpirationDefaults.Copy(),
+		SetupKeyPeerExpirationDefaults:  s.SetupKeyPeerExpirationDefaults.Copy(),
+		SetupKeyPeerExpirationAllowed:   s.SetupKeyPeerExpirationAllowed,
+		SignificantPeerMetaFields:       slices.Clone(s.SignificantPeerMetaFields),
 	}
 	if s.Extra != nil {
 		settings.Extra = s.Extra.Copy()
 	}
+	if s.PeerRegistrationOSVersionCheck != nil {
+		settings.PeerRegistrationOSVersionCheck = s.PeerRegistrationOSVersionCheck.Copy()
+	}
 	return settings
 }
 
@@ -3,6 +3,7 @@ package types
 import (
 	"crypto/sha256"
 	b64 "encoding/base64"
+	"slices"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -56,6 +57,19 @@ type SetupKey struct {
 	Ephemeral bool
 	// AllowExtraDNSLabels indicates if the key allows extra DNS labels
 	AllowExtraDNSLabels bool
+	// RequiresApproval indicates that peers registered with this key are pending approval until an admin approves them
+	RequiresApproval bool
+	// AllowOutdatedOSVersion exempts peers registered with this key from the account minimum OS versions, e.g. for lab machines
+	AllowOutdatedOSVersion bool
+	// ManagedPeers marks peers registered with this key as managed by setup key only. Their settings can't be edited
+	// individually and only change through the key and group mechanisms
+	ManagedPeers bool
+	// PeerExpirationDefaults overrides the expiration flags of the account setup key peer defaults for the peers registered
+	// with this key. Only applied while the account allows the expiration of setup key peers
+	PeerExpirationDefaults *PeerExpirationDefaults `gorm:"serializer:json"`
+	// RequestableGroups is a list of Group IDs a Peer registering with this key may request in addition to the
+	// AutoGroups. Requests for other groups are rejected
+	RequestableGroups []string `gorm:"serializer:json"`
 }
 
 // Copy copies SetupKey to a new object
@@ -66,22 +80,27 @@ func (key *SetupKey) Copy() *SetupKey {
 		key.UpdatedAt = key.CreatedAt
 	}
 	return &SetupKey{
-		Id:                  key.Id,
-		AccountID:           key.AccountID,
-		Key:                 key.Key,
-		KeySecret:           key.KeySecret,
-		Name:                key.Name,
-		Type:                key.Type,
-		CreatedAt:           key.CreatedAt,
-		ExpiresAt:           key.ExpiresAt,
-		UpdatedAt:           key.UpdatedAt,
-		Revoked:             key.Revoked,
-		UsedTimes:           key.UsedTimes,
-		LastUsed:            key.LastUsed,
-		AutoGroups:          autoGroups,
-		UsageLimit:          key.UsageLimit,
-		Ephemeral:           key.Ephemeral,
-		AllowExtraDNSLabels: key.AllowExtraDNSLabels,
+		Id:                     key.Id,
+		AccountID:              key.AccountID,
+		Key:                    key.Key,
+		KeySecret:              key.KeySecret,
+		Name:                   key.Name,
+		Type:                   key.Type,
+		CreatedAt:              key.CreatedAt,
+		ExpiresAt:              key.ExpiresAt,
+		UpdatedAt:              key.UpdatedAt,
+		Revoked:                key.Revoked,
+		UsedTimes:              key.UsedTimes,
+		LastUsed:               key.LastUsed,
+		AutoGroups:             autoGroups,
+		UsageLimit:             key.UsageLimit,
+		Ephemeral:              key.Ephemeral,
+		AllowExtraDNSLabels:    key.AllowExtraDNSLabels,
+		RequiresApproval:       key.RequiresApproval,
+		AllowOutdatedOSVersion: key.AllowOutdatedOSVersion,
+		ManagedPeers:           key.ManagedPeers,
+		PeerExpirationDefaults: key.PeerExpirationDefaults.Copy(),
+		RequestableGroups:      slices.Clone(key.RequestableGroups),
 	}
 }
 
@@ -124,6 +143,19 @@ func (key *SetupKey) IncrementUsage() *SetupKey {
 	return c
 }
 
+// RemainingUses returns the number of registrations the key can still be used for.
+// SetupKeyUnlimitedUsage is returned for keys with unlimited usage.
+func (key *SetupKey) RemainingUses() int {
+	limit := key.UsageLimit
+	if key.Type == SetupKeyOneOff {
+		limit = 1
+	}
+	if limit == SetupKeyUnlimitedUsage {
+		return SetupKeyUnlimitedUsage
+	}
+	return max(limit-key.UsedTimes, 0)
+}
+
 // IsValid is true if the key was not revoked, is not expired and used not more than it was supposed to
 func (key *SetupKey) IsValid() bool {
 	return !key.IsRevoked() && !key.IsExpired() && !key.IsOverUsed()
@@ -151,6 +183,41 @@ func (key *SetupKey) IsOverUsed() bool {
 	return limit > 0 && key.UsedTimes >= limit
 }
 
+// HashSetupKey returns the hash of the plain setup key as it is stored in the SetupKey.Key field
+func HashSetupKey(plainKey string) string {
+	hashedKey := sha256.Sum256([]byte(strings.ToUpper(plainKey)))
+	return b64.StdEncoding.EncodeToString(hashedKey[:])
+}
+
+// SetupKeyValidation is the result of a setup key check that doesn't consume the key.
+// Details are only set for valid keys, so an unknown key can't be told apart from an invalid one.
+type SetupKeyValidation struct {
+	Valid bool
+	// RemainingUses is the number of registrations the key can still be used for, SetupKeyUnlimitedUsage if unlimited
+	RemainingUses int
+	// ExpiresAt is the expiration time of the key, nil if the key doesn't expire
+	ExpiresAt           *time.Time
+	AllowExtraDNSLabels bool
+}
+
+// SetupKeyOptions are the optional properties of a new setup key
+type SetupKeyOptions struct {
+	// Ephemeral makes the peers registered with the key ephemeral
+	Ephemeral bool
+	// AllowExtraDNSLabels allows the peers registered with the key to add extra DNS labels
+	AllowExtraDNSLabels bool
+	// RequiresApproval makes the peers registered with the key wait for a manual approval
+	RequiresApproval bool
+	// AllowOutdatedOSVersion exempts the peers registered with the key from the account minimum OS versions
+	AllowOutdatedOSVersion bool
+	// ManagedPeers makes the peers registered with the key manageable by the setup key only
+	ManagedPeers bool
+	// PeerExpiration overrides the expiration flags of the peers registered with the key, nil uses the account defaults
+	PeerExpiration *PeerExpirationDefaults
+	// RequestableGroups are the groups the peers registered with the key may request in addition to the auto groups
+	RequestableGroups []string
+}
+
 // GenerateSetupKey generates a new setup key
 func GenerateSetupKey(name string, t SetupKeyType, validFor time.Duration, autoGroups []string,
 	usageLimit int, ephemeral bool, allowExtraDNSLabels bool) (*SetupKey, string) {
@@ -165,12 +232,9 @@ func GenerateSetupKey(name string, t SetupKeyType, validFor time.Duration, autoG
 		expiresAt = util.ToPtr(time.Now().UTC().Add(validFor))
 	}
 
-	hashedKey := sha256.Sum256([]byte(key))
-	encodedHashedKey := b64.StdEncoding.EncodeToString(hashedKey[:])
-
 	return &SetupKey{
 		Id:                  xid.New().String(),
-		Key:                 encodedHashedKey,
+		Key:                 HashSetupKey(key),
 		KeySecret:           HiddenKey(key, 4),
 		Name:                name,
 		Type:                t,
@@ -2,6 +2,7 @@ package types
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -104,6 +105,9 @@ type User struct {
 
 	Name  string `gorm:"default:''"`
 	Email string `gorm:"default:''"`
+
+	// PinnedPeers is a list of peer IDs the user pinned to the top of their peer listings
+	PinnedPeers []string `gorm:"serializer:json"`
 }
 
 // IsBlocked returns true if the user is blocked, false otherwise
@@ -221,6 +225,7 @@ func (u *User) Copy() *User {
 		IntegrationReference: u.IntegrationReference,
 		Email:                u.Email,
 		Name:                 u.Name,
+		PinnedPeers:          slices.Clone(u.PinnedPeers),
 	}
 }
 
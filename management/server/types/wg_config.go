@@ -0,0 +1,89 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/route"
+)
+
+// redactedWGPrivateKey replaces the private key in the debug configs, the key never leaves the peer
+const redactedWGPrivateKey = "<redacted, held by the peer only>"
+
+// DebugWGConfig renders the WireGuard configuration of the peer in the wg-quick format as the server sees it in the
+// network map, to be compared with the configuration applied by the client. Endpoints are negotiated by the peers,
+// so only the public address a peer last connected to management from is added as a comment. The routes are added
+// to the allowed IPs of their routing peer, the client applies the ones of the routing peer it picked.
+func DebugWGConfig(peer *nbpeer.Peer, networkMap *NetworkMap, dnsDomain string) string {
+	var b strings.Builder
+
+	ones, _ := networkMap.Network.Net.Mask.Size()
+
+	b.WriteString("[Interface]\n")
+	fmt.Fprintf(&b, "# Peer: %s (%s)\n", peer.Name, peer.ID)
+	fmt.Fprintf(&b, "PrivateKey = %s\n", redactedWGPrivateKey)
+	fmt.Fprintf(&b, "# PublicKey = %s\n", peer.Key)
+	fmt.Fprintf(&b, "Address = %s/%d\n", peer.IP, ones)
+	writeDebugWGDNS(&b, networkMap, dnsDomain)
+
+	routesByPeerKey := make(map[string][]*route.Route)
+	for _, r := range networkMap.Routes {
+		if r.Peer == peer.Key {
+			continue
+		}
+		routesByPeerKey[r.Peer] = append(routesByPeerKey[r.Peer], r)
+	}
+
+	for _, remotePeer := range networkMap.Peers {
+		b.WriteString("\n[Peer]\n")
+		fmt.Fprintf(&b, "# Name: %s (%s), FQDN: %s\n", remotePeer.Name, remotePeer.ID, remotePeer.FQDN(dnsDomain))
+		if remotePeer.Location.ConnectionIP != nil {
+			fmt.Fprintf(&b, "# Endpoint: negotiated by the peers, last connected from %s\n", remotePeer.Location.ConnectionIP)
+		} else {
+			b.WriteString("# Endpoint: negotiated by the peers\n")
+		}
+		fmt.Fprintf(&b, "PublicKey = %s\n", remotePeer.Key)
+
+		allowedIPs := []string{remotePeer.IP.String() + "/32"}
+		for _, r := range routesByPeerKey[remotePeer.Key] {
+			if r.IsDynamic() {
+				fmt.Fprintf(&b, "# Route %s: resolved by the client for %s\n", r.NetID, r.Domains.SafeString())
+				continue
+			}
+			allowedIPs = append(allowedIPs, r.Network.String())
+		}
+		fmt.Fprintf(&b, "AllowedIPs = %s\n", strings.Join(allowedIPs, ", "))
+	}
+
+	return b.String()
+}
+
+// writeDebugWGDNS adds the primary nameservers and the account DNS domain as the DNS entry of the interface.
+// The nameservers of specific domains can't be expressed with wg-quick and are added as comments
+func writeDebugWGDNS(b *strings.Builder, networkMap *NetworkMap, dnsDomain string) {
+	if !networkMap.DNSConfig.ServiceEnable {
+		return
+	}
+
+	var dns []string
+	for _, group := range networkMap.DNSConfig.NameServerGroups {
+		var servers []string
+		for _, ns := range group.NameServers {
+			servers = append(servers, ns.IP.String())
+		}
+
+		if group.Primary {
+			dns = append(dns, servers...)
+			continue
+		}
+		fmt.Fprintf(b, "# DNS for %s: %s\n", strings.Join(group.Domains, ", "), strings.Join(servers, ", "))
+	}
+
+	if dnsDomain != "" {
+		dns = append(dns, dnsDomain)
+	}
+	if len(dns) > 0 {
+		fmt.Fprintf(b, "DNS = %s\n", strings.Join(dns, ", "))
+	}
+}
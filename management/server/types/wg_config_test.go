@@ -0,0 +1,52 @@
+package types
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	nbdns "github.com/netbirdio/netbird/dns"
+	nbpeer "github.com/netbirdio/netbird/management/server/peer"
+	"github.com/netbirdio/netbird/route"
+	"github.com/netbirdio/netbird/shared/management/domain"
+)
+
+func TestDebugWGConfig(t *testing.T) {
+	peer := &nbpeer.Peer{ID: "peer1", Name: "peer1", Key: "peer1Key", IP: net.IP{100, 64, 0, 1}, DNSLabel: "peer1"}
+	router := &nbpeer.Peer{
+		ID: "router", Name: "router", Key: "routerKey", IP: net.IP{100, 64, 0, 2}, DNSLabel: "router",
+		Location: nbpeer.Location{ConnectionIP: net.IP{203, 0, 113, 10}},
+	}
+
+	networkMap := &NetworkMap{
+		Network: &Network{Net: net.IPNet{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)}},
+		Peers:   []*nbpeer.Peer{router},
+		Routes: []*route.Route{
+			{ID: "office", NetID: "office", Network: netip.MustParsePrefix("10.0.0.0/24"), Peer: router.Key},
+			{ID: "saas", NetID: "saas", NetworkType: route.DomainNetwork, Domains: domain.List{"example.com"}, Peer: router.Key},
+			{ID: "own", NetID: "own", Network: netip.MustParsePrefix("10.1.0.0/24"), Peer: peer.Key},
+		},
+		DNSConfig: nbdns.Config{
+			ServiceEnable: true,
+			NameServerGroups: []*nbdns.NameServerGroup{
+				{Primary: true, NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr("1.1.1.1")}}},
+				{Domains: []string{"corp.example.com"}, NameServers: []nbdns.NameServer{{IP: netip.MustParseAddr("10.0.0.53")}}},
+			},
+		},
+	}
+
+	config := DebugWGConfig(peer, networkMap, "netbird.cloud")
+
+	assert.Contains(t, config, "PrivateKey = "+redactedWGPrivateKey)
+	assert.Contains(t, config, "Address = 100.64.0.1/10")
+	assert.Contains(t, config, "DNS = 1.1.1.1, netbird.cloud")
+	assert.Contains(t, config, "# DNS for corp.example.com: 10.0.0.53")
+	assert.Contains(t, config, "PublicKey = routerKey")
+	assert.Contains(t, config, "# Name: router (router), FQDN: router.netbird.cloud")
+	assert.Contains(t, config, "last connected from 203.0.113.10")
+	assert.Contains(t, config, "AllowedIPs = 100.64.0.2/32, 10.0.0.0/24\n")
+	assert.Contains(t, config, "# Route saas: resolved by the client for example.com")
+	assert.NotContains(t, config, "10.1.0.0/24", "routes served by the peer itself aren't allowed IPs of a remote peer")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 	"unicode"
@@ -765,7 +766,8 @@ func (am *DefaultAccountManager) processUserUpdate(ctx context.Context, transact
 
 	var peersToExpire []*nbpeer.Peer
 
-	if !oldUser.IsBlocked() && update.IsBlocked() {
+	// the peers are kept with the quarantine and allow-until-expiry blocked peer owner behaviors
+	if !oldUser.IsBlocked() && update.IsBlocked() && settings.GetBlockedPeerOwnerBehavior() == types.BlockedPeerOwnerReject {
 		peersToExpire = userPeers
 	}
 
@@ -780,7 +782,7 @@ func (am *DefaultAccountManager) processUserUpdate(ctx context.Context, transact
 				}
 			}
 			for _, groupID := range addedGroups {
-				if err := transaction.AddPeerToGroup(ctx, accountID, peer.ID, groupID); err != nil {
+				if err := transaction.AddPeerToAutoGroup(ctx, accountID, peer.ID, groupID); err != nil {
 					return false, nil, nil, nil, fmt.Errorf("failed to add peer %s to group %s: %w", peer.ID, groupID, err)
 				}
 			}
@@ -1455,6 +1457,157 @@ func (am *DefaultAccountManager) RejectUser(ctx context.Context, accountID, init
 	return nil
 }
 
+// ReconcileUserPeerGroups recomputes the group memberships of the target user's peers against the user's current
+// auto groups. Missing auto group memberships are added and, when removeStale is set, memberships that were added
+// from groups that are no longer auto groups of the user are removed. Manually added memberships are never removed.
+func (am *DefaultAccountManager) ReconcileUserPeerGroups(ctx context.Context, accountID, initiatorUserID, targetUserID string, removeStale bool) error {
+	allowed, err := am.permissionsManager.ValidateUserPermissions(ctx, accountID, initiatorUserID, modules.Users, operations.Update)
+	if err != nil {
+		return status.NewPermissionValidationError(err)
+	}
+	if !allowed {
+		return status.NewPermissionDeniedError()
+	}
+
+	var updateAccountPeers bool
+	var eventsToStore []func()
+
+	err = am.Store.ExecuteInTransaction(ctx, func(transaction store.Store) error {
+		user, err := transaction.GetUserByUserID(ctx, store.LockingStrengthNone, targetUserID)
+		if err != nil {
+			return err
+		}
+
+		if user.AccountID != accountID {
+			return status.NewUserNotFoundError(targetUserID)
+		}
+
+		userPeers, err := transaction.GetUserPeers(ctx, store.LockingStrengthUpdate, accountID, targetUserID)
+		if err != nil {
+			return err
+		}
+
+		var added, removed []types.GroupPeer
+		for _, peer := range userPeers {
+			peerGroupIDs, err := transaction.GetPeerGroupIDs(ctx, store.LockingStrengthNone, accountID, peer.ID)
+			if err != nil {
+				return err
+			}
+
+			for _, groupID := range util.Difference(user.AutoGroups, peerGroupIDs) {
+				added = append(added, types.GroupPeer{AccountID: accountID, GroupID: groupID, PeerID: peer.ID})
+			}
+
+			if !removeStale {
+				continue
+			}
+
+			autoGroupIDs, err := transaction.GetPeerAutoGroupIDs(ctx, store.LockingStrengthNone, accountID, peer.ID)
+			if err != nil {
+				return err
+			}
+			for _, groupID := range util.Difference(autoGroupIDs, user.AutoGroups) {
+				removed = append(removed, types.GroupPeer{AccountID: accountID, GroupID: groupID, PeerID: peer.ID})
+			}
+		}
+
+		if len(added) == 0 && len(removed) == 0 {
+			return nil
+		}
+
+		groupIDs := make([]string, 0, len(added)+len(removed))
+		for _, gp := range slices.Concat(added, removed) {
+			groupIDs = append(groupIDs, gp.GroupID)
+		}
+		groups, err := transaction.GetGroupsByIDs(ctx, store.LockingStrengthNone, accountID, groupIDs)
+		if err != nil {
+			return err
+		}
+
+		updatedGroupIDs := make([]string, 0, len(groupIDs))
+		for _, gp := range added {
+			if _, ok := groups[gp.GroupID]; !ok {
+				// we do not wanna create the groups here
+				log.WithContext(ctx).Warnf("group %s does not exist for user group reconciliation", gp.GroupID)
+				continue
+			}
+			if err = transaction.AddPeerToAutoGroup(ctx, accountID, gp.PeerID, gp.GroupID); err != nil {
+				return fmt.Errorf("failed to add peer %s to group %s: %w", gp.PeerID, gp.GroupID, err)
+			}
+			updatedGroupIDs = append(updatedGroupIDs, gp.GroupID)
+		}
+		for _, gp := range removed {
+			if err = transaction.RemovePeerFromGroup(ctx, gp.PeerID, gp.GroupID); err != nil {
+				return fmt.Errorf("failed to remove peer %s from group %s: %w", gp.PeerID, gp.GroupID, err)
+			}
+			updatedGroupIDs = append(updatedGroupIDs, gp.GroupID)
+		}
+
+		if len(updatedGroupIDs) == 0 {
+			return nil
+		}
+
+		updateAccountPeers, err = areGroupChangesAffectPeers(ctx, transaction, accountID, updatedGroupIDs)
+		if err != nil {
+			return err
+		}
+
+		eventsToStore = am.prepareReconciledPeerGroupEvents(ctx, transaction, accountID, initiatorUserID, userPeers, groups, added, removed)
+
+		return transaction.IncrementNetworkSerial(ctx, accountID)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, storeEvent := range eventsToStore {
+		storeEvent()
+	}
+
+	if updateAccountPeers {
+		am.UpdateAccountPeers(ctx, accountID)
+	}
+
+	return nil
+}
+
+func (am *DefaultAccountManager) prepareReconciledPeerGroupEvents(ctx context.Context, transaction store.Store, accountID, initiatorUserID string,
+	userPeers []*nbpeer.Peer, groups map[string]*types.Group, added, removed []types.GroupPeer) []func() {
+	settings, err := transaction.GetAccountSettings(ctx, store.LockingStrengthNone, accountID)
+	if err != nil {
+		log.WithContext(ctx).Debugf("failed to get account settings for peer group events: %v", err)
+		return nil
+	}
+	dnsDomain := am.networkMapController.GetDNSDomain(settings)
+
+	peers := make(map[string]*nbpeer.Peer, len(userPeers))
+	for _, peer := range userPeers {
+		peers[peer.ID] = peer
+	}
+
+	var eventsToStore []func()
+	addEvents := func(groupPeers []types.GroupPeer, activityID activity.Activity) {
+		for _, gp := range groupPeers {
+			group, ok := groups[gp.GroupID]
+			if !ok {
+				continue
+			}
+			peer := peers[gp.PeerID]
+			meta := map[string]any{
+				"group": group.Name, "group_id": group.ID,
+				"peer_ip": peer.IP.String(), "peer_fqdn": peer.FQDN(dnsDomain),
+			}
+			eventsToStore = append(eventsToStore, func() {
+				am.StoreEvent(ctx, initiatorUserID, peer.ID, accountID, activityID, meta)
+			})
+		}
+	}
+	addEvents(added, activity.GroupAddedToPeer)
+	addEvents(removed, activity.GroupRemovedFromPeer)
+
+	return eventsToStore
+}
+
 // CreateUserInvite creates an invite link for a new user in the embedded IdP.
 // The user is NOT created until the invite is accepted.
 func (am *DefaultAccountManager) CreateUserInvite(ctx context.Context, accountID, initiatorUserID string, invite *types.UserInfo, expiresIn int) (*types.UserInvite, error) {
@@ -364,8 +364,9 @@ func TestUser_Copy(t *testing.T) {
 			ID:              0,
 			IntegrationType: "test",
 		},
-		Email: "whatever@gmail.com",
-		Name:  "John Doe",
+		Email:       "whatever@gmail.com",
+		Name:        "John Doe",
+		PinnedPeers: []string{"peer1"},
 	}
 
 	err := validateStruct(user)
@@ -1886,6 +1887,45 @@ func TestRejectUser(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestDefaultAccountManager_ReconcileUserPeerGroups(t *testing.T) {
+	manager, _, err := createManager(t)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	account := newAccountWithId(ctx, "account-1", "admin-user", "example.com", "", "", false)
+	require.NoError(t, manager.Store.SaveAccount(ctx, account))
+
+	for _, groupID := range []string{"old-auto", "new-auto", "manual"} {
+		require.NoError(t, manager.Store.CreateGroup(ctx, &types.Group{ID: groupID, AccountID: account.Id, Name: groupID, Issued: types.GroupIssuedAPI}))
+	}
+
+	owner := types.NewRegularUser("peer-owner", "", "")
+	owner.AccountID = account.Id
+	owner.AutoGroups = []string{"old-auto"}
+	require.NoError(t, manager.Store.SaveUser(ctx, owner))
+
+	peer := addTestPeer(t, manager, "", owner.Id, nbpeer.PeerSystemMeta{Hostname: "laptop"})
+	require.NoError(t, manager.GroupAddPeer(ctx, account.Id, "manual", peer.ID))
+
+	// the auto groups change without being propagated to the existing peers
+	owner.AutoGroups = []string{"new-auto"}
+	require.NoError(t, manager.Store.SaveUser(ctx, owner))
+
+	err = manager.ReconcileUserPeerGroups(ctx, account.Id, owner.Id, owner.Id, true)
+	require.Error(t, err, "regular users should not be able to reconcile peer groups")
+
+	require.NoError(t, manager.ReconcileUserPeerGroups(ctx, account.Id, "admin-user", owner.Id, false))
+	groupIDs, err := manager.Store.GetPeerGroupIDs(ctx, store.LockingStrengthNone, account.Id, peer.ID)
+	require.NoError(t, err)
+	assert.Subset(t, groupIDs, []string{"old-auto", "new-auto", "manual"}, "missing auto groups should be added without removing others")
+
+	require.NoError(t, manager.ReconcileUserPeerGroups(ctx, account.Id, "admin-user", owner.Id, true))
+	groupIDs, err = manager.Store.GetPeerGroupIDs(ctx, store.LockingStrengthNone, account.Id, peer.ID)
+	require.NoError(t, err)
+	assert.Subset(t, groupIDs, []string{"new-auto", "manual"}, "manual memberships should be kept")
+	assert.NotContains(t, groupIDs, "old-auto", "stale auto group memberships should be removed")
+}
+
 func TestUser_Operations_WithEmbeddedIDP(t *testing.T) {
 	ctx := context.Background()
 
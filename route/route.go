@@ -175,6 +175,11 @@ func (r *Route) IsDynamic() bool {
 	return r.NetworkType == DomainNetwork
 }
 
+// IsExitNode returns if the route is a default route (0.0.0.0/0 or ::/0)
+func (r *Route) IsExitNode() bool {
+	return !r.IsDynamic() && r.Network.IsValid() && r.Network.Bits() == 0
+}
+
 // GetHAUniqueID returns the HAUniqueID for the route, it can be used for grouping.
 func (r *Route) GetHAUniqueID() HAUniqueID {
 	return HAUniqueID(fmt.Sprintf("%s%s%s", r.NetID, haSeparator, r.NetString()))
@@ -1,8 +1,13 @@
 package context
 
 const (
-	RequestIDKey = "requestID"
-	AccountIDKey = "accountID"
-	UserIDKey    = "userID"
-	PeerIDKey    = "peerID"
+	RequestIDKey     = "requestID"
+	CorrelationIDKey = "correlationID"
+	AccountIDKey     = "accountID"
+	UserIDKey        = "userID"
+	PeerIDKey        = "peerID"
 )
+
+// CorrelationIDHeader is the gRPC metadata key a client sends its correlation ID in, so its requests to management,
+// e.g. the login followed by the sync, can be tied together in the logs
+const CorrelationIDHeader = "x-correlation-id"
@@ -23,5 +23,6 @@ type Client interface {
 	GetNetworkMap(sysInfo *system.Info) (*proto.NetworkMap, error)
 	IsHealthy() bool
 	SyncMeta(sysInfo *system.Info) error
+	ReportError(level proto.PeerReportedError_Level, message string)
 	Logout() error
 }
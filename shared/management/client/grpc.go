@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc/codes"
@@ -17,10 +19,13 @@ import (
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	nbgrpc "github.com/netbirdio/netbird/client/grpc"
 	"github.com/netbirdio/netbird/client/system"
 	"github.com/netbirdio/netbird/encryption"
+	nbcontext "github.com/netbirdio/netbird/shared/context"
 	"github.com/netbirdio/netbird/shared/management/domain"
 	"github.com/netbirdio/netbird/shared/management/proto"
 	"github.com/netbirdio/netbird/util/wsproxy"
@@ -46,8 +51,28 @@ type GrpcClient struct {
 	conn                  *grpc.ClientConn
 	connStateCallback     ConnStateNotifier
 	connStateCallbackLock sync.RWMutex
+	// knownSerial is the serial of the last network map handled on the sync stream,
+	// reported on reconnect so that the server can respond with a delta
+	knownSerial atomic.Uint64
+	// lazyRoutes keeps the route definitions fetched for lazy network maps
+	lazyRoutes *lazyRoutesCache
+	// lazyResourcesDisabled is set when a lazy network map couldn't be resolved,
+	// so that the server sends full network maps from then on
+	lazyResourcesDisabled atomic.Bool
+	// networkMapAckUnsupported is set when the server doesn't support network map acknowledgements
+	networkMapAckUnsupported atomic.Bool
+	// reportErrorsUnsupported is set when the server only accepts reported errors on sync
+	reportErrorsUnsupported atomic.Bool
+	// reportedErrors keeps the most recent errors passed to ReportError, sent to management right away and on every sync
+	reportedErrors     []*proto.PeerReportedError
+	reportedErrorsLock sync.Mutex
+	// correlationID is sent with the login, sync and acknowledgement requests, so management can tie them together in its logs
+	correlationID string
 }
 
+// maxReportedErrors is the number of most recent errors reported to management
+const maxReportedErrors = 5
+
 // NewClient creates a new client to Management service
 func NewClient(ctx context.Context, addr string, ourPrivateKey wgtypes.Key, tlsEnabled bool) (*GrpcClient, error) {
 	var conn *grpc.ClientConn
@@ -75,6 +100,8 @@ func NewClient(ctx context.Context, addr string, ourPrivateKey wgtypes.Key, tlsE
 		ctx:                   ctx,
 		conn:                  conn,
 		connStateCallbackLock: sync.RWMutex{},
+		lazyRoutes:            newLazyRoutesCache(),
+		correlationID:         uuid.NewString(),
 	}, nil
 }
 
@@ -302,11 +329,86 @@ func (c *GrpcClient) sendJobResponse(
 	return nil
 }
 
+// ReportError records an error or warning the client ran into, e.g. a route conflict, and sends the most recent ones
+// to management, so that they can be looked up without access to the client. They are sent again on every sync, in
+// case management couldn't be reached
+func (c *GrpcClient) ReportError(level proto.PeerReportedError_Level, message string) {
+	c.reportedErrorsLock.Lock()
+	c.reportedErrors = append(c.reportedErrors, &proto.PeerReportedError{
+		Timestamp: timestamppb.Now(),
+		Level:     level,
+		Message:   message,
+	})
+	if len(c.reportedErrors) > maxReportedErrors {
+		c.reportedErrors = c.reportedErrors[len(c.reportedErrors)-maxReportedErrors:]
+	}
+	c.reportedErrorsLock.Unlock()
+
+	go c.sendReportedErrors()
+}
+
+// sendReportedErrors sends the most recent reported errors with ReportErrors. Management versions without it only
+// receive them on the next sync
+func (c *GrpcClient) sendReportedErrors() {
+	if c.reportErrorsUnsupported.Load() || !c.ready() {
+		return
+	}
+
+	serverPubKey, err := c.GetServerPublicKey()
+	if err != nil {
+		log.Debugf(errMsgMgmtPublicKey, err)
+		return
+	}
+
+	reportReq, err := encryption.EncryptMessage(*serverPubKey, c.key, &proto.ReportErrorsRequest{ReportedErrors: c.getReportedErrors()})
+	if err != nil {
+		log.Errorf("failed to encrypt reported errors: %s", err)
+		return
+	}
+
+	mgmCtx, cancel := context.WithTimeout(c.ctx, ConnectTimeout)
+	defer cancel()
+
+	_, err = c.realClient.ReportErrors(c.withCorrelationID(mgmCtx), &proto.EncryptedMessage{
+		WgPubKey: c.key.PublicKey().String(),
+		Body:     reportReq,
+	})
+	if err != nil {
+		if s, ok := gstatus.FromError(err); ok && s.Code() == codes.Unimplemented {
+			log.Debugf("management doesn't support reporting errors outside of sync")
+			c.reportErrorsUnsupported.Store(true)
+			return
+		}
+		log.Debugf("failed to report errors: %v", err)
+	}
+}
+
+func (c *GrpcClient) getReportedErrors() []*proto.PeerReportedError {
+	c.reportedErrorsLock.Lock()
+	defer c.reportedErrorsLock.Unlock()
+
+	return slices.Clone(c.reportedErrors)
+}
+
+// getCapabilities returns the network map features the client handles
+func (c *GrpcClient) getCapabilities() []proto.PeerCapability {
+	capabilities := []proto.PeerCapability{proto.PeerCapability_PeerCapabilityDeltaNetworkMap}
+	if !c.lazyResourcesDisabled.Load() {
+		capabilities = append(capabilities, proto.PeerCapability_PeerCapabilityLazyResources)
+	}
+	return capabilities
+}
+
 func (c *GrpcClient) handleSyncStream(ctx context.Context, serverPubKey wgtypes.Key, sysInfo *system.Info, msgHandler func(msg *proto.SyncResponse) error) error {
 	ctx, cancelStream := context.WithCancel(ctx)
 	defer cancelStream()
 
-	stream, err := c.connectToSyncStream(ctx, serverPubKey, sysInfo)
+	stream, err := c.connectToSyncStream(ctx, serverPubKey, &proto.SyncRequest{
+		Meta:           infoToMetaData(sysInfo),
+		KnownSerial:    c.knownSerial.Load(),
+		ReportedErrors: c.getReportedErrors(),
+		Capabilities:   c.getCapabilities(),
+	})
 	if err != nil {
 		log.Debugf("failed to open Management Service stream: %s", err)
 		if s, ok := gstatus.FromError(err); ok && s.Code() == codes.PermissionDenied {
@@ -353,7 +455,7 @@ func (c *GrpcClient) GetNetworkMap(sysInfo *system.Info) (*proto.NetworkMap, err
 
 	ctx, cancelStream := context.WithCancel(c.ctx)
 	defer cancelStream()
-	stream, err := c.connectToSyncStream(ctx, *serverPubKey, sysInfo)
+	stream, err := c.connectToSyncStream(ctx, *serverPubKey, &proto.SyncRequest{Meta: infoToMetaData(sysInfo)})
 	if err != nil {
 		log.Debugf("failed to open Management Service stream: %s", err)
 		return nil, err
@@ -386,9 +488,7 @@ func (c *GrpcClient) GetNetworkMap(sysInfo *system.Info) (*proto.NetworkMap, err
 	return decryptedResp.GetNetworkMap(), nil
 }
 
-func (c *GrpcClient) connectToSyncStream(ctx context.Context, serverPubKey wgtypes.Key, sysInfo *system.Info) (proto.ManagementService_SyncClient, error) {
-	req := &proto.SyncRequest{Meta: infoToMetaData(sysInfo)}
-
+func (c *GrpcClient) connectToSyncStream(ctx context.Context, serverPubKey wgtypes.Key, req *proto.SyncRequest) (proto.ManagementService_SyncClient, error) {
 	myPrivateKey := c.key
 	myPublicKey := myPrivateKey.PublicKey()
 
@@ -398,7 +498,7 @@ func (c *GrpcClient) connectToSyncStream(ctx context.Context, serverPubKey wgtyp
 		return nil, err
 	}
 	syncReq := &proto.EncryptedMessage{WgPubKey: myPublicKey.String(), Body: encryptedReq}
-	sync, err := c.realClient.Sync(ctx, syncReq)
+	sync, err := c.realClient.Sync(c.withCorrelationID(ctx), syncReq)
 	if err != nil {
 		return nil, err
 	}
@@ -425,12 +525,70 @@ func (c *GrpcClient) receiveUpdatesEvents(stream proto.ManagementService_SyncCli
 			return err
 		}
 
+		if nm := decryptedResp.GetNetworkMap(); nm.GetRoutesLazy() {
+			fetch := func(routeIDs []string) ([]*proto.Route, error) {
+				return c.GetResourceDetails(serverPubKey, routeIDs)
+			}
+			if err := c.lazyRoutes.resolve(nm, fetch); err != nil {
+				// reconnect without lazy resources to receive the full network map
+				c.lazyResourcesDisabled.Store(true)
+				c.knownSerial.Store(0)
+				return fmt.Errorf("resolve lazy network map: %w", err)
+			}
+		}
+
 		if err := msgHandler(decryptedResp); err != nil {
 			log.Errorf("failed handling an update message received from Management Service: %v", err.Error())
+			if decryptedResp.GetNetworkMap().GetIsDelta() {
+				// reconnect without a known serial to receive the full network map
+				c.knownSerial.Store(0)
+				return fmt.Errorf("apply delta network map: %w", err)
+			}
+			continue
+		}
+
+		if nm := decryptedResp.GetNetworkMap(); nm != nil {
+			c.knownSerial.Store(nm.GetSerial())
+			go c.ackNetworkMap(serverPubKey, nm.GetSerial())
 		}
 	}
 }
 
+// ackNetworkMap acknowledges that the network map with the given serial was applied,
+// so that management can detect peers stuck on a stale network map
+func (c *GrpcClient) ackNetworkMap(serverPubKey wgtypes.Key, serial uint64) {
+	if c.networkMapAckUnsupported.Load() {
+		return
+	}
+
+	ackReq, err := encryption.EncryptMessage(serverPubKey, c.key, &proto.NetworkMapAck{Serial: serial})
+	if err != nil {
+		log.Errorf("failed to encrypt network map acknowledgement: %s", err)
+		return
+	}
+
+	mgmCtx, cancel := context.WithTimeout(c.ctx, ConnectTimeout)
+	defer cancel()
+
+	_, err = c.realClient.AckNetworkMap(c.withCorrelationID(mgmCtx), &proto.EncryptedMessage{
+		WgPubKey: c.key.PublicKey().String(),
+		Body:     ackReq,
+	})
+	if err != nil {
+		if s, ok := gstatus.FromError(err); ok && s.Code() == codes.Unimplemented {
+			log.Debugf("management doesn't support network map acknowledgements")
+			c.networkMapAckUnsupported.Store(true)
+			return
+		}
+		log.Debugf("failed to acknowledge network map with serial %d: %v", serial, err)
+	}
+}
+
+// withCorrelationID adds the correlation ID of the client to the metadata of the outgoing request
+func (c *GrpcClient) withCorrelationID(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, nbcontext.CorrelationIDHeader, c.correlationID)
+}
+
 // GetServerPublicKey returns server's WireGuard public key (used later for encrypting messages sent to the server)
 func (c *GrpcClient) GetServerPublicKey() (*wgtypes.Key, error) {
 	if !c.ready() {
@@ -496,7 +654,7 @@ func (c *GrpcClient) login(serverKey wgtypes.Key, req *proto.LoginRequest) (*pro
 		defer cancel()
 
 		var err error
-		resp, err = c.realClient.Login(mgmCtx, &proto.EncryptedMessage{
+		resp, err = c.realClient.Login(c.withCorrelationID(mgmCtx), &proto.EncryptedMessage{
 			WgPubKey: c.key.PublicKey().String(),
 			Body:     loginReq,
 		})
@@ -535,7 +693,7 @@ func (c *GrpcClient) Register(serverKey wgtypes.Key, setupKey string, jwtToken s
 		SshPubKey: pubSSHKey,
 		WgPubKey:  []byte(c.key.PublicKey().String()),
 	}
-	return c.login(serverKey, &proto.LoginRequest{SetupKey: setupKey, Meta: infoToMetaData(sysInfo), JwtToken: jwtToken, PeerKeys: keys, DnsLabels: dnsLabels.ToPunycodeList()})
+	return c.login(serverKey, &proto.LoginRequest{SetupKey: setupKey, Meta: infoToMetaData(sysInfo), JwtToken: jwtToken, PeerKeys: keys, DnsLabels: dnsLabels.ToPunycodeList(), Capabilities: c.getCapabilities()})
 }
 
 // Login attempts login to Management Server. Takes care of encrypting and decrypting messages.
@@ -544,7 +702,39 @@ func (c *GrpcClient) Login(serverKey wgtypes.Key, sysInfo *system.Info, pubSSHKe
 		SshPubKey: pubSSHKey,
 		WgPubKey:  []byte(c.key.PublicKey().String()),
 	}
-	return c.login(serverKey, &proto.LoginRequest{Meta: infoToMetaData(sysInfo), PeerKeys: keys, DnsLabels: dnsLabels.ToPunycodeList()})
+	return c.login(serverKey, &proto.LoginRequest{Meta: infoToMetaData(sysInfo), PeerKeys: keys, DnsLabels: dnsLabels.ToPunycodeList(), Capabilities: c.getCapabilities()})
+}
+
+// GetResourceDetails returns the definitions of the routes referenced by the last lazy network map received.
+// It also takes care of encrypting and decrypting messages.
+func (c *GrpcClient) GetResourceDetails(serverKey wgtypes.Key, routeIDs []string) ([]*proto.Route, error) {
+	if !c.ready() {
+		return nil, errors.New(errMsgNoMgmtConnection)
+	}
+	mgmCtx, cancel := context.WithTimeout(c.ctx, ConnectTimeout)
+	defer cancel()
+
+	message := &proto.ResourceDetailsRequest{RouteIDs: routeIDs}
+	encryptedMSG, err := encryption.EncryptMessage(serverKey, c.key, message)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.realClient.GetResourceDetails(mgmCtx, &proto.EncryptedMessage{
+		WgPubKey: c.key.PublicKey().String(),
+		Body:     encryptedMSG,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	detailsResp := &proto.ResourceDetailsResponse{}
+	err = encryption.DecryptMessage(serverKey, c.key, resp.Body, detailsResp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt resource details message: %w", err)
+	}
+
+	return detailsResp.GetRoutes(), nil
 }
 
 // GetDeviceAuthorizationFlow returns a device authorization flow information.
@@ -703,6 +893,11 @@ func infoToMetaData(info *system.Info) *proto.PeerSystemMeta {
 		})
 	}
 
+	var lastHandshake *timestamppb.Timestamp
+	if !info.LastHandshake.IsZero() {
+		lastHandshake = timestamppb.New(info.LastHandshake)
+	}
+
 	files := make([]*proto.File, 0, len(info.Files))
 	for _, file := range info.Files {
 		files = append(files, &proto.File{
@@ -747,5 +942,9 @@ func infoToMetaData(info *system.Info) *proto.PeerSystemMeta {
 
 			LazyConnectionEnabled: info.LazyConnectionEnabled,
 		},
+		LastHandshake: lastHandshake,
+		RelayAddress:  info.RelayAddress,
+		RxBytes:       info.RxBytes,
+		TxBytes:       info.TxBytes,
 	}
 }
@@ -19,6 +19,7 @@ type MockClient struct {
 	GetDeviceAuthorizationFlowFunc func(serverKey wgtypes.Key) (*proto.DeviceAuthorizationFlow, error)
 	GetPKCEAuthorizationFlowFunc   func(serverKey wgtypes.Key) (*proto.PKCEAuthorizationFlow, error)
 	SyncMetaFunc                   func(sysInfo *system.Info) error
+	ReportErrorFunc                func(level proto.PeerReportedError_Level, message string)
 	LogoutFunc                     func() error
 	JobFunc                        func(ctx context.Context, msgHandler func(msg *proto.JobRequest) *proto.JobResponse) error
 }
@@ -95,6 +96,13 @@ func (m *MockClient) SyncMeta(sysInfo *system.Info) error {
 	return m.SyncMetaFunc(sysInfo)
 }
 
+func (m *MockClient) ReportError(level proto.PeerReportedError_Level, message string) {
+	if m.ReportErrorFunc == nil {
+		return
+	}
+	m.ReportErrorFunc(level, message)
+}
+
 func (m *MockClient) Logout() error {
 	if m.LogoutFunc == nil {
 		return nil
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/netbirdio/netbird/shared/management/proto"
+)
+
+type lazyRoute struct {
+	hash  uint64
+	route *proto.Route
+}
+
+// lazyRoutesCache keeps the route definitions fetched for lazy network maps, keyed by route ID
+type lazyRoutesCache struct {
+	mu     sync.Mutex
+	routes map[string]lazyRoute
+}
+
+func newLazyRoutesCache() *lazyRoutesCache {
+	return &lazyRoutesCache{
+		routes: make(map[string]lazyRoute),
+	}
+}
+
+// resolve fills the routes of a lazy network map from the cache, fetching the routes missing or changed since they
+// were cached. The routes no longer referenced are dropped from the cache.
+func (c *lazyRoutesCache) resolve(nm *proto.NetworkMap, fetch func(routeIDs []string) ([]*proto.Route, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var missing []string
+	for _, ref := range nm.GetLazyRoutes() {
+		if cached, ok := c.routes[ref.GetID()]; !ok || cached.hash != ref.GetHash() {
+			missing = append(missing, ref.GetID())
+		}
+	}
+
+	fetched := make(map[string]*proto.Route, len(missing))
+	if len(missing) > 0 {
+		routes, err := fetch(missing)
+		if err != nil {
+			return fmt.Errorf("fetch routes: %w", err)
+		}
+		for _, r := range routes {
+			fetched[r.GetID()] = r
+		}
+	}
+
+	resolved := make(map[string]lazyRoute, len(nm.GetLazyRoutes()))
+	routes := make([]*proto.Route, 0, len(nm.GetLazyRoutes()))
+	for _, ref := range nm.GetLazyRoutes() {
+		r, ok := fetched[ref.GetID()]
+		if !ok {
+			cached, found := c.routes[ref.GetID()]
+			if !found || cached.hash != ref.GetHash() {
+				return fmt.Errorf("route %s referenced by the network map was not returned", ref.GetID())
+			}
+			r = cached.route
+		}
+		resolved[ref.GetID()] = lazyRoute{hash: ref.GetHash(), route: r}
+		routes = append(routes, r)
+	}
+
+	c.routes = resolved
+	nm.Routes = routes
+	nm.RoutesLazy = false
+	nm.LazyRoutes = nil
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netbirdio/netbird/shared/management/proto"
+)
+
+func TestLazyRoutesCache_Resolve(t *testing.T) {
+	definitions := map[string]*proto.Route{
+		"a": {ID: "a", Network: "10.0.0.0/24"},
+		"b": {ID: "b", Network: "10.0.1.0/24"},
+	}
+	var requested []string
+	fetch := func(routeIDs []string) ([]*proto.Route, error) {
+		requested = append(requested, routeIDs...)
+		var routes []*proto.Route
+		for _, id := range routeIDs {
+			if r, ok := definitions[id]; ok {
+				routes = append(routes, r)
+			}
+		}
+		return routes, nil
+	}
+
+	cache := newLazyRoutesCache()
+
+	nm := &proto.NetworkMap{
+		RoutesLazy: true,
+		LazyRoutes: []*proto.ResourceReference{{ID: "a", Hash: 1}, {ID: "b", Hash: 1}},
+	}
+	require.NoError(t, cache.resolve(nm, fetch))
+	assert.False(t, nm.RoutesLazy)
+	assert.Empty(t, nm.LazyRoutes)
+	require.Len(t, nm.Routes, 2)
+	assert.Equal(t, "10.0.0.0/24", nm.Routes[0].Network)
+	assert.ElementsMatch(t, []string{"a", "b"}, requested)
+
+	// only the changed route is fetched again
+	requested = nil
+	definitions["b"] = &proto.Route{ID: "b", Network: "10.0.2.0/24"}
+	nm = &proto.NetworkMap{
+		RoutesLazy: true,
+		LazyRoutes: []*proto.ResourceReference{{ID: "a", Hash: 1}, {ID: "b", Hash: 2}},
+	}
+	require.NoError(t, cache.resolve(nm, fetch))
+	assert.Equal(t, []string{"b"}, requested)
+	require.Len(t, nm.Routes, 2)
+	assert.Equal(t, "10.0.2.0/24", nm.Routes[1].Network)
+
+	// a route the server didn't return can't be resolved
+	nm = &proto.NetworkMap{
+		RoutesLazy: true,
+		LazyRoutes: []*proto.ResourceReference{{ID: "a", Hash: 1}, {ID: "c", Hash: 1}},
+	}
+	assert.Error(t, cache.resolve(nm, fetch))
+
+	nm = &proto.NetworkMap{
+		RoutesLazy: true,
+		LazyRoutes: []*proto.ResourceReference{{ID: "a", Hash: 3}},
+	}
+	assert.Error(t, cache.resolve(nm, func([]string) ([]*proto.Route, error) {
+		return nil, errors.New("unavailable")
+	}))
+}
@@ -4,16 +4,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 
 	"github.com/netbirdio/netbird/shared/management/http/api"
 )
 
+// ErrAccountNotFound is returned when no account is accessible with the current credentials
+var ErrAccountNotFound = errors.New("account not found")
+
 // AccountsAPI APIs for accounts, do not use directly
 type AccountsAPI struct {
 	c *Client
 }
 
-// List list all accounts, only returns one account always
+// List list all accounts accessible with the current credentials.
+// The management server currently scopes every token to a single account, so the list holds one account,
+// use Current for single-account tooling.
 // See more: https://docs.netbird.io/api/resources/accounts#list-all-accounts
 func (a *AccountsAPI) List(ctx context.Context) ([]api.Account, error) {
 	resp, err := a.c.NewRequest(ctx, "GET", "/api/accounts", nil, nil)
@@ -27,6 +33,19 @@ func (a *AccountsAPI) List(ctx context.Context) ([]api.Account, error) {
 	return ret, err
 }
 
+// Current get the account the current credentials belong to
+// See more: https://docs.netbird.io/api/resources/accounts#list-all-accounts
+func (a *AccountsAPI) Current(ctx context.Context) (*api.Account, error) {
+	ret, err := a.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, ErrAccountNotFound
+	}
+	return &ret[0], nil
+}
+
 // Update update account settings
 // See more: https://docs.netbird.io/api/resources/accounts#update-an-account
 func (a *AccountsAPI) Update(ctx context.Context, accountID string, request api.PutApiAccountsAccountIdJSONRequestBody) (*api.Account, error) {
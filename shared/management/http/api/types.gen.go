@@ -16,6 +16,26 @@ const (
 	TokenAuthScopes  = "TokenAuth.Scopes"
 )
 
+// Defines values for AccountSettingsBlockedPeerOwnerBehavior.
+const (
+	AccountSettingsBlockedPeerOwnerBehaviorAllowUntilExpiry AccountSettingsBlockedPeerOwnerBehavior = "allow-until-expiry"
+	AccountSettingsBlockedPeerOwnerBehaviorQuarantine       AccountSettingsBlockedPeerOwnerBehavior = "quarantine"
+	AccountSettingsBlockedPeerOwnerBehaviorReject           AccountSettingsBlockedPeerOwnerBehavior = "reject"
+)
+
+// Defines values for AccountSettingsPeerDnsLabelSuffix.
+const (
+	AccountSettingsPeerDnsLabelSuffixCounter AccountSettingsPeerDnsLabelSuffix = "counter"
+	AccountSettingsPeerDnsLabelSuffixHash    AccountSettingsPeerDnsLabelSuffix = "hash"
+	AccountSettingsPeerDnsLabelSuffixOctets  AccountSettingsPeerDnsLabelSuffix = "octets"
+)
+
+// Defines values for AccountSettingsReservedDnsLabelAction.
+const (
+	AccountSettingsReservedDnsLabelActionReject AccountSettingsReservedDnsLabelAction = "reject"
+	AccountSettingsReservedDnsLabelActionSuffix AccountSettingsReservedDnsLabelAction = "suffix"
+)
+
 // Defines values for DNSRecordType.
 const (
 	DNSRecordTypeA     DNSRecordType = "A"
@@ -207,12 +227,38 @@ const (
 	NetworkResourceTypeSubnet NetworkResourceType = "subnet"
 )
 
+// Defines values for PeerFirewallOverrideAction.
+const (
+	PeerFirewallOverrideActionAccept PeerFirewallOverrideAction = "accept"
+	PeerFirewallOverrideActionDrop   PeerFirewallOverrideAction = "drop"
+)
+
+// Defines values for PeerFirewallOverrideDirection.
+const (
+	PeerFirewallOverrideDirectionIn  PeerFirewallOverrideDirection = "in"
+	PeerFirewallOverrideDirectionOut PeerFirewallOverrideDirection = "out"
+)
+
+// Defines values for PeerFirewallOverrideProtocol.
+const (
+	PeerFirewallOverrideProtocolAll  PeerFirewallOverrideProtocol = "all"
+	PeerFirewallOverrideProtocolIcmp PeerFirewallOverrideProtocol = "icmp"
+	PeerFirewallOverrideProtocolTcp  PeerFirewallOverrideProtocol = "tcp"
+	PeerFirewallOverrideProtocolUdp  PeerFirewallOverrideProtocol = "udp"
+)
+
 // Defines values for PeerNetworkRangeCheckAction.
 const (
 	PeerNetworkRangeCheckActionAllow PeerNetworkRangeCheckAction = "allow"
 	PeerNetworkRangeCheckActionDeny  PeerNetworkRangeCheckAction = "deny"
 )
 
+// Defines values for PeerReportedErrorLevel.
+const (
+	PeerReportedErrorLevelError   PeerReportedErrorLevel = "error"
+	PeerReportedErrorLevelWarning PeerReportedErrorLevel = "warning"
+)
+
 // Defines values for PolicyRuleAction.
 const (
 	PolicyRuleActionAccept PolicyRuleAction = "accept"
@@ -393,12 +439,18 @@ type AccountSettings struct {
 	// AutoUpdateVersion Set Clients auto-update version. "latest", "disabled", or a specific version (e.g "0.50.1")
 	AutoUpdateVersion *string `json:"auto_update_version,omitempty"`
 
+	// BlockedPeerOwnerBehavior How the peers added with SSO login are handled once their owner is blocked. "reject" expires the peers and rejects their login, "quarantine" keeps the peers connected with an empty network map and "allow-until-expiry" keeps the peers working until their login expires, which requires peer login expiration to be enabled. An omitted value uses "reject".
+	BlockedPeerOwnerBehavior *AccountSettingsBlockedPeerOwnerBehavior `json:"blocked_peer_owner_behavior,omitempty"`
+
 	// DnsDomain Allows to define a custom dns domain for the account
 	DnsDomain *string `json:"dns_domain,omitempty"`
 
 	// EmbeddedIdpEnabled Indicates whether the embedded identity provider (Dex) is enabled for this account. This is a read-only field.
-	EmbeddedIdpEnabled *bool                 `json:"embedded_idp_enabled,omitempty"`
-	Extra              *AccountExtraSettings `json:"extra,omitempty"`
+	EmbeddedIdpEnabled *bool `json:"embedded_idp_enabled,omitempty"`
+
+	// ExcludeEphemeralPeersFromLimits Excludes ephemeral peers from the peer counts used for billing and limits, including peer_limit. Ephemeral peers are still listed and can be counted with the ephemeral filter.
+	ExcludeEphemeralPeersFromLimits *bool                 `json:"exclude_ephemeral_peers_from_limits,omitempty"`
+	Extra                           *AccountExtraSettings `json:"extra,omitempty"`
 
 	// GroupsPropagationEnabled Allows propagate the new user auto groups to peers that belongs to the user
 	GroupsPropagationEnabled *bool `json:"groups_propagation_enabled,omitempty"`
@@ -415,28 +467,106 @@ type AccountSettings struct {
 	// LazyConnectionEnabled Enables or disables experimental lazy connection
 	LazyConnectionEnabled *bool `json:"lazy_connection_enabled,omitempty"`
 
+	// NetworkMapConnectedPeersOnly Limits the network maps sent to the peers to the peers currently connected to management, reducing their size in large, mostly idle accounts. Firewall rules for the offline peers are left out as well, while their DNS records and the routes are kept, so they become reachable with the update sent when they connect.
+	NetworkMapConnectedPeersOnly *bool `json:"network_map_connected_peers_only,omitempty"`
+
 	// NetworkRange Allows to define a custom network range for the account in CIDR format
 	NetworkRange *string `json:"network_range,omitempty"`
 
+	// PeerDisconnectGracePeriod Period in seconds a disconnected peer is still shown as connected, up to 600. A peer reconnecting within the period keeps its connected status, so the flaps of unstable connections don't cause status changes and network map updates. Zero or an omitted value marks the peers as disconnected right away.
+	PeerDisconnectGracePeriod *int `json:"peer_disconnect_grace_period,omitempty"`
+
+	// PeerDnsLabelMaxLength Maximum length of the peer DNS labels including the suffix, between 16 and 63. Zero or an omitted value uses 63.
+	PeerDnsLabelMaxLength *int `json:"peer_dns_label_max_length,omitempty"`
+
+	// PeerDnsLabelSuffix Strategy used to build a unique DNS label for a peer whose hostname label is already taken. "octets" appends the last two octets of the peer IP, "hash" a short hash of the peer IP and "counter" the lowest free number. An omitted value uses "octets".
+	PeerDnsLabelSuffix *AccountSettingsPeerDnsLabelSuffix `json:"peer_dns_label_suffix,omitempty"`
+
+	// PeerExpirationTolerance Grace period in milliseconds added to the login and inactivity expiration of the peers, so a small clock drift between management servers doesn't expire peers early. Up to 60000. Zero or an omitted value uses the default of 1000.
+	PeerExpirationTolerance *int `json:"peer_expiration_tolerance,omitempty"`
+
+	// PeerExtraDnsLabelsLimit Maximum number of extra DNS labels a peer can register, between 1 and 32. Zero or an omitted value uses 32.
+	PeerExtraDnsLabelsLimit *int `json:"peer_extra_dns_labels_limit,omitempty"`
+
 	// PeerInactivityExpiration Period of time of inactivity after which peer session expires (seconds).
 	PeerInactivityExpiration int `json:"peer_inactivity_expiration"`
 
 	// PeerInactivityExpirationEnabled Enables or disables peer inactivity expiration globally. After peer's session has expired the user has to log in (authenticate). Applies only to peers that were added by a user (interactive SSO login).
 	PeerInactivityExpirationEnabled bool `json:"peer_inactivity_expiration_enabled"`
 
+	// PeerLimit Maximum number of peers the account can register. Registrations beyond it are rejected, ephemeral peers are not limited when exclude_ephemeral_peers_from_limits is enabled. Zero or an omitted value doesn't limit the number of peers.
+	PeerLimit *int `json:"peer_limit,omitempty"`
+
 	// PeerLoginExpiration Period of time after which peer login expires (seconds).
 	PeerLoginExpiration int `json:"peer_login_expiration"`
 
 	// PeerLoginExpirationEnabled Enables or disables peer login expiration globally. After peer's login has expired the user has to log in (authenticate). Applies only to peers that were added by a user (interactive SSO login).
 	PeerLoginExpirationEnabled bool `json:"peer_login_expiration_enabled"`
 
+	// PeerLoginExpirationLeadTime Period of time before the peer login expiration from which peers are asked to re-authenticate (seconds). Must be smaller than peer_login_expiration. Zero or an omitted value disables the re-authentication prompt.
+	PeerLoginExpirationLeadTime *int `json:"peer_login_expiration_lead_time,omitempty"`
+
+	// PeerNamingTemplate Template used to name newly registered peers instead of their hostname. Supported variables are {hostname}, {os}, {user} and {random}. Empty value disables the template.
+	PeerNamingTemplate *string `json:"peer_naming_template,omitempty"`
+
+	// PeerRegistrationOsVersionCheck Posture check for the version of operating system
+	PeerRegistrationOsVersionCheck *OSVersionCheck `json:"peer_registration_os_version_check,omitempty"`
+
+	// PeerUpdateBufferInterval Interval in milliseconds network map updates of the account peers are buffered for before being sent, up to 60000. Zero or an omitted value uses the management server default.
+	PeerUpdateBufferInterval *int `json:"peer_update_buffer_interval,omitempty"`
+
+	// PeerUsageCap Maximum number of bytes a peer may receive and send within peer_usage_cap_window before it is marked for quarantine. The cap is reporting only, peers exceeding it are not restricted. Zero or an omitted value disables the cap.
+	PeerUsageCap *int64 `json:"peer_usage_cap,omitempty"`
+
+	// PeerUsageCapWindow Period of time over which the peer usage is compared against peer_usage_cap (seconds), up to 2592000. Required when peer_usage_cap is set.
+	PeerUsageCapWindow *int `json:"peer_usage_cap_window,omitempty"`
+
+	// PeerWebhookSecret Secret used to sign the peer webhook payloads with HMAC-SHA256, sent in the X-Netbird-Signature header. This is a write-only field, when omitted the stored secret is kept.
+	PeerWebhookSecret *string `json:"peer_webhook_secret,omitempty"`
+
+	// PeerWebhookUrl HTTP endpoint notified with a signed JSON payload when a peer is added or deleted, or changes its approval state. The host must resolve to public addresses. Empty value disables the webhook.
+	PeerWebhookUrl *string `json:"peer_webhook_url,omitempty"`
+
+	// RegistrationFrozen Rejects the registration of new peers, with both setup keys and user logins, e.g. during an incident with compromised setup keys. The peers already registered keep working.
+	RegistrationFrozen *bool `json:"registration_frozen,omitempty"`
+
 	// RegularUsersViewBlocked Allows blocking regular users from viewing parts of the system.
 	RegularUsersViewBlocked bool `json:"regular_users_view_blocked"`
 
+	// RelayCountryMapping Map of ISO 3166-1 alpha-2 country codes to the relay URL the peers located in the country should prefer. Peers with an unknown or unmapped location get no hint and pick the relay on their own. Up to 250 countries can be mapped.
+	RelayCountryMapping *map[string]string `json:"relay_country_mapping,omitempty"`
+
+	// ReservedDnsLabelAction What happens when a peer is added or renamed with a reserved DNS label. "suffix" gives the peer a label built with the peer_dns_label_suffix strategy, as for a taken label, and "reject" rejects the request. An omitted value uses "suffix".
+	ReservedDnsLabelAction *AccountSettingsReservedDnsLabelAction `json:"reserved_dns_label_action,omitempty"`
+
+	// ReservedDnsLabels DNS labels that can't be given to peers, e.g. the labels meant for infrastructure. Labels must be lowercase, peers already holding one of them keep it.
+	ReservedDnsLabels *[]string `json:"reserved_dns_labels,omitempty"`
+
 	// RoutingPeerDnsResolutionEnabled Enables or disables DNS resolution on the routing peers
 	RoutingPeerDnsResolutionEnabled *bool `json:"routing_peer_dns_resolution_enabled,omitempty"`
+
+	// SetupKeyPeerExpirationAllowed Allows registering the peers added with a setup key with their login and inactivity expiration flags enabled, with the setup_key_peer_expiration_defaults or per setup key. It has to be set explicitly as these peers can't re-authenticate with SSO once expired.
+	SetupKeyPeerExpirationAllowed *bool `json:"setup_key_peer_expiration_allowed,omitempty"`
+
+	// SetupKeyPeerExpirationDefaults Login and inactivity expiration flags new peers are registered with. For the user peer defaults an omitted value enables both expirations, for the setup key peer defaults it disables both.
+	SetupKeyPeerExpirationDefaults *PeerExpirationDefaults `json:"setup_key_peer_expiration_defaults,omitempty"`
+
+	// SignificantPeerMetaFields Peer meta fields whose changes trigger an update of the account peers, e.g. hostname or system_product_name. Changes of the other fields are only stored. An empty list makes every system meta field significant. The fields used by posture checks (go_os, os_version, kernel_version, wt_version, network_addresses, files) must be included in a non-empty list.
+	SignificantPeerMetaFields *[]string `json:"significant_peer_meta_fields,omitempty"`
+
+	// UserPeerExpirationDefaults Login and inactivity expiration flags new peers are registered with. For the user peer defaults an omitted value enables both expirations, for the setup key peer defaults it disables both.
+	UserPeerExpirationDefaults *PeerExpirationDefaults `json:"user_peer_expiration_defaults,omitempty"`
 }
 
+// AccountSettingsBlockedPeerOwnerBehavior How the peers added with SSO login are handled once their owner is blocked. "reject" expires the peers and rejects their login, "quarantine" keeps the peers connected with an empty network map and "allow-until-expiry" keeps the peers working until their login expires, which requires peer login expiration to be enabled. An omitted value uses "reject".
+type AccountSettingsBlockedPeerOwnerBehavior string
+
+// AccountSettingsPeerDnsLabelSuffix Strategy used to build a unique DNS label for a peer whose hostname label is already taken. "octets" appends the last two octets of the peer IP, "hash" a short hash of the peer IP and "counter" the lowest free number. An omitted value uses "octets".
+type AccountSettingsPeerDnsLabelSuffix string
+
+// AccountSettingsReservedDnsLabelAction What happens when a peer is added or renamed with a reserved DNS label. "suffix" gives the peer a label built with the peer_dns_label_suffix strategy, as for a taken label, and "reject" rejects the request. An omitted value uses "suffix".
+type AccountSettingsReservedDnsLabelAction string
+
 // AvailablePorts defines model for AvailablePorts.
 type AvailablePorts struct {
 	// Tcp Number of available TCP  ports left on the ingress peer
@@ -512,6 +642,9 @@ type City struct {
 
 	// GeonameId Integer ID of the record in GeoNames database
 	GeonameId int `json:"geoname_id"`
+
+	// SubdivisionCode ISO 3166-2 code of the region of the city, when known
+	SubdivisionCode *string `json:"subdivision_code,omitempty"`
 }
 
 // CityName Commonly used English name of the city
@@ -534,6 +667,9 @@ type CreateSetupKeyRequest struct {
 	// AllowExtraDnsLabels Allow extra DNS labels to be added to the peer
 	AllowExtraDnsLabels *bool `json:"allow_extra_dns_labels,omitempty"`
 
+	// AllowOutdatedOsVersion Peers registered with this key are exempt from the account minimum OS versions, e.g. for lab machines
+	AllowOutdatedOsVersion *bool `json:"allow_outdated_os_version,omitempty"`
+
 	// AutoGroups List of group IDs to auto-assign to peers registered with this key
 	AutoGroups []string `json:"auto_groups"`
 
@@ -543,9 +679,21 @@ type CreateSetupKeyRequest struct {
 	// ExpiresIn Expiration time in seconds
 	ExpiresIn int `json:"expires_in"`
 
+	// ManagedPeers Peers registered with this key are managed by setup key only and can't be edited individually
+	ManagedPeers *bool `json:"managed_peers,omitempty"`
+
 	// Name Setup Key name
 	Name string `json:"name"`
 
+	// PeerExpirationDefaults Login and inactivity expiration flags new peers are registered with. For the user peer defaults an omitted value enables both expirations, for the setup key peer defaults it disables both.
+	PeerExpirationDefaults *PeerExpirationDefaults `json:"peer_expiration_defaults,omitempty"`
+
+	// RequestableGroups List of group IDs registering peers may request in addition to the auto groups. Requires the permission to update groups
+	RequestableGroups *[]string `json:"requestable_groups,omitempty"`
+
+	// RequiresApproval Peers registered with this key require manual approval before they join the network
+	RequiresApproval *bool `json:"requires_approval,omitempty"`
+
 	// Type Setup key type, one-off for single time usage and reusable
 	Type string `json:"type"`
 
@@ -640,6 +788,18 @@ type GeoLocationCheck struct {
 // GeoLocationCheckAction Action to take upon policy match
 type GeoLocationCheckAction string
 
+// GeoLocationDatabaseInfo Build and version metadata of the geolocation databases used by the server
+type GeoLocationDatabaseInfo struct {
+	// GeonamesSnapshotDate Date of the GeoNames database snapshot, empty when it can't be determined
+	GeonamesSnapshotDate string `json:"geonames_snapshot_date"`
+
+	// MmdbBuildTime Build time of the MaxMind database
+	MmdbBuildTime time.Time `json:"mmdb_build_time"`
+
+	// MmdbType Type of the MaxMind database
+	MmdbType string `json:"mmdb_type"`
+}
+
 // Group defines model for Group.
 type Group struct {
 	// Id Group ID
@@ -651,6 +811,9 @@ type Group struct {
 	// Name Group Name identifier
 	Name string `json:"name"`
 
+	// PeerLoginExpiration Overrides the account peer login expiration for the peers of the group (seconds). When a peer is a member of several groups with an override, the shortest one applies. An override can only shorten the account setting, a longer one is capped to it. Omitted or 0 uses the account setting.
+	PeerLoginExpiration *int `json:"peer_login_expiration,omitempty"`
+
 	// Peers List of peers object
 	Peers []PeerMinimum `json:"peers"`
 
@@ -691,6 +854,9 @@ type GroupRequest struct {
 	// Name Group name identifier
 	Name string `json:"name"`
 
+	// PeerLoginExpiration Overrides the account peer login expiration for the peers of the group (seconds). When a peer is a member of several groups with an override, the shortest one applies. An override can only shorten the account setting, a longer one is capped to it. Omitted or 0 uses the account setting.
+	PeerLoginExpiration *int `json:"peer_login_expiration,omitempty"`
+
 	// Peers List of peers ids
 	Peers     *[]string   `json:"peers,omitempty"`
 	Resources *[]Resource `json:"resources,omitempty"`
@@ -1289,6 +1455,9 @@ type PasswordChangeRequest struct {
 
 // Peer defines model for Peer.
 type Peer struct {
+	// AdminNotes Internal notes about the peer. Only returned to admins
+	AdminNotes *string `json:"admin_notes,omitempty"`
+
 	// ApprovalRequired (Cloud only) Indicates whether peer needs approval
 	ApprovalRequired bool `json:"approval_required"`
 
@@ -1301,12 +1470,18 @@ type Peer struct {
 	// ConnectionIp Peer's public connection IP address
 	ConnectionIp string `json:"connection_ip"`
 
+	// ConnectionPort Source port the peer connected to management from. Behind a reverse proxy or relay it is taken from the X-Real-Port header, 0 when unknown. Only returned to admins
+	ConnectionPort *int `json:"connection_port,omitempty"`
+
 	// CountryCode 2-letter ISO 3166-1 alpha-2 code that represents the country
 	CountryCode CountryCode `json:"country_code"`
 
 	// CreatedAt Peer creation date (UTC)
 	CreatedAt time.Time `json:"created_at"`
 
+	// Description Free-form human-readable description of the peer
+	Description *string `json:"description,omitempty"`
+
 	// DisapprovalReason (Cloud only) Reason why the peer requires approval
 	DisapprovalReason *string `json:"disapproval_reason,omitempty"`
 
@@ -1319,12 +1494,18 @@ type Peer struct {
 	// ExtraDnsLabels Extra DNS labels added to the peer
 	ExtraDnsLabels []string `json:"extra_dns_labels"`
 
+	// FirstConnectedAt Time the peer connected to the management service for the first time (UTC). Not set if the peer never connected
+	FirstConnectedAt *time.Time `json:"first_connected_at,omitempty"`
+
 	// GeonameId Unique identifier from the GeoNames database for a specific geographical location.
 	GeonameId int `json:"geoname_id"`
 
 	// Groups Groups that the peer belongs to
 	Groups []GroupMinimum `json:"groups"`
 
+	// HandshakeStale Indicates that the peer is connected to the management service but hasn't reported a recent WireGuard handshake
+	HandshakeStale bool `json:"handshake_stale"`
+
 	// Hostname Hostname of the machine
 	Hostname string `json:"hostname"`
 
@@ -1340,6 +1521,9 @@ type Peer struct {
 	// KernelVersion Peer's operating system kernel version
 	KernelVersion string `json:"kernel_version"`
 
+	// LastHandshake Last WireGuard handshake with any remote peer reported by the peer. Not set if the peer hasn't reported one
+	LastHandshake *time.Time `json:"last_handshake,omitempty"`
+
 	// LastLogin Last time this peer performed log in (authentication). E.g., user authenticated.
 	LastLogin time.Time `json:"last_login"`
 
@@ -1347,18 +1531,33 @@ type Peer struct {
 	LastSeen   time.Time       `json:"last_seen"`
 	LocalFlags *PeerLocalFlags `json:"local_flags,omitempty"`
 
+	// LocalNetworks Local network addresses reported by the peer. Only returned to admins
+	LocalNetworks *[]PeerLocalNetwork `json:"local_networks,omitempty"`
+
 	// LoginExpirationEnabled Indicates whether peer login expiration has been enabled or not
 	LoginExpirationEnabled bool `json:"login_expiration_enabled"`
 
 	// LoginExpired Indicates whether peer's login expired or not
 	LoginExpired bool `json:"login_expired"`
 
+	// ManagedBySetupKeyOnly Indicates that the peer is managed by its setup key only and can't be edited individually
+	ManagedBySetupKeyOnly bool `json:"managed_by_setup_key_only"`
+
 	// Name Peer's hostname
 	Name string `json:"name"`
 
 	// Os Peer's operating system and version
 	Os string `json:"os"`
 
+	// OwnerEmail Email of the user that enrolled this peer. It is refreshed when the peer logs in and may lag behind the identity provider in between
+	OwnerEmail *string `json:"owner_email,omitempty"`
+
+	// PendingApprovalSince (Cloud only) Time the peer started requiring approval. Not set if the peer doesn't require approval
+	PendingApprovalSince *time.Time `json:"pending_approval_since,omitempty"`
+
+	// ReportedErrors The most recent errors and warnings reported by the peer, oldest first. Only returned to admins
+	ReportedErrors *[]PeerReportedError `json:"reported_errors,omitempty"`
+
 	// SerialNumber System serial number
 	SerialNumber string `json:"serial_number"`
 
@@ -1380,6 +1579,9 @@ type PeerBatch struct {
 	// AccessiblePeersCount Number of accessible peers
 	AccessiblePeersCount int `json:"accessible_peers_count"`
 
+	// AdminNotes Internal notes about the peer. Only returned to admins
+	AdminNotes *string `json:"admin_notes,omitempty"`
+
 	// ApprovalRequired (Cloud only) Indicates whether peer needs approval
 	ApprovalRequired bool `json:"approval_required"`
 
@@ -1392,12 +1594,18 @@ type PeerBatch struct {
 	// ConnectionIp Peer's public connection IP address
 	ConnectionIp string `json:"connection_ip"`
 
+	// ConnectionPort Source port the peer connected to management from. Behind a reverse proxy or relay it is taken from the X-Real-Port header, 0 when unknown. Only returned to admins
+	ConnectionPort *int `json:"connection_port,omitempty"`
+
 	// CountryCode 2-letter ISO 3166-1 alpha-2 code that represents the country
 	CountryCode CountryCode `json:"country_code"`
 
 	// CreatedAt Peer creation date (UTC)
 	CreatedAt time.Time `json:"created_at"`
 
+	// Description Free-form human-readable description of the peer
+	Description *string `json:"description,omitempty"`
+
 	// DisapprovalReason (Cloud only) Reason why the peer requires approval
 	DisapprovalReason *string `json:"disapproval_reason,omitempty"`
 
@@ -1410,12 +1618,18 @@ type PeerBatch struct {
 	// ExtraDnsLabels Extra DNS labels added to the peer
 	ExtraDnsLabels []string `json:"extra_dns_labels"`
 
+	// FirstConnectedAt Time the peer connected to the management service for the first time (UTC). Not set if the peer never connected
+	FirstConnectedAt *time.Time `json:"first_connected_at,omitempty"`
+
 	// GeonameId Unique identifier from the GeoNames database for a specific geographical location.
 	GeonameId int `json:"geoname_id"`
 
 	// Groups Groups that the peer belongs to
 	Groups []GroupMinimum `json:"groups"`
 
+	// HandshakeStale Indicates that the peer is connected to the management service but hasn't reported a recent WireGuard handshake
+	HandshakeStale bool `json:"handshake_stale"`
+
 	// Hostname Hostname of the machine
 	Hostname string `json:"hostname"`
 
@@ -1431,6 +1645,9 @@ type PeerBatch struct {
 	// KernelVersion Peer's operating system kernel version
 	KernelVersion string `json:"kernel_version"`
 
+	// LastHandshake Last WireGuard handshake with any remote peer reported by the peer. Not set if the peer hasn't reported one
+	LastHandshake *time.Time `json:"last_handshake,omitempty"`
+
 	// LastLogin Last time this peer performed log in (authentication). E.g., user authenticated.
 	LastLogin time.Time `json:"last_login"`
 
@@ -1438,18 +1655,33 @@ type PeerBatch struct {
 	LastSeen   time.Time       `json:"last_seen"`
 	LocalFlags *PeerLocalFlags `json:"local_flags,omitempty"`
 
+	// LocalNetworks Local network addresses reported by the peer. Only returned to admins
+	LocalNetworks *[]PeerLocalNetwork `json:"local_networks,omitempty"`
+
 	// LoginExpirationEnabled Indicates whether peer login expiration has been enabled or not
 	LoginExpirationEnabled bool `json:"login_expiration_enabled"`
 
 	// LoginExpired Indicates whether peer's login expired or not
 	LoginExpired bool `json:"login_expired"`
 
+	// ManagedBySetupKeyOnly Indicates that the peer is managed by its setup key only and can't be edited individually
+	ManagedBySetupKeyOnly bool `json:"managed_by_setup_key_only"`
+
 	// Name Peer's hostname
 	Name string `json:"name"`
 
 	// Os Peer's operating system and version
 	Os string `json:"os"`
 
+	// OwnerEmail Email of the user that enrolled this peer. It is refreshed when the peer logs in and may lag behind the identity provider in between
+	OwnerEmail *string `json:"owner_email,omitempty"`
+
+	// PendingApprovalSince (Cloud only) Time the peer started requiring approval. Not set if the peer doesn't require approval
+	PendingApprovalSince *time.Time `json:"pending_approval_since,omitempty"`
+
+	// ReportedErrors The most recent errors and warnings reported by the peer, oldest first. Only returned to admins
+	ReportedErrors *[]PeerReportedError `json:"reported_errors,omitempty"`
+
 	// SerialNumber System serial number
 	SerialNumber string `json:"serial_number"`
 
@@ -1466,6 +1698,51 @@ type PeerBatch struct {
 	Version string `json:"version"`
 }
 
+// PeerExpirationDefaults Login and inactivity expiration flags new peers are registered with. For the user peer defaults an omitted value enables both expirations, for the setup key peer defaults it disables both.
+type PeerExpirationDefaults struct {
+	// InactivityExpirationEnabled Enables the inactivity expiration of the new peers
+	InactivityExpirationEnabled bool `json:"inactivity_expiration_enabled"`
+
+	// LoginExpirationEnabled Enables the login expiration of the new peers
+	LoginExpirationEnabled bool `json:"login_expiration_enabled"`
+}
+
+// PeerFirewallOverride defines model for PeerFirewallOverride.
+type PeerFirewallOverride struct {
+	// Action Accept or drop the matching traffic
+	Action PeerFirewallOverrideAction `json:"action"`
+
+	// Direction Direction of the traffic relative to the peer
+	Direction PeerFirewallOverrideDirection `json:"direction"`
+
+	// PeerIp IP of the remote peer the rule applies to, 0.0.0.0 matches all peers
+	PeerIp string `json:"peer_ip"`
+
+	// Port Port of the traffic, only for tcp and udp protocols. Can't be combined with port_range
+	Port *string `json:"port,omitempty"`
+
+	// PortRange Policy rule affected ports range
+	PortRange *RulePortRange `json:"port_range,omitempty"`
+
+	// Protocol Type of the traffic
+	Protocol PeerFirewallOverrideProtocol `json:"protocol"`
+}
+
+// PeerFirewallOverrideAction Accept or drop the matching traffic
+type PeerFirewallOverrideAction string
+
+// PeerFirewallOverrideDirection Direction of the traffic relative to the peer
+type PeerFirewallOverrideDirection string
+
+// PeerFirewallOverrideProtocol Type of the traffic
+type PeerFirewallOverrideProtocol string
+
+// PeerFirewallOverridesRequest defines model for PeerFirewallOverridesRequest.
+type PeerFirewallOverridesRequest struct {
+	// Overrides Firewall rules scoped to the peer, replacing the existing ones. Overrides replace the policy rules whose traffic they fully cover: same direction, same remote peer or all peers, same protocol or all protocols, and ports contained in the override ports
+	Overrides []PeerFirewallOverride `json:"overrides"`
+}
+
 // PeerLocalFlags defines model for PeerLocalFlags.
 type PeerLocalFlags struct {
 	// BlockInbound Indicates whether inbound traffic is blocked on this peer
@@ -1499,6 +1776,21 @@ type PeerLocalFlags struct {
 	ServerSshAllowed *bool `json:"server_ssh_allowed,omitempty"`
 }
 
+// PeerLocalNetwork defines model for PeerLocalNetwork.
+type PeerLocalNetwork struct {
+	// Address Address of the network interface with the prefix length of its local subnet
+	Address string `json:"address"`
+
+	// Mac MAC address of the network interface
+	Mac string `json:"mac"`
+}
+
+// PeerLoginsRenewResponse defines model for PeerLoginsRenewResponse.
+type PeerLoginsRenewResponse struct {
+	// RenewedPeers Number of peers whose expired login was renewed
+	RenewedPeers int `json:"renewed_peers"`
+}
+
 // PeerMinimum defines model for PeerMinimum.
 type PeerMinimum struct {
 	// Id Peer ID
@@ -1520,11 +1812,38 @@ type PeerNetworkRangeCheck struct {
 // PeerNetworkRangeCheckAction Action to take upon policy match
 type PeerNetworkRangeCheckAction string
 
+// PeerPinRequest defines model for PeerPinRequest.
+type PeerPinRequest struct {
+	// Pinned Indicates whether the peer should be pinned to the top of the peer listings of the requesting user
+	Pinned bool `json:"pinned"`
+}
+
+// PeerReportedError defines model for PeerReportedError.
+type PeerReportedError struct {
+	// Level Severity of the error
+	Level PeerReportedErrorLevel `json:"level"`
+
+	// Message Error message reported by the peer, truncated to 512 bytes
+	Message string `json:"message"`
+
+	// Time Time the peer ran into the error (UTC)
+	Time time.Time `json:"time"`
+}
+
+// PeerReportedErrorLevel Severity of the error
+type PeerReportedErrorLevel string
+
 // PeerRequest defines model for PeerRequest.
 type PeerRequest struct {
+	// AdminNotes Internal notes about the peer. Only visible to admins and never sent to the peer. Not changed when omitted.
+	AdminNotes *string `json:"admin_notes,omitempty"`
+
 	// ApprovalRequired (Cloud only) Indicates whether peer needs approval
-	ApprovalRequired            *bool `json:"approval_required,omitempty"`
-	InactivityExpirationEnabled bool  `json:"inactivity_expiration_enabled"`
+	ApprovalRequired *bool `json:"approval_required,omitempty"`
+
+	// Description Free-form human-readable description of the peer. It is not used for DNS resolution.
+	Description                 *string `json:"description,omitempty"`
+	InactivityExpirationEnabled bool    `json:"inactivity_expiration_enabled"`
 
 	// Ip Peer's IP address
 	Ip                     *string `json:"ip,omitempty"`
@@ -1952,6 +2271,9 @@ type SetupKey struct {
 	// AllowExtraDnsLabels Allow extra DNS labels to be added to the peer
 	AllowExtraDnsLabels bool `json:"allow_extra_dns_labels"`
 
+	// AllowOutdatedOsVersion Peers registered with this key are exempt from the account minimum OS versions, e.g. for lab machines
+	AllowOutdatedOsVersion bool `json:"allow_outdated_os_version"`
+
 	// AutoGroups List of group IDs to auto-assign to peers registered with this key
 	AutoGroups []string `json:"auto_groups"`
 
@@ -1970,9 +2292,21 @@ type SetupKey struct {
 	// LastUsed Setup key last usage date
 	LastUsed time.Time `json:"last_used"`
 
+	// ManagedPeers Peers registered with this key are managed by setup key only and can't be edited individually
+	ManagedPeers bool `json:"managed_peers"`
+
 	// Name Setup key name identifier
 	Name string `json:"name"`
 
+	// PeerExpirationDefaults Login and inactivity expiration flags new peers are registered with. For the user peer defaults an omitted value enables both expirations, for the setup key peer defaults it disables both.
+	PeerExpirationDefaults *PeerExpirationDefaults `json:"peer_expiration_defaults,omitempty"`
+
+	// RequestableGroups List of group IDs registering peers may request in addition to the auto groups. Requested groups outside of this list are rejected
+	RequestableGroups *[]string `json:"requestable_groups,omitempty"`
+
+	// RequiresApproval Peers registered with this key require manual approval before they join the network
+	RequiresApproval bool `json:"requires_approval"`
+
 	// Revoked Setup key revocation status
 	Revoked bool `json:"revoked"`
 
@@ -2000,6 +2334,9 @@ type SetupKeyBase struct {
 	// AllowExtraDnsLabels Allow extra DNS labels to be added to the peer
 	AllowExtraDnsLabels bool `json:"allow_extra_dns_labels"`
 
+	// AllowOutdatedOsVersion Peers registered with this key are exempt from the account minimum OS versions, e.g. for lab machines
+	AllowOutdatedOsVersion bool `json:"allow_outdated_os_version"`
+
 	// AutoGroups List of group IDs to auto-assign to peers registered with this key
 	AutoGroups []string `json:"auto_groups"`
 
@@ -2015,9 +2352,21 @@ type SetupKeyBase struct {
 	// LastUsed Setup key last usage date
 	LastUsed time.Time `json:"last_used"`
 
+	// ManagedPeers Peers registered with this key are managed by setup key only and can't be edited individually
+	ManagedPeers bool `json:"managed_peers"`
+
 	// Name Setup key name identifier
 	Name string `json:"name"`
 
+	// PeerExpirationDefaults Login and inactivity expiration flags new peers are registered with. For the user peer defaults an omitted value enables both expirations, for the setup key peer defaults it disables both.
+	PeerExpirationDefaults *PeerExpirationDefaults `json:"peer_expiration_defaults,omitempty"`
+
+	// RequestableGroups List of group IDs registering peers may request in addition to the auto groups. Requested groups outside of this list are rejected
+	RequestableGroups *[]string `json:"requestable_groups,omitempty"`
+
+	// RequiresApproval Peers registered with this key require manual approval before they join the network
+	RequiresApproval bool `json:"requires_approval"`
+
 	// Revoked Setup key revocation status
 	Revoked bool `json:"revoked"`
 
@@ -2045,6 +2394,9 @@ type SetupKeyClear struct {
 	// AllowExtraDnsLabels Allow extra DNS labels to be added to the peer
 	AllowExtraDnsLabels bool `json:"allow_extra_dns_labels"`
 
+	// AllowOutdatedOsVersion Peers registered with this key are exempt from the account minimum OS versions, e.g. for lab machines
+	AllowOutdatedOsVersion bool `json:"allow_outdated_os_version"`
+
 	// AutoGroups List of group IDs to auto-assign to peers registered with this key
 	AutoGroups []string `json:"auto_groups"`
 
@@ -2063,9 +2415,21 @@ type SetupKeyClear struct {
 	// LastUsed Setup key last usage date
 	LastUsed time.Time `json:"last_used"`
 
+	// ManagedPeers Peers registered with this key are managed by setup key only and can't be edited individually
+	ManagedPeers bool `json:"managed_peers"`
+
 	// Name Setup key name identifier
 	Name string `json:"name"`
 
+	// PeerExpirationDefaults Login and inactivity expiration flags new peers are registered with. For the user peer defaults an omitted value enables both expirations, for the setup key peer defaults it disables both.
+	PeerExpirationDefaults *PeerExpirationDefaults `json:"peer_expiration_defaults,omitempty"`
+
+	// RequestableGroups List of group IDs registering peers may request in addition to the auto groups. Requested groups outside of this list are rejected
+	RequestableGroups *[]string `json:"requestable_groups,omitempty"`
+
+	// RequiresApproval Peers registered with this key require manual approval before they join the network
+	RequiresApproval bool `json:"requires_approval"`
+
 	// Revoked Setup key revocation status
 	Revoked bool `json:"revoked"`
 
@@ -2093,6 +2457,9 @@ type SetupKeyRequest struct {
 	// AutoGroups List of group IDs to auto-assign to peers registered with this key
 	AutoGroups []string `json:"auto_groups"`
 
+	// RequestableGroups List of group IDs registering peers may request in addition to the auto groups. Keeps the current list when omitted
+	RequestableGroups *[]string `json:"requestable_groups,omitempty"`
+
 	// Revoked Setup key revocation status
 	Revoked bool `json:"revoked"`
 }
@@ -2411,6 +2778,27 @@ type GetApiPeersParams struct {
 
 	// Ip Filter peers by IP address
 	Ip *string `form:"ip,omitempty" json:"ip,omitempty"`
+
+	// HandshakeStale Filter peers by whether they are connected to the management service without a recent WireGuard handshake
+	HandshakeStale *bool `form:"handshake_stale,omitempty" json:"handshake_stale,omitempty"`
+
+	// Ephemeral Filter ephemeral peers when true or persistent peers when false
+	Ephemeral *bool `form:"ephemeral,omitempty" json:"ephemeral,omitempty"`
+
+	// GroupId Filter peers that are members of the group
+	GroupId *string `form:"group_id,omitempty" json:"group_id,omitempty"`
+
+	// ExcludeGroupId Filter peers that are not members of the group
+	ExcludeGroupId *string `form:"exclude_group_id,omitempty" json:"exclude_group_id,omitempty"`
+
+	// PinnedFirst List the peers pinned by the requesting user first
+	PinnedFirst *bool `form:"pinned_first,omitempty" json:"pinned_first,omitempty"`
+}
+
+// PutApiPeersPeerIdParams defines parameters for PutApiPeersPeerId.
+type PutApiPeersPeerIdParams struct {
+	// Strict Reject the request with a bad request error when it sets a field that can't be changed with a peer update, instead of ignoring the field
+	Strict *bool `form:"strict,omitempty" json:"strict,omitempty"`
 }
 
 // GetApiPeersPeerIdIngressPortsParams defines parameters for GetApiPeersPeerIdIngressPorts.
@@ -2488,6 +2876,9 @@ type PutApiNetworksNetworkIdRoutersRouterIdJSONRequestBody = NetworkRouterReques
 // PutApiPeersPeerIdJSONRequestBody defines body for PutApiPeersPeerId for application/json ContentType.
 type PutApiPeersPeerIdJSONRequestBody = PeerRequest
 
+// PutApiPeersPeerIdFirewallOverridesJSONRequestBody defines body for PutApiPeersPeerIdFirewallOverrides for application/json ContentType.
+type PutApiPeersPeerIdFirewallOverridesJSONRequestBody = PeerFirewallOverridesRequest
+
 // PostApiPeersPeerIdIngressPortsJSONRequestBody defines body for PostApiPeersPeerIdIngressPorts for application/json ContentType.
 type PostApiPeersPeerIdIngressPortsJSONRequestBody = IngressPortAllocationRequest
 
@@ -2497,6 +2888,9 @@ type PutApiPeersPeerIdIngressPortsAllocationIdJSONRequestBody = IngressPortAlloc
 // PostApiPeersPeerIdJobsJSONRequestBody defines body for PostApiPeersPeerIdJobs for application/json ContentType.
 type PostApiPeersPeerIdJobsJSONRequestBody = JobRequest
 
+// PutApiPeersPeerIdPinJSONRequestBody defines body for PutApiPeersPeerIdPin for application/json ContentType.
+type PutApiPeersPeerIdPinJSONRequestBody = PeerPinRequest
+
 // PostApiPeersPeerIdTemporaryAccessJSONRequestBody defines body for PostApiPeersPeerIdTemporaryAccess for application/json ContentType.
 type PostApiPeersPeerIdTemporaryAccessJSONRequestBody = PeerTemporaryAccessRequest
 
@@ -108,6 +108,8 @@ func WriteError(ctx context.Context, err error, w http.ResponseWriter) {
 			httpStatus = http.StatusBadRequest
 		case status.TooManyRequests:
 			httpStatus = http.StatusTooManyRequests
+		case status.Unavailable:
+			httpStatus = http.StatusServiceUnavailable
 		default:
 		}
 		msg = strings.ToLower(err.Error())
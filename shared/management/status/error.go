@@ -40,6 +40,9 @@ const (
 
 	// TooManyRequests indicates that the user has sent too many requests in a given amount of time (rate limiting)
 	TooManyRequests Type = 11
+
+	// Unavailable indicates that the service is temporarily unable to handle the request, e.g. due to overload
+	Unavailable Type = 12
 )
 
 // Type is a type of the Error
@@ -141,6 +144,11 @@ func NewSetupKeyNotFoundError(setupKeyID string) error {
 	return Errorf(NotFound, "setup key: %s not found", setupKeyID)
 }
 
+// NewSetupKeyRevokedError creates a new Error with PreconditionFailed type for a setup key revoked during peer registration
+func NewSetupKeyRevokedError() error {
+	return Errorf(PreconditionFailed, "couldn't add peer: setup key has been revoked")
+}
+
 func NewGetAccountFromStoreError(err error) error {
 	return Errorf(Internal, "issue getting account from store: %s", err)
 }